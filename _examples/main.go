@@ -9,10 +9,11 @@ import (
 
 func main() {
 	test := fs.New(path.Join(os.TempDir(), "go-fs-test.lock"))
-	fmt.Println(test)
+	fmt.Println(test) // should be ".../go-fs-test.lock: unlocked"
 
 	err := test.Lock()
-	fmt.Println(err) // should be nil
+	fmt.Println(err)  // should be nil
+	fmt.Println(test) // should be ".../go-fs-test.lock: locked by pid ..."
 
 	err = test.Lock()
 	fmt.Println(err)             // should be ErrLockHeld
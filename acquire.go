@@ -0,0 +1,90 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// AcquireAll concurrently acquires every lock, retrying locks held by others until
+// ctx is done. It returns a MultiLock holding all of them, or releases the locks
+// already acquired and returns the errors of the locks that failed, joined.
+// The first failure cancels the remaining acquisitions, like an errgroup would.
+//
+// The locks are independent: unlike AcquireGlob they are not taken in a global
+// order, so sets that overlap with other AcquireAll calls may contend until ctx is
+// done but never deadlock. It can be called from an errgroup goroutine with the
+// context of the group.
+func AcquireAll(ctx context.Context, locks ...filelock.FileLock) (*MultiLock, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	errs := make([]error, len(locks))
+	var wg sync.WaitGroup
+	for i, lock := range locks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := lockContext(ctx, lock); err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	m := &MultiLock{}
+	var failed []error
+	canceled := false
+	for i, lock := range locks {
+		switch {
+		case errs[i] == nil:
+			m.locks = append(m.locks, lock)
+			m.paths = append(m.paths, lock.Path())
+		case errors.Is(errs[i], context.Canceled), errors.Is(errs[i], context.DeadlineExceeded):
+			canceled = true
+		default:
+			failed = append(failed, errs[i])
+		}
+	}
+	// Acquisitions canceled because another one failed are not failures, the
+	// end of the parent context is reported once
+	if canceled && parent.Err() != nil {
+		failed = append(failed, context.Cause(parent))
+	}
+	if len(failed) > 0 {
+		_ = m.Unlock()
+		return nil, errors.Join(failed...)
+	}
+	sort.Strings(m.paths)
+	return m, nil
+}
+
+// lockContext acquires lock, retrying with exponential backoff while it is held by
+// someone else, until ctx is done
+func lockContext(ctx context.Context, lock filelock.FileLock) error {
+	retryInterval := time.Millisecond * 10
+	for {
+		err := lock.Lock()
+		if !errors.Is(err, filelock.ErrLockHeld) {
+			return err
+		}
+
+		timer := time.NewTimer(retryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if retryInterval < time.Millisecond*100 {
+			retryInterval = time.Duration(float64(retryInterval) * 1.5)
+		}
+	}
+}
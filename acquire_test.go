@@ -0,0 +1,117 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// AcquireAllTestSuite defines a test suite for concurrent lock acquisition
+type AcquireAllTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for lock files before each test
+func (s *AcquireAllTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "acquire-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *AcquireAllTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *AcquireAllTestSuite) newLocks(names ...string) []filelock.FileLock {
+	var locks []filelock.FileLock
+	for _, name := range names {
+		locks = append(locks, New(filepath.Join(s.tempDir, name)))
+	}
+	return locks
+}
+
+// TestAcquireAll tests that every lock is held until the MultiLock is released
+func (s *AcquireAllTestSuite) TestAcquireAll() {
+	locks := s.newLocks("c.lock", "a.lock", "b.lock")
+	m, err := AcquireAll(context.Background(), locks...)
+	s.Require().NoError(err)
+
+	s.Assert().Equal([]string{
+		filepath.Join(s.tempDir, "a.lock"),
+		filepath.Join(s.tempDir, "b.lock"),
+		filepath.Join(s.tempDir, "c.lock"),
+	}, m.Paths())
+	for _, lock := range locks {
+		s.Assert().True(lock.IsLocked())
+	}
+
+	s.Require().NoError(m.Unlock())
+	for _, lock := range locks {
+		s.Assert().False(lock.IsLocked())
+	}
+}
+
+// TestWaitsForHeldLock tests that a lock held by someone else is retried until released
+func (s *AcquireAllTestSuite) TestWaitsForHeldLock() {
+	other := New(filepath.Join(s.tempDir, "b.lock"))
+	s.Require().NoError(other.Lock())
+	time.AfterFunc(50*time.Millisecond, func() { _ = other.Unlock() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m, err := AcquireAll(ctx, s.newLocks("a.lock", "b.lock")...)
+	s.Require().NoError(err)
+	s.Require().NoError(m.Unlock())
+}
+
+// TestDeadlineReleasesPartial tests that the acquired locks are released when ctx ends
+func (s *AcquireAllTestSuite) TestDeadlineReleasesPartial() {
+	other := New(filepath.Join(s.tempDir, "b.lock"))
+	s.Require().NoError(other.Lock())
+	defer other.Unlock()
+
+	locks := s.newLocks("a.lock", "b.lock", "c.lock")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	m, err := AcquireAll(ctx, locks...)
+
+	s.Assert().Nil(m)
+	s.Assert().ErrorIs(err, context.DeadlineExceeded)
+	for _, lock := range locks {
+		s.Assert().False(lock.IsLocked())
+	}
+}
+
+// TestFailureCancelsOthers tests that a failed acquisition stops the others
+func (s *AcquireAllTestSuite) TestFailureCancelsOthers() {
+	other := New(filepath.Join(s.tempDir, "held.lock"))
+	s.Require().NoError(other.Lock())
+	defer other.Unlock()
+
+	locks := s.newLocks("held.lock", "free.lock")
+	locks = append(locks, New(filepath.Join(s.tempDir, "missing", "x.lock")))
+
+	start := time.Now()
+	m, err := AcquireAll(context.Background(), locks...)
+	s.Assert().Nil(m)
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+	s.Assert().False(errors.Is(err, context.Canceled), "canceled acquisitions are not reported")
+	s.Assert().Less(time.Since(start), 5*time.Second)
+	for _, lock := range locks {
+		s.Assert().False(lock.IsLocked())
+	}
+}
+
+// TestAcquireAll runs the test suite
+func TestAcquireAll(t *testing.T) {
+	suite.Run(t, new(AcquireAllTestSuite))
+}
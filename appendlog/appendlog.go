@@ -0,0 +1,158 @@
+// Package appendlog appends records to a file shared by several processes,
+// such as a common log file, without ever interleaving them.
+//
+// Every write takes an exclusive lock on a separate lock file, so records are
+// never mixed even when they are larger than the size for which O_APPEND writes
+// are atomic, or on file systems where O_APPEND is not atomic at all (NFS).
+// Under the lock, the writer also checks that the path still refers to the file
+// it has open, and reopens it otherwise, so it follows rotations made by Rotate
+// or by other cooperating tools.
+package appendlog
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// DefaultTimeout is the default time a write waits for the lock
+const DefaultTimeout = 10 * time.Second
+
+// Writer appends records to a shared file
+type Writer struct {
+	path    string
+	perm    os.FileMode
+	timeout time.Duration
+	lock    filelock.FileLock
+	file    *os.File
+	mutex   sync.Mutex
+}
+
+// Option configures a Writer
+type Option func(*Writer)
+
+// WithPerm sets the permission bits used when creating the file, 0644 by default
+func WithPerm(perm os.FileMode) Option {
+	return func(w *Writer) {
+		w.perm = perm
+	}
+}
+
+// WithTimeout sets how long a write waits for the lock, DefaultTimeout by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(w *Writer) {
+		w.timeout = timeout
+	}
+}
+
+// Open opens the shared file at path for appending, creating it if needed
+// The lock file is fs.LockPath(path)
+func Open(path string, opts ...Option) (*Writer, error) {
+	w := &Writer{
+		path:    path,
+		perm:    0644,
+		timeout: DefaultTimeout,
+		lock:    fs.New(fs.LockPath(path)),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Path returns the path of the shared file
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Write appends p as a single record
+func (w *Writer) Write(p []byte) (int, error) {
+	n := 0
+	err := w.locked(func() error {
+		var err error
+		n, err = w.file.Write(p)
+		return err
+	})
+	return n, err
+}
+
+// WriteBatch appends several records under a single lock acquisition
+// The records are written in order and contiguously
+func (w *Writer) WriteBatch(records ...[]byte) error {
+	return w.locked(func() error {
+		for _, record := range records {
+			if _, err := w.file.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the shared file
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// locked runs fn holding the file lock, with the file reopened if it was rotated
+func (w *Writer) locked(fn func() error) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+
+	if err := w.lock.LockWithTimeout(w.timeout); err != nil {
+		return err
+	}
+	defer w.lock.Unlock()
+
+	if err := w.reopenIfRotated(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// reopenIfRotated reopens the file if path no longer refers to the open file
+func (w *Writer) reopenIfRotated() error {
+	current, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	onDisk, err := os.Stat(w.path)
+	if err == nil && os.SameFile(current, onDisk) {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	_ = w.file.Close()
+	w.file = nil
+	return w.open()
+}
+
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.perm)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	return nil
+}
@@ -0,0 +1,126 @@
+package appendlog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// AppendLogTestSuite defines a test suite for the shared appender
+type AppendLogTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *AppendLogTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "appendlog-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *AppendLogTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestRecordsAreNotInterleaved tests that large concurrent records stay whole
+func (s *AppendLogTestSuite) TestRecordsAreNotInterleaved() {
+	path := filepath.Join(s.tempDir, "shared.log")
+	const numWriters, numRecords = 4, 25
+
+	var wg sync.WaitGroup
+	for w := 0; w < numWriters; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			writer, err := Open(path)
+			if !s.Assert().NoError(err) {
+				return
+			}
+			defer writer.Close()
+
+			// Records larger than the pipe buffer size
+			record := []byte(strings.Repeat(fmt.Sprint(w), 64*1024) + "\n")
+			for i := 0; i < numRecords; i++ {
+				_, err := writer.Write(record)
+				s.Assert().NoError(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	file, err := os.Open(path)
+	s.Require().NoError(err)
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 128*1024), 128*1024)
+	lines := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		s.Require().Len(line, 64*1024)
+		s.Require().Equal(bytes.Repeat(line[:1], len(line)), line, "interleaved record")
+		lines++
+	}
+	s.Require().NoError(scanner.Err())
+	s.Assert().Equal(numWriters*numRecords, lines)
+}
+
+// TestWriteBatch tests that a batch is written contiguously
+func (s *AppendLogTestSuite) TestWriteBatch() {
+	path := filepath.Join(s.tempDir, "batch.log")
+	writer, err := Open(path)
+	s.Require().NoError(err)
+	defer writer.Close()
+
+	s.Require().NoError(writer.WriteBatch([]byte("a\n"), []byte("b\n")))
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("a\nb\n", string(data))
+}
+
+// TestFollowsRotation tests that writes go to the new file after a rotation
+func (s *AppendLogTestSuite) TestFollowsRotation() {
+	path := filepath.Join(s.tempDir, "rotated.log")
+	writer, err := Open(path)
+	s.Require().NoError(err)
+	defer writer.Close()
+
+	_, err = writer.Write([]byte("before\n"))
+	s.Require().NoError(err)
+	s.Require().NoError(os.Rename(path, path+".1"))
+
+	_, err = writer.Write([]byte("after\n"))
+	s.Require().NoError(err)
+
+	old, err := os.ReadFile(path + ".1")
+	s.Require().NoError(err)
+	s.Assert().Equal("before\n", string(old))
+
+	current, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("after\n", string(current))
+}
+
+// TestWriteAfterClose tests that a closed writer refuses writes
+func (s *AppendLogTestSuite) TestWriteAfterClose() {
+	writer, err := Open(filepath.Join(s.tempDir, "closed.log"))
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+
+	_, err = writer.Write([]byte("x"))
+	s.Assert().ErrorIs(err, os.ErrClosed)
+}
+
+// TestAppendLog runs the test suite
+func TestAppendLog(t *testing.T) {
+	suite.Run(t, new(AppendLogTestSuite))
+}
@@ -0,0 +1,187 @@
+package appendlog
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/atomicfile"
+)
+
+// rotatedTimeFormat is the layout of the timestamp appended to rotated files.
+// It sorts lexically in chronological order.
+const rotatedTimeFormat = "20060102T150405.000000000Z"
+
+// compressedSuffix is appended to the name of compressed rotated files
+const compressedSuffix = ".gz"
+
+// Policy configures a rotation
+type Policy struct {
+	// MaxCount is the number of rotated files kept, zero keeps them all
+	MaxCount int
+
+	// MaxAge is how long rotated files are kept, zero keeps them forever
+	MaxAge time.Duration
+
+	// Compress gzips the rotated file
+	Compress bool
+
+	// Timeout is how long to wait for the lock, DefaultTimeout when zero
+	Timeout time.Duration
+}
+
+// Rotate renames the file at path to path.<UTC timestamp> under the lock used by
+// Writer, creates a new empty file in its place, and enforces the retention of the
+// policy. It returns the path of the rotated file, or an empty string if there was
+// nothing to rotate because the file is missing or empty.
+//
+// Writers of every process reopen the new file on their next write, because they
+// check under the same lock that the path still refers to the file they have open.
+// Compression and retention run after the lock is released, so they do not block writers.
+func Rotate(path string, policy Policy) (string, error) {
+	timeout := policy.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	rotated, err := rotate(path, timeout)
+	if err != nil || rotated == "" {
+		return rotated, err
+	}
+
+	if policy.Compress {
+		if rotated, err = compress(rotated); err != nil {
+			return rotated, err
+		}
+	}
+	return rotated, prune(path, policy, time.Now())
+}
+
+// rotate renames the active file under the lock and creates its replacement
+func rotate(path string, timeout time.Duration) (string, error) {
+	lock := fs.New(fs.LockPath(path))
+	if err := lock.LockWithTimeout(timeout); err != nil {
+		return "", err
+	}
+	defer lock.Unlock()
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.Size() == 0 {
+		return "", nil
+	}
+
+	rotated := path + "." + time.Now().UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(path, rotated); err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, info.Mode().Perm())
+	if err != nil {
+		return rotated, err
+	}
+	return rotated, file.Close()
+}
+
+// compress replaces path with its gzipped copy and returns the path of the copy
+func compress(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return path, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return path, err
+	}
+
+	compressed := path + compressedSuffix
+	dst, err := atomicfile.New(compressed, info.Mode().Perm())
+	if err != nil {
+		return path, err
+	}
+	defer dst.Close()
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		return path, err
+	}
+	if err := zw.Close(); err != nil {
+		return path, err
+	}
+	if err := dst.Commit(); err != nil {
+		return path, err
+	}
+	return compressed, os.Remove(path)
+}
+
+// prune removes the rotated files of path exceeding the retention of the policy
+func prune(path string, policy Policy, now time.Time) error {
+	if policy.MaxCount == 0 && policy.MaxAge == 0 {
+		return nil
+	}
+
+	rotated, err := Rotated(path)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, name := range rotated {
+		expired := policy.MaxCount > 0 && i < len(rotated)-policy.MaxCount
+		if !expired && policy.MaxAge > 0 {
+			rotatedAt, _ := rotatedTime(path, name)
+			expired = now.Sub(rotatedAt) > policy.MaxAge
+		}
+		if !expired {
+			continue
+		}
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Rotated returns the paths of the rotated files of path, compressed or not,
+// from the oldest to the newest
+func Rotated(path string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var rotated []string
+	for _, entry := range entries {
+		name := filepath.Join(filepath.Dir(path), entry.Name())
+		if _, ok := rotatedTime(path, name); ok && !entry.IsDir() {
+			rotated = append(rotated, name)
+		}
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		return strings.TrimSuffix(rotated[i], compressedSuffix) < strings.TrimSuffix(rotated[j], compressedSuffix)
+	})
+	return rotated, nil
+}
+
+// rotatedTime parses the rotation time of name, a rotated file of path
+func rotatedTime(path, name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(filepath.Base(name), filepath.Base(path)+".")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(rotatedTimeFormat, strings.TrimSuffix(stamp, compressedSuffix))
+	return t, err == nil
+}
@@ -0,0 +1,152 @@
+package appendlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// RotateTestSuite defines a test suite for the rotation helper
+type RotateTestSuite struct {
+	suite.Suite
+	tempDir string
+	path    string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *RotateTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "rotate-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.path = filepath.Join(tempDir, "app.log")
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *RotateTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestRotate tests that the active file is renamed and recreated empty
+func (s *RotateTestSuite) TestRotate() {
+	s.Require().NoError(os.WriteFile(s.path, []byte("old\n"), 0600))
+
+	rotated, err := Rotate(s.path, Policy{})
+	s.Require().NoError(err)
+
+	data, err := os.ReadFile(rotated)
+	s.Require().NoError(err)
+	s.Assert().Equal("old\n", string(data))
+
+	info, err := os.Stat(s.path)
+	s.Require().NoError(err)
+	s.Assert().Zero(info.Size())
+	s.Assert().Equal(os.FileMode(0600), info.Mode().Perm())
+}
+
+// TestRotateEmpty tests that missing and empty files are not rotated
+func (s *RotateTestSuite) TestRotateEmpty() {
+	rotated, err := Rotate(s.path, Policy{})
+	s.Require().NoError(err)
+	s.Assert().Empty(rotated)
+
+	s.Require().NoError(os.WriteFile(s.path, nil, 0644))
+	rotated, err = Rotate(s.path, Policy{})
+	s.Require().NoError(err)
+	s.Assert().Empty(rotated)
+}
+
+// TestCompress tests that rotated files are gzipped
+func (s *RotateTestSuite) TestCompress() {
+	s.Require().NoError(os.WriteFile(s.path, []byte("compress me\n"), 0644))
+
+	rotated, err := Rotate(s.path, Policy{Compress: true})
+	s.Require().NoError(err)
+	s.Assert().Equal(compressedSuffix, filepath.Ext(rotated))
+
+	file, err := os.Open(rotated)
+	s.Require().NoError(err)
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	s.Require().NoError(err)
+	data, err := io.ReadAll(zr)
+	s.Require().NoError(err)
+	s.Assert().Equal("compress me\n", string(data))
+
+	all, err := Rotated(s.path)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{rotated}, all)
+}
+
+// TestMaxCount tests that only the newest rotated files are kept
+func (s *RotateTestSuite) TestMaxCount() {
+	var kept []string
+	for i := 0; i < 4; i++ {
+		s.Require().NoError(os.WriteFile(s.path, []byte("x"), 0644))
+		rotated, err := Rotate(s.path, Policy{MaxCount: 2})
+		s.Require().NoError(err)
+		kept = append(kept, rotated)
+	}
+
+	all, err := Rotated(s.path)
+	s.Require().NoError(err)
+	s.Assert().Equal(kept[2:], all)
+}
+
+// TestMaxAge tests that rotated files older than the maximum age are removed
+func (s *RotateTestSuite) TestMaxAge() {
+	old := s.path + "." + time.Now().Add(-2*time.Hour).UTC().Format(rotatedTimeFormat) + compressedSuffix
+	s.Require().NoError(os.WriteFile(old, []byte("old"), 0644))
+	s.Require().NoError(os.WriteFile(s.path, []byte("new"), 0644))
+
+	rotated, err := Rotate(s.path, Policy{MaxAge: time.Hour})
+	s.Require().NoError(err)
+
+	all, err := Rotated(s.path)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{rotated}, all)
+}
+
+// TestRotateWhileWriting tests that no record is lost or split by concurrent rotations
+func (s *RotateTestSuite) TestRotateWhileWriting() {
+	const numRecords = 200
+	writer, err := Open(s.path)
+	s.Require().NoError(err)
+	defer writer.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < numRecords; i++ {
+			_, err := writer.Write([]byte("record\n"))
+			s.Assert().NoError(err)
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		_, err := Rotate(s.path, Policy{})
+		s.Require().NoError(err)
+	}
+	wg.Wait()
+
+	all, err := Rotated(s.path)
+	s.Require().NoError(err)
+	total := 0
+	for _, name := range append(all, s.path) {
+		data, err := os.ReadFile(name)
+		s.Require().NoError(err)
+		s.Require().Zero(len(data) % len("record\n"))
+		total += len(data) / len("record\n")
+	}
+	s.Assert().Equal(numRecords, total)
+}
+
+// TestRotateSuite runs the test suite
+func TestRotateSuite(t *testing.T) {
+	suite.Run(t, new(RotateTestSuite))
+}
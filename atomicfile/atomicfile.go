@@ -0,0 +1,192 @@
+// Package atomicfile replaces files atomically and durably.
+//
+// Data is written to a temporary file in the destination directory, flushed to
+// stable storage, renamed over the destination, and the directory itself is
+// flushed so the rename survives a crash. Readers observe either the old or the
+// new content, never a partially written file.
+//
+// Renaming replaces the destination inode: a lock taken on the destination file
+// itself does not protect the new file. Lock a separate file instead (for
+// example "config.json.lock" for "config.json").
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rsgcata/go-fs/internal/dirsync"
+)
+
+// ErrClosed is returned when using a Writer that was already committed or closed
+var ErrClosed = errors.New("atomic writer is closed")
+
+// WriteFile atomically replaces the named file with data, creating it if necessary
+// The file gets the permission bits perm, regardless of the umask
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	w, err := New(path, perm)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Commit()
+}
+
+// RenameDurable renames oldpath to newpath like os.Rename, and makes the rename
+// survive a crash: on Unix the directories of both paths are flushed afterwards,
+// on Windows the rename uses MoveFileEx with MOVEFILE_WRITE_THROUGH.
+// The content of the renamed file is not flushed, call Sync on it before.
+func RenameDurable(oldpath, newpath string) error {
+	return dirsync.Rename(oldpath, newpath)
+}
+
+// SyncDir flushes the entries of the directory dir to stable storage, so that the
+// files created, renamed or removed in it survive a crash
+// It is a no-op on Windows, where directories cannot be flushed and NTFS journals
+// the changes of directory entries.
+func SyncDir(dir string) error {
+	return dirsync.Sync(dir)
+}
+
+// Writer writes the new content of a file, which replaces the destination on Commit
+type Writer struct {
+	path string
+	perm os.FileMode
+	tmp  *os.File
+}
+
+// New creates a Writer replacing path with the permission bits perm on Commit
+// The temporary file is created in the directory of path, so the final rename
+// does not cross file systems
+func New(path string, perm os.FileMode) (*Writer, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{path: path, perm: perm, tmp: tmp}, nil
+}
+
+// LockSuffix is appended to the destination path to get the lock file of NewLocked
+// It is the suffix of git, liblockfile and the other writers of <name>.lock files,
+// so that they exclude each other. It is also the suffix of the lock files of the
+// fs package (fs.LockPath), which are flocked and left in place: do not replace
+// with NewLocked a file also written with fs.Update or the other helpers of the
+// fs package, the lock file they leave behind makes NewLocked fail.
+const LockSuffix = ".lock"
+
+// LockedError is returned by NewLocked when the lock file of the destination
+// exists: another writer is replacing it, or crashed and left a stale lock file
+// behind, which its age helps to tell. It matches fs.ErrExist.
+type LockedError struct {
+	// LockPath is the path of the existing lock file
+	LockPath string
+
+	// ModTime is when the lock file was last modified, and Age how long ago that
+	// was when NewLocked failed. They are zero if the lock file vanished meanwhile.
+	ModTime time.Time
+	Age     time.Duration
+}
+
+func (e *LockedError) Error() string {
+	if e.ModTime.IsZero() {
+		return fmt.Sprintf("lock file %s exists", e.LockPath)
+	}
+	return fmt.Sprintf("lock file %s exists, last modified %s ago: another writer is running, "+
+		"or crashed and left it behind", e.LockPath, e.Age.Round(time.Second))
+}
+
+// Unwrap returns fs.ErrExist
+func (e *LockedError) Unwrap() error {
+	return fs.ErrExist
+}
+
+// NewLocked creates a Writer replacing path like New, git style: the content is
+// written to path plus LockSuffix, created exclusively, so that a single writer
+// at a time can replace path, and renamed onto path on Commit. Close removes the
+// lock file without replacing path. It returns a *LockedError if the lock file
+// exists.
+func NewLocked(path string, perm os.FileMode) (*Writer, error) {
+	lockPath := path + LockSuffix
+	tmp, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+	if errors.Is(err, fs.ErrExist) {
+		lockedErr := &LockedError{LockPath: lockPath}
+		if info, statErr := os.Stat(lockPath); statErr == nil {
+			lockedErr.ModTime = info.ModTime()
+			lockedErr.Age = time.Since(info.ModTime())
+		}
+		return nil, lockedErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{path: path, perm: perm, tmp: tmp}, nil
+}
+
+// Write writes p to the temporary file
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.tmp == nil {
+		return 0, ErrClosed
+	}
+	return w.tmp.Write(p)
+}
+
+// Name returns the path of the temporary file, which is removed on Close
+func (w *Writer) Name() string {
+	if w.tmp == nil {
+		return ""
+	}
+	return w.tmp.Name()
+}
+
+// Commit flushes the written content to stable storage, renames it over the
+// destination and flushes the destination directory
+// The Writer cannot be used after Commit, whether it succeeded or not
+func (w *Writer) Commit() error {
+	if w.tmp == nil {
+		return ErrClosed
+	}
+	tmp := w.tmp
+	w.tmp = nil
+
+	err := tmp.Chmod(w.perm)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = dirsync.Rename(tmp.Name(), w.path)
+	}
+	if err != nil {
+		// Nothing is left to remove if only flushing the directory failed
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Close discards the written content if the Writer was not committed
+// It is safe to call Close after Commit, which makes it convenient to defer
+func (w *Writer) Close() error {
+	if w.tmp == nil {
+		return nil
+	}
+	tmp := w.tmp
+	w.tmp = nil
+
+	_ = tmp.Close()
+	return os.Remove(tmp.Name())
+}
@@ -0,0 +1,166 @@
+package atomicfile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// AtomicFileTestSuite defines a test suite for the atomic file writes
+type AtomicFileTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *AtomicFileTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "atomicfile-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *AtomicFileTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// entries returns the names in the temporary directory
+func (s *AtomicFileTestSuite) entries() []string {
+	entries, err := os.ReadDir(s.tempDir)
+	s.Require().NoError(err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// TestWriteFileCreatesAndReplaces tests creating then replacing a file
+func (s *AtomicFileTestSuite) TestWriteFileCreatesAndReplaces() {
+	path := filepath.Join(s.tempDir, "data.txt")
+
+	s.Require().NoError(WriteFile(path, []byte("first"), 0640))
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("first", string(data))
+
+	s.Require().NoError(WriteFile(path, []byte("second"), 0640))
+	data, err = os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("second", string(data))
+
+	info, err := os.Stat(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0640), info.Mode().Perm())
+
+	// No temporary file is left behind
+	s.Assert().Equal([]string{"data.txt"}, s.entries())
+}
+
+// TestWriterNotVisibleUntilCommit tests that readers see the old content until Commit
+func (s *AtomicFileTestSuite) TestWriterNotVisibleUntilCommit() {
+	path := filepath.Join(s.tempDir, "data.txt")
+	s.Require().NoError(os.WriteFile(path, []byte("old"), 0644))
+
+	w, err := New(path, 0644)
+	s.Require().NoError(err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("new"))
+	s.Require().NoError(err)
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("old", string(data))
+
+	s.Require().NoError(w.Commit())
+	data, err = os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("new", string(data))
+
+	_, err = w.Write([]byte("more"))
+	s.Assert().Equal(ErrClosed, err)
+	s.Assert().Equal(ErrClosed, w.Commit())
+}
+
+// TestCloseDiscards tests that closing an uncommitted writer keeps the destination intact
+func (s *AtomicFileTestSuite) TestCloseDiscards() {
+	path := filepath.Join(s.tempDir, "data.txt")
+	s.Require().NoError(os.WriteFile(path, []byte("old"), 0644))
+
+	w, err := New(path, 0644)
+	s.Require().NoError(err)
+	_, err = w.Write([]byte("new"))
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("old", string(data))
+	s.Assert().Equal([]string{"data.txt"}, s.entries())
+}
+
+// TestRenameDurable tests renaming across directories and flushing a directory
+func (s *AtomicFileTestSuite) TestRenameDurable() {
+	sub := filepath.Join(s.tempDir, "sub")
+	s.Require().NoError(os.Mkdir(sub, 0755))
+	oldPath, newPath := filepath.Join(s.tempDir, "a.txt"), filepath.Join(sub, "b.txt")
+	s.Require().NoError(os.WriteFile(oldPath, []byte("a"), 0644))
+	s.Require().NoError(os.WriteFile(newPath, []byte("b"), 0644))
+
+	s.Require().NoError(RenameDurable(oldPath, newPath))
+	data, err := os.ReadFile(newPath)
+	s.Require().NoError(err)
+	s.Assert().Equal("a", string(data))
+	s.Assert().NoFileExists(oldPath)
+
+	s.Assert().ErrorIs(RenameDurable(oldPath, newPath), os.ErrNotExist)
+	s.Assert().NoError(SyncDir(sub))
+}
+
+// TestNewLocked tests that a single writer at a time replaces the destination
+// through its lock file, and that a leftover lock file is reported with its age
+func (s *AtomicFileTestSuite) TestNewLocked() {
+	path := filepath.Join(s.tempDir, "index")
+	s.Require().NoError(os.WriteFile(path, []byte("old"), 0644))
+
+	w, err := NewLocked(path, 0600)
+	s.Require().NoError(err)
+	s.Assert().Equal(path+LockSuffix, w.Name())
+	_, err = NewLocked(path, 0600)
+	var lockedErr *LockedError
+	s.Require().True(errors.As(err, &lockedErr))
+	s.Assert().ErrorIs(err, fs.ErrExist)
+	s.Assert().Equal(path+LockSuffix, lockedErr.LockPath)
+
+	_, err = w.Write([]byte("new"))
+	s.Require().NoError(err)
+	s.Require().NoError(w.Commit())
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("new", string(data))
+	s.Assert().Equal([]string{"index"}, s.entries())
+
+	w, err = NewLocked(path, 0600)
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+	s.Assert().Equal([]string{"index"}, s.entries(), "Close removes the lock file")
+
+	stale := time.Now().Add(-time.Hour)
+	s.Require().NoError(os.WriteFile(path+LockSuffix, nil, 0644))
+	s.Require().NoError(os.Chtimes(path+LockSuffix, stale, stale))
+	_, err = NewLocked(path, 0600)
+	s.Require().True(errors.As(err, &lockedErr))
+	s.Assert().InDelta(time.Hour.Seconds(), lockedErr.Age.Seconds(), 60)
+	s.Assert().Contains(err.Error(), "1h0m0s ago")
+}
+
+// TestAtomicFile runs the test suite
+func TestAtomicFile(t *testing.T) {
+	suite.Run(t, new(AtomicFileTestSuite))
+}
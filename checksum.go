@@ -0,0 +1,82 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rsgcata/go-fs/atomicfile"
+)
+
+// ChecksumSuffix is appended to a file path to get the path of its checksum sidecar
+const ChecksumSuffix = ".sha256"
+
+// ErrChecksumMismatch is returned when the content of a file does not match its
+// recorded checksum: the file was modified without the helpers of this package,
+// or a write was interrupted
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// FileOption configures the locked file helpers
+type FileOption func(*fileOptions)
+
+type fileOptions struct {
+	checksum bool
+}
+
+func newFileOptions(opts []FileOption) fileOptions {
+	var o fileOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithChecksum records the SHA-256 of the content written by the helpers in the
+// sidecar ChecksumPath(path), and verifies it when the helpers read the file,
+// returning an error wrapping ErrChecksumMismatch if it does not match.
+// The sidecar uses the sha256sum(1) format. Files without a sidecar, such as files
+// written before the option was used, are read without verification.
+func WithChecksum() FileOption {
+	return func(o *fileOptions) {
+		o.checksum = true
+	}
+}
+
+// ChecksumPath returns the path of the checksum sidecar of path
+func ChecksumPath(path string) string {
+	return path + ChecksumSuffix
+}
+
+// verifyChecksum checks data read from path against its sidecar, if any
+func verifyChecksum(path string, data []byte) error {
+	sum := sha256.Sum256(data)
+	return compareChecksum(path, sum[:])
+}
+
+// compareChecksum checks the SHA-256 sum of the content of path against its sidecar, if any
+func compareChecksum(path string, sum []byte) error {
+	recorded, err := os.ReadFile(ChecksumPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	want, _, _ := bytes.Cut(recorded, []byte(" "))
+	if got := hex.EncodeToString(sum); string(want) != got {
+		return fmt.Errorf("%w: %s has sha256 %s, %s recorded", ErrChecksumMismatch, path, got, want)
+	}
+	return nil
+}
+
+// writeChecksum records the checksum of data, the new content of path
+func writeChecksum(path string, data []byte, perm os.FileMode) error {
+	sum := sha256.Sum256(data)
+	line := hex.EncodeToString(sum[:]) + "  " + filepath.Base(path) + "\n"
+	return atomicfile.WriteFile(ChecksumPath(path), []byte(line), perm)
+}
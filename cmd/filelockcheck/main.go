@@ -0,0 +1,17 @@
+// Command filelockcheck reports file locks acquired and not released, see
+// package filelockcheck.
+//
+// Usage:
+//
+//	filelockcheck ./...
+package main
+
+import (
+	"github.com/rsgcata/go-fs/filelock/filelockcheck"
+
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(filelockcheck.Analyzer)
+}
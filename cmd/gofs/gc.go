@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/rsgcata/go-fs/filelock/lockgc"
+)
+
+// runGC implements "gofs gc [flags] dir..."
+func runGC(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gofs gc [flags] dir...")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Removes the lock files of dir that no process holds.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+
+	var opts lockgc.Options
+	flags.StringVar(&opts.Pattern, "pattern", lockgc.DefaultPattern, "base name `pattern` of the lock files")
+	flags.DurationVar(&opts.MinAge, "min-age", 0, "keep lock files modified more recently than `duration`")
+	flags.BoolVar(&opts.Recursive, "r", false, "scan subdirectories")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "report the lock files to remove without removing them")
+	flags.BoolVar(&opts.Dotlock, "dotlock", false, "collect stale dotlocks instead of unlocked flock lock files")
+	verbose := flags.Bool("v", false, "list the removed, held and foreign lock files")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, dir := range flags.Args() {
+		report, err := lockgc.Collect(dir, opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "gofs gc: %v\n", err)
+			status = 1
+			continue
+		}
+
+		action := "removed"
+		if opts.DryRun {
+			action = "would remove"
+		}
+		if *verbose {
+			for _, path := range report.Removed {
+				fmt.Fprintf(stdout, "%s %s\n", action, path)
+			}
+			for _, path := range report.Held {
+				fmt.Fprintf(stdout, "held %s\n", path)
+			}
+			for _, path := range report.Foreign {
+				fmt.Fprintf(stdout, "foreign %s\n", path)
+			}
+		}
+		for _, err := range report.Errors {
+			fmt.Fprintf(stderr, "gofs gc: %v\n", err)
+			status = 1
+		}
+		fmt.Fprintf(stdout, "%s: %s\n", dir, report)
+	}
+	return status
+}
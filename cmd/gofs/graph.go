@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rsgcata/go-fs/filelock/hostlocks"
+)
+
+// runGraph implements "gofs graph [flags]"
+func runGraph(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gofs graph [flags]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Prints the locks held and waited for by the processes of the host registry")
+		fmt.Fprintln(stderr, "as a Graphviz DOT graph, and reports the deadlocks between processes.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+
+	dir := flags.String("dir", hostlocks.DefaultDir(), "registry `directory`")
+	asJSON := flags.Bool("json", false, "print the graph in JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	g, err := hostlocks.Graph(*dir)
+	if err == nil {
+		if *asJSON {
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(g)
+		} else {
+			err = g.WriteDOT(stdout)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gofs graph: %v\n", err)
+		return 1
+	}
+
+	deadlocks := g.Deadlocks()
+	for _, cycle := range deadlocks {
+		fmt.Fprintf(stderr, "gofs graph: deadlock: %s\n", strings.Join(cycle, " -> "))
+	}
+	if len(deadlocks) > 0 {
+		return 1
+	}
+	return 0
+}
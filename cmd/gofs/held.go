@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock/hostlocks"
+)
+
+// runHeld implements "gofs held [flags] [path]"
+func runHeld(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("held", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gofs held [flags] [path]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Lists the locks held by the processes of the host registry, only those")
+		fmt.Fprintln(stderr, "on path or under the directory path if it is given.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+
+	dir := flags.String("dir", hostlocks.DefaultDir(), "registry `directory`")
+	pid := flags.Int("pid", 0, "only list the locks held by the process `pid`")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var manifests []hostlocks.Manifest
+	var err error
+	if flags.NArg() == 1 {
+		manifests, err = hostlocks.HeldUnder(*dir, flags.Arg(0))
+	} else {
+		manifests, err = hostlocks.Manifests(*dir)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gofs held: %v\n", err)
+		return 1
+	}
+
+	now := time.Now()
+	for _, manifest := range manifests {
+		if *pid != 0 && manifest.PID != *pid {
+			continue
+		}
+		for _, lock := range manifest.Locks {
+			held := now.Sub(lock.AcquiredAt).Round(time.Millisecond)
+			fmt.Fprintf(stdout, "%d\t%s\theld for %s\n", manifest.PID, lock.Path, held)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+// Command gofs provides maintenance commands for the lock files of go-fs.
+//
+// Usage:
+//
+//	gofs <command> [flags] [arguments]
+//
+// The commands are:
+//
+//	gc    remove the stale lock files of lock directories
+//	held  list the locks held by the processes of the host registry
+//	graph print the locks held and waited for on the host as a graph
+//	probe test which locking mechanisms exclude other processes in a directory
+//	stats summarize the acquisitions recorded by lockstats
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rsgcata/go-fs/filelock/capability"
+)
+
+// command is a gofs subcommand
+type command struct {
+	name  string
+	short string
+	run   func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = []command{
+	{name: "gc", short: "remove the stale lock files of lock directories", run: runGC},
+	{name: "held", short: "list the locks held by the processes of the host registry", run: runHeld},
+	{name: "graph", short: "print the locks held and waited for on the host as a graph", run: runGraph},
+	{name: "probe", short: "test which locking mechanisms exclude other processes in a directory", run: runProbe},
+	{name: "stats", short: "summarize the acquisitions recorded by lockstats", run: runStats},
+}
+
+func main() {
+	// The probe command runs gofs again as its helper process
+	capability.Serve()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		usage(stderr)
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "gofs: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: gofs <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.short)
+	}
+}
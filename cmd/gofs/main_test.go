@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	gofs "github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock/capability"
+	"github.com/rsgcata/go-fs/filelock/hostlocks"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// TestMain serves the requests of the probe command in its helper process
+func TestMain(m *testing.M) {
+	capability.Serve()
+	os.Exit(m.Run())
+}
+
+// GofsTestSuite defines a test suite for the gofs command
+type GofsTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *GofsTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "gofs-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *GofsTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// run runs gofs with args and returns its exit status and output
+func (s *GofsTestSuite) run(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+// TestUsage tests that unknown commands print the usage
+func (s *GofsTestSuite) TestUsage() {
+	status, _, stderr := s.run("nope")
+	s.Assert().Equal(2, status)
+	s.Assert().Contains(stderr, "unknown command")
+	s.Assert().Contains(stderr, "gc")
+}
+
+// TestGC tests the gc command in dry-run and normal modes
+func (s *GofsTestSuite) TestGC() {
+	lockPath := filepath.Join(s.tempDir, "idle.lock")
+	s.Require().NoError(os.WriteFile(lockPath, nil, 0644))
+
+	status, stdout, _ := s.run("gc", "-dry-run", "-v", s.tempDir)
+	s.Assert().Zero(status)
+	s.Assert().Contains(stdout, "would remove "+lockPath)
+	s.Assert().FileExists(lockPath)
+
+	status, stdout, _ = s.run("gc", s.tempDir)
+	s.Assert().Zero(status)
+	s.Assert().Contains(stdout, "removed 1")
+	s.Assert().NoFileExists(lockPath)
+}
+
+// TestHeld tests the held command by process and by path
+func (s *GofsTestSuite) TestHeld() {
+	dir := filepath.Join(s.tempDir, "registry")
+	registry, err := hostlocks.Open(dir)
+	s.Require().NoError(err)
+	defer registry.Close()
+
+	lockPath := filepath.Join(s.tempDir, "app", "job.lock")
+	s.Require().NoError(os.Mkdir(filepath.Dir(lockPath), 0755))
+	lock := gofs.New(lockPath, registry.Option())
+	s.Require().NoError(lock.Lock())
+	defer lock.Unlock()
+
+	pid := strconv.Itoa(os.Getpid())
+	status, stdout, _ := s.run("held", "-dir", dir, "-pid", pid)
+	s.Assert().Zero(status)
+	s.Assert().Contains(stdout, pid+"\t"+lockPath+"\theld for ")
+
+	status, stdout, _ = s.run("held", "-dir", dir, filepath.Join(s.tempDir, "app"))
+	s.Assert().Zero(status)
+	s.Assert().Contains(stdout, lockPath)
+
+	status, stdout, _ = s.run("held", "-dir", dir, filepath.Join(s.tempDir, "other"))
+	s.Assert().Zero(status)
+	s.Assert().Empty(stdout)
+}
+
+// TestGraph tests the graph command in DOT and JSON
+func (s *GofsTestSuite) TestGraph() {
+	dir := filepath.Join(s.tempDir, "registry")
+	registry, err := hostlocks.Open(dir)
+	s.Require().NoError(err)
+	defer registry.Close()
+
+	lockPath := filepath.Join(s.tempDir, "job.lock")
+	lock := gofs.New(lockPath, registry.Option())
+	s.Require().NoError(lock.Lock())
+	defer lock.Unlock()
+
+	status, stdout, _ := s.run("graph", "-dir", dir)
+	s.Assert().Zero(status)
+	s.Assert().Contains(stdout, "digraph locks {")
+	s.Assert().Contains(stdout, `label="held by"`)
+
+	status, stdout, _ = s.run("graph", "-dir", dir, "-json")
+	s.Assert().Zero(status)
+	s.Assert().Contains(stdout, `"kind": "held_by"`)
+}
+
+// TestStats tests the summary of a stats file
+func (s *GofsTestSuite) TestStats() {
+	statsPath := filepath.Join(s.tempDir, "locks.jsonl")
+	records := `{"time":"2026-01-02T10:00:00Z","path":"a.lock","holder":{"pid":1},"result":"released","wait":1000000,"hold":5000000}
+{"time":"2026-01-02T10:00:01Z","path":"a.lock","holder":{"pid":2},"result":"timeout","wait":3000000000}
+{"time":"2026-01-02T11:00:00Z","path":"b.lock","holder":{"pid":1},"result":"released","wait":0,"hold":1000000}
+`
+	s.Require().NoError(os.WriteFile(statsPath, []byte(records), 0644))
+
+	status, stdout, _ := s.run("stats", statsPath)
+	s.Assert().Zero(status)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	s.Require().Len(lines, 3)
+	s.Assert().Contains(lines[1], "a.lock")
+	s.Assert().Contains(lines[1], "released=1 timeout=1")
+	s.Assert().Contains(lines[1], "3s")
+	s.Assert().Contains(lines[2], "b.lock")
+
+	status, stdout, _ = s.run("stats", "-since", "2026-01-02T10:30:00Z", statsPath)
+	s.Assert().Zero(status)
+	s.Assert().NotContains(stdout, "a.lock")
+	s.Assert().Contains(stdout, "b.lock")
+}
+
+// TestProbe tests that the probe command reports every mechanism as excluding
+func (s *GofsTestSuite) TestProbe() {
+	status, stdout, stderr := s.run("probe", s.tempDir)
+	s.Assert().Zero(status, stderr)
+	s.Assert().Contains(stdout, "MECHANISM")
+	s.Assert().Contains(stdout, "lockfile")
+	s.Assert().NotContains(stdout, "false")
+}
+
+// TestGofs runs the test suite
+func TestGofs(t *testing.T) {
+	suite.Run(t, new(GofsTestSuite))
+}
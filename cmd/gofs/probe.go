@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock/capability"
+)
+
+// runProbe implements "gofs probe [flags] dir"
+func runProbe(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("probe", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gofs probe [flags] dir")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Tests which locking mechanisms exclude other processes in dir, and exits with")
+		fmt.Fprintln(stderr, "status 1 if one of them does not.")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+
+	timeout := flags.Duration("timeout", time.Minute, "give up the probe after `duration`")
+	asJSON := flags.Bool("json", false, "print the report in JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report, err := capability.Probe(ctx, flags.Arg(0))
+	if err == nil {
+		if *asJSON {
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(report)
+		} else {
+			w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "MECHANISM\tEXCLUDES\tERROR")
+			for _, r := range report.Results {
+				fmt.Fprintf(w, "%s\t%t\t%s\n", r.Mechanism, r.Excludes, r.Error)
+			}
+			err = w.Flush()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gofs probe: %v\n", err)
+		return 1
+	}
+
+	for _, r := range report.Results {
+		if !r.Excludes {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+// Command lockbench measures the lock backends available on this platform, see
+// package bench, and prints the results as a table.
+//
+// Usage:
+//
+//	lockbench [-backend regexp] [-scenario regexp]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock/bench"
+)
+
+func main() {
+	backendPattern := flag.String("backend", "", "only measure the backends matching `regexp`")
+	scenarioPattern := flag.String("scenario", "", "only run the scenarios matching `regexp`")
+	flag.Parse()
+
+	backendFilter, err := regexp.Compile(*backendPattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scenarioFilter, err := regexp.Compile(*scenarioPattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "backend\tscenario\tlatency\tallocs/op\tlocks/s\twake-up\t")
+	for _, backend := range bench.Backends() {
+		if !backendFilter.MatchString(backend.Name) {
+			continue
+		}
+		for _, scenario := range bench.Scenarios() {
+			if !scenarioFilter.MatchString(scenario.Name) {
+				continue
+			}
+			result := testing.Benchmark(func(b *testing.B) {
+				scenario.Run(b, backend)
+			})
+			if result.N == 0 {
+				log.Fatalf("%s/%s failed", backend.Name, scenario.Name)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t\n",
+				backend.Name,
+				scenario.Name,
+				time.Duration(result.NsPerOp()),
+				result.AllocsPerOp(),
+				metric(result, "locks/s", func(v float64) string { return fmt.Sprintf("%.0f", v) }),
+				metric(result, "wake-ns/op", func(v float64) string { return time.Duration(v).String() }),
+			)
+		}
+	}
+	_ = w.Flush()
+}
+
+// metric formats the extra metric unit of result, or "-" if it was not reported
+func metric(result testing.BenchmarkResult, unit string, format func(float64) string) string {
+	v, ok := result.Extra[unit]
+	if !ok {
+		return "-"
+	}
+	return format(v)
+}
@@ -0,0 +1,41 @@
+// Command lockd serves file locks over HTTP, see package lockd.
+//
+// Usage:
+//
+//	lockd [-addr :7070] [-dir /var/lib/lockd] [-max-ttl 10m] [-max-timeout 1m]
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rsgcata/go-fs/lockd"
+)
+
+func main() {
+	addr := flag.String("addr", ":7070", "listen `address`")
+	dir := flag.String("dir", "lockd", "`directory` of the lock files")
+	maxTTL := flag.Duration("max-ttl", lockd.DefaultMaxTTL, "maximum lease `ttl` granted to clients")
+	maxTimeout := flag.Duration("max-timeout", lockd.DefaultMaxTimeout, "maximum acquisition `timeout` granted to clients")
+	flag.Parse()
+
+	server, err := lockd.NewServer(*dir, lockd.WithMaxTTL(*maxTTL), lockd.WithMaxTimeout(*maxTimeout))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		_ = server.Close()
+		os.Exit(0)
+	}()
+
+	log.Printf("lockd: serving %s on %s", *dir, *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
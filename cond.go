@@ -0,0 +1,262 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/watch"
+)
+
+// CondSuffix is appended to the path of the lock of a Cond to get the path of
+// its state file
+const CondSuffix = ".cond"
+
+// errUnchanged makes an Update leave the file untouched
+var errUnchanged = errors.New("unchanged")
+
+// condState is the content of the state file of a Cond
+type condState struct {
+	// Generation is incremented by Broadcast, waking every waiter
+	Generation uint64 `json:"generation"`
+
+	// Waiters is the number of processes and goroutines in Wait
+	Waiters int `json:"waiters"`
+
+	// Tokens is the number of Signal calls not consumed by a waiter yet
+	Tokens int `json:"tokens"`
+}
+
+// Cond is a condition variable shared by processes, like sync.Cond: processes
+// change a state guarded by the lock L, and wait for each other's changes with
+// Wait, Signal and Broadcast.
+//
+// Waiters are counted in a state file next to the lock, updated under its own
+// lock, and notified of its changes through the watch package, so they do not
+// poll the guarded state. A waiter whose process dies remains counted, which
+// may turn a later Signal into a spurious wakeup: like with sync.Cond, Wait must
+// be called in a loop checking the condition.
+type Cond struct {
+	// L is held while observing or changing the condition
+	L filelock.FileLock
+
+	path    string
+	watcher *watch.Watcher
+
+	mutex   sync.Mutex
+	changed chan struct{} // closed and replaced on every change of the state file
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewCond creates a Cond guarded by lock, creating its state file if needed
+// The Cond must be closed to stop watching the state file.
+func NewCond(lock filelock.FileLock) (*Cond, error) {
+	path := lock.Path() + CondSuffix
+	err := Update(path, DefaultTimeout, func(old []byte) ([]byte, error) {
+		if len(old) > 0 {
+			return nil, errUnchanged
+		}
+		return json.Marshal(condState{})
+	})
+	if err != nil && !errors.Is(err, errUnchanged) {
+		return nil, err
+	}
+
+	watcher, err := watch.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(path); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	c := &Cond{
+		L:       lock,
+		path:    path,
+		watcher: watcher,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.notify()
+	return c, nil
+}
+
+// Path returns the path of the state file
+func (c *Cond) Path() string {
+	return c.path
+}
+
+// Wait releases L, waits for a Signal or Broadcast and acquires L again before
+// returning. L must be held when calling Wait.
+func (c *Cond) Wait() error {
+	return c.WaitContext(context.Background())
+}
+
+// WaitContext is like Wait, but stops waiting when ctx is done and returns its
+// error. L is then acquired again within DefaultTimeout: it is held on return
+// unless the returned error is a lock error.
+func (c *Cond) WaitContext(ctx context.Context) error {
+	var generation uint64
+	err := c.update(func(state *condState) bool {
+		generation = state.Generation
+		state.Waiters++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.L.Unlock(); err != nil {
+		_ = c.leave(func(*condState) bool { return true })
+		return err
+	}
+
+	err = c.wait(ctx, generation)
+	if err == nil {
+		return lockContext(context.Background(), c.L)
+	}
+	return errors.Join(err, c.L.LockWithTimeout(DefaultTimeout))
+}
+
+// wait waits until a Broadcast after generation or a Signal token is consumed
+func (c *Cond) wait(ctx context.Context, generation uint64) error {
+	for {
+		changed := c.changes()
+		woken := func(state *condState) bool {
+			if state.Generation != generation {
+				return true
+			}
+			if state.Tokens > 0 {
+				state.Tokens--
+				return true
+			}
+			return false
+		}
+
+		data, err := ReadFileShared(c.path)
+		if err != nil {
+			return errors.Join(err, c.leave(func(*condState) bool { return true }))
+		}
+		var state condState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return errors.Join(err, c.leave(func(*condState) bool { return true }))
+		}
+		if woken(&state) {
+			// Consume the token, unless another waiter got it first
+			err := c.leave(woken)
+			if !errors.Is(err, errUnchanged) {
+				return err
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), c.leave(func(*condState) bool { return true }))
+		case <-c.done:
+			return errors.Join(watch.ErrClosed, c.leave(func(*condState) bool { return true }))
+		}
+	}
+}
+
+// leave unregisters the waiter if woken reports it may leave, otherwise returns
+// errUnchanged
+func (c *Cond) leave(woken func(*condState) bool) error {
+	return c.update(func(state *condState) bool {
+		if !woken(state) {
+			return false
+		}
+		state.Waiters = max(state.Waiters-1, 0)
+		return true
+	})
+}
+
+// Signal wakes one waiter, if any
+func (c *Cond) Signal() error {
+	err := c.update(func(state *condState) bool {
+		if state.Tokens >= state.Waiters {
+			return false
+		}
+		state.Tokens++
+		return true
+	})
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	return err
+}
+
+// Broadcast wakes all the waiters
+func (c *Cond) Broadcast() error {
+	err := c.update(func(state *condState) bool {
+		if state.Waiters == 0 {
+			return false
+		}
+		state.Generation++
+		state.Tokens = 0
+		return true
+	})
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	return err
+}
+
+// update modifies the state file under its lock if fn reports a change,
+// otherwise returns errUnchanged
+func (c *Cond) update(fn func(*condState) bool) error {
+	return Update(c.path, DefaultTimeout, func(old []byte) ([]byte, error) {
+		var state condState
+		if err := json.Unmarshal(old, &state); err != nil {
+			return nil, err
+		}
+		if !fn(&state) {
+			return nil, errUnchanged
+		}
+		return json.Marshal(state)
+	})
+}
+
+// changes returns a channel closed on the next change of the state file
+func (c *Cond) changes() <-chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.changed
+}
+
+// notify closes the changes channel on every change of the state file
+func (c *Cond) notify() {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.watcher.Errors():
+			// Events were dropped, wake the waiters to check the state file
+		case <-c.watcher.Events():
+		}
+
+		c.mutex.Lock()
+		close(c.changed)
+		c.changed = make(chan struct{})
+		c.mutex.Unlock()
+	}
+}
+
+// Close stops watching the state file. Waiters still in Wait return
+// watch.ErrClosed once they acquired L again.
+func (c *Cond) Close() error {
+	err := watch.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.wg.Wait()
+		err = c.watcher.Close()
+	})
+	return err
+}
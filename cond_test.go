@@ -0,0 +1,152 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// CondTestSuite defines a test suite for the process-shared condition variable
+type CondTestSuite struct {
+	suite.Suite
+	tempDir  string
+	lockPath string
+	conds    []*Cond
+}
+
+// SetupTest creates a temporary directory before each test
+func (s *CondTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "cond-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.lockPath = filepath.Join(tempDir, "state.lock")
+	s.conds = nil
+}
+
+// TearDownTest closes the conds and removes the temporary directory after each test
+func (s *CondTestSuite) TearDownTest() {
+	for _, c := range s.conds {
+		_ = c.Close()
+	}
+	os.RemoveAll(s.tempDir)
+}
+
+// newCond creates a Cond with its own lock, like another process would
+func (s *CondTestSuite) newCond() *Cond {
+	c, err := NewCond(New(s.lockPath))
+	s.Require().NoError(err)
+	s.conds = append(s.conds, c)
+	return c
+}
+
+func (s *CondTestSuite) state() condState {
+	data, err := os.ReadFile(s.lockPath + CondSuffix)
+	s.Require().NoError(err)
+	var state condState
+	s.Require().NoError(json.Unmarshal(data, &state))
+	return state
+}
+
+// startWaiter waits on a new Cond in a goroutine, the returned channel receives
+// the outcome of Wait
+func (s *CondTestSuite) startWaiter() <-chan error {
+	c := s.newCond()
+	s.Require().NoError(c.L.Lock())
+	waiters := s.state().Waiters
+
+	done := make(chan error, 1)
+	go func() {
+		err := c.Wait()
+		if err == nil && !c.L.IsLocked() {
+			err = os.ErrInvalid
+		}
+		_ = c.L.Unlock()
+		done <- err
+	}()
+	s.Require().Eventually(func() bool { return s.state().Waiters == waiters+1 }, time.Second, time.Millisecond)
+	return done
+}
+
+func (s *CondTestSuite) assertWoken(done <-chan error) {
+	select {
+	case err := <-done:
+		s.Assert().NoError(err)
+	case <-time.After(2 * time.Second):
+		s.Require().Fail("waiter not woken")
+	}
+}
+
+func (s *CondTestSuite) assertWaiting(done <-chan error) {
+	select {
+	case err := <-done:
+		s.Require().Failf("waiter woken", "error: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestSignalWakesOne tests that each Signal wakes a single waiter
+func (s *CondTestSuite) TestSignalWakesOne() {
+	first := s.startWaiter()
+	second := s.startWaiter()
+	signaler := s.newCond()
+
+	s.Require().NoError(signaler.Signal())
+	select {
+	case err := <-first:
+		s.Require().NoError(err)
+		s.assertWaiting(second)
+		s.Require().NoError(signaler.Signal())
+		s.assertWoken(second)
+	case err := <-second:
+		s.Require().NoError(err)
+		s.assertWaiting(first)
+		s.Require().NoError(signaler.Signal())
+		s.assertWoken(first)
+	case <-time.After(2 * time.Second):
+		s.Require().Fail("no waiter woken")
+	}
+	s.Assert().Equal(condState{}, s.state())
+}
+
+// TestBroadcast tests that Broadcast wakes every waiter
+func (s *CondTestSuite) TestBroadcast() {
+	waiters := []<-chan error{s.startWaiter(), s.startWaiter(), s.startWaiter()}
+	s.Require().NoError(s.newCond().Broadcast())
+	for _, done := range waiters {
+		s.assertWoken(done)
+	}
+	s.Assert().Equal(0, s.state().Waiters)
+}
+
+// TestSignalWithoutWaiters tests that signals are not kept for later waiters
+func (s *CondTestSuite) TestSignalWithoutWaiters() {
+	c := s.newCond()
+	s.Require().NoError(c.Signal())
+	s.Require().NoError(c.Broadcast())
+	s.Assert().Equal(condState{}, s.state())
+
+	s.assertWaiting(s.startWaiter())
+}
+
+// TestWaitContext tests that a canceled wait returns with L held and unregistered
+func (s *CondTestSuite) TestWaitContext() {
+	c := s.newCond()
+	s.Require().NoError(c.L.Lock())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s.Assert().ErrorIs(c.WaitContext(ctx), context.DeadlineExceeded)
+	s.Assert().True(c.L.IsLocked())
+	s.Assert().Equal(0, s.state().Waiters)
+	s.Require().NoError(c.L.Unlock())
+}
+
+// TestCond runs the test suite
+func TestCond(t *testing.T) {
+	suite.Run(t, new(CondTestSuite))
+}
@@ -0,0 +1,101 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rsgcata/go-fs/internal/dirsync"
+)
+
+// CopyFile copies the regular file src to dst, holding a shared lock on
+// LockPath(src) and an exclusive lock on LockPath(dst), acquired in sorted order
+// within DefaultTimeout. dst gets the permission bits and the modification time
+// of src, and is replaced atomically and durably.
+// On Linux the content is cloned (reflink) when the file system supports it, and
+// copied in the kernel with copy_file_range(2) otherwise.
+func CopyFile(src, dst string) error {
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		return &os.LinkError{Op: "copy", Old: src, New: dst, Err: errors.New("source and destination are the same file")}
+	}
+	return withPathLocks([]string{dst}, []string{src}, func() error {
+		return copyFile(src, dst)
+	})
+}
+
+// MoveFile moves src to dst, replacing it, holding exclusive locks on LockPath(src)
+// and LockPath(dst), acquired in sorted order within DefaultTimeout.
+// It renames the file when possible. Across file systems it copies the file like
+// CopyFile and then removes src.
+func MoveFile(src, dst string) error {
+	return withPathLocks([]string{src, dst}, nil, func() error {
+		err := dirsync.Rename(src, dst)
+		if err == nil || !isCrossDevice(err) {
+			return err
+		}
+
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+		if err := os.Remove(src); err != nil {
+			return err
+		}
+		return dirsync.Sync(filepath.Dir(src))
+	})
+}
+
+// copyFile copies src to a temporary file renamed over dst, the locks being held
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return &os.LinkError{Op: "copy", Old: src, New: dst, Err: fmt.Errorf("not a regular file: %s", info.Mode().Type())}
+	}
+
+	dir, base := filepath.Split(dst)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	err = copyContent(tmp, in)
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = dirsync.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// copyBytes copies the content of in to out with io.Copy, which uses
+// copy_file_range(2) or sendfile(2) between files where available
+func copyBytes(out, in *os.File) error {
+	_, err := io.Copy(out, in)
+	return err
+}
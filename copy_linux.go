@@ -0,0 +1,23 @@
+package fs
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyContent clones in to the empty file out with the FICLONE ioctl, sharing the
+// data blocks on file systems supporting reflinks (btrfs, XFS), and copies it
+// otherwise
+func copyContent(out, in *os.File) error {
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err == nil {
+		return nil
+	}
+	return copyBytes(out, in)
+}
+
+// isCrossDevice reports whether a rename failed because the paths are on different file systems
+func isCrossDevice(err error) bool {
+	return errors.Is(err, unix.EXDEV)
+}
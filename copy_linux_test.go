@@ -0,0 +1,18 @@
+package fs
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestIsCrossDevice tests the detection of renames across file systems
+func TestIsCrossDevice(t *testing.T) {
+	if !isCrossDevice(&os.LinkError{Op: "rename", Old: "a", New: "b", Err: unix.EXDEV}) {
+		t.Error("EXDEV is a cross-device rename")
+	}
+	if isCrossDevice(os.ErrNotExist) {
+		t.Error("ErrNotExist is not a cross-device rename")
+	}
+}
@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// CopyTestSuite defines a test suite for the locked copy and move helpers
+type CopyTestSuite struct {
+	suite.Suite
+	tempDir string
+	src     string
+	modTime time.Time
+}
+
+// SetupTest creates a temporary directory with a source file before each test
+func (s *CopyTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "copy-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+
+	s.src = filepath.Join(tempDir, "src.txt")
+	s.modTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.Require().NoError(os.WriteFile(s.src, []byte("payload"), 0600))
+	s.Require().NoError(os.Chtimes(s.src, s.modTime, s.modTime))
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *CopyTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *CopyTestSuite) assertCopy(path string) {
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("payload", string(data))
+
+	info, err := os.Stat(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0600), info.Mode().Perm())
+	s.Assert().True(info.ModTime().Equal(s.modTime))
+}
+
+// TestCopyFile tests that the content, permissions and modification time are copied
+func (s *CopyTestSuite) TestCopyFile() {
+	dst := filepath.Join(s.tempDir, "dst.txt")
+	s.Require().NoError(os.WriteFile(dst, []byte("old"), 0644))
+
+	s.Require().NoError(CopyFile(s.src, dst))
+	s.assertCopy(dst)
+	s.assertCopy(s.src)
+
+	s.Assert().Error(CopyFile(s.src, s.src))
+	s.Assert().ErrorIs(CopyFile(filepath.Join(s.tempDir, "missing"), dst), os.ErrNotExist)
+	s.Assert().Error(CopyFile(s.tempDir, dst), "directories are not copied")
+}
+
+// TestCopyWaitsForWriter tests that the copy waits for the exclusive lock of the source
+func (s *CopyTestSuite) TestCopyWaitsForWriter() {
+	writer := New(LockPath(s.src))
+	s.Require().NoError(writer.Lock())
+	time.AfterFunc(50*time.Millisecond, func() { _ = writer.Unlock() })
+
+	start := time.Now()
+	s.Require().NoError(CopyFile(s.src, filepath.Join(s.tempDir, "dst.txt")))
+	s.Assert().GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+}
+
+// TestMoveFile tests that a moved file keeps its attributes and leaves the source
+func (s *CopyTestSuite) TestMoveFile() {
+	dst := filepath.Join(s.tempDir, "moved.txt")
+	s.Require().NoError(MoveFile(s.src, dst))
+	s.assertCopy(dst)
+	s.Assert().NoFileExists(s.src)
+}
+
+// TestCopy runs the test suite
+func TestCopy(t *testing.T) {
+	suite.Run(t, new(CopyTestSuite))
+}
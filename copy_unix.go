@@ -0,0 +1,20 @@
+//go:build unix && !linux
+
+package fs
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyContent copies in to the empty file out
+func copyContent(out, in *os.File) error {
+	return copyBytes(out, in)
+}
+
+// isCrossDevice reports whether a rename failed because the paths are on different file systems
+func isCrossDevice(err error) bool {
+	return errors.Is(err, unix.EXDEV)
+}
@@ -0,0 +1,18 @@
+package fs
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// copyContent copies in to the empty file out
+func copyContent(out, in *os.File) error {
+	return copyBytes(out, in)
+}
+
+// isCrossDevice reports whether a rename failed because the paths are on different volumes
+func isCrossDevice(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
@@ -0,0 +1,193 @@
+//go:build linux
+
+// Package abstract provides thread-safe locking in non-blocking mode backed by
+// Linux abstract unix domain sockets instead of lock files.
+//
+// A lock is held by binding a socket in the abstract namespace under a name
+// derived from the hash of the absolute lock path. Nothing is created on the
+// file system, and the kernel releases the name as soon as the socket is closed,
+// including when the process crashes, so stale locks cannot exist.
+//
+// A name can only be bound once, so locks are always exclusive, even when
+// created with filelock.WithShared.
+//
+// Abstract sockets belong to the network namespace: processes in different
+// network namespaces (e.g. containers) do not see each other's locks.
+package abstract
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/lockcore"
+)
+
+// namePrefix namespaces the socket names used by this package
+const namePrefix = "go-fs/filelock/"
+
+// FileLock represents a lock identified by a path, held through an abstract socket
+type FileLock struct {
+	core *lockcore.Lock
+}
+
+// New creates a new FileLock for the specified path
+// The path does not need to exist, it only identifies the lock
+func New(path string, opts ...filelock.Option) *FileLock {
+	return &FileLock{
+		core: lockcore.New(path, &socketDriver{}, filelock.NewOptions(opts...)),
+	}
+}
+
+// Lock acquires the lock
+// If the lock cannot be acquired immediately, it returns ErrLockHeld
+func (fl *FileLock) Lock() error {
+	return fl.LockWithTimeout(0)
+}
+
+// LockWithTimeout attempts to acquire the lock with a timeout
+// If timeout is <= 0, it's a non-blocking operation
+// If timeout is > 0, it will retry in a non-blocking manner until the timeout is reached
+func (fl *FileLock) LockWithTimeout(timeout time.Duration) error {
+	return fl.core.LockWithTimeout(timeout)
+}
+
+// Unlock releases the lock
+// If the lock is not held, it returns ErrNotLocked, or nil when created with
+// filelock.WithIdempotentUnlock
+func (fl *FileLock) Unlock() error {
+	return fl.core.Unlock()
+}
+
+// UnlockWithTimeout releases the lock like Unlock, giving up after timeout when the
+// release hangs, on a stuck network file system for example: the lock is forgotten,
+// its descriptor abandoned, and an error wrapping filelock.ErrAbandoned is returned
+// ContextLock().Unlock(ctx) gives up the same way when ctx is done
+func (fl *FileLock) UnlockWithTimeout(timeout time.Duration) error {
+	return fl.core.UnlockWithTimeout(timeout)
+}
+
+// Abort interrupts the acquisitions in progress on this instance, including the
+// ones waiting for another operation on it, which return filelock.ErrAborted
+// Later acquisitions are not affected and a held lock stays held
+func (fl *FileLock) Abort() {
+	fl.core.Abort()
+}
+
+// IsLocked returns whether the lock is currently held by this instance
+func (fl *FileLock) IsLocked() bool {
+	return fl.core.IsLocked()
+}
+
+// Path returns the path identifying this lock
+func (fl *FileLock) Path() string {
+	return fl.core.Path()
+}
+
+// AcquiredAt returns when the lock was acquired, or the zero time if it is not held
+func (fl *FileLock) AcquiredAt() time.Time {
+	return fl.core.AcquiredAt()
+}
+
+// HeldDuration returns how long the lock has been held, or 0 if it is not held
+func (fl *FileLock) HeldDuration() time.Duration {
+	return fl.core.HeldDuration()
+}
+
+// LastAcquireStats returns the number of attempts and the time spent by the most
+// recent acquisition, whether it succeeded or not
+func (fl *FileLock) LastAcquireStats() filelock.AcquireStats {
+	return fl.core.LastAcquireStats()
+}
+
+// Status returns a snapshot of the lock state, including holder and acquisition statistics
+func (fl *FileLock) Status() filelock.Status {
+	return fl.core.Status()
+}
+
+// LockFunc acquires the lock, retrying until ctx is done, and returns the function
+// releasing it, see filelock.LockFunc
+func (fl *FileLock) LockFunc(ctx context.Context) (release func() error, err error) {
+	return filelock.LockFunc(ctx, fl)
+}
+
+// ContextLock returns a view of the lock whose operations take a context
+func (fl *FileLock) ContextLock() filelock.ContextLock {
+	return fl.core.ContextLock()
+}
+
+// Yield releases the lock and acquires it again after the waiters of this process,
+// if it has been held for longer than the slice of filelock.WithYield
+// It reports whether the lock was released, see filelock.Yielder
+func (fl *FileLock) Yield(ctx context.Context) (bool, error) {
+	return fl.core.Yield(ctx)
+}
+
+// String describes the lock and its current state
+func (fl *FileLock) String() string {
+	return fl.Status().String()
+}
+
+// MarshalJSON encodes the current status of the lock
+func (fl *FileLock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fl.Status())
+}
+
+// SocketName returns the abstract socket name used to lock path, without the
+// leading NUL byte, as shown by tools like ss(8) with an "@" prefix
+func SocketName(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return namePrefix + hex.EncodeToString(sum[:]), nil
+}
+
+// socketDriver locks by binding an abstract unix domain socket
+type socketDriver struct {
+	name string
+	fd   int
+}
+
+func (d *socketDriver) Open(path string) error {
+	name, err := SocketName(path)
+	if err != nil {
+		return err
+	}
+
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	d.name = name
+	d.fd = fd
+	return nil
+}
+
+func (d *socketDriver) TryLock() error {
+	// A leading "@" selects the abstract namespace
+	err := syscall.Bind(d.fd, &syscall.SockaddrUnix{Name: "@" + d.name})
+
+	// EADDRINUSE means the name is bound by someone else
+	if err == syscall.EADDRINUSE {
+		return filelock.ErrLockHeld
+	}
+	return err
+}
+
+func (d *socketDriver) Unlock() error {
+	// The name is released when the socket is closed
+	return nil
+}
+
+func (d *socketDriver) Close() error {
+	err := syscall.Close(d.fd)
+	d.fd = -1
+	return err
+}
@@ -0,0 +1,98 @@
+//go:build linux
+
+package abstract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/testutil"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// AbstractLockTestSuite defines a test suite for the abstract socket FileLock
+type AbstractLockTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test paths before each test
+func (s *AbstractLockTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "abstract-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *AbstractLockTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestBasicLockAndUnlock tests the basic lock and unlock functionality
+func (s *AbstractLockTestSuite) TestBasicLockAndUnlock() {
+	lock := New(filepath.Join(s.tempDir, "basic.lock"))
+
+	s.Require().NoError(lock.Lock())
+	s.Assert().True(lock.IsLocked())
+	s.Assert().Equal(filelock.ErrAlreadyLocked, lock.Lock())
+
+	s.Require().NoError(lock.Unlock())
+	s.Assert().False(lock.IsLocked())
+	s.Assert().Equal(filelock.ErrNotLocked, lock.Unlock())
+}
+
+// TestContention tests that a second instance cannot take a held lock
+func (s *AbstractLockTestSuite) TestContention() {
+	lockPath := filepath.Join(s.tempDir, "contended.lock")
+
+	lock1 := New(lockPath)
+	s.Require().NoError(lock1.Lock())
+
+	lock2 := New(lockPath)
+	s.Assert().Equal(filelock.ErrLockHeld, lock2.Lock())
+	s.Assert().Equal(filelock.ErrTimeout, lock2.LockWithTimeout(50*time.Millisecond))
+
+	s.Require().NoError(lock1.Unlock())
+	s.Require().NoError(lock2.Lock())
+	s.Require().NoError(lock2.Unlock())
+}
+
+// TestNoFileCreated tests that locking leaves nothing on the file system
+func (s *AbstractLockTestSuite) TestNoFileCreated() {
+	lockPath := filepath.Join(s.tempDir, "nofile.lock")
+	lock := New(lockPath)
+	s.Require().NoError(lock.Lock())
+	defer lock.Unlock()
+
+	_, err := os.Stat(lockPath)
+	s.Assert().True(os.IsNotExist(err))
+}
+
+// TestRelativeAndAbsolutePathsConflict tests that the name derives from the absolute path
+func (s *AbstractLockTestSuite) TestRelativeAndAbsolutePathsConflict() {
+	wd, err := os.Getwd()
+	s.Require().NoError(err)
+
+	lock1 := New("relative.lock")
+	s.Require().NoError(lock1.Lock())
+	defer lock1.Unlock()
+
+	lock2 := New(filepath.Join(wd, "relative.lock"))
+	s.Assert().Equal(filelock.ErrLockHeld, lock2.Lock())
+}
+
+// TestCrossProcessStress tests mutual exclusion between real processes
+func (s *AbstractLockTestSuite) TestCrossProcessStress() {
+	testutil.Stress(s.T(), func(path string) filelock.FileLock {
+		return New(path)
+	}, testutil.StressConfig{})
+}
+
+// TestAbstractLock runs the test suite
+func TestAbstractLock(t *testing.T) {
+	suite.Run(t, new(AbstractLockTestSuite))
+}
@@ -0,0 +1,368 @@
+// Package backend adapts lock services to filelock.FileLock.
+//
+// A backend only implements Locker, a single non-blocking lock attempt on a key,
+// and the Lease it returns. New wraps it with the retry loop, timeouts, statistics,
+// status, audit log and options shared by all the FileLock implementations, so
+// code written against filelock.FileLock can move from local file locks to a
+// distributed lock service by changing the constructor only.
+//
+// FileLocker, local file locks, is provided here. The redis and consul
+// sub-packages provide distributed backends using only the standard library, so
+// they add no dependency to programs that do not import them.
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/lockcore"
+)
+
+// Locker is a lock backend
+type Locker interface {
+	// TryLock makes a single non-blocking attempt to lock key.
+	// It returns filelock.ErrLockHeld if the lock is held by someone else.
+	TryLock(ctx context.Context, key string) (Lease, error)
+}
+
+// Lease is a lock held on a backend
+type Lease interface {
+	// Unlock releases the lock. It returns an error wrapping filelock.ErrLockLost
+	// if the lock was lost meanwhile, for example because its lease expired.
+	Unlock(ctx context.Context) error
+}
+
+// FencedLease is implemented by the leases carrying a fencing token, a number
+// increasing with every acquisition of the lock, so the resources it protects can
+// reject the writes of a holder that lost its lease
+type FencedLease interface {
+	Lease
+
+	// FencingToken returns the token of the acquisition, greater than 0
+	FencingToken() uint64
+}
+
+// FileLock is a filelock.FileLock backed by a Locker
+type FileLock struct {
+	core   *lockcore.Lock
+	driver *lockerDriver
+}
+
+// New creates a FileLock locking key on locker
+func New(locker Locker, key string, opts ...filelock.Option) *FileLock {
+	driver := &lockerDriver{locker: locker, events: make(chan RenewalEvent, renewalBuffer)}
+	return &FileLock{
+		core:   lockcore.New(key, driver, filelock.NewOptions(opts...)),
+		driver: driver,
+	}
+}
+
+// SetRenewalPolicy sets how the lock reacts to the failed renewals of its lease,
+// from the next acquisition on. The default policy is ContinueOnFailure.
+func (fl *FileLock) SetRenewalPolicy(policy RenewalPolicy) {
+	fl.driver.mutex.Lock()
+	defer fl.driver.mutex.Unlock()
+	fl.driver.policy = policy
+}
+
+// Renewals returns the channel receiving the outcome of every renewal of the lease
+// of the held lock, for backends renewing their leases (see RenewingLease). Events
+// are dropped while the channel is full.
+func (fl *FileLock) Renewals() <-chan RenewalEvent {
+	return fl.driver.events
+}
+
+// Context returns a context canceled when the held lock is released or its lease is
+// lost, according to the renewal policy, with the cause filelock.ErrNotLocked or an
+// error wrapping filelock.ErrLockLost. Critical sections should stop their work when
+// it is done, as another process may hold the lock. If the lock is not held, the
+// context is already canceled.
+func (fl *FileLock) Context() context.Context {
+	if w := fl.driver.watch.Load(); w != nil {
+		return w.ctx
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(filelock.ErrNotLocked)
+	return ctx
+}
+
+// Proceed returns nil if the critical section can go on: with PauseOnFailure it
+// waits while the renewals of the lease fail, until one succeeds, the lease is lost
+// or ctx is done. It returns an error wrapping filelock.ErrLockLost if the lease is
+// lost, and filelock.ErrNotLocked if the lock is not held.
+func (fl *FileLock) Proceed(ctx context.Context) error {
+	w := fl.driver.watch.Load()
+	if w == nil {
+		return filelock.ErrNotLocked
+	}
+	return w.proceed(ctx)
+}
+
+// FencingToken returns the fencing token of the held lock, for backends whose
+// leases carry one (see FencedLease)
+// It returns ErrNotLocked if the lock is not held, and an error wrapping
+// errors.ErrUnsupported if the backend does not provide fencing tokens
+func (fl *FileLock) FencingToken() (uint64, error) {
+	if !fl.core.IsLocked() {
+		return 0, filelock.ErrNotLocked
+	}
+	token := fl.driver.token.Load()
+	if token == 0 {
+		return 0, fmt.Errorf("%w: %T provides no fencing tokens", errors.ErrUnsupported, fl.driver.locker)
+	}
+	return token, nil
+}
+
+// Lock acquires the lock
+// If the lock cannot be acquired immediately, it returns ErrLockHeld
+func (fl *FileLock) Lock() error {
+	return fl.LockWithTimeout(0)
+}
+
+// LockWithTimeout attempts to acquire the lock with a timeout
+// If timeout is <= 0, it's a non-blocking operation
+// If timeout is > 0, it will retry in a non-blocking manner until the timeout is reached
+func (fl *FileLock) LockWithTimeout(timeout time.Duration) error {
+	return fl.core.LockWithTimeout(timeout)
+}
+
+// Unlock releases the lock
+// If the lock is not held, it returns ErrNotLocked, or nil when created with
+// filelock.WithIdempotentUnlock
+func (fl *FileLock) Unlock() error {
+	return fl.core.Unlock()
+}
+
+// IsLocked returns whether the lock is currently held by this instance
+func (fl *FileLock) IsLocked() bool {
+	return fl.core.IsLocked()
+}
+
+// Path returns the key of this lock
+func (fl *FileLock) Path() string {
+	return fl.core.Path()
+}
+
+// AcquiredAt returns when the lock was acquired, or the zero time if it is not held
+func (fl *FileLock) AcquiredAt() time.Time {
+	return fl.core.AcquiredAt()
+}
+
+// HeldDuration returns how long the lock has been held, or 0 if it is not held
+func (fl *FileLock) HeldDuration() time.Duration {
+	return fl.core.HeldDuration()
+}
+
+// LastAcquireStats returns the number of attempts and the time spent by the most
+// recent acquisition, whether it succeeded or not
+func (fl *FileLock) LastAcquireStats() filelock.AcquireStats {
+	return fl.core.LastAcquireStats()
+}
+
+// Status returns a snapshot of the lock state, including holder and acquisition statistics
+func (fl *FileLock) Status() filelock.Status {
+	return fl.core.Status()
+}
+
+// LockFunc acquires the lock, retrying until ctx is done, and returns the function
+// releasing it, see filelock.LockFunc
+func (fl *FileLock) LockFunc(ctx context.Context) (release func() error, err error) {
+	return filelock.LockFunc(ctx, fl)
+}
+
+// ContextLock returns a view of the lock whose operations take a context
+func (fl *FileLock) ContextLock() filelock.ContextLock {
+	return fl.core.ContextLock()
+}
+
+// Yield releases the lock and acquires it again after the waiters of this process,
+// if it has been held for longer than the slice of filelock.WithYield
+// It reports whether the lock was released, see filelock.Yielder
+func (fl *FileLock) Yield(ctx context.Context) (bool, error) {
+	return fl.core.Yield(ctx)
+}
+
+// Abort interrupts the acquisitions in progress on this instance, including the
+// ones waiting for another operation on it, which return filelock.ErrAborted
+// Later acquisitions are not affected and a held lock stays held
+func (fl *FileLock) Abort() {
+	fl.core.Abort()
+}
+
+// String describes the lock and its current state
+func (fl *FileLock) String() string {
+	return fl.Status().String()
+}
+
+// MarshalJSON encodes the current status of the lock
+func (fl *FileLock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fl.Status())
+}
+
+// lockerDriver adapts a Locker to lockcore.Driver
+type lockerDriver struct {
+	locker Locker
+	key    string
+	lease  Lease
+
+	// token is the fencing token of the held lease, 0 if it has none
+	token atomic.Uint64
+
+	// events receives the renewals of the held lease, followed by watch
+	events chan RenewalEvent
+	watch  atomic.Pointer[leaseWatch]
+
+	// mutex guards policy, which can be set while the lock is in use
+	mutex  sync.Mutex
+	policy RenewalPolicy
+}
+
+func (d *lockerDriver) Open(key string) error {
+	d.key = key
+	return nil
+}
+
+func (d *lockerDriver) TryLock() error {
+	return d.TryLockContext(context.Background())
+}
+
+func (d *lockerDriver) TryLockContext(ctx context.Context) error {
+	lease, err := d.locker.TryLock(ctx, d.key)
+	if err != nil {
+		return err
+	}
+	d.lease = lease
+	if fenced, ok := lease.(FencedLease); ok {
+		d.token.Store(fenced.FencingToken())
+	}
+
+	d.mutex.Lock()
+	w := newLeaseWatch(d.key, d.policy, d.events)
+	d.mutex.Unlock()
+	d.watch.Store(w)
+	if renewing, ok := lease.(RenewingLease); ok {
+		renewing.Renewer().Observe(w.observe)
+	}
+	return nil
+}
+
+func (d *lockerDriver) Unlock() error {
+	return d.UnlockContext(context.Background())
+}
+
+func (d *lockerDriver) UnlockContext(ctx context.Context) error {
+	err := d.lease.Unlock(ctx)
+	d.lease = nil
+	d.token.Store(0)
+	if w := d.watch.Swap(nil); w != nil {
+		w.release()
+	}
+	return err
+}
+
+func (d *lockerDriver) Close() error {
+	return nil
+}
+
+// FileLocker is a Locker using the local file locks of fs.New.
+// Keys are file paths, relative to Dir when it is set.
+type FileLocker struct {
+	Dir string
+}
+
+// TryLock locks the file of key without waiting
+func (f FileLocker) TryLock(_ context.Context, key string) (Lease, error) {
+	path := key
+	if f.Dir != "" {
+		path = filepath.Join(f.Dir, key)
+	}
+
+	lock := fs.New(path)
+	if err := lock.Lock(); err != nil {
+		return nil, err
+	}
+	return fileLease{lock}, nil
+}
+
+type fileLease struct {
+	lock filelock.FileLock
+}
+
+func (l fileLease) Unlock(context.Context) error {
+	return l.lock.Unlock()
+}
+
+// Renewer renews a lease in the background, for backends whose leases expire
+type Renewer struct {
+	stop chan struct{}
+	done chan struct{}
+	lost error
+	once sync.Once
+
+	mutex    sync.Mutex
+	observer func(error)
+}
+
+// StartRenewer calls renew every interval until Stop is called, or until renew
+// returns an error wrapping filelock.ErrLockLost. Other errors are retried on
+// the next interval. Each call gets a context canceled after interval.
+func StartRenewer(interval time.Duration, renew func(ctx context.Context) error) *Renewer {
+	r := &Renewer{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := renew(ctx)
+			cancel()
+			r.notify(err)
+			if errors.Is(err, filelock.ErrLockLost) {
+				r.lost = err
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// Observe makes the renewer call fn with the error of every renewal, nil if it
+// succeeded, replacing the function given before, if any
+func (r *Renewer) Observe(fn func(err error)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.observer = fn
+}
+
+// notify calls the observer, if any, with the error of a renewal
+func (r *Renewer) notify(err error) {
+	r.mutex.Lock()
+	observer := r.observer
+	r.mutex.Unlock()
+	if observer != nil {
+		observer(err)
+	}
+}
+
+// Stop stops the renewals and returns the error reported by the renewal that
+// found the lease lost, if any. It is safe to call Stop more than once.
+func (r *Renewer) Stop() error {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+	return r.lost
+}
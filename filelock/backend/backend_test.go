@@ -0,0 +1,274 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/conformance"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// BackendTestSuite defines a test suite for the backend adapter
+type BackendTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *BackendTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "backend-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *BackendTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestFileLocker tests the FileLock semantics on top of the file backend
+func (s *BackendTestSuite) TestFileLocker() {
+	locker := FileLocker{Dir: s.tempDir}
+	first, second := New(locker, "key.lock"), New(locker, "key.lock")
+
+	s.Require().NoError(first.Lock())
+	s.Assert().FileExists(filepath.Join(s.tempDir, "key.lock"))
+	s.Assert().Equal(filelock.ErrLockHeld, second.Lock())
+	s.Assert().Equal(filelock.ErrTimeout, second.LockWithTimeout(30*time.Millisecond))
+	s.Assert().Equal("key.lock", first.Status().Path)
+
+	s.Require().NoError(first.Unlock())
+	s.Require().NoError(second.Lock())
+	s.Require().NoError(second.Unlock())
+	s.Assert().Equal(filelock.ErrNotLocked, second.Unlock())
+}
+
+// lostLease is a Lease that was lost before being released
+type lostLease struct{}
+
+func (lostLease) Unlock(context.Context) error {
+	return fmt.Errorf("%w: expired", filelock.ErrLockLost)
+}
+
+type lostLocker struct{}
+
+func (lostLocker) TryLock(context.Context, string) (Lease, error) {
+	return lostLease{}, nil
+}
+
+// TestLostLease tests that a lost lease is reported and forgotten
+func (s *BackendTestSuite) TestLostLease() {
+	lock := New(lostLocker{}, "key")
+	s.Require().NoError(lock.Lock())
+	s.Assert().ErrorIs(lock.Unlock(), filelock.ErrLockLost)
+	s.Assert().False(lock.IsLocked())
+}
+
+// fencedLocker hands out leases carrying increasing fencing tokens
+type fencedLocker struct {
+	tokens atomic.Uint64
+}
+
+type fencedLease uint64
+
+func (fencedLease) Unlock(context.Context) error {
+	return nil
+}
+
+func (l fencedLease) FencingToken() uint64 {
+	return uint64(l)
+}
+
+func (f *fencedLocker) TryLock(context.Context, string) (Lease, error) {
+	return fencedLease(f.tokens.Add(1)), nil
+}
+
+// TestFencingToken tests that the fencing token of the held lease is reported
+func (s *BackendTestSuite) TestFencingToken() {
+	lock := New(&fencedLocker{}, "key")
+	_, err := lock.FencingToken()
+	s.Assert().Equal(filelock.ErrNotLocked, err)
+
+	s.Require().NoError(lock.Lock())
+	token, err := lock.FencingToken()
+	s.Require().NoError(err)
+	s.Assert().Equal(uint64(1), token)
+	s.Require().NoError(lock.Unlock())
+	s.Require().NoError(lock.Lock())
+	token, _ = lock.FencingToken()
+	s.Assert().Equal(uint64(2), token)
+	s.Require().NoError(lock.Unlock())
+
+	result, err := filelock.Acquire(context.Background(), lock)
+	s.Require().NoError(err)
+	s.Assert().Equal(uint64(3), result.FencingToken)
+	s.Require().NoError(lock.Unlock())
+
+	local := New(FileLocker{Dir: s.tempDir}, "key.lock")
+	s.Require().NoError(local.Lock())
+	_, err = local.FencingToken()
+	s.Assert().ErrorIs(err, errors.ErrUnsupported)
+	s.Require().NoError(local.Unlock())
+}
+
+// TestRenewer tests that renewals run until stopped or until the lease is lost
+func (s *BackendTestSuite) TestRenewer() {
+	var calls atomic.Int32
+	r := StartRenewer(5*time.Millisecond, func(context.Context) error {
+		calls.Add(1)
+		return errors.New("transient")
+	})
+	s.Assert().Eventually(func() bool { return calls.Load() >= 3 }, time.Second, time.Millisecond)
+	s.Assert().NoError(r.Stop())
+	s.Assert().NoError(r.Stop())
+
+	r = StartRenewer(5*time.Millisecond, func(context.Context) error {
+		return fmt.Errorf("%w: gone", filelock.ErrLockLost)
+	})
+	time.Sleep(30 * time.Millisecond)
+	s.Assert().ErrorIs(r.Stop(), filelock.ErrLockLost)
+}
+
+// flakyLocker hands out leases renewed every 5ms, renewals failing while fail is set
+type flakyLocker struct {
+	fail atomic.Pointer[error]
+}
+
+func (l *flakyLocker) TryLock(context.Context, string) (Lease, error) {
+	return &flakyLease{StartRenewer(5*time.Millisecond, func(context.Context) error {
+		if err := l.fail.Load(); err != nil {
+			return *err
+		}
+		return nil
+	})}, nil
+}
+
+// setFailure makes the renewals fail with err, or succeed if err is nil
+func (l *flakyLocker) setFailure(err error) {
+	if err == nil {
+		l.fail.Store(nil)
+		return
+	}
+	l.fail.Store(&err)
+}
+
+type flakyLease struct {
+	renewer *Renewer
+}
+
+func (l *flakyLease) Renewer() *Renewer {
+	return l.renewer
+}
+
+func (l *flakyLease) Unlock(context.Context) error {
+	return l.renewer.Stop()
+}
+
+// nextRenewal returns the next renewal event of lock matching match
+func (s *BackendTestSuite) nextRenewal(lock *FileLock, match func(RenewalEvent) bool) RenewalEvent {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case event := <-lock.Renewals():
+			if match(event) {
+				return event
+			}
+		case <-timeout:
+			s.FailNow("no matching renewal event")
+		}
+	}
+}
+
+// TestRenewals tests that renewals are reported and that failures only cancel the
+// context with AbortOnFailure past the grace period
+func (s *BackendTestSuite) TestRenewals() {
+	locker := &flakyLocker{}
+	lock := New(locker, "key")
+	s.Assert().ErrorIs(context.Cause(lock.Context()), filelock.ErrNotLocked)
+	s.Assert().ErrorIs(lock.Proceed(context.Background()), filelock.ErrNotLocked)
+
+	s.Require().NoError(lock.Lock())
+	event := s.nextRenewal(lock, func(RenewalEvent) bool { return true })
+	s.Assert().Equal("key", event.Key)
+	s.Assert().NoError(event.Err)
+
+	locker.setFailure(errors.New("connection refused"))
+	event = s.nextRenewal(lock, func(e RenewalEvent) bool { return e.Failures >= 3 })
+	s.Assert().False(event.Lost, "failures are only reported by default")
+	s.Assert().NoError(lock.Context().Err())
+	s.Assert().NoError(lock.Proceed(context.Background()))
+	s.Require().NoError(lock.Unlock())
+	s.Assert().ErrorIs(context.Cause(lock.Context()), filelock.ErrNotLocked)
+
+	lock.SetRenewalPolicy(RenewalPolicy{Grace: 20 * time.Millisecond, OnFailure: AbortOnFailure})
+	s.Require().NoError(lock.Lock())
+	ctx := lock.Context()
+	select {
+	case <-ctx.Done():
+		s.Assert().ErrorIs(context.Cause(ctx), filelock.ErrLockLost)
+	case <-time.After(time.Second):
+		s.Fail("the context is canceled past the grace period")
+	}
+	s.Assert().ErrorIs(lock.Proceed(context.Background()), filelock.ErrLockLost)
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestRenewalsPause tests that Proceed waits while the renewals fail
+func (s *BackendTestSuite) TestRenewalsPause() {
+	locker := &flakyLocker{}
+	lock := New(locker, "key")
+	lock.SetRenewalPolicy(RenewalPolicy{Grace: time.Minute, OnFailure: PauseOnFailure})
+	s.Require().NoError(lock.Lock())
+	defer lock.Unlock()
+
+	locker.setFailure(errors.New("timeout"))
+	s.nextRenewal(lock, func(e RenewalEvent) bool { return e.Failures > 0 })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	s.Assert().ErrorIs(lock.Proceed(ctx), context.DeadlineExceeded, "paused while failing")
+
+	proceeded := make(chan error, 1)
+	go func() { proceeded <- lock.Proceed(context.Background()) }()
+	locker.setFailure(nil)
+	select {
+	case err := <-proceeded:
+		s.Assert().NoError(err, "resumed by a successful renewal")
+	case <-time.After(time.Second):
+		s.Fail("Proceed still waiting after a successful renewal")
+	}
+	s.Assert().NoError(lock.Context().Err())
+}
+
+// TestRenewalsLost tests that a lease the backend reports lost cancels the context
+func (s *BackendTestSuite) TestRenewalsLost() {
+	locker := &flakyLocker{}
+	lock := New(locker, "key")
+	s.Require().NoError(lock.Lock())
+
+	locker.setFailure(fmt.Errorf("%w: expired", filelock.ErrLockLost))
+	event := s.nextRenewal(lock, func(e RenewalEvent) bool { return e.Lost })
+	s.Assert().ErrorIs(event.Err, filelock.ErrLockLost)
+	<-lock.Context().Done()
+	s.Assert().ErrorIs(context.Cause(lock.Context()), filelock.ErrLockLost)
+	s.Assert().ErrorIs(lock.Unlock(), filelock.ErrLockLost)
+}
+
+// TestConformance runs the conformance checks shared by all the backends
+func (s *BackendTestSuite) TestConformance() {
+	conformance.Run(s.T(), func(path string, opts ...filelock.Option) filelock.FileLock {
+		return New(FileLocker{}, path, opts...)
+	}, conformance.Config{})
+}
+
+// TestBackend runs the test suite
+func TestBackend(t *testing.T) {
+	suite.Run(t, new(BackendTestSuite))
+}
@@ -0,0 +1,324 @@
+// Package cluster is a lock backend for hosts sharing a directory over a network
+// file system, an NFS export for example, providing leases and fencing tokens
+// without any lock service.
+//
+// The lock on a key is a lease record, a small JSON file in the shared directory
+// naming the holder, its fencing token and when its lease expires. The record is
+// only read and replaced under a short-lived mutex file, created NFS-safely by
+// hard linking a temporary file to it, and replaced by an atomic rename, so every
+// host sees a complete record. Held locks renew their lease every third of its
+// TTL; the lease of a crashed holder is taken over once it expired by more than
+// the skew allowance. Released records stay in place, so the fencing token of
+// the next holder is always greater than the previous one.
+//
+// Expiry is judged on the clock of the file system, which sets the modification
+// times of the files, rather than on the clocks of the hosts: a record expires
+// once its modification time is older than its TTL plus the allowance, the
+// current time of the file system being measured on the temporary file created
+// for the mutex. A host whose clock is wrong therefore neither steals live
+// leases nor keeps expired ones. The hosts whose clocks differ from the one of
+// the file system by more than the allowance are reported by WithSkewWarning,
+// as their clocks may break other software.
+//
+// Fencing tokens protect the resources shared by the holders against a holder
+// that lost its lease without noticing, a paused process for example: the
+// resource remembers the greatest token it has seen and rejects older ones, as
+// Fence does for resources on the shared directory.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rsgcata/go-fs/atomicfile"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/backend"
+)
+
+// DefaultTTL is the default duration of the leases
+const DefaultTTL = 30 * time.Second
+
+// DefaultMaxClockSkew is the default skew allowance
+const DefaultMaxClockSkew = 5 * time.Second
+
+// Locker locks keys in a directory shared by several hosts
+type Locker struct {
+	dir      string
+	identity string
+	ttl      time.Duration
+	skew     time.Duration
+	perm     os.FileMode
+	warn     func(SkewWarning)
+}
+
+var (
+	_ backend.Locker        = (*Locker)(nil)
+	_ backend.RenewingLease = (*lease)(nil)
+	_ backend.FencedLease   = (*lease)(nil)
+)
+
+// Option configures a Locker
+type Option func(*Locker)
+
+// WithTTL sets the duration of the leases, DefaultTTL by default
+func WithTTL(ttl time.Duration) Option {
+	return func(l *Locker) {
+		l.ttl = ttl
+	}
+}
+
+// WithMaxClockSkew sets the skew allowance, DefaultMaxClockSkew by default. An
+// expired lease is only taken over once it expired by more than skew, which
+// covers the coarse modification times of some file systems, and clocks
+// differing from the one of the file system by more than skew are reported.
+func WithMaxClockSkew(skew time.Duration) Option {
+	return func(l *Locker) {
+		l.skew = skew
+	}
+}
+
+// SkewWarning reports a clock differing from the clock of the shared file system
+// by more than the skew allowance
+type SkewWarning struct {
+	// Path is the path of the lease record
+	Path string
+
+	// Identity names the host of the clock, this Locker or the holder of the
+	// record
+	Identity string
+
+	// Skew is the clock of the host minus the clock of the file system
+	Skew time.Duration
+
+	// Allowance is the skew allowance of the Locker
+	Allowance time.Duration
+}
+
+// WithSkewWarning calls fn with the clocks found differing from the clock of the
+// file system by more than the skew allowance, on every acquisition and renewal.
+// fn must not block.
+func WithSkewWarning(fn func(SkewWarning)) Option {
+	return func(l *Locker) {
+		l.warn = fn
+	}
+}
+
+// WithPerm sets the permission of the lease records, 0644 by default
+func WithPerm(perm os.FileMode) Option {
+	return func(l *Locker) {
+		l.perm = perm
+	}
+}
+
+// New creates a Locker for the keys in the shared directory dir, identity naming
+// this holder, unique among the hosts, like hostname:pid
+func New(dir, identity string, opts ...Option) *Locker {
+	l := &Locker{dir: dir, identity: identity, ttl: DefaultTTL, skew: DefaultMaxClockSkew, perm: 0644}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// AcquireClusterLock acquires the lock on the lease record at path in a shared
+// directory for identity, retrying until ctx is done. The returned lock renews
+// its lease while held and cancels its Context when the lease is lost, a third
+// of the TTL after the renewals started failing, before another host may take
+// it over; FencingToken returns the fencing token of the acquisition.
+func AcquireClusterLock(ctx context.Context, path, identity string, opts ...Option) (*backend.FileLock, error) {
+	locker := New(filepath.Dir(path), identity, opts...)
+	lock := backend.New(locker, filepath.Base(path))
+	lock.SetRenewalPolicy(backend.RenewalPolicy{Grace: locker.ttl / 3, OnFailure: backend.AbortOnFailure})
+	if err := lock.ContextLock().Lock(ctx); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// Record is the lease record of a key
+type Record struct {
+	// Identity names the holder
+	Identity string `json:"identity"`
+
+	// Token is the fencing token of the last acquisition
+	Token uint64 `json:"token"`
+
+	// Renewed is when the lease was acquired or last renewed, on the clock of the
+	// holder
+	Renewed time.Time `json:"renewed"`
+
+	// TTL is the duration of the lease, from the modification time of the record
+	TTL time.Duration `json:"ttl"`
+
+	// Expires is when the lease expires, on the clock of the holder. It is only
+	// informative, expiry is judged on the modification time of the record.
+	Expires time.Time `json:"expires"`
+
+	// Released reports that the holder released the lock
+	Released bool `json:"released,omitempty"`
+}
+
+// ReadRecord returns the lease record at path
+func ReadRecord(path string) (Record, error) {
+	rec, _, err := readRecord(path)
+	return rec, err
+}
+
+// readRecord returns the lease record at path and its modification time
+func readRecord(path string) (Record, time.Time, error) {
+	var rec Record
+	file, err := os.Open(path)
+	if err != nil {
+		return rec, time.Time{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return rec, time.Time{}, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return rec, time.Time{}, err
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, time.Time{}, fmt.Errorf("lease record %s: %w", path, err)
+	}
+	return rec, info.ModTime(), nil
+}
+
+// TryLock takes over the lease record of key if it is released or expired, and
+// renews it while held
+func (l *Locker) TryLock(ctx context.Context, key string) (backend.Lease, error) {
+	path := filepath.Join(l.dir, key)
+	mutex, err := lockMutex(ctx, path, l.skew)
+	if err != nil {
+		return nil, err
+	}
+	defer mutex.unlock()
+	l.checkSkew(path, l.identity, mutex.skew)
+
+	rec, modTime, err := readRecord(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil && !rec.Released {
+		if !rec.Renewed.IsZero() {
+			l.checkSkew(path, rec.Identity, rec.Renewed.Sub(modTime))
+		}
+		ttl := rec.TTL
+		if ttl <= 0 {
+			ttl = l.ttl
+		}
+		if mutex.storageNow().Sub(modTime) <= ttl+l.skew {
+			return nil, filelock.ErrLockHeld
+		}
+	}
+
+	now := time.Now()
+	next := Record{Identity: l.identity, Token: rec.Token + 1, Renewed: now, TTL: l.ttl, Expires: now.Add(l.ttl)}
+	if err := l.write(path, next); err != nil {
+		return nil, err
+	}
+
+	lease := &lease{locker: l, path: path, token: next.Token, renewed: now}
+	lease.renewer = backend.StartRenewer(l.ttl/3, lease.renew)
+	return lease, nil
+}
+
+// update applies fn to the lease record at path under the mutex, if it is still
+// the one of the acquisition of token
+func (l *Locker) update(ctx context.Context, path string, token uint64, fn func(rec *Record)) error {
+	mutex, err := lockMutex(ctx, path, l.skew)
+	if err != nil {
+		return err
+	}
+	defer mutex.unlock()
+	l.checkSkew(path, l.identity, mutex.skew)
+
+	rec, err := ReadRecord(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: lease record %s was removed", filelock.ErrLockLost, path)
+	}
+	if err != nil {
+		return err
+	}
+	if rec.Identity != l.identity || rec.Token != token || rec.Released {
+		return fmt.Errorf("%w: lease %s taken over by %s with token %d", filelock.ErrLockLost, path, rec.Identity, rec.Token)
+	}
+	fn(&rec)
+	return l.write(path, rec)
+}
+
+// checkSkew reports the clock of identity if its skew exceeds the allowance
+func (l *Locker) checkSkew(path, identity string, skew time.Duration) {
+	if l.warn != nil && (skew > l.skew || skew < -l.skew) {
+		l.warn(SkewWarning{Path: path, Identity: identity, Skew: skew, Allowance: l.skew})
+	}
+}
+
+// write replaces the lease record at path with rec
+func (l *Locker) write(path string, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, append(data, '\n'), l.perm)
+}
+
+type lease struct {
+	locker  *Locker
+	path    string
+	token   uint64
+	renewer *backend.Renewer
+
+	// renewed is when the last successful renewal started, only used by the
+	// renewer
+	renewed time.Time
+}
+
+// Renewer returns the renewer of the lease
+func (l *lease) Renewer() *backend.Renewer {
+	return l.renewer
+}
+
+// FencingToken returns the fencing token of the acquisition
+func (l *lease) FencingToken() uint64 {
+	return l.token
+}
+
+// renew extends the lease, which is lost once it expired without renewal
+func (l *lease) renew(ctx context.Context) error {
+	start := time.Now()
+	err := l.locker.update(ctx, l.path, l.token, func(rec *Record) {
+		rec.Renewed = start
+		rec.TTL = l.locker.ttl
+		rec.Expires = start.Add(l.locker.ttl)
+	})
+	if err == nil {
+		l.renewed = start
+		return nil
+	}
+	if !errors.Is(err, filelock.ErrLockLost) && time.Since(l.renewed) >= l.locker.ttl {
+		return fmt.Errorf("%w: lease %s expired at %s: %w", filelock.ErrLockLost, l.path, l.renewed.Add(l.locker.ttl), err)
+	}
+	return err
+}
+
+func (l *lease) Unlock(ctx context.Context) error {
+	if err := l.renewer.Stop(); err != nil {
+		return err
+	}
+	return l.locker.update(ctx, l.path, l.token, func(rec *Record) {
+		rec.Released = true
+		rec.Renewed = time.Now()
+		rec.Expires = rec.Renewed
+	})
+}
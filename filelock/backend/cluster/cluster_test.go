@@ -0,0 +1,201 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/backend"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// ClusterTestSuite defines a test suite for the shared directory backend
+type ClusterTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *ClusterTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "cluster-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest cleans up the temporary directory after each test
+func (s *ClusterTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// writeRecord writes rec as the lease record of key, modified at modTime
+func (s *ClusterTestSuite) writeRecord(key string, rec Record, modTime time.Time) {
+	path := filepath.Join(s.tempDir, key)
+	data, err := json.Marshal(rec)
+	s.Require().NoError(err)
+	s.Require().NoError(os.WriteFile(path, data, 0644))
+	s.Require().NoError(os.Chtimes(path, modTime, modTime))
+}
+
+// TestExclusive tests that hosts take the lock in turn with increasing tokens
+func (s *ClusterTestSuite) TestExclusive() {
+	first := backend.New(New(s.tempDir, "host-a:1"), "job.lease")
+	second := backend.New(New(s.tempDir, "host-b:1"), "job.lease")
+
+	s.Require().NoError(first.Lock())
+	s.Assert().ErrorIs(second.Lock(), filelock.ErrLockHeld)
+	token, err := first.FencingToken()
+	s.Require().NoError(err)
+	s.Assert().Equal(uint64(1), token)
+
+	rec, err := ReadRecord(filepath.Join(s.tempDir, "job.lease"))
+	s.Require().NoError(err)
+	s.Assert().Equal("host-a:1", rec.Identity)
+	s.Assert().Equal(uint64(1), rec.Token)
+	s.Assert().False(rec.Released)
+	s.Assert().NoFileExists(filepath.Join(s.tempDir, "job.lease"+MutexSuffix))
+
+	s.Require().NoError(first.Unlock())
+	rec, err = ReadRecord(filepath.Join(s.tempDir, "job.lease"))
+	s.Require().NoError(err)
+	s.Assert().True(rec.Released)
+
+	s.Require().NoError(second.Lock())
+	token, err = second.FencingToken()
+	s.Require().NoError(err)
+	s.Assert().Equal(uint64(2), token)
+	s.Require().NoError(second.Unlock())
+}
+
+// TestExpired tests that an expired lease is taken over only once its record
+// is older than its TTL plus the skew allowance on the clock of the file system
+func (s *ClusterTestSuite) TestExpired() {
+	// The clock of the crashed holder is an hour ahead
+	ahead := time.Now().Add(time.Hour)
+	s.writeRecord("job.lease", Record{
+		Identity: "crashed:1", Token: 7, Renewed: ahead, TTL: 10 * time.Millisecond, Expires: ahead,
+	}, time.Now().Add(-time.Second))
+
+	lock := backend.New(New(s.tempDir, "host-a:1", WithMaxClockSkew(time.Minute)), "job.lease")
+	s.Assert().ErrorIs(lock.Lock(), filelock.ErrLockHeld)
+
+	var warnings []SkewWarning
+	lock = backend.New(New(s.tempDir, "host-a:1", WithMaxClockSkew(500*time.Millisecond),
+		WithSkewWarning(func(w SkewWarning) { warnings = append(warnings, w) })), "job.lease")
+	s.Require().NoError(lock.Lock())
+	token, err := lock.FencingToken()
+	s.Require().NoError(err)
+	s.Assert().Equal(uint64(8), token)
+	s.Require().NoError(lock.Unlock())
+
+	s.Require().Len(warnings, 1)
+	s.Assert().Equal("crashed:1", warnings[0].Identity)
+	s.Assert().Equal(filepath.Join(s.tempDir, "job.lease"), warnings[0].Path)
+	s.Assert().InDelta(time.Hour+time.Second, warnings[0].Skew, float64(time.Second))
+	s.Assert().Equal(500*time.Millisecond, warnings[0].Allowance)
+}
+
+// TestLiveWithSkewedClock tests that a renewed lease is not taken over whatever
+// the expiry written by the clock of its holder
+func (s *ClusterTestSuite) TestLiveWithSkewedClock() {
+	behind := time.Now().Add(-time.Hour)
+	s.writeRecord("job.lease", Record{
+		Identity: "host-b:1", Token: 3, Renewed: behind, TTL: time.Minute, Expires: behind.Add(time.Minute),
+	}, time.Now())
+
+	lock := backend.New(New(s.tempDir, "host-a:1"), "job.lease")
+	s.Assert().ErrorIs(lock.Lock(), filelock.ErrLockHeld)
+}
+
+// TestRenewal tests that held leases are extended
+func (s *ClusterTestSuite) TestRenewal() {
+	path := filepath.Join(s.tempDir, "job.lease")
+	lock := backend.New(New(s.tempDir, "host-a:1", WithTTL(60*time.Millisecond)), "job.lease")
+	s.Require().NoError(lock.Lock())
+	rec, err := ReadRecord(path)
+	s.Require().NoError(err)
+
+	s.Eventually(func() bool {
+		renewed, err := ReadRecord(path)
+		return err == nil && renewed.Expires.After(rec.Expires)
+	}, time.Second, 5*time.Millisecond)
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestTakenOver tests that a holder whose lease was taken over loses its lock
+func (s *ClusterTestSuite) TestTakenOver() {
+	lock := backend.New(New(s.tempDir, "host-a:1", WithTTL(30*time.Millisecond)), "job.lease")
+	s.Require().NoError(lock.Lock())
+	s.writeRecord("job.lease", Record{Identity: "host-b:1", Token: 2, TTL: time.Minute}, time.Now())
+
+	select {
+	case <-lock.Context().Done():
+	case <-time.After(time.Second):
+		s.FailNow("lease not lost")
+	}
+	s.Assert().ErrorIs(context.Cause(lock.Context()), filelock.ErrLockLost)
+	s.Assert().ErrorIs(lock.Unlock(), filelock.ErrLockLost)
+}
+
+// TestStaleMutex tests that a mutex file left by a crashed host is removed
+func (s *ClusterTestSuite) TestStaleMutex() {
+	mutex := filepath.Join(s.tempDir, "job.lease"+MutexSuffix)
+	s.Require().NoError(os.WriteFile(mutex, nil, 0644))
+
+	lock := backend.New(New(s.tempDir, "host-a:1"), "job.lease")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s.Assert().ErrorIs(lock.ContextLock().Lock(ctx), context.DeadlineExceeded)
+
+	old := time.Now().Add(-time.Minute)
+	s.Require().NoError(os.Chtimes(mutex, old, old))
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestAcquireClusterLock tests the lock returned by AcquireClusterLock
+func (s *ClusterTestSuite) TestAcquireClusterLock() {
+	path := filepath.Join(s.tempDir, "job.lease")
+	lock, err := AcquireClusterLock(context.Background(), path, "host-a:1")
+	s.Require().NoError(err)
+	s.Assert().Nil(lock.Context().Err())
+	token, err := lock.FencingToken()
+	s.Require().NoError(err)
+	s.Assert().Equal(uint64(1), token)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = AcquireClusterLock(ctx, path, "host-b:1")
+	s.Assert().Error(err)
+
+	s.Require().NoError(lock.Unlock())
+	s.Assert().Error(lock.Context().Err())
+}
+
+// TestFence tests that older fencing tokens are rejected
+func (s *ClusterTestSuite) TestFence() {
+	ctx := context.Background()
+	fence := NewFence(filepath.Join(s.tempDir, "data.fence"))
+
+	token, err := fence.Token()
+	s.Require().NoError(err)
+	s.Assert().Zero(token)
+
+	s.Require().NoError(fence.Admit(ctx, 2))
+	s.Require().NoError(fence.Admit(ctx, 2))
+	s.Assert().ErrorIs(fence.Admit(ctx, 1), ErrStaleToken)
+	s.Require().NoError(fence.Admit(ctx, 3))
+
+	token, err = fence.Token()
+	s.Require().NoError(err)
+	s.Assert().Equal(uint64(3), token)
+}
+
+// TestCluster runs the test suite
+func TestCluster(t *testing.T) {
+	suite.Run(t, new(ClusterTestSuite))
+}
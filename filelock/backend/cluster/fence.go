@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsgcata/go-fs/atomicfile"
+)
+
+// ErrStaleToken is returned by Fence.Admit for a fencing token older than the
+// greatest one admitted
+var ErrStaleToken = errors.New("stale fencing token")
+
+// Fence guards a resource on the shared directory with the fencing tokens of its
+// holders: the greatest admitted token is kept in a file, and older tokens are
+// rejected, so a holder that lost its lease cannot write after the next holder
+// started
+type Fence struct {
+	path string
+	skew time.Duration
+}
+
+// NewFence creates a Fence keeping the greatest admitted token in the file at
+// path
+func NewFence(path string) *Fence {
+	return &Fence{path: path, skew: DefaultMaxClockSkew}
+}
+
+// Admit records token if it is not older than the greatest admitted token, and
+// returns an error wrapping ErrStaleToken otherwise. Holders call it before
+// every write to the resource.
+func (f *Fence) Admit(ctx context.Context, token uint64) error {
+	mutex, err := lockMutex(ctx, f.path, f.skew)
+	if err != nil {
+		return err
+	}
+	defer mutex.unlock()
+
+	last, err := f.read()
+	if err != nil {
+		return err
+	}
+	if token < last {
+		return fmt.Errorf("%w: %d, %s admitted %d", ErrStaleToken, token, f.path, last)
+	}
+	if token == last {
+		return nil
+	}
+	return atomicfile.WriteFile(f.path, []byte(strconv.FormatUint(token, 10)+"\n"), 0644)
+}
+
+// Token returns the greatest admitted token, 0 if none was admitted
+func (f *Fence) Token() (uint64, error) {
+	return f.read()
+}
+
+func (f *Fence) read() (uint64, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	token, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("fence %s: %w", f.path, err)
+	}
+	return token, nil
+}
@@ -0,0 +1,159 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// MutexSuffix is appended to the path of a lease record to get the mutex file
+// guarding its updates
+const MutexSuffix = ".mutex"
+
+const (
+	// mutexPoll is the interval between the attempts to take a mutex
+	mutexPoll = 5 * time.Millisecond
+
+	// mutexWait is how long a mutex is waited for before giving up with
+	// filelock.ErrLockHeld, the mutex being only held for a few file operations
+	mutexWait = 2 * time.Second
+
+	// mutexStale is the age after which a mutex file is left by a crashed holder
+	mutexStale = 10 * time.Second
+)
+
+// tempCounter tells apart the temporary files of this process
+var tempCounter atomic.Uint64
+
+// heldMutex is a held mutex file, which measured the clock of the file system
+// when taken
+type heldMutex struct {
+	path string
+
+	// storageTime is the modification time given by the file system to the
+	// temporary file linked to the mutex, and localTime when this host saw it
+	storageTime time.Time
+	localTime   time.Time
+
+	// skew is the clock of this host minus the clock of the file system
+	skew time.Duration
+}
+
+// storageNow estimates the current time on the clock of the file system, never
+// after the actual one
+func (m *heldMutex) storageNow() time.Time {
+	return m.storageTime.Add(time.Since(m.localTime))
+}
+
+// unlock releases the mutex
+func (m *heldMutex) unlock() {
+	_ = os.Remove(m.path)
+}
+
+// lockMutex takes the mutex file guarding the file at path, removing it when
+// its modification time is older than mutexStale plus skew on the clock of the
+// file system
+func lockMutex(ctx context.Context, path string, skew time.Duration) (*heldMutex, error) {
+	m := &heldMutex{path: path + MutexSuffix}
+	before := time.Now()
+	tmp, err := writeTemp(m.path)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return nil, err
+	}
+	m.storageTime, m.localTime = info.ModTime(), time.Now()
+	switch {
+	case m.storageTime.Before(before):
+		m.skew = before.Sub(m.storageTime)
+	case m.storageTime.After(m.localTime):
+		m.skew = m.localTime.Sub(m.storageTime)
+	}
+
+	deadline := time.Now().Add(mutexWait)
+	for {
+		err := os.Link(tmp, m.path)
+		if err == nil || linked(tmp, m.path) {
+			// Over NFS, the link may be done even though the reply was lost
+			return m, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if removeStale(m.path, m.storageNow(), mutexStale+skew) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: mutex %s held for more than %s", filelock.ErrLockHeld, m.path, mutexWait)
+		}
+
+		timer := time.NewTimer(mutexPoll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, context.Cause(ctx)
+		case <-timer.C:
+		}
+	}
+}
+
+// writeTemp creates a temporary file next to the file at path, unique among the
+// hosts, and returns its path
+func writeTemp(path string) (string, error) {
+	hostname, _ := os.Hostname()
+	name := fmt.Sprintf(".%s.%s.%d.%d", filepath.Base(path), hostname, os.Getpid(), tempCounter.Add(1))
+	tmp := filepath.Join(filepath.Dir(path), name)
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// linked reports whether the file at path is the temporary file tmp
+func linked(tmp, path string) bool {
+	tmpInfo, err := os.Stat(tmp)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && os.SameFile(tmpInfo, info)
+}
+
+// removeStale removes the file at path if its modification time is older than
+// age at now, on the clock of the file system, and reports whether it did. The
+// file is removed only if it is still the one judged stale.
+func removeStale(path string, now time.Time, age time.Duration) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		// Removed in between, the next attempt may succeed
+		return errors.Is(err, fs.ErrNotExist)
+	}
+	if now.Sub(info.ModTime()) < age {
+		return false
+	}
+	if current, err := os.Stat(path); err != nil || !os.SameFile(info, current) ||
+		!current.ModTime().Equal(info.ModTime()) {
+		return false
+	}
+	return os.Remove(path) == nil
+}
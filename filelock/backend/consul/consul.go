@@ -0,0 +1,197 @@
+// Package consul is a lock backend using Consul sessions and the acquire and
+// release operations of its key-value store.
+//
+// Each lock acquisition creates a session with a TTL, renewed every third of the
+// TTL while the lock is held. When the holder dies, the session expires and
+// Consul deletes the lock key. The client uses the HTTP API directly and only
+// depends on the standard library.
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/backend"
+)
+
+// DefaultTTL is the default TTL of the sessions, the minimum accepted by Consul
+const DefaultTTL = 10 * time.Second
+
+// Locker locks keys of a Consul key-value store
+type Locker struct {
+	addr       string
+	token      string
+	ttl        time.Duration
+	prefix     string
+	httpClient *http.Client
+}
+
+var (
+	_ backend.Locker        = (*Locker)(nil)
+	_ backend.RenewingLease = (*lease)(nil)
+)
+
+// Option configures a Locker
+type Option func(*Locker)
+
+// WithToken authenticates with the ACL token
+func WithToken(token string) Option {
+	return func(l *Locker) {
+		l.token = token
+	}
+}
+
+// WithTTL sets the TTL of the sessions, DefaultTTL by default
+func WithTTL(ttl time.Duration) Option {
+	return func(l *Locker) {
+		l.ttl = ttl
+	}
+}
+
+// WithKeyPrefix prefixes the lock keys with prefix, e.g. "locks/"
+func WithKeyPrefix(prefix string) Option {
+	return func(l *Locker) {
+		l.prefix = prefix
+	}
+}
+
+// WithHTTPClient sets the http.Client used to reach Consul, http.DefaultClient by default
+func WithHTTPClient(c *http.Client) Option {
+	return func(l *Locker) {
+		l.httpClient = c
+	}
+}
+
+// New creates a Locker for the Consul agent at addr, e.g. "http://127.0.0.1:8500"
+func New(addr string, opts ...Option) *Locker {
+	l := &Locker{
+		addr:       strings.TrimSuffix(addr, "/"),
+		ttl:        DefaultTTL,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// TryLock creates a session and acquires key with it
+func (l *Locker) TryLock(ctx context.Context, key string) (backend.Lease, error) {
+	var session struct{ ID string }
+	err := l.call(ctx, "/v1/session/create", map[string]string{
+		"Name":      "go-fs lock " + key,
+		"TTL":       l.ttl.String(),
+		"Behavior":  "delete",
+		"LockDelay": "0s",
+	}, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	key = l.prefix + key
+	holder, err := json.Marshal(filelock.CurrentHolder())
+	if err != nil {
+		return nil, err
+	}
+	var acquired bool
+	err = l.call(ctx, "/v1/kv/"+escapeKey(key)+"?acquire="+session.ID, json.RawMessage(holder), &acquired)
+	if err != nil || !acquired {
+		_ = l.call(ctx, "/v1/session/destroy/"+session.ID, nil, nil)
+		if err == nil {
+			err = filelock.ErrLockHeld
+		}
+		return nil, err
+	}
+
+	lease := &lease{locker: l, key: key, session: session.ID}
+	lease.renewer = backend.StartRenewer(l.ttl/3, func(ctx context.Context) error {
+		return l.call(ctx, "/v1/session/renew/"+session.ID, nil, nil)
+	})
+	return lease, nil
+}
+
+type lease struct {
+	locker  *Locker
+	key     string
+	session string
+	renewer *backend.Renewer
+}
+
+// Renewer returns the renewer of the lease
+func (l *lease) Renewer() *backend.Renewer {
+	return l.renewer
+}
+
+func (l *lease) Unlock(ctx context.Context) error {
+	if err := l.renewer.Stop(); err != nil {
+		return err
+	}
+
+	var released bool
+	err := l.locker.call(ctx, "/v1/kv/"+escapeKey(l.key)+"?release="+l.session, nil, &released)
+	_ = l.locker.call(ctx, "/v1/session/destroy/"+l.session, nil, nil)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return fmt.Errorf("%w: key %s is no longer held by session %s", filelock.ErrLockLost, l.key, l.session)
+	}
+	return nil
+}
+
+// call sends a PUT request with the JSON encoding of in and decodes the response
+// into out. A 404 response, for an unknown or expired session, is reported as
+// an error wrapping filelock.ErrLockLost.
+func (l *Locker) call(ctx context.Context, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, l.addr+path, body)
+	if err != nil {
+		return err
+	}
+	if l.token != "" {
+		req.Header.Set("X-Consul-Token", l.token)
+	}
+
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s not found", filelock.ErrLockLost, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("consul: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// escapeKey escapes every segment of a key for use in a URL path
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,138 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/backend"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeConsul implements the session and key-value endpoints used by the Locker
+type fakeConsul struct {
+	mutex    sync.Mutex
+	sessions map[string]bool
+	owners   map[string]string
+	renewals int
+	nextID   int
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case path == "/v1/session/create":
+		c.nextID++
+		id := fmt.Sprintf("session-%d", c.nextID)
+		c.sessions[id] = true
+		_ = json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	case strings.HasPrefix(path, "/v1/session/renew/"):
+		if !c.sessions[strings.TrimPrefix(path, "/v1/session/renew/")] {
+			http.NotFound(w, r)
+			return
+		}
+		c.renewals++
+		_, _ = w.Write([]byte("[]"))
+	case strings.HasPrefix(path, "/v1/session/destroy/"):
+		delete(c.sessions, strings.TrimPrefix(path, "/v1/session/destroy/"))
+		_, _ = w.Write([]byte("true"))
+	case strings.HasPrefix(path, "/v1/kv/"):
+		key := strings.TrimPrefix(path, "/v1/kv/")
+		owner, held := c.owners[key]
+		if session := r.URL.Query().Get("acquire"); session != "" {
+			ok := c.sessions[session] && (!held || owner == session)
+			if ok {
+				c.owners[key] = session
+			}
+			_ = json.NewEncoder(w).Encode(ok)
+			return
+		}
+		session := r.URL.Query().Get("release")
+		ok := held && owner == session
+		if ok {
+			delete(c.owners, key)
+		}
+		_ = json.NewEncoder(w).Encode(ok)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ConsulTestSuite defines a test suite for the Consul backend
+type ConsulTestSuite struct {
+	suite.Suite
+	consul *fakeConsul
+	server *httptest.Server
+}
+
+// SetupTest starts a fake Consul agent before each test
+func (s *ConsulTestSuite) SetupTest() {
+	s.consul = &fakeConsul{sessions: map[string]bool{}, owners: map[string]string{}}
+	s.server = httptest.NewServer(s.consul)
+}
+
+// TearDownTest stops the fake agent after each test
+func (s *ConsulTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *ConsulTestSuite) newLock(key string, opts ...Option) *backend.FileLock {
+	return backend.New(New(s.server.URL, opts...), key)
+}
+
+// TestLockAndUnlock tests mutual exclusion through Consul
+func (s *ConsulTestSuite) TestLockAndUnlock() {
+	first, second := s.newLock("jobs/report"), s.newLock("jobs/report")
+
+	s.Require().NoError(first.Lock())
+	s.Assert().Equal(filelock.ErrLockHeld, second.Lock())
+	s.Require().NoError(first.Unlock())
+	s.Require().NoError(second.Lock())
+	s.Require().NoError(second.Unlock())
+
+	s.consul.mutex.Lock()
+	defer s.consul.mutex.Unlock()
+	s.Assert().Empty(s.consul.sessions, "sessions are destroyed")
+}
+
+// TestRenewal tests that the session of a held lock is renewed
+func (s *ConsulTestSuite) TestRenewal() {
+	lock := s.newLock("renewed", WithTTL(30*time.Millisecond))
+	s.Require().NoError(lock.Lock())
+
+	s.Assert().Eventually(func() bool {
+		s.consul.mutex.Lock()
+		defer s.consul.mutex.Unlock()
+		return s.consul.renewals >= 2
+	}, time.Second, 5*time.Millisecond)
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestLost tests that a lock whose session expired is reported lost
+func (s *ConsulTestSuite) TestLost() {
+	lock := s.newLock("lost", WithKeyPrefix("locks/"), WithTTL(30*time.Millisecond))
+	s.Require().NoError(lock.Lock())
+
+	s.consul.mutex.Lock()
+	s.consul.sessions = map[string]bool{}
+	delete(s.consul.owners, "locks/lost")
+	s.consul.mutex.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	s.Assert().ErrorIs(lock.Unlock(), filelock.ErrLockLost)
+}
+
+// TestConsul runs the test suite
+func TestConsul(t *testing.T) {
+	suite.Run(t, new(ConsulTestSuite))
+}
@@ -0,0 +1,295 @@
+// Package redis is a lock backend using Redis, with the single-instance locking
+// pattern: SET key token NX PX ttl to lock, and scripts checking the token to
+// renew and release.
+//
+// Held locks renew their key every third of its TTL, so the key of a crashed
+// holder expires after at most one TTL. The client speaks RESP directly and only
+// depends on the standard library.
+//
+// The lock is only as safe as the Redis instance: with asynchronous replication,
+// a failover may lose a held lock.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/backend"
+)
+
+// DefaultTTL is the default expiration of the lock keys
+const DefaultTTL = 30 * time.Second
+
+const (
+	renewScript  = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+	unlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+// Locker locks keys of a Redis server
+type Locker struct {
+	addr     string
+	password string
+	db       int
+	ttl      time.Duration
+	prefix   string
+
+	mutex sync.Mutex
+	conn  net.Conn
+	rd    *bufio.Reader
+}
+
+var (
+	_ backend.Locker        = (*Locker)(nil)
+	_ backend.RenewingLease = (*lease)(nil)
+)
+
+// Option configures a Locker
+type Option func(*Locker)
+
+// WithPassword authenticates with password
+func WithPassword(password string) Option {
+	return func(l *Locker) {
+		l.password = password
+	}
+}
+
+// WithDB selects the database db
+func WithDB(db int) Option {
+	return func(l *Locker) {
+		l.db = db
+	}
+}
+
+// WithTTL sets the expiration of the lock keys, DefaultTTL by default
+func WithTTL(ttl time.Duration) Option {
+	return func(l *Locker) {
+		l.ttl = ttl
+	}
+}
+
+// WithKeyPrefix prefixes the lock keys with prefix
+func WithKeyPrefix(prefix string) Option {
+	return func(l *Locker) {
+		l.prefix = prefix
+	}
+}
+
+// New creates a Locker for the Redis server at addr (host:port)
+// The connection is established on first use
+func New(addr string, opts ...Option) *Locker {
+	l := &Locker{addr: addr, ttl: DefaultTTL}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// TryLock sets the key of key if it does not exist, and renews it while held
+func (l *Locker) TryLock(ctx context.Context, key string) (backend.Lease, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	key = l.prefix + key
+	ttl := strconv.FormatInt(l.ttl.Milliseconds(), 10)
+	reply, err := l.do(ctx, "SET", key, token, "NX", "PX", ttl)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, filelock.ErrLockHeld
+	}
+
+	lease := &lease{locker: l, key: key, token: token}
+	lease.renewer = backend.StartRenewer(l.ttl/3, func(ctx context.Context) error {
+		reply, err := l.do(ctx, "EVAL", renewScript, "1", key, token, ttl)
+		if err == nil && reply == int64(0) {
+			return fmt.Errorf("%w: key %s expired", filelock.ErrLockLost, key)
+		}
+		return err
+	})
+	return lease, nil
+}
+
+// Close closes the connection to the server
+func (l *Locker) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	err := l.conn.Close()
+	l.conn = nil
+	return err
+}
+
+type lease struct {
+	locker  *Locker
+	key     string
+	token   string
+	renewer *backend.Renewer
+}
+
+// Renewer returns the renewer of the lease
+func (l *lease) Renewer() *backend.Renewer {
+	return l.renewer
+}
+
+func (l *lease) Unlock(ctx context.Context) error {
+	if err := l.renewer.Stop(); err != nil {
+		return err
+	}
+
+	reply, err := l.locker.do(ctx, "EVAL", unlockScript, "1", l.key, l.token)
+	if err != nil {
+		return err
+	}
+	if reply == int64(0) {
+		return fmt.Errorf("%w: key %s expired", filelock.ErrLockLost, l.key)
+	}
+	return nil
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// do sends a command and returns its reply: a string, an int64, a []byte, nil
+// or an []any. Connection errors close the connection, which is reopened by the
+// next command.
+func (l *Locker) do(ctx context.Context, args ...string) (any, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conn == nil {
+		if err := l.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := l.roundTrip(ctx, args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		_ = l.conn.Close()
+		l.conn = nil
+	}
+	return reply, err
+}
+
+// connect dials the server, authenticates and selects the database
+func (l *Locker) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", l.addr)
+	if err != nil {
+		return err
+	}
+	l.conn, l.rd = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if l.password != "" {
+		setup = append(setup, []string{"AUTH", l.password})
+	}
+	if l.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(l.db)})
+	}
+	for _, args := range setup {
+		if _, err := l.roundTrip(ctx, args); err != nil {
+			_ = conn.Close()
+			l.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Locker) roundTrip(ctx context.Context, args []string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(l.ttl)
+	}
+	if err := l.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if _, err := l.conn.Write(encodeCommand(args)); err != nil {
+		return nil, err
+	}
+	return readReply(l.rd)
+}
+
+// encodeCommand encodes a command as a RESP array of bulk strings
+func encodeCommand(args []string) []byte {
+	b := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		b = fmt.Appendf(b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b
+}
+
+// readReply decodes a RESP reply
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
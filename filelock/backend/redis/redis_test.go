@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/backend"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeServer implements the few Redis commands used by the Locker
+type fakeServer struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	values   map[string]string
+	expiry   map[string]time.Time
+	password string
+}
+
+func newFakeServer() (*fakeServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &fakeServer{listener: listener, values: map[string]string{}, expiry: map[string]time.Time{}}
+	go s.serve()
+	return s, nil
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := false
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]any) {
+			args = append(args, string(arg.([]byte)))
+		}
+		fmt.Fprint(conn, s.exec(args, &authed))
+	}
+}
+
+// get returns the value of key, honoring expirations, must be called with mutex held
+func (s *fakeServer) get(key string) (string, bool) {
+	if exp, ok := s.expiry[key]; ok && time.Now().After(exp) {
+		delete(s.values, key)
+		delete(s.expiry, key)
+	}
+	value, ok := s.values[key]
+	return value, ok
+}
+
+func (s *fakeServer) exec(args []string, authed *bool) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	command := strings.ToUpper(args[0])
+	if s.password != "" && !*authed && command != "AUTH" {
+		return "-NOAUTH Authentication required\r\n"
+	}
+
+	switch command {
+	case "AUTH":
+		if args[1] != s.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		*authed = true
+		return "+OK\r\n"
+	case "SET":
+		if _, ok := s.get(args[1]); ok {
+			return "$-1\r\n"
+		}
+		ms, _ := strconv.Atoi(args[5])
+		s.values[args[1]] = args[2]
+		s.expiry[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return "+OK\r\n"
+	case "EVAL":
+		key, token := args[3], args[4]
+		if value, ok := s.get(key); !ok || value != token {
+			return ":0\r\n"
+		}
+		if args[1] == renewScript {
+			ms, _ := strconv.Atoi(args[5])
+			s.expiry[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		} else {
+			delete(s.values, key)
+		}
+		return ":1\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// RedisTestSuite defines a test suite for the Redis backend
+type RedisTestSuite struct {
+	suite.Suite
+	server *fakeServer
+}
+
+// SetupTest starts a fake Redis server before each test
+func (s *RedisTestSuite) SetupTest() {
+	server, err := newFakeServer()
+	s.Require().NoError(err)
+	s.server = server
+}
+
+// TearDownTest stops the fake server after each test
+func (s *RedisTestSuite) TearDownTest() {
+	s.server.listener.Close()
+}
+
+func (s *RedisTestSuite) newLock(key string, opts ...Option) *backend.FileLock {
+	locker := New(s.server.listener.Addr().String(), opts...)
+	s.T().Cleanup(func() { locker.Close() })
+	return backend.New(locker, key)
+}
+
+// TestLockAndUnlock tests mutual exclusion through the server
+func (s *RedisTestSuite) TestLockAndUnlock() {
+	first, second := s.newLock("job"), s.newLock("job")
+
+	s.Require().NoError(first.Lock())
+	s.Assert().Equal(filelock.ErrLockHeld, second.Lock())
+	s.Require().NoError(first.Unlock())
+	s.Require().NoError(second.Lock())
+	s.Require().NoError(second.Unlock())
+}
+
+// TestRenewal tests that a held lock outlives its TTL
+func (s *RedisTestSuite) TestRenewal() {
+	lock := s.newLock("renewed", WithTTL(60*time.Millisecond))
+	s.Require().NoError(lock.Lock())
+
+	time.Sleep(200 * time.Millisecond)
+	s.Assert().Equal(filelock.ErrLockHeld, s.newLock("renewed").Lock())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestLost tests that a lock whose key was taken over is reported lost
+func (s *RedisTestSuite) TestLost() {
+	lock := s.newLock("lost", WithKeyPrefix("locks:"))
+	s.Require().NoError(lock.Lock())
+
+	s.server.mutex.Lock()
+	s.server.values["locks:lost"] = "someone else"
+	s.server.mutex.Unlock()
+
+	s.Assert().ErrorIs(lock.Unlock(), filelock.ErrLockLost)
+	s.Assert().False(lock.IsLocked())
+}
+
+// TestAuth tests that the password is sent on connection
+func (s *RedisTestSuite) TestAuth() {
+	s.server.mutex.Lock()
+	s.server.password = "secret"
+	s.server.mutex.Unlock()
+
+	s.Assert().Error(s.newLock("auth").Lock())
+	lock := s.newLock("auth", WithPassword("secret"))
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestRedis runs the test suite
+func TestRedis(t *testing.T) {
+	suite.Run(t, new(RedisTestSuite))
+}
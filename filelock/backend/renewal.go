@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// renewalBuffer is the capacity of the channel returned by FileLock.Renewals
+const renewalBuffer = 16
+
+// RenewingLease is implemented by the leases renewed in the background by a
+// Renewer, so FileLock can report their renewals
+type RenewingLease interface {
+	Lease
+
+	// Renewer returns the Renewer of the lease
+	Renewer() *Renewer
+}
+
+// RenewalEvent is the outcome of a renewal of the lease of a held lock
+type RenewalEvent struct {
+	// Key is the key of the lock
+	Key string
+
+	// Time is when the renewal completed
+	Time time.Time
+
+	// Err is the error of the renewal, nil if it succeeded
+	Err error
+
+	// Failures is the number of consecutive failed renewals, 0 if it succeeded
+	Failures int
+
+	// Lost reports that the lease is considered lost, because the backend said so
+	// or because the renewals failed for longer than the grace period
+	Lost bool
+}
+
+// RenewalAction is what a held lock does while the renewals of its lease fail
+type RenewalAction int
+
+const (
+	// ContinueOnFailure keeps working, failures are only reported. The lease is
+	// only considered lost when the backend says so.
+	ContinueOnFailure RenewalAction = iota
+
+	// PauseOnFailure makes FileLock.Proceed wait while the renewals fail, until
+	// one succeeds or the grace period is over and the lease is considered lost
+	PauseOnFailure
+
+	// AbortOnFailure keeps working until the grace period is over, then considers
+	// the lease lost, canceling FileLock.Context
+	AbortOnFailure
+)
+
+// RenewalPolicy configures the reaction of a held lock to failed renewals
+type RenewalPolicy struct {
+	// Grace is how long the renewals may fail before the lease is considered
+	// lost, with PauseOnFailure and AbortOnFailure. Zero gives up on the first
+	// failure. Keep it below the TTL of the lease: past the TTL another process
+	// may hold the lock.
+	Grace time.Duration
+
+	// OnFailure is what the lock does while the renewals fail
+	OnFailure RenewalAction
+}
+
+// leaseWatch follows the renewals of the lease of a held lock
+type leaseWatch struct {
+	key    string
+	policy RenewalPolicy
+	events chan<- RenewalEvent
+
+	// ctx is canceled when the lease is released or lost
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mutex        sync.Mutex
+	failures     int
+	failingSince time.Time
+	lost         error
+
+	// healthy is closed while the renewals succeed, and replaced by an open
+	// channel while they fail
+	healthy chan struct{}
+	failing bool
+}
+
+func newLeaseWatch(key string, policy RenewalPolicy, events chan<- RenewalEvent) *leaseWatch {
+	w := &leaseWatch{key: key, policy: policy, events: events, healthy: make(chan struct{})}
+	w.ctx, w.cancel = context.WithCancelCause(context.Background())
+	close(w.healthy)
+	return w
+}
+
+// observe records the outcome of a renewal and reports it on the events channel,
+// dropping the event if the channel is full
+func (w *leaseWatch) observe(err error) {
+	now := time.Now()
+	w.mutex.Lock()
+	if w.lost != nil {
+		w.mutex.Unlock()
+		return
+	}
+
+	switch {
+	case err == nil:
+		w.failures = 0
+		w.failingSince = time.Time{}
+		if w.failing {
+			w.failing = false
+			close(w.healthy)
+		}
+	case errors.Is(err, filelock.ErrLockLost):
+		w.failures++
+		w.lose(err)
+	default:
+		w.failures++
+		if !w.failing {
+			w.failing = true
+			w.failingSince = now
+			w.healthy = make(chan struct{})
+		}
+		failingFor := now.Sub(w.failingSince)
+		if w.policy.OnFailure != ContinueOnFailure && failingFor >= w.policy.Grace {
+			w.lose(fmt.Errorf("%w: renewals failing for %s: %w", filelock.ErrLockLost, failingFor, err))
+		}
+	}
+	event := RenewalEvent{Key: w.key, Time: now, Err: err, Failures: w.failures, Lost: w.lost != nil}
+	w.mutex.Unlock()
+
+	select {
+	case w.events <- event:
+	default:
+	}
+}
+
+// lose considers the lease lost because of err, must be called with mutex held
+func (w *leaseWatch) lose(err error) {
+	w.lost = err
+	w.cancel(err)
+	if w.failing {
+		w.failing = false
+		close(w.healthy)
+	}
+}
+
+// release ends the watch of a released lease
+func (w *leaseWatch) release() {
+	w.cancel(filelock.ErrNotLocked)
+}
+
+// proceed waits, with PauseOnFailure, while the renewals fail, and returns the
+// error that made the lease lost, if any
+func (w *leaseWatch) proceed(ctx context.Context) error {
+	w.mutex.Lock()
+	lost, healthy := w.lost, w.healthy
+	w.mutex.Unlock()
+	if lost != nil || w.policy.OnFailure != PauseOnFailure {
+		return lost
+	}
+
+	select {
+	case <-healthy:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.lost
+}
@@ -0,0 +1,68 @@
+package bench
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/abstract"
+	"github.com/rsgcata/go-fs/filelock/unix"
+	"github.com/rsgcata/go-fs/internal/lockcore"
+
+	xunix "golang.org/x/sys/unix"
+)
+
+func platformBackends() []Backend {
+	return []Backend{
+		{Name: "flock", New: func(path string) filelock.FileLock { return unix.New(path) }},
+		{
+			Name: "flock-keepopen",
+			New:  func(path string) filelock.FileLock { return unix.New(path, filelock.WithKeepOpen()) },
+			// The lock file is revalidated without allocating on these architectures
+			ZeroAlloc: runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64",
+		},
+		{Name: "fcntl", New: newFcntlLock},
+		{Name: "abstract", New: func(path string) filelock.FileLock { return abstract.New(path) }},
+	}
+}
+
+// newFcntlLock returns a reference lock using open file description locks,
+// fcntl(2) F_OFD_SETLK, for comparison with flock(2)
+func newFcntlLock(path string) filelock.FileLock {
+	return coreLock{lockcore.New(path, &fcntlDriver{}, filelock.NewOptions())}
+}
+
+// fcntlDriver locks the whole file with F_OFD_SETLK
+type fcntlDriver struct {
+	file *os.File
+}
+
+func (d *fcntlDriver) Open(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	d.file = file
+	return nil
+}
+
+func (d *fcntlDriver) TryLock() error {
+	err := d.setLock(xunix.F_WRLCK)
+	if err == xunix.EAGAIN || err == xunix.EACCES {
+		return filelock.ErrLockHeld
+	}
+	return err
+}
+
+func (d *fcntlDriver) Unlock() error {
+	return d.setLock(xunix.F_UNLCK)
+}
+
+func (d *fcntlDriver) Close() error {
+	return d.file.Close()
+}
+
+func (d *fcntlDriver) setLock(lockType int16) error {
+	lock := xunix.Flock_t{Type: lockType, Whence: 0}
+	return xunix.FcntlFlock(d.file.Fd(), xunix.F_OFD_SETLK, &lock)
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+package bench
+
+import (
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/unix"
+)
+
+func platformBackends() []Backend {
+	return []Backend{
+		{Name: "flock", New: func(path string) filelock.FileLock { return unix.New(path) }},
+	}
+}
@@ -0,0 +1,12 @@
+package bench
+
+import (
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/windows"
+)
+
+func platformBackends() []Backend {
+	return []Backend{
+		{Name: "windows", New: func(path string) filelock.FileLock { return windows.New(path) }},
+	}
+}
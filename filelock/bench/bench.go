@@ -0,0 +1,193 @@
+// Package bench measures the lock backends of this module, to pick a backend
+// with data and to catch performance regressions.
+//
+// Each scenario is a benchmark function usable from go test -bench and from
+// testing.Benchmark, as the lockbench command does:
+//   - Uncontended: latency of Lock and Unlock on a lock no one else uses
+//   - Contended: throughput of goroutines taking turns on a lock, each with its
+//     own instance, as separate processes would
+//   - WakeUp: latency between the release of a lock and its acquisition by a
+//     waiter, reported as the wake-ns/op metric
+package bench
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/lockfile"
+	"github.com/rsgcata/go-fs/internal/lockcore"
+)
+
+// waitTimeout bounds the acquisitions of the contended scenarios
+const waitTimeout = time.Minute
+
+// Backend is a lock implementation to measure
+type Backend struct {
+	// Name identifies the backend in the benchmark names
+	Name string
+
+	// New creates a lock on path
+	New func(path string) filelock.FileLock
+
+	// ZeroAlloc requires an uncontended Lock and Unlock not to allocate, which
+	// Uncontended checks
+	ZeroAlloc bool
+}
+
+// Backends returns the backends available on this platform
+func Backends() []Backend {
+	backends := platformBackends()
+	return append(backends, Backend{Name: "lockfile", New: func(path string) filelock.FileLock {
+		return lockfile.New(path)
+	}})
+}
+
+// Scenario is a measurement run against a backend
+type Scenario struct {
+	// Name identifies the scenario in the benchmark names
+	Name string
+
+	// Run measures the backend
+	Run func(b *testing.B, backend Backend)
+}
+
+// Scenarios returns the measured scenarios, at several contention levels
+func Scenarios() []Scenario {
+	return []Scenario{
+		{Name: "Uncontended", Run: Uncontended},
+		{Name: "Contended-2", Run: func(b *testing.B, backend Backend) { Contended(b, backend, 2) }},
+		{Name: "Contended-8", Run: func(b *testing.B, backend Backend) { Contended(b, backend, 8) }},
+		{Name: "WakeUp", Run: WakeUp},
+	}
+}
+
+// Run runs every scenario against every backend as sub-benchmarks of b
+func Run(b *testing.B) {
+	for _, backend := range Backends() {
+		for _, scenario := range Scenarios() {
+			b.Run(backend.Name+"/"+scenario.Name, func(b *testing.B) {
+				scenario.Run(b, backend)
+			})
+		}
+	}
+}
+
+// Uncontended measures Lock followed by Unlock on a lock no one else uses
+func Uncontended(b *testing.B, backend Backend) {
+	lock := backend.New(filepath.Join(b.TempDir(), "bench.lock"))
+	if backend.ZeroAlloc {
+		allocs := testing.AllocsPerRun(100, func() {
+			_ = lock.Lock()
+			_ = lock.Unlock()
+		})
+		if allocs > 0 {
+			b.Errorf("%s: %v allocations per Lock and Unlock, want 0", backend.Name, allocs)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if err := lock.Lock(); err != nil {
+			b.Fatal(err)
+		}
+		if err := lock.Unlock(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Contended measures the throughput of goroutines taking turns on a lock, b.N
+// critical sections in total
+func Contended(b *testing.B, backend Backend, goroutines int) {
+	path := filepath.Join(b.TempDir(), "bench.lock")
+	work := make(chan struct{}, b.N)
+	for range b.N {
+		work <- struct{}{}
+	}
+	close(work)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	b.ResetTimer()
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock := backend.New(path)
+			for range work {
+				if err := lock.LockWithTimeout(waitTimeout); err != nil {
+					errs <- err
+					return
+				}
+				if err := lock.Unlock(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	b.StopTimer()
+
+	close(errs)
+	for err := range errs {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "locks/s")
+}
+
+// WakeUp measures the latency between the release of a lock and its acquisition
+// by a waiter retrying with LockWithTimeout
+func WakeUp(b *testing.B, backend Backend) {
+	path := filepath.Join(b.TempDir(), "bench.lock")
+	holder, waiter := backend.New(path), backend.New(path)
+
+	var total time.Duration
+	for range b.N {
+		if err := holder.Lock(); err != nil {
+			b.Fatal(err)
+		}
+		acquired := make(chan time.Time)
+		go func() {
+			err := waiter.LockWithTimeout(waitTimeout)
+			if err != nil {
+				b.Error(err)
+			}
+			acquired <- time.Now()
+		}()
+
+		// Let the waiter start waiting, as it would when contending for real
+		time.Sleep(time.Millisecond)
+		released := time.Now()
+		if err := holder.Unlock(); err != nil {
+			b.Fatal(err)
+		}
+		total += (<-acquired).Sub(released)
+		if err := waiter.Unlock(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "wake-ns/op")
+}
+
+// coreLock adapts a lockcore.Lock to filelock.FileLock, for the reference
+// implementations measured only by this package
+type coreLock struct {
+	core *lockcore.Lock
+}
+
+func (l coreLock) Lock() error { return l.core.LockWithTimeout(0) }
+func (l coreLock) LockWithTimeout(timeout time.Duration) error {
+	return l.core.LockWithTimeout(timeout)
+}
+func (l coreLock) Unlock() error                           { return l.core.Unlock() }
+func (l coreLock) IsLocked() bool                          { return l.core.IsLocked() }
+func (l coreLock) Path() string                            { return l.core.Path() }
+func (l coreLock) AcquiredAt() time.Time                   { return l.core.AcquiredAt() }
+func (l coreLock) HeldDuration() time.Duration             { return l.core.HeldDuration() }
+func (l coreLock) LastAcquireStats() filelock.AcquireStats { return l.core.LastAcquireStats() }
+func (l coreLock) Status() filelock.Status                 { return l.core.Status() }
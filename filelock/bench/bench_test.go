@@ -0,0 +1,10 @@
+package bench
+
+import (
+	"testing"
+)
+
+// BenchmarkBackends runs every scenario against every backend
+func BenchmarkBackends(b *testing.B) {
+	Run(b)
+}
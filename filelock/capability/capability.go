@@ -0,0 +1,320 @@
+// Package capability verifies which locking mechanisms provide mutual exclusion
+// on a given file system, for applications deployed on file systems they do not
+// know: NFS mounts without lockd, FUSE or container overlay file systems may
+// accept locks without excluding other processes.
+//
+// Probe takes a lock with every mechanism available on the platform in a
+// directory, and asks a helper child process whether it can take it too. The
+// helper is the running executable started again, so the main function of the
+// program must call Serve first:
+//
+//	func main() {
+//		capability.Serve()
+//		...
+//	}
+package capability
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/lockfile"
+)
+
+// Mechanism is a locking mechanism
+type Mechanism string
+
+const (
+	// Flock is flock(2), the default of the Unix backend
+	Flock Mechanism = "flock"
+
+	// Fcntl is fcntl(2) POSIX record locks, the only locks of NFSv3 and of many
+	// network file systems
+	Fcntl Mechanism = "fcntl"
+
+	// LockFileEx is LockFileEx, the Windows backend
+	LockFileEx Mechanism = "LockFileEx"
+
+	// LockFile is the lock-file protocol of the lockfile package, exclusive
+	// creation of the lock file
+	LockFile Mechanism = "lockfile"
+)
+
+// ErrNoHelper is returned by Probe when the helper process does not answer,
+// typically because the program does not call Serve first in main
+var ErrNoHelper = errors.New("capability probe helper did not start, call capability.Serve first in main")
+
+// helperTimeout is how long Probe waits for the helper process to start
+const helperTimeout = 10 * time.Second
+
+// envHelper marks the helper process started by Probe
+const envHelper = "GOFS_CAPABILITY_HELPER"
+
+// helperReady is the first line written by the helper process
+const helperReady = "gofs-capability-ready"
+
+// Result is the outcome of probing a mechanism
+type Result struct {
+	// Mechanism is the probed mechanism
+	Mechanism Mechanism `json:"mechanism"`
+
+	// Excludes reports whether the lock held by Probe kept the helper process from
+	// taking it, and the helper took it once released: the mechanism provides
+	// mutual exclusion between processes on the file system
+	Excludes bool `json:"excludes"`
+
+	// Error tells why the mechanism does not provide mutual exclusion, if it does not
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the outcome of Probe
+type Report struct {
+	// Dir is the probed directory
+	Dir string `json:"dir"`
+
+	// Results holds the result of every mechanism available on the platform
+	Results []Result `json:"results"`
+}
+
+// Excludes reports whether m provides mutual exclusion in the probed directory
+func (r Report) Excludes(m Mechanism) bool {
+	for _, result := range r.Results {
+		if result.Mechanism == m {
+			return result.Excludes
+		}
+	}
+	return false
+}
+
+// locker is a lock taken by one of the mechanisms
+type locker interface {
+	Lock() error
+	Unlock() error
+}
+
+// newLocker returns a locker of m for path, or nil if m is not available
+func newLocker(m Mechanism, path string) locker {
+	if m == LockFile {
+		return lockfile.New(path)
+	}
+	return newPlatformLocker(m, path)
+}
+
+// request is a request sent to the helper process
+type request struct {
+	Mechanism Mechanism `json:"mechanism"`
+	Path      string    `json:"path"`
+}
+
+// response is the answer of the helper process to a request
+type response struct {
+	Held  bool   `json:"held"`
+	Error string `json:"error,omitempty"`
+}
+
+// Serve makes the process serve the requests of Probe and exit if it is the
+// helper process started by Probe, and returns immediately otherwise. It must be
+// called first in main, before the program does anything else.
+func Serve() {
+	if os.Getenv(envHelper) == "" {
+		return
+	}
+	serve(os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+// serve answers the requests read from r, trying to take each lock once
+func serve(r io.Reader, w io.Writer) {
+	fmt.Fprintln(w, helperReady)
+	scanner := bufio.NewScanner(r)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		var req request
+		var resp response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp = try(req)
+		}
+		if enc.Encode(resp) != nil {
+			return
+		}
+	}
+}
+
+// try tries to take the lock of req without waiting, and releases it if taken
+func try(req request) response {
+	l := newLocker(req.Mechanism, req.Path)
+	if l == nil {
+		return response{Error: fmt.Sprintf("mechanism %s is not available", req.Mechanism)}
+	}
+	err := l.Lock()
+	if errors.Is(err, filelock.ErrLockHeld) {
+		return response{Held: true}
+	}
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	if err := l.Unlock(); err != nil {
+		return response{Error: err.Error()}
+	}
+	return response{}
+}
+
+// helper is the helper process of a Probe
+type helper struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	output *bufio.Scanner
+}
+
+// Probe tests which mechanisms available on the platform provide mutual exclusion
+// between processes in the directory dir, with a helper process started from the
+// running executable, which must call Serve first in main. The probe lock files are
+// created in dir and removed afterwards. ctx bounds the whole probe.
+func Probe(ctx context.Context, dir string) (Report, error) {
+	report := Report{Dir: dir}
+	h, err := startHelper(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer h.stop()
+
+	for _, m := range platformMechanisms {
+		path := filepath.Join(dir, ".gofs-probe-"+string(m)+"-"+strconv.Itoa(os.Getpid()))
+		result, err := h.probe(m, path)
+		_ = os.Remove(path)
+		if err != nil {
+			return report, err
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, ctx.Err()
+}
+
+// startHelper starts the helper process and waits for it to be ready
+func startHelper(ctx context.Context) (*helper, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, executable)
+	cmd.Env = append(os.Environ(), envHelper+"=1")
+	cmd.Stderr = io.Discard
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	h := &helper{cmd: cmd, stdin: stdin, output: bufio.NewScanner(stdout)}
+	ready := make(chan bool, 1)
+	go func() {
+		ready <- h.output.Scan() && h.output.Text() == helperReady
+	}()
+	timer := time.NewTimer(helperTimeout)
+	defer timer.Stop()
+	select {
+	case ok := <-ready:
+		if ok {
+			return h, nil
+		}
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	h.stop()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, ErrNoHelper
+}
+
+// probe tests m on the lock file at path
+func (h *helper) probe(m Mechanism, path string) (Result, error) {
+	result := Result{Mechanism: m}
+	l := newLocker(m, path)
+	if err := l.Lock(); err != nil {
+		result.Error = "lock: " + err.Error()
+		return result, nil
+	}
+
+	held, err := h.call(request{Mechanism: m, Path: path})
+	unlockErr := l.Unlock()
+	switch {
+	case err != nil:
+		result.Error = "helper: " + err.Error()
+		return result, nil
+	case !held:
+		result.Error = "the helper process took the held lock"
+		return result, nil
+	case unlockErr != nil:
+		result.Error = "unlock: " + unlockErr.Error()
+		return result, nil
+	}
+
+	held, err = h.call(request{Mechanism: m, Path: path})
+	switch {
+	case err != nil:
+		result.Error = "helper: " + err.Error()
+	case held:
+		result.Error = "the lock stayed held after its release"
+	default:
+		result.Excludes = true
+	}
+	return result, nil
+}
+
+// call sends req to the helper and reports whether it found the lock held. The
+// errors of the helper are returned as errors.
+func (h *helper) call(req request) (bool, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return false, err
+	}
+	if _, err := h.stdin.Write(append(data, '\n')); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrNoHelper, err)
+	}
+	if !h.output.Scan() {
+		return false, fmt.Errorf("%w: helper exited", ErrNoHelper)
+	}
+	var resp response
+	if err := json.Unmarshal(h.output.Bytes(), &resp); err != nil {
+		return false, err
+	}
+	if resp.Error != "" {
+		return false, errors.New(resp.Error)
+	}
+	return resp.Held, nil
+}
+
+// stop ends the helper process
+func (h *helper) stop() {
+	_ = h.stdin.Close()
+	done := make(chan struct{})
+	go func() {
+		_ = h.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		_ = h.cmd.Process.Kill()
+		<-done
+	}
+}
@@ -0,0 +1,88 @@
+package capability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// TestMain serves the requests of Probe in the helper process started by the tests
+func TestMain(m *testing.M) {
+	Serve()
+	os.Exit(m.Run())
+}
+
+// CapabilityTestSuite defines a test suite for the capability probe
+type CapabilityTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *CapabilityTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "capability-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *CapabilityTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestProbe tests that every mechanism excludes the helper process on the local
+// file system, and that the probe files are removed
+func (s *CapabilityTestSuite) TestProbe() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	report, err := Probe(ctx, s.tempDir)
+	s.Require().NoError(err)
+	s.Assert().Equal(s.tempDir, report.Dir)
+	s.Require().Equal(len(platformMechanisms), len(report.Results))
+	for _, result := range report.Results {
+		s.Assert().True(result.Excludes, "%s: %s", result.Mechanism, result.Error)
+		s.Assert().True(report.Excludes(result.Mechanism))
+	}
+	s.Assert().False(report.Excludes("nfs-magic"))
+
+	entries, err := os.ReadDir(s.tempDir)
+	s.Require().NoError(err)
+	s.Assert().Empty(entries)
+}
+
+// TestServe tests the answers of the helper to a free lock, a held lock and an
+// unknown mechanism
+func (s *CapabilityTestSuite) TestServe() {
+	path := filepath.Join(s.tempDir, "serve.lock")
+	held := newLocker(LockFile, filepath.Join(s.tempDir, "held.lock"))
+	s.Require().NoError(held.Lock())
+	defer held.Unlock()
+
+	var requests bytes.Buffer
+	enc := json.NewEncoder(&requests)
+	s.Require().NoError(enc.Encode(request{Mechanism: LockFile, Path: path}))
+	s.Require().NoError(enc.Encode(request{Mechanism: LockFile, Path: filepath.Join(s.tempDir, "held.lock")}))
+	s.Require().NoError(enc.Encode(request{Mechanism: "nope", Path: path}))
+
+	var output bytes.Buffer
+	serve(&requests, &output)
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	s.Require().Len(lines, 4)
+	s.Assert().Equal(helperReady, lines[0])
+	s.Assert().JSONEq(`{"held":false}`, lines[1])
+	s.Assert().JSONEq(`{"held":true}`, lines[2])
+	s.Assert().Contains(lines[3], "not available")
+}
+
+// TestCapability runs the test suite
+func TestCapability(t *testing.T) {
+	suite.Run(t, new(CapabilityTestSuite))
+}
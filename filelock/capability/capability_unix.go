@@ -0,0 +1,70 @@
+//go:build unix
+
+package capability
+
+import (
+	"os"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/unix"
+
+	xunix "golang.org/x/sys/unix"
+)
+
+// platformMechanisms are the mechanisms probed on this platform
+var platformMechanisms = []Mechanism{Flock, Fcntl, LockFile}
+
+// newPlatformLocker returns a locker of m for path, or nil if m is not available
+func newPlatformLocker(m Mechanism, path string) locker {
+	switch m {
+	case Flock:
+		return unix.New(path)
+	case Fcntl:
+		return &fcntlLocker{path: path}
+	default:
+		return nil
+	}
+}
+
+// fcntlLocker takes fcntl(2) POSIX record locks on the whole file, which belong
+// to the process
+type fcntlLocker struct {
+	path string
+	file *os.File
+}
+
+func (l *fcntlLocker) Lock() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	if err := setLock(file, xunix.F_WRLCK); err != nil {
+		_ = file.Close()
+		if err == xunix.EAGAIN || err == xunix.EACCES {
+			return filelock.ErrLockHeld
+		}
+		return err
+	}
+	l.file = file
+	return nil
+}
+
+func (l *fcntlLocker) Unlock() error {
+	err := setLock(l.file, xunix.F_UNLCK)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// setLock sets a lock of type typ on the whole file without waiting
+func setLock(file *os.File, typ int16) error {
+	lock := xunix.Flock_t{Type: typ}
+	for {
+		err := xunix.FcntlFlock(file.Fd(), xunix.F_SETLK, &lock)
+		if err != xunix.EINTR {
+			return err
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package capability
+
+import "github.com/rsgcata/go-fs/filelock/windows"
+
+// platformMechanisms are the mechanisms probed on this platform
+var platformMechanisms = []Mechanism{LockFileEx, LockFile}
+
+// newPlatformLocker returns a locker of m for path, or nil if m is not available
+func newPlatformLocker(m Mechanism, path string) locker {
+	if m == LockFileEx {
+		return windows.New(path)
+	}
+	return nil
+}
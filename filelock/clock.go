@@ -0,0 +1,45 @@
+package filelock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock abstracts the passage of time for the timeout and backoff logic,
+// so it can be replaced by a fake in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// Sleep pauses for d, or until ctx is done in which case it returns ctx.Err().
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// DefaultClock is the Clock used by locks created without WithClock.
+// It is read when a lock is created.
+var DefaultClock Clock = systemClock{}
+
+// systemClock is the Clock backed by the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	// The lock backoff sleeps without cancellation, no timer is needed
+	if ctx.Done() == nil {
+		time.Sleep(d)
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,288 @@
+// Package conformance provides a test suite checking that a FileLock
+// implementation has the semantics shared by all the backends of this module, so
+// code written against filelock.FileLock behaves the same on any of them.
+//
+// Backends call Run from a test with their constructor:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(path string, opts ...filelock.Option) filelock.FileLock {
+//			return mybackend.New(path, opts...)
+//		}, conformance.Config{Shared: true})
+//	}
+package conformance
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// Factory creates a lock on path with opts, like the New function of a backend
+type Factory func(path string, opts ...filelock.Option) filelock.FileLock
+
+// Config describes the capabilities of the backend under test
+type Config struct {
+	// Shared reports whether the backend honors filelock.WithShared. Backends
+	// always locking exclusively skip the shared lock checks.
+	Shared bool
+
+	// SingleLock reports whether the Factory ignores its path and options and
+	// returns instances of the same lock, for example when adapting a constructor
+	// without parameters. The checks relying on options are then skipped.
+	SingleLock bool
+}
+
+// suite runs the checks against a backend
+type suite struct {
+	factory Factory
+	config  Config
+}
+
+// Run runs the conformance checks as subtests of t, each on a new lock path in
+// a temporary directory
+func Run(t *testing.T, factory Factory, config Config) {
+	s := suite{factory: factory, config: config}
+	checks := []struct {
+		name string
+		fn   func(t *testing.T, path string)
+	}{
+		{"LockAndUnlock", s.lockAndUnlock},
+		{"AlreadyLocked", s.alreadyLocked},
+		{"Reentrancy", s.reentrancy},
+		{"NotLocked", s.notLocked},
+		{"IdempotentUnlock", s.idempotentUnlock},
+		{"Contention", s.contention},
+		{"Timeout", s.timeout},
+		{"AcquiredOnRelease", s.acquiredOnRelease},
+		{"Status", s.status},
+		{"MutualExclusion", s.mutualExclusion},
+		{"Shared", s.shared},
+	}
+	for _, check := range checks {
+		t.Run(check.name, func(t *testing.T) {
+			check.fn(t, filepath.Join(t.TempDir(), "conformance.lock"))
+		})
+	}
+}
+
+// noError fails the test now if err is not nil
+func noError(t *testing.T, err error, op string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", op, err)
+	}
+}
+
+// isError fails the test if err is not target
+func isError(t *testing.T, err, target error, op string) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("%s: got error %v, want %v", op, err, target)
+	}
+}
+
+func (s suite) lockAndUnlock(t *testing.T, path string) {
+	lock := s.factory(path)
+	if lock.IsLocked() {
+		t.Error("new lock reports being held")
+	}
+	if !s.config.SingleLock && lock.Path() != path {
+		t.Errorf("Path() = %q, want %q", lock.Path(), path)
+	}
+
+	for range 2 {
+		noError(t, lock.Lock(), "Lock")
+		if !lock.IsLocked() {
+			t.Error("IsLocked() = false after Lock")
+		}
+		noError(t, lock.Unlock(), "Unlock")
+		if lock.IsLocked() {
+			t.Error("IsLocked() = true after Unlock")
+		}
+	}
+}
+
+func (s suite) alreadyLocked(t *testing.T, path string) {
+	lock := s.factory(path)
+	noError(t, lock.Lock(), "Lock")
+	defer lock.Unlock()
+
+	isError(t, lock.Lock(), filelock.ErrAlreadyLocked, "second Lock")
+	isError(t, lock.LockWithTimeout(50*time.Millisecond), filelock.ErrAlreadyLocked, "second LockWithTimeout")
+	if !lock.IsLocked() {
+		t.Error("a failed second Lock released the lock")
+	}
+}
+
+func (s suite) notLocked(t *testing.T, path string) {
+	lock := s.factory(path)
+	isError(t, lock.Unlock(), filelock.ErrNotLocked, "Unlock without Lock")
+
+	noError(t, lock.Lock(), "Lock")
+	noError(t, lock.Unlock(), "Unlock")
+	isError(t, lock.Unlock(), filelock.ErrNotLocked, "second Unlock")
+}
+
+// reentrancy checks that locks belong to the instance rather than to a goroutine,
+// and that an instance is not reentrant
+func (s suite) reentrancy(t *testing.T, path string) {
+	lock := s.factory(path)
+	locked := make(chan error)
+	go func() { locked <- lock.Lock() }()
+	noError(t, <-locked, "Lock from another goroutine")
+
+	isError(t, lock.Lock(), filelock.ErrAlreadyLocked, "Lock of the instance held by another goroutine")
+	noError(t, lock.Unlock(), "Unlock of the lock taken by another goroutine")
+}
+
+func (s suite) idempotentUnlock(t *testing.T, path string) {
+	if s.config.SingleLock {
+		t.Skip("the factory does not take options")
+	}
+	lock := s.factory(path, filelock.WithIdempotentUnlock())
+	noError(t, lock.Unlock(), "Unlock without Lock")
+	noError(t, lock.Lock(), "Lock")
+	noError(t, lock.Unlock(), "Unlock")
+	noError(t, lock.Unlock(), "second Unlock")
+}
+
+func (s suite) contention(t *testing.T, path string) {
+	first, second := s.factory(path), s.factory(path)
+	noError(t, first.Lock(), "first Lock")
+
+	start := time.Now()
+	isError(t, second.Lock(), filelock.ErrLockHeld, "Lock of a held lock")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Lock of a held lock blocked for %s", elapsed)
+	}
+	if second.IsLocked() {
+		t.Error("a failed Lock reports being held")
+	}
+
+	noError(t, first.Unlock(), "first Unlock")
+	noError(t, second.Lock(), "Lock of a released lock")
+	noError(t, second.Unlock(), "second Unlock")
+}
+
+func (s suite) timeout(t *testing.T, path string) {
+	first, second := s.factory(path), s.factory(path)
+	noError(t, first.Lock(), "first Lock")
+	defer first.Unlock()
+
+	start := time.Now()
+	isError(t, second.LockWithTimeout(100*time.Millisecond), filelock.ErrTimeout, "LockWithTimeout of a held lock")
+	elapsed := time.Since(start)
+	if elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("LockWithTimeout(100ms) returned after %s", elapsed)
+	}
+	isError(t, second.LockWithTimeout(0), filelock.ErrLockHeld, "LockWithTimeout(0) of a held lock")
+}
+
+func (s suite) acquiredOnRelease(t *testing.T, path string) {
+	first, second := s.factory(path), s.factory(path)
+	noError(t, first.Lock(), "first Lock")
+	time.AfterFunc(50*time.Millisecond, func() { _ = first.Unlock() })
+
+	noError(t, second.LockWithTimeout(5*time.Second), "LockWithTimeout of a lock released meanwhile")
+	noError(t, second.Unlock(), "second Unlock")
+}
+
+func (s suite) status(t *testing.T, path string) {
+	lock := s.factory(path)
+	if !lock.AcquiredAt().IsZero() || lock.HeldDuration() != 0 {
+		t.Error("a lock not held reports an acquisition time or a held duration")
+	}
+	if state := lock.Status().State; state != filelock.Unlocked {
+		t.Errorf("Status().State = %s before Lock, want %s", state, filelock.Unlocked)
+	}
+
+	before := time.Now()
+	noError(t, lock.Lock(), "Lock")
+	if acquiredAt := lock.AcquiredAt(); acquiredAt.Before(before.Add(-time.Second)) || acquiredAt.After(time.Now()) {
+		t.Errorf("AcquiredAt() = %s, want around %s", acquiredAt, before)
+	}
+	status := lock.Status()
+	if status.State != filelock.Locked || status.Path != lock.Path() {
+		t.Errorf("Status() = %+v after Lock, want a locked status", status)
+	}
+	if status.Holder == nil || *status.Holder != filelock.CurrentHolder() {
+		t.Errorf("Status().Holder = %v after Lock, want %v", status.Holder, filelock.CurrentHolder())
+	}
+	if stats := lock.LastAcquireStats(); stats.Attempts < 1 {
+		t.Errorf("LastAcquireStats().Attempts = %d, want at least 1", stats.Attempts)
+	}
+
+	noError(t, lock.Unlock(), "Unlock")
+	if !lock.AcquiredAt().IsZero() || lock.Status().State != filelock.Unlocked {
+		t.Error("a released lock reports an acquisition time or a locked status")
+	}
+}
+
+func (s suite) mutualExclusion(t *testing.T, path string) {
+	const goroutines, iterations = 8, 20
+	var inside, violations atomic.Int32
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock := s.factory(path)
+			for range iterations {
+				if err := lock.LockWithTimeout(10 * time.Second); err != nil {
+					errs <- err
+					return
+				}
+				if inside.Add(1) != 1 {
+					violations.Add(1)
+				}
+				time.Sleep(time.Millisecond)
+				inside.Add(-1)
+				if err := lock.Unlock(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := violations.Load(); n > 0 {
+		t.Errorf("mutual exclusion violated %d times", n)
+	}
+}
+
+func (s suite) shared(t *testing.T, path string) {
+	if !s.config.Shared || s.config.SingleLock {
+		t.Skip("the backend does not support shared locks")
+	}
+
+	first := s.factory(path, filelock.WithShared())
+	second := s.factory(path, filelock.WithShared())
+	exclusive := s.factory(path)
+
+	noError(t, first.Lock(), "first shared Lock")
+	noError(t, second.Lock(), "second shared Lock")
+	if !first.Status().Shared {
+		t.Error("Status().Shared = false for a shared lock")
+	}
+	isError(t, exclusive.Lock(), filelock.ErrLockHeld, "exclusive Lock of a shared lock")
+
+	noError(t, first.Unlock(), "first shared Unlock")
+	isError(t, exclusive.Lock(), filelock.ErrLockHeld, "exclusive Lock with a shared holder left")
+	noError(t, second.Unlock(), "second shared Unlock")
+
+	noError(t, exclusive.Lock(), "exclusive Lock")
+	isError(t, first.Lock(), filelock.ErrLockHeld, "shared Lock of an exclusive lock")
+	noError(t, exclusive.Unlock(), "exclusive Unlock")
+}
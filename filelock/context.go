@@ -0,0 +1,206 @@
+package filelock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ContextLock is a lock whose operations take a context, so cancellation and
+// deadlines propagate uniformly, including to the calls lease-backed backends make
+// to their lock service. FileLock remains the primary interface: AsContextLock and
+// AsFileLock convert between the two.
+type ContextLock interface {
+	// Lock acquires the lock, retrying while it is held by someone else until ctx
+	// is done, in which case it returns the error of ctx.
+	Lock(ctx context.Context) error
+
+	// TryLock makes a single attempt to acquire the lock.
+	// Returns ErrLockHeld if the lock is held by someone else.
+	TryLock(ctx context.Context) error
+
+	// Unlock releases the lock.
+	// Returns ErrNotLocked if the lock is not held, unless the lock was created
+	// with WithIdempotentUnlock. If ctx is done before a file system release
+	// completes, the lock is abandoned, see ErrAbandoned.
+	Unlock(ctx context.Context) error
+
+	// Probe reports whether acquiring the lock would fail now because it is held,
+	// by this instance or by someone else, without keeping it.
+	// It does not wait for an acquisition polling on the same instance, which
+	// means the lock is held by someone else, and reports it as held.
+	Probe(ctx context.Context) (bool, error)
+
+	// IsLocked returns true if the lock is currently held by this instance.
+	IsLocked() bool
+
+	// Path returns the path to the locked file.
+	Path() string
+
+	// Status returns a snapshot of the lock state, holder and acquisition statistics.
+	Status() Status
+}
+
+// ContextLocker is implemented by the FileLocks of this module, which provide a
+// native ContextLock operating on the same lock.
+type ContextLocker interface {
+	ContextLock() ContextLock
+}
+
+// AsContextLock returns a ContextLock operating on l. It is the native
+// implementation for locks implementing ContextLocker. For other locks, Lock
+// retries l.Lock with exponential backoff until ctx is done, the context is not
+// passed to their operations, and Probe acquires and releases l when it is free.
+func AsContextLock(l FileLock) ContextLock {
+	if locker, ok := l.(ContextLocker); ok {
+		return locker.ContextLock()
+	}
+	return fileContextLock{l}
+}
+
+// AsFileLock returns a FileLock operating on l, for code written against FileLock.
+// LockWithTimeout maps the deadline of its context to ErrTimeout, and the other
+// operations use context.Background().
+func AsFileLock(l ContextLock) FileLock {
+	if c, ok := l.(fileContextLock); ok {
+		return c.l
+	}
+	return contextFileLock{l}
+}
+
+// LockFunc acquires l, retrying until ctx is done like ContextLock.Lock, and returns
+// the function releasing it, for callers writing
+//
+//	release, err := filelock.LockFunc(ctx, l)
+//	if err != nil {
+//		return err
+//	}
+//	defer release()
+//
+// release can be called more than once, only the first call releases the lock. It
+// uses a context carrying the values of ctx but never canceled, so the lock is
+// released even after ctx is done. On error, release is a no-op.
+func LockFunc(ctx context.Context, l FileLock) (release func() error, err error) {
+	lock := AsContextLock(l)
+	if err := lock.Lock(ctx); err != nil {
+		return func() error { return nil }, err
+	}
+
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() {
+			err = lock.Unlock(context.WithoutCancel(ctx))
+		})
+		return err
+	}, nil
+}
+
+// fileContextLock adapts a FileLock without native ContextLock to ContextLock
+type fileContextLock struct {
+	l FileLock
+}
+
+func (c fileContextLock) Lock(ctx context.Context) error {
+	retryInterval := time.Millisecond * 10
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := c.l.Lock()
+		if !errors.Is(err, ErrLockHeld) {
+			return err
+		}
+		if err := DefaultClock.Sleep(ctx, retryInterval); err != nil {
+			return err
+		}
+		if retryInterval < time.Millisecond*100 {
+			retryInterval = time.Duration(float64(retryInterval) * 1.5)
+		}
+	}
+}
+
+func (c fileContextLock) TryLock(context.Context) error {
+	return c.l.Lock()
+}
+
+func (c fileContextLock) Unlock(context.Context) error {
+	return c.l.Unlock()
+}
+
+func (c fileContextLock) Probe(context.Context) (bool, error) {
+	if c.l.IsLocked() {
+		return true, nil
+	}
+	err := c.l.Lock()
+	if errors.Is(err, ErrLockHeld) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return false, c.l.Unlock()
+}
+
+func (c fileContextLock) IsLocked() bool {
+	return c.l.IsLocked()
+}
+
+func (c fileContextLock) Path() string {
+	return c.l.Path()
+}
+
+func (c fileContextLock) Status() Status {
+	return c.l.Status()
+}
+
+// contextFileLock adapts a ContextLock to FileLock
+type contextFileLock struct {
+	l ContextLock
+}
+
+func (f contextFileLock) Lock() error {
+	return f.l.TryLock(context.Background())
+}
+
+func (f contextFileLock) LockWithTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return f.Lock()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := f.l.Lock(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return err
+}
+
+func (f contextFileLock) Unlock() error {
+	return f.l.Unlock(context.Background())
+}
+
+func (f contextFileLock) IsLocked() bool {
+	return f.l.IsLocked()
+}
+
+func (f contextFileLock) Path() string {
+	return f.l.Path()
+}
+
+func (f contextFileLock) AcquiredAt() time.Time {
+	return f.l.Status().AcquiredAt
+}
+
+func (f contextFileLock) HeldDuration() time.Duration {
+	return f.l.Status().HeldFor
+}
+
+func (f contextFileLock) LastAcquireStats() AcquireStats {
+	return f.l.Status().LastAcquire
+}
+
+func (f contextFileLock) Status() Status {
+	return f.l.Status()
+}
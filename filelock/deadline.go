@@ -0,0 +1,123 @@
+package filelock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DeadlineContext is a context whose deadline can be moved while operations wait
+// on it. An acquisition given it, with ContextLock.Lock or Acquire, keeps waiting
+// when the deadline is extended, for example when the user of a CLI chooses to
+// keep waiting, instead of being canceled and restarted, which would lose its
+// place among the goroutines waiting for the same lock instance.
+//
+// It is done when the deadline passes, with the error context.DeadlineExceeded,
+// when its cancel function is called, or when its parent is done. Moving the
+// deadline of a done context has no effect.
+type DeadlineContext struct {
+	parent context.Context
+	done   chan struct{}
+	stop   func() bool
+
+	mutex    sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+	err      error
+}
+
+// WithAdjustableDeadline returns a DeadlineContext derived from parent, done at
+// deadline unless it is moved, and the function canceling it, which should be
+// called once the operations using it are over.
+func WithAdjustableDeadline(parent context.Context, deadline time.Time) (*DeadlineContext, context.CancelFunc) {
+	c := &DeadlineContext{parent: parent, done: make(chan struct{}), deadline: deadline}
+	// The callbacks wait for the mutex, so they see the timer and stop
+	c.mutex.Lock()
+	c.timer = time.AfterFunc(time.Until(deadline), c.expire)
+	c.stop = context.AfterFunc(parent, func() { c.finish(parent.Err()) })
+	c.mutex.Unlock()
+	return c, func() { c.finish(context.Canceled) }
+}
+
+// SetDeadline moves the deadline to deadline, earlier or later. It reports
+// whether the context was not done yet.
+func (c *DeadlineContext) SetDeadline(deadline time.Time) bool {
+	return c.move(func(time.Time) time.Time { return deadline })
+}
+
+// Extend moves the deadline by d, later if d is positive and earlier otherwise.
+// Concurrent extensions add up. It reports whether the context was not done yet.
+func (c *DeadlineContext) Extend(d time.Duration) bool {
+	return c.move(func(deadline time.Time) time.Time { return deadline.Add(d) })
+}
+
+// move replaces the deadline with the one next returns for it, unless the
+// context is done, and reports whether it did.
+func (c *DeadlineContext) move(next func(time.Time) time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return false
+	}
+	c.deadline = next(c.deadline)
+	c.timer.Reset(time.Until(c.deadline))
+	return true
+}
+
+// Deadline returns the current deadline, or the deadline of the parent if it is
+// earlier.
+func (c *DeadlineContext) Deadline() (time.Time, bool) {
+	c.mutex.Lock()
+	deadline := c.deadline
+	c.mutex.Unlock()
+	if parent, ok := c.parent.Deadline(); ok && parent.Before(deadline) {
+		return parent, true
+	}
+	return deadline, true
+}
+
+// Done returns a channel closed when the context is done.
+func (c *DeadlineContext) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns nil until the context is done, and then why it is done.
+func (c *DeadlineContext) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// Value returns the value of the parent for key.
+func (c *DeadlineContext) Value(key any) any {
+	return c.parent.Value(key)
+}
+
+// expire ends the context if the deadline passed, the timer having possibly
+// fired before the deadline was moved.
+func (c *DeadlineContext) expire() {
+	c.mutex.Lock()
+	if remaining := time.Until(c.deadline); remaining > 0 && c.err == nil {
+		c.timer.Reset(remaining)
+		c.mutex.Unlock()
+		return
+	}
+	c.mutex.Unlock()
+	c.finish(context.DeadlineExceeded)
+}
+
+// finish ends the context with err, unless it is already done.
+func (c *DeadlineContext) finish(err error) {
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return
+	}
+	c.err = err
+	c.timer.Stop()
+	close(c.done)
+	stop := c.stop
+	c.mutex.Unlock()
+
+	stop()
+}
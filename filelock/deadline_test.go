@@ -0,0 +1,106 @@
+package filelock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// DeadlineTestSuite defines a test suite for DeadlineContext
+// The acquisitions waiting on a DeadlineContext are tested by TestAdjustableDeadline
+// of the unix backend.
+type DeadlineTestSuite struct {
+	suite.Suite
+}
+
+// done reports whether ctx is done within wait
+func done(ctx context.Context, wait time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-time.After(wait):
+		return false
+	}
+}
+
+// TestExtend tests that a waiter keeps waiting when the deadline is extended
+func (s *DeadlineTestSuite) TestExtend() {
+	ctx, cancel := WithAdjustableDeadline(context.Background(), time.Now().Add(50*time.Millisecond))
+	defer cancel()
+	waited := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		waited <- ctx.Err()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	s.Require().True(ctx.Extend(time.Second))
+	deadline, ok := ctx.Deadline()
+	s.Assert().True(ok)
+	s.Assert().WithinDuration(time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+	s.Assert().False(done(ctx, 100*time.Millisecond), "the former deadline passed")
+	s.Assert().NoError(ctx.Err())
+
+	cancel()
+	s.Assert().ErrorIs(<-waited, context.Canceled)
+	s.Assert().False(ctx.Extend(time.Minute), "a done context stays done")
+}
+
+// TestSetDeadline tests that an earlier deadline ends the context with
+// context.DeadlineExceeded
+func (s *DeadlineTestSuite) TestSetDeadline() {
+	ctx, cancel := WithAdjustableDeadline(context.Background(), time.Now().Add(time.Minute))
+	defer cancel()
+
+	s.Require().True(ctx.SetDeadline(time.Now().Add(20 * time.Millisecond)))
+	s.Require().True(done(ctx, time.Second))
+	s.Assert().ErrorIs(ctx.Err(), context.DeadlineExceeded)
+	s.Assert().False(ctx.SetDeadline(time.Now().Add(time.Minute)), "a done context stays done")
+	s.Assert().ErrorIs(ctx.Err(), context.DeadlineExceeded)
+}
+
+// TestConcurrentExtend tests that concurrent extensions add up
+func (s *DeadlineTestSuite) TestConcurrentExtend() {
+	start := time.Now().Add(time.Minute)
+	ctx, cancel := WithAdjustableDeadline(context.Background(), start)
+	defer cancel()
+
+	const extensions = 1000
+	var wg sync.WaitGroup
+	ready := make(chan struct{})
+	for range extensions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ready
+			ctx.Extend(time.Second)
+		}()
+	}
+	close(ready)
+	wg.Wait()
+	deadline, _ := ctx.Deadline()
+	s.Assert().True(start.Add(extensions*time.Second).Equal(deadline), "deadline %s", deadline)
+}
+
+// TestParent tests that the context ends with its parent, whose earlier deadline
+// it reports
+func (s *DeadlineTestSuite) TestParent() {
+	parentDeadline := time.Now().Add(time.Hour)
+	parent, cancelParent := context.WithDeadline(context.Background(), parentDeadline)
+	ctx, cancel := WithAdjustableDeadline(parent, time.Now().Add(2*time.Hour))
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	s.Assert().Equal(parentDeadline, deadline)
+	cancelParent()
+	s.Require().True(done(ctx, time.Second))
+	s.Assert().ErrorIs(ctx.Err(), context.Canceled)
+}
+
+// TestDeadline runs the test suite
+func TestDeadline(t *testing.T) {
+	suite.Run(t, new(DeadlineTestSuite))
+}
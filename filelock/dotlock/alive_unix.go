@@ -0,0 +1,12 @@
+//go:build unix
+
+package dotlock
+
+import "syscall"
+
+// processAlive reports whether a process with pid runs on this host. A process
+// of another user, which cannot be signaled, is alive.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
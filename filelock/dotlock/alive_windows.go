@@ -0,0 +1,19 @@
+package dotlock
+
+import "golang.org/x/sys/windows"
+
+// processAlive reports whether a process with pid runs on this host. A process
+// the current user cannot open is alive.
+func processAlive(pid int) bool {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(handle)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(handle, &code); err != nil {
+		return true
+	}
+	return code == 259 // STILL_ACTIVE
+}
@@ -0,0 +1,340 @@
+// Package dotlock provides thread-safe locking in non-blocking mode compatible
+// with the dotlock files of mail spools, as taken by liblockfile, dotlockfile,
+// procmail and many mail and cron tools: the lock on a file is held by the
+// existence of <file>.lock, whose content is the PID of the holder.
+//
+// The lock file is created NFS-safely like liblockfile does, by writing a
+// temporary file next to it and hard linking it to the lock path, and a lock
+// file left behind by a crashed holder is removed as stale when its PID is not
+// running on this host, or when it holds no PID and is older than StaleAge.
+// Long holders call Touch, like lockfile_touch, so tools judging locks by age
+// do not take them for stale ones. Locks are always exclusive.
+package dotlock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/lockcore"
+)
+
+// Suffix is appended to the path of the protected file to get its lock file
+const Suffix = ".lock"
+
+// StaleAge is the age after which a lock file holding no PID is stale, the five
+// minutes of liblockfile
+const StaleAge = 5 * time.Minute
+
+// LockPath returns the path of the dotlock file of the file at path
+func LockPath(path string) string {
+	return path + Suffix
+}
+
+// FileLock represents a dotlock on a file
+type FileLock struct {
+	core *lockcore.Lock
+}
+
+// New creates a new FileLock held by creating the lock file at path, like
+// lockfile_create, LockPath(file) being the dotlock of file
+func New(path string, opts ...filelock.Option) *FileLock {
+	o := filelock.NewOptions(opts...)
+	return &FileLock{core: lockcore.New(path, &linkDriver{perm: o.Perm}, o)}
+}
+
+// Lock acquires the lock
+// If the lock cannot be acquired immediately, it returns ErrLockHeld
+func (fl *FileLock) Lock() error {
+	return fl.LockWithTimeout(0)
+}
+
+// LockWithTimeout attempts to acquire the lock with a timeout
+// If timeout is <= 0, it's a non-blocking operation
+// If timeout is > 0, it will retry in a non-blocking manner until the timeout is reached
+func (fl *FileLock) LockWithTimeout(timeout time.Duration) error {
+	return fl.core.LockWithTimeout(timeout)
+}
+
+// Unlock releases the lock by removing the lock file
+// If the lock is not held, it returns ErrNotLocked, or nil when created with
+// filelock.WithIdempotentUnlock
+// If the lock file was removed by someone else meanwhile, it returns an error
+// wrapping ErrLockLost
+func (fl *FileLock) Unlock() error {
+	return fl.core.Unlock()
+}
+
+// UnlockWithTimeout releases the lock like Unlock, giving up after timeout when the
+// release hangs, on a stuck network file system for example: the lock is forgotten
+// and an error wrapping filelock.ErrAbandoned is returned
+// ContextLock().Unlock(ctx) gives up the same way when ctx is done
+func (fl *FileLock) UnlockWithTimeout(timeout time.Duration) error {
+	return fl.core.UnlockWithTimeout(timeout)
+}
+
+// Abort interrupts the acquisitions in progress on this instance, including the
+// ones waiting for another operation on it, which return filelock.ErrAborted
+// Later acquisitions are not affected and a held lock stays held
+func (fl *FileLock) Abort() {
+	fl.core.Abort()
+}
+
+// Touch updates the modification time of the held lock file, so that tools
+// judging dotlocks by their age keep seeing it as fresh, like lockfile_touch
+// It returns ErrNotLocked if the lock is not held
+func (fl *FileLock) Touch() error {
+	if !fl.core.IsLocked() {
+		return filelock.ErrNotLocked
+	}
+	now := time.Now()
+	err := os.Chtimes(fl.core.Path(), now, now)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: lock file %s was removed", filelock.ErrLockLost, fl.core.Path())
+	}
+	return mapError(err)
+}
+
+// IsLocked returns whether the lock is currently held by this instance
+func (fl *FileLock) IsLocked() bool {
+	return fl.core.IsLocked()
+}
+
+// Path returns the path of the lock file
+func (fl *FileLock) Path() string {
+	return fl.core.Path()
+}
+
+// AcquiredAt returns when the lock was acquired, or the zero time if it is not held
+func (fl *FileLock) AcquiredAt() time.Time {
+	return fl.core.AcquiredAt()
+}
+
+// HeldDuration returns how long the lock has been held, or 0 if it is not held
+func (fl *FileLock) HeldDuration() time.Duration {
+	return fl.core.HeldDuration()
+}
+
+// LastAcquireStats returns the number of attempts and the time spent by the most
+// recent acquisition, whether it succeeded or not
+func (fl *FileLock) LastAcquireStats() filelock.AcquireStats {
+	return fl.core.LastAcquireStats()
+}
+
+// Status returns a snapshot of the lock state, including holder and acquisition statistics
+func (fl *FileLock) Status() filelock.Status {
+	return fl.core.Status()
+}
+
+// LockFunc acquires the lock, retrying until ctx is done, and returns the function
+// releasing it, see filelock.LockFunc
+func (fl *FileLock) LockFunc(ctx context.Context) (release func() error, err error) {
+	return filelock.LockFunc(ctx, fl)
+}
+
+// ContextLock returns a view of the lock whose operations take a context
+func (fl *FileLock) ContextLock() filelock.ContextLock {
+	return fl.core.ContextLock()
+}
+
+// Yield releases the lock and acquires it again after the waiters of this process,
+// if it has been held for longer than the slice of filelock.WithYield
+// It reports whether the lock was released, see filelock.Yielder
+func (fl *FileLock) Yield(ctx context.Context) (bool, error) {
+	return fl.core.Yield(ctx)
+}
+
+// String describes the lock and its current state
+func (fl *FileLock) String() string {
+	return fl.Status().String()
+}
+
+// MarshalJSON encodes the current status of the lock
+func (fl *FileLock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fl.Status())
+}
+
+// ReadPID returns the PID written in the dotlock file at lockPath, or 0 if it
+// holds none
+func ReadPID(lockPath string) (int, error) {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0, err
+	}
+	pid, _ := parsePID(data)
+	return pid, nil
+}
+
+// tempCounter tells apart the temporary files of the locks of this process
+var tempCounter atomic.Uint64
+
+// linkDriver locks by hard linking a temporary file to the lock file
+type linkDriver struct {
+	path string
+
+	// perm is the exact permission of the lock file, or 0 for 0644
+	perm os.FileMode
+}
+
+func (d *linkDriver) Open(path string) error {
+	d.path = path
+	return nil
+}
+
+func (d *linkDriver) TryLock() error {
+	tmp, err := d.writeTemp()
+	if err != nil {
+		return mapError(err)
+	}
+	defer os.Remove(tmp)
+
+	// One stale lock file is removed per attempt, as liblockfile does
+	for retry := true; ; retry = false {
+		err := os.Link(tmp, d.path)
+		if err == nil || linked(tmp, d.path) {
+			// Over NFS, the link may be done even though the reply was lost
+			return nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return mapError(err)
+		}
+		if !retry {
+			return filelock.ErrLockHeld
+		}
+		// A lock file removed in between lets the next attempt succeed
+		if removed, err := removeStale(d.path, time.Now()); !removed && !errors.Is(err, fs.ErrNotExist) {
+			return filelock.ErrLockHeld
+		}
+	}
+}
+
+// writeTemp writes the PID line of the process into a new temporary file next to
+// the lock file, named like those of liblockfile, and returns its path
+func (d *linkDriver) writeTemp() (string, error) {
+	hostname, _ := os.Hostname()
+	if i := strings.IndexByte(hostname, '.'); i >= 0 {
+		hostname = hostname[:i]
+	}
+	name := fmt.Sprintf(".lk%05d%x%s", os.Getpid(), tempCounter.Add(1), hostname)
+	tmp := filepath.Join(filepath.Dir(d.path), name)
+
+	perm := d.perm
+	if perm == 0 {
+		perm = 0644
+	}
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && d.perm != 0 {
+		err = os.Chmod(tmp, d.perm)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+func (d *linkDriver) Unlock() error {
+	err := os.Remove(d.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: lock file %s was removed", filelock.ErrLockLost, d.path)
+	}
+	return mapError(err)
+}
+
+func (d *linkDriver) Close() error {
+	return nil
+}
+
+// linked reports whether the lock file at path is the temporary file tmp
+func linked(tmp, path string) bool {
+	tmpInfo, err := os.Stat(tmp)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && os.SameFile(tmpInfo, info)
+}
+
+// Stale reports whether the dotlock file at lockPath is stale: it holds the PID
+// of a process that is not running on this host, or it holds no PID and is older
+// than StaleAge. A lock file held by a running process is never stale.
+func Stale(lockPath string) (bool, error) {
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		return false, err
+	}
+	return stale(lockPath, info, time.Now())
+}
+
+// RemoveStale removes the dotlock file at lockPath if it is stale, as judged by
+// Stale, and reports whether it did. The file is removed only if it is still the
+// one judged stale.
+func RemoveStale(lockPath string) (bool, error) {
+	return removeStale(lockPath, time.Now())
+}
+
+// stale reports whether the lock file at path, described by info, is stale at now
+func stale(path string, info os.FileInfo, now time.Time) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if pid, ok := parsePID(data); ok {
+		return !processAlive(pid), nil
+	}
+	return now.Sub(info.ModTime()) >= StaleAge, nil
+}
+
+// removeStale removes the lock file at path if it is stale at now, and reports
+// whether it did
+func removeStale(path string, now time.Time) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if isStale, err := stale(path, info, now); err != nil || !isStale {
+		return false, err
+	}
+
+	if current, err := os.Stat(path); err != nil || !os.SameFile(info, current) ||
+		!current.ModTime().Equal(info.ModTime()) {
+		// Replaced by a new lock file meanwhile
+		return false, nil
+	}
+	if err := os.Remove(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// parsePID parses data as a PID line, a positive decimal number surrounded by
+// blanks
+func parsePID(data []byte) (int, bool) {
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, err == nil && pid > 0
+}
+
+// mapError translates the errors callers may want to branch on into the
+// filelock errors, keeping the original error in the chain
+func mapError(err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w: %w", filelock.ErrPermission, err)
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package dotlock
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/conformance"
+	"github.com/rsgcata/go-fs/filelock/testutil"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// DotLockTestSuite defines a test suite for the dotlock FileLock
+type DotLockTestSuite struct {
+	suite.Suite
+	tempDir string
+	mailbox string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *DotLockTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "dotlock-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.mailbox = filepath.Join(tempDir, "mailbox")
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *DotLockTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestBasicLockAndUnlock tests that the lock file holds the PID line exactly while
+// the lock is held, and that no temporary file is left behind
+func (s *DotLockTestSuite) TestBasicLockAndUnlock() {
+	lock := New(LockPath(s.mailbox))
+	s.Assert().Equal(s.mailbox+".lock", lock.Path())
+
+	s.Require().NoError(lock.Lock())
+	data, err := os.ReadFile(lock.Path())
+	s.Require().NoError(err)
+	s.Assert().Equal(fmt.Sprintf("%d\n", os.Getpid()), string(data))
+	s.Assert().Equal(filelock.ErrLockHeld, New(LockPath(s.mailbox)).Lock())
+
+	s.Require().NoError(lock.Unlock())
+	s.Assert().NoFileExists(lock.Path())
+	entries, err := os.ReadDir(s.tempDir)
+	s.Require().NoError(err)
+	s.Assert().Empty(entries)
+}
+
+// TestHonorsForeignLocks tests that lock files written by other tools are honored
+// while their holder runs, and removed once it is gone
+func (s *DotLockTestSuite) TestHonorsForeignLocks() {
+	lockPath := LockPath(s.mailbox)
+	s.Require().NoError(os.WriteFile(lockPath, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644))
+	s.Assert().Equal(filelock.ErrLockHeld, New(LockPath(s.mailbox)).Lock(), "a running holder is honored")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	s.Require().NoError(cmd.Run())
+	s.Require().NoError(os.WriteFile(lockPath, []byte(fmt.Sprintf("%10d\n", cmd.Process.Pid)), 0644))
+	pid, err := ReadPID(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Equal(cmd.Process.Pid, pid)
+
+	lock := New(LockPath(s.mailbox))
+	s.Require().NoError(lock.Lock(), "the lock of an exited holder is stale")
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestStaleAge tests that a lock file holding no PID is stale only once it is old
+func (s *DotLockTestSuite) TestStaleAge() {
+	lockPath := LockPath(s.mailbox)
+	s.Require().NoError(os.WriteFile(lockPath, nil, 0644))
+	s.Assert().Equal(filelock.ErrLockHeld, New(LockPath(s.mailbox)).Lock())
+
+	old := time.Now().Add(-StaleAge - time.Minute)
+	s.Require().NoError(os.Chtimes(lockPath, old, old))
+	lock := New(LockPath(s.mailbox))
+	s.Require().NoError(lock.Lock())
+
+	s.Require().NoError(os.Chtimes(lockPath, old, old))
+	s.Require().NoError(lock.Touch())
+	info, err := os.Stat(lockPath)
+	s.Require().NoError(err)
+	s.Assert().WithinDuration(time.Now(), info.ModTime(), time.Minute)
+	s.Require().NoError(lock.Unlock())
+	s.Assert().Equal(filelock.ErrNotLocked, lock.Touch())
+}
+
+// TestCrossProcessStress tests mutual exclusion between real processes
+func (s *DotLockTestSuite) TestCrossProcessStress() {
+	testutil.Stress(s.T(), func(path string) filelock.FileLock {
+		return New(path)
+	}, testutil.StressConfig{})
+}
+
+// TestConformance runs the conformance checks shared by all the backends
+func (s *DotLockTestSuite) TestConformance() {
+	conformance.Run(s.T(), func(path string, opts ...filelock.Option) filelock.FileLock {
+		return New(path, opts...)
+	}, conformance.Config{})
+}
+
+// TestDotLock runs the test suite
+func TestDotLock(t *testing.T) {
+	suite.Run(t, new(DotLockTestSuite))
+}
@@ -0,0 +1,59 @@
+// Package fakeclock provides a deterministic filelock.Clock for tests.
+//
+// Sleeping on a fake clock does not block: it advances the fake time by the
+// requested duration and returns immediately, so timeout and backoff logic runs
+// instantly and produces the same results on every run.
+package fakeclock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is a filelock.Clock whose time only moves when slept on or advanced
+type Clock struct {
+	now    time.Time
+	sleeps []time.Duration
+	mutex  sync.Mutex
+}
+
+// New creates a new Clock starting at the given time
+func New(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the fake current time
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Sleep advances the fake time by d and records the sleep
+// It returns ctx.Err() without advancing if ctx is already done
+func (c *Clock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+	return nil
+}
+
+// Advance moves the fake time forward by d without recording a sleep
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Sleeps returns the durations passed to Sleep, in order
+func (c *Clock) Sleeps() []time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
@@ -3,7 +3,9 @@
 package filelock
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -20,25 +22,192 @@ var (
 
 	// ErrNotLocked is returned when trying to unlock a file that is not locked
 	ErrNotLocked = errors.New("file is not locked")
+
+	// ErrSharingViolation is returned when the file cannot be opened because another
+	// process opened it without sharing access (ERROR_SHARING_VIOLATION on Windows).
+	// Unlike ErrLockHeld, the other process may not use locks at all.
+	ErrSharingViolation = errors.New("file is opened exclusively by another process")
+
+	// ErrPermission is returned when the process is not allowed to open or lock the file.
+	// Check the permissions of the file and of its directory.
+	ErrPermission = errors.New("permission denied")
+
+	// ErrLockLost is returned when a held lock was released by the system, for example
+	// because the network share holding the file disconnected. The lock is no longer
+	// held and the protected resource may have been modified by someone else.
+	ErrLockLost = errors.New("lock was lost")
+
+	// ErrLockTableFull is returned when the system ran out of lock records (ENOLCK).
+	// Release unused locks, raise the system lock limit, or on NFS check that the
+	// lock manager (lockd/statd) is running.
+	ErrLockTableFull = errors.New("system lock table is full")
+
+	// ErrReadOnly is returned when the lock file cannot be created or opened for
+	// writing because the file system is read-only (EROFS).
+	// Place lock files on a writable file system, such as /run/lock or a tmpfs.
+	ErrReadOnly = errors.New("file system is read-only")
+
+	// ErrNoSpace is returned when the lock file cannot be created because the device
+	// has no space or inodes left (ENOSPC). Free space or inodes on the device.
+	ErrNoSpace = errors.New("no space left on device")
+
+	// ErrDeadlock is returned by Upgrade when another instance of this process holding
+	// the same lock shared is already upgrading it: each would wait for the other to
+	// release its shared lock. Release the shared lock and acquire an exclusive one instead.
+	ErrDeadlock = errors.New("upgrade would deadlock with another upgrade of the same lock")
+
+	// ErrUnsafePath is returned by locks created with WithNoFollow or WithSecureParent
+	// when the lock file is a symbolic link, or its directory can be written by other
+	// users, so another user could redirect the lock to a file of their choosing.
+	ErrUnsafePath = errors.New("lock path is unsafe")
+
+	// ErrNotRegular is returned when the lock path is a directory, a device, a named
+	// pipe or a socket: locking it would hang or have no meaning. The error tells the
+	// kind of file found.
+	ErrNotRegular = errors.New("lock path is not a regular file")
+
+	// ErrAbandoned is returned by an Unlock given a deadline, such as UnlockWithTimeout,
+	// when the release did not complete in time, typically on a hung network file
+	// system. The lock instance forgets the lock and abandons its file descriptor:
+	// the system releases the lock when the pending release completes, or when the
+	// process exits.
+	ErrAbandoned = errors.New("unlock abandoned")
+
+	// ErrAborted is returned by an acquisition interrupted by Abort, whether it
+	// was polling for the lock or waiting for another operation on the instance.
+	ErrAborted = errors.New("lock acquisition aborted")
 )
 
+// AttemptsError is returned by an acquisition that gave up after the number of
+// attempts set by WithMaxAttempts. It wraps ErrTimeout.
+type AttemptsError struct {
+	// Attempts is the number of attempts made.
+	Attempts int
+}
+
+// Error reports the attempts made.
+func (e *AttemptsError) Error() string {
+	return fmt.Sprintf("%s after %d attempts", ErrTimeout, e.Attempts)
+}
+
+// Unwrap returns ErrTimeout.
+func (e *AttemptsError) Unwrap() error {
+	return ErrTimeout
+}
+
+// hints holds the remediation advice for the errors callers can act upon, in the
+// order Hint checks them, so an error matching several gets the same advice
+var hints = []struct {
+	err  error
+	hint string
+}{
+	{ErrSharingViolation, "close the other program using the file or wait for it to finish"},
+	{ErrPermission, "check the permissions of the lock file and of its directory"},
+	{ErrLockTableFull, "release unused locks, raise the system lock limit, or on NFS check that lockd/statd are running"},
+	{ErrReadOnly, "place lock files on a writable file system, such as /run/lock or a tmpfs"},
+	{ErrNoSpace, "free space or inodes on the device holding the lock file"},
+	{ErrDeadlock, "release the shared lock and acquire an exclusive one instead of upgrading"},
+	{ErrUnsafePath, "place lock files in a directory only writable by the owner, such as /run/lock"},
+	{ErrNotRegular, "lock a regular file, such as a .lock file next to the directory or device to protect"},
+	{ErrAbandoned, "check the file system holding the lock file, the lock is released when the pending release completes or the process exits"},
+}
+
+// Hint returns a short remediation advice for err, or "" if there is none.
+// It recognizes wrapped errors. For an error matching several of the errors
+// of this package, such as one made by errors.Join, the advice is always the
+// same one.
+func Hint(err error) string {
+	for _, h := range hints {
+		if errors.Is(err, h.err) {
+			return h.hint
+		}
+	}
+	return ""
+}
+
 // FileLock defines a common interface for file locking mechanisms.
+//
+// The locks of this module are safe for concurrent use. The operations changing
+// the state of an instance (Lock, LockWithTimeout, Unlock and the conversions) are
+// serialized: an operation waits for the one in progress on the same instance,
+// including an acquisition polling in LockWithTimeout. The other methods never
+// wait for them.
 type FileLock interface {
 	// Lock attempts to acquire an exclusive lock on the file.
 	// Returns ErrLockHeld if the lock is already held by another process.
+	// It waits for an operation in progress on the instance, and then returns
+	// ErrAlreadyLocked if that operation acquired the lock.
 	Lock() error
 
 	// LockWithTimeout attempts to acquire an exclusive lock on the file with a timeout.
 	// If timeout is <= 0, it's a non-blocking operation.
+	// It waits for an operation in progress on the instance like Lock, the timeout
+	// only bounding its own polling.
 	LockWithTimeout(timeout time.Duration) error
 
 	// Unlock releases the lock on the file.
-	// Returns ErrNotLocked if the file is not locked.
+	// Returns ErrNotLocked if the file is not locked, unless the lock was
+	// created with WithIdempotentUnlock.
+	// It waits for an acquisition in progress on the instance to finish.
 	Unlock() error
 
 	// IsLocked returns true if the file is currently locked by this process.
+	// Like AcquiredAt, HeldDuration, LastAcquireStats and Status, it never waits
+	// for an acquisition or a release in progress on the same instance, so health
+	// checks can call it at any time.
 	IsLocked() bool
 
-	// Path returns the path to the locked file.
+	// Path returns the path to the locked file. It never changes.
 	Path() string
+
+	// AcquiredAt returns when the lock was acquired, or the zero time if it is not held.
+	AcquiredAt() time.Time
+
+	// HeldDuration returns how long the lock has been held, or 0 if it is not held.
+	HeldDuration() time.Duration
+
+	// LastAcquireStats returns the number of attempts and the time spent by the
+	// most recent acquisition, whether it succeeded or not.
+	LastAcquireStats() AcquireStats
+
+	// Status returns a snapshot of the lock state, holder and acquisition statistics.
+	// It never waits for an in-flight acquisition to finish.
+	Status() Status
+}
+
+// Converter is implemented by locks whose mode can be changed while held. Backends
+// that cannot convert a lock without releasing it return errors.ErrUnsupported.
+type Converter interface {
+	// Downgrade converts a held exclusive lock to a shared one, without releasing it
+	// in between. It returns ErrNotLocked if the lock is not held, and nil if it is
+	// already shared.
+	Downgrade() error
+
+	// Upgrade converts a held shared lock to an exclusive one, retrying until the
+	// other shared holders are gone or timeout is reached, like LockWithTimeout.
+	// On ErrTimeout the shared lock is still held. It returns ErrDeadlock if another
+	// instance of this process is upgrading the same lock, and ErrLockLost if the
+	// shared lock could not be kept during the upgrade.
+	Upgrade(timeout time.Duration) error
+}
+
+// Yielder is implemented by the FileLocks of this module, whose holder can let the
+// waiters of the process take the lock in turn, see WithYield.
+type Yielder interface {
+	// Yield releases the lock and acquires it again, retrying until ctx is done, if
+	// it has been held for longer than the slice of WithYield while other locks of
+	// this process wait for it. Their waiters take the lock first. It reports
+	// whether the lock was released, in which case the state it protects may have
+	// changed, and returns ErrNotLocked if the lock is not held. On any other error
+	// the lock is not held anymore.
+	Yield(ctx context.Context) (bool, error)
+}
+
+// Aborter is implemented by the FileLocks of this module, whose pending
+// acquisitions can be interrupted from another goroutine, such as a shutdown path
+// having no context to cancel.
+type Aborter interface {
+	// Abort interrupts the acquisitions in progress on the instance, which return
+	// ErrAborted. Later acquisitions are not affected and a held lock stays held.
+	Abort()
 }
@@ -0,0 +1,34 @@
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// FileLockTestSuite defines a test suite for the errors of the package
+type FileLockTestSuite struct {
+	suite.Suite
+}
+
+// TestHint tests that the advice is found through wrapping, and that an error
+// matching several errors always gets the same advice
+func (s *FileLockTestSuite) TestHint() {
+	s.Assert().Empty(Hint(nil))
+	s.Assert().Empty(Hint(errors.New("other")))
+	s.Assert().Empty(Hint(ErrLockHeld))
+	s.Assert().NotEmpty(Hint(fmt.Errorf("open x.lock: %w", ErrReadOnly)))
+
+	joined := errors.Join(ErrNoSpace, ErrPermission, ErrUnsafePath)
+	want := Hint(ErrPermission)
+	for range 100 {
+		s.Require().Equal(want, Hint(joined))
+	}
+}
+
+// TestFileLock runs the test suite
+func TestFileLock(t *testing.T) {
+	suite.Run(t, new(FileLockTestSuite))
+}
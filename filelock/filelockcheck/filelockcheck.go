@@ -0,0 +1,281 @@
+// Package filelockcheck defines an Analyzer reporting locks acquired and not
+// released, like lostcancel does for the cancel functions of contexts.
+//
+// A lock is any value with the methods of filelock.FileLock, Lock() error,
+// LockWithTimeout(time.Duration) error and Unlock() error, held in a local
+// variable. After a call to Lock or LockWithTimeout whose error is checked, the
+// statements of the success path must release it, with Unlock or defer Unlock,
+// before returning.
+// Locks passed to other functions, returned or stored elsewhere are assumed to be
+// released by their new owner and are not checked.
+package filelockcheck
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// Analyzer reports the locks acquired and not released on some path
+var Analyzer = &analysis.Analyzer{
+	Name:     "filelockcheck",
+	Doc:      "check that file locks acquired with Lock or LockWithTimeout are released",
+	URL:      "https://pkg.go.dev/github.com/rsgcata/go-fs/filelock/filelockcheck",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	filter := []ast.Node{(*ast.FuncDecl)(nil), (*ast.FuncLit)(nil)}
+	inspect.Preorder(filter, func(n ast.Node) {
+		var body *ast.BlockStmt
+		switch f := n.(type) {
+		case *ast.FuncDecl:
+			body = f.Body
+		case *ast.FuncLit:
+			body = f.Body
+		}
+		if body != nil {
+			checkFunc(pass, body)
+		}
+	})
+	return nil, nil
+}
+
+// checkFunc checks the locks acquired in the statements of a function body,
+// excluding the nested function literals, which are checked on their own
+func checkFunc(pass *analysis.Pass, body *ast.BlockStmt) {
+	var blocks []*ast.BlockStmt
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.BlockStmt:
+			blocks = append(blocks, n)
+		case *ast.CaseClause:
+			blocks = append(blocks, &ast.BlockStmt{List: n.Body})
+		case *ast.CommClause:
+			blocks = append(blocks, &ast.BlockStmt{List: n.Body})
+		}
+		return true
+	})
+
+	for _, block := range blocks {
+		for i, stmt := range block.List {
+			lock, call, rest := acquisition(pass, stmt, block.List[i+1:])
+			// Locks declared outside the body, like parameters, belong to the caller
+			if lock == nil || lock.Pos() < body.Pos() || escapes(pass, body, lock) {
+				continue
+			}
+			checkReleased(pass, lock, call, rest, block == body)
+		}
+	}
+}
+
+// acquisition returns the lock variable acquired by stmt, the acquiring call and
+// the statements of the success path following it in its block
+func acquisition(pass *analysis.Pass, stmt ast.Stmt, next []ast.Stmt) (*types.Var, *ast.CallExpr, []ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		// err := lock.Lock() followed by if err != nil { return }
+		if len(s.Rhs) != 1 || len(s.Lhs) != 1 {
+			return nil, nil, nil
+		}
+		lock, call := lockCall(pass, s.Rhs[0])
+		if lock == nil {
+			return nil, nil, nil
+		}
+		// Without the check, the outcome of the acquisition is not known
+		if len(next) == 0 || !isErrCheck(pass, next[0], s.Lhs[0]) {
+			return nil, nil, nil
+		}
+		return lock, call, next[1:]
+
+	case *ast.IfStmt:
+		// if err := lock.Lock(); err != nil { return }
+		if assign, ok := s.Init.(*ast.AssignStmt); ok && len(assign.Rhs) == 1 && len(assign.Lhs) == 1 {
+			lock, call := lockCall(pass, assign.Rhs[0])
+			if lock != nil && s.Else == nil && isErrCond(pass, s.Cond, assign.Lhs[0]) && terminates(s.Body) {
+				return lock, call, next
+			}
+		}
+		// if lock.Lock() != nil { return }
+		if cond, ok := s.Cond.(*ast.BinaryExpr); ok && cond.Op == token.NEQ && isNil(pass, cond.Y) {
+			lock, call := lockCall(pass, cond.X)
+			if lock != nil && s.Else == nil && terminates(s.Body) {
+				return lock, call, next
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// lockCall returns the lock variable and the call if expr calls Lock or
+// LockWithTimeout on a local lock variable
+func lockCall(pass *analysis.Pass, expr ast.Expr) (*types.Var, *ast.CallExpr) {
+	call, ok := ast.Unparen(expr).(*ast.CallExpr)
+	if !ok {
+		return nil, nil
+	}
+	lock, name := methodCall(pass, call)
+	if lock == nil || (name != "Lock" && name != "LockWithTimeout") {
+		return nil, nil
+	}
+	return lock, call
+}
+
+// methodCall returns the local lock variable a method is called on, and the name
+// of the method
+func methodCall(pass *analysis.Pass, call *ast.CallExpr) (*types.Var, string) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil, ""
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return nil, ""
+	}
+	v, ok := pass.TypesInfo.Uses[ident].(*types.Var)
+	if !ok || v.IsField() || v.Parent() == v.Pkg().Scope() || !isFileLock(v.Type()) {
+		return nil, ""
+	}
+	return v, sel.Sel.Name
+}
+
+// isFileLock reports whether t has the lock methods of filelock.FileLock
+func isFileLock(t types.Type) bool {
+	errorType := types.Universe.Lookup("error").Type()
+	returnsError := func(name string, params int) bool {
+		obj, _, _ := types.LookupFieldOrMethod(t, true, nil, name)
+		fn, ok := obj.(*types.Func)
+		if !ok {
+			return false
+		}
+		sig := fn.Type().(*types.Signature)
+		return sig.Params().Len() == params && sig.Results().Len() == 1 &&
+			types.Identical(sig.Results().At(0).Type(), errorType)
+	}
+	return returnsError("Lock", 0) && returnsError("Unlock", 0) && returnsError("LockWithTimeout", 1)
+}
+
+// isErrCheck reports whether stmt is if err != nil { ... } with a terminating body
+func isErrCheck(pass *analysis.Pass, stmt ast.Stmt, errExpr ast.Expr) bool {
+	s, ok := stmt.(*ast.IfStmt)
+	return ok && s.Init == nil && s.Else == nil && isErrCond(pass, s.Cond, errExpr) && terminates(s.Body)
+}
+
+// isErrCond reports whether cond is err != nil
+func isErrCond(pass *analysis.Pass, cond ast.Expr, errExpr ast.Expr) bool {
+	bin, ok := cond.(*ast.BinaryExpr)
+	if !ok || bin.Op != token.NEQ || !isNil(pass, bin.Y) {
+		return false
+	}
+	x, ok1 := bin.X.(*ast.Ident)
+	e, ok2 := errExpr.(*ast.Ident)
+	return ok1 && ok2 && pass.TypesInfo.ObjectOf(x) == pass.TypesInfo.ObjectOf(e)
+}
+
+func isNil(pass *analysis.Pass, expr ast.Expr) bool {
+	return pass.TypesInfo.Types[expr].IsNil()
+}
+
+// terminates reports whether block ends with a return, panic, or a branch
+func terminates(block *ast.BlockStmt) bool {
+	if len(block.List) == 0 {
+		return false
+	}
+	switch s := block.List[len(block.List)-1].(type) {
+	case *ast.ReturnStmt, *ast.BranchStmt:
+		return true
+	case *ast.ExprStmt:
+		call, ok := s.X.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		ident, ok := call.Fun.(*ast.Ident)
+		return ok && ident.Name == "panic"
+	}
+	return false
+}
+
+// escapes reports whether lock is used in body other than by calling its methods,
+// in which case its release is the responsibility of another function
+func escapes(pass *analysis.Pass, body *ast.BlockStmt, lock *types.Var) bool {
+	methodRecv := make(map[*ast.Ident]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				methodRecv[ident] = true
+			}
+		}
+		return true
+	})
+
+	escaped := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if ok && pass.TypesInfo.Uses[ident] == lock && !methodRecv[ident] {
+			escaped = true
+		}
+		return !escaped
+	})
+	return escaped
+}
+
+// checkReleased reports the returns of the success path reached before the lock is
+// released, and the end of the function if it is never released
+func checkReleased(pass *analysis.Pass, lock *types.Var, call *ast.CallExpr, rest []ast.Stmt, isFuncBody bool) {
+	for _, stmt := range rest {
+		if releases(pass, stmt, lock) {
+			return
+		}
+		if ret := findReturn(stmt); ret != nil {
+			pass.Reportf(ret.Pos(), "this return leaks the lock acquired by %s.%s at line %d: add defer %s.Unlock()",
+				lock.Name(), callName(call), pass.Fset.Position(call.Pos()).Line, lock.Name())
+			return
+		}
+	}
+	if isFuncBody {
+		pass.Reportf(call.Pos(), "the lock acquired by %s.%s is never released: add defer %s.Unlock()",
+			lock.Name(), callName(call), lock.Name())
+	}
+}
+
+// releases reports whether stmt calls Unlock on lock, possibly deferred or in a
+// function literal
+func releases(pass *analysis.Pass, stmt ast.Stmt, lock *types.Var) bool {
+	found := false
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if v, name := methodCall(pass, call); v == lock && name == "Unlock" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// findReturn returns the first return statement of stmt, outside function literals
+func findReturn(stmt ast.Stmt) *ast.ReturnStmt {
+	var ret *ast.ReturnStmt
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			ret = n
+		}
+		return ret == nil
+	})
+	return ret
+}
+
+func callName(call *ast.CallExpr) string {
+	return call.Fun.(*ast.SelectorExpr).Sel.Name
+}
@@ -0,0 +1,110 @@
+package a
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type FileLock struct{}
+
+func (*FileLock) Lock() error                         { return nil }
+func (*FileLock) LockWithTimeout(time.Duration) error { return nil }
+func (*FileLock) Unlock() error                       { return nil }
+
+func New(string) *FileLock { return &FileLock{} }
+
+func deferred() error {
+	lock := New("a.lock")
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return work()
+}
+
+func explicit() error {
+	lock := New("a.lock")
+	err := lock.LockWithTimeout(time.Second)
+	if err != nil {
+		return err
+	}
+	err = work()
+	lock.Unlock()
+	return err
+}
+
+func returnWithoutRelease() error {
+	lock := New("a.lock")
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	work()
+	return nil // want `this return leaks the lock acquired by lock.Lock at line 39: add defer lock.Unlock\(\)`
+}
+
+func neverReleased() {
+	lock := New("a.lock")
+	if err := lock.Lock(); err != nil { // want `the lock acquired by lock.Lock is never released: add defer lock.Unlock\(\)`
+		return
+	}
+	work()
+}
+
+func earlyReturn() error {
+	lock := New("a.lock")
+	if lock.LockWithTimeout(time.Second) != nil {
+		return errors.New("busy")
+	}
+	if err := work(); err != nil {
+		return err // want `this return leaks the lock acquired by lock.LockWithTimeout at line 56`
+	}
+	return lock.Unlock()
+}
+
+func releasedInClosure() error {
+	lock := New("a.lock")
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	defer func() { _ = lock.Unlock() }()
+	return work()
+}
+
+func transferred() (*FileLock, error) {
+	lock := New("a.lock")
+	if err := lock.Lock(); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+type holder struct {
+	lock *FileLock
+}
+
+func (h *holder) field() error {
+	return h.lock.Lock()
+}
+
+func unchecked() bool {
+	lock := New("a.lock")
+	err := lock.LockWithTimeout(time.Second)
+	return errors.Is(err, errBusy)
+}
+
+func parameter(lock *FileLock) error {
+	if err := lock.Lock(); err != nil {
+		return err
+	}
+	return nil
+}
+
+var errBusy = errors.New("busy")
+
+func mutex() {
+	var mu sync.Mutex
+	mu.Lock()
+}
+
+func work() error { return nil }
@@ -0,0 +1,73 @@
+// Package filelocktest lets implementers of filelock.FileLock, such as adapters
+// for lock services, check that their implementation behaves like the backends
+// of this module.
+//
+// RunConformance checks double locks, unlocks without a lock, timeouts,
+// reentrancy, status and holder metadata, mutual exclusion between goroutines
+// and between processes:
+//
+//	func TestConformance(t *testing.T) {
+//		filelocktest.RunConformance(t, func() filelock.FileLock {
+//			return redislock.New(client, "filelocktest")
+//		})
+//	}
+package filelocktest
+
+import (
+	"testing"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/conformance"
+	"github.com/rsgcata/go-fs/filelock/testutil"
+)
+
+type options struct {
+	processes bool
+	stress    testutil.StressConfig
+}
+
+// Option configures RunConformance
+type Option func(*options)
+
+// WithStressConfig configures the check of mutual exclusion between processes
+func WithStressConfig(cfg testutil.StressConfig) Option {
+	return func(o *options) {
+		o.stress = cfg
+	}
+}
+
+// WithoutProcesses skips the check of mutual exclusion between processes, for
+// implementations only locking within a process
+func WithoutProcesses() Option {
+	return func(o *options) {
+		o.processes = false
+	}
+}
+
+// RunConformance runs the conformance checks as subtests of t. newLock must return
+// a new instance of the same lock on every call, including in the child processes
+// of the test binary started by the check between processes: use a fixed key or
+// path rather than one derived from t.TempDir. The lock must be free when
+// RunConformance is called.
+//
+// The checks relying on filelock options, like shared locks, are skipped; backends
+// taking options can run conformance.Run as well.
+func RunConformance(t *testing.T, newLock func() filelock.FileLock, opts ...Option) {
+	o := options{processes: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	t.Run("Processes", func(t *testing.T) {
+		if !o.processes {
+			t.Skip("disabled by WithoutProcesses")
+		}
+		testutil.Stress(t, func(string) filelock.FileLock {
+			return newLock()
+		}, o.stress)
+	})
+
+	conformance.Run(t, func(string, ...filelock.Option) filelock.FileLock {
+		return newLock()
+	}, conformance.Config{SingleLock: true})
+}
@@ -0,0 +1,19 @@
+package filelocktest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/lockfile"
+)
+
+// TestRunConformance runs the checks against the lockfile backend, on a path shared
+// with the child processes
+func TestRunConformance(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "go-fs-filelocktest.lock")
+	RunConformance(t, func() filelock.FileLock {
+		return lockfile.New(path)
+	})
+}
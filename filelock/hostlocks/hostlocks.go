@@ -0,0 +1,338 @@
+// Package hostlocks keeps an opt-in registry of the locks held by the processes of
+// the host, to answer "what does PID 1234 hold?" and "who holds anything under
+// /var/lib/app/?" without attaching to the processes.
+//
+// Each participating process opens the registry, which writes its manifest, the
+// list of the locks it holds, in a well-known directory, and creates its locks
+// with the option of the registry:
+//
+//	registry, err := hostlocks.Open("")
+//	if err != nil {
+//		return err
+//	}
+//	defer registry.Close()
+//
+//	lock := fs.New(path, registry.Option())
+//
+// A process holds the lock of its manifest while it is registered, so the
+// manifests left behind by processes that crashed are recognized and skipped.
+package hostlocks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gofs "github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/atomicfile"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/lockdebug"
+)
+
+// manifestSuffix is the extension of the manifests, named after the PID of their
+// process
+const manifestSuffix = ".json"
+
+// DefaultDir returns the directory used by Open and the queries when they are given
+// an empty directory, shared by the users of the host
+func DefaultDir() string {
+	return filepath.Join(os.TempDir(), "go-fs.hostlocks")
+}
+
+// Lock is a lock held by a registered process
+type Lock struct {
+	// Path is the path the lock was created with
+	Path string `json:"path"`
+
+	// CanonicalPath is the canonical form of Path, see filelock.CanonicalPath
+	CanonicalPath string `json:"canonical_path"`
+
+	// AcquiredAt is when the lock was acquired
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// Manifest lists the locks held by a registered process
+type Manifest struct {
+	filelock.Holder
+
+	// Locks are the locks held by the process, in acquisition order
+	Locks []Lock `json:"locks"`
+
+	// Waiting are the locks the process is acquiring, with the time it started
+	// as AcquiredAt
+	Waiting []Lock `json:"waiting,omitempty"`
+}
+
+// Registry registers the locks of the current process
+type Registry struct {
+	dir  string
+	path string
+	lock filelock.FileLock
+
+	mutex    sync.Mutex
+	manifest Manifest
+	closed   bool
+}
+
+// Open registers the current process in the registry of dir, or DefaultDir if dir
+// is empty, creating the directory if needed. The process holds no lock until locks
+// created with Option are acquired. A process can only be registered once per
+// directory.
+func Open(dir string) (*Registry, error) {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	if err := createDir(dir); err != nil {
+		return nil, err
+	}
+
+	holder := filelock.CurrentHolder()
+	name := strconv.Itoa(holder.PID)
+	lock := gofs.New(filepath.Join(dir, name+gofs.LockSuffix))
+	if err := lock.Lock(); err != nil {
+		if errors.Is(err, filelock.ErrLockHeld) {
+			return nil, fmt.Errorf("process %d is already registered in %s: %w", holder.PID, dir, err)
+		}
+		return nil, err
+	}
+
+	r := &Registry{
+		dir:      dir,
+		path:     filepath.Join(dir, name+manifestSuffix),
+		lock:     lock,
+		manifest: Manifest{Holder: holder, Locks: []Lock{}},
+	}
+	if err := r.write(); err != nil {
+		_ = lock.Unlock()
+		return nil, err
+	}
+	return r, nil
+}
+
+// createDir creates dir, if it does not exist, writable by every user with the
+// sticky bit, like the temporary directory, so every user of the host can register
+func createDir(dir string) error {
+	err := os.Mkdir(dir, 0o777)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chmod(dir, 0o777|os.ModeSticky)
+}
+
+// Dir returns the directory of the registry
+func (r *Registry) Dir() string {
+	return r.dir
+}
+
+// Option returns the option recording the lock in the manifest of the process while
+// it is held or being acquired. The manifest is rewritten on every acquisition
+// attempt and release, failing to rewrite it does not fail the lock, it only hides
+// the change.
+func (r *Registry) Option() filelock.Option {
+	return filelock.WithStateChange(r.transition)
+}
+
+// transition records the acquisitions and releases of a lock
+func (r *Registry) transition(t filelock.Transition) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+
+	lock := Lock{Path: t.Path, CanonicalPath: t.CanonicalPath, AcquiredAt: t.Time}
+	switch t.To {
+	case filelock.Acquiring:
+		r.manifest.Waiting = append(r.manifest.Waiting, lock)
+	case filelock.Locked:
+		if t.From != filelock.Acquiring {
+			// A failed release, the lock is still recorded
+			return
+		}
+		r.manifest.Waiting = remove(r.manifest.Waiting, t.Path)
+		r.manifest.Locks = append(r.manifest.Locks, lock)
+	case filelock.Unlocked, filelock.Lost:
+		switch t.From {
+		case filelock.Acquiring:
+			// A failed acquisition
+			r.manifest.Waiting = remove(r.manifest.Waiting, t.Path)
+		case filelock.Locked, filelock.Releasing:
+			r.manifest.Locks = remove(r.manifest.Locks, t.Path)
+		default:
+			// A lost lock being forgotten, it is already removed
+			return
+		}
+	default:
+		return
+	}
+	_ = r.write()
+}
+
+// remove removes the lock most recently added to locks with path, if any
+func remove(locks []Lock, path string) []Lock {
+	for i := len(locks) - 1; i >= 0; i-- {
+		if locks[i].Path == path {
+			return append(locks[:i], locks[i+1:]...)
+		}
+	}
+	return locks
+}
+
+// write replaces the manifest of the process, must be called with mutex held
+func (r *Registry) write() error {
+	data, err := json.Marshal(r.manifest)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(r.path, data, 0o644)
+}
+
+// Close unregisters the current process, removing its manifest. The locks created
+// with Option are not recorded anymore.
+func (r *Registry) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	err := os.Remove(r.path)
+	return errors.Join(err, r.lock.Unlock())
+}
+
+// Manifests returns the manifests of the processes registered in dir, or DefaultDir
+// if dir is empty, sorted by PID. Manifests of processes that are not registered
+// anymore are skipped.
+func Manifests(dir string) ([]Manifest, error) {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+manifestSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []Manifest
+	for _, path := range paths {
+		manifest, err := readManifest(path)
+		if err != nil {
+			return nil, err
+		}
+		if manifest != nil {
+			manifests = append(manifests, *manifest)
+		}
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].PID < manifests[j].PID
+	})
+	return manifests, nil
+}
+
+// readManifest returns the manifest at path, or nil if its process is not registered
+// anymore
+func readManifest(path string) (*Manifest, error) {
+	// Registered processes hold the lock of their manifest, the shared lock does
+	// not get in the way of concurrent queries
+	lock := gofs.New(strings.TrimSuffix(path, manifestSuffix)+gofs.LockSuffix, filelock.WithShared())
+	switch err := lock.Lock(); {
+	case err == nil:
+		_ = lock.Unlock()
+		return nil, nil
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case !errors.Is(err, filelock.ErrLockHeld):
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Unregistered meanwhile
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("manifest %s is invalid: %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// HeldBy returns the manifest of the process pid registered in dir, or DefaultDir if
+// dir is empty, or nil if the process is not registered
+func HeldBy(dir string, pid int) (*Manifest, error) {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	return readManifest(filepath.Join(dir, strconv.Itoa(pid)+manifestSuffix))
+}
+
+// HeldUnder returns the manifests of the processes registered in dir, or DefaultDir
+// if dir is empty, holding locks on prefix or on files under the directory prefix,
+// with only these locks. Paths are compared in canonical form.
+func HeldUnder(dir, prefix string) ([]Manifest, error) {
+	manifests, err := Manifests(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix = filelock.CanonicalPath(prefix)
+	var found []Manifest
+	for _, manifest := range manifests {
+		var locks []Lock
+		for _, lock := range manifest.Locks {
+			if under(lock.CanonicalPath, prefix) {
+				locks = append(locks, lock)
+			}
+		}
+		if len(locks) > 0 {
+			manifest.Locks = locks
+			found = append(found, manifest)
+		}
+	}
+	return found, nil
+}
+
+// under reports whether path is prefix or is under the directory prefix
+func under(path, prefix string) bool {
+	if path == prefix {
+		return true
+	}
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, prefix)
+}
+
+// Graph returns the graph of the locks held and waited for by the processes
+// registered in dir, or DefaultDir if dir is empty, to find the deadlocks between
+// processes with Graph.Deadlocks or draw it with Graph.WriteDOT
+func Graph(dir string) (lockdebug.Graph, error) {
+	manifests, err := Manifests(dir)
+	if err != nil {
+		return lockdebug.Graph{}, err
+	}
+
+	var g lockdebug.Graph
+	for _, manifest := range manifests {
+		for _, lock := range manifest.Locks {
+			g.Hold(manifest.Holder, lock.CanonicalPath)
+		}
+		for _, lock := range manifest.Waiting {
+			g.Wait(manifest.Holder, lock.CanonicalPath)
+		}
+	}
+	return g, nil
+}
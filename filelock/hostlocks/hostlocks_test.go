@@ -0,0 +1,169 @@
+package hostlocks
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	gofs "github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/lockdebug"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// HostLocksTestSuite defines a test suite for the host registry of held locks
+type HostLocksTestSuite struct {
+	suite.Suite
+	tempDir string
+	dir     string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *HostLocksTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "hostlocks-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.dir = filepath.Join(tempDir, "registry")
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *HostLocksTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestHeldBy tests that the manifest follows the acquisitions and releases
+func (s *HostLocksTestSuite) TestHeldBy() {
+	registry, err := Open(s.dir)
+	s.Require().NoError(err)
+	defer registry.Close()
+
+	pid := os.Getpid()
+	manifest, err := HeldBy(s.dir, pid)
+	s.Require().NoError(err)
+	s.Require().NotNil(manifest)
+	s.Assert().Equal(filelock.CurrentHolder(), manifest.Holder)
+	s.Assert().Empty(manifest.Locks)
+
+	first := gofs.New(filepath.Join(s.tempDir, "first.lock"), registry.Option())
+	second := gofs.New(filepath.Join(s.tempDir, "second.lock"), registry.Option())
+	s.Require().NoError(first.Lock())
+	s.Require().NoError(second.Lock())
+
+	manifest, err = HeldBy(s.dir, pid)
+	s.Require().NoError(err)
+	s.Require().Len(manifest.Locks, 2)
+	s.Assert().Equal(first.Path(), manifest.Locks[0].Path)
+	s.Assert().Equal(filelock.CanonicalPath(first.Path()), manifest.Locks[0].CanonicalPath)
+	s.Assert().False(manifest.Locks[0].AcquiredAt.IsZero())
+	s.Assert().Equal(second.Path(), manifest.Locks[1].Path)
+
+	// A failed acquisition is not recorded
+	contender := gofs.New(first.Path(), registry.Option())
+	s.Assert().ErrorIs(contender.Lock(), filelock.ErrLockHeld)
+
+	s.Require().NoError(first.Unlock())
+	manifest, err = HeldBy(s.dir, pid)
+	s.Require().NoError(err)
+	s.Require().Len(manifest.Locks, 1)
+	s.Assert().Equal(second.Path(), manifest.Locks[0].Path)
+	s.Require().NoError(second.Unlock())
+
+	manifest, err = HeldBy(s.dir, pid+1)
+	s.Require().NoError(err)
+	s.Assert().Nil(manifest)
+}
+
+// TestHeldUnder tests the query by directory
+func (s *HostLocksTestSuite) TestHeldUnder() {
+	registry, err := Open(s.dir)
+	s.Require().NoError(err)
+	defer registry.Close()
+
+	appDir := filepath.Join(s.tempDir, "app")
+	s.Require().NoError(os.Mkdir(appDir, 0o755))
+	inside := gofs.New(filepath.Join(appDir, "job.lock"), registry.Option())
+	outside := gofs.New(filepath.Join(s.tempDir, "application.lock"), registry.Option())
+	s.Require().NoError(inside.Lock())
+	defer inside.Unlock()
+	s.Require().NoError(outside.Lock())
+	defer outside.Unlock()
+
+	manifests, err := HeldUnder(s.dir, appDir)
+	s.Require().NoError(err)
+	s.Require().Len(manifests, 1)
+	s.Require().Len(manifests[0].Locks, 1)
+	s.Assert().Equal(inside.Path(), manifests[0].Locks[0].Path)
+
+	manifests, err = HeldUnder(s.dir, outside.Path())
+	s.Require().NoError(err)
+	s.Require().Len(manifests, 1)
+	s.Assert().Equal(outside.Path(), manifests[0].Locks[0].Path)
+}
+
+// TestStaleManifest tests that the manifests of processes that are gone are skipped
+func (s *HostLocksTestSuite) TestStaleManifest() {
+	registry, err := Open(s.dir)
+	s.Require().NoError(err)
+	_, err = Open(s.dir)
+	s.Assert().ErrorIs(err, filelock.ErrLockHeld, "a process registers once")
+
+	// A crashed process leaves its manifest, but not the lock on it
+	stale := filepath.Join(s.dir, strconv.Itoa(os.Getpid()+1)+manifestSuffix)
+	s.Require().NoError(os.WriteFile(stale, []byte(`{"pid":1,"locks":[]}`), 0o644))
+
+	manifests, err := Manifests(s.dir)
+	s.Require().NoError(err)
+	s.Require().Len(manifests, 1)
+	s.Assert().Equal(os.Getpid(), manifests[0].PID)
+
+	s.Require().NoError(registry.Close())
+	manifests, err = Manifests(s.dir)
+	s.Require().NoError(err)
+	s.Assert().Empty(manifests)
+}
+
+// TestGraph tests that processes waiting for each other are found in the graph
+func (s *HostLocksTestSuite) TestGraph() {
+	registry, err := Open(s.dir)
+	s.Require().NoError(err)
+	defer registry.Close()
+
+	lockPath := filepath.Join(s.tempDir, "graph.lock")
+	holder := gofs.New(lockPath, registry.Option())
+	s.Require().NoError(holder.Lock())
+	defer holder.Unlock()
+
+	waiter := gofs.New(lockPath, registry.Option())
+	done := make(chan error, 1)
+	go func() {
+		done <- waiter.LockWithTimeout(300 * time.Millisecond)
+	}()
+
+	s.Require().Eventually(func() bool {
+		manifest, err := HeldBy(s.dir, os.Getpid())
+		return err == nil && len(manifest.Waiting) == 1
+	}, 200*time.Millisecond, 5*time.Millisecond)
+
+	g, err := Graph(s.dir)
+	s.Require().NoError(err)
+	s.Assert().Len(g.Nodes, 2)
+	var kinds []lockdebug.EdgeKind
+	for _, e := range g.Edges {
+		kinds = append(kinds, e.Kind)
+	}
+	s.Assert().ElementsMatch([]lockdebug.EdgeKind{lockdebug.HeldBy, lockdebug.WaitsFor}, kinds)
+
+	s.Assert().ErrorIs(<-done, filelock.ErrTimeout)
+	manifest, err := HeldBy(s.dir, os.Getpid())
+	s.Require().NoError(err)
+	s.Assert().Empty(manifest.Waiting)
+	s.Assert().Len(manifest.Locks, 1)
+}
+
+// TestHostLocks runs the test suite
+func TestHostLocks(t *testing.T) {
+	suite.Run(t, new(HostLocksTestSuite))
+}
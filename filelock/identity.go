@@ -0,0 +1,51 @@
+package filelock
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// FileID identifies a file independently of the paths leading to it: the device
+// and inode numbers on Unix, the volume serial number and file index on Windows.
+type FileID struct {
+	Device uint64
+	File   uint64
+}
+
+// IsZero reports whether the file is unknown.
+func (id FileID) IsZero() bool {
+	return id == FileID{}
+}
+
+// String returns the identifier as device:file.
+func (id FileID) String() string {
+	return fmt.Sprintf("%d:%d", id.Device, id.File)
+}
+
+// MarshalText encodes the identifier as its String form.
+func (id FileID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// CanonicalPath returns the absolute form of path with its symbolic links resolved,
+// lower-cased on Windows whose file systems ignore case, so that the different paths
+// of a lock file, such as "./a.lock" and "/abs/path/a.lock", give the same result.
+// The links of a lock file that does not exist yet are resolved in its directory.
+// When the path cannot be resolved it returns the absolute path, or path itself.
+func CanonicalPath(path string) string {
+	canonical, err := filepath.Abs(path)
+	if err != nil {
+		canonical = filepath.Clean(path)
+	}
+	if resolved, err := filepath.EvalSymlinks(canonical); err == nil {
+		canonical = resolved
+	} else if dir, err := filepath.EvalSymlinks(filepath.Dir(canonical)); err == nil {
+		canonical = filepath.Join(dir, filepath.Base(canonical))
+	}
+	if runtime.GOOS == "windows" {
+		canonical = strings.ToLower(canonical)
+	}
+	return canonical
+}
@@ -0,0 +1,33 @@
+package filelock
+
+// Profiler labels set on goroutines waiting for a lock, so that goroutine and
+// CPU profiles show which lock file they are waiting on and in which phase.
+// Uncontended acquisitions are not labelled.
+const (
+	// LabelPath is the pprof label holding the path of the awaited lock.
+	LabelPath = "filelock.path"
+
+	// LabelPhase is the pprof label holding the wait phase, PhaseQueued or PhaseBackoff.
+	LabelPhase = "filelock.phase"
+
+	// PhaseQueued is the wait phase of a goroutine waiting for another goroutine
+	// that is using the same lock instance.
+	PhaseQueued = "queued"
+
+	// PhaseBackoff is the wait phase of a goroutine polling a lock held by someone else.
+	PhaseBackoff = "backoff"
+)
+
+// Execution trace annotations, so go tool trace shows the waits for locks and the
+// periods they are held alongside goroutine scheduling. The wait phases of a
+// contended acquisition run in a region named RegionPrefix followed by the phase,
+// and a held lock is a task of type TaskHold, both logging the path with the key
+// LabelPath. A hold task ends on release, in whichever goroutine releases the lock.
+// Annotations cost nothing while the tracer is off.
+const (
+	// RegionPrefix prefixes the name of the trace regions of the wait phases.
+	RegionPrefix = "filelock."
+
+	// TaskHold is the type of the trace tasks spanning the hold periods.
+	TaskHold = "filelock.hold"
+)
@@ -0,0 +1,227 @@
+package lockdebug
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// NodeKind is the kind of a node of a Graph
+type NodeKind string
+
+const (
+	// ProcessNode is a process holding or waiting for locks
+	ProcessNode NodeKind = "process"
+
+	// LockNode is a lock file, identified by its canonical path
+	LockNode NodeKind = "lock"
+)
+
+// EdgeKind is the kind of an edge of a Graph
+type EdgeKind string
+
+const (
+	// HeldBy goes from a lock to the process holding it
+	HeldBy EdgeKind = "held_by"
+
+	// WaitsFor goes from a process to the lock it is acquiring
+	WaitsFor EdgeKind = "waits_for"
+)
+
+// Node is a process or a lock of a Graph
+type Node struct {
+	ID    string   `json:"id"`
+	Kind  NodeKind `json:"kind"`
+	Label string   `json:"label"`
+}
+
+// Edge is an ownership or wait-for relationship of a Graph
+type Edge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+// Graph is a resource allocation graph of locks: locks point to the processes
+// holding them, and processes point to the locks they wait for, so a cycle spanning
+// several processes is a deadlock. It encodes to JSON and to Graphviz DOT with
+// WriteDOT.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// ProcessGraph returns the graph of the active locks of this process, see Active.
+// Goroutines of the process are not told apart: a lock the process both holds and
+// waits for is contention between its goroutines.
+func ProcessGraph() Graph {
+	var g Graph
+	holder := filelock.CurrentHolder()
+	for _, status := range Active() {
+		switch status.State {
+		case filelock.Locked, filelock.Releasing:
+			g.Hold(holder, status.CanonicalPath)
+		case filelock.Acquiring:
+			g.Wait(holder, status.CanonicalPath)
+		}
+	}
+	return g
+}
+
+// Hold adds the lock file at the canonical path lock held by holder
+func (g *Graph) Hold(holder filelock.Holder, lock string) {
+	g.addEdge(Edge{From: g.addLock(lock), To: g.addProcess(holder), Kind: HeldBy})
+}
+
+// Wait adds the lock file at the canonical path lock being acquired by holder
+func (g *Graph) Wait(holder filelock.Holder, lock string) {
+	g.addEdge(Edge{From: g.addProcess(holder), To: g.addLock(lock), Kind: WaitsFor})
+}
+
+// addProcess adds the node of holder, if missing, and returns its ID
+func (g *Graph) addProcess(holder filelock.Holder) string {
+	id := "process:" + strconv.Itoa(holder.PID)
+	if holder.Hostname != "" {
+		id += "@" + holder.Hostname
+	}
+	g.addNode(Node{ID: id, Kind: ProcessNode, Label: holder.String()})
+	return id
+}
+
+// addLock adds the node of the lock file at the canonical path lock, if missing,
+// and returns its ID
+func (g *Graph) addLock(lock string) string {
+	id := "lock:" + lock
+	g.addNode(Node{ID: id, Kind: LockNode, Label: lock})
+	return id
+}
+
+func (g *Graph) addNode(n Node) {
+	for _, node := range g.Nodes {
+		if node.ID == n.ID {
+			return
+		}
+	}
+	g.Nodes = append(g.Nodes, n)
+}
+
+func (g *Graph) addEdge(e Edge) {
+	for _, edge := range g.Edges {
+		if edge == e {
+			return
+		}
+	}
+	g.Edges = append(g.Edges, e)
+}
+
+// Deadlocks returns the cycles of the graph spanning several processes, each as the
+// IDs of its nodes in order, starting with a process. A process waiting for a lock it
+// holds itself is not reported.
+func (g Graph) Deadlocks() [][]string {
+	next := make(map[string][]string)
+	for _, e := range g.Edges {
+		next[e.From] = append(next[e.From], e.To)
+	}
+	for _, targets := range next {
+		sort.Strings(targets)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var cycles [][]string
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = visiting
+		path = append(path, id)
+		for _, to := range next[id] {
+			switch state[to] {
+			case unvisited:
+				visit(to)
+			case visiting:
+				// Back edge, the cycle is the end of the path from to
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == to {
+						if cycle := g.processCycle(path[i:]); cycle != nil {
+							cycles = append(cycles, cycle)
+						}
+						break
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+	}
+
+	ids := make([]string, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return cycles
+}
+
+// processCycle returns cycle rotated to start with a process, or nil if it does not
+// span several processes
+func (g Graph) processCycle(cycle []string) []string {
+	start, processes := -1, 0
+	for i, id := range cycle {
+		if g.kind(id) == ProcessNode {
+			processes++
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if processes < 2 {
+		return nil
+	}
+	return append(append([]string{}, cycle[start:]...), cycle[:start]...)
+}
+
+func (g Graph) kind(id string) NodeKind {
+	for _, n := range g.Nodes {
+		if n.ID == id {
+			return n.Kind
+		}
+	}
+	return ""
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language, drawing processes as boxes,
+// locks as notes and waits as dashed edges
+func (g Graph) WriteDOT(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString("digraph locks {\n\trankdir=LR;\n")
+	for _, n := range g.Nodes {
+		shape := "note"
+		if n.Kind == ProcessNode {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "\t%s [shape=%s, label=%s];\n", strconv.Quote(n.ID), shape, strconv.Quote(n.Label))
+	}
+	for _, e := range g.Edges {
+		attrs := `label="held by"`
+		if e.Kind == WaitsFor {
+			attrs = `label="waits for", style=dashed`
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), attrs)
+	}
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
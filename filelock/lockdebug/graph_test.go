@@ -0,0 +1,81 @@
+package lockdebug
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// TestProcessGraph tests the graph of the held and waited for locks of the process
+func (s *LockDebugTestSuite) TestProcessGraph() {
+	lockPath := filepath.Join(s.tempDir, "graph.lock")
+	holder := fs.New(lockPath)
+	s.Require().NoError(holder.Lock())
+	defer holder.Unlock()
+
+	waiter := fs.New(lockPath)
+	done := make(chan struct{})
+	go func() {
+		_ = waiter.LockWithTimeout(300 * time.Millisecond)
+		close(done)
+	}()
+	defer func() { <-done }()
+
+	canonical := filelock.CanonicalPath(lockPath)
+	var g Graph
+	s.Require().Eventually(func() bool {
+		g = ProcessGraph()
+		return len(g.Edges) >= 2
+	}, 200*time.Millisecond, 5*time.Millisecond)
+
+	s.Assert().Contains(g.Nodes, Node{ID: "lock:" + canonical, Kind: LockNode, Label: canonical})
+	var kinds []EdgeKind
+	for _, e := range g.Edges {
+		if e.From == "lock:"+canonical || e.To == "lock:"+canonical {
+			kinds = append(kinds, e.Kind)
+		}
+	}
+	s.Assert().ElementsMatch([]EdgeKind{HeldBy, WaitsFor}, kinds)
+	s.Assert().Empty(g.Deadlocks(), "goroutines of a process waiting for each other are not a deadlock")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/locks?format=dot", nil))
+	s.Assert().Contains(rec.Header().Get("Content-Type"), "text/vnd.graphviz")
+	s.Assert().Contains(rec.Body.String(), "digraph locks {")
+	s.Assert().Contains(rec.Body.String(), `label="waits for", style=dashed`)
+
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/locks?format=graph", nil))
+	var decoded Graph
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &decoded))
+	s.Assert().NotEmpty(decoded.Edges)
+}
+
+// TestDeadlocks tests that a cycle between two processes is reported
+func (s *LockDebugTestSuite) TestDeadlocks() {
+	first := filelock.Holder{PID: 1, Hostname: "host"}
+	second := filelock.Holder{PID: 2, Hostname: "host"}
+	third := filelock.Holder{PID: 3, Hostname: "host"}
+
+	var g Graph
+	g.Hold(first, "/a.lock")
+	g.Wait(first, "/b.lock")
+	g.Hold(second, "/b.lock")
+	g.Wait(second, "/a.lock")
+	g.Wait(third, "/a.lock")
+
+	s.Assert().Equal([][]string{
+		{"process:1@host", "lock:/b.lock", "process:2@host", "lock:/a.lock"},
+	}, g.Deadlocks())
+
+	var dot bytes.Buffer
+	s.Require().NoError(g.WriteDOT(&dot))
+	s.Assert().Contains(dot.String(), `"lock:/a.lock" -> "process:1@host" [label="held by"];`)
+	s.Assert().Contains(dot.String(), `"process:3@host" [shape=box, label="pid 3@host"];`)
+}
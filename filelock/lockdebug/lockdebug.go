@@ -0,0 +1,125 @@
+// Package lockdebug serves the locks of the current process over HTTP, in the
+// spirit of expvar and net/http/pprof, to help diagnose hangs in production.
+//
+// Only locks created by this module are reported, and only while they are held
+// or being acquired. The handler is not registered anywhere by default:
+//
+//	http.Handle("/debug/locks", lockdebug.Handler())
+//
+// The handler responds with JSON, or with an HTML table when the request has
+// the query parameter format=html or prefers text/html. With format=graph and
+// format=dot, it responds with the ProcessGraph of the locks in JSON or in
+// Graphviz DOT.
+package lockdebug
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/registry"
+)
+
+// Active returns the status of every lock of this process that is held or being
+// acquired, sorted by canonical path so that the locks of the same file, created
+// with different paths, are next to each other.
+func Active() []filelock.Status {
+	return registry.Snapshot()
+}
+
+// Find returns the status of the active locks of this process on the file at path,
+// whichever path they were created with, see filelock.Status.SameLock.
+func Find(path string) []filelock.Status {
+	active := Active()
+
+	// The locks of path tell its identifier, shared by the locks of its other
+	// paths, such as hard links
+	target := filelock.Status{CanonicalPath: filelock.CanonicalPath(path)}
+	for _, status := range active {
+		if status.CanonicalPath == target.CanonicalPath && !status.FileID.IsZero() {
+			target.FileID = status.FileID
+			break
+		}
+	}
+
+	var found []filelock.Status
+	for _, status := range active {
+		if status.SameLock(target) {
+			found = append(found, status)
+		}
+	}
+	return found
+}
+
+// Handler returns an http.Handler listing the active locks of this process.
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+type response struct {
+	Locks []filelock.Status `json:"locks"`
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("format") {
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		_ = ProcessGraph().WriteDOT(w)
+		return
+	case "graph":
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(ProcessGraph())
+		return
+	}
+
+	locks := Active()
+
+	if wantsHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = page.Execute(w, locks)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(response{Locks: locks})
+}
+
+func wantsHTML(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "html":
+		return true
+	case "json":
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+var page = template.Must(template.New("locks").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Active file locks</title></head>
+<body>
+<h1>Active file locks</h1>
+<table border="1" cellpadding="4">
+<tr><th>Path</th><th>Canonical path</th><th>File ID</th><th>State</th><th>Holder</th><th>Held for</th><th>Waiters</th><th>Last attempts</th><th>Last wait</th></tr>
+{{range .}}<tr>
+<td>{{.Path}}</td>
+<td>{{.CanonicalPath}}</td>
+<td>{{if not .FileID.IsZero}}{{.FileID}}{{end}}</td>
+<td>{{.State}}</td>
+<td>{{with .Holder}}{{.}}{{end}}</td>
+<td>{{if .HeldFor}}{{.HeldFor}}{{end}}</td>
+<td>{{.Waiters}}</td>
+<td>{{.LastAcquire.Attempts}}</td>
+<td>{{.LastAcquire.Waited}}</td>
+</tr>
+{{else}}<tr><td colspan="9">No active locks</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
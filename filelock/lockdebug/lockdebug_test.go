@@ -0,0 +1,147 @@
+package lockdebug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// LockDebugTestSuite defines a test suite for the debug handler
+type LockDebugTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *LockDebugTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "lockdebug-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *LockDebugTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// activePaths returns the paths served by the handler in JSON form
+func (s *LockDebugTestSuite) activePaths() map[string]string {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/locks", nil))
+	s.Require().Equal(http.StatusOK, rec.Code)
+
+	var body struct {
+		Locks []struct {
+			Path  string `json:"path"`
+			State string `json:"state"`
+		} `json:"locks"`
+	}
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &body))
+
+	paths := make(map[string]string)
+	for _, l := range body.Locks {
+		paths[l.Path] = l.State
+	}
+	return paths
+}
+
+// TestHeldLocksAreListed tests that held locks appear and released ones disappear
+func (s *LockDebugTestSuite) TestHeldLocksAreListed() {
+	lockPath := filepath.Join(s.tempDir, "held.lock")
+	lock := fs.New(lockPath)
+
+	s.Assert().NotContains(s.activePaths(), lockPath)
+
+	s.Require().NoError(lock.Lock())
+	s.Assert().Equal("locked", s.activePaths()[lockPath])
+
+	s.Require().NoError(lock.Unlock())
+	s.Assert().NotContains(s.activePaths(), lockPath)
+}
+
+// TestWaitingLocksAreListed tests that an in-flight acquisition is reported without blocking
+func (s *LockDebugTestSuite) TestWaitingLocksAreListed() {
+	lockPath := filepath.Join(s.tempDir, "waiting.lock")
+	holder := fs.New(lockPath)
+	s.Require().NoError(holder.Lock())
+	defer holder.Unlock()
+
+	waiter := fs.New(lockPath)
+	done := make(chan struct{})
+	go func() {
+		_ = waiter.LockWithTimeout(300 * time.Millisecond)
+		close(done)
+	}()
+
+	s.Assert().Eventually(func() bool {
+		for _, status := range Active() {
+			if status.Path == lockPath && status.Waiters == 1 {
+				return true
+			}
+		}
+		return false
+	}, 200*time.Millisecond, 5*time.Millisecond)
+
+	<-done
+}
+
+// TestHTML tests the HTML rendering
+func (s *LockDebugTestSuite) TestHTML() {
+	lockPath := filepath.Join(s.tempDir, "html.lock")
+	lock := fs.New(lockPath)
+	s.Require().NoError(lock.Lock())
+	defer lock.Unlock()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/locks?format=html", nil))
+	s.Assert().Contains(rec.Header().Get("Content-Type"), "text/html")
+	s.Assert().Contains(rec.Body.String(), lockPath)
+}
+
+// TestFindAcrossPaths tests that the locks of a file are found whichever path they were created with
+func (s *LockDebugTestSuite) TestFindAcrossPaths() {
+	lockPath := filepath.Join(s.tempDir, "same.lock")
+	linkDir := filepath.Join(s.tempDir, "link")
+	s.Require().NoError(os.Symlink(s.tempDir, linkDir))
+	hardLink := filepath.Join(s.tempDir, "hard.lock")
+
+	direct := fs.New(lockPath, filelock.WithShared())
+	s.Require().NoError(direct.Lock())
+	defer direct.Unlock()
+	s.Require().NoError(os.Link(lockPath, hardLink))
+
+	viaLink := fs.New(filepath.Join(linkDir, "same.lock"), filelock.WithShared())
+	s.Require().NoError(viaLink.Lock())
+	defer viaLink.Unlock()
+	viaHardLink := fs.New(hardLink, filelock.WithShared())
+	s.Require().NoError(viaHardLink.Lock())
+	defer viaHardLink.Unlock()
+	other := fs.New(filepath.Join(s.tempDir, "other.lock"))
+	s.Require().NoError(other.Lock())
+	defer other.Unlock()
+
+	s.Assert().Equal(direct.Status().CanonicalPath, viaLink.Status().CanonicalPath)
+	s.Assert().True(direct.Status().SameLock(viaHardLink.Status()))
+	s.Assert().False(direct.Status().SameLock(other.Status()))
+
+	found := Find(filepath.Join(linkDir, ".", "same.lock"))
+	paths := make([]string, 0, len(found))
+	for _, status := range found {
+		paths = append(paths, status.Path)
+	}
+	s.Assert().ElementsMatch([]string{lockPath, filepath.Join(linkDir, "same.lock"), hardLink}, paths)
+}
+
+// TestLockDebug runs the test suite
+func TestLockDebug(t *testing.T) {
+	suite.Run(t, new(LockDebugTestSuite))
+}
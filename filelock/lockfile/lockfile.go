@@ -0,0 +1,228 @@
+// Package lockfile provides thread-safe locking in non-blocking mode using the
+// lock-file protocol: a lock is held by atomically creating the lock file, and
+// released by removing it.
+//
+// The protocol only needs a file system supporting exclusive creation
+// (O_CREATE|O_EXCL), so it runs on any FS implementation: the OS file system,
+// the in-memory MemFS in tests, or a custom storage layer such as an afero.Fs
+// wrapped in a small adapter.
+//
+// The lock file is not removed when the holder crashes, so a crashed holder
+// leaves a stale lock behind that must be removed by hand. Locks are always
+// exclusive, even when created with filelock.WithShared.
+package lockfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/lockcore"
+)
+
+// File is the writable file returned by FS.OpenFile
+type File interface {
+	io.Writer
+	io.Closer
+}
+
+// FS is the minimal writable file system used by the lock-file protocol
+type FS interface {
+	// OpenFile opens the named file like os.OpenFile. With os.O_CREATE|os.O_EXCL
+	// the creation must be atomic and fail with an error matching fs.ErrExist if
+	// the file exists.
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+
+	// Remove removes the named file like os.Remove
+	Remove(name string) error
+}
+
+// OS is the FS of the operating system
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// FileLock represents a lock held by the existence of a lock file
+type FileLock struct {
+	core *lockcore.Lock
+}
+
+// New creates a new FileLock for the specified path on the OS file system
+func New(path string, opts ...filelock.Option) *FileLock {
+	return NewFS(OS, path, opts...)
+}
+
+// NewFS creates a new FileLock for the specified path on fsys
+func NewFS(fsys FS, path string, opts ...filelock.Option) *FileLock {
+	return &FileLock{
+		core: lockcore.New(path, &createDriver{fsys: fsys}, filelock.NewOptions(opts...)),
+	}
+}
+
+// Lock acquires the lock
+// If the lock cannot be acquired immediately, it returns ErrLockHeld
+func (fl *FileLock) Lock() error {
+	return fl.LockWithTimeout(0)
+}
+
+// LockWithTimeout attempts to acquire the lock with a timeout
+// If timeout is <= 0, it's a non-blocking operation
+// If timeout is > 0, it will retry in a non-blocking manner until the timeout is reached
+func (fl *FileLock) LockWithTimeout(timeout time.Duration) error {
+	return fl.core.LockWithTimeout(timeout)
+}
+
+// Unlock releases the lock by removing the lock file
+// If the lock is not held, it returns ErrNotLocked, or nil when created with
+// filelock.WithIdempotentUnlock
+// If the lock file was removed by someone else meanwhile, it returns an error
+// wrapping ErrLockLost
+func (fl *FileLock) Unlock() error {
+	return fl.core.Unlock()
+}
+
+// UnlockWithTimeout releases the lock like Unlock, giving up after timeout when the
+// release hangs, on a stuck network file system for example: the lock is forgotten,
+// its descriptor abandoned, and an error wrapping filelock.ErrAbandoned is returned
+// ContextLock().Unlock(ctx) gives up the same way when ctx is done
+func (fl *FileLock) UnlockWithTimeout(timeout time.Duration) error {
+	return fl.core.UnlockWithTimeout(timeout)
+}
+
+// Abort interrupts the acquisitions in progress on this instance, including the
+// ones waiting for another operation on it, which return filelock.ErrAborted
+// Later acquisitions are not affected and a held lock stays held
+func (fl *FileLock) Abort() {
+	fl.core.Abort()
+}
+
+// IsLocked returns whether the lock is currently held by this instance
+func (fl *FileLock) IsLocked() bool {
+	return fl.core.IsLocked()
+}
+
+// Path returns the path of the lock file
+func (fl *FileLock) Path() string {
+	return fl.core.Path()
+}
+
+// AcquiredAt returns when the lock was acquired, or the zero time if it is not held
+func (fl *FileLock) AcquiredAt() time.Time {
+	return fl.core.AcquiredAt()
+}
+
+// HeldDuration returns how long the lock has been held, or 0 if it is not held
+func (fl *FileLock) HeldDuration() time.Duration {
+	return fl.core.HeldDuration()
+}
+
+// LastAcquireStats returns the number of attempts and the time spent by the most
+// recent acquisition, whether it succeeded or not
+func (fl *FileLock) LastAcquireStats() filelock.AcquireStats {
+	return fl.core.LastAcquireStats()
+}
+
+// Status returns a snapshot of the lock state, including holder and acquisition statistics
+func (fl *FileLock) Status() filelock.Status {
+	return fl.core.Status()
+}
+
+// LockFunc acquires the lock, retrying until ctx is done, and returns the function
+// releasing it, see filelock.LockFunc
+func (fl *FileLock) LockFunc(ctx context.Context) (release func() error, err error) {
+	return filelock.LockFunc(ctx, fl)
+}
+
+// ContextLock returns a view of the lock whose operations take a context
+func (fl *FileLock) ContextLock() filelock.ContextLock {
+	return fl.core.ContextLock()
+}
+
+// Yield releases the lock and acquires it again after the waiters of this process,
+// if it has been held for longer than the slice of filelock.WithYield
+// It reports whether the lock was released, see filelock.Yielder
+func (fl *FileLock) Yield(ctx context.Context) (bool, error) {
+	return fl.core.Yield(ctx)
+}
+
+// String describes the lock and its current state
+func (fl *FileLock) String() string {
+	return fl.Status().String()
+}
+
+// MarshalJSON encodes the current status of the lock
+func (fl *FileLock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fl.Status())
+}
+
+// createDriver locks by exclusively creating the lock file
+type createDriver struct {
+	fsys FS
+	path string
+}
+
+func (d *createDriver) Open(path string) error {
+	d.path = path
+	return nil
+}
+
+func (d *createDriver) TryLock() error {
+	file, err := d.fsys.OpenFile(d.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return filelock.ErrLockHeld
+	}
+	if err != nil {
+		return mapError(err)
+	}
+
+	// The content only informs whoever finds the file, the lock is already held
+	holder, _ := json.Marshal(filelock.CurrentHolder())
+	_, err = file.Write(append(holder, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = d.fsys.Remove(d.path)
+		return mapError(err)
+	}
+	return nil
+}
+
+func (d *createDriver) Unlock() error {
+	err := d.fsys.Remove(d.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: lock file %s was removed", filelock.ErrLockLost, d.path)
+	}
+	return mapError(err)
+}
+
+func (d *createDriver) Close() error {
+	return nil
+}
+
+// mapError translates the errors callers may want to branch on into the
+// filelock errors, keeping the original error in the chain
+func mapError(err error) error {
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("%w: %w", filelock.ErrPermission, err)
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/conformance"
+	"github.com/rsgcata/go-fs/filelock/testutil"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// LockFileTestSuite defines a test suite for the lock-file protocol FileLock
+type LockFileTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *LockFileTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "lockfile-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *LockFileTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestBasicLockAndUnlock tests that the lock file exists exactly while the lock is held
+func (s *LockFileTestSuite) TestBasicLockAndUnlock() {
+	lockPath := filepath.Join(s.tempDir, "basic.lock")
+	lock := New(lockPath)
+
+	s.Require().NoError(lock.Lock())
+	s.Assert().True(lock.IsLocked())
+	s.Assert().Equal(filelock.ErrAlreadyLocked, lock.Lock())
+
+	data, err := os.ReadFile(lockPath)
+	s.Require().NoError(err)
+	var holder filelock.Holder
+	s.Require().NoError(json.Unmarshal(data, &holder))
+	s.Assert().Equal(filelock.CurrentHolder(), holder)
+
+	s.Require().NoError(lock.Unlock())
+	s.Assert().False(lock.IsLocked())
+	s.Assert().NoFileExists(lockPath)
+	s.Assert().Equal(filelock.ErrNotLocked, lock.Unlock())
+}
+
+// TestContention tests that a second instance cannot take a held lock
+func (s *LockFileTestSuite) TestContention() {
+	lockPath := filepath.Join(s.tempDir, "contended.lock")
+
+	lock1 := New(lockPath)
+	s.Require().NoError(lock1.Lock())
+
+	lock2 := New(lockPath)
+	s.Assert().Equal(filelock.ErrLockHeld, lock2.Lock())
+	s.Assert().Equal(filelock.ErrTimeout, lock2.LockWithTimeout(50*time.Millisecond))
+
+	s.Require().NoError(lock1.Unlock())
+	s.Require().NoError(lock2.Lock())
+	s.Require().NoError(lock2.Unlock())
+}
+
+// TestMissingDirectory tests that errors other than contention are returned as is
+func (s *LockFileTestSuite) TestMissingDirectory() {
+	lock := New(filepath.Join(s.tempDir, "missing", "dir.lock"))
+	err := lock.LockWithTimeout(50 * time.Millisecond)
+	s.Assert().ErrorIs(err, fs.ErrNotExist)
+	s.Assert().False(lock.IsLocked())
+}
+
+// TestMemFS tests the protocol against the in-memory file system
+func (s *LockFileTestSuite) TestMemFS() {
+	fsys := NewMemFS()
+	lock1, lock2 := NewFS(fsys, "jobs/report.lock"), NewFS(fsys, "jobs/report.lock")
+
+	s.Require().NoError(lock1.Lock())
+	s.Assert().Equal([]string{"jobs/report.lock"}, fsys.Names())
+	s.Assert().Equal(filelock.ErrLockHeld, lock2.Lock())
+
+	s.Require().NoError(lock1.Unlock())
+	s.Assert().Empty(fsys.Names())
+	s.Require().NoError(lock2.Lock())
+	s.Require().NoError(lock2.Unlock())
+}
+
+// TestLockLost tests that Unlock reports a lock file removed by someone else
+func (s *LockFileTestSuite) TestLockLost() {
+	fsys := NewMemFS()
+	lock := NewFS(fsys, "lost.lock")
+	s.Require().NoError(lock.Lock())
+
+	s.Require().NoError(fsys.Remove("lost.lock"))
+	s.Assert().ErrorIs(lock.Unlock(), filelock.ErrLockLost)
+	s.Assert().False(lock.IsLocked())
+}
+
+// TestFailedWriteReleases tests that a lock file whose content cannot be written is removed
+func (s *LockFileTestSuite) TestFailedWriteReleases() {
+	fsys := &failingFS{MemFS: NewMemFS()}
+	lock := NewFS(fsys, "failing.lock")
+
+	s.Assert().ErrorIs(lock.Lock(), errWrite)
+	s.Assert().Empty(fsys.Names())
+}
+
+// TestMutualExclusion tests that concurrent holders never overlap on a MemFS
+func (s *LockFileTestSuite) TestMutualExclusion() {
+	fsys := NewMemFS()
+	counter := 0
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				lock := NewFS(fsys, "counter.lock")
+				s.Require().NoError(lock.LockWithTimeout(5 * time.Second))
+				counter++
+				s.Require().NoError(lock.Unlock())
+			}
+		}()
+	}
+	wg.Wait()
+	s.Assert().Equal(160, counter)
+}
+
+// TestCrossProcessStress tests mutual exclusion between real processes
+func (s *LockFileTestSuite) TestCrossProcessStress() {
+	testutil.Stress(s.T(), func(path string) filelock.FileLock {
+		return New(path)
+	}, testutil.StressConfig{})
+}
+
+// TestConformance runs the conformance checks shared by all the backends, on the
+// operating system and in memory
+func (s *LockFileTestSuite) TestConformance() {
+	conformance.Run(s.T(), func(path string, opts ...filelock.Option) filelock.FileLock {
+		return New(path, opts...)
+	}, conformance.Config{})
+
+	memFS := NewMemFS()
+	conformance.Run(s.T(), func(path string, opts ...filelock.Option) filelock.FileLock {
+		return NewFS(memFS, path, opts...)
+	}, conformance.Config{})
+}
+
+// TestLockFile runs the test suite
+func TestLockFile(t *testing.T) {
+	suite.Run(t, new(LockFileTestSuite))
+}
+
+var errWrite = errors.New("write failed")
+
+// failingFS is a MemFS whose files cannot be written
+type failingFS struct {
+	*MemFS
+}
+
+func (f *failingFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := f.MemFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return failingFile{file}, nil
+}
+
+type failingFile struct {
+	File
+}
+
+func (failingFile) Write([]byte) (int, error) {
+	return 0, errWrite
+}
@@ -0,0 +1,120 @@
+package lockfile
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+)
+
+// MemFS is an in-memory FS, safe for concurrent use
+// Names are plain keys: there are no directories, and "a/b" and "a//b" are
+// different files. It is meant for tests.
+type MemFS struct {
+	mutex sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemFS creates an empty MemFS
+func NewMemFS() *MemFS {
+	return &MemFS{files: map[string][]byte{}}
+}
+
+// OpenFile opens the named file for writing, honoring os.O_CREATE, os.O_EXCL,
+// os.O_TRUNC and os.O_APPEND. The permission bits are ignored.
+func (m *MemFS) OpenFile(name string, flag int, _ os.FileMode) (File, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, exists := m.files[name]
+	switch {
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !exists || flag&os.O_TRUNC != 0:
+		data = nil
+	}
+	m.files[name] = data
+
+	file := &memFile{fsys: m, name: name}
+	if flag&os.O_APPEND != 0 {
+		file.offset = len(data)
+	}
+	return file, nil
+}
+
+// Remove removes the named file
+func (m *MemFS) Remove(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.files[name]; !exists {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// ReadFile returns a copy of the content of the named file
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, exists := m.files[name]
+	if !exists {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(data), nil
+}
+
+// Names returns the names of the files, sorted
+func (m *MemFS) Names() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// memFile writes to a file of a MemFS
+// Writes to a file that was removed meanwhile are discarded, like writes to an
+// unlinked file on disk.
+type memFile struct {
+	fsys   *MemFS
+	name   string
+	offset int
+	closed bool
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	f.fsys.mutex.Lock()
+	defer f.fsys.mutex.Unlock()
+
+	if data, exists := f.fsys.files[f.name]; exists {
+		if end := f.offset + len(p); end > len(data) {
+			data = append(data, make([]byte, end-len(data))...)
+		}
+		copy(data[f.offset:], p)
+		f.fsys.files[f.name] = data
+	}
+	f.offset += len(p)
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
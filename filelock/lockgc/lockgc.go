@@ -0,0 +1,281 @@
+// Package lockgc removes the stale lock files of a lock directory.
+//
+// Keyed lock managers (per-file claims, per-message queue locks, tree locks)
+// create one lock file per key and never remove them, since removing a lock
+// file while it may be locked is racy. Collect removes the lock files that are
+// not held by any process: each one is locked without waiting first, so lock
+// files of live holders, including holders that are only waiting for their
+// lock, are left alone. Lock files whose holder died are released by the system
+// and are collected.
+//
+// Processes that opened a lock file just before it was collected detect it
+// after locking and lock the new file at the same path instead.
+//
+// Only the files whose content the flock helpers write, nothing, a holder record
+// or the PID line of filelock.WithPIDFormat, are collected. Other files matching
+// the pattern, such as files being written by atomicfile.NewLocked, are kept:
+// for other locking schemes, where the existence of the file is the lock, being
+// unlocked does not make a file stale. A lock file holding the PID of a running
+// process is never removed, since it may be a dotlock. Lock directories of
+// dotlocks are collected with Options.Dotlock.
+package lockgc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	gofs "github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/dotlock"
+)
+
+// DefaultPattern matches the lock files of the helpers of this module
+const DefaultPattern = "*" + gofs.LockSuffix
+
+// Options configures a collection
+type Options struct {
+	// Pattern selects the lock files by base name, as filepath.Match does.
+	// DefaultPattern is used when it is empty.
+	Pattern string
+
+	// MinAge keeps the lock files modified more recently than MinAge, to avoid
+	// churning the lock files of keys that are used often.
+	MinAge time.Duration
+
+	// Recursive also scans the subdirectories.
+	Recursive bool
+
+	// DryRun reports the lock files that would be removed without removing them.
+	DryRun bool
+
+	// Dotlock collects the dotlocks of the dotlock package and of liblockfile
+	// instead of the lock files of the flock helpers: a file is removed only when
+	// dotlock.Stale reports it stale.
+	Dotlock bool
+}
+
+// Report describes the outcome of a collection
+type Report struct {
+	// Scanned is the number of lock files matching the pattern.
+	Scanned int
+
+	// Removed lists the lock files removed, or that would be removed in dry-run mode.
+	Removed []string
+
+	// Held lists the lock files held by a live process.
+	Held []string
+
+	// Recent lists the lock files kept because they are younger than MinAge.
+	Recent []string
+
+	// Foreign lists the files kept because they are not lock files of the flock
+	// helpers.
+	Foreign []string
+
+	// Errors lists the lock files that could not be checked or removed.
+	Errors []error
+}
+
+// String summarizes the report in one line
+func (r Report) String() string {
+	summary := fmt.Sprintf(
+		"scanned %d, removed %d, held %d, recent %d, errors %d",
+		r.Scanned, len(r.Removed), len(r.Held), len(r.Recent), len(r.Errors),
+	)
+	if len(r.Foreign) > 0 {
+		summary += fmt.Sprintf(", foreign %d", len(r.Foreign))
+	}
+	return summary
+}
+
+// Collect removes the stale lock files of dir. The returned error is only about
+// scanning dir, errors about single lock files are listed in the report.
+func Collect(dir string, opts Options) (Report, error) {
+	pattern := opts.Pattern
+	if pattern == "" {
+		pattern = DefaultPattern
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return Report{}, err
+	}
+
+	var report Report
+	now := time.Now()
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && !opts.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matched, _ := filepath.Match(pattern, entry.Name()); !matched || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		report.Scanned++
+		info, err := entry.Info()
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// Removed meanwhile
+		case err != nil:
+			report.Errors = append(report.Errors, err)
+		case now.Sub(info.ModTime()) < opts.MinAge:
+			report.Recent = append(report.Recent, path)
+		case opts.Dotlock:
+			collectDotlock(path, opts.DryRun, &report)
+		default:
+			collect(path, info, opts.DryRun, &report)
+		}
+		return nil
+	})
+	return report, err
+}
+
+// maxContent is the size above which a file is not a lock file of the flock
+// helpers
+const maxContent = 1 << 20
+
+// lockFileKind is how a file matching the pattern was recognised
+type lockFileKind int
+
+const (
+	// flockFile is a lock file of the flock helpers
+	flockFile lockFileKind = iota
+
+	// pidFile holds a PID line, a lock file of WithPIDFormat or a dotlock
+	pidFile
+
+	// foreignFile is not a lock file of the flock helpers
+	foreignFile
+)
+
+// recognize returns the kind of the file at path from its content
+func recognize(path string) (lockFileKind, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return foreignFile, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxContent+1))
+	switch {
+	case err != nil:
+		return foreignFile, err
+	case len(data) == 0:
+		return flockFile, nil
+	case len(data) > maxContent:
+		return foreignFile, nil
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid > 0 {
+		return pidFile, nil
+	}
+
+	var record filelock.HolderRecord
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if decoder.Decode(&record) == nil && record.PID > 0 && !record.AcquiredAt.IsZero() {
+		return flockFile, nil
+	}
+	return foreignFile, nil
+}
+
+// collect removes the lock file at path, described by info, if it is a lock file
+// of the flock helpers that no process holds
+func collect(path string, info fs.FileInfo, dryRun bool, report *Report) {
+	kind, err := recognize(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			report.Errors = append(report.Errors, err)
+		}
+		return
+	}
+	switch kind {
+	case foreignFile:
+		report.Foreign = append(report.Foreign, path)
+		return
+	case pidFile:
+		// The PID of a crashed WithPIDFormat holder, or of a dotlock holder
+		// whose lock is the existence of the file
+		stale, err := dotlock.Stale(path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				report.Errors = append(report.Errors, err)
+			}
+			return
+		}
+		if !stale {
+			report.Held = append(report.Held, path)
+			return
+		}
+	}
+
+	lock := gofs.New(path)
+	if err := lock.LockWithTimeout(0); err != nil {
+		if errors.Is(err, filelock.ErrLockHeld) {
+			report.Held = append(report.Held, path)
+		} else {
+			report.Errors = append(report.Errors, err)
+		}
+		return
+	}
+	if current, err := os.Stat(path); err != nil || !os.SameFile(info, current) ||
+		!current.ModTime().Equal(info.ModTime()) {
+		// Replaced by a new lock file since it was recognised
+		_ = lock.Unlock()
+		report.Held = append(report.Held, path)
+		return
+	}
+
+	if dryRun {
+		_ = lock.Unlock()
+		report.Removed = append(report.Removed, path)
+		return
+	}
+
+	// Remove while holding the lock where possible (Unix); where open files
+	// cannot be removed (Windows), remove right after releasing it, which fails
+	// if another process opened the file meanwhile
+	err = os.Remove(path)
+	_ = lock.Unlock()
+	if err != nil {
+		err = os.Remove(path)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		report.Errors = append(report.Errors, err)
+		return
+	}
+	report.Removed = append(report.Removed, path)
+}
+
+// collectDotlock removes the dotlock at path if it is stale
+func collectDotlock(path string, dryRun bool, report *Report) {
+	var stale bool
+	var err error
+	if dryRun {
+		stale, err = dotlock.Stale(path)
+	} else {
+		stale, err = dotlock.RemoveStale(path)
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// Released meanwhile
+	case err != nil:
+		report.Errors = append(report.Errors, err)
+	case stale:
+		report.Removed = append(report.Removed, path)
+	default:
+		report.Held = append(report.Held, path)
+	}
+}
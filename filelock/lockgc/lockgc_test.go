@@ -0,0 +1,173 @@
+package lockgc
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/dotlock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// LockGCTestSuite defines a test suite for the lock garbage collector
+type LockGCTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *LockGCTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "lockgc-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *LockGCTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *LockGCTestSuite) createFiles(names ...string) {
+	for _, name := range names {
+		path := filepath.Join(s.tempDir, name)
+		s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0777))
+		s.Require().NoError(os.WriteFile(path, nil, 0644))
+	}
+}
+
+// TestCollect tests that only the lock files without holder are removed
+func (s *LockGCTestSuite) TestCollect() {
+	s.createFiles("idle.lock", "data.json", "sub/nested.lock")
+	held := fs.New(filepath.Join(s.tempDir, "held.lock"))
+	s.Require().NoError(held.Lock())
+	defer held.Unlock()
+
+	report, err := Collect(s.tempDir, Options{})
+	s.Require().NoError(err)
+	s.Assert().Equal(2, report.Scanned)
+	s.Assert().Equal([]string{filepath.Join(s.tempDir, "idle.lock")}, report.Removed)
+	s.Assert().Equal([]string{held.Path()}, report.Held)
+	s.Assert().Empty(report.Errors)
+
+	s.Assert().NoFileExists(filepath.Join(s.tempDir, "idle.lock"))
+	s.Assert().FileExists(filepath.Join(s.tempDir, "data.json"))
+	s.Assert().FileExists(filepath.Join(s.tempDir, "sub", "nested.lock"))
+	s.Assert().FileExists(held.Path())
+}
+
+// TestRecursiveAndPattern tests the recursive scan with a custom pattern
+func (s *LockGCTestSuite) TestRecursiveAndPattern() {
+	s.createFiles("a.claim", "sub/b.claim", "sub/c.lock")
+
+	report, err := Collect(s.tempDir, Options{Pattern: "*.claim", Recursive: true})
+	s.Require().NoError(err)
+	s.Assert().ElementsMatch([]string{
+		filepath.Join(s.tempDir, "a.claim"),
+		filepath.Join(s.tempDir, "sub", "b.claim"),
+	}, report.Removed)
+	s.Assert().FileExists(filepath.Join(s.tempDir, "sub", "c.lock"))
+}
+
+// TestDryRun tests that nothing is removed in dry-run mode
+func (s *LockGCTestSuite) TestDryRun() {
+	s.createFiles("idle.lock")
+
+	report, err := Collect(s.tempDir, Options{DryRun: true})
+	s.Require().NoError(err)
+	s.Assert().Len(report.Removed, 1)
+	s.Assert().FileExists(filepath.Join(s.tempDir, "idle.lock"))
+}
+
+// TestMinAge tests that recently used lock files are kept
+func (s *LockGCTestSuite) TestMinAge() {
+	s.createFiles("recent.lock", "old.lock")
+	old := time.Now().Add(-2 * time.Hour)
+	s.Require().NoError(os.Chtimes(filepath.Join(s.tempDir, "old.lock"), old, old))
+
+	report, err := Collect(s.tempDir, Options{MinAge: time.Hour})
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{filepath.Join(s.tempDir, "old.lock")}, report.Removed)
+	s.Assert().Equal([]string{filepath.Join(s.tempDir, "recent.lock")}, report.Recent)
+	s.Assert().Equal("scanned 2, removed 1, held 0, recent 1, errors 0", report.String())
+}
+
+// deadPID returns the PID of a process that exited
+func (s *LockGCTestSuite) deadPID() int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	s.Require().NoError(cmd.Run())
+	return cmd.Process.Pid
+}
+
+// TestForeign tests that files the flock helpers do not write are kept
+func (s *LockGCTestSuite) TestForeign() {
+	path := filepath.Join(s.tempDir, "index.lock")
+	s.Require().NoError(os.WriteFile(path, []byte("A-partial"), 0644))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.tempDir, "config.lock"), []byte(`{"pid":0}`), 0644))
+
+	report, err := Collect(s.tempDir, Options{})
+	s.Require().NoError(err)
+	s.Assert().Empty(report.Removed)
+	s.Assert().Len(report.Foreign, 2)
+	s.Assert().FileExists(path)
+	s.Assert().Equal("scanned 2, removed 0, held 0, recent 0, errors 0, foreign 2", report.String())
+}
+
+// TestHolderContent tests that lock files holding a holder record or the PID of
+// an exited holder are collected, and that the ones holding the PID of a running
+// process are kept
+func (s *LockGCTestSuite) TestHolderContent() {
+	payload := fs.New(filepath.Join(s.tempDir, "payload.lock"), filelock.WithPayload([]byte("job 42"), false))
+	s.Require().NoError(payload.Lock())
+	s.Require().NoError(payload.Unlock())
+	if runtime.GOOS != "windows" {
+		content, err := os.ReadFile(payload.Path())
+		s.Require().NoError(err)
+		s.Require().NotEmpty(content, "the payload is left in the lock file")
+	}
+
+	dead := filepath.Join(s.tempDir, "dead.lock")
+	s.Require().NoError(os.WriteFile(dead, []byte(strconv.Itoa(s.deadPID())+"\n"), 0644))
+	alive := filepath.Join(s.tempDir, "alive.lock")
+	s.Require().NoError(os.WriteFile(alive, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644))
+
+	report, err := Collect(s.tempDir, Options{})
+	s.Require().NoError(err)
+	s.Assert().ElementsMatch([]string{payload.Path(), dead}, report.Removed)
+	s.Assert().Equal([]string{alive}, report.Held, "it may be a dotlock")
+	s.Assert().FileExists(alive)
+}
+
+// TestDotlock tests that dotlocks are removed only when stale
+func (s *LockGCTestSuite) TestDotlock() {
+	held := dotlock.New(filepath.Join(s.tempDir, "held.lock"))
+	s.Require().NoError(held.Lock())
+	defer held.Unlock()
+	dead := filepath.Join(s.tempDir, "dead.lock")
+	s.Require().NoError(os.WriteFile(dead, []byte(strconv.Itoa(s.deadPID())+"\n"), 0644))
+	s.createFiles("fresh.lock")
+
+	report, err := Collect(s.tempDir, Options{Dotlock: true, DryRun: true})
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{dead}, report.Removed)
+	s.Assert().FileExists(dead)
+
+	report, err = Collect(s.tempDir, Options{Dotlock: true})
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{dead}, report.Removed)
+	s.Assert().ElementsMatch([]string{held.Path(), filepath.Join(s.tempDir, "fresh.lock")}, report.Held)
+	s.Assert().NoFileExists(dead)
+	s.Assert().FileExists(held.Path())
+	s.Assert().True(held.IsLocked())
+}
+
+// TestLockGC runs the test suite
+func TestLockGC(t *testing.T) {
+	suite.Run(t, new(LockGCTestSuite))
+}
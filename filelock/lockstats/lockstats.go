@@ -0,0 +1,265 @@
+// Package lockstats persists a record of every acquisition of locks, with its wait
+// time, hold time, result and holder, to a JSON lines file with rotation, and
+// summarizes them, for post-mortem analysis of contention when live metrics were
+// not scraped.
+//
+//	stats, err := lockstats.Open("/var/log/myapp/locks.jsonl", lockstats.Rotation{
+//		MaxSize: 10 << 20,
+//		Policy:  appendlog.Policy{MaxCount: 5, Compress: true},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer stats.Close()
+//
+//	lock := fs.New(path, stats.Option())
+//
+// The file is written with appendlog, so several processes can share it.
+package lockstats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rsgcata/go-fs/appendlog"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// Result is the outcome of an acquisition
+type Result string
+
+const (
+	// Released is an acquisition whose lock was held, then released
+	Released Result = "released"
+
+	// Lost is an acquisition whose lock was lost while held
+	Lost Result = "lost"
+
+	// Contended is a single attempt failing because the lock was held
+	Contended Result = "contended"
+
+	// TimedOut is an acquisition giving up after its timeout
+	TimedOut Result = "timeout"
+
+	// Canceled is an acquisition stopped by its context or by Abort
+	Canceled Result = "canceled"
+
+	// Failed is an acquisition failing with another error
+	Failed Result = "failed"
+)
+
+// Record is the persisted record of an acquisition
+type Record struct {
+	// Time is when the acquisition started
+	Time time.Time `json:"time"`
+
+	// Path is the path of the lock file
+	Path string `json:"path"`
+
+	// Holder is the process that acquired the lock, or tried to
+	Holder filelock.Holder `json:"holder"`
+
+	// Result is the outcome of the acquisition
+	Result Result `json:"result"`
+
+	// Wait is the time spent acquiring the lock
+	Wait time.Duration `json:"wait"`
+
+	// Hold is the time the lock was held, zero if it was not acquired
+	Hold time.Duration `json:"hold,omitempty"`
+
+	// Error is the error of a failed acquisition or release
+	Error string `json:"error,omitempty"`
+}
+
+// Rotation configures the rotation of the stats file
+type Rotation struct {
+	// MaxSize is the size over which the file is rotated, zero never rotates it
+	MaxSize int64
+
+	// Policy is the retention of the rotated files, see appendlog.Rotate
+	Policy appendlog.Policy
+}
+
+// buffered is the number of records waiting to be written before new ones are dropped
+const buffered = 1024
+
+// Log appends the records of the acquisitions of locks to a stats file
+// Records are written by a background goroutine, so the locks never wait for the
+// file; records produced faster than they can be written are dropped and counted.
+type Log struct {
+	writer   *appendlog.Writer
+	rotation Rotation
+
+	records chan Record
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	// mutex guards closed and err, so no record is queued once records is closed
+	mutex  sync.RWMutex
+	closed bool
+	err    error
+}
+
+// Open opens the stats file at path for appending, creating it if needed, and
+// starts writing the records of the locks created with Option
+func Open(path string, rotation Rotation) (*Log, error) {
+	writer, err := appendlog.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{
+		writer:   writer,
+		rotation: rotation,
+		records:  make(chan Record, buffered),
+		done:     make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Path returns the path of the stats file
+func (l *Log) Path() string {
+	return l.writer.Path()
+}
+
+// Dropped returns the number of records dropped because the file could not keep up
+// or could not be written
+func (l *Log) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Option returns the option recording the acquisitions of a lock. Each lock needs
+// its own Option, which tracks the state of the lock between transitions.
+func (l *Log) Option() filelock.Option {
+	t := &tracker{log: l}
+	return filelock.WithStateChange(t.transition)
+}
+
+// Close writes the pending records and closes the stats file. The records of the
+// locks created with Option are dropped afterwards.
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return l.err
+	}
+	l.closed = true
+	close(l.records)
+
+	<-l.done
+	l.err = l.writer.Close()
+	return l.err
+}
+
+// add queues r to be written, dropping it if the queue is full or l is closed
+func (l *Log) add(r Record) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.closed {
+		l.dropped.Add(1)
+		return
+	}
+	select {
+	case l.records <- r:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// run writes the queued records until the queue is closed
+func (l *Log) run() {
+	defer close(l.done)
+	for r := range l.records {
+		line, err := json.Marshal(r)
+		if err == nil {
+			_, err = l.writer.Write(append(line, '\n'))
+		}
+		if err != nil {
+			l.dropped.Add(1)
+			continue
+		}
+		l.rotate()
+	}
+}
+
+// rotate rotates the stats file once it reaches the maximum size
+func (l *Log) rotate() {
+	if l.rotation.MaxSize <= 0 {
+		return
+	}
+	info, err := os.Stat(l.Path())
+	if err != nil || info.Size() < l.rotation.MaxSize {
+		return
+	}
+	// Writers of other processes reopen the new file on their next write
+	_, _ = appendlog.Rotate(l.Path(), l.rotation.Policy)
+}
+
+// tracker follows the transitions of a lock to record its acquisitions, its
+// transitions are serialized by the lock
+type tracker struct {
+	log        *Log
+	started    time.Time
+	acquiredAt time.Time
+	wait       time.Duration
+}
+
+func (t *tracker) transition(tr filelock.Transition) {
+	switch tr.To {
+	case filelock.Acquiring:
+		t.started = tr.Time
+	case filelock.Locked:
+		if tr.From == filelock.Acquiring {
+			t.acquiredAt = tr.Time
+			t.wait = tr.Time.Sub(t.started)
+		}
+	case filelock.Unlocked, filelock.Lost:
+		switch tr.From {
+		case filelock.Acquiring:
+			t.record(tr, acquireResult(tr.Err), tr.Time.Sub(t.started), 0)
+		case filelock.Locked, filelock.Releasing:
+			result := Released
+			if tr.To == filelock.Lost {
+				result = Lost
+			}
+			t.record(tr, result, t.wait, tr.Time.Sub(t.acquiredAt))
+		}
+	}
+}
+
+func (t *tracker) record(tr filelock.Transition, result Result, wait, hold time.Duration) {
+	r := Record{
+		Time:   t.started,
+		Path:   tr.Path,
+		Holder: filelock.CurrentHolder(),
+		Result: result,
+		Wait:   wait,
+		Hold:   hold,
+	}
+	if tr.Err != nil {
+		r.Error = tr.Err.Error()
+	}
+	t.log.add(r)
+}
+
+// acquireResult returns the result of an acquisition failing with err
+func acquireResult(err error) Result {
+	switch {
+	case errors.Is(err, filelock.ErrTimeout):
+		return TimedOut
+	case errors.Is(err, filelock.ErrLockHeld):
+		return Contended
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, filelock.ErrAborted):
+		return Canceled
+	default:
+		return Failed
+	}
+}
@@ -0,0 +1,120 @@
+package lockstats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/appendlog"
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// LockStatsTestSuite defines a test suite for the persisted contention statistics
+type LockStatsTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *LockStatsTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "lockstats-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *LockStatsTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestRecords tests that every acquisition is recorded with its result
+func (s *LockStatsTestSuite) TestRecords() {
+	statsPath := filepath.Join(s.tempDir, "locks.jsonl")
+	stats, err := Open(statsPath, Rotation{})
+	s.Require().NoError(err)
+
+	lockPath := filepath.Join(s.tempDir, "job.lock")
+	holder := fs.New(lockPath, stats.Option())
+	contender := fs.New(lockPath, stats.Option())
+
+	s.Require().NoError(holder.Lock())
+	s.Assert().ErrorIs(contender.Lock(), filelock.ErrLockHeld)
+	s.Assert().ErrorIs(contender.LockWithTimeout(30*time.Millisecond), filelock.ErrTimeout)
+	time.Sleep(10 * time.Millisecond)
+	s.Require().NoError(holder.Unlock())
+	s.Require().NoError(stats.Close())
+	s.Assert().Zero(stats.Dropped())
+
+	records, err := Read(statsPath)
+	s.Require().NoError(err)
+	s.Require().Len(records, 3)
+	s.Assert().Equal(Contended, records[0].Result)
+	s.Assert().Equal(TimedOut, records[1].Result)
+	s.Assert().GreaterOrEqual(records[1].Wait, 30*time.Millisecond)
+	s.Assert().NotEmpty(records[1].Error)
+	s.Assert().Equal(Released, records[2].Result)
+	s.Assert().GreaterOrEqual(records[2].Hold, 40*time.Millisecond)
+	s.Assert().Equal(filelock.CurrentHolder(), records[2].Holder)
+	s.Assert().Equal(lockPath, records[2].Path)
+
+	summaries := Summarize(records)
+	s.Require().Len(summaries, 1)
+	summary := summaries[0]
+	s.Assert().Equal(3, summary.Acquisitions)
+	s.Assert().Equal(1, summary.Holders)
+	s.Assert().Equal(map[Result]int{Contended: 1, TimedOut: 1, Released: 1}, summary.Results)
+	s.Assert().Equal(records[1].Wait, summary.Wait.Max)
+	s.Assert().Equal(records[2].Hold, summary.Hold.P50)
+}
+
+// TestRotation tests that the records of the rotated files are read back in order
+func (s *LockStatsTestSuite) TestRotation() {
+	statsPath := filepath.Join(s.tempDir, "locks.jsonl")
+	stats, err := Open(statsPath, Rotation{MaxSize: 1, Policy: appendlog.Policy{Compress: true}})
+	s.Require().NoError(err)
+
+	lock := fs.New(filepath.Join(s.tempDir, "job.lock"), stats.Option())
+	for range 3 {
+		s.Require().NoError(lock.Lock())
+		s.Require().NoError(lock.Unlock())
+		// Rotated files are named after the time of the rotation
+		time.Sleep(time.Millisecond)
+	}
+	s.Require().NoError(stats.Close())
+
+	rotated, err := appendlog.Rotated(statsPath)
+	s.Require().NoError(err)
+	s.Assert().Len(rotated, 3)
+
+	records, err := Read(statsPath)
+	s.Require().NoError(err)
+	s.Require().Len(records, 3)
+	for i := 1; i < len(records); i++ {
+		s.Assert().False(records[i].Time.Before(records[i-1].Time))
+	}
+}
+
+// TestTruncatedLine tests that a line left incomplete by a crash is skipped
+func (s *LockStatsTestSuite) TestTruncatedLine() {
+	statsPath := filepath.Join(s.tempDir, "locks.jsonl")
+	data := `{"path":"a.lock","result":"released","wait":1000,"hold":2000}` + "\n" + `{"path":"a.lo`
+	s.Require().NoError(os.WriteFile(statsPath, []byte(data), 0644))
+
+	records, err := Read(statsPath)
+	s.Require().NoError(err)
+	s.Require().Len(records, 1)
+	s.Assert().Equal(2*time.Microsecond, records[0].Hold)
+
+	s.Require().NoError(os.WriteFile(statsPath, []byte("nope\n"), 0644))
+	_, err = Read(statsPath)
+	s.Assert().ErrorContains(err, "locks.jsonl:1")
+}
+
+// TestLockStats runs the test suite
+func TestLockStats(t *testing.T) {
+	suite.Run(t, new(LockStatsTestSuite))
+}
@@ -0,0 +1,189 @@
+package lockstats
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rsgcata/go-fs/appendlog"
+)
+
+// Read returns the records of the stats file at path and of its rotated files,
+// oldest first. A truncated last line, left by a process that crashed while
+// writing it, is skipped.
+func Read(path string) ([]Record, error) {
+	paths, err := appendlog.Rotated(path)
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, path)
+
+	var records []Record
+	for _, name := range paths {
+		if records, err = readFile(name, records); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// readFile appends the records of the file at path, gzipped if it is a compressed
+// rotated file, to records
+func readFile(path string, records []Record) ([]Record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Rotated or pruned meanwhile
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Without its newline, the line was not completely written
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// Summary summarizes the acquisitions of a lock
+type Summary struct {
+	// Path is the path of the lock file
+	Path string
+
+	// Acquisitions is the number of acquisitions, successful or not
+	Acquisitions int
+
+	// Results counts the acquisitions by result
+	Results map[Result]int
+
+	// Holders is the number of distinct processes that acquired the lock, or tried to
+	Holders int
+
+	// Wait and Hold describe the wait times of every acquisition and the hold times
+	// of the successful ones
+	Wait Distribution
+	Hold Distribution
+
+	// First and Last are the start times of the first and last acquisitions
+	First, Last time.Time
+}
+
+// Distribution describes a set of durations
+type Distribution struct {
+	P50, P99, Max time.Duration
+}
+
+// String formats the distribution as p50/p99/max
+func (d Distribution) String() string {
+	return fmt.Sprintf("%s/%s/%s", d.P50, d.P99, d.Max)
+}
+
+// Summarize returns the summary of the records of every lock, sorted by total wait
+// time, the most contended lock first
+func Summarize(records []Record) []Summary {
+	type acc struct {
+		summary Summary
+		holders map[string]struct{}
+		waits   []time.Duration
+		holds   []time.Duration
+		waited  time.Duration
+	}
+
+	byPath := make(map[string]*acc)
+	for _, r := range records {
+		a := byPath[r.Path]
+		if a == nil {
+			a = &acc{
+				summary: Summary{Path: r.Path, Results: make(map[Result]int), First: r.Time},
+				holders: make(map[string]struct{}),
+			}
+			byPath[r.Path] = a
+		}
+
+		s := &a.summary
+		s.Acquisitions++
+		s.Results[r.Result]++
+		if r.Time.Before(s.First) {
+			s.First = r.Time
+		}
+		if r.Time.After(s.Last) {
+			s.Last = r.Time
+		}
+		a.holders[r.Holder.String()] = struct{}{}
+		a.waits = append(a.waits, r.Wait)
+		a.waited += r.Wait
+		if r.Result == Released || r.Result == Lost {
+			a.holds = append(a.holds, r.Hold)
+		}
+	}
+
+	accs := make([]*acc, 0, len(byPath))
+	for _, a := range byPath {
+		a.summary.Holders = len(a.holders)
+		a.summary.Wait = distribution(a.waits)
+		a.summary.Hold = distribution(a.holds)
+		accs = append(accs, a)
+	}
+	sort.Slice(accs, func(i, j int) bool {
+		if accs[i].waited != accs[j].waited {
+			return accs[i].waited > accs[j].waited
+		}
+		return accs[i].summary.Path < accs[j].summary.Path
+	})
+
+	summaries := make([]Summary, len(accs))
+	for i, a := range accs {
+		summaries[i] = a.summary
+	}
+	return summaries
+}
+
+// distribution returns the distribution of durations, sorting them
+func distribution(durations []time.Duration) Distribution {
+	if len(durations) == 0 {
+		return Distribution{}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	return Distribution{
+		P50: percentile(durations, 50),
+		P99: percentile(durations, 99),
+		Max: durations[len(durations)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
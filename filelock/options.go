@@ -0,0 +1,390 @@
+package filelock
+
+import (
+	"os"
+	"time"
+)
+
+// Options holds the configuration shared by all FileLock implementations.
+type Options struct {
+	// IdempotentUnlock makes Unlock a no-op when the lock is not held,
+	// instead of returning ErrNotLocked.
+	IdempotentUnlock bool
+
+	// Clock is used for acquisition timeouts, backoff and statistics.
+	Clock Clock
+
+	// SpinAttempts is the number of retries made right away, yielding the
+	// processor in between, before a contended acquisition starts sleeping with
+	// exponential backoff.
+	SpinAttempts int
+
+	// MaxAttempts bounds the number of attempts of an acquisition, in addition
+	// to its timeout. Zero means no bound.
+	MaxAttempts int
+
+	// RangeOffset and RangeLength select the locked byte range on backends that
+	// lock byte ranges. A zero RangeLength locks from RangeOffset to the maximum
+	// file size.
+	RangeOffset uint64
+	RangeLength uint64
+
+	// Shared takes a shared (read) lock instead of an exclusive one. Any number
+	// of shared locks can be held on a file at once, excluding exclusive locks.
+	Shared bool
+
+	// HolderMetadata records the holder on the lock file while an exclusive lock
+	// is held, so other processes can find out who holds it.
+	HolderMetadata bool
+
+	// KeepOpen keeps the lock file open after Unlock and failed attempts, to be
+	// locked again without reopening it.
+	KeepOpen bool
+
+	// CoalesceShared makes the shared locks of this process on the same path share
+	// a single OS-level lock.
+	CoalesceShared bool
+
+	// StateChange is called with every state transition of the lock.
+	StateChange func(Transition)
+
+	// Payload is recorded in the lock file while an exclusive lock is held, and
+	// removed on release if ClearPayload is set.
+	Payload      []byte
+	ClearPayload bool
+
+	// PIDFormat writes the PID of the holder as the content of the lock file, as
+	// a decimal number followed by a newline.
+	PIDFormat bool
+
+	// NoFollow refuses to open a lock file that is a symbolic link.
+	NoFollow bool
+
+	// DenyShare opens the lock file without sharing it while the lock is held.
+	DenyShare bool
+
+	// Mandatory takes mandatory locks, enforced on the writes of every process.
+	Mandatory bool
+
+	// SecureParent refuses lock files whose directory other users can write to.
+	SecureParent bool
+
+	// Perm is the exact permission of the lock file, regardless of the umask.
+	// Zero keeps the default, 0666 filtered by the umask.
+	Perm os.FileMode
+
+	// Chown changes the owner of the lock file to UID and GID, where -1 leaves
+	// the owner or the group unchanged.
+	Chown    bool
+	UID, GID int
+
+	// OwnerSID is a Windows security identifier granted full access to created
+	// lock files.
+	OwnerSID string
+
+	// CreateParents creates the missing parent directories of the lock file with
+	// the permission ParentPerm.
+	CreateParents bool
+	ParentPerm    os.FileMode
+
+	// Root is the directory lock files must resolve beneath, or "" for no
+	// restriction.
+	Root string
+
+	// YieldAfter is the slice the lock can be held for before Yield lets the
+	// waiters of the process go first.
+	YieldAfter time.Duration
+
+	// AuditLog receives the acquisitions and releases of the lock. When nil,
+	// the DefaultAuditLog at the time of the event is used, if any.
+	AuditLog *AuditLog
+}
+
+// Option configures a FileLock at construction time.
+type Option func(*Options)
+
+// NewOptions returns the default Options with the given options applied.
+func NewOptions(opts ...Option) Options {
+	o := Options{
+		Clock: DefaultClock,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithIdempotentUnlock makes Unlock on a lock that is not held return nil
+// instead of ErrNotLocked. Useful when the same lock may be released more than once,
+// for example by both a deferred Unlock and an explicit one.
+func WithIdempotentUnlock() Option {
+	return func(o *Options) {
+		o.IdempotentUnlock = true
+	}
+}
+
+// WithClock sets the Clock used for timeouts, backoff and statistics, instead of DefaultClock.
+func WithClock(clock Clock) Option {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
+// WithSpin makes a contended LockWithTimeout retry up to attempts times right away,
+// calling runtime.Gosched in between, before falling back to sleeping with exponential
+// backoff from 10ms. It cuts the acquisition latency of locks held for very short
+// critical sections, at the cost of CPU time while spinning.
+func WithSpin(attempts int) Option {
+	return func(o *Options) {
+		o.SpinAttempts = attempts
+	}
+}
+
+// WithMaxAttempts makes an acquisition give up after attempts attempts, in addition
+// to its timeout or context, with an AttemptsError wrapping ErrTimeout that reports
+// the attempts made. With WithMaxAttempts(3), LockWithTimeout tries the lock three
+// times, sleeping with exponential backoff in between, and then fails, whatever the
+// time left. Non-blocking acquisitions make a single attempt anyway.
+func WithMaxAttempts(attempts int) Option {
+	return func(o *Options) {
+		o.MaxAttempts = attempts
+	}
+}
+
+// WithShared takes a shared lock, compatible with other shared locks, instead of an
+// exclusive one. Backends without shared locks (abstract) take an exclusive lock.
+func WithShared() Option {
+	return func(o *Options) {
+		o.Shared = true
+	}
+}
+
+// WithAuditLog records the acquisitions and releases of the lock in a, instead of
+// the DefaultAuditLog.
+func WithAuditLog(a *AuditLog) Option {
+	return func(o *Options) {
+		o.AuditLog = a
+	}
+}
+
+// WithRange locks length bytes starting at offset instead of the whole file, for
+// interoperability with software locking a specific region of the same file.
+// A zero length locks from offset to the maximum file size.
+// It is honored by backends locking byte ranges (Windows) and ignored by the others.
+func WithRange(offset, length uint64) Option {
+	return func(o *Options) {
+		o.RangeOffset = offset
+		o.RangeLength = length
+	}
+}
+
+// WithHolderMetadata records the holder (PID, hostname and acquisition time) on the
+// lock file while an exclusive lock is held. The Unix backend stores it in the
+// extended attribute unix.HolderXattr, keeping the file content free for application
+// data, or in the file content on file systems without extended attributes.
+// It is ignored by the other backends.
+func WithHolderMetadata() Option {
+	return func(o *Options) {
+		o.HolderMetadata = true
+	}
+}
+
+// WithKeepOpen keeps the lock file open across Lock and Unlock cycles on the same
+// FileLock, saving the open and close system calls of every acquisition in tight
+// lock/unlock loops. A lock file replaced or removed in the meantime is detected when
+// locking, and the file at the path is opened instead. The file stays open until
+// Close is called on the lock. Since the file is not closed on release, watchers
+// of the lock notice the release on their next poll rather than at once.
+// It is honored by the Unix and Windows backends and ignored by the others.
+func WithKeepOpen() Option {
+	return func(o *Options) {
+		o.KeepOpen = true
+	}
+}
+
+// WithCoalescedShared makes the shared locks taken by this process on the same path
+// with this option share a single OS-level shared lock, counting references in the
+// process: the first acquisition locks the file, the last release unlocks it. It spares
+// a descriptor and the system calls of every further acquisition, and makes shared
+// locks taken by goroutines independent of which descriptor holds what, unlike flock(2)
+// per descriptor semantics. Coalesced locks cannot be upgraded. It is honored by the
+// Unix and Windows backends and ignored by the others and by exclusive locks.
+func WithCoalescedShared() Option {
+	return func(o *Options) {
+		o.CoalesceShared = true
+	}
+}
+
+// WithStateChange calls fn with every state transition of the lock, the single
+// integration point for metrics, tracing and watchdogs. fn runs synchronously as the
+// lock changes state, so it must be quick and must not call the lock, except Status.
+// With several WithStateChange options, every fn is called in order.
+func WithStateChange(fn func(Transition)) Option {
+	return func(o *Options) {
+		if previous := o.StateChange; previous != nil {
+			o.StateChange = func(t Transition) {
+				previous(t)
+				fn(t)
+			}
+			return
+		}
+		o.StateChange = fn
+	}
+}
+
+// WithPayload records data, such as a job ID or a JSON status, in the lock file when
+// an exclusive lock is acquired, so external tools can inspect what the holder is
+// doing. The file content is then a JSON HolderRecord, as recorded by WithHolderMetadata,
+// whose Payload is data. With clearOnRelease the content is removed on release,
+// otherwise it is left until the next holder replaces it.
+// The record is written before the file is truncated to its size: readers see a
+// complete record, or an invalid one to read again, never an empty file.
+// It is honored by the Unix backend and ignored by the others and by shared locks.
+func WithPayload(data []byte, clearOnRelease bool) Option {
+	return func(o *Options) {
+		o.Payload = data
+		o.ClearPayload = clearOnRelease
+	}
+}
+
+// WithPIDFormat writes the PID of the holder into the lock file while an exclusive
+// lock is held, as a decimal number followed by a newline: the format of daemon PID
+// files and of liblockfile, so tools inspecting those files, such as pkill -F or
+// scripts reading the PID, work on the lock files of this package. The content is
+// removed on release. The metadata of WithHolderMetadata and the payload of
+// WithPayload are then only recorded in the extended attribute.
+// It is honored by the Unix backend and ignored by the others and by shared locks.
+func WithPIDFormat() Option {
+	return func(o *Options) {
+		o.PIDFormat = true
+	}
+}
+
+// WithNoFollow refuses to lock, or create, a lock file that is a symbolic link
+// (O_NOFOLLOW on Unix, FILE_FLAG_OPEN_REPARSE_POINT on Windows): Lock returns
+// ErrUnsafePath. It protects privileged daemons locking files in directories like
+// /tmp, where another user could otherwise point the lock path at any file.
+// It is honored by the Unix and Windows backends and ignored by the others.
+func WithNoFollow() Option {
+	return func(o *Options) {
+		o.NoFollow = true
+	}
+}
+
+// WithDenyShare opens the lock file without any sharing mode (no FILE_SHARE_READ,
+// FILE_SHARE_WRITE or FILE_SHARE_DELETE) while the lock is held, in addition to
+// locking it with LockFileEx: no other process can even open the file, a
+// stronger guarantee than the lock for files read by programs ignoring locks,
+// such as the files of installers. The file is opened when the lock is acquired,
+// an open refused because another process has the file open being contention,
+// and closed when it is released, so WithKeepOpen is ignored.
+// It is honored by the Windows backend and ignored by the others.
+func WithDenyShare() Option {
+	return func(o *Options) {
+		o.DenyShare = true
+	}
+}
+
+// WithMandatory takes mandatory locks on Linux: the lock file gets the setgid bit
+// with group execute cleared, and is locked with fcntl(2) open file description
+// locks, which the kernel then enforces on the reads and writes of every process,
+// cooperating or not. Mandatory locking needs a file system mounted with the mand
+// option and was removed in Linux 5.15; where it is not enforced, Lock returns a
+// *unix.MandatoryError matching errors.ErrUnsupported rather than taking an
+// advisory lock silently.
+// Caveats: a process blocked writing the file hangs until the lock is released, the
+// holder itself can only write through its locked descriptor, and mmap of the file
+// is refused while it is locked.
+// It is honored by the Unix backend and ignored by the others.
+func WithMandatory() Option {
+	return func(o *Options) {
+		o.Mandatory = true
+	}
+}
+
+// WithSecureParent refuses to lock a file whose directory is owned by another user
+// than the current one or root, or is writable by other users without the sticky bit
+// that keeps them from replacing the files of others: Lock returns ErrUnsafePath.
+// The lock file is then opened relative to the checked directory, so the directory
+// cannot be swapped between the check and the open. Combine it with WithNoFollow for
+// sticky directories like /tmp.
+// It is honored by the Unix backend and ignored by the others.
+func WithSecureParent() Option {
+	return func(o *Options) {
+		o.SecureParent = true
+	}
+}
+
+// WithPerm gives the lock file exactly the permission bits of perm, regardless of
+// the umask that filters the default 0666, so that the users coordinating through
+// the lock can all open it. On Unix the file is created with perm and changed to it
+// when it is opened by its owner; on Windows it is created with a security descriptor
+// granting the owner full access, the primary group of the process the read and
+// write access of the group bits, and everyone the read and write access of the
+// other bits only.
+// It is honored by the Unix and Windows backends and ignored by the others.
+func WithPerm(perm os.FileMode) Option {
+	return func(o *Options) {
+		o.Perm = perm.Perm()
+	}
+}
+
+// WithOwner makes the lock file owned by uid and gid, where -1 leaves the owner or
+// the group unchanged, so that a daemon started as root creates lock files its
+// service user can lock later on. The owner is changed with fchown(2) when the
+// file is opened with another owner, which only root can do for the user.
+// It is honored by the Unix backend and ignored by the others, see WithOwnerSID.
+func WithOwner(uid, gid int) Option {
+	return func(o *Options) {
+		o.Chown = true
+		o.UID = uid
+		o.GID = gid
+	}
+}
+
+// WithOwnerSID grants full access to created lock files to the Windows security
+// identifier sid, such as "S-1-5-19" or "LS" for the local service account, the
+// Windows equivalent of WithOwner. It is combined with WithPerm if given.
+// It is honored by the Windows backend and ignored by the others.
+func WithOwnerSID(sid string) Option {
+	return func(o *Options) {
+		o.OwnerSID = sid
+	}
+}
+
+// WithCreateParents creates the missing parent directories of the lock file with
+// exactly the permission perm, regardless of the umask, so that locking
+// /var/lib/myapp/locks/job-42.lock works on first run. Directories created at the
+// same time by other processes are accepted, and existing ones are left as they are.
+// It is honored by the Unix and Windows backends and ignored by the others.
+func WithCreateParents(perm os.FileMode) Option {
+	return func(o *Options) {
+		o.CreateParents = true
+		o.ParentPerm = perm.Perm()
+	}
+}
+
+// WithRoot confines the lock files to the directory root, such as the state
+// directory of the application: a lock path outside of it, or resolving outside of
+// it through "..", is refused with ErrUnsafePath. On Linux 5.6 and later the lock
+// file is opened with openat2(2) and RESOLVE_BENEATH|RESOLVE_NO_SYMLINKS relative to
+// root, so symbolic links in the path are refused too; older kernels silently fall
+// back to a lexical check, with the last component of the path not followed.
+// It is honored by the Unix backend for locks created by New and ignored by the
+// others.
+func WithRoot(root string) Option {
+	return func(o *Options) {
+		o.Root = root
+	}
+}
+
+// WithYield makes Yield release the lock and queue again behind the waiters when it
+// has been held for longer than slice while other locks of this process wait for
+// the same file, so a holder calling Yield between units of work cannot monopolize
+// the lock. Yield is cooperative: the lock is never released behind the back of the
+// holder. Waiters in other processes cannot be seen and are not yielded to.
+func WithYield(slice time.Duration) Option {
+	return func(o *Options) {
+		o.YieldAfter = slice
+	}
+}
@@ -0,0 +1,243 @@
+// Package staged implements the staged locking protocol of SQLite on top of file
+// locks: any number of readers hold SHARED locks, a single writer prepares its
+// changes under a RESERVED lock while readers keep coming and going, and only the
+// final commit window (PENDING then EXCLUSIVE) keeps new readers out.
+//
+// The states map to three lock files next to the protected file:
+//
+//   - SHARED holds LockPath(path) shared
+//   - RESERVED also holds path + ".reserved.lock" exclusively, so there is a single writer
+//   - PENDING also holds path + ".pending.lock" exclusively, so new readers wait
+//   - EXCLUSIVE holds LockPath(path) exclusively, once the readers are gone
+//
+// Readers take the pending lock shared while acquiring SHARED. Since the main lock
+// file is the one of the helpers of the root package, an EXCLUSIVE lock excludes
+// fs.Update and a SHARED lock excludes other exclusive holders of LockPath(path).
+package staged
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	gofs "github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// State is a state of the staged locking protocol
+type State int
+
+const (
+	// Unlocked holds no lock
+	Unlocked State = iota
+
+	// Shared allows reading, along with other readers
+	Shared
+
+	// Reserved announces the intent to write, readers can still acquire Shared
+	Reserved
+
+	// Pending waits for the current readers to finish, new readers wait too
+	Pending
+
+	// Exclusive allows writing, no one else holds a lock
+	Exclusive
+)
+
+// String returns the lower case name of the state
+func (s State) String() string {
+	switch s {
+	case Unlocked:
+		return "unlocked"
+	case Shared:
+		return "shared"
+	case Reserved:
+		return "reserved"
+	case Pending:
+		return "pending"
+	case Exclusive:
+		return "exclusive"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// ErrInvalidTransition is returned when the requested state cannot be reached from the current one
+var ErrInvalidTransition = errors.New("invalid staged lock transition")
+
+// Lock is a staged lock on a file, safe for concurrent use
+type Lock struct {
+	path     string
+	mutex    sync.Mutex
+	state    State
+	main     filelock.FileLock
+	reserved filelock.FileLock
+	pending  filelock.FileLock
+}
+
+// New creates an unlocked staged Lock protecting path
+func New(path string) *Lock {
+	return &Lock{path: path}
+}
+
+// Path returns the path of the protected file
+func (l *Lock) Path() string {
+	return l.path
+}
+
+// State returns the current state
+func (l *Lock) State() State {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.state
+}
+
+// Lock moves up to the state to, going through the intermediate states, within
+// timeout. Locking to the current state or a lower one does nothing.
+// Shared can only be reached from Unlocked, and the writer states from Shared or
+// a writer state: Lock(Exclusive) on an Unlocked lock returns ErrInvalidTransition.
+//
+// If timeout is reached, the lock stays in the highest state reached and the error
+// is returned, e.g. Lock(Exclusive) may leave the lock Pending while readers remain,
+// which keeps new readers out: retry or Unlock(Shared).
+// Reserved fails with ErrLockHeld or ErrTimeout while another writer holds it.
+func (l *Lock) Lock(to State, timeout time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if to > Exclusive {
+		return fmt.Errorf("%w: unknown state %s", ErrInvalidTransition, to)
+	}
+	if to <= l.state {
+		return nil
+	}
+	if l.state == Unlocked && to > Shared {
+		return fmt.Errorf("%w: %s to %s, acquire %s first", ErrInvalidTransition, l.state, to, Shared)
+	}
+
+	deadline := time.Now().Add(timeout)
+	remaining := func() time.Duration {
+		return max(time.Until(deadline), 0)
+	}
+
+	for l.state < to {
+		var err error
+		switch l.state {
+		case Unlocked:
+			err = l.lockShared(remaining())
+		case Shared:
+			err = l.take(&l.reserved, ".reserved", false, remaining())
+		case Reserved:
+			err = l.take(&l.pending, ".pending", false, remaining())
+		case Pending:
+			err = l.lockExclusive(remaining())
+		}
+		if err != nil {
+			return err
+		}
+		l.state++
+	}
+	return nil
+}
+
+// lockShared acquires the shared main lock, unless a writer is pending
+func (l *Lock) lockShared(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	pending := gofs.New(l.lockPath(".pending"), filelock.WithShared())
+	if err := pending.LockWithTimeout(timeout); err != nil {
+		return err
+	}
+	defer pending.Unlock()
+
+	return l.take(&l.main, "", true, max(time.Until(deadline), 0))
+}
+
+// lockExclusive replaces the shared main lock with an exclusive one once the
+// readers are gone
+// Holding the pending and reserved locks, no one else can take the main lock in
+// between, so the shared lock can be released first even where locks cannot be
+// converted, and taken again if the readers stay until timeout.
+func (l *Lock) lockExclusive(timeout time.Duration) error {
+	if err := l.drop(&l.main); err != nil {
+		return err
+	}
+	err := l.take(&l.main, "", false, timeout)
+	if err == nil {
+		return nil
+	}
+	if sharedErr := l.take(&l.main, "", true, 0); sharedErr != nil {
+		// Should not happen, the lock is no longer Shared
+		l.releaseAll()
+		return fmt.Errorf("%w: %w", filelock.ErrLockLost, sharedErr)
+	}
+	return err
+}
+
+// Unlock moves down to the state to, which must be Shared or Unlocked
+// Unlocking to the current state or a higher one does nothing.
+func (l *Lock) Unlock(to State) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if to != Shared && to != Unlocked {
+		return fmt.Errorf("%w: unlock to %s, only %s or %s", ErrInvalidTransition, to, Shared, Unlocked)
+	}
+	if to >= l.state {
+		return nil
+	}
+	if to == Unlocked {
+		return l.releaseAll()
+	}
+
+	// Readers are kept out by the pending lock, if any, while the main lock is
+	// turned shared again
+	var errs []error
+	if l.state == Exclusive {
+		errs = append(errs, l.drop(&l.main))
+		if err := l.take(&l.main, "", true, 0); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", filelock.ErrLockLost, err))
+			errs = append(errs, l.releaseAll())
+			return errors.Join(errs...)
+		}
+	}
+	errs = append(errs, l.drop(&l.pending), l.drop(&l.reserved))
+	l.state = Shared
+	return errors.Join(errs...)
+}
+
+// releaseAll releases every held lock, must be called with mutex held
+func (l *Lock) releaseAll() error {
+	err := errors.Join(l.drop(&l.main), l.drop(&l.pending), l.drop(&l.reserved))
+	l.state = Unlocked
+	return err
+}
+
+// take acquires the lock file with the given suffix into *lock
+func (l *Lock) take(lock *filelock.FileLock, suffix string, shared bool, timeout time.Duration) error {
+	var opts []filelock.Option
+	if shared {
+		opts = append(opts, filelock.WithShared())
+	}
+	fl := gofs.New(l.lockPath(suffix), opts...)
+	if err := fl.LockWithTimeout(timeout); err != nil {
+		return err
+	}
+	*lock = fl
+	return nil
+}
+
+// drop releases *lock, if held
+func (l *Lock) drop(lock *filelock.FileLock) error {
+	if *lock == nil {
+		return nil
+	}
+	err := (*lock).Unlock()
+	*lock = nil
+	return err
+}
+
+// lockPath returns the path of the lock file with the given suffix
+func (l *Lock) lockPath(suffix string) string {
+	return gofs.LockPath(l.path + suffix)
+}
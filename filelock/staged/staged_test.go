@@ -0,0 +1,97 @@
+package staged
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gofs "github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// StagedTestSuite defines a test suite for the staged locking protocol
+type StagedTestSuite struct {
+	suite.Suite
+	tempDir string
+	path    string
+}
+
+// SetupTest creates a temporary directory before each test
+func (s *StagedTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "staged-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.path = filepath.Join(tempDir, "app.db")
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *StagedTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestReadersAndReservedWriter tests that readers coexist with a reserved writer
+func (s *StagedTestSuite) TestReadersAndReservedWriter() {
+	reader, writer := New(s.path), New(s.path)
+
+	s.Require().NoError(reader.Lock(Shared, 0))
+	s.Require().NoError(writer.Lock(Shared, 0))
+	s.Require().NoError(writer.Lock(Reserved, 0))
+	s.Assert().Equal(Reserved, writer.State())
+
+	late := New(s.path)
+	s.Require().NoError(late.Lock(Shared, 0), "readers still come in while a writer is reserved")
+	s.Assert().Equal(filelock.ErrLockHeld, late.Lock(Reserved, 0), "there is a single writer")
+	s.Assert().Equal(Shared, late.State())
+
+	s.Require().NoError(late.Unlock(Unlocked))
+	s.Require().NoError(reader.Unlock(Unlocked))
+	s.Require().NoError(writer.Unlock(Unlocked))
+}
+
+// TestPendingKeepsNewReadersOut tests the commit window
+func (s *StagedTestSuite) TestPendingKeepsNewReadersOut() {
+	reader, writer := New(s.path), New(s.path)
+	s.Require().NoError(reader.Lock(Shared, 0))
+	s.Require().NoError(writer.Lock(Shared, 0))
+
+	s.Assert().Equal(filelock.ErrTimeout, writer.Lock(Exclusive, 50*time.Millisecond))
+	s.Assert().Equal(Pending, writer.State(), "the writer stays pending while readers remain")
+	s.Assert().Equal(filelock.ErrLockHeld, New(s.path).Lock(Shared, 0), "new readers wait")
+
+	time.AfterFunc(50*time.Millisecond, func() { _ = reader.Unlock(Unlocked) })
+	s.Require().NoError(writer.Lock(Exclusive, 5*time.Second))
+	s.Assert().Equal(Exclusive, writer.State())
+	s.Assert().Equal(filelock.ErrLockHeld, gofs.New(gofs.LockPath(s.path)).Lock(), "fs helpers are excluded")
+
+	s.Require().NoError(writer.Unlock(Shared))
+	s.Assert().Equal(Shared, writer.State())
+	other := New(s.path)
+	s.Require().NoError(other.Lock(Shared, 0))
+	s.Require().NoError(other.Lock(Reserved, 0), "the writer locks are released")
+	s.Require().NoError(other.Unlock(Unlocked))
+	s.Require().NoError(writer.Unlock(Unlocked))
+}
+
+// TestInvalidTransitions tests the transitions that are refused
+func (s *StagedTestSuite) TestInvalidTransitions() {
+	lock := New(s.path)
+	s.Assert().ErrorIs(lock.Lock(Exclusive, 0), ErrInvalidTransition)
+	s.Assert().ErrorIs(lock.Unlock(Reserved), ErrInvalidTransition)
+	s.Assert().ErrorIs(lock.Lock(State(9), 0), ErrInvalidTransition)
+	s.Assert().Equal(Unlocked, lock.State())
+	s.Assert().NoError(lock.Unlock(Unlocked))
+}
+
+// TestStateString tests the names of the states
+func (s *StagedTestSuite) TestStateString() {
+	s.Assert().Equal("pending", Pending.String())
+	s.Assert().Equal("State(9)", State(9).String())
+}
+
+// TestStaged runs the test suite
+func TestStaged(t *testing.T) {
+	suite.Run(t, new(StagedTestSuite))
+}
@@ -0,0 +1,92 @@
+package filelock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// AcquireStats describes the most recent attempt to acquire a lock.
+type AcquireStats struct {
+	// Attempts is the number of times the lock was tried, including the final one.
+	Attempts int
+
+	// Waited is the time spent acquiring the lock, whether it succeeded or not.
+	Waited time.Duration
+
+	// Contended reports whether the first attempt found the lock held by someone
+	// else.
+	Contended bool
+
+	// HolderBefore is the holder recorded on the lock when the first attempt found
+	// it held by someone else, for the backends able to read it, such as the Unix
+	// backend with WithHolderMetadata or WithPIDFormat. It is nil otherwise.
+	HolderBefore *HolderRecord
+}
+
+// AcquireResult describes an acquisition made by Acquire.
+type AcquireResult struct {
+	// Attempts is the number of times the lock was tried, including the final one.
+	Attempts int
+
+	// Waited is the time spent acquiring the lock, whether it succeeded or not.
+	Waited time.Duration
+
+	// Contended reports whether the lock was held by someone else when the
+	// acquisition started.
+	Contended bool
+
+	// FencingToken is the fencing token of the acquisition for the locks
+	// implementing Fencer, 0 otherwise.
+	FencingToken uint64
+
+	// HolderBefore is the holder found by the first attempt, see AcquireStats.
+	HolderBefore *HolderRecord
+}
+
+// Fencer is implemented by the locks providing a fencing token with every
+// acquisition, a number increasing with each of them, such as the locks of the
+// backend package on backends whose leases carry one.
+type Fencer interface {
+	// FencingToken returns the fencing token of the held lock.
+	FencingToken() (uint64, error)
+}
+
+// Acquire acquires l like AsContextLock(l).Lock(ctx), retrying until ctx is done,
+// and describes the acquisition, whether it succeeded or not, so callers can log it
+// or react to long waits without wrapping the lock:
+//
+//	result, err := filelock.Acquire(ctx, lock)
+//	if err != nil {
+//		return err
+//	}
+//	defer lock.Unlock()
+//	if result.Waited > slo {
+//		log.Printf("waited %s for %s held by %v", result.Waited, lock.Path(), result.HolderBefore)
+//	}
+//
+// The description comes from LastAcquireStats: with concurrent acquisitions
+// through the same instance, it may describe another one.
+func Acquire(ctx context.Context, l FileLock) (AcquireResult, error) {
+	err := AsContextLock(l).Lock(ctx)
+	stats := l.LastAcquireStats()
+	// Backends not recording the contention of the first attempt show it by
+	// retrying or failing
+	contended := stats.Contended || stats.HolderBefore != nil || stats.Attempts > 1 ||
+		errors.Is(err, ErrLockHeld) || errors.Is(err, ErrTimeout)
+	result := AcquireResult{
+		Attempts:     stats.Attempts,
+		Waited:       stats.Waited,
+		Contended:    contended,
+		HolderBefore: stats.HolderBefore,
+	}
+	if err != nil {
+		return result, err
+	}
+	if fencer, ok := l.(Fencer); ok {
+		if token, err := fencer.FencingToken(); err == nil {
+			result.FencingToken = token
+		}
+	}
+	return result, nil
+}
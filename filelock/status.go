@@ -0,0 +1,239 @@
+package filelock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle state of a lock instance.
+type State int
+
+const (
+	// Unlocked means the lock is not held and no acquisition is in progress.
+	Unlocked State = iota
+
+	// Acquiring means an acquisition is in progress.
+	Acquiring
+
+	// Locked means the lock is held.
+	Locked
+
+	// Releasing means the held lock is being released.
+	Releasing
+
+	// Lost means the held lock was released by the system, see ErrLockLost.
+	// It is only reported by transitions: the instance is Unlocked right after.
+	Lost
+)
+
+// String returns the lower-case name of the state.
+func (s State) String() string {
+	switch s {
+	case Unlocked:
+		return "unlocked"
+	case Acquiring:
+		return "acquiring"
+	case Locked:
+		return "locked"
+	case Releasing:
+		return "releasing"
+	case Lost:
+		return "lost"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the state as its name.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state name encoded by MarshalText.
+func (s *State) UnmarshalText(text []byte) error {
+	for state := Unlocked; state <= Lost; state++ {
+		if state.String() == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown lock state %q", text)
+}
+
+// Transition is a change of the state of a lock instance, see WithStateChange.
+//
+// The states follow this machine, a failed Releasing going back to Locked:
+//
+//	Unlocked → Acquiring → Locked → Releasing → Unlocked
+//	Acquiring → Unlocked (the acquisition failed)
+//	Locked, Releasing → Lost → Unlocked
+type Transition struct {
+	// Path is the path of the lock file.
+	Path string
+
+	// CanonicalPath is the canonical form of Path, see CanonicalPath, the same for
+	// every lock instance on the same file.
+	CanonicalPath string
+
+	// From and To are the states before and after the transition.
+	From State
+	To   State
+
+	// Shared reports whether the lock instance takes a shared lock.
+	Shared bool
+
+	// Time is when the transition happened, according to the Clock of the lock.
+	Time time.Time
+
+	// Err is the error that caused the transition, if any, such as the failure of
+	// an acquisition or the loss of the lock.
+	Err error
+}
+
+// Holder identifies the process holding a lock.
+type Holder struct {
+	PID      int    `json:"pid"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// String returns the holder as pid@hostname.
+func (h Holder) String() string {
+	if h.Hostname == "" {
+		return fmt.Sprintf("pid %d", h.PID)
+	}
+	return fmt.Sprintf("pid %d@%s", h.PID, h.Hostname)
+}
+
+var currentHolder = sync.OnceValue(func() Holder {
+	hostname, _ := os.Hostname()
+	return Holder{PID: os.Getpid(), Hostname: hostname}
+})
+
+// CurrentHolder returns the Holder describing the current process.
+func CurrentHolder() Holder {
+	return currentHolder()
+}
+
+// HolderRecord is the holder metadata recorded on a lock file by the backends
+// supporting WithHolderMetadata.
+type HolderRecord struct {
+	Holder
+
+	// AcquiredAt is when the holder acquired the lock.
+	AcquiredAt time.Time `json:"acquired_at"`
+
+	// Payload is the content provided by the holder with WithPayload, if any.
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// Status is a point-in-time description of a lock instance.
+type Status struct {
+	// Path is the path of the lock file.
+	Path string
+
+	// CanonicalPath is the canonical form of Path, see CanonicalPath.
+	CanonicalPath string
+
+	// FileID identifies the locked file, set only while it is Locked by a backend
+	// able to identify it.
+	FileID FileID
+
+	// State is the state of the lock instance.
+	State State
+
+	// Shared reports whether the lock instance takes a shared lock.
+	Shared bool
+
+	// Holder is the process holding the lock, set only while it is Locked.
+	Holder *Holder
+
+	// AcquiredAt is when the lock was acquired, zero unless it is Locked.
+	AcquiredAt time.Time
+
+	// HeldFor is how long the lock has been held, zero unless it is Locked.
+	HeldFor time.Duration
+
+	// LastAcquire describes the most recent acquisition attempt.
+	LastAcquire AcquireStats
+
+	// Waiters is the number of goroutines of this process acquiring the lock
+	// through this instance, including the one currently trying.
+	Waiters int
+}
+
+// SameLock reports whether s and other describe lock instances on the same file,
+// comparing their FileID when both are known and their CanonicalPath otherwise.
+func (s Status) SameLock(other Status) bool {
+	if !s.FileID.IsZero() && !other.FileID.IsZero() {
+		return s.FileID == other.FileID
+	}
+	return s.canonicalPath() == other.canonicalPath()
+}
+
+// canonicalPath returns CanonicalPath, or Path for statuses built without it.
+func (s Status) canonicalPath() string {
+	if s.CanonicalPath != "" {
+		return s.CanonicalPath
+	}
+	return s.Path
+}
+
+// String returns a single-line, human-readable description of the status.
+func (s Status) String() string {
+	switch {
+	case s.State == Locked && s.Holder != nil:
+		return fmt.Sprintf(
+			"%s: locked by %s for %s (%d attempts, waited %s)",
+			s.Path, s.Holder, s.HeldFor, s.LastAcquire.Attempts, s.LastAcquire.Waited,
+		)
+	default:
+		return fmt.Sprintf("%s: %s", s.Path, s.State)
+	}
+}
+
+type statusJSON struct {
+	Path          string           `json:"path"`
+	CanonicalPath string           `json:"canonical_path,omitempty"`
+	FileID        FileID           `json:"file_id,omitzero"`
+	State         State            `json:"state"`
+	Shared        bool             `json:"shared,omitempty"`
+	Holder        *Holder          `json:"holder,omitempty"`
+	AcquiredAt    time.Time        `json:"acquired_at,omitzero"`
+	HeldFor       string           `json:"held_for,omitempty"`
+	LastAcquire   acquireStatsJSON `json:"last_acquire"`
+	Waiters       int              `json:"waiters"`
+}
+
+type acquireStatsJSON struct {
+	Attempts     int           `json:"attempts"`
+	Waited       string        `json:"waited"`
+	Contended    bool          `json:"contended,omitempty"`
+	HolderBefore *HolderRecord `json:"holder_before,omitempty"`
+}
+
+// MarshalJSON encodes the status with durations in time.Duration string form.
+func (s Status) MarshalJSON() ([]byte, error) {
+	out := statusJSON{
+		Path:          s.Path,
+		CanonicalPath: s.CanonicalPath,
+		FileID:        s.FileID,
+		State:         s.State,
+		Shared:        s.Shared,
+		Holder:        s.Holder,
+		AcquiredAt:    s.AcquiredAt,
+		LastAcquire: acquireStatsJSON{
+			Attempts:     s.LastAcquire.Attempts,
+			Waited:       s.LastAcquire.Waited.String(),
+			Contended:    s.LastAcquire.Contended,
+			HolderBefore: s.LastAcquire.HolderBefore,
+		},
+		Waiters: s.Waiters,
+	}
+	if s.State == Locked {
+		out.HeldFor = s.HeldFor.String()
+	}
+	return json.Marshal(out)
+}
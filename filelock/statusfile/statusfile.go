@@ -0,0 +1,190 @@
+// Package statusfile publishes the state of locks in status sidecar files, so
+// observers that do not take the locks, shell scripts, file watchers or other
+// hosts on a shared mount, can follow them without probing the locks.
+//
+// The sidecar of the lock file at path is path+Suffix, a JSON Status replaced by
+// an atomic rename on every acquisition and release: observers see a new file,
+// with a new modification time, through inotify, fswatch, or by polling its
+// metadata. Locks publish their state when created with the option of a
+// Publisher:
+//
+//	var publisher statusfile.Publisher
+//	lock := fs.New(path, publisher.Option())
+//
+// Only exclusive locks are published. The release is published while the lock
+// is still held, so it never replaces the status written by the next holder.
+package statusfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/rsgcata/go-fs/atomicfile"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/watch"
+)
+
+// Suffix is appended to the path of a lock file to get its status sidecar
+const Suffix = ".status"
+
+// Path returns the path of the status sidecar of the lock file at lockPath
+func Path(lockPath string) string {
+	return lockPath + Suffix
+}
+
+// Status is the content of a status sidecar
+type Status struct {
+	// Lock is the path of the lock file
+	Lock string `json:"lock"`
+
+	// State is Locked, Unlocked, or Lost when the holder lost the lock
+	State filelock.State `json:"state"`
+
+	// Holder is the process that last held the lock
+	Holder filelock.Holder `json:"holder"`
+
+	// Time is when the state changed
+	Time time.Time `json:"time"`
+
+	// Error is the reason of the loss of the lock, if it is Lost
+	Error string `json:"error,omitempty"`
+}
+
+// Read returns the status published for the lock file at lockPath
+func Read(lockPath string) (Status, error) {
+	var st Status
+	data, err := os.ReadFile(Path(lockPath))
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("status sidecar %s: %w", Path(lockPath), err)
+	}
+	return st, nil
+}
+
+// Publisher writes the status sidecars of the locks created with its option
+// The zero value is ready to use
+type Publisher struct {
+	failed atomic.Uint64
+}
+
+// Option returns the option publishing the state of a lock
+func (p *Publisher) Option() filelock.Option {
+	return filelock.WithStateChange(p.transition)
+}
+
+// Failed returns the number of sidecars that could not be written
+func (p *Publisher) Failed() uint64 {
+	return p.failed.Load()
+}
+
+// transition publishes the acquisitions and releases of an exclusive lock
+func (p *Publisher) transition(t filelock.Transition) {
+	if t.Shared {
+		return
+	}
+
+	st := Status{Lock: t.Path, Holder: filelock.CurrentHolder(), Time: t.Time}
+	switch {
+	case t.To == filelock.Locked:
+		// Acquired, or a failed release
+		st.State = filelock.Locked
+	case t.To == filelock.Releasing:
+		st.State = filelock.Unlocked
+	case t.To == filelock.Lost:
+		// The lock may already be held by someone else, whose status is kept
+		current, err := Read(t.Path)
+		if err != nil || current.State != filelock.Locked || current.Holder != st.Holder {
+			return
+		}
+		st.State = filelock.Lost
+		if t.Err != nil {
+			st.Error = t.Err.Error()
+		}
+	default:
+		return
+	}
+	if err := write(st); err != nil {
+		p.failed.Add(1)
+	}
+}
+
+// write replaces the status sidecar of st.Lock
+func write(st Status) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(Path(st.Lock), append(data, '\n'), 0o644)
+}
+
+// Watch sends the status published for the lock file at lockPath, first the
+// current one if any, then every new one, until ctx is done, when the channel
+// is closed. Changes are reported by the system through the watch package, and
+// the sidecar is also checked every pollInterval if it is > 0, for the changes
+// made by other hosts on a network file system, which the system does not
+// report.
+func Watch(ctx context.Context, lockPath string, pollInterval time.Duration) (<-chan Status, error) {
+	watcher, err := watch.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(lockPath)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	statuses := make(chan Status)
+	go func() {
+		defer close(statuses)
+		defer watcher.Close()
+
+		var poll <-chan time.Time
+		if pollInterval > 0 {
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+
+		sidecar := Path(lockPath)
+		var last os.FileInfo
+		for {
+			info, err := os.Stat(sidecar)
+			if err == nil && !sameVersion(last, info) {
+				if st, err := Read(lockPath); err == nil {
+					last = info
+					select {
+					case statuses <- st:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-poll:
+			case _, ok := <-watcher.Events():
+				if !ok {
+					return
+				}
+			case <-watcher.Errors():
+			}
+		}
+	}()
+	return statuses, nil
+}
+
+// sameVersion reports whether the sidecar described by info is the one
+// described by last, as every version is a new file
+func sameVersion(last, info os.FileInfo) bool {
+	return last != nil && os.SameFile(last, info) && last.ModTime().Equal(info.ModTime()) &&
+		last.Size() == info.Size()
+}
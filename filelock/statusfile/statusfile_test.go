@@ -0,0 +1,105 @@
+package statusfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gofs "github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// StatusFileTestSuite defines a test suite for the status sidecars
+type StatusFileTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *StatusFileTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "statusfile-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *StatusFileTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestPublish tests that the sidecar follows the acquisitions and releases
+func (s *StatusFileTestSuite) TestPublish() {
+	path := filepath.Join(s.tempDir, "app.lock")
+	var publisher Publisher
+	lock := gofs.New(path, publisher.Option())
+
+	_, err := Read(path)
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+
+	s.Require().NoError(lock.Lock())
+	st, err := Read(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(filelock.Locked, st.State)
+	s.Assert().Equal(path, st.Lock)
+	s.Assert().Equal(filelock.CurrentHolder(), st.Holder)
+	s.Assert().WithinDuration(time.Now(), st.Time, time.Minute)
+
+	s.Require().NoError(lock.Unlock())
+	st, err = Read(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(filelock.Unlocked, st.State)
+	s.Assert().Zero(publisher.Failed())
+}
+
+// TestShared tests that shared locks are not published
+func (s *StatusFileTestSuite) TestShared() {
+	path := filepath.Join(s.tempDir, "app.lock")
+	var publisher Publisher
+	lock := gofs.New(path, publisher.Option(), filelock.WithShared())
+
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+	s.Assert().NoFileExists(Path(path))
+}
+
+// TestWatch tests that the published statuses are received
+func (s *StatusFileTestSuite) TestWatch() {
+	path := filepath.Join(s.tempDir, "app.lock")
+	var publisher Publisher
+	lock := gofs.New(path, publisher.Option())
+	s.Require().NoError(lock.Lock())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	statuses, err := Watch(ctx, path, time.Second)
+	s.Require().NoError(err)
+
+	next := func() Status {
+		select {
+		case st := <-statuses:
+			return st
+		case <-time.After(5 * time.Second):
+			s.FailNow("no status received")
+			return Status{}
+		}
+	}
+	s.Assert().Equal(filelock.Locked, next().State)
+	s.Require().NoError(lock.Unlock())
+	s.Assert().Equal(filelock.Unlocked, next().State)
+	s.Require().NoError(lock.Lock())
+	s.Assert().Equal(filelock.Locked, next().State)
+	s.Require().NoError(lock.Unlock())
+	s.Assert().Equal(filelock.Unlocked, next().State)
+
+	cancel()
+	for range statuses {
+	}
+}
+
+// TestStatusFile runs the test suite
+func TestStatusFile(t *testing.T) {
+	suite.Run(t, new(StatusFileTestSuite))
+}
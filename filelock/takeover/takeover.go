@@ -0,0 +1,254 @@
+// Package takeover lets a process ask the holder of a lock to hand it over, for
+// rolling restarts where the new process must take over promptly.
+//
+// The requester writes a takeover request next to the lock file, then waits a
+// grace period for the holder to release the lock. Holders created with
+// OnRequested watch the requests while they hold the lock and are called back, so
+// they can finish their work and release it. If the holder does not release the
+// lock in time, the requester breaks it with the breaker given with WithBreaker,
+// if any, or gives up.
+//
+//	// Old process
+//	var lock filelock.FileLock
+//	lock = fs.New(path, takeover.OnRequested(func(r takeover.Request) {
+//		stopAcceptingWork()
+//		lock.Unlock()
+//	}))
+//
+//	// New process
+//	lock := fs.New(path)
+//	err := takeover.Take(ctx, lock, 10*time.Second)
+package takeover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs/atomicfile"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/watch"
+)
+
+// Suffix is appended to the path of a lock file to get the path of its takeover
+// requests
+const Suffix = ".takeover"
+
+// Request is a takeover request of a lock
+type Request struct {
+	// Requester is the process asking for the lock
+	Requester filelock.Holder `json:"requester"`
+
+	// RequestedAt is when the takeover was requested
+	RequestedAt time.Time `json:"requested_at"`
+
+	// Deadline is when the requester stops waiting for the lock to be released,
+	// and breaks it if it can
+	Deadline time.Time `json:"deadline"`
+}
+
+// RequestPath returns the path of the takeover requests of the lock file at lockPath
+func RequestPath(lockPath string) string {
+	return lockPath + Suffix
+}
+
+// ReadRequest returns the pending takeover request of the lock file at lockPath,
+// or nil if there is none. Requests past their deadline are left behind by
+// requesters that crashed, they are not returned.
+func ReadRequest(lockPath string) (*Request, error) {
+	data, err := os.ReadFile(RequestPath(lockPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var request Request
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, fmt.Errorf("takeover request of %s is invalid: %w", lockPath, err)
+	}
+	if time.Now().After(request.Deadline) {
+		return nil, nil
+	}
+	return &request, nil
+}
+
+// Breaker breaks the lock of the lock file at lockPath held by an unresponsive
+// holder, so it can be acquired
+type Breaker func(ctx context.Context, lockPath string) error
+
+// RemoveLockFile is a Breaker for locks held by the existence of their lock file,
+// such as the lockfile package: it removes the lock file. The former holder is not
+// told, and removes the lock file of the new holder if it unlocks later.
+func RemoveLockFile(_ context.Context, lockPath string) error {
+	err := os.Remove(lockPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Option configures Take
+type Option func(*options)
+
+type options struct {
+	breaker Breaker
+}
+
+// WithBreaker makes Take break the lock with breaker when the holder did not
+// release it within the grace period, then acquire it
+func WithBreaker(breaker Breaker) Option {
+	return func(o *options) {
+		o.breaker = breaker
+	}
+}
+
+// Take acquires lock, asking its holder to hand it over if it is held: it writes
+// a takeover request next to the lock file, then waits up to grace for the holder
+// to release the lock. If the holder did not release it in time, the lock is broken
+// with the breaker given with WithBreaker and acquired, retrying until ctx is done.
+// Without a breaker, Take returns an error wrapping filelock.ErrTimeout.
+// The request is removed when Take returns.
+func Take(ctx context.Context, lock filelock.FileLock, grace time.Duration, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	err := lock.Lock()
+	if !errors.Is(err, filelock.ErrLockHeld) {
+		return err
+	}
+
+	now := time.Now()
+	request := Request{Requester: filelock.CurrentHolder(), RequestedAt: now, Deadline: now.Add(grace)}
+	if err := writeRequest(lock.Path(), request); err != nil {
+		return err
+	}
+	defer removeRequest(lock.Path(), request)
+
+	contextLock := filelock.AsContextLock(lock)
+	graceCtx, cancel := context.WithDeadline(ctx, request.Deadline)
+	err = contextLock.Lock(graceCtx)
+	cancel()
+	if err == nil || ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	if o.breaker == nil {
+		return fmt.Errorf("%w: the holder of %s did not hand it over within %s", filelock.ErrTimeout, lock.Path(), grace)
+	}
+	if err := o.breaker(ctx, lock.Path()); err != nil {
+		return fmt.Errorf("breaking the lock %s: %w", lock.Path(), err)
+	}
+	return contextLock.Lock(ctx)
+}
+
+// writeRequest writes request for the lock file at lockPath, replacing the
+// previous one, if any
+func writeRequest(lockPath string, request Request) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(RequestPath(lockPath), data, 0644)
+}
+
+// removeRequest removes the takeover request of the lock file at lockPath if it
+// is still request, and not the one of another requester
+func removeRequest(lockPath string, request Request) {
+	data, err := os.ReadFile(RequestPath(lockPath))
+	if err != nil {
+		return
+	}
+	var current Request
+	if json.Unmarshal(data, &current) != nil {
+		return
+	}
+	if current.Requester == request.Requester && current.RequestedAt.Equal(request.RequestedAt) {
+		_ = os.Remove(RequestPath(lockPath))
+	}
+}
+
+// OnRequested makes the lock call fn with every takeover request made while it is
+// held, from a watchdog goroutine started when the lock is acquired and stopped
+// when it is released. fn is typically expected to finish the work in progress
+// and release the lock before the deadline of the request; it may call the lock.
+// Requests are noticed through the watch package. Each request is reported once.
+func OnRequested(fn func(Request)) filelock.Option {
+	dog := &watchdog{fn: fn}
+	return filelock.WithStateChange(dog.transition)
+}
+
+// watchdog watches the takeover requests of a lock while it is held
+type watchdog struct {
+	fn func(Request)
+
+	mutex sync.Mutex
+	stop  chan struct{}
+}
+
+// transition starts the watch when the lock is acquired and stops it when the
+// lock is released, without waiting for it to stop, as fn may be releasing it
+func (d *watchdog) transition(t filelock.Transition) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	switch {
+	case t.To == filelock.Locked && d.stop == nil:
+		d.stop = make(chan struct{})
+		go d.watch(t.Path, d.stop)
+	case (t.To == filelock.Unlocked || t.To == filelock.Lost) && d.stop != nil:
+		close(d.stop)
+		d.stop = nil
+	}
+}
+
+// watch reports the takeover requests of the lock file at lockPath until stop is
+// closed
+func (d *watchdog) watch(lockPath string, stop <-chan struct{}) {
+	requestPath := filepath.Clean(RequestPath(lockPath))
+	watcher, err := watch.New()
+	if err != nil {
+		return
+	}
+	defer watcher.Close()
+	// Without a watch, requests are only checked once
+	_ = watcher.Add(filepath.Dir(requestPath))
+
+	var reported time.Time
+	check := func() {
+		request, err := ReadRequest(lockPath)
+		if err != nil || request == nil || request.RequestedAt.Equal(reported) {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		reported = request.RequestedAt
+		d.fn(*request)
+	}
+
+	check()
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-watcher.Events():
+			if e.Path == requestPath && e.Op&(watch.Create|watch.Write|watch.Rename) != 0 {
+				check()
+			}
+		case <-watcher.Errors():
+			// Events were dropped
+			check()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package takeover
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/lockfile"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// TakeoverTestSuite defines a test suite for lock takeover requests
+type TakeoverTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *TakeoverTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "takeover-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *TakeoverTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestTakeFree tests that a free lock is acquired without a request
+func (s *TakeoverTestSuite) TestTakeFree() {
+	lockPath := filepath.Join(s.tempDir, "free.lock")
+	lock := lockfile.New(lockPath)
+
+	s.Require().NoError(Take(context.Background(), lock, time.Second))
+	s.Assert().True(lock.IsLocked())
+	s.Assert().NoFileExists(RequestPath(lockPath))
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestCooperativeHolder tests that a holder watching requests is told and hands
+// the lock over within the grace period
+func (s *TakeoverTestSuite) TestCooperativeHolder() {
+	lockPath := filepath.Join(s.tempDir, "cooperative.lock")
+	requests := make(chan Request, 1)
+	var holder *lockfile.FileLock
+	holder = lockfile.New(lockPath, OnRequested(func(r Request) {
+		requests <- r
+		_ = holder.Unlock()
+	}))
+	s.Require().NoError(holder.Lock())
+
+	requester := lockfile.New(lockPath)
+	s.Require().NoError(Take(context.Background(), requester, 10*time.Second))
+	defer requester.Unlock()
+
+	select {
+	case r := <-requests:
+		s.Assert().Equal(filelock.CurrentHolder(), r.Requester)
+		s.Assert().True(r.Deadline.After(r.RequestedAt))
+	default:
+		s.Fail("the holder was not told of the request")
+	}
+	s.Assert().False(holder.IsLocked())
+	s.Assert().NoFileExists(RequestPath(lockPath))
+}
+
+// TestGraceExpired tests that Take gives up without a breaker when the holder
+// does not hand the lock over
+func (s *TakeoverTestSuite) TestGraceExpired() {
+	lockPath := filepath.Join(s.tempDir, "stubborn.lock")
+	holder := lockfile.New(lockPath)
+	s.Require().NoError(holder.Lock())
+	defer holder.Unlock()
+
+	requester := lockfile.New(lockPath)
+	err := Take(context.Background(), requester, 50*time.Millisecond)
+	s.Assert().ErrorIs(err, filelock.ErrTimeout)
+	s.Assert().False(requester.IsLocked())
+	s.Assert().NoFileExists(RequestPath(lockPath))
+}
+
+// TestBreaker tests that the lock of an unresponsive holder is broken once the
+// grace period is over
+func (s *TakeoverTestSuite) TestBreaker() {
+	lockPath := filepath.Join(s.tempDir, "broken.lock")
+	holder := lockfile.New(lockPath)
+	s.Require().NoError(holder.Lock())
+
+	requester := lockfile.New(lockPath)
+	start := time.Now()
+	s.Require().NoError(Take(context.Background(), requester, 50*time.Millisecond, WithBreaker(RemoveLockFile)))
+	s.Assert().True(requester.IsLocked())
+	s.Assert().GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+	s.Require().NoError(requester.Unlock())
+}
+
+// TestReadRequest tests that expired requests are ignored
+func (s *TakeoverTestSuite) TestReadRequest() {
+	lockPath := filepath.Join(s.tempDir, "request.lock")
+
+	request, err := ReadRequest(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Nil(request)
+
+	now := time.Now()
+	s.Require().NoError(writeRequest(lockPath, Request{RequestedAt: now, Deadline: now.Add(time.Minute)}))
+	request, err = ReadRequest(lockPath)
+	s.Require().NoError(err)
+	s.Require().NotNil(request)
+	s.Assert().True(request.RequestedAt.Equal(now))
+
+	s.Require().NoError(writeRequest(lockPath, Request{RequestedAt: now.Add(-time.Minute), Deadline: now.Add(-time.Second)}))
+	request, err = ReadRequest(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Nil(request)
+}
+
+// TestTakeover runs the test suite
+func TestTakeover(t *testing.T) {
+	suite.Run(t, new(TakeoverTestSuite))
+}
@@ -0,0 +1,232 @@
+package testutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// envRemote marks the child processes started by StartRemote
+const envRemote = "GOFS_REMOTE_LOCKER"
+
+// remotePrefix marks the response lines of a remote locker, the other lines of
+// its output being written by the testing package
+const remotePrefix = "gofs-remote: "
+
+// remoteErrors are the errors keeping their identity across processes
+var remoteErrors = []error{
+	filelock.ErrLockHeld,
+	filelock.ErrTimeout,
+	filelock.ErrAlreadyLocked,
+	filelock.ErrNotLocked,
+	filelock.ErrLockLost,
+	filelock.ErrPermission,
+}
+
+// remoteCommand is a request sent to a remote locker
+type remoteCommand struct {
+	Op      string        `json:"op"`
+	Path    string        `json:"path"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// remoteResponse is the outcome of a remoteCommand
+type remoteResponse struct {
+	Error string `json:"error,omitempty"`
+	// Known is the index in remoteErrors of the error, or -1
+	Known int `json:"known"`
+}
+
+// Remote is a child process of the test binary locking and unlocking on behalf
+// of a test, for assertions between processes: a lock held by a Remote is held
+// by another process, and killing it shows what happens to the locks of a
+// crashed process.
+type Remote struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	output *bufio.Scanner
+	mutex  sync.Mutex
+	done   bool
+}
+
+// StartRemote re-runs the calling test in a child process serving the requests of
+// the returned Remote, with the locks returned by newLock. The child is stopped
+// when the test ends.
+//
+// In the child process StartRemote serves the requests and then skips the rest of
+// the test, so it should be called before any other assertion, like Stress.
+func StartRemote(t *testing.T, newLock func(path string) filelock.FileLock) *Remote {
+	t.Helper()
+	if os.Getenv(envRemote) != "" {
+		serveRemote(os.Stdin, os.Stdout, newLock)
+		t.SkipNow()
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run="+runPattern(t.Name()), "-test.count=1")
+	cmd.Env = append(os.Environ(), envRemote+"=1")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Remote{cmd: cmd, stdin: stdin, output: bufio.NewScanner(stdout)}
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+// Pid returns the process ID of the remote locker
+func (r *Remote) Pid() int {
+	return r.cmd.Process.Pid
+}
+
+// Lock makes the remote locker acquire the lock on path without waiting
+func (r *Remote) Lock(path string) error {
+	return r.call(remoteCommand{Op: "lock", Path: path})
+}
+
+// LockWithTimeout makes the remote locker acquire the lock on path within timeout
+func (r *Remote) LockWithTimeout(path string, timeout time.Duration) error {
+	return r.call(remoteCommand{Op: "lock", Path: path, Timeout: timeout})
+}
+
+// Unlock makes the remote locker release the lock on path
+func (r *Remote) Unlock(path string) error {
+	return r.call(remoteCommand{Op: "unlock", Path: path})
+}
+
+// Hold makes the remote locker acquire the lock on path without waiting, and
+// release it after d in the background
+func (r *Remote) Hold(path string, d time.Duration) error {
+	return r.call(remoteCommand{Op: "hold", Path: path, Timeout: d})
+}
+
+// Kill kills the remote locker without releasing its locks, like a crash
+func (r *Remote) Kill() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.done {
+		return nil
+	}
+	r.done = true
+	_ = r.cmd.Process.Kill()
+	_ = r.cmd.Wait()
+	return nil
+}
+
+// Close stops the remote locker, which releases its locks
+func (r *Remote) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.done {
+		return nil
+	}
+	r.done = true
+	_ = r.stdin.Close()
+	return r.cmd.Wait()
+}
+
+// call sends cmd to the remote locker and returns the error it reported
+func (r *Remote) call(cmd remoteCommand) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.done {
+		return errors.New("remote locker stopped")
+	}
+
+	request, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(r.stdin, "%s\n", request); err != nil {
+		return fmt.Errorf("remote locker: %w", err)
+	}
+
+	for r.output.Scan() {
+		line, ok := strings.CutPrefix(r.output.Text(), remotePrefix)
+		if !ok {
+			continue
+		}
+		var response remoteResponse
+		if err := json.Unmarshal([]byte(line), &response); err != nil {
+			return fmt.Errorf("remote locker: %w", err)
+		}
+		switch {
+		case response.Error == "":
+			return nil
+		case response.Known >= 0 && response.Known < len(remoteErrors):
+			return fmt.Errorf("%w (remote: %s)", remoteErrors[response.Known], response.Error)
+		default:
+			return fmt.Errorf("remote: %s", response.Error)
+		}
+	}
+	return fmt.Errorf("remote locker exited: %w", errors.Join(r.output.Err(), io.ErrUnexpectedEOF))
+}
+
+// serveRemote serves the commands read from in until it is closed
+func serveRemote(in io.Reader, out io.Writer, newLock func(path string) filelock.FileLock) {
+	locks := make(map[string]filelock.FileLock)
+	lockFor := func(path string) filelock.FileLock {
+		if locks[path] == nil {
+			locks[path] = newLock(path)
+		}
+		return locks[path]
+	}
+
+	input := bufio.NewScanner(in)
+	for input.Scan() {
+		var cmd remoteCommand
+		err := json.Unmarshal(input.Bytes(), &cmd)
+		if err == nil {
+			lock := lockFor(cmd.Path)
+			switch cmd.Op {
+			case "lock":
+				err = lock.LockWithTimeout(cmd.Timeout)
+			case "unlock":
+				err = lock.Unlock()
+			case "hold":
+				if err = lock.Lock(); err == nil {
+					time.AfterFunc(cmd.Timeout, func() { _ = lock.Unlock() })
+				}
+			default:
+				err = fmt.Errorf("unknown command %q", cmd.Op)
+			}
+		}
+
+		response := remoteResponse{Known: -1}
+		if err != nil {
+			response.Error = err.Error()
+			for i, known := range remoteErrors {
+				if errors.Is(err, known) {
+					response.Known = i
+					break
+				}
+			}
+		}
+		data, _ := json.Marshal(response)
+		_, _ = fmt.Fprintf(out, "\n%s%s\n", remotePrefix, data)
+	}
+
+	for _, lock := range locks {
+		if lock.IsLocked() {
+			_ = lock.Unlock()
+		}
+	}
+}
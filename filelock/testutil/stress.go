@@ -0,0 +1,197 @@
+// Package testutil provides helpers for testing FileLock implementations
+// across real processes.
+package testutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// Environment variables used to hand the stress parameters to child processes
+const (
+	envStressDir        = "GOFS_STRESS_DIR"
+	envStressIterations = "GOFS_STRESS_ITERATIONS"
+	envStressMaxHold    = "GOFS_STRESS_MAX_HOLD"
+	envStressTimeout    = "GOFS_STRESS_TIMEOUT"
+)
+
+const (
+	stressLockFile    = "stress.lock"
+	stressCounterFile = "counter"
+	stressOwnerFile   = "owner"
+)
+
+// StressConfig configures Stress. Zero fields take their default value.
+type StressConfig struct {
+	// Processes is the number of child processes, 4 by default.
+	Processes int
+
+	// Iterations is the number of critical sections run by each child, 20 by default.
+	Iterations int
+
+	// MaxHold is the maximum random time a child holds the lock, 5ms by default.
+	MaxHold time.Duration
+
+	// Timeout is the acquisition timeout of each iteration, 10s by default.
+	Timeout time.Duration
+}
+
+func (c StressConfig) withDefaults() StressConfig {
+	if c.Processes <= 0 {
+		c.Processes = 4
+	}
+	if c.Iterations <= 0 {
+		c.Iterations = 20
+	}
+	if c.MaxHold <= 0 {
+		c.MaxHold = 5 * time.Millisecond
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// Stress proves mutual exclusion across processes. It re-runs the calling test
+// in cfg.Processes child processes of the test binary; each child acquires the
+// lock returned by newLock cfg.Iterations times, and while holding it checks that
+// no other process is inside the critical section and increments a shared
+// counter file. The test fails if any overlap or lost update is detected.
+//
+// In the child processes Stress runs the critical sections and then skips the
+// rest of the test, so it should be called before any other assertion.
+func Stress(t *testing.T, newLock func(path string) filelock.FileLock, cfg StressConfig) {
+	t.Helper()
+	cfg = cfg.withDefaults()
+
+	if dir := os.Getenv(envStressDir); dir != "" {
+		runStressChild(t, dir, newLock)
+		t.SkipNow()
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, stressCounterFile), []byte("0"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, cfg.Processes)
+	for i := 0; i < cfg.Processes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run="+runPattern(t.Name()), "-test.count=1")
+			cmd.Env = append(os.Environ(),
+				envStressDir+"="+dir,
+				envStressIterations+"="+strconv.Itoa(cfg.Iterations),
+				envStressMaxHold+"="+cfg.MaxHold.String(),
+				envStressTimeout+"="+cfg.Timeout.String(),
+			)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				errs <- fmt.Errorf("child %d: %w\n%s", i, err, out)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	got, err := readCounter(filepath.Join(dir, stressCounterFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := cfg.Processes * cfg.Iterations; got != want {
+		t.Errorf("counter is %d after %d critical sections, updates were lost", got, want)
+	}
+}
+
+// runStressChild runs the critical sections of a child process
+func runStressChild(t *testing.T, dir string, newLock func(path string) filelock.FileLock) {
+	iterations, err := strconv.Atoi(os.Getenv(envStressIterations))
+	if err != nil {
+		t.Fatalf("invalid %s: %v", envStressIterations, err)
+	}
+	maxHold, err := time.ParseDuration(os.Getenv(envStressMaxHold))
+	if err != nil {
+		t.Fatalf("invalid %s: %v", envStressMaxHold, err)
+	}
+	timeout, err := time.ParseDuration(os.Getenv(envStressTimeout))
+	if err != nil {
+		t.Fatalf("invalid %s: %v", envStressTimeout, err)
+	}
+
+	lock := newLock(filepath.Join(dir, stressLockFile))
+	for i := 0; i < iterations; i++ {
+		if err := lock.LockWithTimeout(timeout); err != nil {
+			t.Fatalf("iteration %d: lock: %v", i, err)
+		}
+		if err := criticalSection(dir, rand.N(maxHold+1)); err != nil {
+			t.Fatalf("iteration %d: %v", i, err)
+		}
+		if err := lock.Unlock(); err != nil {
+			t.Fatalf("iteration %d: unlock: %v", i, err)
+		}
+	}
+}
+
+// criticalSection marks the section as owned, increments the counter and
+// releases the ownership marker
+func criticalSection(dir string, hold time.Duration) error {
+	ownerPath := filepath.Join(dir, stressOwnerFile)
+	owner, err := os.OpenFile(ownerPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if errors.Is(err, os.ErrExist) {
+		other, _ := os.ReadFile(ownerPath)
+		return fmt.Errorf("mutual exclusion violated, pid %s is in the critical section", other)
+	}
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprint(owner, os.Getpid())
+	_ = owner.Close()
+
+	counterPath := filepath.Join(dir, stressCounterFile)
+	counter, err := readCounter(counterPath)
+	if err != nil {
+		return err
+	}
+
+	time.Sleep(hold)
+
+	if err := os.WriteFile(counterPath, []byte(strconv.Itoa(counter+1)), 0666); err != nil {
+		return err
+	}
+	return os.Remove(ownerPath)
+}
+
+func readCounter(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(bytes.TrimSpace(data)))
+}
+
+// runPattern returns the -test.run pattern matching exactly the named (sub)test
+func runPattern(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = "^" + regexp.QuoteMeta(part) + "$"
+	}
+	return strings.Join(parts, "/")
+}
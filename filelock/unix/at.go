@@ -0,0 +1,129 @@
+package unix
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/lockcore"
+
+	xunix "golang.org/x/sys/unix"
+)
+
+// NewAt creates a new FileLock for the lock file at path relative to the open
+// directory dir, like openat(2). The lock file, and the parents created by
+// filelock.WithCreateParents, are opened and checked through dir only, so
+// processes restricted to pre-opened directories, by Landlock or a capability
+// sandbox, can lock in them, and renaming dir does not move the lock elsewhere.
+// dir must stay open while the lock is used; Path returns path joined to the name
+// of dir, which identifies the lock in the process.
+// An absolute path is refused with an error wrapping filelock.ErrUnsafePath.
+func NewAt(dir *os.File, path string, opts ...filelock.Option) *FileLock {
+	o := filelock.NewOptions(opts...)
+	driver := newDriver(o)
+	driver.at = dir
+	driver.rel = path
+	return &FileLock{core: lockcore.New(filepath.Join(dir.Name(), path), driver, o)}
+}
+
+// openLockFileAt opens, creating it with perm if needed, the lock file at rel
+// relative to the open directory dir, path naming it in errors
+func openLockFileAt(dir *os.File, rel, path string, perm os.FileMode, noFollow, secureParent bool) (*os.File, error) {
+	if filepath.IsAbs(rel) {
+		return nil, fmt.Errorf("%w: %s is not relative to directory %s", filelock.ErrUnsafePath, rel, dir.Name())
+	}
+	return openRelative(int(dir.Fd()), rel, path, perm, noFollow, secureParent, false)
+}
+
+// openRelative opens the lock file at rel relative to the open directory dirFd,
+// resolving rel beneath dirFd with beneath, path naming it in errors
+func openRelative(dirFd int, rel, path string, perm os.FileMode, noFollow, secureParent, beneath bool) (*os.File, error) {
+	if parent := filepath.Dir(rel); parent != "." {
+		parentFd, err := openFd(dirFd, parent, xunix.O_RDONLY|xunix.O_DIRECTORY, 0, beneath)
+		if err != nil {
+			return nil, resolveError(filepath.Dir(path), err, beneath)
+		}
+		defer xunix.Close(parentFd)
+		dirFd = parentFd
+	}
+	if secureParent {
+		if err := checkParent(dirFd, filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	}
+	return openAt(dirFd, filepath.Base(rel), path, lockFlags(noFollow), perm, noFollow, beneath)
+}
+
+// mkdirAllAt creates the directory rel relative to the open directory dirFd named
+// dirName, and its missing parents, with exactly the permission perm like
+// dirsync.MkdirAll
+func mkdirAllAt(dirFd int, dirName, rel string, perm os.FileMode) error {
+	created := ""
+	for _, name := range strings.Split(filepath.Clean(rel), string(filepath.Separator)) {
+		parent := created
+		if created == "" {
+			created = name
+		} else {
+			created = filepath.Join(created, name)
+		}
+		if name == "." || name == ".." {
+			continue
+		}
+
+		err := xunix.Mkdirat(dirFd, created, uint32(perm))
+		if errors.Is(err, xunix.EEXIST) {
+			// Existing, or created by someone else in between
+			var st xunix.Stat_t
+			if err := xunix.Fstatat(dirFd, created, &st, 0); err != nil || st.Mode&xunix.S_IFMT != xunix.S_IFDIR {
+				return &os.PathError{Op: "mkdir", Path: filepath.Join(dirName, created), Err: xunix.ENOTDIR}
+			}
+			continue
+		}
+		if err != nil {
+			return &os.PathError{Op: "mkdir", Path: filepath.Join(dirName, created), Err: err}
+		}
+		// The umask may have filtered perm
+		if err := xunix.Fchmodat(dirFd, created, uint32(perm), 0); err != nil {
+			return &os.PathError{Op: "chmod", Path: filepath.Join(dirName, created), Err: err}
+		}
+		if err := syncDirAt(dirFd, parent); err != nil {
+			return &os.PathError{Op: "sync", Path: filepath.Join(dirName, parent), Err: err}
+		}
+	}
+	return nil
+}
+
+// syncDirAt flushes the entries of the directory rel relative to dirFd, dirFd
+// itself if rel is ""
+func syncDirAt(dirFd int, rel string) error {
+	if rel == "" {
+		rel = "."
+	}
+	fd, err := openDirAt(dirFd, rel)
+	if err != nil {
+		return err
+	}
+	defer xunix.Close(fd)
+	return xunix.Fsync(fd)
+}
+
+// isCurrentAt reports whether the open file is still the one at rel relative to
+// the open directory dir, the isCurrent of locks created by NewAt
+func (d *flockDriver) isCurrentAt() (bool, error) {
+	var opened, onDisk xunix.Stat_t
+	if err := xunix.Fstat(int(d.file.Fd()), &opened); err != nil {
+		return false, mapError(&os.PathError{Op: "fstat", Path: d.path, Err: err})
+	}
+	err := xunix.Fstatat(int(d.at.Fd()), d.rel, &onDisk, 0)
+	if err == xunix.ENOENT {
+		return false, nil
+	}
+	if err != nil {
+		return false, mapError(&os.PathError{Op: "stat", Path: d.path, Err: err})
+	}
+	d.id = filelock.FileID{Device: uint64(opened.Dev), File: uint64(opened.Ino)}
+	return opened.Dev == onDisk.Dev && opened.Ino == onDisk.Ino, nil
+}
@@ -3,27 +3,49 @@
 package unix
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
-	"sync"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/dirsync"
+	"github.com/rsgcata/go-fs/internal/lockcore"
 )
 
 // FileLock represents a lock on a file
 type FileLock struct {
-	path   string
-	file   *os.File
-	locked bool
-	mutex  sync.Mutex
+	core *lockcore.Lock
 }
 
 // New creates a new FileLock for the specified file path
-func New(path string) *FileLock {
-	return &FileLock{
-		path:   path,
-		locked: false,
+func New(path string, opts ...filelock.Option) *FileLock {
+	o := filelock.NewOptions(opts...)
+	return &FileLock{core: lockcore.New(path, newDriver(o), o)}
+}
+
+// newDriver returns the driver taking the lock configured by o
+func newDriver(o filelock.Options) *flockDriver {
+	return &flockDriver{
+		shared:       o.Shared,
+		metadata:     o.HolderMetadata,
+		payload:      o.Payload,
+		clearPayload: o.ClearPayload,
+		pidFormat:    o.PIDFormat,
+		mandatory:    o.Mandatory,
+		noFollow:     o.NoFollow,
+		secureParent: o.SecureParent,
+		perm:         o.Perm,
+		chown:        o.Chown,
+		uid:          o.UID,
+		gid:          o.GID,
+		mkdirs:       o.CreateParents,
+		parentPerm:   o.ParentPerm,
+		root:         o.Root,
 	}
 }
 
@@ -37,116 +59,401 @@ func (fl *FileLock) Lock() error {
 // If timeout is <= 0, it's a non-blocking operation
 // If timeout is > 0, it will retry in a non-blocking manner until the timeout is reached
 func (fl *FileLock) LockWithTimeout(timeout time.Duration) error {
-	fl.mutex.Lock()
-	defer fl.mutex.Unlock()
+	return fl.core.LockWithTimeout(timeout)
+}
 
-	if fl.locked {
-		return filelock.ErrAlreadyLocked
-	}
+// Unlock releases the lock on the file
+// If the lock is not held, it returns ErrNotLocked, or nil when created with
+// filelock.WithIdempotentUnlock
+func (fl *FileLock) Unlock() error {
+	return fl.core.Unlock()
+}
+
+// UnlockWithTimeout releases the lock like Unlock, giving up after timeout when the
+// release hangs, on a stuck network file system for example: the lock is forgotten,
+// its descriptor abandoned, and an error wrapping filelock.ErrAbandoned is returned
+// ContextLock().Unlock(ctx) gives up the same way when ctx is done
+func (fl *FileLock) UnlockWithTimeout(timeout time.Duration) error {
+	return fl.core.UnlockWithTimeout(timeout)
+}
+
+// Abort interrupts the acquisitions in progress on this instance, including the
+// ones waiting for another operation on it, which return filelock.ErrAborted
+// Later acquisitions are not affected and a held lock stays held
+func (fl *FileLock) Abort() {
+	fl.core.Abort()
+}
+
+// Close releases the lock if it is held and closes the lock file kept open by
+// filelock.WithKeepOpen, if any
+func (fl *FileLock) Close() error {
+	return fl.core.Close()
+}
+
+// IsLocked returns whether the file is currently locked by this process
+func (fl *FileLock) IsLocked() bool {
+	return fl.core.IsLocked()
+}
+
+// Path returns the file path associated with this lock
+func (fl *FileLock) Path() string {
+	return fl.core.Path()
+}
+
+// AcquiredAt returns when the lock was acquired, or the zero time if it is not held
+func (fl *FileLock) AcquiredAt() time.Time {
+	return fl.core.AcquiredAt()
+}
+
+// HeldDuration returns how long the lock has been held, or 0 if it is not held
+func (fl *FileLock) HeldDuration() time.Duration {
+	return fl.core.HeldDuration()
+}
+
+// LastAcquireStats returns the number of attempts and the time spent by the most
+// recent acquisition, whether it succeeded or not
+func (fl *FileLock) LastAcquireStats() filelock.AcquireStats {
+	return fl.core.LastAcquireStats()
+}
+
+// Status returns a snapshot of the lock state, including holder and acquisition statistics
+func (fl *FileLock) Status() filelock.Status {
+	return fl.core.Status()
+}
+
+// LockFunc acquires the lock, retrying until ctx is done, and returns the function
+// releasing it, see filelock.LockFunc
+func (fl *FileLock) LockFunc(ctx context.Context) (release func() error, err error) {
+	return filelock.LockFunc(ctx, fl)
+}
 
-	var err error
-	fl.file, err = os.OpenFile(fl.path, os.O_CREATE|os.O_RDWR, 0666)
+// ContextLock returns a view of the lock whose operations take a context
+func (fl *FileLock) ContextLock() filelock.ContextLock {
+	return fl.core.ContextLock()
+}
+
+// Yield releases the lock and acquires it again after the waiters of this process,
+// if it has been held for longer than the slice of filelock.WithYield
+// It reports whether the lock was released, see filelock.Yielder
+func (fl *FileLock) Yield(ctx context.Context) (bool, error) {
+	return fl.core.Yield(ctx)
+}
+
+// String describes the lock and its current state
+func (fl *FileLock) String() string {
+	return fl.Status().String()
+}
+
+// MarshalJSON encodes the current status of the lock
+func (fl *FileLock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fl.Status())
+}
+
+// Downgrade converts the held exclusive lock to a shared one, without releasing it in between
+// It returns ErrNotLocked if the lock is not held, and nil if it is already shared
+func (fl *FileLock) Downgrade() error {
+	return fl.core.Downgrade()
+}
+
+// Upgrade converts the held shared lock to an exclusive one, retrying until the other
+// shared holders are gone or timeout is reached
+// On ErrTimeout the shared lock is still held. It returns ErrDeadlock if another instance
+// of this process is upgrading the same lock
+// A failed attempt briefly drops the shared lock (see flock(2)): if an exclusive lock is
+// taken meanwhile, the lock is lost and Upgrade returns an error wrapping ErrLockLost
+func (fl *FileLock) Upgrade(timeout time.Duration) error {
+	return fl.core.Upgrade(timeout)
+}
+
+// flockDriver locks files using flock(2)
+type flockDriver struct {
+	path     string
+	file     *os.File
+	shared   bool
+	metadata bool
+
+	// payload is written into the lock file while an exclusive lock is held
+	payload      []byte
+	clearPayload bool
+
+	// pidFormat writes the PID of the holder as the file content instead
+	pidFormat bool
+
+	// mandatory takes fcntl(2) locks enforced by the kernel instead of flock(2)
+	mandatory bool
+
+	// noFollow and secureParent refuse lock paths other users could redirect
+	noFollow     bool
+	secureParent bool
+
+	// perm is the exact permission of the lock file, or 0 for 0666 filtered by the umask
+	perm os.FileMode
+
+	// chown makes the lock file owned by uid and gid
+	chown    bool
+	uid, gid int
+
+	// mkdirs creates the missing parent directories with parentPerm
+	mkdirs     bool
+	parentPerm os.FileMode
+
+	// root is the directory the lock file must resolve beneath, if any
+	root string
+
+	// cpath is path terminated by a NUL byte, for statPath
+	cpath []byte
+
+	// at is the open directory the lock file is opened relative to, at rel, for
+	// the locks created by NewAt
+	at  *os.File
+	rel string
+
+	// recorded is where the holder metadata of the held lock was recorded
+	recorded holderStore
+
+	// id identifies the file locked by the last successful TryLock
+	id filelock.FileID
+}
+
+func (d *flockDriver) Open(path string) error {
+	perm := d.perm
+	if perm == 0 {
+		perm = 0666
+	}
+	file, err := d.openFile(path, perm)
+	if err != nil && d.mkdirs && errors.Is(err, os.ErrNotExist) {
+		if err := d.mkdirAll(path); err != nil {
+			return mapError(err)
+		}
+		file, err = d.openFile(path, perm)
+	}
 	if err != nil {
-		return err
+		return mapError(err)
 	}
+	if d.chown {
+		if err := enforceOwner(file, d.uid, d.gid); err != nil {
+			_ = file.Close()
+			return mapError(err)
+		}
+	}
+	if d.perm != 0 {
+		if err := enforcePerm(file, d.perm); err != nil {
+			_ = file.Close()
+			return mapError(err)
+		}
+	}
+	if d.mandatory {
+		if err := enableMandatory(file); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	if d.path != path {
+		d.path = path
+		d.cpath = append([]byte(path), 0)
+	}
+	d.file = file
+	return nil
+}
 
-	// Try to acquire the lock
-	err = fl.tryLock(timeout)
-	if err != nil {
-		_ = fl.file.Close()
-		fl.file = nil
-		return err
+// openFile opens the lock file at path, or relative to the directory of NewAt
+func (d *flockDriver) openFile(path string, perm os.FileMode) (*os.File, error) {
+	if d.at != nil {
+		return openLockFileAt(d.at, d.rel, path, perm, d.noFollow, d.secureParent)
 	}
+	if d.root != "" {
+		return openLockFileInRoot(d.root, path, perm, d.noFollow, d.secureParent)
+	}
+	return openLockFile(path, perm, d.noFollow, d.secureParent)
+}
 
-	fl.locked = true
-	return nil
+// mkdirAll creates the missing parent directories of the lock file at path
+func (d *flockDriver) mkdirAll(path string) error {
+	if d.at != nil {
+		return mkdirAllAt(int(d.at.Fd()), d.at.Name(), filepath.Dir(d.rel), d.parentPerm)
+	}
+	if d.root != "" {
+		return mkdirAllInRoot(d.root, filepath.Dir(path), d.parentPerm)
+	}
+	return dirsync.MkdirAll(filepath.Dir(path), d.parentPerm)
 }
 
-// tryLock attempts to acquire the lock with the specified timeout
-// It uses a non-blocking approach for all cases
-func (fl *FileLock) tryLock(timeout time.Duration) error {
-	// Try non-blocking lock first using syscall.Flock
-	// LOCK_EX = exclusive lock, LOCK_NB = non-blocking
-	err := syscall.Flock(int(fl.file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+// Clone returns an unopened driver taking the same kind of lock
+func (d *flockDriver) Clone() lockcore.Driver {
+	return &flockDriver{
+		shared:       d.shared,
+		metadata:     d.metadata,
+		payload:      d.payload,
+		clearPayload: d.clearPayload,
+		pidFormat:    d.pidFormat,
+		mandatory:    d.mandatory,
+		noFollow:     d.noFollow,
+		secureParent: d.secureParent,
+		perm:         d.perm,
+		chown:        d.chown,
+		uid:          d.uid,
+		gid:          d.gid,
+		mkdirs:       d.mkdirs,
+		parentPerm:   d.parentPerm,
+		root:         d.root,
+		at:           d.at,
+		rel:          d.rel,
+	}
+}
 
-	// If we got the lock immediately, return
-	if err == nil {
-		return nil
+// Reusable reports whether a file is open. TryLock checks that it is still the
+// file at the lock path once locked, and opens the current one if not.
+func (d *flockDriver) Reusable() bool {
+	return d.file != nil
+}
+
+func (d *flockDriver) TryLock() error {
+	// LOCK_EX = exclusive lock, LOCK_SH = shared lock, LOCK_NB = non-blocking
+	how := syscall.LOCK_EX
+	if d.shared {
+		how = syscall.LOCK_SH
 	}
 
-	// EWOULDBLOCK means the lock is held by someone else
-	if err == syscall.EWOULDBLOCK {
-		// If timeout <= 0, it's a non-blocking call, so return immediately
-		if timeout <= 0 {
+	for {
+		err := d.lockFile(how | syscall.LOCK_NB)
+
+		// EWOULDBLOCK means the lock is held by someone else
+		if isContended(err) {
 			return filelock.ErrLockHeld
 		}
+		if err != nil {
+			return mapError(err)
+		}
 
-		// For timeout > 0, retry with polling until timeout
-		startTime := time.Now()
-		retryInterval := time.Millisecond * 10 // Start with 10ms retry interval
-
-		for {
-			// Check if we've exceeded the timeout
-			if time.Since(startTime) >= timeout {
-				return filelock.ErrTimeout
-			}
-
-			// Sleep for a short interval before retrying
-			time.Sleep(retryInterval)
+		// The lock file may have been removed or replaced, e.g. by a lock garbage
+		// collector, between Open and flock: the lock would then be on a file no one
+		// else can see. Lock the file now at the path instead.
+		current, err := d.isCurrent()
+		if current && !d.shared && d.records() {
+			d.recordHolder()
+		}
+		if err != nil || current {
+			return err
+		}
+		_ = d.lockFile(syscall.LOCK_UN)
+		_ = d.file.Close()
+		if err := d.Open(d.path); err != nil {
+			return err
+		}
+	}
+}
 
-			// Increase retry interval for exponential backoff, but cap it at 100ms
-			if retryInterval < time.Millisecond*100 {
-				retryInterval = time.Duration(float64(retryInterval) * 1.5)
-			}
+// isCurrent reports whether the open file is still the one at the lock path
+// It runs on every acquisition, so it compares the raw stat results rather than
+// allocating os.FileInfo values
+func (d *flockDriver) isCurrent() (bool, error) {
+	if d.at != nil {
+		return d.isCurrentAt()
+	}
+	var opened, onDisk syscall.Stat_t
+	if err := syscall.Fstat(int(d.file.Fd()), &opened); err != nil {
+		return false, mapError(&os.PathError{Op: "fstat", Path: d.path, Err: err})
+	}
+	err := statPath(d.cpath, &onDisk)
+	if err == syscall.ENOENT {
+		return false, nil
+	}
+	if err != nil {
+		return false, mapError(&os.PathError{Op: "stat", Path: d.path, Err: err})
+	}
+	d.id = filelock.FileID{Device: uint64(opened.Dev), File: uint64(opened.Ino)}
+	return opened.Dev == onDisk.Dev && opened.Ino == onDisk.Ino, nil
+}
 
-			// Try to acquire the lock again (non-blocking)
-			err = syscall.Flock(int(fl.file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+// FileID returns the device and inode numbers of the file locked by the last
+// successful TryLock
+func (d *flockDriver) FileID() filelock.FileID {
+	return d.id
+}
 
-			// If we got the lock, return
-			if err == nil {
-				return nil
-			}
+// Convert changes the mode of the held lock. flock(2) replaces the held lock
+// atomically, except that a failed upgrade drops it: the shared lock is then
+// taken again, which fails with ErrLockLost if an exclusive lock got in between.
+func (d *flockDriver) Convert(shared bool) error {
+	how := syscall.LOCK_EX
+	if shared {
+		how = syscall.LOCK_SH
+	}
 
-			// If the error is not EWOULDBLOCK, return the error
-			if err != syscall.EWOULDBLOCK {
-				return err
-			}
+	err := d.lockFile(how | syscall.LOCK_NB)
+	if err == nil {
+		if shared {
+			d.clearHolder()
+		} else if d.records() {
+			d.recordHolder()
 		}
 	}
+	if !isContended(err) {
+		return mapError(err)
+	}
+	if err := d.lockFile(syscall.LOCK_SH | syscall.LOCK_NB); err != nil {
+		return fmt.Errorf("%w: shared lock dropped by a failed upgrade: %w", filelock.ErrLockLost, err)
+	}
+	return filelock.ErrLockHeld
+}
 
-	return err
+func (d *flockDriver) Unlock() error {
+	d.clearHolder()
+
+	// Release the lock using flock with LOCK_UN flag
+	return mapError(d.lockFile(syscall.LOCK_UN))
 }
 
-// Unlock releases the lock on the file
-func (fl *FileLock) Unlock() error {
-	fl.mutex.Lock()
-	defer fl.mutex.Unlock()
+func (d *flockDriver) Close() error {
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
 
-	if !fl.locked || fl.file == nil {
-		return filelock.ErrNotLocked
+// lockFile applies how, flock(2) operation flags, to the open file, with fcntl(2)
+// for mandatory locks
+func (d *flockDriver) lockFile(how int) error {
+	if d.mandatory {
+		return fcntlLock(d.file, how)
 	}
+	return flock(d.file, how)
+}
 
-	// Release the lock using syscall.Flock with LOCK_UN flag
-	err := syscall.Flock(int(fl.file.Fd()), syscall.LOCK_UN)
-	if err != nil {
-		return err
+// flock calls flock(2) on file, retrying when the call is interrupted by a signal
+func flock(file *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
 	}
-
-	// Close the file
-	err = fl.file.Close()
-	fl.file = nil
-	fl.locked = false
-	return err
 }
 
-// IsLocked returns whether the file is currently locked by this process
-func (fl *FileLock) IsLocked() bool {
-	fl.mutex.Lock()
-	defer fl.mutex.Unlock()
-	return fl.locked
+// isContended reports whether err is the flock(2) error for a lock held by
+// someone else, which is EWOULDBLOCK or EAGAIN depending on the platform
+func isContended(err error) bool {
+	return err == syscall.EWOULDBLOCK || err == syscall.EAGAIN
 }
 
-// Path returns the file path associated with this lock
-func (fl *FileLock) Path() string {
-	return fl.path
+// mapError translates the system errors callers may want to branch on into the
+// filelock errors, keeping the original error in the chain
+func mapError(err error) error {
+	var target error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+		target = filelock.ErrPermission
+	case errors.Is(err, syscall.ENOLCK):
+		target = filelock.ErrLockTableFull
+	case errors.Is(err, syscall.EROFS):
+		target = filelock.ErrReadOnly
+	case errors.Is(err, syscall.ENOSPC):
+		target = filelock.ErrNoSpace
+	case errors.Is(err, syscall.EISDIR):
+		target = filelock.ErrNotRegular
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %w", target, err)
 }
@@ -1,14 +1,25 @@
 package unix
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/conformance"
+	"github.com/rsgcata/go-fs/filelock/testutil"
+	"github.com/rsgcata/go-fs/internal/lockcore"
 
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -78,6 +89,517 @@ func (s *FileLockTestSuite) TestUnlockWithoutLock() {
 	s.Assert().Equal(filelock.ErrNotLocked, err)
 }
 
+// TestIdempotentUnlock tests that unlocking twice is a no-op when the option is set
+func (s *FileLockTestSuite) TestIdempotentUnlock() {
+	lockPath := filepath.Join(s.tempDir, "idempotent.lock")
+	lock := New(lockPath, filelock.WithIdempotentUnlock())
+
+	// Unlocking before locking should not fail
+	s.Require().NoError(lock.Unlock())
+
+	err := lock.Lock()
+	s.Require().NoError(err)
+
+	// Release twice, as a deferred and an explicit Unlock would
+	s.Require().NoError(lock.Unlock())
+	s.Require().NoError(lock.Unlock())
+	s.Assert().False(lock.IsLocked())
+}
+
+// TestSharedLocks tests that shared locks exclude exclusive locks but not each other
+func (s *FileLockTestSuite) TestSharedLocks() {
+	lockPath := filepath.Join(s.tempDir, "shared.lock")
+	reader1 := New(lockPath, filelock.WithShared())
+	reader2 := New(lockPath, filelock.WithShared())
+	writer := New(lockPath)
+
+	s.Require().NoError(reader1.Lock())
+	s.Require().NoError(reader2.Lock())
+	s.Assert().True(reader1.Status().Shared)
+	s.Assert().Equal(filelock.ErrLockHeld, writer.Lock())
+
+	s.Require().NoError(reader1.Unlock())
+	s.Require().NoError(reader2.Unlock())
+	s.Require().NoError(writer.Lock())
+	s.Assert().Equal(filelock.ErrLockHeld, reader1.Lock())
+	s.Require().NoError(writer.Unlock())
+}
+
+// TestDowngradeAndUpgrade tests converting a held lock between exclusive and shared
+func (s *FileLockTestSuite) TestDowngradeAndUpgrade() {
+	lockPath := filepath.Join(s.tempDir, "convert.lock")
+	writer := New(lockPath)
+	reader := New(lockPath, filelock.WithShared())
+
+	s.Require().NoError(writer.Lock())
+	s.Require().NoError(writer.Downgrade())
+	s.Require().NoError(reader.Lock(), "a downgraded lock admits readers")
+
+	s.Assert().Equal(filelock.ErrTimeout, writer.Upgrade(50*time.Millisecond))
+	s.Assert().True(writer.Status().Shared, "a timed out upgrade keeps the shared lock")
+	s.Assert().Equal(filelock.ErrLockHeld, New(lockPath).Lock())
+
+	time.AfterFunc(50*time.Millisecond, func() { _ = reader.Unlock() })
+	s.Require().NoError(writer.Upgrade(5 * time.Second))
+	s.Assert().Equal(filelock.ErrLockHeld, reader.Lock())
+	s.Require().NoError(writer.Unlock())
+}
+
+// TestUpgradeDeadlock tests that a second concurrent upgrade in the process fails fast
+func (s *FileLockTestSuite) TestUpgradeDeadlock() {
+	lockPath := filepath.Join(s.tempDir, "deadlock.lock")
+	reader1 := New(lockPath, filelock.WithShared())
+	reader2 := New(lockPath, filelock.WithShared())
+	s.Require().NoError(reader1.Lock())
+	s.Require().NoError(reader2.Lock())
+
+	upgraded := make(chan error, 1)
+	go func() { upgraded <- reader1.Upgrade(5 * time.Second) }()
+	time.Sleep(50 * time.Millisecond)
+	s.Assert().Equal(filelock.ErrDeadlock, reader2.Upgrade(5*time.Second))
+
+	s.Require().NoError(reader2.Unlock())
+	s.Require().NoError(<-upgraded)
+	s.Require().NoError(reader1.Unlock())
+}
+
+// TestHolderMetadata tests that the holder is recorded while the lock is held exclusively
+func (s *FileLockTestSuite) TestHolderMetadata() {
+	lockPath := filepath.Join(s.tempDir, "holder.lock")
+	lock := New(lockPath, filelock.WithHolderMetadata())
+
+	s.Require().NoError(lock.Lock())
+	record, err := ReadHolder(lockPath)
+	s.Require().NoError(err)
+	s.Require().NotNil(record)
+	s.Assert().Equal(filelock.CurrentHolder(), record.Holder)
+	s.Assert().WithinDuration(time.Now(), record.AcquiredAt, time.Minute)
+
+	s.Require().NoError(lock.Downgrade())
+	record, err = ReadHolder(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Nil(record, "shared holders are not recorded")
+
+	s.Require().NoError(lock.Upgrade(0))
+	s.Require().NoError(lock.Unlock())
+	record, err = ReadHolder(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Nil(record)
+}
+
+// TestReadHolderFromContent tests reading a holder recorded in the file content
+func (s *FileLockTestSuite) TestReadHolderFromContent() {
+	lockPath := filepath.Join(s.tempDir, "content.lock")
+	s.Require().NoError(os.WriteFile(lockPath, []byte(`{"pid":42,"hostname":"db1","acquired_at":"2025-01-01T00:00:00Z"}`), 0644))
+
+	record, err := ReadHolder(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Equal(filelock.Holder{PID: 42, Hostname: "db1"}, record.Holder)
+
+	s.Require().NoError(os.WriteFile(lockPath, []byte("application data"), 0644))
+	_, err = ReadHolder(lockPath)
+	s.Assert().Error(err)
+}
+
+// TestPIDFormat tests that the lock file holds the PID line while the lock is held,
+// and that PID lines written by other tools are read
+func (s *FileLockTestSuite) TestPIDFormat() {
+	lockPath := filepath.Join(s.tempDir, "pid.lock")
+	lock := New(lockPath, filelock.WithPIDFormat())
+
+	s.Require().NoError(lock.Lock())
+	content, err := os.ReadFile(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Equal(fmt.Sprintf("%d\n", os.Getpid()), string(content))
+	pid, err := ReadPID(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.Getpid(), pid)
+	record, err := ReadHolder(lockPath)
+	s.Require().NoError(err)
+	s.Require().NotNil(record)
+	s.Assert().Equal(os.Getpid(), record.PID)
+
+	s.Require().NoError(lock.Unlock())
+	pid, err = ReadPID(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Zero(pid, "the PID is removed on release")
+
+	s.Require().NoError(os.WriteFile(lockPath, []byte("      4242\n"), 0644))
+	pid, err = ReadPID(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Equal(4242, pid)
+}
+
+// TestAcquireResult tests that acquisitions report the contention and the holder
+// found by their first attempt
+func (s *FileLockTestSuite) TestAcquireResult() {
+	lockPath := filepath.Join(s.tempDir, "result.lock")
+	holder := New(lockPath, filelock.WithHolderMetadata())
+	waiter := New(lockPath)
+
+	result, err := filelock.Acquire(context.Background(), waiter)
+	s.Require().NoError(err)
+	s.Assert().Equal(1, result.Attempts)
+	s.Assert().False(result.Contended)
+	s.Assert().Nil(result.HolderBefore)
+	s.Assert().Zero(result.FencingToken)
+	s.Require().NoError(waiter.Unlock())
+
+	s.Require().NoError(holder.Lock())
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	result, err = filelock.Acquire(ctx, waiter)
+	s.Assert().ErrorIs(err, context.DeadlineExceeded)
+	s.Assert().True(result.Contended)
+	s.Require().NotNil(result.HolderBefore)
+	s.Assert().Equal(os.Getpid(), result.HolderBefore.PID)
+
+	time.AfterFunc(30*time.Millisecond, func() { _ = holder.Unlock() })
+	result, err = filelock.Acquire(context.Background(), waiter)
+	s.Require().NoError(err)
+	s.Assert().True(result.Contended)
+	s.Assert().Greater(result.Attempts, 1)
+	s.Assert().GreaterOrEqual(result.Waited, 20*time.Millisecond)
+	s.Require().NotNil(result.HolderBefore)
+	s.Assert().Equal(os.Getpid(), result.HolderBefore.PID)
+	s.Assert().Equal(result.HolderBefore, waiter.Status().LastAcquire.HolderBefore)
+	s.Require().NoError(waiter.Unlock())
+
+	// Canceled right after a first attempt finding the lock held, with no
+	// holder recorded
+	plain := New(lockPath)
+	s.Require().NoError(plain.Lock())
+	defer plain.Unlock()
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond, cancel)
+	result, err = filelock.Acquire(ctx, waiter)
+	s.Assert().ErrorIs(err, context.Canceled)
+	s.Assert().True(result.Contended)
+	s.Assert().Nil(result.HolderBefore)
+	s.Assert().True(waiter.LastAcquireStats().Contended)
+}
+
+// TestAdjustableDeadline tests that an acquisition keeps waiting when its
+// deadline is extended, and gives up when it is shortened
+func (s *FileLockTestSuite) TestAdjustableDeadline() {
+	lockPath := filepath.Join(s.tempDir, "deadline.lock")
+	holder, waiter := New(lockPath), New(lockPath)
+	s.Require().NoError(holder.Lock())
+
+	ctx, cancel := filelock.WithAdjustableDeadline(context.Background(), time.Now().Add(50*time.Millisecond))
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- waiter.ContextLock().Lock(ctx) }()
+
+	time.Sleep(20 * time.Millisecond)
+	s.Require().True(ctx.Extend(time.Second))
+	deadline, ok := ctx.Deadline()
+	s.Assert().True(ok)
+	s.Assert().WithinDuration(time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+
+	time.Sleep(80 * time.Millisecond)
+	s.Require().NoError(holder.Unlock())
+	s.Require().NoError(<-done)
+	s.Assert().Greater(waiter.LastAcquireStats().Attempts, 1, "the acquisition was not restarted")
+	s.Require().NoError(waiter.Unlock())
+
+	s.Require().NoError(holder.Lock())
+	ctx, cancel = filelock.WithAdjustableDeadline(context.Background(), time.Now().Add(time.Minute))
+	defer cancel()
+	go func() { done <- waiter.ContextLock().Lock(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	s.Require().True(ctx.SetDeadline(time.Now()))
+	s.Assert().ErrorIs(<-done, context.DeadlineExceeded)
+	s.Assert().Less(time.Since(start), time.Second)
+	s.Assert().False(ctx.Extend(time.Minute), "a done context stays done")
+	s.Require().NoError(holder.Unlock())
+}
+
+// TestPayload tests that the payload is written into the lock file while the lock is held
+func (s *FileLockTestSuite) TestPayload() {
+	lockPath := filepath.Join(s.tempDir, "payload.lock")
+	payload := []byte(`{"job":"nightly-42"}`)
+
+	kept := New(lockPath, filelock.WithPayload(payload, false))
+	s.Require().NoError(kept.Lock())
+	record, err := ReadHolder(lockPath)
+	s.Require().NoError(err)
+	s.Require().NotNil(record)
+	s.Assert().Equal(payload, record.Payload)
+	s.Assert().Equal(filelock.CurrentHolder(), record.Holder)
+
+	content, err := os.ReadFile(lockPath)
+	s.Require().NoError(err)
+	var fromContent filelock.HolderRecord
+	s.Require().NoError(json.Unmarshal(content, &fromContent))
+	s.Assert().Equal(payload, fromContent.Payload)
+
+	s.Require().NoError(kept.Unlock())
+	record, err = ReadHolder(lockPath)
+	s.Require().NoError(err)
+	s.Require().NotNil(record, "the payload is kept on release")
+	s.Assert().Equal(payload, record.Payload)
+
+	cleared := New(lockPath, filelock.WithPayload([]byte("short"), true), filelock.WithHolderMetadata())
+	s.Require().NoError(cleared.Lock())
+	record, err = ReadHolder(lockPath)
+	s.Require().NoError(err)
+	s.Require().NotNil(record)
+	s.Assert().Equal([]byte("short"), record.Payload, "the previous payload is fully replaced")
+	s.Assert().Equal(filelock.CurrentHolder(), record.Holder)
+
+	s.Require().NoError(cleared.Unlock())
+	record, err = ReadHolder(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Nil(record, "the payload is cleared on release")
+}
+
+// TestReadHolderContent tests reading the payload while the holder rewrites it
+func (s *FileLockTestSuite) TestReadHolderContent() {
+	lockPath := filepath.Join(s.tempDir, "content-reader.lock")
+	lock := New(lockPath, filelock.WithPayload([]byte("a much longer first payload"), false), filelock.WithHolderMetadata())
+	s.Require().NoError(lock.Lock())
+
+	record, err := ReadHolderContent(lockPath)
+	s.Require().NoError(err)
+	s.Require().NotNil(record)
+	s.Assert().Equal([]byte("a much longer first payload"), record.Payload)
+	s.Assert().Equal(filelock.CurrentHolder(), record.Holder)
+	s.Assert().True(lock.IsLocked(), "reading does not disturb the holder")
+	s.Require().NoError(lock.Unlock())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			rewriter := New(lockPath, filelock.WithPayload([]byte(fmt.Sprintf("p%d", i)), i%2 == 0))
+			if rewriter.Lock() == nil {
+				_ = rewriter.Unlock()
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		_, err := ReadHolderContent(lockPath)
+		s.Require().NoError(err, "a rewritten content is read again")
+	}
+}
+
+// TestReadHolderContentMetadataOnly tests that the extended attribute is read for an empty lock file
+func (s *FileLockTestSuite) TestReadHolderContentMetadataOnly() {
+	lockPath := filepath.Join(s.tempDir, "metadata-only.lock")
+	lock := New(lockPath, filelock.WithHolderMetadata())
+	s.Require().NoError(lock.Lock())
+	defer lock.Unlock()
+
+	record, err := ReadHolderContent(lockPath)
+	s.Require().NoError(err)
+	s.Require().NotNil(record)
+	s.Assert().Equal(filelock.CurrentHolder(), record.Holder)
+	s.Assert().Nil(record.Payload)
+}
+
+// TestNoFollow tests that a symbolic link is not locked nor created through
+func (s *FileLockTestSuite) TestNoFollow() {
+	target := filepath.Join(s.tempDir, "target")
+	link := filepath.Join(s.tempDir, "link.lock")
+	s.Require().NoError(os.Symlink(target, link))
+
+	err := New(link, filelock.WithNoFollow()).Lock()
+	s.Assert().ErrorIs(err, filelock.ErrUnsafePath)
+	s.Assert().NoFileExists(target, "the dangling link target is not created")
+
+	err = New(link, filelock.WithNoFollow(), filelock.WithSecureParent()).Lock()
+	s.Assert().ErrorIs(err, filelock.ErrUnsafePath)
+
+	lock := New(filepath.Join(s.tempDir, "regular.lock"), filelock.WithNoFollow())
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestSecureParent tests that locks are refused in directories other users can write to
+func (s *FileLockTestSuite) TestSecureParent() {
+	dir := filepath.Join(s.tempDir, "shared")
+	s.Require().NoError(os.Mkdir(dir, 0755))
+	lockPath := filepath.Join(dir, "secure.lock")
+
+	lock := New(lockPath, filelock.WithSecureParent())
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+
+	s.Require().NoError(os.Chmod(dir, 0777))
+	err := lock.Lock()
+	s.Assert().ErrorIs(err, filelock.ErrUnsafePath)
+	s.Assert().Contains(err.Error(), "writable by other users")
+
+	s.Require().NoError(os.Chmod(dir, 0777|os.ModeSticky))
+	s.Require().NoError(lock.Lock(), "the sticky bit keeps others from replacing the lock file")
+	s.Require().NoError(lock.Unlock())
+
+	_, err = os.Stat(lockPath)
+	s.Assert().NoError(err)
+}
+
+// TestPerm tests that the lock file gets exactly the requested permission, regardless of the umask
+func (s *FileLockTestSuite) TestPerm() {
+	defer syscall.Umask(syscall.Umask(0o077))
+
+	lockPath := filepath.Join(s.tempDir, "perm.lock")
+	lock := New(lockPath, filelock.WithPerm(0o666))
+	s.Require().NoError(lock.Lock())
+	info, err := os.Stat(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0o666), info.Mode().Perm())
+	s.Require().NoError(lock.Unlock())
+
+	s.Require().NoError(os.Chmod(lockPath, 0o600))
+	lock = New(lockPath, filelock.WithPerm(0o660), filelock.WithSecureParent())
+	s.Require().NoError(lock.Lock())
+	info, err = os.Stat(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0o660), info.Mode().Perm(), "an existing file of the owner is changed")
+	s.Require().NoError(lock.Unlock())
+
+	defaultPath := filepath.Join(s.tempDir, "default.lock")
+	s.Require().NoError(New(defaultPath).Lock())
+	info, err = os.Stat(defaultPath)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0o600), info.Mode().Perm(), "the default is filtered by the umask")
+}
+
+// TestOwner tests that a lock file created by root is handed over to the service user
+func (s *FileLockTestSuite) TestOwner() {
+	if os.Geteuid() != 0 {
+		s.T().Skip("only root can change the owner of a file")
+	}
+	const nobody = 65534
+
+	lockPath := filepath.Join(s.tempDir, "owned.lock")
+	lock := New(lockPath, filelock.WithOwner(nobody, -1), filelock.WithPerm(0o600))
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+
+	var st syscall.Stat_t
+	s.Require().NoError(syscall.Stat(lockPath, &st))
+	s.Assert().EqualValues(nobody, st.Uid)
+	s.Assert().EqualValues(0, st.Gid, "a -1 gid leaves the group unchanged")
+	s.Assert().EqualValues(0o600, st.Mode&0o777)
+}
+
+// TestNotRegular tests that directories, named pipes and devices are refused without hanging
+func (s *FileLockTestSuite) TestNotRegular() {
+	dir := filepath.Join(s.tempDir, "dir.lock")
+	s.Require().NoError(os.Mkdir(dir, 0755))
+	fifo := filepath.Join(s.tempDir, "fifo.lock")
+	s.Require().NoError(syscall.Mkfifo(fifo, 0644))
+
+	cases := map[string]string{
+		dir:        "directory",
+		fifo:       "named pipe",
+		os.DevNull: "character device",
+	}
+	for path, kind := range cases {
+		for _, opts := range [][]filelock.Option{nil, {filelock.WithSecureParent()}} {
+			err := New(path, opts...).LockWithTimeout(time.Second)
+			s.Assert().ErrorIs(err, filelock.ErrNotRegular, path)
+			s.Assert().ErrorContains(err, kind)
+		}
+	}
+}
+
+// TestYield tests that a lock held past its slice lets the waiters of the process
+// go first, and is not released without waiters or before its slice
+func (s *FileLockTestSuite) TestYield() {
+	lockPath := filepath.Join(s.tempDir, "yield.lock")
+	holder := New(lockPath, filelock.WithYield(20*time.Millisecond))
+	s.Require().NoError(holder.Lock())
+	defer holder.Unlock()
+
+	yielded, err := holder.Yield(context.Background())
+	s.Require().NoError(err)
+	s.Assert().False(yielded, "the slice is not over")
+
+	time.Sleep(30 * time.Millisecond)
+	yielded, err = holder.Yield(context.Background())
+	s.Require().NoError(err)
+	s.Assert().False(yielded, "nobody is waiting")
+
+	waiter := New(lockPath)
+	var took atomic.Bool
+	acquired := make(chan error, 1)
+	go func() {
+		err := waiter.LockWithTimeout(5 * time.Second)
+		if err == nil {
+			took.Store(true)
+			time.Sleep(10 * time.Millisecond)
+			err = waiter.Unlock()
+		}
+		acquired <- err
+	}()
+	s.Require().Eventually(func() bool {
+		return waiter.Status().State == filelock.Acquiring
+	}, time.Second, time.Millisecond)
+
+	yielded, err = holder.Yield(context.Background())
+	s.Require().NoError(err)
+	s.Assert().True(yielded)
+	s.Assert().True(holder.IsLocked())
+	s.Assert().True(took.Load(), "the waiter took the lock first")
+	s.Assert().NoError(<-acquired)
+
+	s.Require().NoError(holder.Unlock())
+	_, err = holder.Yield(context.Background())
+	s.Assert().ErrorIs(err, filelock.ErrNotLocked)
+}
+
+// TestCreateParents tests that missing parent directories are created with the requested permission
+func (s *FileLockTestSuite) TestCreateParents() {
+	defer syscall.Umask(syscall.Umask(0o077))
+
+	lockPath := filepath.Join(s.tempDir, "lib", "myapp", "locks", "job-42.lock")
+	s.Assert().ErrorIs(New(lockPath).Lock(), os.ErrNotExist)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path := filepath.Join(filepath.Dir(lockPath), fmt.Sprintf("job-%d.lock", i))
+			lock := New(path, filelock.WithCreateParents(0o755))
+			err := lock.Lock()
+			if err == nil {
+				err = lock.Unlock()
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		s.Assert().NoError(err, "concurrent creations of the parents succeed")
+	}
+
+	for _, dir := range []string{"lib", "lib/myapp", "lib/myapp/locks"} {
+		info, err := os.Stat(filepath.Join(s.tempDir, dir))
+		s.Require().NoError(err)
+		s.Assert().Equal(os.FileMode(0o755), info.Mode().Perm(), dir)
+	}
+
+	s.Require().NoError(os.Chmod(filepath.Join(s.tempDir, "lib"), 0o700))
+	lock := New(lockPath, filelock.WithCreateParents(0o755))
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+	info, err := os.Stat(filepath.Join(s.tempDir, "lib"))
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0o700), info.Mode().Perm(), "existing directories are left as they are")
+}
+
 // TestConcurrentLocks tests that concurrent locks work as expected
 func (s *FileLockTestSuite) TestConcurrentLocks() {
 	lockPath := filepath.Join(s.tempDir, "concurrent.lock")
@@ -138,6 +660,91 @@ func (s *FileLockTestSuite) TestLockWithTimeout() {
 	s.Require().NoError(err)
 }
 
+// TestAcquireStats tests the acquisition time and attempt statistics
+func (s *FileLockTestSuite) TestAcquireStats() {
+	lockPath := filepath.Join(s.tempDir, "stats.lock")
+	lock := New(lockPath)
+
+	s.Assert().True(lock.AcquiredAt().IsZero())
+	s.Assert().Zero(lock.HeldDuration())
+
+	before := time.Now()
+	err := lock.Lock()
+	s.Require().NoError(err)
+	s.Assert().False(lock.AcquiredAt().Before(before))
+	s.Assert().Equal(1, lock.LastAcquireStats().Attempts)
+
+	time.Sleep(10 * time.Millisecond)
+	s.Assert().GreaterOrEqual(lock.HeldDuration(), 10*time.Millisecond)
+
+	// A contended acquisition records every attempt and the time waited
+	lock2 := New(lockPath)
+	err = lock2.LockWithTimeout(100 * time.Millisecond)
+	s.Require().Equal(filelock.ErrTimeout, err)
+	stats := lock2.LastAcquireStats()
+	s.Assert().Greater(stats.Attempts, 1)
+	s.Assert().GreaterOrEqual(stats.Waited, 100*time.Millisecond)
+
+	err = lock.Unlock()
+	s.Require().NoError(err)
+	s.Assert().True(lock.AcquiredAt().IsZero())
+	s.Assert().Zero(lock.HeldDuration())
+}
+
+// TestStatusStringAndJSON tests the printable and JSON forms of the lock status
+func (s *FileLockTestSuite) TestStatusStringAndJSON() {
+	lockPath := filepath.Join(s.tempDir, "status.lock")
+	lock := New(lockPath)
+
+	s.Assert().Equal(filelock.Unlocked, lock.Status().State)
+	s.Assert().Equal(lockPath+": unlocked", lock.String())
+
+	err := lock.Lock()
+	s.Require().NoError(err)
+	defer lock.Unlock()
+
+	status := lock.Status()
+	s.Assert().Equal(filelock.Locked, status.State)
+	s.Require().NotNil(status.Holder)
+	s.Assert().Equal(os.Getpid(), status.Holder.PID)
+	s.Assert().Contains(lock.String(), "locked by pid")
+
+	data, err := json.Marshal(lock)
+	s.Require().NoError(err)
+
+	var decoded map[string]any
+	s.Require().NoError(json.Unmarshal(data, &decoded))
+	s.Assert().Equal(lockPath, decoded["path"])
+	s.Assert().Equal("locked", decoded["state"])
+	s.Assert().Contains(decoded, "holder")
+	s.Assert().Contains(decoded, "held_for")
+	s.Assert().Contains(decoded, "last_acquire")
+}
+
+// TestWaitProfilerLabels tests that goroutines waiting for a lock carry pprof labels
+func (s *FileLockTestSuite) TestWaitProfilerLabels() {
+	lockPath := filepath.Join(s.tempDir, "labels.lock")
+
+	lock1 := New(lockPath)
+	s.Require().NoError(lock1.Lock())
+	defer lock1.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = New(lockPath).LockWithTimeout(300 * time.Millisecond)
+	}()
+
+	s.Assert().Eventually(func() bool {
+		var profile strings.Builder
+		_ = pprof.Lookup("goroutine").WriteTo(&profile, 1)
+		return strings.Contains(profile.String(), `"`+filelock.LabelPath+`":"`+lockPath+`"`) &&
+			strings.Contains(profile.String(), `"`+filelock.LabelPhase+`":"`+filelock.PhaseBackoff+`"`)
+	}, 250*time.Millisecond, 10*time.Millisecond)
+
+	<-done
+}
+
 // TestNonBlockingBehavior tests that LockWithTimeout doesn't block threads indefinitely
 func (s *FileLockTestSuite) TestNonBlockingBehavior() {
 	lockPath := filepath.Join(s.tempDir, "nonblocking.lock")
@@ -222,6 +829,235 @@ func (s *FileLockTestSuite) TestThreadSafety() {
 	s.Assert().False(lock.IsLocked())
 }
 
+// TestCrossProcessStress tests mutual exclusion between real processes
+func (s *FileLockTestSuite) TestCrossProcessStress() {
+	testutil.Stress(s.T(), func(path string) filelock.FileLock {
+		return New(path)
+	}, testutil.StressConfig{})
+}
+
+// TestRemovedLockFile tests that a lock file removed before being locked is recreated and locked
+func (s *FileLockTestSuite) TestRemovedLockFile() {
+	lockPath := filepath.Join(s.tempDir, "removed.lock")
+	driver := &flockDriver{}
+	s.Require().NoError(driver.Open(lockPath))
+	defer driver.Close()
+
+	// A garbage collector removes the idle lock file between Open and TryLock
+	s.Require().NoError(os.Remove(lockPath))
+	s.Require().NoError(driver.TryLock())
+
+	current, err := driver.isCurrent()
+	s.Require().NoError(err)
+	s.Assert().True(current)
+	s.Assert().Equal(filelock.ErrLockHeld, New(lockPath).Lock())
+}
+
+// TestNewAt tests locking relative to an open directory, which keeps locking the
+// same files once the directory is renamed
+func (s *FileLockTestSuite) TestNewAt() {
+	dirPath := filepath.Join(s.tempDir, "state")
+	s.Require().NoError(os.Mkdir(dirPath, 0755))
+	dir, err := os.Open(dirPath)
+	s.Require().NoError(err)
+	defer dir.Close()
+
+	lock := NewAt(dir, filepath.Join("locks", "job.lock"), filelock.WithCreateParents(0700))
+	s.Assert().Equal(filepath.Join(dirPath, "locks", "job.lock"), lock.Path())
+	s.Require().NoError(lock.Lock())
+	info, err := os.Stat(filepath.Join(dirPath, "locks"))
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0700), info.Mode().Perm())
+	s.Assert().Equal(filelock.ErrLockHeld, New(filepath.Join(dirPath, "locks", "job.lock")).Lock())
+	s.Require().NoError(lock.Unlock())
+
+	moved := filepath.Join(s.tempDir, "moved")
+	s.Require().NoError(os.Rename(dirPath, moved))
+	s.Require().NoError(lock.Lock(), "the lock follows the open directory")
+	s.Assert().Equal(filelock.ErrLockHeld, New(filepath.Join(moved, "locks", "job.lock")).Lock())
+	s.Require().NoError(lock.Unlock())
+
+	s.Assert().ErrorIs(NewAt(dir, filepath.Join(s.tempDir, "abs.lock")).Lock(), filelock.ErrUnsafePath)
+}
+
+// TestKeepOpen tests that the lock file stays open across cycles and follows a replaced file
+func (s *FileLockTestSuite) TestKeepOpen() {
+	lockPath := filepath.Join(s.tempDir, "keepopen.lock")
+	driver := &flockDriver{}
+	lock := &FileLock{core: lockcore.New(lockPath, driver, filelock.NewOptions(filelock.WithKeepOpen()))}
+	defer lock.Close()
+
+	s.Require().NoError(lock.Lock())
+	file := driver.file
+	s.Require().NoError(lock.Unlock())
+	other := New(lockPath)
+	s.Require().NoError(other.Lock(), "the kept file is unlocked")
+	s.Require().NoError(other.Unlock())
+	s.Require().NoError(lock.Lock())
+	s.Assert().Same(file, driver.file)
+	s.Require().NoError(lock.Unlock())
+
+	// The idle lock file is removed, the next acquisition locks the new one
+	s.Require().NoError(os.Remove(lockPath))
+	s.Require().NoError(lock.Lock())
+	s.Assert().NotSame(file, driver.file)
+	s.Assert().Equal(filelock.ErrLockHeld, New(lockPath).Lock())
+
+	s.Require().NoError(lock.Close())
+	s.Assert().False(lock.IsLocked())
+	s.Assert().Nil(driver.file)
+	s.Require().NoError(other.Lock())
+	s.Require().NoError(other.Unlock())
+}
+
+// TestKeepOpenAllocations tests that an uncontended cycle on a kept lock file does not allocate
+func (s *FileLockTestSuite) TestKeepOpenAllocations() {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		s.T().Skip("the lock file is revalidated without allocating on linux/amd64 and linux/arm64 only")
+	}
+	lock := New(filepath.Join(s.tempDir, "allocs.lock"), filelock.WithKeepOpen())
+	defer lock.Close()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = lock.Lock()
+		_ = lock.Unlock()
+	})
+	s.Assert().Zero(allocs)
+}
+
+// TestCoalescedShared tests that the shared locks of the process share one descriptor
+func (s *FileLockTestSuite) TestCoalescedShared() {
+	lockPath := filepath.Join(s.tempDir, "coalesced.lock")
+	exclusive := New(lockPath)
+	openFiles := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			s.T().Skip("open descriptors cannot be listed")
+		}
+		return len(entries)
+	}
+
+	before := openFiles()
+	var locks []*FileLock
+	for range 5 {
+		lock := New(lockPath, filelock.WithShared(), filelock.WithCoalescedShared())
+		s.Require().NoError(lock.Lock())
+		locks = append(locks, lock)
+	}
+	s.Assert().Equal(before+1, openFiles())
+	s.Assert().Equal(filelock.ErrLockHeld, exclusive.Lock())
+
+	for _, lock := range locks[1:] {
+		s.Require().NoError(lock.Unlock())
+	}
+	s.Assert().Equal(filelock.ErrLockHeld, exclusive.Lock())
+	s.Require().NoError(locks[0].Unlock())
+	s.Assert().Equal(before, openFiles())
+	s.Require().NoError(exclusive.Lock())
+	s.Require().NoError(exclusive.Unlock())
+}
+
+// TestContextLock tests the context-taking view of the lock and the adapters
+func (s *FileLockTestSuite) TestContextLock() {
+	lockPath := filepath.Join(s.tempDir, "context.lock")
+	holder := New(lockPath)
+	s.Require().NoError(holder.Lock())
+
+	for name, lock := range map[string]filelock.ContextLock{
+		"native":  filelock.AsContextLock(New(lockPath)),
+		"adapter": filelock.AsContextLock(struct{ filelock.FileLock }{New(lockPath)}),
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		s.Assert().ErrorIs(lock.Lock(ctx), context.DeadlineExceeded, name)
+		cancel()
+		s.Assert().Equal(filelock.ErrLockHeld, lock.TryLock(context.Background()), name)
+
+		held, err := lock.Probe(context.Background())
+		s.Require().NoError(err, name)
+		s.Assert().True(held, name)
+	}
+
+	s.Require().NoError(holder.Unlock())
+	lock := New(lockPath).ContextLock()
+	held, err := lock.Probe(context.Background())
+	s.Require().NoError(err)
+	s.Assert().False(held)
+	s.Require().NoError(lock.Lock(context.Background()))
+	s.Assert().Equal(filelock.ErrLockHeld, holder.Lock())
+	s.Require().NoError(lock.Unlock(context.Background()))
+}
+
+// TestLockFunc tests the release closure returned by LockFunc
+func (s *FileLockTestSuite) TestLockFunc() {
+	lockPath := filepath.Join(s.tempDir, "lockfunc.lock")
+	lock := New(lockPath)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	release, err := lock.LockFunc(ctx)
+	s.Require().NoError(err)
+	s.Assert().True(lock.IsLocked())
+
+	timeoutCtx, cancelTimeout := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelTimeout()
+	failed, err := New(lockPath).LockFunc(timeoutCtx)
+	s.Require().ErrorIs(err, context.DeadlineExceeded)
+	s.Assert().NoError(failed(), "the release of a failed acquisition is a no-op")
+
+	cancel()
+	s.Require().NoError(release(), "the lock is released after ctx is done")
+	s.Assert().False(lock.IsLocked())
+	s.Assert().NoError(release(), "only the first call releases")
+}
+
+// TestContextConformance runs the conformance checks against the FileLock adapter of the
+// context-taking view
+func (s *FileLockTestSuite) TestContextConformance() {
+	conformance.Run(s.T(), func(path string, opts ...filelock.Option) filelock.FileLock {
+		return filelock.AsFileLock(New(path, opts...).ContextLock())
+	}, conformance.Config{Shared: true})
+}
+
+// TestIsContended tests the normalization of the flock contention errors
+func (s *FileLockTestSuite) TestIsContended() {
+	s.Assert().True(isContended(syscall.EWOULDBLOCK))
+	s.Assert().True(isContended(syscall.EAGAIN))
+	s.Assert().False(isContended(syscall.EINTR))
+	s.Assert().False(isContended(nil))
+}
+
+// TestMapError tests the translation of system errors into filelock errors
+func (s *FileLockTestSuite) TestMapError() {
+	cases := map[syscall.Errno]error{
+		syscall.EACCES: filelock.ErrPermission,
+		syscall.EPERM:  filelock.ErrPermission,
+		syscall.ENOLCK: filelock.ErrLockTableFull,
+		syscall.EROFS:  filelock.ErrReadOnly,
+		syscall.ENOSPC: filelock.ErrNoSpace,
+	}
+	for errno, want := range cases {
+		err := mapError(&os.PathError{Op: "open", Path: "x.lock", Err: errno})
+		s.Assert().ErrorIs(err, want)
+		s.Assert().ErrorIs(err, errno)
+		s.Assert().NotEmpty(filelock.Hint(err))
+	}
+
+	other := errors.New("other")
+	s.Assert().Equal(other, mapError(other))
+	s.Assert().Nil(mapError(nil))
+}
+
+// TestPermissionDenied tests that opening a lock file without permission returns ErrPermission
+func (s *FileLockTestSuite) TestPermissionDenied() {
+	if os.Geteuid() == 0 {
+		s.T().Skip("permissions are not enforced for root")
+	}
+	lockPath := filepath.Join(s.tempDir, "readonly.lock")
+	s.Require().NoError(os.WriteFile(lockPath, nil, 0400))
+
+	err := New(lockPath).Lock()
+	s.Assert().ErrorIs(err, filelock.ErrPermission)
+}
+
 // TestUnixSpecificBehavior tests Unix-specific behavior of file locks
 func (s *FileLockTestSuite) TestUnixSpecificBehavior() {
 	lockPath := filepath.Join(s.tempDir, "unix-specific.lock")
@@ -240,6 +1076,43 @@ func (s *FileLockTestSuite) TestUnixSpecificBehavior() {
 	s.Require().NoError(err)
 }
 
+// TestRemoteHolder tests the locks held and left by another process
+func (s *FileLockTestSuite) TestRemoteHolder() {
+	remote := testutil.StartRemote(s.T(), func(path string) filelock.FileLock {
+		return New(path)
+	})
+	lockPath := filepath.Join(s.tempDir, "remote.lock")
+	lock := New(lockPath)
+
+	s.Require().NoError(remote.Lock(lockPath))
+	s.Assert().Equal(filelock.ErrLockHeld, lock.Lock())
+	s.Assert().ErrorIs(remote.Lock(lockPath), filelock.ErrAlreadyLocked)
+	s.Require().NoError(remote.Unlock(lockPath))
+	s.Assert().ErrorIs(remote.Unlock(lockPath), filelock.ErrNotLocked)
+
+	s.Require().NoError(lock.Lock())
+	s.Assert().ErrorIs(remote.LockWithTimeout(lockPath, 30*time.Millisecond), filelock.ErrTimeout)
+	s.Require().NoError(lock.Unlock())
+
+	s.Require().NoError(remote.Hold(lockPath, 50*time.Millisecond))
+	s.Require().NoError(lock.LockWithTimeout(time.Second))
+	s.Require().NoError(lock.Unlock())
+
+	// The system releases the locks of a crashed process
+	s.Require().NoError(remote.Lock(lockPath))
+	s.Require().NoError(remote.Kill())
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+	s.Assert().Error(remote.Lock(lockPath))
+}
+
+// TestConformance runs the conformance checks shared by all the backends
+func (s *FileLockTestSuite) TestConformance() {
+	conformance.Run(s.T(), func(path string, opts ...filelock.Option) filelock.FileLock {
+		return New(path, opts...)
+	}, conformance.Config{Shared: true})
+}
+
 // TestFileLock runs the test suite
 func TestFileLock(t *testing.T) {
 	suite.Run(t, new(FileLockTestSuite))
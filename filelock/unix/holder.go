@@ -0,0 +1,223 @@
+package unix
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// HolderXattr is the extended attribute holding the metadata recorded by
+// filelock.WithHolderMetadata
+const HolderXattr = "user.go-fs.holder"
+
+// holderStore is a set of places where the holder metadata of a lock is recorded
+type holderStore int
+
+const (
+	inXattr holderStore = 1 << iota
+	inContent
+
+	notRecorded holderStore = 0
+)
+
+// records reports whether the holder is recorded on the lock file while an
+// exclusive lock is held
+func (d *flockDriver) records() bool {
+	return d.metadata || d.payload != nil || d.pidFormat
+}
+
+// recordHolder records the holder of the held lock, in the extended attribute if
+// the file system supports it and in the file content otherwise. The payload, if
+// any, is recorded with the holder and always written in the file content too.
+// With pidFormat the file content is the PID line, and the holder and the payload
+// are only recorded in the extended attribute.
+// Failing to record the holder does not fail the lock, it only hides the holder.
+func (d *flockDriver) recordHolder() {
+	if d.pidFormat {
+		d.recordPID()
+		return
+	}
+	record := filelock.HolderRecord{
+		Holder:     filelock.CurrentHolder(),
+		AcquiredAt: time.Now(),
+		Payload:    d.payload,
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if d.metadata && setXattr(d.file, HolderXattr, data) == nil {
+		d.recorded |= inXattr
+		if d.payload == nil {
+			return
+		}
+	}
+	if writeContent(d.file, data) == nil {
+		d.recorded |= inContent
+	}
+}
+
+// recordPID writes the PID line of the current process as the file content, and
+// the holder metadata in the extended attribute if requested
+func (d *flockDriver) recordPID() {
+	if d.metadata || d.payload != nil {
+		record := filelock.HolderRecord{
+			Holder:     filelock.CurrentHolder(),
+			AcquiredAt: time.Now(),
+			Payload:    d.payload,
+		}
+		if data, err := json.Marshal(record); err == nil && setXattr(d.file, HolderXattr, data) == nil {
+			d.recorded |= inXattr
+		}
+	}
+	line := strconv.Itoa(filelock.CurrentHolder().PID) + "\n"
+	if writeContent(d.file, []byte(line)) == nil {
+		d.recorded |= inContent
+	}
+}
+
+// writeContent replaces the content of file with data. The new content is
+// written before the file is truncated to its size, so readers see the previous
+// content, data followed by the end of the previous content, or data, and never
+// an empty file in between
+func writeContent(file *os.File, data []byte) error {
+	if _, err := file.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return file.Truncate(int64(len(data)))
+}
+
+// clearHolder removes the holder metadata recorded by recordHolder, if any, and
+// the payload if it is cleared on release
+func (d *flockDriver) clearHolder() {
+	if d.recorded&inXattr != 0 {
+		_ = removeXattr(d.file, HolderXattr)
+	}
+	if d.recorded&inContent != 0 && (d.payload == nil || d.clearPayload || d.pidFormat) {
+		_ = d.file.Truncate(0)
+	}
+	d.recorded = notRecorded
+}
+
+// ReadHolder returns the holder recorded on the lock file at path by a lock created
+// with filelock.WithHolderMetadata, or nil if none is recorded
+// The record is left behind by a holder that crashed, so it only identifies the
+// holder while the lock is actually held.
+func ReadHolder(path string) (*filelock.HolderRecord, error) {
+	if record, err := readXattrHolder(path); err != nil || record != nil {
+		return record, err
+	}
+	return ReadHolderContent(path)
+}
+
+// ReadHolder returns the holder recorded on the lock file held by someone else,
+// or nil if none is recorded or it cannot be read
+func (d *flockDriver) ReadHolder() *filelock.HolderRecord {
+	record, err := ReadHolder(d.path)
+	if err != nil {
+		return nil
+	}
+	return record
+}
+
+// holderReadAttempts is how many times ReadHolderContent reads a lock file whose
+// content is being rewritten before giving up
+const holderReadAttempts = 5
+
+// ReadHolderContent returns the holder record written in the content of the lock
+// file at path, with the payload given to filelock.WithPayload, or nil if the file
+// is empty. A PID line, written by filelock.WithPIDFormat or by other tools such as
+// liblockfile, gives a record with only the PID. Unlike ReadHolder it prefers the content, where the payload is, over the
+// extended attribute, which it only reads for an empty file.
+// The file is opened read-only and never locked, so it does not disturb the holder,
+// and a content read while the holder rewrites it is read again.
+func ReadHolderContent(path string) (*filelock.HolderRecord, error) {
+	var err error
+	for attempt := 1; attempt <= holderReadAttempts; attempt++ {
+		var data []byte
+		var stable bool
+		if data, stable, err = readContent(path); err != nil {
+			return nil, err
+		}
+		if len(data) == 0 && stable {
+			return readXattrHolder(path)
+		}
+
+		if pid, ok := parsePID(data); ok && stable {
+			return &filelock.HolderRecord{Holder: filelock.Holder{PID: pid}}, nil
+		}
+		var record filelock.HolderRecord
+		if err = json.Unmarshal(data, &record); err == nil && stable {
+			return &record, nil
+		}
+		time.Sleep(time.Duration(attempt) * time.Millisecond)
+	}
+	if err == nil {
+		err = errors.New("content keeps changing")
+	}
+	return nil, fmt.Errorf("lock file %s does not hold holder metadata: %w", path, err)
+}
+
+// ReadPID returns the PID of the holder written in the content of the lock file at
+// path, as a PID line or a holder record, or 0 if the file is empty
+func ReadPID(path string) (int, error) {
+	record, err := ReadHolderContent(path)
+	if err != nil || record == nil {
+		return 0, err
+	}
+	return record.PID, nil
+}
+
+// parsePID parses data as a PID line, a positive decimal number surrounded by
+// blanks, such as the space padded lines of HDB UUCP lock files
+func parsePID(data []byte) (int, bool) {
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, err == nil && pid > 0
+}
+
+// readContent reads the content of the file at path, and reports whether it was
+// not modified while being read
+func readContent(path string) (data []byte, stable bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	before, err := file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if data, err = io.ReadAll(file); err != nil {
+		return nil, false, err
+	}
+	after, err := file.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	stable = before.Size() == after.Size() && before.ModTime().Equal(after.ModTime()) &&
+		int64(len(data)) == after.Size()
+	return data, stable, nil
+}
+
+// readXattrHolder returns the holder recorded in the extended attribute of the file
+// at path, or nil if there is none
+func readXattrHolder(path string) (*filelock.HolderRecord, error) {
+	data, err := getXattr(path, HolderXattr)
+	if err != nil || len(data) == 0 {
+		return nil, nil
+	}
+
+	var record filelock.HolderRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("lock file %s does not hold holder metadata: %w", path, err)
+	}
+	return &record, nil
+}
@@ -0,0 +1,72 @@
+package unix
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// MandatoryError is returned when the mandatory locks of filelock.WithMandatory
+// would not be enforced on the lock file. It matches errors.ErrUnsupported.
+type MandatoryError struct {
+	// Path is the path of the lock file
+	Path string
+
+	// Reason tells why mandatory locking is not enforced
+	Reason string
+}
+
+func (e *MandatoryError) Error() string {
+	return fmt.Sprintf("mandatory locking not enforced on %s: %s", e.Path, e.Reason)
+}
+
+// Unwrap returns errors.ErrUnsupported
+func (e *MandatoryError) Unwrap() error {
+	return errors.ErrUnsupported
+}
+
+// enableMandatory makes the kernel enforce the fcntl(2) locks of the open lock
+// file, setting its setgid bit and clearing group execute, and returns a
+// *MandatoryError if they would not be enforced
+func enableMandatory(file *os.File) error {
+	if reason := mandatoryUnsupported(file); reason != "" {
+		return &MandatoryError{Path: file.Name(), Reason: reason}
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(file.Fd()), &st); err != nil {
+		return mapError(&os.PathError{Op: "fstat", Path: file.Name(), Err: err})
+	}
+	if isMandatoryMode(uint32(st.Mode)) {
+		return nil
+	}
+	mode := uint32(st.Mode)&0o7777&^0o010 | syscall.S_ISGID
+	for {
+		err := syscall.Fchmod(int(file.Fd()), mode)
+		if err == nil {
+			break
+		}
+		if err == syscall.EPERM {
+			return &MandatoryError{Path: file.Name(), Reason: "the file is owned by another user and lacks the setgid bit"}
+		}
+		if err != syscall.EINTR {
+			return mapError(&os.PathError{Op: "fchmod", Path: file.Name(), Err: err})
+		}
+	}
+
+	// The kernel silently drops the setgid bit for users outside the group of the file
+	if err := syscall.Fstat(int(file.Fd()), &st); err != nil {
+		return mapError(&os.PathError{Op: "fstat", Path: file.Name(), Err: err})
+	}
+	if !isMandatoryMode(uint32(st.Mode)) {
+		return &MandatoryError{Path: file.Name(), Reason: "the setgid bit cannot be set outside the group of the file"}
+	}
+	return nil
+}
+
+// isMandatoryMode reports whether mode, a st_mode value, marks a file for
+// mandatory locking: setgid set and group execute cleared
+func isMandatoryMode(mode uint32) bool {
+	return mode&syscall.S_ISGID != 0 && mode&0o010 == 0
+}
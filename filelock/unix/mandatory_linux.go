@@ -0,0 +1,51 @@
+package unix
+
+import (
+	"os"
+	"syscall"
+
+	xunix "golang.org/x/sys/unix"
+)
+
+// mandatoryUnsupported returns why the kernel would not enforce mandatory locks on
+// the open file, or "" if it would
+func mandatoryUnsupported(file *os.File) string {
+	var fs xunix.Statfs_t
+	if err := xunix.Fstatfs(int(file.Fd()), &fs); err != nil {
+		return "cannot check the mount options: " + err.Error()
+	}
+	if fs.Flags&xunix.ST_MANDLOCK == 0 {
+		return "the file system is not mounted with the mand option, which Linux 5.15 and later ignore"
+	}
+	return ""
+}
+
+// fcntlLock applies how, flock(2) operation flags, to file with fcntl(2) open file
+// description locks, which like flock(2) locks belong to the open file and are
+// enforced when the file is marked for mandatory locking
+func fcntlLock(file *os.File, how int) error {
+	lock := xunix.Flock_t{Whence: 0, Start: 0, Len: 0}
+	switch how &^ syscall.LOCK_NB {
+	case syscall.LOCK_SH:
+		lock.Type = xunix.F_RDLCK
+	case syscall.LOCK_EX:
+		lock.Type = xunix.F_WRLCK
+	default:
+		lock.Type = xunix.F_UNLCK
+	}
+	cmd := xunix.F_OFD_SETLKW
+	if how&syscall.LOCK_NB != 0 {
+		cmd = xunix.F_OFD_SETLK
+	}
+
+	for {
+		err := xunix.FcntlFlock(file.Fd(), cmd, &lock)
+		if err == xunix.EACCES {
+			// Some systems report a held lock as EACCES rather than EAGAIN
+			return syscall.EAGAIN
+		}
+		if err != xunix.EINTR {
+			return err
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package unix
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// TestMandatory tests that mandatory locks are taken where the mount enforces them,
+// and refused with a MandatoryError elsewhere rather than taken as advisory locks
+func (s *FileLockTestSuite) TestMandatory() {
+	lockPath := filepath.Join(s.tempDir, "mandatory.lock")
+	lock := New(lockPath, filelock.WithMandatory())
+
+	err := lock.Lock()
+	var mandatoryErr *MandatoryError
+	if errors.As(err, &mandatoryErr) {
+		s.Assert().ErrorIs(err, errors.ErrUnsupported)
+		s.Assert().Equal(lockPath, mandatoryErr.Path)
+		s.Assert().False(lock.IsLocked())
+		return
+	}
+	s.Require().NoError(err)
+	info, err := os.Stat(lockPath)
+	s.Require().NoError(err)
+	s.Assert().NotZero(info.Mode()&os.ModeSetgid, "the file is marked for mandatory locking")
+	s.Assert().Equal(filelock.ErrLockHeld, New(lockPath, filelock.WithMandatory()).Lock())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestFcntlLock tests the open file description locks of mandatory locking, which
+// exclude each other between descriptors like flock(2) locks
+func (s *FileLockTestSuite) TestFcntlLock() {
+	lockPath := filepath.Join(s.tempDir, "fcntl.lock")
+	first, err := os.Create(lockPath)
+	s.Require().NoError(err)
+	defer first.Close()
+	second, err := os.Open(lockPath)
+	s.Require().NoError(err)
+	defer second.Close()
+
+	s.Require().NoError(fcntlLock(first, syscall.LOCK_EX|syscall.LOCK_NB))
+	s.Assert().True(isContended(fcntlLock(second, syscall.LOCK_SH|syscall.LOCK_NB)))
+	s.Require().NoError(fcntlLock(first, syscall.LOCK_SH|syscall.LOCK_NB), "converted in place")
+	s.Require().NoError(fcntlLock(second, syscall.LOCK_SH|syscall.LOCK_NB))
+	s.Require().NoError(fcntlLock(first, syscall.LOCK_UN))
+	s.Require().NoError(fcntlLock(second, syscall.LOCK_UN))
+}
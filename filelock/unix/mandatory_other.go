@@ -0,0 +1,19 @@
+//go:build !linux
+
+package unix
+
+import (
+	"errors"
+	"os"
+)
+
+// mandatoryUnsupported returns why mandatory locks would not be enforced, which
+// this package only supports on Linux
+func mandatoryUnsupported(*os.File) string {
+	return "mandatory locking is only supported on Linux"
+}
+
+// fcntlLock is never called, as mandatory locks are refused before locking
+func fcntlLock(*os.File, int) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,36 @@
+package unix
+
+import (
+	"os"
+	"sync/atomic"
+
+	xunix "golang.org/x/sys/unix"
+)
+
+// noOpenat2 is set once the kernel turned out not to support openat2(2)
+var noOpenat2 atomic.Bool
+
+// openFd opens name relative to the open directory dirFd with flags and perm,
+// with beneath using openat2(2) to refuse resolving outside of dirFd or through a
+// symbolic link, and falling back to openat(2) without following the last component
+// on kernels older than 5.6
+func openFd(dirFd int, name string, flags int, perm os.FileMode, beneath bool) (int, error) {
+	if beneath && !noOpenat2.Load() {
+		how := xunix.OpenHow{
+			Flags:   uint64(flags | xunix.O_CLOEXEC),
+			Mode:    uint64(perm),
+			Resolve: xunix.RESOLVE_BENEATH | xunix.RESOLVE_NO_SYMLINKS,
+		}
+		for {
+			fd, err := xunix.Openat2(dirFd, name, &how)
+			if err == xunix.ENOSYS {
+				noOpenat2.Store(true)
+				break
+			}
+			if err != xunix.EINTR {
+				return fd, err
+			}
+		}
+	}
+	return openatFd(dirFd, name, flags, perm, beneath)
+}
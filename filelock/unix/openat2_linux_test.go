@@ -0,0 +1,39 @@
+package unix
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// TestRoot tests that WithRoot refuses lock files resolving outside of the root,
+// with openat2 and with the fallback of older kernels
+func (s *FileLockTestSuite) TestRoot() {
+	root := filepath.Join(s.tempDir, "root")
+	outside := filepath.Join(s.tempDir, "outside")
+	s.Require().NoError(os.Mkdir(root, 0755))
+	s.Require().NoError(os.Mkdir(outside, 0755))
+	s.Require().NoError(os.Symlink(outside, filepath.Join(root, "link")))
+	s.Require().NoError(os.Symlink(filepath.Join(outside, "target.lock"), filepath.Join(root, "target.lock")))
+	defer noOpenat2.Store(false)
+
+	for _, fallback := range []bool{false, true} {
+		noOpenat2.Store(fallback)
+		lock := New(filepath.Join(root, "jobs", "job.lock"), filelock.WithRoot(root), filelock.WithCreateParents(0755))
+		s.Require().NoError(lock.Lock())
+		s.Require().NoError(lock.Unlock())
+
+		for _, path := range []string{
+			filepath.Join(root, "..", "outside", "escape.lock"),
+			filepath.Join(root, "link", "escape.lock"),
+			filepath.Join(root, "target.lock"),
+		} {
+			err := New(path, filelock.WithRoot(root)).Lock()
+			s.Assert().ErrorIs(err, filelock.ErrUnsafePath, "%s, fallback %v", path, fallback)
+		}
+	}
+	entries, err := os.ReadDir(outside)
+	s.Require().NoError(err)
+	s.Assert().Empty(entries, "no lock file is created outside of the root")
+}
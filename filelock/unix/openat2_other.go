@@ -0,0 +1,11 @@
+//go:build !linux
+
+package unix
+
+import "os"
+
+// openFd opens name relative to the open directory dirFd with flags and perm,
+// without following the last component with beneath
+func openFd(dirFd int, name string, flags int, perm os.FileMode, beneath bool) (int, error) {
+	return openatFd(dirFd, name, flags, perm, beneath)
+}
@@ -0,0 +1,84 @@
+package unix
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	xunix "golang.org/x/sys/unix"
+)
+
+// openLockFileInRoot opens, creating it with perm if needed, the lock file at path,
+// which must resolve beneath the directory root, see filelock.WithRoot
+func openLockFileInRoot(root, path string, perm os.FileMode, noFollow, secureParent bool) (*os.File, error) {
+	rel, err := relativeToRoot(root, path)
+	if err != nil {
+		return nil, err
+	}
+	rootFd, err := openDir(root)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	defer xunix.Close(rootFd)
+	return openRelative(rootFd, rel, path, perm, noFollow, secureParent, true)
+}
+
+// mkdirAllInRoot creates the directory dir, which must be beneath the directory
+// root, and its missing parents
+func mkdirAllInRoot(root, dir string, perm os.FileMode) error {
+	rel, err := relativeToRoot(root, dir)
+	if errors.Is(err, filelock.ErrUnsafePath) && filepath.Clean(dir) == filepath.Clean(root) {
+		rel, err = ".", nil
+	}
+	if err != nil {
+		return err
+	}
+	rootFd, err := openDir(root)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	defer xunix.Close(rootFd)
+	return mkdirAllAt(rootFd, root, rel, perm)
+}
+
+// relativeToRoot returns path relative to root, or an error wrapping
+// filelock.ErrUnsafePath if it is not lexically beneath root
+func relativeToRoot(root, path string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is not beneath root %s", filelock.ErrUnsafePath, path, root)
+	}
+	return rel, nil
+}
+
+// resolveError returns the error of opening path, wrapping filelock.ErrUnsafePath
+// when the resolution beneath the root, with beneath, crossed it or a symbolic link
+func resolveError(path string, err error, beneath bool) error {
+	if beneath && (errors.Is(err, xunix.EXDEV) || isSymlinkRefused(err) || isSymlinkDir(path, err)) {
+		return fmt.Errorf("%w: %s resolves outside of the root or through a symbolic link: %w",
+			filelock.ErrUnsafePath, path, err)
+	}
+	return &os.PathError{Op: "open", Path: path, Err: err}
+}
+
+// isSymlinkDir reports whether err is the error of an O_DIRECTORY|O_NOFOLLOW open
+// of path, a symbolic link, which is ENOTDIR
+func isSymlinkDir(path string, err error) bool {
+	if !errors.Is(err, xunix.ENOTDIR) {
+		return false
+	}
+	info, lerr := os.Lstat(path)
+	return lerr == nil && info.Mode()&os.ModeSymlink != 0
+}
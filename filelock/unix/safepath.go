@@ -0,0 +1,190 @@
+package unix
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	xunix "golang.org/x/sys/unix"
+)
+
+// openLockFile opens, creating it with perm if needed, the lock file at path,
+// refusing a symbolic link with noFollow and a directory other users can tamper
+// with with secureParent
+func openLockFile(path string, perm os.FileMode, noFollow, secureParent bool) (*os.File, error) {
+	flags := lockFlags(noFollow)
+	if !secureParent {
+		file, err := os.OpenFile(path, flags, perm)
+		if err != nil && noFollow && isSymlinkRefused(err) {
+			return nil, fmt.Errorf("%w: %s is a symbolic link: %w", filelock.ErrUnsafePath, path, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return checkRegular(file)
+	}
+
+	dir := filepath.Dir(path)
+	dirFd, err := openDir(dir)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	defer xunix.Close(dirFd)
+	if err := checkParent(dirFd, dir); err != nil {
+		return nil, err
+	}
+	return openAt(dirFd, filepath.Base(path), path, flags, perm, noFollow, false)
+}
+
+// lockFlags returns the flags opening lock files
+func lockFlags(noFollow bool) int {
+	// O_NONBLOCK keeps named pipes and devices from blocking the open, they are
+	// refused right after
+	flags := os.O_CREATE | os.O_RDWR | xunix.O_NONBLOCK | xunix.O_NOCTTY
+	if noFollow {
+		flags |= xunix.O_NOFOLLOW
+	}
+	return flags
+}
+
+// openAt opens with flags, creating it with perm if needed, the lock file name
+// of the open directory dirFd, resolving it beneath dirFd with beneath, path
+// naming it in errors
+func openAt(dirFd int, name, path string, flags int, perm os.FileMode, noFollow, beneath bool) (*os.File, error) {
+	fd, err := openFd(dirFd, name, flags, perm, beneath)
+	if err != nil && noFollow && isSymlinkRefused(err) {
+		return nil, fmt.Errorf("%w: %s is a symbolic link: %w", filelock.ErrUnsafePath, path, err)
+	}
+	if err != nil {
+		return nil, resolveError(path, err, beneath)
+	}
+	return checkRegular(os.NewFile(uintptr(fd), path))
+}
+
+// openatFd opens name relative to the open directory dirFd with openat(2), not
+// following the last component with noFollow
+func openatFd(dirFd int, name string, flags int, perm os.FileMode, noFollow bool) (int, error) {
+	if noFollow {
+		flags |= xunix.O_NOFOLLOW
+	}
+	for {
+		fd, err := xunix.Openat(dirFd, name, flags|xunix.O_CLOEXEC, uint32(perm))
+		if err != xunix.EINTR {
+			return fd, err
+		}
+	}
+}
+
+// checkRegular returns file if it is a regular file, and closes it and returns an
+// error wrapping filelock.ErrNotRegular otherwise
+func checkRegular(file *os.File) (*os.File, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(file.Fd()), &st); err != nil {
+		_ = file.Close()
+		return nil, &os.PathError{Op: "fstat", Path: file.Name(), Err: err}
+	}
+	if st.Mode&syscall.S_IFMT == syscall.S_IFREG {
+		return file, nil
+	}
+	_ = file.Close()
+	return nil, fmt.Errorf("%w: %s is a %s", filelock.ErrNotRegular, file.Name(), fileKind(uint32(st.Mode)))
+}
+
+// fileKind describes the type of file of mode, a st_mode value
+func fileKind(mode uint32) string {
+	switch mode & syscall.S_IFMT {
+	case syscall.S_IFDIR:
+		return "directory"
+	case syscall.S_IFIFO:
+		return "named pipe"
+	case syscall.S_IFCHR:
+		return "character device"
+	case syscall.S_IFBLK:
+		return "block device"
+	case syscall.S_IFSOCK:
+		return "socket"
+	default:
+		return "special file"
+	}
+}
+
+// openDir opens the directory dir to open files relative to it
+func openDir(dir string) (int, error) {
+	return openDirAt(xunix.AT_FDCWD, dir)
+}
+
+// openDirAt opens the directory dir relative to the open directory dirFd
+func openDirAt(dirFd int, dir string) (int, error) {
+	return openatFd(dirFd, dir, xunix.O_RDONLY|xunix.O_DIRECTORY, 0, false)
+}
+
+// checkParent returns an error wrapping filelock.ErrUnsafePath if the open directory
+// dir is owned by another user than the current one or root, or if other users can
+// write to it without the sticky bit keeping them from replacing the files of others
+func checkParent(dirFd int, dir string) error {
+	var st xunix.Stat_t
+	if err := xunix.Fstat(dirFd, &st); err != nil {
+		return &os.PathError{Op: "fstat", Path: dir, Err: err}
+	}
+	if st.Uid != 0 && int(st.Uid) != os.Geteuid() {
+		return fmt.Errorf("%w: directory %s is owned by uid %d", filelock.ErrUnsafePath, dir, st.Uid)
+	}
+	if uint32(st.Mode)&0o022 != 0 && uint32(st.Mode)&xunix.S_ISVTX == 0 {
+		return fmt.Errorf("%w: directory %s is writable by other users", filelock.ErrUnsafePath, dir)
+	}
+	return nil
+}
+
+// isSymlinkRefused reports whether err is the error of an O_NOFOLLOW open of a
+// symbolic link, which is ELOOP, or EMLINK on FreeBSD
+func isSymlinkRefused(err error) bool {
+	return errors.Is(err, xunix.ELOOP) || errors.Is(err, xunix.EMLINK)
+}
+
+// enforcePerm changes the permission of the open lock file to exactly perm, which
+// the umask may have filtered on creation. Files owned by another user are left
+// as they are, as only their owner and root can change them.
+func enforcePerm(file *os.File, perm os.FileMode) error {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(file.Fd()), &st); err != nil {
+		return &os.PathError{Op: "fstat", Path: file.Name(), Err: err}
+	}
+	euid := os.Geteuid()
+	if (int(st.Uid) != euid && euid != 0) || os.FileMode(st.Mode)&os.ModePerm == perm {
+		return nil
+	}
+	for {
+		err := syscall.Fchmod(int(file.Fd()), uint32(perm))
+		if err == nil {
+			return nil
+		}
+		if err != syscall.EINTR {
+			return &os.PathError{Op: "fchmod", Path: file.Name(), Err: err}
+		}
+	}
+}
+
+// enforceOwner changes the owner of the open lock file to uid and gid, where -1
+// leaves the owner or the group unchanged, if it has another owner
+func enforceOwner(file *os.File, uid, gid int) error {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(file.Fd()), &st); err != nil {
+		return &os.PathError{Op: "fstat", Path: file.Name(), Err: err}
+	}
+	if (uid < 0 || int(st.Uid) == uid) && (gid < 0 || int(st.Gid) == gid) {
+		return nil
+	}
+	for {
+		err := syscall.Fchown(int(file.Fd()), uid, gid)
+		if err == nil {
+			return nil
+		}
+		if err != syscall.EINTR {
+			return &os.PathError{Op: "fchown", Path: file.Name(), Err: err}
+		}
+	}
+}
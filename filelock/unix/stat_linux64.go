@@ -0,0 +1,27 @@
+//go:build linux && (amd64 || arm64)
+
+package unix
+
+import (
+	"syscall"
+	"unsafe"
+
+	xunix "golang.org/x/sys/unix"
+)
+
+// statPath is stat(2) on the NUL-terminated path. Unlike syscall.Stat, it does
+// not copy the path on every call, so revalidating the lock file does not allocate
+func statPath(path []byte, st *syscall.Stat_t) error {
+	cwd := xunix.AT_FDCWD
+	_, _, errno := syscall.Syscall6(
+		xunix.SYS_NEWFSTATAT,
+		uintptr(cwd),
+		uintptr(unsafe.Pointer(&path[0])),
+		uintptr(unsafe.Pointer(st)),
+		0, 0, 0,
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux || !(amd64 || arm64)
+
+package unix
+
+import "syscall"
+
+// statPath is stat(2) on the NUL-terminated path
+func statPath(path []byte, st *syscall.Stat_t) error {
+	return syscall.Stat(string(path[:len(path)-1]), st)
+}
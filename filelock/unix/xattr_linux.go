@@ -0,0 +1,37 @@
+package unix
+
+import (
+	"os"
+
+	xunix "golang.org/x/sys/unix"
+)
+
+// setXattr sets the extended attribute name of file
+func setXattr(file *os.File, name string, data []byte) error {
+	return xunix.Fsetxattr(int(file.Fd()), name, data, 0)
+}
+
+// removeXattr removes the extended attribute name of file
+func removeXattr(file *os.File, name string) error {
+	return xunix.Fremovexattr(int(file.Fd()), name)
+}
+
+// getXattr returns the extended attribute name of the file at path
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := xunix.Getxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size)
+		n, err := xunix.Getxattr(path, name, data)
+		// ERANGE means the attribute grew in between
+		if err == xunix.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+}
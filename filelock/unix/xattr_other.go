@@ -0,0 +1,23 @@
+//go:build !linux
+
+package unix
+
+import (
+	"errors"
+	"os"
+)
+
+// errNoXattr is returned on systems where this package does not use extended attributes
+var errNoXattr = errors.New("extended attributes are not supported")
+
+func setXattr(*os.File, string, []byte) error {
+	return errNoXattr
+}
+
+func removeXattr(*os.File, string) error {
+	return errNoXattr
+}
+
+func getXattr(string, string) ([]byte, error) {
+	return nil, errNoXattr
+}
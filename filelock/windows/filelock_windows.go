@@ -1,29 +1,52 @@
-// Package filelock provides thread-safe file locking functionality in non-blocking mode.
+// Package windows provides thread-safe file locking functionality in non-blocking mode.
 // It allows for acquiring exclusive locks on files without blocking indefinitely.
 package windows
 
 import (
-	"github.com/rsgcata/go-fs/filelock"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"os"
-	"sync"
+	"path/filepath"
+	"syscall"
 	"time"
 
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/dirsync"
+	"github.com/rsgcata/go-fs/internal/lockcore"
+
 	"golang.org/x/sys/windows"
 )
 
 // FileLock represents a lock on a file
 type FileLock struct {
-	path   string
-	file   *os.File
-	locked bool
-	mutex  sync.Mutex
+	core *lockcore.Lock
 }
 
 // New creates a new FileLock for the specified file path
-func New(path string) *FileLock {
+// The path is opened in its extended-length form, so paths longer than MAX_PATH
+// and UNC paths (\\server\share\...) are supported
+// By default the whole file is locked, see filelock.WithRange to lock a region
+func New(path string, opts ...filelock.Option) *FileLock {
+	o := filelock.NewOptions(opts...)
+	driver := &lockFileDriver{
+		offset:     o.RangeOffset,
+		length:     o.RangeLength,
+		shared:     o.Shared,
+		noFollow:   o.NoFollow,
+		denyShare:  o.DenyShare,
+		perm:       o.Perm,
+		ownerSID:   o.OwnerSID,
+		mkdirs:     o.CreateParents,
+		parentPerm: o.ParentPerm,
+	}
+	if driver.length == 0 {
+		driver.length = math.MaxUint64 - driver.offset
+	}
 	return &FileLock{
-		path:   path,
-		locked: false,
+		core: lockcore.New(path, driver, o),
 	}
 }
 
@@ -37,126 +60,347 @@ func (fl *FileLock) Lock() error {
 // If timeout is <= 0, it's a non-blocking operation
 // If timeout is > 0, it will retry in a non-blocking manner until the timeout is reached
 func (fl *FileLock) LockWithTimeout(timeout time.Duration) error {
-	fl.mutex.Lock()
-	defer fl.mutex.Unlock()
+	return fl.core.LockWithTimeout(timeout)
+}
 
-	if fl.locked {
-		return filelock.ErrAlreadyLocked
-	}
+// Unlock releases the lock on the file
+// If the lock is not held, it returns ErrNotLocked, or nil when created with
+// filelock.WithIdempotentUnlock
+func (fl *FileLock) Unlock() error {
+	return fl.core.Unlock()
+}
+
+// UnlockWithTimeout releases the lock like Unlock, giving up after timeout when the
+// release hangs, on a stuck network file system for example: the lock is forgotten,
+// its descriptor abandoned, and an error wrapping filelock.ErrAbandoned is returned
+// ContextLock().Unlock(ctx) gives up the same way when ctx is done
+func (fl *FileLock) UnlockWithTimeout(timeout time.Duration) error {
+	return fl.core.UnlockWithTimeout(timeout)
+}
+
+// Abort interrupts the acquisitions in progress on this instance, including the
+// ones waiting for another operation on it, which return filelock.ErrAborted
+// Later acquisitions are not affected and a held lock stays held
+func (fl *FileLock) Abort() {
+	fl.core.Abort()
+}
+
+// Close releases the lock if it is held and closes the lock file kept open by
+// filelock.WithKeepOpen, if any
+func (fl *FileLock) Close() error {
+	return fl.core.Close()
+}
+
+// IsLocked returns whether the file is currently locked by this process
+func (fl *FileLock) IsLocked() bool {
+	return fl.core.IsLocked()
+}
+
+// Path returns the file path associated with this lock
+func (fl *FileLock) Path() string {
+	return fl.core.Path()
+}
+
+// AcquiredAt returns when the lock was acquired, or the zero time if it is not held
+func (fl *FileLock) AcquiredAt() time.Time {
+	return fl.core.AcquiredAt()
+}
+
+// HeldDuration returns how long the lock has been held, or 0 if it is not held
+func (fl *FileLock) HeldDuration() time.Duration {
+	return fl.core.HeldDuration()
+}
+
+// LastAcquireStats returns the number of attempts and the time spent by the most
+// recent acquisition, whether it succeeded or not
+func (fl *FileLock) LastAcquireStats() filelock.AcquireStats {
+	return fl.core.LastAcquireStats()
+}
+
+// Status returns a snapshot of the lock state, including holder and acquisition statistics
+func (fl *FileLock) Status() filelock.Status {
+	return fl.core.Status()
+}
+
+// LockFunc acquires the lock, retrying until ctx is done, and returns the function
+// releasing it, see filelock.LockFunc
+func (fl *FileLock) LockFunc(ctx context.Context) (release func() error, err error) {
+	return filelock.LockFunc(ctx, fl)
+}
+
+// ContextLock returns a view of the lock whose operations take a context
+func (fl *FileLock) ContextLock() filelock.ContextLock {
+	return fl.core.ContextLock()
+}
+
+// Yield releases the lock and acquires it again after the waiters of this process,
+// if it has been held for longer than the slice of filelock.WithYield
+// It reports whether the lock was released, see filelock.Yielder
+func (fl *FileLock) Yield(ctx context.Context) (bool, error) {
+	return fl.core.Yield(ctx)
+}
+
+// String describes the lock and its current state
+func (fl *FileLock) String() string {
+	return fl.Status().String()
+}
+
+// MarshalJSON encodes the current status of the lock
+func (fl *FileLock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fl.Status())
+}
+
+// Downgrade converts the held exclusive lock to a shared one, without releasing it in between
+// It returns ErrNotLocked if the lock is not held, and nil if it is already shared
+// LockFileEx cannot convert a held lock, so on a held lock it returns errors.ErrUnsupported
+func (fl *FileLock) Downgrade() error {
+	return fl.core.Downgrade()
+}
+
+// Upgrade converts the held shared lock to an exclusive one, retrying until the other
+// shared holders are gone or timeout is reached
+// On ErrTimeout the shared lock is still held. It returns ErrDeadlock if another instance
+// of this process is upgrading the same lock
+// LockFileEx cannot convert a held lock, so on a held lock it returns errors.ErrUnsupported
+func (fl *FileLock) Upgrade(timeout time.Duration) error {
+	return fl.core.Upgrade(timeout)
+}
+
+// lockFileDriver locks a byte range of files using LockFileEx
+type lockFileDriver struct {
+	file   *os.File
+	offset uint64
+	length uint64
+	shared bool
 
-	var err error
-	fl.file, err = os.OpenFile(fl.path, os.O_CREATE|os.O_RDWR, 0666)
+	// noFollow refuses lock files that are reparse points, such as symbolic links
+	noFollow bool
+
+	// denyShare opens the file without sharing it when locking, and closes it when
+	// unlocking, path being the file to open
+	denyShare bool
+	path      string
+
+	// perm is the permission of created lock files, or 0 for the default
+	perm os.FileMode
+
+	// ownerSID is granted full access to created lock files, if set
+	ownerSID string
+
+	// mkdirs creates the missing parent directories with parentPerm
+	mkdirs     bool
+	parentPerm os.FileMode
+
+	// id identifies the open file
+	id filelock.FileID
+
+	// ov is reused by every call, sparing an allocation per lock operation
+	ov windows.Overlapped
+}
+
+func (d *lockFileDriver) Open(path string) error {
+	path, err := extendedPath(path)
 	if err != nil {
 		return err
 	}
+	if d.denyShare {
+		// Opening the file takes the lock, so TryLock does it
+		d.path = path
+		return nil
+	}
+	return d.openFile(path)
+}
 
-	// Try to acquire the lock
-	err = fl.tryLock(timeout)
+// openFile opens the lock file at path, creating the missing parents if requested
+func (d *lockFileDriver) openFile(path string) error {
+	file, err := d.open(path)
+	if err != nil && d.mkdirs && errors.Is(err, os.ErrNotExist) {
+		if err := dirsync.MkdirAll(filepath.Dir(path), d.parentPerm); err != nil {
+			return mapError(err)
+		}
+		file, err = d.open(path)
+	}
 	if err != nil {
-		_ = fl.file.Close()
-		fl.file = nil
-		return err
+		return mapError(err)
+	}
+
+	// Devices such as NUL or COM1 and named pipes open fine, but cannot be locked
+	if kind := fileKind(file); kind != "" {
+		_ = file.Close()
+		return fmt.Errorf("%w: %s is a %s", filelock.ErrNotRegular, path, kind)
 	}
+	d.file = file
 
-	fl.locked = true
+	d.id = filelock.FileID{}
+	var info windows.ByHandleFileInformation
+	if windows.GetFileInformationByHandle(windows.Handle(file.Fd()), &info) == nil {
+		d.id = filelock.FileID{
+			Device: uint64(info.VolumeSerialNumber),
+			File:   uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow),
+		}
+	}
 	return nil
 }
 
-// tryLock attempts to acquire the lock with the specified timeout
-// It uses a non-blocking approach for all cases
-func (fl *FileLock) tryLock(timeout time.Duration) error {
-	handle := windows.Handle(fl.file.Fd())
-	overlapped := &windows.Overlapped{}
-
-	// For non-blocking mode or immediate check
-	err := windows.LockFileEx(
-		handle,
-		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
-		0,
-		1,
-		0,
-		overlapped,
-	)
+// open opens, creating it if needed, the lock file at path
+func (d *lockFileDriver) open(path string) (*os.File, error) {
+	if d.denyShare {
+		return openLockFile(path, 0, d.perm, d.ownerSID, d.noFollow)
+	}
+	if d.noFollow || d.perm != 0 || d.ownerSID != "" {
+		return openLockFile(path, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, d.perm, d.ownerSID, d.noFollow)
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+}
 
-	// If we got the lock immediately or there was an error other than lock violation, return
-	if err == nil || err != windows.ERROR_LOCK_VIOLATION {
-		return err
+// fileKind describes the type of the open file if it is not a regular disk file,
+// and returns "" for a regular one
+func fileKind(file *os.File) string {
+	fileType, err := windows.GetFileType(windows.Handle(file.Fd()))
+	if err != nil {
+		return ""
+	}
+	switch fileType {
+	case windows.FILE_TYPE_DISK:
+		return ""
+	case windows.FILE_TYPE_PIPE:
+		return "named pipe"
+	case windows.FILE_TYPE_CHAR:
+		return "character device"
+	default:
+		return "special file"
 	}
+}
 
-	// At this point, we know the lock is held (err == windows.ERROR_LOCK_VIOLATION)
+// FileID returns the volume serial number and file index of the open file, which
+// cannot be replaced while it is open
+func (d *lockFileDriver) FileID() filelock.FileID {
+	return d.id
+}
 
-	// If timeout <= 0, it's a non-blocking call, so return immediately
-	if timeout <= 0 {
-		return filelock.ErrLockHeld
+// Clone returns an unopened driver taking the same kind of lock
+func (d *lockFileDriver) Clone() lockcore.Driver {
+	return &lockFileDriver{
+		offset:     d.offset,
+		length:     d.length,
+		shared:     d.shared,
+		noFollow:   d.noFollow,
+		denyShare:  d.denyShare,
+		perm:       d.perm,
+		ownerSID:   d.ownerSID,
+		mkdirs:     d.mkdirs,
+		parentPerm: d.parentPerm,
 	}
+}
 
-	// For timeout > 0, retry with polling until timeout
-	startTime := time.Now()
-	retryInterval := time.Millisecond * 10 // Start with 10ms retry interval
+// Reusable reports whether a file is open. The open file cannot be removed or
+// replaced, as it is opened without FILE_SHARE_DELETE.
+func (d *lockFileDriver) Reusable() bool {
+	return d.file != nil
+}
 
-	for {
-		// Check if we've exceeded the timeout
-		if time.Since(startTime) >= timeout {
-			return filelock.ErrTimeout
+func (d *lockFileDriver) TryLock() error {
+	if d.denyShare && d.file == nil {
+		// Another process having the file open is contention
+		if err := d.openFile(d.path); err != nil {
+			if errors.Is(err, filelock.ErrSharingViolation) {
+				return filelock.ErrLockHeld
+			}
+			return err
 		}
+	}
 
-		// Sleep for a short interval before retrying
-		time.Sleep(retryInterval)
-
-		// Increase retry interval for exponential backoff, but cap it at 100ms
-		if retryInterval < time.Millisecond*100 {
-			retryInterval = time.Duration(float64(retryInterval) * 1.5)
-		}
+	var flags uint32 = windows.LOCKFILE_FAIL_IMMEDIATELY
+	if !d.shared {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	err := windows.LockFileEx(
+		windows.Handle(d.file.Fd()),
+		flags,
+		0,
+		uint32(d.length),
+		uint32(d.length>>32),
+		d.overlapped(),
+	)
+	if err != nil && d.denyShare {
+		_ = d.Close()
+	}
+	return mapError(err)
+}
 
-		// Try to acquire the lock again (non-blocking)
-		err = windows.LockFileEx(
-			handle,
-			windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
-			0,
-			1,
-			0,
-			overlapped,
-		)
-
-		// If we got the lock or there was an error other than lock violation, return
-		if err == nil || err != windows.ERROR_LOCK_VIOLATION {
-			return err
+func (d *lockFileDriver) Unlock() error {
+	err := windows.UnlockFileEx(
+		windows.Handle(d.file.Fd()),
+		0,
+		uint32(d.length),
+		uint32(d.length>>32),
+		d.overlapped(),
+	)
+	if d.denyShare {
+		// Let other processes open the file again
+		if closeErr := d.Close(); err == nil {
+			return closeErr
 		}
 	}
+	return mapError(err)
 }
 
-// Unlock releases the lock on the file
-func (fl *FileLock) Unlock() error {
-	fl.mutex.Lock()
-	defer fl.mutex.Unlock()
-
-	if !fl.locked || fl.file == nil {
-		return filelock.ErrNotLocked
+// overlapped returns the structure carrying the offset of the locked range
+func (d *lockFileDriver) overlapped() *windows.Overlapped {
+	d.ov = windows.Overlapped{
+		Offset:     uint32(d.offset),
+		OffsetHigh: uint32(d.offset >> 32),
 	}
+	return &d.ov
+}
 
-	// Release the lock
-	handle := windows.Handle(fl.file.Fd())
-	overlapped := &windows.Overlapped{}
-	err := windows.UnlockFileEx(handle, 0, 1, 0, overlapped)
-	if err != nil {
-		return err
+func (d *lockFileDriver) Close() error {
+	if d.file == nil {
+		return nil
 	}
-
-	// Close the file
-	err = fl.file.Close()
-	fl.file = nil
-	fl.locked = false
+	err := d.file.Close()
+	d.file = nil
 	return err
 }
 
-// IsLocked returns whether the file is currently locked by this process
-func (fl *FileLock) IsLocked() bool {
-	fl.mutex.Lock()
-	defer fl.mutex.Unlock()
-	return fl.locked
+// mapError translates the Windows errors callers may want to branch on into the
+// filelock errors, keeping the original error in the chain
+func mapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, windows.ERROR_LOCK_VIOLATION):
+		// The lock is held by someone else
+		return filelock.ErrLockHeld
+	case errors.Is(err, windows.ERROR_SHARING_VIOLATION):
+		return fmt.Errorf("%w: %w", filelock.ErrSharingViolation, err)
+	case errors.Is(err, syscall.EISDIR):
+		// os.OpenFile refuses to open a directory for writing
+		return fmt.Errorf("%w: %w", filelock.ErrNotRegular, err)
+	case errors.Is(err, windows.ERROR_ACCESS_DENIED):
+		return fmt.Errorf("%w: %w", filelock.ErrPermission, err)
+	case isDisconnected(err):
+		return fmt.Errorf("%w: %w", filelock.ErrLockLost, err)
+	default:
+		return err
+	}
 }
 
-// Path returns the file path associated with this lock
-func (fl *FileLock) Path() string {
-	return fl.path
+// isDisconnected reports whether err means the network share holding the file
+// went away, which releases any lock held on it
+func isDisconnected(err error) bool {
+	for _, errno := range []windows.Errno{
+		windows.ERROR_NETNAME_DELETED,
+		windows.ERROR_BAD_NETPATH,
+		windows.ERROR_BAD_NET_NAME,
+		windows.ERROR_UNEXP_NET_ERR,
+		windows.ERROR_DEV_NOT_EXIST,
+		windows.ERROR_VC_DISCONNECTED,
+		windows.ERROR_NETWORK_UNREACHABLE,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
 }
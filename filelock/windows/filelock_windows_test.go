@@ -1,14 +1,15 @@
 package windows
 
 import (
-	"github.com/rsgcata/go-fs/filelock"
-	"github.com/rsgcata/go-fs/filelock/unix"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/conformance"
+
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
@@ -34,7 +35,7 @@ func (s *FileLockTestSuite) TearDownTest() {
 // TestBasicLockAndUnlock tests the basic lock and unlock functionality
 func (s *FileLockTestSuite) TestBasicLockAndUnlock() {
 	lockPath := filepath.Join(s.tempDir, "basic.lock")
-	lock := unix.New(lockPath)
+	lock := New(lockPath)
 
 	// Lock the file
 	err := lock.Lock()
@@ -50,7 +51,7 @@ func (s *FileLockTestSuite) TestBasicLockAndUnlock() {
 // TestDoubleLock tests that locking an already locked file returns an error
 func (s *FileLockTestSuite) TestDoubleLock() {
 	lockPath := filepath.Join(s.tempDir, "double.lock")
-	lock := unix.New(lockPath)
+	lock := New(lockPath)
 
 	// Lock the file
 	err := lock.Lock()
@@ -70,7 +71,7 @@ func (s *FileLockTestSuite) TestDoubleLock() {
 // TestUnlockWithoutLock tests that unlocking a file that isn't locked returns an error
 func (s *FileLockTestSuite) TestUnlockWithoutLock() {
 	lockPath := filepath.Join(s.tempDir, "unlock.lock")
-	lock := unix.New(lockPath)
+	lock := New(lockPath)
 
 	// Try to unlock without locking first
 	err := lock.Unlock()
@@ -82,12 +83,12 @@ func (s *FileLockTestSuite) TestConcurrentLocks() {
 	lockPath := filepath.Join(s.tempDir, "concurrent.lock")
 
 	// Create a lock and acquire it
-	lock1 := unix.New(lockPath)
+	lock1 := New(lockPath)
 	err := lock1.Lock()
 	s.Require().NoError(err)
 
 	// Try to acquire the same lock from another instance (should fail with ErrLockHeld)
-	lock2 := unix.New(lockPath)
+	lock2 := New(lockPath)
 	err = lock2.Lock()
 	s.Assert().Equal(filelock.ErrLockHeld, err)
 
@@ -109,12 +110,12 @@ func (s *FileLockTestSuite) TestLockWithTimeout() {
 	lockPath := filepath.Join(s.tempDir, "timeout.lock")
 
 	// Create a lock and acquire it
-	lock1 := unix.New(lockPath)
+	lock1 := New(lockPath)
 	err := lock1.Lock()
 	s.Require().NoError(err)
 
 	// Try to acquire with a short timeout (should fail with ErrTimeout)
-	lock2 := unix.New(lockPath)
+	lock2 := New(lockPath)
 	err = lock2.LockWithTimeout(100 * time.Millisecond)
 	s.Assert().Equal(filelock.ErrTimeout, err)
 
@@ -128,7 +129,7 @@ func (s *FileLockTestSuite) TestNonBlockingBehavior() {
 	lockPath := filepath.Join(s.tempDir, "nonblocking.lock")
 
 	// Create a lock and acquire it
-	lock1 := unix.New(lockPath)
+	lock1 := New(lockPath)
 	err := lock1.Lock()
 	s.Require().NoError(err)
 	defer lock1.Unlock()
@@ -138,7 +139,7 @@ func (s *FileLockTestSuite) TestNonBlockingBehavior() {
 
 	// Start a goroutine that tries to acquire the lock with a long timeout
 	go func() {
-		lock2 := unix.New(lockPath)
+		lock2 := New(lockPath)
 		// Use a relatively long timeout
 		err := lock2.LockWithTimeout(500 * time.Millisecond)
 		// We expect a timeout error
@@ -162,7 +163,7 @@ func (s *FileLockTestSuite) TestNonBlockingBehavior() {
 // TestThreadSafety tests that the FileLock is thread-safe
 func (s *FileLockTestSuite) TestThreadSafety() {
 	lockPath := filepath.Join(s.tempDir, "threadsafe.lock")
-	lock := unix.New(lockPath)
+	lock := New(lockPath)
 
 	// Create multiple goroutines that try to lock and unlock
 	var wg sync.WaitGroup
@@ -207,6 +208,33 @@ func (s *FileLockTestSuite) TestThreadSafety() {
 	s.Assert().False(lock.IsLocked())
 }
 
+// TestDenyShare tests that no other process can open the file while the lock is
+// held without sharing it, and that an open file is contention for the lock
+func (s *FileLockTestSuite) TestDenyShare() {
+	lockPath := filepath.Join(s.tempDir, "installer.lock")
+	lock := New(lockPath, filelock.WithDenyShare())
+
+	s.Require().NoError(lock.Lock())
+	_, err := os.Open(lockPath)
+	s.Assert().Error(err, "the file cannot be opened while the lock is held")
+	s.Assert().Equal(filelock.ErrLockHeld, New(lockPath, filelock.WithDenyShare()).Lock())
+	s.Require().NoError(lock.Unlock())
+
+	reader, err := os.Open(lockPath)
+	s.Require().NoError(err)
+	s.Assert().Equal(filelock.ErrLockHeld, lock.Lock(), "a reader keeps the file from being opened unshared")
+	s.Require().NoError(reader.Close())
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestConformance runs the conformance checks shared by all the backends
+func (s *FileLockTestSuite) TestConformance() {
+	conformance.Run(s.T(), func(path string, opts ...filelock.Option) filelock.FileLock {
+		return New(path, opts...)
+	}, conformance.Config{Shared: true})
+}
+
 // TestFileLock runs the test suite
 func TestFileLock(t *testing.T) {
 	suite.Run(t, new(FileLockTestSuite))
@@ -0,0 +1,127 @@
+package windows
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"golang.org/x/sys/windows"
+)
+
+// openLockFile opens, creating it if needed, the lock file at path like os.OpenFile
+// does, sharing it with share. With noFollow a reparse point is opened itself rather
+// than its target, and refused. A non-zero perm or an ownerSID gives a created file
+// the security descriptor of fileSDDL, the group bits applying to the primary group
+// of the process.
+func openLockFile(path string, share uint32, perm os.FileMode, ownerSID string, noFollow bool) (*os.File, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	var sa *windows.SecurityAttributes
+	if perm != 0 || ownerSID != "" {
+		sd, err := windows.SecurityDescriptorFromString(fileSDDL(perm, ownerSID, primaryGroupSID()))
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: path, Err: err}
+		}
+		sa = &windows.SecurityAttributes{SecurityDescriptor: sd}
+		sa.Length = uint32(unsafe.Sizeof(*sa))
+	}
+	var attrs uint32 = windows.FILE_ATTRIBUTE_NORMAL
+	if noFollow {
+		attrs |= windows.FILE_FLAG_OPEN_REPARSE_POINT
+	}
+
+	handle, err := windows.CreateFile(
+		name,
+		windows.GENERIC_READ|windows.GENERIC_WRITE,
+		share,
+		sa,
+		windows.OPEN_ALWAYS,
+		attrs,
+		0,
+	)
+	if err == windows.ERROR_ACCESS_DENIED && isDir(name) {
+		// Like os.OpenFile, tell directories from files that cannot be written
+		err = syscall.EISDIR
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	if noFollow {
+		var info windows.ByHandleFileInformation
+		if err := windows.GetFileInformationByHandle(handle, &info); err != nil {
+			_ = windows.CloseHandle(handle)
+			return nil, &os.PathError{Op: "stat", Path: path, Err: err}
+		}
+		if info.FileAttributes&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+			_ = windows.CloseHandle(handle)
+			return nil, fmt.Errorf("%w: %s is a reparse point", filelock.ErrUnsafePath, path)
+		}
+	}
+	return os.NewFile(uintptr(handle), path), nil
+}
+
+// fileSDDL returns the security descriptor, in SDDL, of created lock files. A
+// non-zero perm makes it protected from inherited entries and match the Unix
+// permission bits: the owner and SYSTEM get full access, groupSID gets the read
+// and write access of the group bits, and everyone the read and write access of
+// the other bits. ownerSID, if any, gets full access too.
+func fileSDDL(perm os.FileMode, ownerSID, groupSID string) string {
+	var sddl strings.Builder
+	if perm == 0 {
+		sddl.WriteString("D:")
+	} else {
+		sddl.WriteString("D:P(A;;FA;;;OW)(A;;FA;;;SY)")
+	}
+	if ownerSID != "" {
+		sddl.WriteString("(A;;FA;;;" + ownerSID + ")")
+	}
+	if perm == 0 {
+		return sddl.String()
+	}
+
+	if rights := accessRights(perm >> 3); rights != "" && groupSID != "" {
+		sddl.WriteString("(A;;" + rights + ";;;" + groupSID + ")")
+	}
+	if rights := accessRights(perm); rights != "" {
+		sddl.WriteString("(A;;" + rights + ";;;WD)")
+	}
+	return sddl.String()
+}
+
+// accessRights returns the SDDL access rights of the read and write bits of the
+// lowest triplet of perm
+func accessRights(perm os.FileMode) string {
+	var rights string
+	if perm&0o4 != 0 {
+		rights += "FR"
+	}
+	if perm&0o2 != 0 {
+		rights += "FW"
+	}
+	return rights
+}
+
+// primaryGroupSID returns the primary group of the process, as a SID string, or ""
+// if it cannot be found
+var primaryGroupSID = sync.OnceValue(func() string {
+	group, err := windows.GetCurrentProcessToken().GetTokenPrimaryGroup()
+	if err != nil {
+		return ""
+	}
+	return group.PrimaryGroup.String()
+})
+
+// isDir reports whether name is an existing directory
+func isDir(name *uint16) bool {
+	attrs, err := windows.GetFileAttributes(name)
+	return err == nil && attrs&windows.FILE_ATTRIBUTE_DIRECTORY != 0
+}
@@ -0,0 +1,51 @@
+package windows
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFileSDDL tests the security descriptors matching Unix permission bits and owners
+func TestFileSDDL(t *testing.T) {
+	const group = "S-1-5-21-1-2-3-513"
+	cases := map[os.FileMode]string{
+		0o600: "D:P(A;;FA;;;OW)(A;;FA;;;SY)",
+		0o644: "D:P(A;;FA;;;OW)(A;;FA;;;SY)(A;;FR;;;" + group + ")(A;;FR;;;WD)",
+		0o640: "D:P(A;;FA;;;OW)(A;;FA;;;SY)(A;;FR;;;" + group + ")",
+		0o660: "D:P(A;;FA;;;OW)(A;;FA;;;SY)(A;;FRFW;;;" + group + ")",
+		0o664: "D:P(A;;FA;;;OW)(A;;FA;;;SY)(A;;FRFW;;;" + group + ")(A;;FR;;;WD)",
+		0o666: "D:P(A;;FA;;;OW)(A;;FA;;;SY)(A;;FRFW;;;" + group + ")(A;;FRFW;;;WD)",
+		0o620: "D:P(A;;FA;;;OW)(A;;FA;;;SY)(A;;FW;;;" + group + ")",
+		0o604: "D:P(A;;FA;;;OW)(A;;FA;;;SY)(A;;FR;;;WD)",
+	}
+	for perm, want := range cases {
+		assert.Equal(t, want, fileSDDL(perm, "", group), perm.String())
+	}
+	assert.Equal(t, "D:P(A;;FA;;;OW)(A;;FA;;;SY)", fileSDDL(0o660, "", ""), "no group, no group access")
+	assert.Equal(t, "D:(A;;FA;;;LS)", fileSDDL(0, "LS", group))
+	assert.Equal(t, "D:P(A;;FA;;;OW)(A;;FA;;;SY)(A;;FA;;;S-1-5-19)(A;;FR;;;"+group+")",
+		fileSDDL(0o640, "S-1-5-19", group))
+	assert.NotEmpty(t, primaryGroupSID())
+}
+
+// TestNoFollow tests that a symbolic link is not locked through
+func TestNoFollow(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "link.lock")
+	if err := os.Symlink(filepath.Join(dir, "target"), link); err != nil {
+		t.Skipf("creating symbolic links is not allowed: %v", err)
+	}
+
+	err := New(link, filelock.WithNoFollow()).Lock()
+	assert.ErrorIs(t, err, filelock.ErrUnsafePath)
+
+	lock := New(filepath.Join(dir, "regular.lock"), filelock.WithNoFollow(), filelock.WithPerm(0o600))
+	require.NoError(t, lock.Lock())
+	require.NoError(t, lock.Unlock())
+}
@@ -0,0 +1,32 @@
+package windows
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// extendedPrefix disables the MAX_PATH limit and path normalization of the Win32 API
+	extendedPrefix = `\\?\`
+
+	// extendedUNCPrefix replaces the leading \\ of UNC paths in extended form
+	extendedUNCPrefix = `\\?\UNC\`
+)
+
+// extendedPath returns the absolute, extended-length form of path, so that
+// paths longer than MAX_PATH and UNC shares (\\server\share\...) can be opened
+func extendedPath(path string) (string, error) {
+	if strings.HasPrefix(path, extendedPrefix) {
+		return path, nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(abs, `\\`) {
+		return extendedUNCPrefix + abs[2:], nil
+	}
+	return extendedPrefix + abs, nil
+}
@@ -0,0 +1,43 @@
+package windows
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExtendedPath tests the conversion of paths to their extended-length form
+func TestExtendedPath(t *testing.T) {
+	cases := map[string]string{
+		`C:\locks\app.lock`:           `\\?\C:\locks\app.lock`,
+		`C:/locks/app.lock`:           `\\?\C:\locks\app.lock`,
+		`\\server\share\app.lock`:     `\\?\UNC\server\share\app.lock`,
+		`\\?\C:\already\extended`:     `\\?\C:\already\extended`,
+		`\\?\UNC\server\share\a.lock`: `\\?\UNC\server\share\a.lock`,
+	}
+	for in, want := range cases {
+		got, err := extendedPath(in)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, in)
+	}
+}
+
+// TestLongPathLock tests locking a file whose path is longer than MAX_PATH
+func TestLongPathLock(t *testing.T) {
+	dir := t.TempDir()
+	long := filepath.Join(dir, strings.Repeat("d", 120), strings.Repeat("e", 120))
+	extended, err := extendedPath(long)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(extended, 0777))
+
+	lockPath := filepath.Join(long, "long.lock")
+	require.Greater(t, len(lockPath), 260)
+
+	lock := New(lockPath)
+	require.NoError(t, lock.Lock())
+	require.NoError(t, lock.Unlock())
+}
@@ -1,3 +1,5 @@
+//go:build unix
+
 package fs
 
 import (
@@ -6,6 +8,6 @@ import (
 )
 
 // New creates a new FileLock for the specified file path
-func New(path string) filelock.FileLock {
-	return unix.New(path)
+func New(path string, opts ...filelock.Option) filelock.FileLock {
+	return unix.New(path, opts...)
 }
@@ -6,6 +6,6 @@ import (
 )
 
 // New creates a new FileLock for the specified file path
-func New(path string) filelock.FileLock {
-	return windows.New(path)
+func New(path string, opts ...filelock.Option) filelock.FileLock {
+	return windows.New(path, opts...)
 }
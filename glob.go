@@ -0,0 +1,128 @@
+package fs
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// MultiLock is a set of locks acquired together and released together
+type MultiLock struct {
+	paths []string
+	locks []filelock.FileLock
+}
+
+// Paths returns the paths of the files covered by the locks, sorted
+func (m *MultiLock) Paths() []string {
+	return append([]string(nil), m.paths...)
+}
+
+// Locks returns the held locks, in acquisition order
+func (m *MultiLock) Locks() []filelock.FileLock {
+	return append([]filelock.FileLock(nil), m.locks...)
+}
+
+// Unlock releases every lock, in reverse acquisition order, and returns the
+// errors of the locks that could not be released
+func (m *MultiLock) Unlock() error {
+	var errs []error
+	for i := len(m.locks) - 1; i >= 0; i-- {
+		errs = append(errs, m.locks[i].Unlock())
+	}
+	return errors.Join(errs...)
+}
+
+// GlobOption configures AcquireGlob
+type GlobOption func(*globOptions)
+
+type globOptions struct {
+	dirLock bool
+}
+
+// WithDirLock also locks LockPath(dir) for the directories of the pattern and of
+// its matches, so that cooperating processes taking the same directory lock before
+// creating a file there cannot add matches while the MultiLock is held.
+func WithDirLock() GlobOption {
+	return func(o *globOptions) {
+		o.dirLock = true
+	}
+}
+
+// AcquireGlob locks LockPath(match) for every file matching pattern, as resolved by
+// filepath.Glob, within timeout. Lock files themselves never match. Locks are
+// acquired in sorted path order, so overlapping acquisitions do not deadlock, and
+// on failure the locks already acquired are released.
+// Files created after the glob is resolved are not covered, unless WithDirLock is used.
+func AcquireGlob(pattern string, timeout time.Duration, opts ...GlobOption) (*MultiLock, error) {
+	var o globOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	deadline := time.Now().Add(timeout)
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MultiLock{}
+	var lockPaths []string
+	dirs := make(map[string]bool)
+	for _, match := range matches {
+		if strings.HasSuffix(match, LockSuffix) {
+			continue
+		}
+		m.paths = append(m.paths, match)
+		lockPaths = append(lockPaths, LockPath(match))
+		dirs[filepath.Dir(match)] = true
+	}
+	sort.Strings(m.paths)
+
+	if o.dirLock {
+		if dir := filepath.Dir(pattern); !hasMeta(dir) {
+			dirs[dir] = true
+		}
+		for dir := range dirs {
+			lockPaths = append(lockPaths, LockPath(dir))
+		}
+	}
+
+	// A directory lock file sorts before the lock files of its entries
+	if err := m.lockSorted(lockPaths, nil, deadline); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// lockSorted locks lockPaths in sorted order before deadline, shared for the paths
+// in shared and exclusive for the others, and releases the locks already acquired
+// on failure
+func (m *MultiLock) lockSorted(lockPaths []string, shared map[string]bool, deadline time.Time) error {
+	sort.Strings(lockPaths)
+	for _, path := range lockPaths {
+		var opts []filelock.Option
+		if shared[path] {
+			opts = append(opts, filelock.WithShared())
+		}
+		lock := New(path, opts...)
+		if err := lock.LockWithTimeout(max(time.Until(deadline), 0)); err != nil {
+			_ = m.Unlock()
+			return err
+		}
+		m.locks = append(m.locks, lock)
+	}
+	return nil
+}
+
+// hasMeta reports whether path contains any of the magic characters of filepath.Match
+func hasMeta(path string) bool {
+	magic := `*?[`
+	if filepath.Separator != '\\' {
+		magic = `*?[\`
+	}
+	return strings.ContainsAny(path, magic)
+}
@@ -0,0 +1,87 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// GlobTestSuite defines a test suite for glob lock acquisition
+type GlobTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory with a few shards before each test
+func (s *GlobTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "glob-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+
+	for _, name := range []string{"shard-2", "shard-1", "shard-3", "other"} {
+		s.Require().NoError(os.WriteFile(filepath.Join(tempDir, name), nil, 0644))
+	}
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *GlobTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+	os.Remove(LockPath(s.tempDir))
+}
+
+// TestAcquireGlob tests that every match is locked and released
+func (s *GlobTestSuite) TestAcquireGlob() {
+	m, err := AcquireGlob(filepath.Join(s.tempDir, "shard-*"), time.Second)
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{
+		filepath.Join(s.tempDir, "shard-1"),
+		filepath.Join(s.tempDir, "shard-2"),
+		filepath.Join(s.tempDir, "shard-3"),
+	}, m.Paths())
+
+	other := New(LockPath(filepath.Join(s.tempDir, "shard-2")))
+	s.Assert().ErrorIs(other.LockWithTimeout(0), filelock.ErrLockHeld)
+
+	// Lock files created by the first acquisition do not match
+	_, err = AcquireGlob(filepath.Join(s.tempDir, "*"), 0)
+	s.Assert().ErrorIs(err, filelock.ErrLockHeld)
+
+	s.Require().NoError(m.Unlock())
+	s.Require().NoError(other.LockWithTimeout(0))
+	s.Require().NoError(other.Unlock())
+}
+
+// TestAcquireGlobReleasesOnFailure tests that a failed acquisition releases the acquired locks
+func (s *GlobTestSuite) TestAcquireGlobReleasesOnFailure() {
+	holder := New(LockPath(filepath.Join(s.tempDir, "shard-3")))
+	s.Require().NoError(holder.Lock())
+	defer holder.Unlock()
+
+	_, err := AcquireGlob(filepath.Join(s.tempDir, "shard-*"), 50*time.Millisecond)
+	s.Require().ErrorIs(err, filelock.ErrTimeout)
+
+	first := New(LockPath(filepath.Join(s.tempDir, "shard-1")))
+	s.Require().NoError(first.LockWithTimeout(0))
+	s.Require().NoError(first.Unlock())
+}
+
+// TestWithDirLock tests that the directory lock is held along with the matches
+func (s *GlobTestSuite) TestWithDirLock() {
+	m, err := AcquireGlob(filepath.Join(s.tempDir, "none-*"), time.Second, WithDirLock())
+	s.Require().NoError(err)
+	defer m.Unlock()
+
+	s.Assert().Empty(m.Paths())
+	s.Require().Len(m.Locks(), 1)
+	s.Assert().Equal(LockPath(s.tempDir), m.Locks()[0].Path())
+}
+
+// TestGlob runs the test suite
+func TestGlob(t *testing.T) {
+	suite.Run(t, new(GlobTestSuite))
+}
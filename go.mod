@@ -5,10 +5,13 @@ go 1.24.1
 require (
 	github.com/stretchr/testify v1.10.0
 	golang.org/x/sys v0.33.0
+	golang.org/x/tools v0.33.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/mod v0.24.0 // indirect
+	golang.org/x/sync v0.14.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,39 @@
+//go:build !windows
+
+// Package dirsync flushes directory entries to stable storage, so that file
+// creations, renames and removals survive a crash.
+package dirsync
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Sync flushes the directory entries of dir to stable storage
+func Sync(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Rename renames oldpath to newpath, replacing it, and flushes the directories of
+// both paths so the rename survives a crash
+func Rename(oldpath, newpath string) error {
+	if err := os.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	oldDir, newDir := filepath.Dir(oldpath), filepath.Dir(newpath)
+	if err := Sync(newDir); err != nil {
+		return err
+	}
+	if oldDir != newDir {
+		return Sync(oldDir)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+// Package dirsync flushes directory entries to stable storage, so that file
+// creations, renames and removals survive a crash.
+package dirsync
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Sync is a no-op on Windows, where directories cannot be flushed and NTFS
+// journals the rename itself
+func Sync(string) error {
+	return nil
+}
+
+// Rename renames oldpath to newpath, replacing it, with MOVEFILE_WRITE_THROUGH so
+// the call only returns once the rename is flushed to disk
+func Rename(oldpath, newpath string) error {
+	from, err := windows.UTF16PtrFromString(oldpath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	to, err := windows.UTF16PtrFromString(newpath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	err = windows.MoveFileEx(from, to, windows.MOVEFILE_REPLACE_EXISTING|windows.MOVEFILE_WRITE_THROUGH)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package dirsync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// MkdirAll creates dir and its missing parents with exactly the permission perm,
+// regardless of the umask, and flushes the directory entries of the created ones.
+// Directories created concurrently by another process are accepted, and existing
+// directories are left as they are.
+func MkdirAll(dir string, perm os.FileMode) error {
+	if info, err := os.Stat(dir); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	parent := filepath.Dir(dir)
+	if parent != dir {
+		if err := MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+
+	err := os.Mkdir(dir, perm)
+	if errors.Is(err, os.ErrExist) {
+		// Created by someone else in between
+		if info, statErr := os.Stat(dir); statErr == nil && info.IsDir() {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// The umask may have filtered perm
+	if err := os.Chmod(dir, perm); err != nil {
+		return err
+	}
+	return Sync(parent)
+}
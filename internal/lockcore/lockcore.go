@@ -0,0 +1,1019 @@
+// Package lockcore implements the state handling and retry logic shared by
+// the platform-specific FileLock implementations.
+package lockcore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/registry"
+)
+
+// Driver performs the platform-specific operations of a lock.
+// A Driver is only ever used by a single Lock, under the Lock's mutex.
+type Driver interface {
+	// Open prepares the handle used to lock path.
+	Open(path string) error
+
+	// TryLock makes a single non-blocking attempt to lock the open handle.
+	// It returns filelock.ErrLockHeld if the lock is held by someone else.
+	TryLock() error
+
+	// Unlock releases the lock held on the open handle.
+	Unlock() error
+
+	// Close releases the handle opened by Open.
+	Close() error
+}
+
+// Converter is implemented by Drivers able to change the mode of a held lock.
+type Converter interface {
+	// Convert makes a single non-blocking attempt to change the held lock to a
+	// shared or an exclusive one. It returns filelock.ErrLockHeld if the lock is
+	// held by someone else, in which case the held lock is kept, or an error
+	// wrapping filelock.ErrLockLost if the held lock could not be kept.
+	Convert(shared bool) error
+}
+
+// Reuser is implemented by Drivers able to keep their handle open between
+// acquisitions, see filelock.WithKeepOpen.
+type Reuser interface {
+	// Reusable reports whether the handle opened by Open can be locked again
+	// without opening it anew. A handle found stale by TryLock must be replaced
+	// by TryLock itself.
+	Reusable() bool
+}
+
+// ContextDriver is implemented by Drivers making calls that can be canceled, such
+// as requests to a lock service. They receive the context of the operation.
+type ContextDriver interface {
+	// TryLockContext is TryLock using ctx for the calls it makes.
+	TryLockContext(ctx context.Context) error
+
+	// UnlockContext is Unlock using ctx for the calls it makes.
+	UnlockContext(ctx context.Context) error
+}
+
+// Cloner is implemented by Drivers able to hold a shared lock on behalf of all
+// the Locks of this process on the same path, see filelock.WithCoalescedShared.
+type Cloner interface {
+	// Clone returns a new Driver, not opened yet, configured like this one.
+	Clone() Driver
+}
+
+// HolderReader is implemented by Drivers able to read the holder recorded on a
+// lock held by someone else, see filelock.AcquireStats.
+type HolderReader interface {
+	// ReadHolder returns the holder recorded on the lock, or nil if none is.
+	ReadHolder() *filelock.HolderRecord
+}
+
+// Identifier is implemented by Drivers able to identify the file they locked, so
+// that the Locks of different paths of the same file are recognized as such.
+type Identifier interface {
+	// FileID returns the identifier of the file locked by the last successful
+	// TryLock, or the zero FileID if it is unknown.
+	FileID() filelock.FileID
+}
+
+// sharedKey identifies the locks that can be coalesced
+type sharedKey struct {
+	path   string
+	offset uint64
+	length uint64
+}
+
+// sharedLock is a shared lock held by this process on behalf of refs Locks
+type sharedLock struct {
+	driver Driver
+	refs   int
+	id     filelock.FileID
+}
+
+// sharedLocks holds the coalesced shared locks of this process
+var sharedLocks = struct {
+	sync.Mutex
+	locks map[sharedKey]*sharedLock
+}{locks: make(map[sharedKey]*sharedLock)}
+
+// upgrades holds the canonical paths of the locks being upgraded in this process
+var upgrades = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// Lock implements the filelock.FileLock semantics on top of a Driver
+//
+// The operations using the driver (acquisitions, releases, conversions, Close)
+// are serialized by mutex, which an acquisition holds while it polls. Everything
+// else stays responsive meanwhile: the accessors read the status published on
+// every change of state under statusMutex, held only to copy it, Probe and Yield
+// answer from that status when mutex is busy, and waiters counts goroutines
+// without locking.
+type Lock struct {
+	path string
+	opts filelock.Options
+
+	// canonical is the canonical form of path, and fileID identifies the file
+	// while the lock is held, if the driver can tell
+	canonical string
+	fileID    filelock.FileID
+
+	driver Driver
+	opened bool
+	locked bool
+
+	// key identifies the shared lock of this process joined by the lock, and
+	// coalesced is set while it is joined
+	key       sharedKey
+	coalesced bool
+
+	shared     bool
+	acquiredAt time.Time
+	stats      filelock.AcquireStats
+	mutex      sync.Mutex
+
+	// firstHeld and holderBefore report whether the first attempt of the
+	// current acquisition found the lock held, and the holder read then
+	firstHeld    bool
+	holderBefore *filelock.HolderRecord
+
+	// status is republished under mutex on every state change, so that
+	// Status can be read without waiting for an in-flight acquisition
+	// It is guarded by its own mutex and stored by value, publishing does not
+	// allocate
+	status      filelock.Status
+	statusMutex sync.Mutex
+
+	// holdTask is the trace task spanning the hold period, if the execution
+	// tracer was on when the lock was acquired
+	holdTask *trace.Task
+
+	// waiters counts the goroutines inside LockWithTimeout, the lock is
+	// registered as active while it has waiters or is held
+	waiters atomic.Int32
+
+	// abort is done once Abort is called for the acquisitions started before,
+	// each acquisition keeping the one current when it started. It is replaced
+	// under abortMutex by Abort, so uncontended acquisitions do not allocate
+	abort       context.Context
+	abortCancel context.CancelFunc
+	abortMutex  sync.Mutex
+}
+
+// New creates a new Lock for path using driver for the platform-specific operations
+func New(path string, driver Driver, opts filelock.Options) *Lock {
+	l := &Lock{
+		path:      path,
+		canonical: filelock.CanonicalPath(path),
+		opts:      opts,
+		driver:    driver,
+		shared:    opts.Shared,
+	}
+	l.abort, l.abortCancel = context.WithCancel(context.Background())
+	if _, ok := driver.(Cloner); ok && opts.CoalesceShared {
+		l.key = sharedKey{path: l.canonical, offset: opts.RangeOffset, length: opts.RangeLength}
+	}
+	l.publish(filelock.Unlocked)
+	return l
+}
+
+// publish stores a new status snapshot, must be called with mutex held
+func (l *Lock) publish(state filelock.State) {
+	l.transition(state, nil)
+}
+
+// transition stores a new status snapshot and reports the change of state caused
+// by err, if any, to the StateChange option, must be called with mutex held
+func (l *Lock) transition(state filelock.State, err error) {
+	l.statusMutex.Lock()
+	from := l.status.State
+	l.status = filelock.Status{
+		Path:          l.path,
+		CanonicalPath: l.canonical,
+		FileID:        l.fileID,
+		State:         state,
+		Shared:        l.shared,
+		AcquiredAt:    l.acquiredAt,
+		LastAcquire:   l.stats,
+	}
+	l.statusMutex.Unlock()
+
+	// Called without statusMutex, so the callback can read the Status
+	if l.opts.StateChange != nil && from != state {
+		l.opts.StateChange(filelock.Transition{
+			Path:          l.path,
+			CanonicalPath: l.canonical,
+			From:          from,
+			To:            state,
+			Shared:        l.shared,
+			Time:          l.opts.Clock.Now(),
+			Err:           err,
+		})
+	}
+}
+
+// LockWithTimeout attempts to acquire the lock with a timeout
+// If timeout is <= 0, it's a non-blocking operation
+// If timeout is > 0, it will retry in a non-blocking manner until the timeout is reached
+func (l *Lock) LockWithTimeout(timeout time.Duration) error {
+	return l.lock(context.Background(), timeout)
+}
+
+// LockContext acquires the lock, retrying while it is held by someone else until
+// ctx is done, in which case it returns the error of ctx
+func (l *Lock) LockContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.lock(ctx, math.MaxInt64)
+}
+
+// TryLockContext makes a single attempt to acquire the lock, ctx only bounding
+// the calls made by drivers implementing ContextDriver
+func (l *Lock) TryLockContext(ctx context.Context) error {
+	return l.lock(ctx, 0)
+}
+
+// lock acquires the lock, retrying until timeout or until ctx is done
+func (l *Lock) lock(ctx context.Context, timeout time.Duration) error {
+	abort := l.pendingAbort()
+
+	// Register before waiting for the mutex, so blocked goroutines are visible
+	l.waiters.Add(1)
+	registry.Add(l)
+
+	if !l.mutex.TryLock() {
+		// Another goroutine is using this instance, label the wait for profiles
+		l.withLabels(ctx, filelock.PhaseQueued, l.mutex.Lock)
+	}
+	defer l.mutex.Unlock()
+	defer func() {
+		if l.waiters.Add(-1) == 0 && !l.locked {
+			registry.Remove(l)
+		}
+	}()
+
+	if abort.Err() != nil {
+		return filelock.ErrAborted
+	}
+	if l.locked {
+		return filelock.ErrAlreadyLocked
+	}
+
+	// Shared locks are coalesced with the other Locks of the process, without
+	// using the driver of this one
+	coalescing := l.coalescing()
+	if !coalescing {
+		if err := l.open(); err != nil {
+			l.audit(filelock.AuditEvent{Event: filelock.EventAcquire}, err)
+			return err
+		}
+	}
+
+	l.publish(filelock.Acquiring)
+	startTime := l.opts.Clock.Now()
+	l.firstHeld, l.holderBefore = false, nil
+	attempts, err := l.tryLock(ctx, abort, timeout, l.attempt(ctx, coalescing))
+	l.stats = filelock.AcquireStats{
+		Attempts:     attempts,
+		Waited:       l.since(startTime),
+		Contended:    l.firstHeld,
+		HolderBefore: l.holderBefore,
+	}
+	if l.auditLog() != nil {
+		l.audit(filelock.AuditEvent{
+			Event:    filelock.EventAcquire,
+			Attempts: l.stats.Attempts,
+			Waited:   l.stats.Waited.String(),
+		}, err)
+	}
+	if err != nil {
+		// Contention leaves the handle usable for the next attempt
+		contended := errors.Is(err, filelock.ErrLockHeld) || errors.Is(err, filelock.ErrTimeout)
+		_ = l.close(contended)
+		l.transition(filelock.Unlocked, err)
+		return err
+	}
+
+	l.locked = true
+	l.coalesced = coalescing
+	l.fileID = l.identify()
+	l.acquiredAt = l.opts.Clock.Now()
+	if trace.IsEnabled() {
+		var taskCtx context.Context
+		taskCtx, l.holdTask = trace.NewTask(ctx, filelock.TaskHold)
+		trace.Log(taskCtx, filelock.LabelPath, l.path)
+	}
+	l.publish(filelock.Locked)
+	return nil
+}
+
+// identify returns the identifier of the file of the held lock, or the zero FileID
+// if the driver cannot tell, must be called with mutex held
+func (l *Lock) identify() filelock.FileID {
+	if l.coalesced {
+		sharedLocks.Lock()
+		defer sharedLocks.Unlock()
+		return sharedLocks.locks[l.key].id
+	}
+	if driver, ok := l.driver.(Identifier); ok {
+		return driver.FileID()
+	}
+	return filelock.FileID{}
+}
+
+// coalescing reports whether the next acquisition joins the shared lock of the
+// process instead of using the driver of this lock
+func (l *Lock) coalescing() bool {
+	return l.shared && l.key.path != ""
+}
+
+// attempt returns the single non-blocking acquisition attempt of the lock
+func (l *Lock) attempt(ctx context.Context, coalescing bool) func() error {
+	if coalescing {
+		return l.joinShared
+	}
+	if driver, ok := l.driver.(ContextDriver); ok {
+		return func() error { return driver.TryLockContext(ctx) }
+	}
+	return l.driver.TryLock
+}
+
+// unlockDriver releases the lock held by the driver, with ctx if it makes calls
+func (l *Lock) unlockDriver(ctx context.Context) error {
+	if driver, ok := l.driver.(ContextDriver); ok {
+		return driver.UnlockContext(ctx)
+	}
+	return l.driver.Unlock()
+}
+
+// joinShared takes a reference on the shared lock of this process on the path of
+// the lock, acquiring it with a clone of the driver if no other Lock holds it
+func (l *Lock) joinShared() error {
+	sharedLocks.Lock()
+	defer sharedLocks.Unlock()
+
+	if shared, ok := sharedLocks.locks[l.key]; ok {
+		shared.refs++
+		return nil
+	}
+
+	driver := l.driver.(Cloner).Clone()
+	if err := driver.Open(l.path); err != nil {
+		return err
+	}
+	if err := driver.TryLock(); err != nil {
+		_ = driver.Close()
+		return err
+	}
+	shared := &sharedLock{driver: driver, refs: 1}
+	if identifier, ok := driver.(Identifier); ok {
+		shared.id = identifier.FileID()
+	}
+	sharedLocks.locks[l.key] = shared
+	return nil
+}
+
+// leaveShared drops the reference of the lock on the shared lock of this
+// process, releasing the shared lock with the last reference
+func (l *Lock) leaveShared() error {
+	sharedLocks.Lock()
+	defer sharedLocks.Unlock()
+
+	shared := sharedLocks.locks[l.key]
+	if shared.refs--; shared.refs > 0 {
+		return nil
+	}
+	delete(sharedLocks.locks, l.key)
+	err := shared.driver.Unlock()
+	return errors.Join(err, shared.driver.Close())
+}
+
+// tryLock makes attempts with the specified timeout or until ctx or abort is done,
+// attempt being a non-blocking lock operation returning filelock.ErrLockHeld on
+// contention
+// It uses a non-blocking approach for all cases and returns the number of attempts made
+func (l *Lock) tryLock(ctx, abort context.Context, timeout time.Duration, attempt func() error) (int, error) {
+	attempts := 1
+	err := attempt()
+
+	// If we got the lock immediately or the failure is not contention, return
+	if err == nil || !errors.Is(err, filelock.ErrLockHeld) {
+		return attempts, err
+	}
+	l.firstHeld = true
+	if reader, ok := l.driver.(HolderReader); ok {
+		l.holderBefore = reader.ReadHolder()
+	}
+
+	// If timeout <= 0, it's a non-blocking call, so return immediately
+	if timeout <= 0 {
+		return attempts, filelock.ErrLockHeld
+	}
+
+	// For timeout > 0, retry with polling until timeout, the context being
+	// derived only now to keep uncontended acquisitions free of allocations
+	pollCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := context.AfterFunc(abort, func() { cancel(filelock.ErrAborted) })
+	defer stop()
+	l.withLabels(ctx, filelock.PhaseBackoff, func() {
+		attempts, err = l.poll(pollCtx, timeout, attempts, attempt)
+	})
+	if err != nil && ctx.Err() == nil && errors.Is(context.Cause(pollCtx), filelock.ErrAborted) {
+		err = filelock.ErrAborted
+	}
+	return attempts, err
+}
+
+// pendingAbort returns the context done by the next call to Abort
+func (l *Lock) pendingAbort() context.Context {
+	l.abortMutex.Lock()
+	defer l.abortMutex.Unlock()
+	return l.abort
+}
+
+// Abort interrupts the acquisitions in progress on the lock, polling for it or
+// waiting for another operation on the instance, which return
+// filelock.ErrAborted. Acquisitions started afterwards are not affected, and a
+// held lock is left held.
+// It does not wait for the interrupted acquisitions to return.
+func (l *Lock) Abort() {
+	l.abortMutex.Lock()
+	defer l.abortMutex.Unlock()
+	l.abortCancel()
+	l.abort, l.abortCancel = context.WithCancel(context.Background())
+}
+
+// poll retries the lock, first spinning for the configured number of attempts,
+// then with exponential backoff, until it succeeds, fails with an error other
+// than contention, the timeout is reached or ctx is done
+func (l *Lock) poll(ctx context.Context, timeout time.Duration, attempts int, attempt func() error) (int, error) {
+	startTime := l.opts.Clock.Now()
+	retryInterval := time.Millisecond * 10 // Start with 10ms retry interval
+
+	for range l.opts.SpinAttempts {
+		if l.since(startTime) >= timeout {
+			return attempts, filelock.ErrTimeout
+		}
+		if l.exhausted(attempts) {
+			return attempts, &filelock.AttemptsError{Attempts: attempts}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return attempts, err
+		}
+
+		// Let the holder run, a short critical section may be over by now
+		runtime.Gosched()
+
+		attempts++
+		err := attempt()
+		if err == nil || !errors.Is(err, filelock.ErrLockHeld) {
+			return attempts, err
+		}
+	}
+
+	for {
+		// Check if we've exceeded the timeout
+		if l.since(startTime) >= timeout {
+			return attempts, filelock.ErrTimeout
+		}
+		if l.exhausted(attempts) {
+			return attempts, &filelock.AttemptsError{Attempts: attempts}
+		}
+
+		// Sleep for a short interval before retrying
+		if err := l.opts.Clock.Sleep(ctx, retryInterval); err != nil {
+			return attempts, err
+		}
+
+		// Increase retry interval for exponential backoff, but cap it at 100ms
+		if retryInterval < time.Millisecond*100 {
+			retryInterval = time.Duration(float64(retryInterval) * 1.5)
+		}
+
+		// Try to acquire the lock again (non-blocking)
+		attempts++
+		err := attempt()
+		if err == nil || !errors.Is(err, filelock.ErrLockHeld) {
+			return attempts, err
+		}
+	}
+}
+
+// exhausted reports whether attempts reached the bound set by
+// filelock.WithMaxAttempts
+func (l *Lock) exhausted(attempts int) bool {
+	return l.opts.MaxAttempts > 0 && attempts >= l.opts.MaxAttempts
+}
+
+// since returns the time elapsed since t according to the configured clock
+func (l *Lock) since(t time.Time) time.Duration {
+	return l.opts.Clock.Now().Sub(t)
+}
+
+// withLabels runs fn with the pprof labels of the given wait phase, in a trace
+// region of the phase when the execution tracer is on
+func (l *Lock) withLabels(ctx context.Context, phase string, fn func()) {
+	labels := pprof.Labels(filelock.LabelPath, l.path, filelock.LabelPhase, phase)
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		if !trace.IsEnabled() {
+			fn()
+			return
+		}
+		trace.Log(ctx, filelock.LabelPath, l.path)
+		trace.WithRegion(ctx, filelock.RegionPrefix+phase, fn)
+	})
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	return l.UnlockContext(context.Background())
+}
+
+// UnlockContext releases the lock, ctx bounding the calls made by drivers
+// implementing ContextDriver
+func (l *Lock) UnlockContext(ctx context.Context) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.locked {
+		if l.opts.IdempotentUnlock {
+			return nil
+		}
+		return filelock.ErrNotLocked
+	}
+
+	heldFor := l.since(l.acquiredAt)
+	l.publish(filelock.Releasing)
+	if l.coalesced {
+		err := l.leaveShared()
+		l.release()
+		l.auditRelease(heldFor, err)
+		return err
+	}
+	abandoned, err := l.unlockWithin(ctx)
+	if abandoned {
+		l.abandonDriver()
+		l.transition(filelock.Unlocked, err)
+		l.release()
+		l.auditRelease(heldFor, err)
+		return err
+	}
+	if err != nil {
+		if errors.Is(err, filelock.ErrLockLost) {
+			// Nothing is left to release, forget the lock
+			_ = l.close(false)
+			l.transition(filelock.Lost, err)
+			l.release()
+		} else {
+			l.publish(filelock.Locked)
+		}
+		l.auditRelease(heldFor, err)
+		return err
+	}
+
+	err = l.close(true)
+	l.release()
+	l.auditRelease(heldFor, err)
+	return err
+}
+
+// UnlockWithTimeout releases the lock like Unlock, giving up after timeout with
+// an error wrapping filelock.ErrAbandoned
+func (l *Lock) UnlockWithTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return l.UnlockContext(ctx)
+}
+
+// unlockWithin releases the lock held by the driver like unlockDriver, giving up
+// when ctx is done for the drivers ignoring it: the release goes on in the
+// background, closing the driver if it ever returns, and the driver is abandoned
+func (l *Lock) unlockWithin(ctx context.Context) (abandoned bool, err error) {
+	if _, ok := l.driver.(ContextDriver); ok || ctx.Done() == nil {
+		return false, l.unlockDriver(ctx)
+	}
+
+	driver := l.driver
+	done := make(chan error, 1)
+	go func() {
+		done <- driver.Unlock()
+	}()
+	select {
+	case err := <-done:
+		return false, err
+	case <-ctx.Done():
+	}
+	// A release completing with an already done ctx is not abandoned
+	select {
+	case err := <-done:
+		return false, err
+	default:
+	}
+
+	go func() {
+		<-done
+		_ = driver.Close()
+	}()
+	return true, fmt.Errorf("%w: releasing %s: %w", filelock.ErrAbandoned, l.path, context.Cause(ctx))
+}
+
+// abandonDriver replaces the driver left to a background release with a new one,
+// or with one failing with filelock.ErrAbandoned if it cannot be cloned
+func (l *Lock) abandonDriver() {
+	if cloner, ok := l.driver.(Cloner); ok {
+		l.driver = cloner.Clone()
+		return
+	}
+	l.driver = abandonedDriver{}
+}
+
+// abandonedDriver is the driver of a Lock whose driver was abandoned
+type abandonedDriver struct{}
+
+func (abandonedDriver) Open(string) error {
+	return fmt.Errorf("%w: the lock cannot be used anymore", filelock.ErrAbandoned)
+}
+
+func (abandonedDriver) TryLock() error {
+	return filelock.ErrAbandoned
+}
+
+func (abandonedDriver) Unlock() error {
+	return filelock.ErrNotLocked
+}
+
+func (abandonedDriver) Close() error {
+	return nil
+}
+
+// yieldWait bounds how long Yield waits for a waiter to take the released lock
+// before acquiring it again, longer than the longest backoff of the waiters
+const yieldWait = 250 * time.Millisecond
+
+// Yield releases the lock and acquires it again after the waiters of the process,
+// when it has been held for longer than the YieldAfter option while other locks of
+// the process on the same file are being acquired
+func (l *Lock) Yield(ctx context.Context) (bool, error) {
+	if !l.IsLocked() {
+		return false, filelock.ErrNotLocked
+	}
+	if l.opts.YieldAfter <= 0 || l.HeldDuration() < l.opts.YieldAfter || !l.contended() {
+		return false, nil
+	}
+
+	if err := l.UnlockContext(ctx); err != nil {
+		return false, err
+	}
+	// Competing right away would take the lock back before the waiters, which
+	// only retry after their backoff
+	start := l.opts.Clock.Now()
+	for l.contended() && l.since(start) < yieldWait {
+		if err := l.opts.Clock.Sleep(ctx, time.Millisecond); err != nil {
+			return true, err
+		}
+	}
+	return true, l.LockContext(ctx)
+}
+
+// contended reports whether other locks of the process on the same file are being
+// acquired
+func (l *Lock) contended() bool {
+	for _, status := range registry.Snapshot() {
+		if status.CanonicalPath == l.canonical && status.State == filelock.Acquiring {
+			return true
+		}
+	}
+	return false
+}
+
+// Downgrade converts the held exclusive lock to a shared one without releasing it
+func (l *Lock) Downgrade() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	converter, err := l.converter()
+	if err != nil || l.shared {
+		return err
+	}
+	if err := converter.Convert(true); err != nil {
+		return l.convertFailed(err)
+	}
+	l.shared = true
+	l.publish(filelock.Locked)
+	return nil
+}
+
+// Upgrade converts the held shared lock to an exclusive one, retrying until timeout
+func (l *Lock) Upgrade(timeout time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	converter, err := l.converter()
+	if err != nil || !l.shared {
+		return err
+	}
+
+	// Two shared holders upgrading at once would each wait for the other
+	upgrades.Lock()
+	if upgrades.paths[l.canonical] {
+		upgrades.Unlock()
+		return filelock.ErrDeadlock
+	}
+	upgrades.paths[l.canonical] = true
+	upgrades.Unlock()
+	defer func() {
+		upgrades.Lock()
+		delete(upgrades.paths, l.canonical)
+		upgrades.Unlock()
+	}()
+
+	_, err = l.tryLock(context.Background(), context.Background(), timeout, func() error { return converter.Convert(false) })
+	if err != nil {
+		return l.convertFailed(err)
+	}
+	l.shared = false
+	l.publish(filelock.Locked)
+	return nil
+}
+
+// converter returns the Converter of the driver of the held lock, must be called
+// with mutex held
+func (l *Lock) converter() (Converter, error) {
+	if !l.locked {
+		return nil, filelock.ErrNotLocked
+	}
+	converter, ok := l.driver.(Converter)
+	if !ok || l.coalesced {
+		return nil, errors.ErrUnsupported
+	}
+	return converter, nil
+}
+
+// convertFailed forgets the lock if the conversion lost it, must be called with
+// mutex held
+func (l *Lock) convertFailed(err error) error {
+	if errors.Is(err, filelock.ErrLockLost) {
+		l.auditRelease(l.since(l.acquiredAt), err)
+		_ = l.close(false)
+		l.transition(filelock.Lost, err)
+		l.release()
+	}
+	return err
+}
+
+// open opens the driver handle, unless the handle kept open by the previous
+// acquisition can be reused, must be called with mutex held
+func (l *Lock) open() error {
+	if l.opened {
+		if reuser, ok := l.driver.(Reuser); ok && reuser.Reusable() {
+			return nil
+		}
+		_ = l.close(false)
+	}
+	if err := l.driver.Open(l.path); err != nil {
+		return err
+	}
+	l.opened = true
+	return nil
+}
+
+// close closes the driver handle, or keeps it open for the next acquisition if
+// keep is set and the lock was created with filelock.WithKeepOpen, must be called
+// with mutex held
+func (l *Lock) close(keep bool) error {
+	if !l.opened {
+		return nil
+	}
+	if _, ok := l.driver.(Reuser); keep && ok && l.opts.KeepOpen {
+		return nil
+	}
+	l.opened = false
+	return l.driver.Close()
+}
+
+// Close releases the lock if it is held and closes the handle kept open by
+// filelock.WithKeepOpen, if any. The lock can be acquired again afterwards.
+func (l *Lock) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var err error
+	if l.locked {
+		heldFor := l.since(l.acquiredAt)
+		l.publish(filelock.Releasing)
+		if l.coalesced {
+			err = l.leaveShared()
+		} else {
+			err = l.unlockDriver(context.Background())
+		}
+		if errors.Is(err, filelock.ErrLockLost) {
+			l.transition(filelock.Lost, err)
+		}
+		l.release()
+		l.auditRelease(heldFor, err)
+	}
+	return errors.Join(err, l.close(false))
+}
+
+// Probe reports whether an acquisition of the lock would fail now because it is
+// held, by this instance or by someone else. When this instance does not hold it,
+// the lock is tried without waiting and released right away, without being
+// recorded in the statistics or the audit log.
+// It does not wait for an operation in progress on the instance: an acquisition
+// polling or a lock being released means the lock is held, by someone else or by
+// this instance.
+func (l *Lock) Probe(ctx context.Context) (bool, error) {
+	for !l.mutex.TryLock() {
+		switch l.snapshot().State {
+		case filelock.Acquiring, filelock.Locked, filelock.Releasing:
+			return true, nil
+		}
+		// A short operation, such as opening the file before an acquisition
+		// starts polling, the wait is not measured by the configured clock
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer l.mutex.Unlock()
+
+	if l.locked {
+		return true, nil
+	}
+	coalescing := l.coalescing()
+	if !coalescing {
+		if err := l.open(); err != nil {
+			return false, err
+		}
+	}
+
+	err := l.attempt(ctx, coalescing)()
+	switch {
+	case err == nil && coalescing:
+		return false, l.leaveShared()
+	case err == nil:
+		err = l.unlockDriver(ctx)
+		return false, errors.Join(err, l.close(err == nil))
+	case errors.Is(err, filelock.ErrLockHeld):
+		_ = l.close(true)
+		return true, nil
+	default:
+		_ = l.close(false)
+		return false, err
+	}
+}
+
+// ContextLock returns the filelock.ContextLock view of the lock
+func (l *Lock) ContextLock() filelock.ContextLock {
+	return contextLock{l}
+}
+
+// contextLock adapts a Lock to filelock.ContextLock
+type contextLock struct {
+	l *Lock
+}
+
+func (c contextLock) Lock(ctx context.Context) error {
+	return c.l.LockContext(ctx)
+}
+
+func (c contextLock) TryLock(ctx context.Context) error {
+	return c.l.TryLockContext(ctx)
+}
+
+func (c contextLock) Unlock(ctx context.Context) error {
+	return c.l.UnlockContext(ctx)
+}
+
+func (c contextLock) Probe(ctx context.Context) (bool, error) {
+	return c.l.Probe(ctx)
+}
+
+func (c contextLock) IsLocked() bool {
+	return c.l.IsLocked()
+}
+
+func (c contextLock) Path() string {
+	return c.l.Path()
+}
+
+func (c contextLock) Status() filelock.Status {
+	return c.l.Status()
+}
+
+// auditLog returns the audit log of the lock, or nil if events are not recorded
+func (l *Lock) auditLog() *filelock.AuditLog {
+	if l.opts.AuditLog != nil {
+		return l.opts.AuditLog
+	}
+	return filelock.DefaultAuditLog()
+}
+
+// auditRelease records a release after holding the lock for heldFor, only
+// formatting the event if there is an audit log
+func (l *Lock) auditRelease(heldFor time.Duration, err error) {
+	if l.auditLog() != nil {
+		l.audit(filelock.AuditEvent{Event: filelock.EventRelease, HeldFor: heldFor.String()}, err)
+	}
+}
+
+// audit records e with the outcome err in the audit log, if any
+// Failing to record an event does not fail the lock operation
+func (l *Lock) audit(e filelock.AuditEvent, err error) {
+	auditLog := l.auditLog()
+	if auditLog == nil {
+		return
+	}
+
+	e.Time = l.opts.Clock.Now()
+	e.Path = l.path
+	e.Shared = l.shared
+	e.Holder = filelock.CurrentHolder()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	_ = auditLog.Record(e)
+}
+
+// release marks the lock as not held, must be called with mutex held
+func (l *Lock) release() {
+	if l.holdTask != nil {
+		l.holdTask.End()
+		l.holdTask = nil
+	}
+	l.locked = false
+	l.coalesced = false
+	l.shared = l.opts.Shared
+	l.fileID = filelock.FileID{}
+	l.acquiredAt = time.Time{}
+	l.publish(filelock.Unlocked)
+	if l.waiters.Load() == 0 {
+		registry.Remove(l)
+	}
+}
+
+// Status returns a snapshot of the lock state
+// Like IsLocked, AcquiredAt, HeldDuration and LastAcquireStats, it reads the status
+// published on every change of state, and never waits for an in-flight acquisition
+// or release
+func (l *Lock) Status() filelock.Status {
+	status := l.snapshot()
+	status.Waiters = int(l.waiters.Load())
+	if status.State == filelock.Locked {
+		holder := filelock.CurrentHolder()
+		status.Holder = &holder
+		status.HeldFor = l.since(status.AcquiredAt)
+	}
+	return status
+}
+
+// snapshot returns the last published status
+func (l *Lock) snapshot() filelock.Status {
+	l.statusMutex.Lock()
+	defer l.statusMutex.Unlock()
+	return l.status
+}
+
+// IsLocked returns whether the lock is currently held, including while it is
+// being released
+func (l *Lock) IsLocked() bool {
+	state := l.snapshot().State
+	return state == filelock.Locked || state == filelock.Releasing
+}
+
+// AcquiredAt returns when the lock was acquired, or the zero time if it is not held
+func (l *Lock) AcquiredAt() time.Time {
+	return l.snapshot().AcquiredAt
+}
+
+// HeldDuration returns how long the lock has been held, or 0 if it is not held
+func (l *Lock) HeldDuration() time.Duration {
+	acquiredAt := l.AcquiredAt()
+	if acquiredAt.IsZero() {
+		return 0
+	}
+	return l.since(acquiredAt)
+}
+
+// LastAcquireStats returns the statistics of the most recent acquisition attempt
+func (l *Lock) LastAcquireStats() filelock.AcquireStats {
+	return l.snapshot().LastAcquire
+}
+
+// Path returns the path associated with this lock
+func (l *Lock) Path() string {
+	return l.path
+}
@@ -0,0 +1,798 @@
+package lockcore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/trace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/fakeclock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeDriver is a Driver reporting contention for a fixed number of attempts
+type fakeDriver struct {
+	heldFor   int
+	tries     int
+	tryErr    error
+	unlockErr error
+	open      bool
+	opens     int
+}
+
+func (d *fakeDriver) Open(string) error {
+	d.open = true
+	d.opens++
+	return nil
+}
+
+func (d *fakeDriver) TryLock() error {
+	d.tries++
+	if d.tryErr != nil {
+		return d.tryErr
+	}
+	if d.tries <= d.heldFor {
+		return filelock.ErrLockHeld
+	}
+	return nil
+}
+
+func (d *fakeDriver) Unlock() error {
+	return d.unlockErr
+}
+
+func (d *fakeDriver) Close() error {
+	d.open = false
+	return nil
+}
+
+// convertingDriver is a fakeDriver able to convert the held lock
+type convertingDriver struct {
+	fakeDriver
+	converts   int
+	convertErr error
+}
+
+func (d *convertingDriver) Convert(bool) error {
+	d.converts++
+	return d.convertErr
+}
+
+// reusableDriver is a fakeDriver able to keep its handle open
+type reusableDriver struct {
+	fakeDriver
+	stale bool
+}
+
+func (d *reusableDriver) Reusable() bool {
+	return !d.stale
+}
+
+// cloningDriver is a fakeDriver recording its clones
+type cloningDriver struct {
+	fakeDriver
+	clones []*fakeDriver
+}
+
+func (d *cloningDriver) Clone() Driver {
+	clone := &fakeDriver{heldFor: d.heldFor}
+	d.clones = append(d.clones, clone)
+	return clone
+}
+
+// hangingDriver is a cloningDriver whose Unlock hangs until release is closed, like
+// on a stuck network file system
+type hangingDriver struct {
+	cloningDriver
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (d *hangingDriver) Unlock() error {
+	<-d.release
+	return nil
+}
+
+func (d *hangingDriver) Close() error {
+	close(d.closed)
+	return nil
+}
+
+// blockingDriver is a fakeDriver whose TryLock blocks until proceed is closed
+type blockingDriver struct {
+	fakeDriver
+	proceed chan struct{}
+}
+
+func (d *blockingDriver) TryLock() error {
+	<-d.proceed
+	return d.fakeDriver.TryLock()
+}
+
+// cancelingDriver is a fakeDriver canceling a context on its cancelAt-th attempt
+type cancelingDriver struct {
+	fakeDriver
+	cancelAt int
+	cancel   context.CancelFunc
+}
+
+func (d *cancelingDriver) TryLock() error {
+	if d.tries+1 == d.cancelAt {
+		d.cancel()
+	}
+	return d.fakeDriver.TryLock()
+}
+
+// abortingDriver is a fakeDriver calling abort on its abortAt-th attempt
+type abortingDriver struct {
+	fakeDriver
+	abortAt int
+	abort   func()
+}
+
+func (d *abortingDriver) TryLock() error {
+	if d.tries+1 == d.abortAt {
+		d.abort()
+	}
+	return d.fakeDriver.TryLock()
+}
+
+// contextDriver is a fakeDriver recording the contexts it receives
+type contextDriver struct {
+	fakeDriver
+	contexts []context.Context
+}
+
+func (d *contextDriver) TryLockContext(ctx context.Context) error {
+	d.contexts = append(d.contexts, ctx)
+	return d.TryLock()
+}
+
+func (d *contextDriver) UnlockContext(ctx context.Context) error {
+	d.contexts = append(d.contexts, ctx)
+	return d.Unlock()
+}
+
+// LockCoreTestSuite defines a test suite for the shared lock logic
+type LockCoreTestSuite struct {
+	suite.Suite
+	clock *fakeclock.Clock
+}
+
+// SetupTest creates a fresh fake clock before each test
+func (s *LockCoreTestSuite) SetupTest() {
+	s.clock = fakeclock.New(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func (s *LockCoreTestSuite) newLock(driver Driver, opts ...filelock.Option) *Lock {
+	opts = append([]filelock.Option{filelock.WithClock(s.clock)}, opts...)
+	return New("fake.lock", driver, filelock.NewOptions(opts...))
+}
+
+// TestBackoffSchedule tests the exponential backoff intervals and their cap
+func (s *LockCoreTestSuite) TestBackoffSchedule() {
+	driver := &fakeDriver{heldFor: 9}
+	lock := s.newLock(driver)
+
+	err := lock.LockWithTimeout(time.Second)
+	s.Require().NoError(err)
+
+	s.Assert().Equal([]time.Duration{
+		10 * time.Millisecond,
+		15 * time.Millisecond,
+		22500 * time.Microsecond,
+		33750 * time.Microsecond,
+		50625 * time.Microsecond,
+		75937500 * time.Nanosecond,
+		113906250 * time.Nanosecond,
+		113906250 * time.Nanosecond,
+		113906250 * time.Nanosecond,
+	}, s.clock.Sleeps())
+	s.Assert().Equal(10, lock.LastAcquireStats().Attempts)
+	s.Assert().Equal(s.clock.Now(), lock.AcquiredAt())
+}
+
+// TestSpin tests that spinning retries without sleeping before the backoff starts
+func (s *LockCoreTestSuite) TestSpin() {
+	driver := &fakeDriver{heldFor: 3}
+	lock := s.newLock(driver, filelock.WithSpin(5))
+
+	s.Require().NoError(lock.LockWithTimeout(time.Second))
+	s.Assert().Empty(s.clock.Sleeps())
+	s.Assert().Equal(4, lock.LastAcquireStats().Attempts)
+	s.Require().NoError(lock.Unlock())
+
+	driver.tries, driver.heldFor = 0, 8
+	s.Require().NoError(lock.LockWithTimeout(time.Second))
+	s.Assert().Equal([]time.Duration{
+		10 * time.Millisecond,
+		15 * time.Millisecond,
+		22500 * time.Microsecond,
+	}, s.clock.Sleeps(), "the backoff starts over after the spin attempts")
+	s.Assert().Equal(9, lock.LastAcquireStats().Attempts)
+}
+
+// TestTimeout tests that the timeout is measured with the configured clock
+func (s *LockCoreTestSuite) TestTimeout() {
+	driver := &fakeDriver{heldFor: 1000}
+	lock := s.newLock(driver)
+
+	err := lock.LockWithTimeout(100 * time.Millisecond)
+	s.Require().Equal(filelock.ErrTimeout, err)
+	s.Assert().False(driver.open)
+
+	stats := lock.LastAcquireStats()
+	s.Assert().Equal(6, stats.Attempts)
+	s.Assert().Equal(131875*time.Microsecond, stats.Waited)
+}
+
+// TestMaxAttempts tests that an acquisition gives up after the maximum number of
+// attempts, reporting them
+func (s *LockCoreTestSuite) TestMaxAttempts() {
+	driver := &fakeDriver{heldFor: 1000}
+	lock := s.newLock(driver, filelock.WithMaxAttempts(3))
+
+	err := lock.LockWithTimeout(time.Hour)
+	s.Require().ErrorIs(err, filelock.ErrTimeout)
+	var attemptsErr *filelock.AttemptsError
+	s.Require().ErrorAs(err, &attemptsErr)
+	s.Assert().Equal(3, attemptsErr.Attempts)
+	s.Assert().Equal("timeout acquiring lock after 3 attempts", err.Error())
+	s.Assert().Equal(3, driver.tries)
+	s.Assert().Equal([]time.Duration{10 * time.Millisecond, 15 * time.Millisecond}, s.clock.Sleeps())
+	s.Assert().Equal(3, lock.LastAcquireStats().Attempts)
+	s.Assert().False(lock.IsLocked())
+
+	driver.tries, driver.heldFor = 0, 2
+	s.Require().NoError(lock.LockWithTimeout(time.Hour), "the third attempt succeeds")
+	s.Require().NoError(lock.Unlock())
+
+	driver.tries, driver.heldFor = 0, 1000
+	lock = s.newLock(driver, filelock.WithMaxAttempts(2), filelock.WithSpin(5))
+	err = lock.LockWithTimeout(time.Hour)
+	s.Require().ErrorAs(err, &attemptsErr)
+	s.Assert().Equal(2, attemptsErr.Attempts, "spin attempts count")
+
+	driver.tries = 0
+	s.Assert().Equal(filelock.ErrLockHeld, lock.LockWithTimeout(0), "non-blocking acquisitions are not affected")
+}
+
+// TestNonBlockingDoesNotSleep tests that a zero timeout makes a single attempt
+func (s *LockCoreTestSuite) TestNonBlockingDoesNotSleep() {
+	lock := s.newLock(&fakeDriver{heldFor: 1})
+
+	err := lock.LockWithTimeout(0)
+	s.Require().Equal(filelock.ErrLockHeld, err)
+	s.Assert().Empty(s.clock.Sleeps())
+	s.Assert().Equal(1, lock.LastAcquireStats().Attempts)
+}
+
+// TestDriverErrorStopsRetrying tests that errors other than contention are returned as is
+func (s *LockCoreTestSuite) TestDriverErrorStopsRetrying() {
+	driverErr := errors.New("boom")
+	driver := &fakeDriver{tryErr: driverErr}
+	lock := s.newLock(driver)
+
+	err := lock.LockWithTimeout(time.Second)
+	s.Require().Equal(driverErr, err)
+	s.Assert().Equal(1, driver.tries)
+	s.Assert().False(lock.IsLocked())
+}
+
+// TestHeldDuration tests that the held duration follows the configured clock
+func (s *LockCoreTestSuite) TestHeldDuration() {
+	lock := s.newLock(&fakeDriver{})
+	s.Require().NoError(lock.LockWithTimeout(0))
+
+	s.clock.Advance(time.Minute)
+	s.Assert().Equal(time.Minute, lock.HeldDuration())
+	s.Assert().Equal(time.Minute, lock.Status().HeldFor)
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestLostLockIsForgotten tests that a lock lost while held is no longer reported as held
+func (s *LockCoreTestSuite) TestLostLockIsForgotten() {
+	driver := &fakeDriver{}
+	lock := s.newLock(driver)
+	s.Require().NoError(lock.LockWithTimeout(0))
+
+	driver.unlockErr = fmt.Errorf("%w: share disconnected", filelock.ErrLockLost)
+	err := lock.Unlock()
+	s.Require().ErrorIs(err, filelock.ErrLockLost)
+	s.Assert().False(lock.IsLocked())
+	s.Assert().False(driver.open)
+	s.Assert().Equal(filelock.Unlocked, lock.Status().State)
+}
+
+// TestAuditLog tests that acquisitions and releases are recorded as JSON lines
+func (s *LockCoreTestSuite) TestAuditLog() {
+	var buf bytes.Buffer
+	lock := s.newLock(&fakeDriver{heldFor: 1}, filelock.WithAuditLog(filelock.NewAuditLog(&buf)))
+
+	s.Require().Equal(filelock.ErrLockHeld, lock.LockWithTimeout(0))
+	s.Require().NoError(lock.LockWithTimeout(time.Second))
+	s.clock.Advance(time.Minute)
+	s.Require().NoError(lock.Unlock())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	s.Require().Len(lines, 3)
+
+	var events []filelock.AuditEvent
+	for _, line := range lines {
+		var e filelock.AuditEvent
+		s.Require().NoError(json.Unmarshal([]byte(line), &e))
+		s.Assert().Equal("fake.lock", e.Path)
+		s.Assert().Equal(filelock.CurrentHolder(), e.Holder)
+		events = append(events, e)
+	}
+
+	s.Assert().Equal(filelock.EventAcquire, events[0].Event)
+	s.Assert().Equal(filelock.ErrLockHeld.Error(), events[0].Error)
+	s.Assert().Equal(filelock.EventAcquire, events[1].Event)
+	s.Assert().Empty(events[1].Error)
+	s.Assert().Equal(1, events[1].Attempts)
+	s.Assert().Equal(filelock.EventRelease, events[2].Event)
+	s.Assert().Equal("1m0s", events[2].HeldFor)
+	s.Assert().True(events[2].Time.Equal(s.clock.Now()))
+}
+
+// TestDefaultAuditLog tests that the process-wide audit log is used without WithAuditLog
+func (s *LockCoreTestSuite) TestDefaultAuditLog() {
+	var buf bytes.Buffer
+	filelock.SetDefaultAuditLog(filelock.NewAuditLog(&buf))
+	defer filelock.SetDefaultAuditLog(nil)
+
+	lock := s.newLock(&fakeDriver{})
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Require().NoError(lock.Unlock())
+	s.Assert().Equal(2, strings.Count(buf.String(), "\n"))
+}
+
+// TestConvert tests the state changes of Downgrade and Upgrade
+func (s *LockCoreTestSuite) TestConvert() {
+	driver := &convertingDriver{}
+	lock := s.newLock(driver)
+	s.Assert().Equal(filelock.ErrNotLocked, lock.Downgrade())
+	s.Require().NoError(lock.LockWithTimeout(0))
+
+	s.Require().NoError(lock.Upgrade(0), "upgrading an exclusive lock is a no-op")
+	s.Require().NoError(lock.Downgrade())
+	s.Assert().True(lock.Status().Shared)
+	s.Require().NoError(lock.Downgrade(), "downgrading a shared lock is a no-op")
+	s.Assert().Equal(1, driver.converts)
+
+	driver.convertErr = filelock.ErrLockHeld
+	s.Assert().Equal(filelock.ErrTimeout, lock.Upgrade(time.Second))
+	s.Assert().True(lock.IsLocked())
+	s.Assert().True(lock.Status().Shared)
+
+	driver.convertErr = nil
+	s.Require().NoError(lock.Upgrade(time.Second))
+	s.Assert().False(lock.Status().Shared)
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestConvertLost tests that a lock lost by a conversion is no longer reported as held
+func (s *LockCoreTestSuite) TestConvertLost() {
+	driver := &convertingDriver{}
+	lock := s.newLock(driver, filelock.WithShared())
+	s.Require().NoError(lock.LockWithTimeout(0))
+
+	driver.convertErr = fmt.Errorf("%w: dropped", filelock.ErrLockLost)
+	s.Assert().ErrorIs(lock.Upgrade(time.Second), filelock.ErrLockLost)
+	s.Assert().False(lock.IsLocked())
+	s.Assert().False(driver.open)
+
+	driver.convertErr = nil
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Assert().True(lock.Status().Shared, "the next acquisition uses the configured mode")
+}
+
+// TestConvertUnsupported tests that drivers without conversion report it
+func (s *LockCoreTestSuite) TestConvertUnsupported() {
+	lock := s.newLock(&fakeDriver{})
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Assert().ErrorIs(lock.Downgrade(), errors.ErrUnsupported)
+	s.Assert().True(lock.IsLocked())
+}
+
+// TestKeepOpen tests that the handle is reused across acquisitions until it is stale or closed
+func (s *LockCoreTestSuite) TestKeepOpen() {
+	driver := &reusableDriver{}
+	lock := s.newLock(driver, filelock.WithKeepOpen())
+
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Require().NoError(lock.Unlock())
+	s.Assert().True(driver.open)
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Require().NoError(lock.Unlock())
+	s.Assert().Equal(1, driver.opens)
+
+	driver.tries, driver.heldFor = 0, 1
+	s.Require().Equal(filelock.ErrLockHeld, lock.LockWithTimeout(0))
+	s.Assert().True(driver.open, "contention keeps the handle open")
+
+	driver.stale = true
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Assert().Equal(2, driver.opens)
+
+	s.Require().NoError(lock.Close())
+	s.Assert().False(driver.open)
+	s.Assert().False(lock.IsLocked())
+	s.Require().NoError(lock.Close(), "closing twice is a no-op")
+}
+
+// TestKeepOpenUnsupported tests that drivers unable to reuse their handle close it
+func (s *LockCoreTestSuite) TestKeepOpenUnsupported() {
+	driver := &fakeDriver{}
+	lock := s.newLock(driver, filelock.WithKeepOpen())
+
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Require().NoError(lock.Unlock())
+	s.Assert().False(driver.open)
+}
+
+// TestUncontendedAllocations tests that acquiring and releasing a free lock does not allocate
+func (s *LockCoreTestSuite) TestUncontendedAllocations() {
+	lock := s.newLock(&fakeDriver{})
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = lock.LockWithTimeout(time.Second)
+		_ = lock.Unlock()
+	})
+	s.Assert().Zero(allocs)
+}
+
+// TestCoalescedShared tests that shared locks on the same path share a single driver
+func (s *LockCoreTestSuite) TestCoalescedShared() {
+	drivers := []*cloningDriver{{}, {}, {}}
+	var locks []*Lock
+	for _, driver := range drivers {
+		locks = append(locks, s.newLock(driver, filelock.WithShared(), filelock.WithCoalescedShared()))
+	}
+	for _, lock := range locks {
+		s.Require().NoError(lock.LockWithTimeout(0))
+	}
+
+	s.Require().Len(drivers[0].clones, 1)
+	held := drivers[0].clones[0]
+	s.Assert().True(held.open)
+	for _, driver := range drivers {
+		s.Assert().Zero(driver.opens, "the drivers of the locks are not used")
+	}
+	s.Assert().Empty(drivers[1].clones)
+	s.Assert().Empty(drivers[2].clones)
+	s.Assert().ErrorIs(locks[2].Upgrade(0), errors.ErrUnsupported)
+
+	s.Require().NoError(locks[0].Unlock())
+	s.Require().NoError(locks[1].Unlock())
+	s.Assert().True(held.open, "the shared lock is held until the last release")
+	s.Require().NoError(locks[2].Unlock())
+	s.Assert().False(held.open)
+
+	s.Require().NoError(locks[1].LockWithTimeout(0))
+	s.Assert().Len(drivers[1].clones, 1, "the next acquisition locks again")
+	s.Require().NoError(locks[1].Unlock())
+}
+
+// TestCoalescedSharedContention tests that a contended coalesced lock is retried and released
+func (s *LockCoreTestSuite) TestCoalescedSharedContention() {
+	driver := &cloningDriver{fakeDriver: fakeDriver{heldFor: 1}}
+	lock := s.newLock(driver, filelock.WithShared(), filelock.WithCoalescedShared())
+
+	s.Require().Equal(filelock.ErrLockHeld, lock.LockWithTimeout(0))
+	s.Require().Len(driver.clones, 1)
+	s.Assert().False(driver.clones[0].open)
+
+	driver.heldFor = 0
+	s.Require().NoError(lock.LockWithTimeout(time.Second))
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestLockContextCanceled tests that LockContext retries until its context is done
+func (s *LockCoreTestSuite) TestLockContextCanceled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	driver := &cancelingDriver{fakeDriver: fakeDriver{heldFor: 1000}, cancelAt: 5, cancel: cancel}
+	lock := s.newLock(driver)
+
+	s.Require().ErrorIs(lock.LockContext(ctx), context.Canceled)
+	s.Assert().Equal(5, lock.LastAcquireStats().Attempts)
+	s.Assert().False(lock.IsLocked())
+	s.Assert().False(driver.open)
+
+	s.Assert().ErrorIs(lock.LockContext(ctx), context.Canceled, "a done context makes no attempt")
+	s.Assert().Equal(5, driver.tries)
+}
+
+// TestContextDriver tests that the context of the operation reaches the driver
+func (s *LockCoreTestSuite) TestContextDriver() {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "op")
+	driver := &contextDriver{}
+	lock := s.newLock(driver).ContextLock()
+
+	s.Require().NoError(lock.TryLock(ctx))
+	s.Require().NoError(lock.Unlock(ctx))
+	s.Require().Len(driver.contexts, 2)
+	for _, got := range driver.contexts {
+		s.Assert().Equal("op", got.Value(key{}))
+	}
+}
+
+// TestProbe tests that probing reports whether the lock is held without keeping it
+func (s *LockCoreTestSuite) TestProbe() {
+	driver := &fakeDriver{}
+	lock := s.newLock(driver)
+
+	held, err := lock.Probe(context.Background())
+	s.Require().NoError(err)
+	s.Assert().False(held)
+	s.Assert().False(lock.IsLocked())
+	s.Assert().False(driver.open)
+
+	driver.tries, driver.heldFor = 0, 1
+	held, err = lock.Probe(context.Background())
+	s.Require().NoError(err)
+	s.Assert().True(held)
+
+	s.Require().NoError(lock.LockWithTimeout(0))
+	held, err = lock.Probe(context.Background())
+	s.Require().NoError(err)
+	s.Assert().True(held, "a lock held by this instance is held")
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestStateChange tests the transitions reported for acquisitions, releases and losses
+func (s *LockCoreTestSuite) TestStateChange() {
+	var transitions []filelock.Transition
+	var lock *Lock
+	driver := &fakeDriver{heldFor: 1}
+	lock = s.newLock(driver, filelock.WithStateChange(func(t filelock.Transition) {
+		s.Assert().Equal("fake.lock", t.Path)
+		s.Assert().Equal(s.clock.Now(), t.Time)
+		s.Assert().Equal(t.To, lock.Status().State, "the status is published before the callback")
+		transitions = append(transitions, t)
+	}))
+
+	s.Require().Equal(filelock.ErrLockHeld, lock.LockWithTimeout(0))
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Require().NoError(lock.Unlock())
+
+	lostErr := fmt.Errorf("%w: share disconnected", filelock.ErrLockLost)
+	s.Require().NoError(lock.LockWithTimeout(0))
+	driver.unlockErr = lostErr
+	s.Require().ErrorIs(lock.Unlock(), filelock.ErrLockLost)
+
+	type step struct {
+		from, to filelock.State
+		err      error
+	}
+	var steps []step
+	for _, t := range transitions {
+		steps = append(steps, step{t.From, t.To, t.Err})
+	}
+	s.Assert().Equal([]step{
+		{filelock.Unlocked, filelock.Acquiring, nil},
+		{filelock.Acquiring, filelock.Unlocked, filelock.ErrLockHeld},
+		{filelock.Unlocked, filelock.Acquiring, nil},
+		{filelock.Acquiring, filelock.Locked, nil},
+		{filelock.Locked, filelock.Releasing, nil},
+		{filelock.Releasing, filelock.Unlocked, nil},
+		{filelock.Unlocked, filelock.Acquiring, nil},
+		{filelock.Acquiring, filelock.Locked, nil},
+		{filelock.Locked, filelock.Releasing, nil},
+		{filelock.Releasing, filelock.Lost, lostErr},
+		{filelock.Lost, filelock.Unlocked, nil},
+	}, steps)
+}
+
+// TestStateChangeChained tests that every WithStateChange callback is called
+func (s *LockCoreTestSuite) TestStateChangeChained() {
+	var first, second int
+	lock := s.newLock(&fakeDriver{},
+		filelock.WithStateChange(func(filelock.Transition) { first++ }),
+		filelock.WithStateChange(func(filelock.Transition) { second++ }),
+	)
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Assert().Equal(2, first)
+	s.Assert().Equal(2, second)
+}
+
+// TestUnlockAbandoned tests that a hung release is abandoned after the timeout,
+// leaving the driver to close itself if the release ever completes
+func (s *LockCoreTestSuite) TestUnlockAbandoned() {
+	driver := &hangingDriver{release: make(chan struct{}), closed: make(chan struct{})}
+	var transitions []filelock.Transition
+	lock := s.newLock(driver, filelock.WithStateChange(func(t filelock.Transition) {
+		transitions = append(transitions, t)
+	}))
+	s.Require().NoError(lock.LockWithTimeout(0))
+
+	err := lock.UnlockWithTimeout(10 * time.Millisecond)
+	s.Require().ErrorIs(err, filelock.ErrAbandoned)
+	s.Assert().ErrorIs(err, context.DeadlineExceeded)
+	s.Assert().False(lock.IsLocked())
+	s.Assert().Equal(filelock.Unlocked, lock.Status().State)
+	s.Assert().ErrorIs(transitions[len(transitions)-1].Err, filelock.ErrAbandoned)
+
+	// The lock goes on with a clone of the abandoned driver
+	s.Require().Len(driver.clones, 1)
+	s.Require().NoError(lock.LockWithTimeout(0))
+	s.Require().NoError(lock.UnlockWithTimeout(time.Second))
+
+	close(driver.release)
+	select {
+	case <-driver.closed:
+	case <-time.After(time.Second):
+		s.Fail("the abandoned driver is not closed after its release")
+	}
+}
+
+// TestUnlockAbandonedWithoutClone tests that a lock whose driver cannot be cloned
+// cannot be used after abandoning it
+func (s *LockCoreTestSuite) TestUnlockAbandonedWithoutClone() {
+	driver := &hangingDriver{release: make(chan struct{}), closed: make(chan struct{})}
+	defer close(driver.release)
+	lock := s.newLock(struct{ Driver }{driver})
+	s.Require().NoError(lock.LockWithTimeout(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Require().ErrorIs(lock.ContextLock().Unlock(ctx), filelock.ErrAbandoned)
+	s.Assert().ErrorIs(lock.LockWithTimeout(0), filelock.ErrAbandoned)
+}
+
+// TestAccessorsDoNotBlock tests that the accessors answer while an acquisition
+// holds the mutex of the instance
+func (s *LockCoreTestSuite) TestAccessorsDoNotBlock() {
+	driver := &blockingDriver{proceed: make(chan struct{})}
+	lock := s.newLock(driver)
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- lock.LockWithTimeout(time.Hour)
+	}()
+	s.Require().Eventually(func() bool {
+		return lock.Status().State == filelock.Acquiring
+	}, time.Second, time.Millisecond)
+
+	answered := make(chan struct{})
+	go func() {
+		defer close(answered)
+		s.Assert().False(lock.IsLocked())
+		s.Assert().Zero(lock.AcquiredAt())
+		s.Assert().Zero(lock.HeldDuration())
+		s.Assert().Zero(lock.LastAcquireStats())
+		s.Assert().Equal("fake.lock", lock.Path())
+	}()
+	select {
+	case <-answered:
+	case <-time.After(time.Second):
+		s.Fail("the accessors wait for the acquisition")
+	}
+
+	close(driver.proceed)
+	s.Require().NoError(<-acquired)
+	s.Assert().True(lock.IsLocked())
+	s.Assert().Equal(s.clock.Now(), lock.AcquiredAt())
+	s.Assert().Equal(1, lock.LastAcquireStats().Attempts)
+	s.Require().NoError(lock.Unlock())
+	s.Assert().False(lock.IsLocked())
+}
+
+// TestProbeDuringAcquisition tests that Probe and Yield answer while an acquisition
+// polls on the same instance
+func (s *LockCoreTestSuite) TestProbeDuringAcquisition() {
+	driver := &blockingDriver{proceed: make(chan struct{})}
+	lock := s.newLock(driver)
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- lock.LockWithTimeout(time.Hour)
+	}()
+	s.Require().Eventually(func() bool {
+		return lock.Status().State == filelock.Acquiring
+	}, time.Second, time.Millisecond)
+
+	answered := make(chan struct{})
+	go func() {
+		defer close(answered)
+		held, err := lock.Probe(context.Background())
+		s.Assert().NoError(err)
+		s.Assert().True(held)
+		_, err = lock.Yield(context.Background())
+		s.Assert().ErrorIs(err, filelock.ErrNotLocked)
+	}()
+	select {
+	case <-answered:
+	case <-time.After(time.Second):
+		s.Fail("Probe waits for the acquisition")
+	}
+
+	close(driver.proceed)
+	s.Require().NoError(<-acquired)
+	held, err := lock.Probe(context.Background())
+	s.Require().NoError(err)
+	s.Assert().True(held)
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestAbort tests that Abort interrupts a polling acquisition, and only the
+// acquisitions in progress
+func (s *LockCoreTestSuite) TestAbort() {
+	driver := &abortingDriver{fakeDriver: fakeDriver{heldFor: 1 << 30}, abortAt: 5}
+	lock := s.newLock(driver)
+	driver.abort = lock.Abort
+
+	s.Require().ErrorIs(lock.LockWithTimeout(24*time.Hour), filelock.ErrAborted)
+	s.Assert().GreaterOrEqual(lock.LastAcquireStats().Attempts, 5)
+	s.Assert().False(lock.IsLocked())
+
+	driver.fakeDriver = fakeDriver{heldFor: 2}
+	s.Require().NoError(lock.LockWithTimeout(time.Second), "a later acquisition is not aborted")
+	s.Assert().Equal(3, lock.LastAcquireStats().Attempts)
+	lock.Abort()
+	s.Assert().True(lock.IsLocked(), "Abort leaves a held lock held")
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestAbortQueued tests that Abort interrupts an acquisition waiting for another
+// operation on the instance
+func (s *LockCoreTestSuite) TestAbortQueued() {
+	driver := &blockingDriver{proceed: make(chan struct{})}
+	lock := s.newLock(driver)
+
+	first := make(chan error, 1)
+	go func() {
+		first <- lock.LockWithTimeout(time.Hour)
+	}()
+	s.Require().Eventually(func() bool {
+		return lock.Status().State == filelock.Acquiring
+	}, time.Second, time.Millisecond)
+
+	queued := make(chan error, 1)
+	go func() {
+		queued <- lock.LockWithTimeout(time.Hour)
+	}()
+	s.Require().Eventually(func() bool {
+		return lock.waiters.Load() == 2
+	}, time.Second, time.Millisecond)
+
+	lock.Abort()
+	close(driver.proceed)
+	s.Require().NoError(<-first, "an attempt in progress is not interrupted")
+	s.Assert().ErrorIs(<-queued, filelock.ErrAborted)
+	s.Assert().True(lock.IsLocked())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestTrace tests that the wait and the hold periods are annotated in the
+// execution trace
+func (s *LockCoreTestSuite) TestTrace() {
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		s.T().Skip("the execution tracer is already on")
+	}
+
+	lock := s.newLock(&fakeDriver{heldFor: 2})
+	s.Require().NoError(lock.LockWithTimeout(time.Second))
+	s.Assert().NotNil(lock.holdTask)
+	s.Require().NoError(lock.Unlock())
+	s.Assert().Nil(lock.holdTask)
+	trace.Stop()
+
+	for _, annotation := range []string{filelock.TaskHold, filelock.RegionPrefix + filelock.PhaseBackoff, "fake.lock"} {
+		s.Assert().True(bytes.Contains(buf.Bytes(), []byte(annotation)), annotation)
+	}
+}
+
+// TestLockCore runs the test suite
+func TestLockCore(t *testing.T) {
+	suite.Run(t, new(LockCoreTestSuite))
+}
@@ -0,0 +1,58 @@
+// Package registry keeps track of the locks of this process that are held or
+// being acquired, for the debugging and introspection tools.
+package registry
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// Entry is a lock that can describe its own state
+type Entry interface {
+	Status() filelock.Status
+}
+
+var (
+	mutex   sync.Mutex
+	entries = make(map[Entry]struct{})
+)
+
+// Add registers e as active, adding an entry that is already registered is a no-op
+func Add(e Entry) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	entries[e] = struct{}{}
+}
+
+// Remove unregisters e
+func Remove(e Entry) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	delete(entries, e)
+}
+
+// Snapshot returns the status of every registered entry, sorted by canonical path
+// so that the entries of the same file are next to each other, then by path
+func Snapshot() []filelock.Status {
+	mutex.Lock()
+	active := make([]Entry, 0, len(entries))
+	for e := range entries {
+		active = append(active, e)
+	}
+	mutex.Unlock()
+
+	// Status is read outside the registry mutex, entries may take their own locks
+	statuses := make([]filelock.Status, 0, len(active))
+	for _, e := range active {
+		statuses = append(statuses, e.Status())
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		if statuses[i].CanonicalPath != statuses[j].CanonicalPath {
+			return statuses[i].CanonicalPath < statuses[j].CanonicalPath
+		}
+		return statuses[i].Path < statuses[j].Path
+	})
+	return statuses
+}
@@ -0,0 +1,430 @@
+// Package kvstore is a small key-value store kept in a single file and shared by
+// several processes, for the cases where a map shared by a few processes is
+// needed and an embedded database is not.
+//
+// The file is an append-only log of checksummed records: Put and Delete append
+// a record, and every process replays the records appended by the others before
+// each operation. Every operation holds the lock on the sidecar lock file
+// "<path>.lock". Compact rewrites the log atomically with only the live entries,
+// either on demand or automatically past a size threshold.
+//
+// Every log starts with an epoch record, a random value written when the file is
+// created or compacted, so that a process tells a compacted file from the one it
+// replayed even if it reuses its inode and is not smaller.
+//
+// A record torn by a crash is ignored and overwritten by the next write.
+package kvstore
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/atomicfile"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// DefaultTimeout is the default time an operation waits for the lock
+const DefaultTimeout = 10 * time.Second
+
+// ErrNotFound is returned by Get for missing keys
+var ErrNotFound = errors.New("key not found")
+
+// errCorrupt reports a torn or corrupted record
+var errCorrupt = errors.New("corrupt record")
+
+const (
+	opPut    byte = 'P'
+	opDelete byte = 'D'
+	opEpoch  byte = 'E'
+
+	// headerSize is the size of the checksum and length preceding every record
+	headerSize = 8
+)
+
+// Store is a key-value store backed by a file
+type Store struct {
+	path             string
+	perm             os.FileMode
+	timeout          time.Duration
+	compactThreshold int64
+	lock             filelock.FileLock
+	mutex            sync.Mutex
+
+	// State replayed from the file, valid while info refers to the same file and
+	// epoch is its epoch
+	info    os.FileInfo
+	epoch   string
+	offset  int64
+	entries map[string]entry
+	live    int64
+}
+
+// entry is a live value and the size of the record holding it
+type entry struct {
+	value []byte
+	size  int64
+}
+
+// Option configures a Store
+type Option func(*Store)
+
+// WithTimeout sets how long operations wait for the lock, DefaultTimeout by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Store) {
+		s.timeout = timeout
+	}
+}
+
+// WithPerm sets the permission bits used when creating the file, 0644 by default
+func WithPerm(perm os.FileMode) Option {
+	return func(s *Store) {
+		s.perm = perm
+	}
+}
+
+// WithAutoCompact compacts the file after a write when it is larger than size
+// and more than half of it is made of overwritten or deleted entries
+func WithAutoCompact(size int64) Option {
+	return func(s *Store) {
+		s.compactThreshold = size
+	}
+}
+
+// Open opens the store kept in the file at path, which is created by the first write
+func Open(path string, opts ...Option) (*Store, error) {
+	s := &Store{
+		path:    path,
+		perm:    0644,
+		timeout: DefaultTimeout,
+		lock:    fs.New(fs.LockPath(path)),
+		entries: make(map[string]entry),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, s.locked(func() error { return nil })
+}
+
+// Path returns the path of the store file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns the value of key, or ErrNotFound
+func (s *Store) Get(key string) ([]byte, error) {
+	var value []byte
+	err := s.locked(func() error {
+		e, ok := s.entries[key]
+		if !ok {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), e.value...)
+		return nil
+	})
+	return value, err
+}
+
+// Put sets the value of key
+func (s *Store) Put(key string, value []byte) error {
+	return s.locked(func() error {
+		return s.append(opPut, key, value)
+	})
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (s *Store) Delete(key string) error {
+	return s.locked(func() error {
+		if _, ok := s.entries[key]; !ok {
+			return nil
+		}
+		return s.append(opDelete, key, nil)
+	})
+}
+
+// Range calls fn for every entry in key order, until fn returns false.
+// fn sees a consistent snapshot and runs without holding the lock, so it may
+// use the store.
+func (s *Store) Range(fn func(key string, value []byte) bool) error {
+	var keys []string
+	var values [][]byte
+	err := s.locked(func() error {
+		keys = make([]string, 0, len(s.entries))
+		for key := range s.entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values = make([][]byte, len(keys))
+		for i, key := range keys {
+			values[i] = append([]byte(nil), s.entries[key].value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, key := range keys {
+		if !fn(key, values[i]) {
+			break
+		}
+	}
+	return nil
+}
+
+// Len returns the number of keys
+func (s *Store) Len() (int, error) {
+	n := 0
+	err := s.locked(func() error {
+		n = len(s.entries)
+		return nil
+	})
+	return n, err
+}
+
+// Compact atomically rewrites the file with only the live entries
+func (s *Store) Compact() error {
+	return s.locked(s.compact)
+}
+
+// locked runs fn holding the lock, after replaying the records written by other processes
+func (s *Store) locked(fn func() error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.lock.LockWithTimeout(s.timeout); err != nil {
+		return err
+	}
+	defer s.lock.Unlock()
+
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// refresh replays the records appended since the last operation, or the whole
+// file if it was replaced by a compaction
+func (s *Store) refresh() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		s.reset(nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	epoch := readEpoch(file, info.Size())
+	if s.info == nil || !os.SameFile(s.info, info) || info.Size() < s.offset || epoch != s.epoch {
+		s.reset(info)
+	}
+	s.info = info
+	s.epoch = epoch
+	if info.Size() == s.offset {
+		return nil
+	}
+
+	if _, err := file.Seek(s.offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(file)
+	for {
+		op, key, value, size, err := readRecord(r, info.Size()-s.offset)
+		if err == io.EOF || errors.Is(err, errCorrupt) {
+			// A torn tail is overwritten by the next append
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.apply(op, key, value, size)
+	}
+}
+
+// newEpoch returns a random epoch
+func newEpoch() string {
+	epoch := make([]byte, 8)
+	_, _ = rand.Read(epoch)
+	return string(epoch)
+}
+
+// readEpoch returns the epoch of the log in file, of size bytes, or "" if it does
+// not start with an epoch record, like the logs of older versions and the ones
+// torn by a crash when created
+func readEpoch(file *os.File, size int64) string {
+	r := bufio.NewReader(io.NewSectionReader(file, 0, size))
+	op, _, value, _, err := readRecord(r, size)
+	if err != nil || op != opEpoch {
+		return ""
+	}
+	return string(value)
+}
+
+// reset forgets the replayed state
+func (s *Store) reset(info os.FileInfo) {
+	s.info = info
+	s.epoch = ""
+	s.offset = 0
+	s.live = 0
+	clear(s.entries)
+}
+
+// apply updates the replayed state with a record
+func (s *Store) apply(op byte, key string, value []byte, size int64) {
+	if op == opEpoch {
+		s.offset += size
+		return
+	}
+	if old, ok := s.entries[key]; ok {
+		s.live -= old.size
+		delete(s.entries, key)
+	}
+	if op == opPut {
+		s.entries[key] = entry{value: value, size: size}
+		s.live += size
+	}
+	s.offset += size
+}
+
+// append writes a record at the end of the valid records and flushes it, after the
+// epoch record if the log is empty
+func (s *Store) append(op byte, key string, value []byte) error {
+	var records []byte
+	var epoch string
+	if s.offset == 0 {
+		epoch = newEpoch()
+		records = encodeRecord(opEpoch, "", []byte(epoch))
+	}
+	epochSize := int64(len(records))
+	record := encodeRecord(op, key, value)
+	records = append(records, record...)
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY, s.perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Overwrite a torn tail, if any
+	if err := file.Truncate(s.offset); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(records, s.offset); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if s.info, err = file.Stat(); err != nil {
+		return err
+	}
+
+	if epochSize > 0 {
+		s.epoch = epoch
+		s.apply(opEpoch, "", nil, epochSize)
+	}
+	s.apply(op, key, append([]byte(nil), value...), int64(len(record)))
+	if s.compactThreshold > 0 && s.offset > s.compactThreshold && s.offset > 2*s.live {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact rewrites the file with the live entries
+func (s *Store) compact() error {
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	epoch := newEpoch()
+	data := encodeRecord(opEpoch, "", []byte(epoch))
+	for _, key := range keys {
+		data = append(data, encodeRecord(opPut, key, s.entries[key].value)...)
+	}
+
+	perm := s.perm
+	if s.info != nil {
+		perm = s.info.Mode().Perm()
+	}
+	if err := atomicfile.WriteFile(s.path, data, perm); err != nil {
+		return err
+	}
+
+	// The live entries keep the size of their records, now the whole file
+	info, err := os.Stat(s.path)
+	if err != nil {
+		s.reset(nil)
+		return err
+	}
+	s.info = info
+	s.epoch = epoch
+	s.offset = int64(len(data))
+	return nil
+}
+
+// encodeRecord encodes a record as its checksum and length, both little-endian
+// uint32, followed by the operation, the uvarint key length, the key and the value
+func encodeRecord(op byte, key string, value []byte) []byte {
+	payload := make([]byte, 0, 1+binary.MaxVarintLen64+len(key)+len(value))
+	payload = append(payload, op)
+	payload = binary.AppendUvarint(payload, uint64(len(key)))
+	payload = append(payload, key...)
+	payload = append(payload, value...)
+
+	record := make([]byte, headerSize, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(record[4:8], uint32(len(payload)))
+	return append(record, payload...)
+}
+
+// readRecord decodes the next record, of at most remaining bytes, and returns its total size
+func readRecord(r *bufio.Reader, remaining int64) (op byte, key string, value []byte, size int64, err error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errCorrupt
+		}
+		return 0, "", nil, 0, err
+	}
+
+	length := int64(binary.LittleEndian.Uint32(header[4:8]))
+	if length > remaining-headerSize {
+		return 0, "", nil, 0, errCorrupt
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errCorrupt
+		}
+		return 0, "", nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[0:4]) || len(payload) == 0 {
+		return 0, "", nil, 0, errCorrupt
+	}
+
+	op = payload[0]
+	keyLen, n := binary.Uvarint(payload[1:])
+	if n <= 0 || keyLen > uint64(len(payload)-1-n) || (op != opPut && op != opDelete && op != opEpoch) {
+		return 0, "", nil, 0, errCorrupt
+	}
+	key = string(payload[1+n : 1+n+int(keyLen)])
+	value = payload[1+n+int(keyLen):]
+	return op, key, value, int64(headerSize + len(payload)), nil
+}
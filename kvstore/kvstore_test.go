@@ -0,0 +1,208 @@
+package kvstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// KVStoreTestSuite defines a test suite for the key-value store
+type KVStoreTestSuite struct {
+	suite.Suite
+	tempDir string
+	path    string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *KVStoreTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "kvstore-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.path = filepath.Join(tempDir, "store.kv")
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *KVStoreTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *KVStoreTestSuite) open(opts ...Option) *Store {
+	store, err := Open(s.path, opts...)
+	s.Require().NoError(err)
+	return store
+}
+
+// TestPutGetDelete tests the basic operations
+func (s *KVStoreTestSuite) TestPutGetDelete() {
+	store := s.open()
+
+	_, err := store.Get("a")
+	s.Assert().ErrorIs(err, ErrNotFound)
+
+	s.Require().NoError(store.Put("a", []byte("1")))
+	s.Require().NoError(store.Put("a", []byte("2")))
+	value, err := store.Get("a")
+	s.Require().NoError(err)
+	s.Assert().Equal("2", string(value))
+
+	s.Require().NoError(store.Delete("a"))
+	s.Require().NoError(store.Delete("missing"))
+	_, err = store.Get("a")
+	s.Assert().ErrorIs(err, ErrNotFound)
+}
+
+// TestSharedBetweenInstances tests that writes of one instance are seen by another
+func (s *KVStoreTestSuite) TestSharedBetweenInstances() {
+	first, second := s.open(), s.open()
+
+	s.Require().NoError(first.Put("k", []byte("from first")))
+	value, err := second.Get("k")
+	s.Require().NoError(err)
+	s.Assert().Equal("from first", string(value))
+
+	s.Require().NoError(second.Compact())
+	s.Require().NoError(first.Put("k2", []byte("after compaction")))
+	value, err = second.Get("k2")
+	s.Require().NoError(err)
+	s.Assert().Equal("after compaction", string(value))
+
+	n, err := second.Len()
+	s.Require().NoError(err)
+	s.Assert().Equal(2, n)
+}
+
+// TestRange tests that entries are visited in key order until fn stops
+func (s *KVStoreTestSuite) TestRange() {
+	store := s.open()
+	for _, key := range []string{"c", "a", "b"} {
+		s.Require().NoError(store.Put(key, []byte(key+key)))
+	}
+
+	var visited []string
+	err := store.Range(func(key string, value []byte) bool {
+		s.Assert().Equal(key+key, string(value))
+		visited = append(visited, key)
+		return key != "b"
+	})
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{"a", "b"}, visited)
+}
+
+// TestCompact tests that compaction keeps only the live entries
+func (s *KVStoreTestSuite) TestCompact() {
+	store := s.open()
+	for i := 0; i < 100; i++ {
+		s.Require().NoError(store.Put("counter", []byte(fmt.Sprint(i))))
+	}
+	s.Require().NoError(store.Put("gone", []byte("x")))
+	s.Require().NoError(store.Delete("gone"))
+
+	before, err := os.Stat(s.path)
+	s.Require().NoError(err)
+	s.Require().NoError(store.Compact())
+	after, err := os.Stat(s.path)
+	s.Require().NoError(err)
+	s.Assert().Less(after.Size(), before.Size()/50)
+
+	value, err := s.open().Get("counter")
+	s.Require().NoError(err)
+	s.Assert().Equal("99", string(value))
+}
+
+// TestCompactReusingInode tests that a compacted file is replayed from its start
+// even if it reuses the inode of the replayed one and is not smaller
+func (s *KVStoreTestSuite) TestCompactReusingInode() {
+	first, second := s.open(), s.open()
+	for i := range 10 {
+		s.Require().NoError(first.Put(fmt.Sprint("key", i), []byte("old")))
+	}
+
+	s.Require().NoError(second.Delete("key0"))
+	s.Require().NoError(second.Compact())
+	s.Require().NoError(second.Put("new", make([]byte, 200)))
+
+	// As if the file system gave the new file the inode of the old one
+	info, err := os.Stat(s.path)
+	s.Require().NoError(err)
+	s.Require().GreaterOrEqual(info.Size(), first.offset)
+	first.info = info
+
+	_, err = first.Get("key0")
+	s.Assert().ErrorIs(err, ErrNotFound)
+	value, err := first.Get("new")
+	s.Require().NoError(err)
+	s.Assert().Len(value, 200)
+	n, err := first.Len()
+	s.Require().NoError(err)
+	s.Assert().Equal(10, n)
+}
+
+// TestAutoCompact tests that the file is compacted past the threshold
+func (s *KVStoreTestSuite) TestAutoCompact() {
+	store := s.open(WithAutoCompact(1024))
+	for i := 0; i < 1000; i++ {
+		s.Require().NoError(store.Put("key", []byte(fmt.Sprint(i))))
+	}
+
+	info, err := os.Stat(s.path)
+	s.Require().NoError(err)
+	s.Assert().LessOrEqual(info.Size(), int64(1024))
+}
+
+// TestTornRecord tests that a torn record is ignored and overwritten
+func (s *KVStoreTestSuite) TestTornRecord() {
+	store := s.open()
+	s.Require().NoError(store.Put("a", []byte("1")))
+
+	torn := encodeRecord(opPut, "b", []byte("2"))
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+	s.Require().NoError(err)
+	_, err = file.Write(torn[:len(torn)-1])
+	s.Require().NoError(err)
+	s.Require().NoError(file.Close())
+
+	other := s.open()
+	_, err = other.Get("b")
+	s.Assert().ErrorIs(err, ErrNotFound)
+
+	s.Require().NoError(other.Put("c", []byte("3")))
+	for key, want := range map[string]string{"a": "1", "c": "3"} {
+		value, err := s.open().Get(key)
+		s.Require().NoError(err)
+		s.Assert().Equal(want, string(value))
+	}
+}
+
+// TestConcurrentWriters tests that concurrent writers never lose an update
+func (s *KVStoreTestSuite) TestConcurrentWriters() {
+	const numWriters, numKeys = 4, 50
+
+	var wg sync.WaitGroup
+	for w := 0; w < numWriters; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store, err := Open(s.path, WithAutoCompact(4096))
+			if !s.Assert().NoError(err) {
+				return
+			}
+			for i := 0; i < numKeys; i++ {
+				s.Assert().NoError(store.Put(fmt.Sprintf("w%d-k%d", w, i), []byte("v")))
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := s.open().Len()
+	s.Require().NoError(err)
+	s.Assert().Equal(numWriters*numKeys, n)
+}
+
+// TestKVStore runs the test suite
+func TestKVStore(t *testing.T) {
+	suite.Run(t, new(KVStoreTestSuite))
+}
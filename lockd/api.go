@@ -0,0 +1,82 @@
+package lockd
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// Default limits of the server and the client
+const (
+	DefaultLeaseTTL   = 30 * time.Second
+	DefaultMaxTTL     = 10 * time.Minute
+	DefaultMaxTimeout = time.Minute
+)
+
+// Error codes of the API, mapped to the filelock errors by the client
+const (
+	codeLockHeld    = "lock_held"
+	codeTimeout     = "timeout"
+	codeNotLocked   = "not_locked"
+	codeBadRequest  = "bad_request"
+	codeServerError = "server_error"
+)
+
+// ErrBadRequest is returned by the client for requests rejected by the server
+var ErrBadRequest = errors.New("lockd: bad request")
+
+// acquireRequest is the body of POST /v1/locks/{name}/acquire
+type acquireRequest struct {
+	// Timeout is how long the server waits for the lock, as a time.Duration string
+	Timeout string `json:"timeout,omitempty"`
+
+	// TTL is how long the lease lasts without renewal, as a time.Duration string
+	TTL string `json:"ttl,omitempty"`
+
+	// Owner identifies the client process
+	Owner filelock.Holder `json:"owner"`
+}
+
+// renewRequest is the body of POST /v1/locks/{name}/renew
+type renewRequest struct {
+	Token string `json:"token"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+// releaseRequest is the body of POST /v1/locks/{name}/release
+type releaseRequest struct {
+	Token string `json:"token"`
+}
+
+// Lease describes a lock held through the server
+type Lease struct {
+	// Name is the name of the lock.
+	Name string `json:"name"`
+
+	// Token authenticates the renewals and the release, only sent to the acquirer.
+	Token string `json:"token,omitempty"`
+
+	// Owner is the client process holding the lease.
+	Owner filelock.Holder `json:"owner"`
+
+	// AcquiredAt is when the lock was acquired.
+	AcquiredAt time.Time `json:"acquired_at"`
+
+	// ExpiresAt is when the lease expires unless renewed.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Attempts is the number of attempts the acquisition took.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// errorResponse is the body of the error responses
+type errorResponse struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// listResponse is the body of GET /v1/locks
+type listResponse struct {
+	Leases []Lease `json:"leases"`
+}
@@ -0,0 +1,308 @@
+package lockd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// Client acquires locks from a Server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	ttl        time.Duration
+	owner      filelock.Holder
+}
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the http.Client used to reach the server, http.DefaultClient by default
+func WithHTTPClient(c *http.Client) ClientOption {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithLeaseTTL sets the TTL of the leases, DefaultLeaseTTL by default.
+// Held locks renew their lease every third of the TTL.
+func WithLeaseTTL(ttl time.Duration) ClientOption {
+	return func(client *Client) {
+		client.ttl = ttl
+	}
+}
+
+// NewClient creates a Client for the server at baseURL, e.g. "http://locks.internal:7070"
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		ttl:        DefaultLeaseTTL,
+		owner:      filelock.CurrentHolder(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewLock returns the lock called name, which is not acquired yet
+func (c *Client) NewLock(name string) *Lock {
+	return &Lock{client: c, name: name}
+}
+
+// Inspect returns the lease of the lock called name, or filelock.ErrNotLocked if
+// it is not held through the server
+func (c *Client) Inspect(ctx context.Context, name string) (Lease, error) {
+	var lease Lease
+	err := c.call(ctx, http.MethodGet, name, "", nil, &lease)
+	return lease, err
+}
+
+// List returns the leases held through the server
+func (c *Client) List(ctx context.Context) ([]Lease, error) {
+	var resp listResponse
+	err := c.call(ctx, http.MethodGet, "", "", nil, &resp)
+	return resp.Leases, err
+}
+
+// call performs an API call, decoding the response into out and mapping error responses
+func (c *Client) call(ctx context.Context, method, name, action string, in, out any) error {
+	u := c.baseURL + "/v1/locks"
+	if name != "" {
+		u += "/" + url.PathEscape(name)
+	}
+	if action != "" {
+		u += "/" + action
+	}
+
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			return fmt.Errorf("lockd: %s", resp.Status)
+		}
+		return e.err()
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// err maps an error response to the filelock error it stands for
+func (e errorResponse) err() error {
+	switch e.Code {
+	case codeLockHeld:
+		return filelock.ErrLockHeld
+	case codeTimeout:
+		return filelock.ErrTimeout
+	case codeNotLocked:
+		return filelock.ErrNotLocked
+	case codeBadRequest:
+		return fmt.Errorf("%w: %s", ErrBadRequest, e.Error)
+	default:
+		return fmt.Errorf("lockd: %s", e.Error)
+	}
+}
+
+// Lock is a filelock.FileLock held through a Server
+type Lock struct {
+	client *Client
+	name   string
+
+	// mutex serializes the operations, which hold it during calls to the server.
+	// stateMutex is only held to change or read token, acquiredAt and stats, so
+	// the accessors never wait for a call to the server.
+	mutex      sync.Mutex
+	stateMutex sync.Mutex
+
+	// Guarded by mutex, and by stateMutex for token, acquiredAt and stats
+	token      string
+	acquiredAt time.Time
+	stats      filelock.AcquireStats
+	stop       chan struct{}
+	done       chan struct{}
+
+	// lost is set by the renewal goroutine when the server dropped the lease
+	lost error
+}
+
+var _ filelock.FileLock = (*Lock)(nil)
+
+// Lock acquires the lock without waiting
+// If the lock cannot be acquired immediately, it returns ErrLockHeld
+func (l *Lock) Lock() error {
+	return l.LockWithTimeout(0)
+}
+
+// LockWithTimeout acquires the lock, the server waiting up to timeout for it
+func (l *Lock) LockWithTimeout(timeout time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.token != "" {
+		return filelock.ErrAlreadyLocked
+	}
+
+	start := time.Now()
+	var lease Lease
+	err := l.client.call(context.Background(), http.MethodPost, l.name, "acquire", acquireRequest{
+		Timeout: max(timeout, 0).String(),
+		TTL:     l.client.ttl.String(),
+		Owner:   l.client.owner,
+	}, &lease)
+	stats := filelock.AcquireStats{Attempts: max(lease.Attempts, 1), Waited: time.Since(start)}
+	if err != nil {
+		l.setState(l.token, l.acquiredAt, stats)
+		return err
+	}
+
+	l.setState(lease.Token, time.Now(), stats)
+	l.lost = nil
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.keepAlive(l.token, l.stop, l.done)
+	return nil
+}
+
+// Unlock releases the lock. It returns an error wrapping filelock.ErrLockLost if
+// the lease expired on the server while the lock was believed held.
+func (l *Lock) Unlock() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.token == "" {
+		return filelock.ErrNotLocked
+	}
+	close(l.stop)
+	<-l.done
+
+	token, lost := l.token, l.lost
+	l.setState("", time.Time{}, l.stats)
+	if lost != nil {
+		return lost
+	}
+
+	err := l.client.call(context.Background(), http.MethodPost, l.name, "release", releaseRequest{Token: token}, nil)
+	if errors.Is(err, filelock.ErrNotLocked) {
+		return fmt.Errorf("%w: lease of %s expired", filelock.ErrLockLost, l.name)
+	}
+	return err
+}
+
+// keepAlive renews the lease every third of its TTL until stop is closed
+func (l *Lock) keepAlive(token string, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(l.client.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.client.ttl/3)
+		err := l.client.call(ctx, http.MethodPost, l.name, "renew", renewRequest{Token: token, TTL: l.client.ttl.String()}, nil)
+		cancel()
+		if errors.Is(err, filelock.ErrNotLocked) {
+			// The lease expired, other errors are retried until it does
+			l.lost = fmt.Errorf("%w: lease of %s expired", filelock.ErrLockLost, l.name)
+			return
+		}
+	}
+}
+
+// setState changes the state read by the accessors, must be called with mutex held
+func (l *Lock) setState(token string, acquiredAt time.Time, stats filelock.AcquireStats) {
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+	l.token, l.acquiredAt, l.stats = token, acquiredAt, stats
+}
+
+// IsLocked returns whether the lock is held, as far as this process knows
+// Like the other accessors, it never waits for an operation in progress
+func (l *Lock) IsLocked() bool {
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+	return l.token != ""
+}
+
+// Path returns the name of the lock
+func (l *Lock) Path() string {
+	return l.name
+}
+
+// AcquiredAt returns when the lock was acquired, or the zero time if it is not held
+func (l *Lock) AcquiredAt() time.Time {
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+	return l.acquiredAt
+}
+
+// HeldDuration returns how long the lock has been held, or 0 if it is not held
+func (l *Lock) HeldDuration() time.Duration {
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+	if l.token == "" {
+		return 0
+	}
+	return time.Since(l.acquiredAt)
+}
+
+// LastAcquireStats returns the statistics of the most recent acquisition attempt
+// Attempts are counted by the server
+func (l *Lock) LastAcquireStats() filelock.AcquireStats {
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+	return l.stats
+}
+
+// Status returns a snapshot of the lock state as known by this process
+func (l *Lock) Status() filelock.Status {
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+
+	status := filelock.Status{Path: l.name, State: filelock.Unlocked, LastAcquire: l.stats}
+	if l.token != "" {
+		owner := l.client.owner
+		status.State = filelock.Locked
+		status.Holder = &owner
+		status.AcquiredAt = l.acquiredAt
+		status.HeldFor = time.Since(l.acquiredAt)
+	}
+	return status
+}
+
+// String describes the lock and its current state
+func (l *Lock) String() string {
+	return l.Status().String()
+}
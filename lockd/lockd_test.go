@@ -0,0 +1,186 @@
+package lockd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// LockdTestSuite defines a test suite for the lock server and client
+type LockdTestSuite struct {
+	suite.Suite
+	tempDir string
+	server  *Server
+	http    *httptest.Server
+}
+
+// SetupTest starts a server on a temporary lock directory before each test
+func (s *LockdTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "lockd-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+
+	s.server, err = NewServer(tempDir)
+	s.Require().NoError(err)
+	s.http = httptest.NewServer(s.server)
+}
+
+// TearDownTest stops the server and removes the temporary directory after each test
+func (s *LockdTestSuite) TearDownTest() {
+	s.http.Close()
+	s.server.Close()
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *LockdTestSuite) client(opts ...ClientOption) *Client {
+	return NewClient(s.http.URL, opts...)
+}
+
+// TestLockAndUnlock tests the acquisition and release through the server
+func (s *LockdTestSuite) TestLockAndUnlock() {
+	lock := s.client().NewLock("jobs/nightly")
+
+	s.Require().NoError(lock.Lock())
+	s.Assert().True(lock.IsLocked())
+	s.Assert().Equal(filelock.ErrAlreadyLocked, lock.Lock())
+	s.Assert().FileExists(filepath.Join(s.tempDir, "jobs%2Fnightly.lock"))
+
+	lease, err := s.client().Inspect(context.Background(), "jobs/nightly")
+	s.Require().NoError(err)
+	s.Assert().Equal(filelock.CurrentHolder(), lease.Owner)
+	s.Assert().Empty(lease.Token)
+
+	s.Require().NoError(lock.Unlock())
+	s.Assert().False(lock.IsLocked())
+	s.Assert().Equal(filelock.ErrNotLocked, lock.Unlock())
+
+	_, err = s.client().Inspect(context.Background(), "jobs/nightly")
+	s.Assert().ErrorIs(err, filelock.ErrNotLocked)
+}
+
+// TestContention tests that clients exclude each other
+func (s *LockdTestSuite) TestContention() {
+	first, second := s.client().NewLock("shared"), s.client().NewLock("shared")
+
+	s.Require().NoError(first.Lock())
+	s.Assert().ErrorIs(second.Lock(), filelock.ErrLockHeld)
+	s.Assert().ErrorIs(second.LockWithTimeout(50*time.Millisecond), filelock.ErrTimeout)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = first.Unlock()
+	}()
+	s.Require().NoError(second.LockWithTimeout(time.Second))
+	s.Assert().Greater(second.LastAcquireStats().Attempts, 1)
+	s.Require().NoError(second.Unlock())
+}
+
+// TestAccessorsDuringAcquisition tests that the accessors answer while the server
+// is waiting for the lock on behalf of the same instance
+func (s *LockdTestSuite) TestAccessorsDuringAcquisition() {
+	holder, waiter := s.client().NewLock("busy"), s.client().NewLock("busy")
+	s.Require().NoError(holder.Lock())
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- waiter.LockWithTimeout(time.Second)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	s.Assert().False(waiter.IsLocked())
+	s.Assert().Equal(filelock.Unlocked, waiter.Status().State)
+	s.Assert().Less(time.Since(start), 50*time.Millisecond)
+
+	s.Require().NoError(holder.Unlock())
+	s.Require().NoError(<-acquired)
+	s.Assert().True(waiter.IsLocked())
+	s.Require().NoError(waiter.Unlock())
+}
+
+// TestDisconnectedWaiter tests that a client disconnecting while the server waits
+// for the lock does not get a lease
+func (s *LockdTestSuite) TestDisconnectedWaiter() {
+	holder := s.client().NewLock("busy")
+	s.Require().NoError(holder.Lock())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.http.URL+"/v1/locks/busy/acquire",
+		strings.NewReader(`{"timeout": "1m"}`))
+	s.Require().NoError(err)
+	_, err = http.DefaultClient.Do(req)
+	s.Require().ErrorIs(err, context.DeadlineExceeded)
+
+	time.Sleep(50 * time.Millisecond)
+	s.Require().NoError(holder.Unlock())
+	time.Sleep(100 * time.Millisecond)
+	_, err = s.client().Inspect(context.Background(), "busy")
+	s.Assert().ErrorIs(err, filelock.ErrNotLocked, "the disconnected client got a lease")
+
+	other := s.client().NewLock("busy")
+	s.Require().NoError(other.LockWithTimeout(time.Second))
+	s.Require().NoError(other.Unlock())
+}
+
+// TestRenewal tests that held locks keep their lease beyond its TTL
+func (s *LockdTestSuite) TestRenewal() {
+	lock := s.client(WithLeaseTTL(150 * time.Millisecond)).NewLock("renewed")
+	s.Require().NoError(lock.Lock())
+
+	time.Sleep(400 * time.Millisecond)
+	s.Assert().ErrorIs(s.client().NewLock("renewed").Lock(), filelock.ErrLockHeld)
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestExpiredLease tests that an expired lease releases the lock and is reported as lost
+func (s *LockdTestSuite) TestExpiredLease() {
+	lock := s.client(WithLeaseTTL(time.Hour)).NewLock("expiring")
+	s.Require().NoError(lock.Lock())
+
+	// Expire the lease as if the client had stopped renewing it
+	s.server.mutex.Lock()
+	l := s.server.leases["expiring"]
+	s.server.mutex.Unlock()
+	s.server.expire("expiring", l.Token)
+
+	other := s.client().NewLock("expiring")
+	s.Require().NoError(other.Lock())
+	s.Assert().ErrorIs(lock.Unlock(), filelock.ErrLockLost)
+	s.Require().NoError(other.Unlock())
+}
+
+// TestList tests the listing of the held leases
+func (s *LockdTestSuite) TestList() {
+	for _, name := range []string{"b", "a"} {
+		lock := s.client().NewLock(name)
+		s.Require().NoError(lock.Lock())
+		defer lock.Unlock()
+	}
+
+	leases, err := s.client().List(context.Background())
+	s.Require().NoError(err)
+	s.Require().Len(leases, 2)
+	s.Assert().Equal("a", leases[0].Name)
+	s.Assert().Equal("b", leases[1].Name)
+}
+
+// TestLockPath tests that lock names are escaped into file names
+func (s *LockdTestSuite) TestLockPath() {
+	s.Assert().Equal(filepath.Join(s.tempDir, "a.b-c_d.lock"), s.server.lockPath("a.b-c_d"))
+	s.Assert().Equal(filepath.Join(s.tempDir, "%2E.%2Fx%3A.lock"), s.server.lockPath("../x:"))
+}
+
+// TestLockd runs the test suite
+func TestLockd(t *testing.T) {
+	suite.Run(t, new(LockdTestSuite))
+}
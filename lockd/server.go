@@ -0,0 +1,342 @@
+// Package lockd serves locks over HTTP, for teams that want a single coordination
+// host without adopting etcd or Consul.
+//
+// The Server holds local file locks on behalf of its clients, under leases that
+// expire unless renewed, so locks of crashed or partitioned clients are released.
+// The Client returns locks implementing filelock.FileLock, which acquire through
+// the server and renew their lease in the background while held.
+//
+// The API is JSON over HTTP:
+//
+//	POST /v1/locks/{name}/acquire   {"timeout": "5s", "ttl": "30s", "owner": {...}}
+//	POST /v1/locks/{name}/renew     {"token": "...", "ttl": "30s"}
+//	POST /v1/locks/{name}/release   {"token": "..."}
+//	GET  /v1/locks/{name}
+//	GET  /v1/locks
+package lockd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// Server serves the locks kept in a lock directory
+type Server struct {
+	dir        string
+	maxTTL     time.Duration
+	maxTimeout time.Duration
+	mux        *http.ServeMux
+
+	mutex  sync.Mutex
+	leases map[string]*lease
+}
+
+// lease is a lock held on behalf of a client
+type lease struct {
+	Lease
+	lock  filelock.FileLock
+	timer *time.Timer
+}
+
+// ServerOption configures a Server
+type ServerOption func(*Server)
+
+// WithMaxTTL caps the lease TTL requested by clients, DefaultMaxTTL by default
+func WithMaxTTL(ttl time.Duration) ServerOption {
+	return func(s *Server) {
+		s.maxTTL = ttl
+	}
+}
+
+// WithMaxTimeout caps the acquisition timeout requested by clients, DefaultMaxTimeout by default
+func WithMaxTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.maxTimeout = timeout
+	}
+}
+
+// NewServer creates a Server keeping its lock files in dir, created if needed
+func NewServer(dir string, opts ...ServerOption) (*Server, error) {
+	s := &Server{
+		dir:        dir,
+		maxTTL:     DefaultMaxTTL,
+		maxTimeout: DefaultMaxTimeout,
+		mux:        http.NewServeMux(),
+		leases:     make(map[string]*lease),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	s.mux.HandleFunc("POST /v1/locks/{name}/acquire", s.acquire)
+	s.mux.HandleFunc("POST /v1/locks/{name}/renew", s.renew)
+	s.mux.HandleFunc("POST /v1/locks/{name}/release", s.release)
+	s.mux.HandleFunc("GET /v1/locks/{name}", s.inspect)
+	s.mux.HandleFunc("GET /v1/locks", s.list)
+	return s, nil
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close releases every lease
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var errs []error
+	for name, l := range s.leases {
+		l.timer.Stop()
+		errs = append(errs, l.lock.Unlock())
+		delete(s.leases, name)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) acquire(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var req acquireRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	timeout, ok := parseDuration(w, req.Timeout, 0, s.maxTimeout)
+	if !ok {
+		return
+	}
+	ttl, ok := parseDuration(w, req.TTL, DefaultLeaseTTL, s.maxTTL)
+	if !ok {
+		return
+	}
+
+	lock := fs.New(s.lockPath(name))
+	if err := acquireLock(r.Context(), lock, timeout); err != nil {
+		writeError(w, err)
+		return
+	}
+	if r.Context().Err() != nil {
+		// The client disconnected as the lock was acquired
+		_ = lock.Unlock()
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		_ = lock.Unlock()
+		writeError(w, err)
+		return
+	}
+
+	now := time.Now()
+	l := &lease{
+		Lease: Lease{
+			Name:       name,
+			Token:      token,
+			Owner:      req.Owner,
+			AcquiredAt: now,
+			ExpiresAt:  now.Add(ttl),
+			Attempts:   lock.LastAcquireStats().Attempts,
+		},
+		lock: lock,
+	}
+
+	s.mutex.Lock()
+	s.leases[name] = l
+	l.timer = time.AfterFunc(ttl, func() { s.expire(name, token) })
+	s.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, l.Lease)
+}
+
+// acquireLock acquires lock within timeout, or with a single attempt if timeout is
+// <= 0, giving up when ctx is done, so a client disconnecting while waiting does
+// not get a lease
+func acquireLock(ctx context.Context, lock filelock.FileLock, timeout time.Duration) error {
+	ctxLock := filelock.AsContextLock(lock)
+	if timeout <= 0 {
+		return ctxLock.TryLock(ctx)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := ctxLock.Lock(waitCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("%w after %s", filelock.ErrTimeout, timeout)
+	}
+	return err
+}
+
+func (s *Server) renew(w http.ResponseWriter, r *http.Request) {
+	var req renewRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	ttl, ok := parseDuration(w, req.TTL, DefaultLeaseTTL, s.maxTTL)
+	if !ok {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	l, ok := s.leases[r.PathValue("name")]
+	if !ok || l.Token != req.Token {
+		writeError(w, filelock.ErrNotLocked)
+		return
+	}
+	l.ExpiresAt = time.Now().Add(ttl)
+	l.timer.Reset(ttl)
+	writeJSON(w, http.StatusOK, l.Lease)
+}
+
+func (s *Server) release(w http.ResponseWriter, r *http.Request) {
+	var req releaseRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name := r.PathValue("name")
+	l, ok := s.leases[name]
+	if !ok || l.Token != req.Token {
+		writeError(w, filelock.ErrNotLocked)
+		return
+	}
+	l.timer.Stop()
+	delete(s.leases, name)
+	if err := l.lock.Unlock(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) inspect(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	l, ok := s.leases[r.PathValue("name")]
+	if !ok {
+		writeError(w, filelock.ErrNotLocked)
+		return
+	}
+	writeJSON(w, http.StatusOK, l.public())
+}
+
+func (s *Server) list(w http.ResponseWriter, _ *http.Request) {
+	s.mutex.Lock()
+	leases := make([]Lease, 0, len(s.leases))
+	for _, l := range s.leases {
+		leases = append(leases, l.public())
+	}
+	s.mutex.Unlock()
+
+	sort.Slice(leases, func(i, j int) bool { return leases[i].Name < leases[j].Name })
+	writeJSON(w, http.StatusOK, listResponse{Leases: leases})
+}
+
+// expire releases the lease of name if it is still the one identified by token
+func (s *Server) expire(name, token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if l, ok := s.leases[name]; ok && l.Token == token {
+		delete(s.leases, name)
+		_ = l.lock.Unlock()
+	}
+}
+
+// public returns the lease without its token
+func (l *lease) public() Lease {
+	out := l.Lease
+	out.Token = ""
+	return out
+}
+
+// lockPath returns the path of the lock file of name, with every byte other than
+// ASCII letters, digits, '-', '_' and '.' escaped as %XX
+func (s *Server) lockPath(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return filepath.Join(s.dir, b.String()+fs.LockSuffix)
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// decode decodes the JSON body of r into v, writing an error response on failure
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Code: codeBadRequest, Error: err.Error()})
+		return false
+	}
+	return true
+}
+
+// parseDuration parses a duration of the API, applying a default and a maximum
+func parseDuration(w http.ResponseWriter, value string, def, limit time.Duration) (time.Duration, bool) {
+	if value == "" {
+		return min(def, limit), true
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Code: codeBadRequest, Error: fmt.Sprintf("invalid duration %q", value)})
+		return 0, false
+	}
+	return min(d, limit), true
+}
+
+// writeError writes err with the code the client maps back to a filelock error
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, filelock.ErrLockHeld):
+		writeJSON(w, http.StatusConflict, errorResponse{Code: codeLockHeld, Error: err.Error()})
+	case errors.Is(err, filelock.ErrTimeout):
+		writeJSON(w, http.StatusConflict, errorResponse{Code: codeTimeout, Error: err.Error()})
+	case errors.Is(err, filelock.ErrNotLocked):
+		writeJSON(w, http.StatusNotFound, errorResponse{Code: codeNotLocked, Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Code: codeServerError, Error: err.Error()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
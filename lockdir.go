@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lockDirBase is a directory under which DefaultLockDir may create the lock
+// directory of an application, with the permission to give it
+type lockDirBase struct {
+	path string
+	perm os.FileMode
+
+	// system marks the system-wide directory used by SystemLockDir
+	system bool
+}
+
+// DefaultLockDir returns the platform's directory for the lock files of appName,
+// creating it if needed, so applications stop hardcoding /tmp. It is the first
+// usable of:
+//   - Linux: $XDG_RUNTIME_DIR/appName, /run/lock/appName, then os.TempDir()/appName
+//   - macOS: /var/run/appName, then $TMPDIR/appName
+//   - Windows: %ProgramData%\appName, %LOCALAPPDATA%\appName, then os.TempDir()\appName
+//   - other Unix systems: /var/run/appName, then os.TempDir()/appName
+//
+// Per-user directories are created with mode 0700 and system-wide ones with mode
+// 0755, regardless of the umask. A directory is usable if it is a directory, not a
+// symbolic link, owned by the current user or root on Unix, and files can be created
+// in it, so another user cannot plant it in a shared directory such as /tmp.
+//
+// The result depends on the user and the environment: processes running as
+// different users, or with different XDG_RUNTIME_DIR, TMPDIR or other variables,
+// get different directories for the same appName, and so lock different files
+// without any error. Use it for the locks of a single user, and SystemLockDir for
+// the locks shared by several users or services.
+func DefaultLockDir(appName string) (string, error) {
+	return lockDir(appName, lockDirBases())
+}
+
+// SystemLockDir returns the system-wide directory for the lock files of appName,
+// creating it if needed, with the same checks as DefaultLockDir but without any
+// fallback, so every process of the host gets the same directory or an error:
+//   - Linux: /run/lock/appName
+//   - macOS and the other Unix systems: /var/run/appName
+//   - Windows: %ProgramData%\appName
+//
+// The directory is created with mode 0755, so only its creator can create lock
+// files in it. When the locks are shared by several users, create it beforehand,
+// as root and with the permissions they need, for example from an installer or
+// systemd-tmpfiles.
+func SystemLockDir(appName string) (string, error) {
+	var bases []lockDirBase
+	for _, base := range lockDirBases() {
+		if base.system {
+			bases = append(bases, base)
+		}
+	}
+	return lockDir(appName, bases)
+}
+
+// lockDir returns the lock directory of appName under the first usable of bases
+func lockDir(appName string, bases []lockDirBase) (string, error) {
+	if appName == "" || appName == "." || appName == ".." || strings.ContainsAny(appName, `/\`) {
+		return "", fmt.Errorf("fs: invalid application name %q for a lock directory", appName)
+	}
+
+	var errs []error
+	for _, base := range bases {
+		if base.path == "" || !filepath.IsAbs(base.path) {
+			errs = append(errs, fmt.Errorf("%q is not an absolute directory", base.path))
+			continue
+		}
+		dir := filepath.Join(base.path, appName)
+		if err := prepareLockDir(dir, base.perm); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return dir, nil
+	}
+	return "", fmt.Errorf("fs: no usable lock directory for %s: %w", appName, errors.Join(errs...))
+}
+
+// prepareLockDir creates dir with perm if it does not exist, and checks that lock
+// files can be created in it
+func prepareLockDir(dir string, perm os.FileMode) error {
+	err := os.Mkdir(dir, perm)
+	if err == nil {
+		// The umask may have filtered perm
+		if err := os.Chmod(dir, perm); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if err := checkLockDirOwner(dir, info); err != nil {
+		return err
+	}
+
+	probe, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return err
+	}
+	_ = probe.Close()
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,11 @@
+package fs
+
+import "os"
+
+// lockDirBases returns the directories DefaultLockDir tries, in order
+func lockDirBases() []lockDirBase {
+	return []lockDirBase{
+		{path: "/var/run", perm: 0755, system: true},
+		{path: os.Getenv("TMPDIR"), perm: 0700},
+	}
+}
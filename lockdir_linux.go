@@ -0,0 +1,12 @@
+package fs
+
+import "os"
+
+// lockDirBases returns the directories DefaultLockDir tries, in order
+func lockDirBases() []lockDirBase {
+	return []lockDirBase{
+		{path: os.Getenv("XDG_RUNTIME_DIR"), perm: 0700},
+		{path: "/run/lock", perm: 0755, system: true},
+		{path: os.TempDir(), perm: 0700},
+	}
+}
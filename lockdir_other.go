@@ -0,0 +1,13 @@
+//go:build unix && !linux && !darwin
+
+package fs
+
+import "os"
+
+// lockDirBases returns the directories DefaultLockDir tries, in order
+func lockDirBases() []lockDirBase {
+	return []lockDirBase{
+		{path: "/var/run", perm: 0755, system: true},
+		{path: os.TempDir(), perm: 0700},
+	}
+}
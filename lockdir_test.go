@@ -0,0 +1,101 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// LockDirTestSuite defines a test suite for DefaultLockDir
+type LockDirTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory before each test
+func (s *LockDirTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "lockdir-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *LockDirTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestDefaultLockDir tests that the lock directory is created in the per-user runtime directory
+func (s *LockDirTestSuite) TestDefaultLockDir() {
+	if runtime.GOOS != "linux" {
+		s.T().Skip("XDG_RUNTIME_DIR is only used on Linux")
+	}
+	s.T().Setenv("XDG_RUNTIME_DIR", s.tempDir)
+
+	dir, err := DefaultLockDir("myapp")
+	s.Require().NoError(err)
+	s.Assert().Equal(filepath.Join(s.tempDir, "myapp"), dir)
+
+	info, err := os.Stat(dir)
+	s.Require().NoError(err)
+	s.Assert().True(info.IsDir())
+	s.Assert().Equal(os.FileMode(0700), info.Mode().Perm())
+
+	again, err := DefaultLockDir("myapp")
+	s.Require().NoError(err)
+	s.Assert().Equal(dir, again, "an existing directory is reused")
+
+	lock := New(filepath.Join(dir, "app.lock"))
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestDefaultLockDirFallback tests that unusable directories are skipped
+func (s *LockDirTestSuite) TestDefaultLockDirFallback() {
+	if runtime.GOOS != "linux" {
+		s.T().Skip("XDG_RUNTIME_DIR is only used on Linux")
+	}
+	s.T().Setenv("XDG_RUNTIME_DIR", s.tempDir)
+	s.Require().NoError(os.WriteFile(filepath.Join(s.tempDir, "go-fs-lockdir-test"), nil, 0644))
+
+	dir, err := DefaultLockDir("go-fs-lockdir-test")
+	s.Require().NoError(err)
+	defer os.Remove(dir)
+	s.Assert().NotEqual(filepath.Join(s.tempDir, "go-fs-lockdir-test"), dir)
+}
+
+// TestDefaultLockDirInvalidName tests that application names cannot escape the base directory
+func (s *LockDirTestSuite) TestDefaultLockDirInvalidName() {
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`} {
+		_, err := DefaultLockDir(name)
+		s.Assert().Error(err, name)
+	}
+}
+
+// TestSystemLockDir tests that the system-wide directory does not depend on the
+// environment, and that it is not replaced by a fallback when unusable
+func (s *LockDirTestSuite) TestSystemLockDir() {
+	if runtime.GOOS != "linux" {
+		s.T().Skip("/run/lock is only used on Linux")
+	}
+	s.T().Setenv("XDG_RUNTIME_DIR", s.tempDir)
+	s.T().Setenv("TMPDIR", s.tempDir)
+
+	dir, err := SystemLockDir("go-fs-lockdir-test")
+	if err != nil {
+		s.Assert().Contains(err.Error(), "/run/lock/go-fs-lockdir-test")
+		return
+	}
+	defer os.Remove(dir)
+	s.Assert().Equal("/run/lock/go-fs-lockdir-test", dir)
+
+	_, err = SystemLockDir("..")
+	s.Assert().Error(err)
+}
+
+// TestLockDir runs the test suite
+func TestLockDir(t *testing.T) {
+	suite.Run(t, new(LockDirTestSuite))
+}
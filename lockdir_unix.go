@@ -0,0 +1,22 @@
+//go:build unix
+
+package fs
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkLockDirOwner returns an error if the lock directory dir is owned by another
+// user than the current one or root
+func checkLockDirOwner(dir string, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if st.Uid != 0 && int(st.Uid) != os.Geteuid() {
+		return fmt.Errorf("%s is owned by uid %d", dir, st.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package fs
+
+import (
+	"context"
+	"os"
+
+	"github.com/rsgcata/go-fs/atomicfile"
+)
+
+// ReadFileLocked reads the named file like os.ReadFile, under a shared lock on
+// LockPath(name) acquired within DefaultTimeout. It is ReadFileShared, named to
+// pair with WriteFileLocked.
+func ReadFileLocked(name string, opts ...FileOption) ([]byte, error) {
+	return ReadFileShared(name, opts...)
+}
+
+// ReadFileLockedContext is ReadFileLocked waiting for the lock until ctx is done
+func ReadFileLockedContext(ctx context.Context, name string, opts ...FileOption) ([]byte, error) {
+	o := newFileOptions(opts)
+	var data []byte
+	err := withLockContext(ctx, name, true, func() error {
+		var err error
+		data, err = readFile(name, o)
+		return err
+	})
+	return data, err
+}
+
+// WriteFileLocked writes data to the named file like os.WriteFile, under an
+// exclusive lock on LockPath(name) acquired within DefaultTimeout. The file is
+// replaced atomically and durably, so even readers not using the lock never see
+// a partial write. Unlike os.WriteFile, the file gets the permission bits perm
+// whether it exists or not, regardless of the umask.
+func WriteFileLocked(name string, data []byte, perm os.FileMode, opts ...FileOption) error {
+	o := newFileOptions(opts)
+	return withLock(name, false, func() error {
+		return writeFile(name, data, perm, o)
+	})
+}
+
+// WriteFileLockedContext is WriteFileLocked waiting for the lock until ctx is done
+func WriteFileLockedContext(ctx context.Context, name string, data []byte, perm os.FileMode, opts ...FileOption) error {
+	o := newFileOptions(opts)
+	return withLockContext(ctx, name, false, func() error {
+		return writeFile(name, data, perm, o)
+	})
+}
+
+// writeFile replaces name with data and records its checksum if requested, the
+// lock being held
+func writeFile(name string, data []byte, perm os.FileMode, o fileOptions) error {
+	if err := atomicfile.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	if o.checksum {
+		return writeChecksum(name, data, perm)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// ErrNoRoot is returned by Manager.Lock on a Manager without root, see Rooted
+var ErrNoRoot = errors.New("manager has no root directory")
+
+// NewLockFunc creates a lock on path with opts, like New or the New function of a
+// backend
+type NewLockFunc func(path string, opts ...filelock.Option) filelock.FileLock
+
+// Manager creates locks sharing default options, so an application configures its
+// locking policy once, permissions, backoff, audit log, metrics and state hooks,
+// and calls mgr.New(path) everywhere instead of repeating the options at every
+// call site
+type Manager struct {
+	newLock NewLockFunc
+	opts    []filelock.Option
+
+	// root and namespace are the directories of the locks created by Lock
+	root      string
+	namespace string
+}
+
+// NewManager returns a Manager creating its locks with New and the default
+// options opts
+func NewManager(opts ...filelock.Option) *Manager {
+	return NewManagerWith(New, opts...)
+}
+
+// NewManagerWith returns a Manager creating its locks with newLock, such as
+// unix.New, lockfile.New or a closure over backend.New, and the default options
+// opts
+func NewManagerWith(newLock NewLockFunc, opts ...filelock.Option) *Manager {
+	return &Manager{newLock: newLock, opts: opts}
+}
+
+// New creates a lock on path, not acquired yet, with the default options followed
+// by opts. The options of opts setting a value override the defaults, the ones
+// adding a hook, such as filelock.WithStateChange, add it to those of the
+// defaults.
+func (m *Manager) New(path string, opts ...filelock.Option) filelock.FileLock {
+	return m.newLock(path, m.options(opts)...)
+}
+
+// With returns a Manager creating its locks like m, with opts added to its
+// default options, for a part of the application needing a stricter policy
+func (m *Manager) With(opts ...filelock.Option) *Manager {
+	return &Manager{newLock: m.newLock, opts: m.options(opts), root: m.root, namespace: m.namespace}
+}
+
+// Options returns the default options of the locks, resolved
+func (m *Manager) Options() filelock.Options {
+	return filelock.NewOptions(m.opts...)
+}
+
+// Rooted returns a Manager creating locks like m, whose Lock maps logical lock
+// names to lock files under the directory root, in the sub-directory namespace,
+// itself a logical name, or directly under root if namespace is "". root must
+// exist, the directories under it are created as needed, with permission 0755
+// unless the options set another one with filelock.WithCreateParents.
+func (m *Manager) Rooted(root, namespace string) *Manager {
+	return &Manager{newLock: m.newLock, opts: m.opts, root: root, namespace: namespace}
+}
+
+// Lock returns a new lock, not acquired yet, on the logical name, such as
+// "jobs/42", with the default options followed by opts. The name is a sequence of
+// segments separated by "/", mapped to the lock file PathOf(name), and the lock
+// is confined to the root with filelock.WithRoot, which the Unix backend enforces
+// against symbolic links too.
+// It returns ErrNoRoot if the Manager was not Rooted, and an error wrapping
+// filelock.ErrUnsafePath if the name is not valid.
+func (m *Manager) Lock(name string, opts ...filelock.Option) (filelock.FileLock, error) {
+	path, err := m.PathOf(name)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]filelock.Option, 0, len(m.opts)+len(opts)+2)
+	all = append(all, filelock.WithCreateParents(0o755))
+	all = append(all, m.options(opts)...)
+	all = append(all, filelock.WithRoot(m.root))
+	return m.newLock(path, all...), nil
+}
+
+// PathOf returns the path of the lock file of the logical name under the root
+// and namespace of the Manager: every segment of the name gives a directory, and
+// the last one the lock file, with LockSuffix appended. Every segment must be
+// non-empty and neither "." nor "..", so the name cannot escape the namespace.
+// The bytes of a segment other than lowercase ASCII letters, digits, '-', '_' and
+// '.' are written as %XX, and so are the dot of a trailing ".lock", a trailing
+// dot and the first letter of a name reserved by Windows, such as "nul" or
+// "com1". Distinct names thus map to distinct files, also on case-insensitive
+// file systems, and no directory of a name is the lock file of another.
+// It returns ErrNoRoot if the Manager was not Rooted, and an error wrapping
+// filelock.ErrUnsafePath if the name is not valid.
+func (m *Manager) PathOf(name string) (string, error) {
+	if m.root == "" {
+		return "", ErrNoRoot
+	}
+
+	elems := []string{m.root}
+	if m.namespace != "" {
+		namespace, err := sanitizeName(m.namespace)
+		if err != nil {
+			return "", err
+		}
+		elems = append(elems, namespace...)
+	}
+	segments, err := sanitizeName(name)
+	if err != nil {
+		return "", err
+	}
+	segments[len(segments)-1] += LockSuffix
+	return filepath.Join(append(elems, segments...)...), nil
+}
+
+// sanitizeName returns the file names of the segments of the logical name
+func sanitizeName(name string) ([]string, error) {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("%w: invalid lock name %q", filelock.ErrUnsafePath, name)
+		}
+		segments[i] = escapeSegment(segment)
+	}
+	return segments, nil
+}
+
+// escapeSegment returns the file name of a segment of a logical name
+func escapeSegment(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	escaped := b.String()
+
+	// Windows drops trailing dots, and a directory must not look like a lock file
+	switch {
+	case strings.HasSuffix(escaped, "."):
+		escaped = escaped[:len(escaped)-1] + "%2E"
+	case strings.HasSuffix(escaped, LockSuffix):
+		dot := len(escaped) - len(LockSuffix)
+		escaped = escaped[:dot] + "%2E" + escaped[dot+1:]
+	}
+	if reservedName(escaped) {
+		escaped = fmt.Sprintf("%%%02X", escaped[0]) + escaped[1:]
+	}
+	return escaped
+}
+
+// reservedName reports whether Windows reserves the file name name for a device,
+// whatever its extension
+func reservedName(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	switch base {
+	case "con", "prn", "aux", "nul":
+		return true
+	}
+	return len(base) == 4 && (strings.HasPrefix(base, "com") || strings.HasPrefix(base, "lpt")) &&
+		'0' <= base[3] && base[3] <= '9'
+}
+
+// options returns the default options followed by opts, in a new slice
+func (m *Manager) options(opts []filelock.Option) []filelock.Option {
+	all := make([]filelock.Option, 0, len(m.opts)+len(opts))
+	all = append(all, m.opts...)
+	return append(all, opts...)
+}
@@ -0,0 +1,187 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/lockfile"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// ManagerTestSuite defines a test suite for Manager
+type ManagerTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary lock directory before each test
+func (s *ManagerTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "manager-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *ManagerTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestDefaults tests that the locks get the default options, overridden by their own
+func (s *ManagerTestSuite) TestDefaults() {
+	var transitions []filelock.Transition
+	mgr := NewManager(
+		filelock.WithPerm(0600),
+		filelock.WithIdempotentUnlock(),
+		filelock.WithStateChange(func(t filelock.Transition) { transitions = append(transitions, t) }),
+	)
+	s.Assert().Equal(os.FileMode(0600), mgr.Options().Perm)
+
+	path := filepath.Join(s.tempDir, "a.lock")
+	lock := mgr.New(path)
+	s.Require().NoError(lock.Lock())
+	info, err := os.Stat(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0600), info.Mode().Perm())
+	s.Require().NoError(lock.Unlock())
+	s.Require().NoError(lock.Unlock(), "WithIdempotentUnlock is a default")
+	s.Assert().NotEmpty(transitions)
+
+	path = filepath.Join(s.tempDir, "b.lock")
+	var own int
+	lock = mgr.New(path, filelock.WithPerm(0640), filelock.WithStateChange(func(filelock.Transition) { own++ }))
+	s.Require().NoError(lock.Lock())
+	info, err = os.Stat(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0640), info.Mode().Perm(), "the options of the lock override the defaults")
+	s.Require().NoError(lock.Unlock())
+	s.Assert().Equal(4, own)
+	s.Assert().Len(transitions, 8, "hooks are added to the default ones")
+}
+
+// TestWith tests that derived managers add options without changing their parent
+func (s *ManagerTestSuite) TestWith() {
+	mgr := NewManager(filelock.WithSpin(2))
+	strict := mgr.With(filelock.WithMaxAttempts(1))
+	s.Assert().Equal(2, strict.Options().SpinAttempts)
+	s.Assert().Equal(1, strict.Options().MaxAttempts)
+	s.Assert().Zero(mgr.Options().MaxAttempts)
+
+	path := filepath.Join(s.tempDir, "a.lock")
+	holder := mgr.New(path)
+	s.Require().NoError(holder.Lock())
+	defer holder.Unlock()
+	s.Assert().ErrorAs(strict.New(path).LockWithTimeout(time.Minute), new(*filelock.AttemptsError))
+}
+
+// TestNewManagerWith tests that locks are created by the given function
+func (s *ManagerTestSuite) TestNewManagerWith() {
+	mgr := NewManagerWith(func(path string, opts ...filelock.Option) filelock.FileLock {
+		return lockfile.New(path, opts...)
+	})
+	path := filepath.Join(s.tempDir, "a.lock")
+	lock := mgr.New(path)
+	s.Require().NoError(lock.Lock())
+	s.Assert().FileExists(path)
+	s.Require().NoError(lock.Unlock())
+	s.Assert().NoFileExists(path, "lock-file protocol locks remove their file")
+}
+
+// TestRooted tests that logical names map to lock files under the root and
+// namespace
+func (s *ManagerTestSuite) TestRooted() {
+	mgr := NewManager(filelock.WithPerm(0600)).Rooted(s.tempDir, "app")
+
+	path, err := mgr.PathOf("jobs/42")
+	s.Require().NoError(err)
+	s.Assert().Equal(filepath.Join(s.tempDir, "app", "jobs", "42.lock"), path)
+
+	lock, err := mgr.Lock("jobs/42")
+	s.Require().NoError(err)
+	s.Assert().Equal(path, lock.Path())
+	s.Require().NoError(lock.Lock())
+	info, err := os.Stat(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0600), info.Mode().Perm(), "the default options apply")
+	info, err = os.Stat(filepath.Dir(path))
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0755), info.Mode().Perm())
+	s.Require().NoError(lock.Unlock())
+
+	path, err = mgr.PathOf(`a b/ünï\%x`)
+	s.Require().NoError(err)
+	s.Assert().Equal(filepath.Join(s.tempDir, "app", "a%20b", "%C3%BCn%C3%AF%5C%25x.lock"), path)
+
+	path, err = NewManager().Rooted(s.tempDir, "").PathOf("jobs/42")
+	s.Require().NoError(err)
+	s.Assert().Equal(filepath.Join(s.tempDir, "jobs", "42.lock"), path)
+}
+
+// TestRootedNames tests that distinct names map to distinct, portable files
+func (s *ManagerTestSuite) TestRootedNames() {
+	mgr := NewManager().Rooted(s.tempDir, "")
+	for name, file := range map[string]string{
+		"a":        "a.lock",
+		"a.lock/b": filepath.Join("a%2Elock", "b.lock"),
+		"a.lock":   "a%2Elock.lock",
+		"A":        "%41.lock",
+		"nul":      "%6Eul.lock",
+		"NUL":      "%4E%55%4C.lock",
+		"con.txt":  "%63on.txt.lock",
+		"com1/x":   filepath.Join("%63om1", "x.lock"),
+		"console":  "console.lock",
+		"a.":       "a%2E.lock",
+		"...":      "..%2E.lock",
+	} {
+		path, err := mgr.PathOf(name)
+		s.Require().NoError(err)
+		s.Assert().Equal(filepath.Join(s.tempDir, file), path, name)
+	}
+
+	a, err := mgr.PathOf("a")
+	s.Require().NoError(err)
+	upper, err := mgr.PathOf("A")
+	s.Require().NoError(err)
+	s.Assert().False(strings.EqualFold(a, upper), "case-insensitive file systems tell them apart")
+
+	file, err := mgr.Lock("a")
+	s.Require().NoError(err)
+	s.Require().NoError(file.Lock())
+	defer file.Unlock()
+	dir, err := mgr.Lock("a.lock/b")
+	s.Require().NoError(err)
+	s.Require().NoError(dir.Lock(), "the lock file of a is not a directory of a.lock/b")
+	s.Require().NoError(dir.Unlock())
+}
+
+// TestRootedTraversal tests that names cannot escape the namespace
+func (s *ManagerTestSuite) TestRootedTraversal() {
+	mgr := NewManager().Rooted(s.tempDir, "app")
+	for _, name := range []string{"", "../x", "a/../../x", "a//b", "a/./b", "/etc/passwd", "a/"} {
+		_, err := mgr.Lock(name)
+		s.Assert().ErrorIs(err, filelock.ErrUnsafePath, name)
+	}
+	_, err := NewManager().Rooted(s.tempDir, "../other").Lock("x")
+	s.Assert().ErrorIs(err, filelock.ErrUnsafePath)
+	_, err = NewManager().Lock("x")
+	s.Assert().ErrorIs(err, ErrNoRoot)
+
+	outside, err := os.MkdirTemp("", "manager-outside")
+	s.Require().NoError(err)
+	defer os.RemoveAll(outside)
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.tempDir, "app"), 0755))
+	s.Require().NoError(os.Symlink(outside, filepath.Join(s.tempDir, "app", "evil")))
+	lock, err := mgr.Lock("evil/x")
+	s.Require().NoError(err)
+	s.Assert().ErrorIs(lock.Lock(), filelock.ErrUnsafePath, "symbolic links cannot leave the root")
+	s.Assert().NoFileExists(filepath.Join(outside, "x.lock"))
+}
+
+// TestManager runs the test suite
+func TestManager(t *testing.T) {
+	suite.Run(t, new(ManagerTestSuite))
+}
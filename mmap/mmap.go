@@ -0,0 +1,242 @@
+// Package mmap maps files into memory under a file lock held for the whole
+// lifetime of the mapping.
+//
+// A read-only Mapping holds a shared lock on fs.LockPath(path), so any number of
+// processes can map the file for reading while no writer changes it. A writable
+// Mapping holds the exclusive lock: changes made through Bytes are visible to the
+// other processes mapping the file as soon as they can acquire the lock, and are
+// written to the file by Flush and Close.
+package mmap
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// DefaultTimeout is the default time Open and OpenWritable wait for the lock
+const DefaultTimeout = 10 * time.Second
+
+// ErrReadOnly is returned when resizing a read-only Mapping
+var ErrReadOnly = errors.New("mapping is read-only")
+
+// Mapping is a file mapped into memory under a lock
+// The methods are safe for concurrent use, but the memory returned by Bytes is not
+// synchronized between goroutines.
+type Mapping struct {
+	path     string
+	writable bool
+	lock     filelock.FileLock
+	file     *os.File
+	data     []byte
+	mutex    sync.Mutex
+}
+
+type options struct {
+	timeout time.Duration
+	perm    os.FileMode
+	size    int64
+}
+
+// Option configures Open and OpenWritable
+type Option func(*options)
+
+// WithTimeout sets how long to wait for the lock, DefaultTimeout by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithPerm sets the permission bits used by OpenWritable when creating the file, 0644 by default
+func WithPerm(perm os.FileMode) Option {
+	return func(o *options) {
+		o.perm = perm
+	}
+}
+
+// WithSize makes OpenWritable grow the file to at least size bytes before mapping it
+func WithSize(size int64) Option {
+	return func(o *options) {
+		o.size = size
+	}
+}
+
+// Open maps the file at path for reading, holding a shared lock on fs.LockPath(path)
+// until Close
+func Open(path string, opts ...Option) (*Mapping, error) {
+	return open(path, false, opts)
+}
+
+// OpenWritable maps the file at path for reading and writing, holding an exclusive
+// lock on fs.LockPath(path) until Close. The file is created if needed.
+func OpenWritable(path string, opts ...Option) (*Mapping, error) {
+	return open(path, true, opts)
+}
+
+func open(path string, writable bool, opts []Option) (*Mapping, error) {
+	o := options{timeout: DefaultTimeout, perm: 0644}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var lockOpts []filelock.Option
+	if !writable {
+		lockOpts = append(lockOpts, filelock.WithShared())
+	}
+	lock := fs.New(fs.LockPath(path), lockOpts...)
+	if err := lock.LockWithTimeout(o.timeout); err != nil {
+		return nil, err
+	}
+
+	m := &Mapping{path: path, writable: writable, lock: lock}
+	if err := m.open(o); err != nil {
+		if m.file != nil {
+			_ = m.file.Close()
+		}
+		_ = lock.Unlock()
+		return nil, err
+	}
+	return m, nil
+}
+
+// open opens and maps the file, the lock being held
+func (m *Mapping) open(o options) error {
+	var err error
+	if m.writable {
+		m.file, err = os.OpenFile(m.path, os.O_RDWR|os.O_CREATE, o.perm)
+	} else {
+		m.file, err = os.Open(m.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	info, err := m.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if m.writable && size < o.size {
+		if err := m.file.Truncate(o.size); err != nil {
+			return err
+		}
+		size = o.size
+	}
+	return m.mapFile(size)
+}
+
+// mapFile maps size bytes of the open file, an empty file is not mapped
+func (m *Mapping) mapFile(size int64) error {
+	if size == 0 {
+		m.data = nil
+		return nil
+	}
+	data, err := mmap(m.file, int(size), m.writable)
+	if err != nil {
+		return &os.PathError{Op: "mmap", Path: m.path, Err: err}
+	}
+	m.data = data
+	return nil
+}
+
+// unmapFile unmaps the file, if mapped
+func (m *Mapping) unmapFile() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return munmap(data)
+}
+
+// Path returns the path of the mapped file
+func (m *Mapping) Path() string {
+	return m.path
+}
+
+// Writable reports whether the mapping was opened with OpenWritable
+func (m *Mapping) Writable() bool {
+	return m.writable
+}
+
+// Bytes returns the mapped memory, nil for an empty file
+// The slice is only valid until the next Resize or Close. Writing to the memory of
+// a read-only Mapping crashes the program.
+func (m *Mapping) Bytes() []byte {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.data
+}
+
+// Len returns the size of the mapping
+func (m *Mapping) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.data)
+}
+
+// Flush writes the changes made to a writable mapping to stable storage
+func (m *Mapping) Flush() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.file == nil {
+		return os.ErrClosed
+	}
+	return m.flush()
+}
+
+func (m *Mapping) flush() error {
+	if !m.writable || m.data == nil {
+		return nil
+	}
+	if err := msync(m.data, m.file); err != nil {
+		return &os.PathError{Op: "msync", Path: m.path, Err: err}
+	}
+	return nil
+}
+
+// Resize changes the size of the file of a writable mapping and maps it again
+// Growing fills the file with zeros, shrinking discards the end of the file.
+// The memory returned by Bytes before Resize must no longer be used.
+func (m *Mapping) Resize(size int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.file == nil {
+		return os.ErrClosed
+	}
+	if !m.writable {
+		return ErrReadOnly
+	}
+
+	// The file cannot be truncated while mapped on Windows
+	if err := m.flush(); err != nil {
+		return err
+	}
+	previous := int64(len(m.data))
+	if err := m.unmapFile(); err != nil {
+		return err
+	}
+	if err := m.file.Truncate(size); err != nil {
+		return errors.Join(err, m.mapFile(previous))
+	}
+	return m.mapFile(size)
+}
+
+// Close flushes a writable mapping, unmaps and closes the file, and releases the lock
+// It returns os.ErrClosed if the mapping was already closed.
+func (m *Mapping) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.file == nil {
+		return os.ErrClosed
+	}
+
+	err := errors.Join(m.flush(), m.unmapFile(), m.file.Close())
+	m.file = nil
+	return errors.Join(err, m.lock.Unlock())
+}
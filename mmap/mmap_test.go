@@ -0,0 +1,108 @@
+package mmap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// MmapTestSuite defines a test suite for locked memory mappings
+type MmapTestSuite struct {
+	suite.Suite
+	tempDir string
+	path    string
+}
+
+// SetupTest creates a temporary directory before each test
+func (s *MmapTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "mmap-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.path = filepath.Join(tempDir, "state.bin")
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *MmapTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestWriteAndRead tests that changes made through a writable mapping reach the file
+func (s *MmapTestSuite) TestWriteAndRead() {
+	w, err := OpenWritable(s.path, WithSize(8), WithPerm(0600))
+	s.Require().NoError(err)
+	s.Assert().True(w.Writable())
+	s.Require().Equal(8, w.Len())
+	copy(w.Bytes(), "go-fs!!!")
+	s.Require().NoError(w.Flush())
+
+	data, err := os.ReadFile(s.path)
+	s.Require().NoError(err)
+	s.Assert().Equal("go-fs!!!", string(data))
+	s.Require().NoError(w.Close())
+	s.Assert().Equal(os.ErrClosed, w.Close())
+
+	r, err := Open(s.path)
+	s.Require().NoError(err)
+	s.Assert().Equal("go-fs!!!", string(r.Bytes()))
+	s.Assert().Equal(ErrReadOnly, r.Resize(16))
+	s.Require().NoError(r.Close())
+}
+
+// TestLocking tests that readers share the lock and exclude writers
+func (s *MmapTestSuite) TestLocking() {
+	s.Require().NoError(os.WriteFile(s.path, []byte("data"), 0644))
+
+	r1, err := Open(s.path)
+	s.Require().NoError(err)
+	r2, err := Open(s.path, WithTimeout(0))
+	s.Require().NoError(err, "readers share the lock")
+
+	_, err = OpenWritable(s.path, WithTimeout(50*time.Millisecond))
+	s.Assert().Equal(filelock.ErrTimeout, err)
+	s.Require().NoError(r1.Close())
+	s.Require().NoError(r2.Close())
+
+	w, err := OpenWritable(s.path)
+	s.Require().NoError(err)
+	s.Assert().Equal(filelock.ErrLockHeld, fs.New(fs.LockPath(s.path), filelock.WithShared()).Lock())
+	s.Require().NoError(w.Close())
+}
+
+// TestResize tests growing and shrinking a writable mapping
+func (s *MmapTestSuite) TestResize() {
+	w, err := OpenWritable(s.path)
+	s.Require().NoError(err)
+	s.Assert().Nil(w.Bytes(), "an empty file is not mapped")
+
+	s.Require().NoError(w.Resize(4096))
+	s.Assert().Equal(4096, w.Len())
+	copy(w.Bytes(), "head")
+	s.Require().NoError(w.Resize(2))
+	s.Assert().Equal("he", string(w.Bytes()))
+	s.Require().NoError(w.Close())
+
+	info, err := os.Stat(s.path)
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(2), info.Size())
+}
+
+// TestOpenMissing tests that a read-only mapping of a missing file fails and releases the lock
+func (s *MmapTestSuite) TestOpenMissing() {
+	_, err := Open(s.path)
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+
+	lock := fs.New(fs.LockPath(s.path))
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestMmap runs the test suite
+func TestMmap(t *testing.T) {
+	suite.Run(t, new(MmapTestSuite))
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package mmap
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmap maps the first size bytes of file, shared with the other processes
+func mmap(file *os.File, size int, writable bool) ([]byte, error) {
+	prot := unix.PROT_READ
+	if writable {
+		prot |= unix.PROT_WRITE
+	}
+	return unix.Mmap(int(file.Fd()), 0, size, prot, unix.MAP_SHARED)
+}
+
+// munmap unmaps data returned by mmap
+func munmap(data []byte) error {
+	return unix.Munmap(data)
+}
+
+// msync writes the changes made to data to the file
+func msync(data []byte, _ *os.File) error {
+	return unix.Msync(data, unix.MS_SYNC)
+}
@@ -0,0 +1,56 @@
+//go:build windows
+
+package mmap
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// mmap maps the first size bytes of file, shared with the other processes
+func mmap(file *os.File, size int, writable bool) ([]byte, error) {
+	protect, access := uint32(windows.PAGE_READONLY), uint32(windows.FILE_MAP_READ)
+	if writable {
+		protect, access = windows.PAGE_READWRITE, windows.FILE_MAP_WRITE
+	}
+
+	handle, err := windows.CreateFileMapping(
+		windows.Handle(file.Fd()), nil, protect, uint32(uint64(size)>>32), uint32(size), nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// The view keeps the mapping object alive
+	defer windows.CloseHandle(handle)
+
+	addr, err := windows.MapViewOfFile(handle, access, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the slice header directly, converting addr to a pointer is reported
+	// by go vet although the memory is not managed by Go
+	var data []byte
+	header := (*struct {
+		data     uintptr
+		len, cap int
+	})(unsafe.Pointer(&data))
+	header.data, header.len, header.cap = addr, size, size
+	return data, nil
+}
+
+// munmap unmaps data returned by mmap
+func munmap(data []byte) error {
+	return windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&data[0])))
+}
+
+// msync writes the changes made to data to the file, FlushViewOfFile only starts
+// the write of the pages so the file buffers are flushed as well
+func msync(data []byte, file *os.File) error {
+	if err := windows.FlushViewOfFile(uintptr(unsafe.Pointer(&data[0])), uintptr(len(data))); err != nil {
+		return err
+	}
+	return windows.FlushFileBuffers(windows.Handle(file.Fd()))
+}
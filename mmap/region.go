@@ -0,0 +1,237 @@
+package mmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// regionMagic identifies a shared region file
+var regionMagic = []byte("GFSR")
+
+// regionHeaderSize is the size of the header preceding the data of a region:
+// the magic, the data size as a little endian uint32, and the version as a
+// native endian uint64, 8-byte aligned so it can be accessed atomically
+const regionHeaderSize = 16
+
+// ErrInvalidRegion is returned when opening a file that is not a shared region of the requested size
+var ErrInvalidRegion = errors.New("invalid shared region")
+
+// SharedRegion is a fixed-size byte region shared by cooperating processes through a
+// memory-mapped file, guarded by the lock on fs.LockPath(path)
+//
+// Writers modify the region under the exclusive lock and increment its version,
+// readers read it under the shared lock, and Version and Wait read the version
+// without any lock, so readers can cheaply notice changes. The version is stored
+// in native byte order: the file is meant for processes of the same host.
+type SharedRegion struct {
+	path    string
+	timeout time.Duration
+	file    *os.File
+	mapped  []byte
+	data    []byte
+	version *uint64
+	shared  filelock.FileLock
+	excl    filelock.FileLock
+	scratch []byte
+	mutex   sync.Mutex
+}
+
+// OpenRegion opens the shared region of size bytes at path, creating it if needed
+// It returns an error wrapping ErrInvalidRegion if the file exists with another size
+// or is not a region. WithTimeout sets how long operations wait for the lock and
+// WithPerm the permission bits of a new file.
+func OpenRegion(path string, size int, opts ...Option) (*SharedRegion, error) {
+	o := options{timeout: DefaultTimeout, perm: 0644}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if size <= 0 || uint64(size) > 1<<32-1 {
+		return nil, fmt.Errorf("%w: size %d out of range", ErrInvalidRegion, size)
+	}
+
+	r := &SharedRegion{
+		path:    path,
+		timeout: o.timeout,
+		shared:  fs.New(fs.LockPath(path), filelock.WithShared()),
+		excl:    fs.New(fs.LockPath(path)),
+		scratch: make([]byte, size),
+	}
+	if err := r.excl.LockWithTimeout(o.timeout); err != nil {
+		return nil, err
+	}
+	err := r.open(size, o.perm)
+	err = errors.Join(err, r.excl.Unlock())
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens, initializes if new, and maps the region file, the exclusive lock being held
+func (r *SharedRegion) open(size int, perm os.FileMode) error {
+	var err error
+	r.file, err = os.OpenFile(r.path, os.O_RDWR|os.O_CREATE, perm)
+	if err != nil {
+		return err
+	}
+	info, err := r.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	total := regionHeaderSize + size
+	header := make([]byte, regionHeaderSize)
+	switch info.Size() {
+	case 0:
+		copy(header, regionMagic)
+		binary.LittleEndian.PutUint32(header[4:], uint32(size))
+		if _, err := r.file.WriteAt(header, 0); err != nil {
+			return err
+		}
+		if err := r.file.Truncate(int64(total)); err != nil {
+			return err
+		}
+	case int64(total):
+		if _, err := r.file.ReadAt(header, 0); err != nil {
+			return err
+		}
+		if !bytes.Equal(header[:4], regionMagic) || binary.LittleEndian.Uint32(header[4:]) != uint32(size) {
+			return fmt.Errorf("%w: %s has an unexpected header", ErrInvalidRegion, r.path)
+		}
+	default:
+		return fmt.Errorf("%w: %s is %d bytes, expected %d", ErrInvalidRegion, r.path, info.Size(), total)
+	}
+
+	r.mapped, err = mmap(r.file, total, true)
+	if err != nil {
+		return &os.PathError{Op: "mmap", Path: r.path, Err: err}
+	}
+	r.version = (*uint64)(unsafe.Pointer(&r.mapped[8]))
+	r.data = r.mapped[regionHeaderSize:]
+	return nil
+}
+
+// Path returns the path of the region file
+func (r *SharedRegion) Path() string {
+	return r.path
+}
+
+// Size returns the size of the region data
+func (r *SharedRegion) Size() int {
+	return len(r.scratch)
+}
+
+// Version returns the number of writes made to the region, without taking the lock
+// It must not be called after Close.
+func (r *SharedRegion) Version() uint64 {
+	return atomic.LoadUint64(r.version)
+}
+
+// Read calls fn with the region data and its version under the shared lock
+// The data must not be modified nor retained after fn returns.
+func (r *SharedRegion) Read(fn func(data []byte, version uint64) error) error {
+	return r.locked(r.shared, func() error {
+		return fn(r.data, r.Version())
+	})
+}
+
+// Update calls fn with a copy of the region data under the exclusive lock and, if fn
+// succeeds, stores the modified copy and increments the version, which is returned
+// If fn fails, the region is left untouched.
+func (r *SharedRegion) Update(fn func(data []byte) error) (uint64, error) {
+	var version uint64
+	err := r.locked(r.excl, func() error {
+		copy(r.scratch, r.data)
+		if err := fn(r.scratch); err != nil {
+			return err
+		}
+		copy(r.data, r.scratch)
+		version = atomic.AddUint64(r.version, 1)
+		return nil
+	})
+	return version, err
+}
+
+// Wait polls the version until it differs from since or ctx is done, and returns it
+// It must not be called after Close.
+func (r *SharedRegion) Wait(ctx context.Context, since uint64) (uint64, error) {
+	interval := 100 * time.Microsecond
+	for {
+		if version := r.Version(); version != since {
+			return version, nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return since, ctx.Err()
+		case <-timer.C:
+		}
+		interval = min(2*interval, 10*time.Millisecond)
+	}
+}
+
+// locked runs fn holding lock, within the configured timeout
+func (r *SharedRegion) locked(lock filelock.FileLock, fn func() error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+
+	if err := lock.LockWithTimeout(r.timeout); err != nil {
+		return err
+	}
+	err := fn()
+	if unlockErr := lock.Unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// Flush writes the region to stable storage, it is not needed to share it
+func (r *SharedRegion) Flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	return msync(r.mapped, r.file)
+}
+
+// Close unmaps and closes the region file
+// It returns os.ErrClosed if the region was already closed.
+func (r *SharedRegion) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	return r.close()
+}
+
+func (r *SharedRegion) close() error {
+	var err error
+	if r.mapped != nil {
+		err = munmap(r.mapped)
+		r.mapped, r.data = nil, nil
+	}
+	if r.file != nil {
+		err = errors.Join(err, r.file.Close())
+		r.file = nil
+	}
+	return err
+}
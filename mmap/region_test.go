@@ -0,0 +1,155 @@
+package mmap
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// RegionTestSuite defines a test suite for shared regions
+type RegionTestSuite struct {
+	suite.Suite
+	tempDir string
+	path    string
+}
+
+// SetupTest creates a temporary directory before each test
+func (s *RegionTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "region-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.path = filepath.Join(tempDir, "ipc.region")
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *RegionTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestUpdateAndRead tests that updates are seen by other openers of the region
+func (s *RegionTestSuite) TestUpdateAndRead() {
+	writer, err := OpenRegion(s.path, 8)
+	s.Require().NoError(err)
+	defer writer.Close()
+	reader, err := OpenRegion(s.path, 8)
+	s.Require().NoError(err)
+	defer reader.Close()
+
+	version, err := writer.Update(func(data []byte) error {
+		binary.LittleEndian.PutUint64(data, 42)
+		return nil
+	})
+	s.Require().NoError(err)
+	s.Assert().Equal(uint64(1), version)
+	s.Assert().Equal(uint64(1), reader.Version())
+
+	s.Require().NoError(reader.Read(func(data []byte, version uint64) error {
+		s.Assert().Equal(uint64(42), binary.LittleEndian.Uint64(data))
+		s.Assert().Equal(uint64(1), version)
+		return nil
+	}))
+}
+
+// TestFailedUpdate tests that a failing update leaves the region untouched
+func (s *RegionTestSuite) TestFailedUpdate() {
+	region, err := OpenRegion(s.path, 4)
+	s.Require().NoError(err)
+	defer region.Close()
+
+	errFailed := errors.New("failed")
+	_, err = region.Update(func(data []byte) error {
+		copy(data, "oops")
+		return errFailed
+	})
+	s.Assert().Equal(errFailed, err)
+	s.Assert().Equal(uint64(0), region.Version())
+	s.Require().NoError(region.Read(func(data []byte, _ uint64) error {
+		s.Assert().Equal(make([]byte, 4), data)
+		return nil
+	}))
+}
+
+// TestWait tests that Wait returns once another opener updates the region
+func (s *RegionTestSuite) TestWait() {
+	waiter, err := OpenRegion(s.path, 4)
+	s.Require().NoError(err)
+	defer waiter.Close()
+	writer, err := OpenRegion(s.path, 4)
+	s.Require().NoError(err)
+	defer writer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = waiter.Wait(ctx, 0)
+	s.Assert().ErrorIs(err, context.DeadlineExceeded)
+
+	time.AfterFunc(20*time.Millisecond, func() {
+		_, _ = writer.Update(func([]byte) error { return nil })
+	})
+	version, err := waiter.Wait(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Assert().Equal(uint64(1), version)
+}
+
+// TestConcurrentUpdates tests that concurrent increments are not lost
+func (s *RegionTestSuite) TestConcurrentUpdates() {
+	var wg sync.WaitGroup
+	for range 4 {
+		region, err := OpenRegion(s.path, 8)
+		s.Require().NoError(err)
+		defer region.Close()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 25 {
+				_, err := region.Update(func(data []byte) error {
+					binary.LittleEndian.PutUint64(data, binary.LittleEndian.Uint64(data)+1)
+					return nil
+				})
+				s.Assert().NoError(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	region, err := OpenRegion(s.path, 8)
+	s.Require().NoError(err)
+	defer region.Close()
+	s.Assert().Equal(uint64(100), region.Version())
+	s.Require().NoError(region.Read(func(data []byte, _ uint64) error {
+		s.Assert().Equal(uint64(100), binary.LittleEndian.Uint64(data))
+		return nil
+	}))
+}
+
+// TestInvalidRegion tests that a region of another size or a foreign file is refused
+func (s *RegionTestSuite) TestInvalidRegion() {
+	region, err := OpenRegion(s.path, 8)
+	s.Require().NoError(err)
+	s.Require().NoError(region.Close())
+	s.Assert().Equal(os.ErrClosed, region.Close())
+
+	_, err = OpenRegion(s.path, 16)
+	s.Assert().ErrorIs(err, ErrInvalidRegion)
+
+	other := filepath.Join(s.tempDir, "other")
+	s.Require().NoError(os.WriteFile(other, make([]byte, 24), 0644))
+	_, err = OpenRegion(other, 8)
+	s.Assert().ErrorIs(err, ErrInvalidRegion)
+
+	_, err = OpenRegion(s.path, 0)
+	s.Assert().ErrorIs(err, ErrInvalidRegion)
+}
+
+// TestRegion runs the test suite
+func TestRegion(t *testing.T) {
+	suite.Run(t, new(RegionTestSuite))
+}
@@ -0,0 +1,40 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// MustNew creates a lock on path like New and checks that it can be used, trying
+// it without keeping it. It panics with a descriptive message if the lock file
+// cannot be opened or locked, for example because its directory does not exist or
+// is not writable, so misconfigurations surface at startup. A lock held by someone
+// else passes the check.
+func MustNew(path string, opts ...filelock.Option) filelock.FileLock {
+	lock := New(path, opts...)
+	if _, err := filelock.AsContextLock(lock).Probe(context.Background()); err != nil {
+		panic(mustMessage("cannot use lock", path, err))
+	}
+	return lock
+}
+
+// MustLock acquires lock within timeout, like LockWithTimeout, and panics with a
+// descriptive message if it fails. It replaces the log.Fatal boilerplate of
+// main and init-time setup, such as single-instance guards.
+func MustLock(lock filelock.FileLock, timeout time.Duration) {
+	if err := lock.LockWithTimeout(timeout); err != nil {
+		panic(mustMessage("cannot acquire lock", lock.Path(), err))
+	}
+}
+
+// mustMessage describes the failure of a Must helper, with its remediation hint
+func mustMessage(what, path string, err error) string {
+	msg := fmt.Sprintf("fs: %s %s: %v", what, path, err)
+	if hint := filelock.Hint(err); hint != "" {
+		msg += " (" + hint + ")"
+	}
+	return msg
+}
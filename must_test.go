@@ -0,0 +1,76 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// MustTestSuite defines a test suite for the Must helpers
+type MustTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory before each test
+func (s *MustTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "must-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *MustTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestMustNew tests that MustNew returns a usable lock, even if it is held
+func (s *MustTestSuite) TestMustNew() {
+	lockPath := filepath.Join(s.tempDir, "app.lock")
+	lock := MustNew(lockPath)
+	s.Assert().False(lock.IsLocked())
+
+	MustLock(lock, 0)
+	defer lock.Unlock()
+	s.Assert().NotPanics(func() { MustNew(lockPath) })
+}
+
+// TestMustNewMissingDirectory tests that MustNew panics when the lock file cannot be created
+func (s *MustTestSuite) TestMustNewMissingDirectory() {
+	lockPath := filepath.Join(s.tempDir, "missing", "app.lock")
+	s.Assert().True(strings.HasPrefix(
+		panicMessage(func() { MustNew(lockPath) }),
+		"fs: cannot use lock "+lockPath+": open "+lockPath,
+	))
+}
+
+// TestMustLockHeld tests that MustLock panics when the lock is not acquired in time
+func (s *MustTestSuite) TestMustLockHeld() {
+	lockPath := filepath.Join(s.tempDir, "app.lock")
+	holder := New(lockPath)
+	s.Require().NoError(holder.Lock())
+	defer holder.Unlock()
+
+	s.Assert().PanicsWithValue(
+		"fs: cannot acquire lock "+lockPath+": timeout acquiring lock",
+		func() { MustLock(New(lockPath), 20*time.Millisecond) },
+	)
+}
+
+// panicMessage returns the value fn panics with, or "" if it does not panic
+func panicMessage(fn func()) (msg string) {
+	defer func() {
+		msg, _ = recover().(string)
+	}()
+	fn()
+	return ""
+}
+
+// TestMust runs the test suite
+func TestMust(t *testing.T) {
+	suite.Run(t, new(MustTestSuite))
+}
@@ -0,0 +1,248 @@
+// Package queue implements a durable FIFO queue in a directory, shared by
+// several processes on the same host without a broker.
+//
+// Messages are files. Enqueuing atomically creates a file in the "ready"
+// directory. Dequeuing claims the oldest ready message by taking a lock
+// dedicated to the claim and renaming the message into the "inflight"
+// directory; acknowledging deletes it. A consumer that crashes releases its
+// claim locks, and its messages become ready again on the next Dequeue or
+// Requeue. Messages claimed for longer than the visibility timeout are made
+// ready again as well, even if their consumer is still alive; acknowledging
+// such a message then returns ErrClaimExpired.
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/atomicfile"
+	"github.com/rsgcata/go-fs/uniqfile"
+)
+
+var (
+	// ErrEmpty is returned by Dequeue when no message is ready
+	ErrEmpty = errors.New("queue is empty")
+
+	// ErrClaimExpired is returned when acknowledging a message whose claim was
+	// given up, because its visibility timeout expired
+	ErrClaimExpired = errors.New("message claim expired")
+)
+
+// Subdirectories of the queue directory
+const (
+	readyDir    = "ready"
+	inflightDir = "inflight"
+	locksDir    = "locks"
+)
+
+// claimSeparator separates the message ID from the claim ID in inflight names
+const claimSeparator = "~"
+
+// Queue is a FIFO queue stored in a directory
+type Queue struct {
+	dir        string
+	visibility time.Duration
+}
+
+// Option configures a Queue
+type Option func(*Queue)
+
+// WithVisibilityTimeout sets how long a message may stay claimed before it is
+// made ready again. By default claims only expire when their consumer dies.
+func WithVisibilityTimeout(timeout time.Duration) Option {
+	return func(q *Queue) {
+		q.visibility = timeout
+	}
+}
+
+// Open opens the queue stored in dir, creating the directory layout if needed
+func Open(dir string, opts ...Option) (*Queue, error) {
+	q := &Queue{dir: dir}
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	for _, sub := range []string{readyDir, inflightDir, locksDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0777); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// Enqueue appends a message with the given data and returns its ID
+func (q *Queue) Enqueue(data []byte) (string, error) {
+	id := uniqfile.Name()
+	if err := atomicfile.WriteFile(q.path(readyDir, id), data, 0644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Dequeue claims the oldest ready message, or returns ErrEmpty
+// Claims of dead consumers and expired claims are requeued first
+func (q *Queue) Dequeue() (*Message, error) {
+	if _, err := q.Requeue(); err != nil {
+		return nil, err
+	}
+
+	ids, err := q.list(readyDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		msg, err := q.claim(id)
+		if errors.Is(err, os.ErrNotExist) {
+			// Claimed by another consumer in the meantime
+			continue
+		}
+		return msg, err
+	}
+	return nil, ErrEmpty
+}
+
+// claim takes the claim lock of a new claim of message id, then moves the message in flight
+func (q *Queue) claim(id string) (*Message, error) {
+	claimID := uniqfile.Name()
+	name := id + claimSeparator + claimID
+
+	// The claim lock is taken before the message becomes in flight, so an in flight
+	// message with a free claim lock always belongs to a dead consumer
+	lock := fs.New(q.path(locksDir, name+fs.LockSuffix))
+	if err := lock.Lock(); err != nil {
+		return nil, err
+	}
+
+	release := func() {
+		_ = os.Remove(lock.Path())
+		_ = lock.Unlock()
+	}
+
+	if err := os.Rename(q.path(readyDir, id), q.path(inflightDir, name)); err != nil {
+		release()
+		return nil, err
+	}
+
+	data, err := os.ReadFile(q.path(inflightDir, name))
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	return &Message{ID: id, Data: data, queue: q, name: name, release: release}, nil
+}
+
+// Requeue makes ready again the messages claimed by dead consumers, and those
+// claimed for longer than the visibility timeout. It returns how many were requeued.
+func (q *Queue) Requeue() (int, error) {
+	names, err := q.list(inflightDir)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, name := range names {
+		id, claimID, ok := strings.Cut(name, claimSeparator)
+		if !ok {
+			continue
+		}
+
+		lock := fs.New(q.path(locksDir, name+fs.LockSuffix))
+		alive := lock.Lock() != nil
+		if alive && !q.expired(claimID) {
+			continue
+		}
+
+		err := os.Rename(q.path(inflightDir, name), q.path(readyDir, id))
+		if err == nil {
+			requeued++
+		}
+		_ = os.Remove(lock.Path())
+		if !alive {
+			_ = lock.Unlock()
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return requeued, err
+		}
+	}
+	return requeued, nil
+}
+
+// Len returns the number of ready messages
+func (q *Queue) Len() (int, error) {
+	ids, err := q.list(readyDir)
+	return len(ids), err
+}
+
+// expired reports whether a claim is older than the visibility timeout
+func (q *Queue) expired(claimID string) bool {
+	if q.visibility <= 0 {
+		return false
+	}
+	claimedAt, ok := uniqfile.Time(claimID)
+	return ok && time.Since(claimedAt) > q.visibility
+}
+
+// list returns the sorted message names in a subdirectory, skipping temporary files
+func (q *Queue) list(sub string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, sub))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (q *Queue) path(sub, name string) string {
+	return filepath.Join(q.dir, sub, name)
+}
+
+// Message is a message claimed by this consumer
+type Message struct {
+	// ID identifies the message in the queue
+	ID string
+
+	// Data is the content of the message
+	Data []byte
+
+	queue   *Queue
+	name    string
+	release func()
+}
+
+// Ack removes the message from the queue
+// It returns ErrClaimExpired if the claim expired and the message was requeued
+func (m *Message) Ack() error {
+	defer m.release()
+
+	err := os.Remove(m.queue.path(inflightDir, m.name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrClaimExpired
+	}
+	return err
+}
+
+// Nack gives up the claim and makes the message ready again
+// It returns ErrClaimExpired if the claim already expired
+func (m *Message) Nack() error {
+	defer m.release()
+
+	err := os.Rename(m.queue.path(inflightDir, m.name), m.queue.path(readyDir, m.ID))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrClaimExpired
+	}
+	return err
+}
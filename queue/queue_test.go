@@ -0,0 +1,167 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// QueueTestSuite defines a test suite for the directory queue
+type QueueTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for the queue before each test
+func (s *QueueTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "queue-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *QueueTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestFIFO tests that messages are dequeued in enqueue order
+func (s *QueueTestSuite) TestFIFO() {
+	q, err := Open(s.tempDir)
+	s.Require().NoError(err)
+
+	for i := 0; i < 3; i++ {
+		_, err := q.Enqueue([]byte(fmt.Sprint(i)))
+		s.Require().NoError(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		msg, err := q.Dequeue()
+		s.Require().NoError(err)
+		s.Assert().Equal(fmt.Sprint(i), string(msg.Data))
+		s.Require().NoError(msg.Ack())
+	}
+
+	_, err = q.Dequeue()
+	s.Assert().Equal(ErrEmpty, err)
+}
+
+// TestNack tests that a rejected message becomes ready again
+func (s *QueueTestSuite) TestNack() {
+	q, err := Open(s.tempDir)
+	s.Require().NoError(err)
+	id, err := q.Enqueue([]byte("job"))
+	s.Require().NoError(err)
+
+	msg, err := q.Dequeue()
+	s.Require().NoError(err)
+	s.Assert().Equal(id, msg.ID)
+
+	n, err := q.Len()
+	s.Require().NoError(err)
+	s.Assert().Zero(n)
+
+	s.Require().NoError(msg.Nack())
+
+	msg, err = q.Dequeue()
+	s.Require().NoError(err)
+	s.Assert().Equal(id, msg.ID)
+	s.Require().NoError(msg.Ack())
+}
+
+// TestDeadConsumerIsRequeued tests that claims whose lock was released are requeued
+func (s *QueueTestSuite) TestDeadConsumerIsRequeued() {
+	q, err := Open(s.tempDir)
+	s.Require().NoError(err)
+	_, err = q.Enqueue([]byte("job"))
+	s.Require().NoError(err)
+
+	msg, err := q.Dequeue()
+	s.Require().NoError(err)
+
+	// A live claim is not requeued
+	n, err := q.Requeue()
+	s.Require().NoError(err)
+	s.Assert().Zero(n)
+
+	// Simulate a crash: the claim lock is released without acknowledging
+	msg.release()
+
+	again, err := q.Dequeue()
+	s.Require().NoError(err)
+	s.Assert().Equal(msg.ID, again.ID)
+	s.Require().NoError(again.Ack())
+}
+
+// TestVisibilityTimeout tests that expired claims are requeued and cannot be acknowledged
+func (s *QueueTestSuite) TestVisibilityTimeout() {
+	q, err := Open(s.tempDir, WithVisibilityTimeout(20*time.Millisecond))
+	s.Require().NoError(err)
+	_, err = q.Enqueue([]byte("job"))
+	s.Require().NoError(err)
+
+	slow, err := q.Dequeue()
+	s.Require().NoError(err)
+
+	time.Sleep(40 * time.Millisecond)
+
+	fast, err := q.Dequeue()
+	s.Require().NoError(err)
+	s.Assert().Equal(slow.ID, fast.ID)
+
+	s.Assert().Equal(ErrClaimExpired, slow.Ack())
+	s.Require().NoError(fast.Ack())
+}
+
+// TestConcurrentConsumers tests that each message is delivered to exactly one consumer
+func (s *QueueTestSuite) TestConcurrentConsumers() {
+	q, err := Open(s.tempDir)
+	s.Require().NoError(err)
+
+	const numMessages = 50
+	for i := 0; i < numMessages; i++ {
+		_, err := q.Enqueue([]byte(fmt.Sprint(i)))
+		s.Require().NoError(err)
+	}
+
+	var (
+		mutex sync.Mutex
+		seen  = make(map[string]int)
+		wg    sync.WaitGroup
+	)
+	for w := 0; w < 5; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumer, err := Open(s.tempDir)
+			s.Assert().NoError(err)
+			for {
+				msg, err := consumer.Dequeue()
+				if err == ErrEmpty {
+					return
+				}
+				if !s.Assert().NoError(err) {
+					return
+				}
+				mutex.Lock()
+				seen[string(msg.Data)]++
+				mutex.Unlock()
+				s.Assert().NoError(msg.Ack())
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.Assert().Len(seen, numMessages)
+	for data, count := range seen {
+		s.Assert().Equal(1, count, data)
+	}
+}
+
+// TestQueue runs the test suite
+func TestQueue(t *testing.T) {
+	suite.Run(t, new(QueueTestSuite))
+}
@@ -0,0 +1,311 @@
+// Package ratelimit is a token bucket rate limiter shared by the processes of a
+// host, for example to respect an API quota from several workers.
+//
+// The state of the bucket lives in a file updated with fs.Update, under the lock
+// of its sidecar lock file. The API is modeled on golang.org/x/time/rate, with
+// errors added where the state file is accessed. Every process sharing a file
+// must use the same limit and burst.
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// DefaultTimeout is the default time an operation waits for the lock of the state file
+const DefaultTimeout = 10 * time.Second
+
+var (
+	// ErrExceedsBurst is returned when waiting for more events than the burst allows
+	ErrExceedsBurst = errors.New("rate: n exceeds limiter's burst")
+
+	// ErrWouldExceedDeadline is returned by Wait when the wait would exceed the context deadline
+	ErrWouldExceedDeadline = errors.New("rate: wait would exceed context deadline")
+)
+
+// Limit is a maximum frequency of events, in events per second
+type Limit float64
+
+// Inf is the infinite rate limit, it allows all events
+const Inf = Limit(math.MaxFloat64)
+
+// Every converts a minimum time interval between events to a Limit
+func Every(interval time.Duration) Limit {
+	if interval <= 0 {
+		return Inf
+	}
+	return 1 / Limit(interval.Seconds())
+}
+
+// Limiter controls how frequently events are allowed to happen across processes
+type Limiter struct {
+	path    string
+	limit   Limit
+	burst   int
+	timeout time.Duration
+	clock   filelock.Clock
+}
+
+// Option configures a Limiter
+type Option func(*Limiter)
+
+// WithTimeout sets how long operations wait for the lock, DefaultTimeout by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(l *Limiter) {
+		l.timeout = timeout
+	}
+}
+
+// WithClock sets the Clock used for the bucket and for Wait, instead of filelock.DefaultClock
+func WithClock(clock filelock.Clock) Option {
+	return func(l *Limiter) {
+		l.clock = clock
+	}
+}
+
+// New returns a Limiter allowing events up to rate limit with bursts of at most
+// burst events, whose state is kept in the file at path. A missing file is a full bucket.
+func New(path string, limit Limit, burst int, opts ...Option) *Limiter {
+	l := &Limiter{
+		path:    path,
+		limit:   limit,
+		burst:   burst,
+		timeout: DefaultTimeout,
+		clock:   filelock.DefaultClock,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Limit returns the maximum event frequency
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+// Burst returns the maximum burst size
+func (l *Limiter) Burst() int {
+	return l.burst
+}
+
+// Tokens returns the number of tokens available now
+func (l *Limiter) Tokens() (float64, error) {
+	var tokens float64
+	err := l.update(func(s *state, now time.Time) bool {
+		tokens = s.Tokens
+		return false
+	})
+	return tokens, err
+}
+
+// Allow reports whether an event may happen now
+func (l *Limiter) Allow() (bool, error) {
+	return l.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now, and consumes their tokens if so
+func (l *Limiter) AllowN(n int) (bool, error) {
+	r, err := l.reserveN(n, 0)
+	if err != nil {
+		return false, err
+	}
+	return r.ok, nil
+}
+
+// Reserve returns a Reservation telling how long to wait before an event may happen
+func (l *Limiter) Reserve() (*Reservation, error) {
+	return l.ReserveN(1)
+}
+
+// ReserveN returns a Reservation telling how long to wait before n events may happen.
+// The tokens are consumed unless the reservation is not OK, because n exceeds the burst.
+func (l *Limiter) ReserveN(n int) (*Reservation, error) {
+	return l.reserveN(n, time.Duration(math.MaxInt64))
+}
+
+// Wait blocks until an event may happen
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n events may happen. It fails without consuming tokens if n
+// exceeds the burst or if the wait would exceed the deadline of ctx, and returns
+// the tokens if ctx is canceled while waiting.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if n > l.burst && l.limit != Inf {
+		return fmt.Errorf("%w: Wait(n=%d) with burst %d", ErrExceedsBurst, n, l.burst)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	maxWait := time.Duration(math.MaxInt64)
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = deadline.Sub(l.clock.Now())
+	}
+
+	r, err := l.reserveN(n, maxWait)
+	if err != nil {
+		return err
+	}
+	if !r.ok {
+		return fmt.Errorf("%w: Wait(n=%d)", ErrWouldExceedDeadline, n)
+	}
+
+	delay := r.DelayFrom(l.clock.Now())
+	if delay == 0 {
+		return nil
+	}
+	if err := l.clock.Sleep(ctx, delay); err != nil {
+		_ = r.Cancel()
+		return err
+	}
+	return nil
+}
+
+// Reservation holds tokens reserved for events happening after a delay
+type Reservation struct {
+	limiter   *Limiter
+	ok        bool
+	tokens    int
+	timeToAct time.Time
+}
+
+// OK reports whether the events may happen at all, false if they exceed the burst
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long to wait before the events may happen
+func (r *Reservation) Delay() time.Duration {
+	return r.DelayFrom(r.limiter.clock.Now())
+}
+
+// DelayFrom returns how long to wait from t before the events may happen.
+// It is infinite if the reservation is not OK.
+func (r *Reservation) DelayFrom(t time.Time) time.Duration {
+	if !r.ok {
+		return time.Duration(math.MaxInt64)
+	}
+	return max(r.timeToAct.Sub(t), 0)
+}
+
+// Cancel returns the reserved tokens to the bucket, if the events did not happen
+// yet. Like golang.org/x/time/rate, the tokens the reservations made afterwards
+// were scheduled against are not returned.
+func (r *Reservation) Cancel() error {
+	if !r.ok || r.tokens == 0 {
+		return nil
+	}
+	limit := r.limiter.limit
+	return r.limiter.update(func(s *state, now time.Time) bool {
+		if !r.timeToAct.After(now) {
+			return false
+		}
+		tokens := float64(r.tokens)
+		restore := tokens - limit.tokensFromDuration(s.LastEvent.Sub(r.timeToAct))
+		r.tokens = 0
+		if restore <= 0 {
+			return false
+		}
+		s.Tokens = min(s.Tokens+restore, float64(r.limiter.burst))
+		if r.timeToAct.Equal(s.LastEvent) {
+			// The last reservation is canceled, the previous one becomes the last
+			if prev := r.timeToAct.Add(-limit.durationFromTokens(tokens)); !prev.Before(now) {
+				s.LastEvent = prev
+			}
+		}
+		return true
+	})
+}
+
+// reserveN reserves n tokens if they are available within maxWait
+func (l *Limiter) reserveN(n int, maxWait time.Duration) (*Reservation, error) {
+	r := &Reservation{limiter: l}
+	if l.limit == Inf {
+		r.ok, r.timeToAct = true, l.clock.Now()
+		return r, nil
+	}
+
+	err := l.update(func(s *state, now time.Time) bool {
+		tokens := s.Tokens - float64(n)
+		var wait time.Duration
+		if tokens < 0 {
+			wait = l.limit.durationFromTokens(-tokens)
+		}
+		if n > l.burst || wait > maxWait || (tokens < 0 && l.limit <= 0) {
+			return false
+		}
+
+		r.ok, r.tokens, r.timeToAct = true, n, now.Add(wait)
+		s.Tokens = tokens
+		s.LastEvent = r.timeToAct
+		return true
+	})
+	return r, err
+}
+
+// state is the content of the state file
+type state struct {
+	Tokens float64   `json:"tokens"`
+	Last   time.Time `json:"last"`
+
+	// LastEvent is when the latest reservation may act
+	LastEvent time.Time `json:"last_event"`
+}
+
+// update calls fn with the state of the bucket advanced to now, and saves it if fn returns true
+func (l *Limiter) update(fn func(s *state, now time.Time) bool) error {
+	errUnchanged := errors.New("unchanged")
+
+	err := fs.Update(l.path, l.timeout, func(old []byte) ([]byte, error) {
+		now := l.clock.Now()
+		s := state{Tokens: float64(l.burst), Last: now}
+		if old != nil {
+			if err := json.Unmarshal(old, &s); err != nil {
+				return nil, fmt.Errorf("rate: corrupt state file %s: %w", l.path, err)
+			}
+		}
+		l.advance(&s, now)
+
+		if !fn(&s, now) {
+			return nil, errUnchanged
+		}
+		return json.Marshal(s)
+	})
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	return err
+}
+
+// advance refills the bucket for the time elapsed since the last update
+func (l *Limiter) advance(s *state, now time.Time) {
+	if elapsed := now.Sub(s.Last); elapsed > 0 {
+		s.Tokens += l.limit.tokensFromDuration(elapsed)
+		s.Last = now
+	}
+	s.Tokens = min(s.Tokens, float64(l.burst))
+}
+
+func (limit Limit) durationFromTokens(tokens float64) time.Duration {
+	if limit <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / float64(limit) * float64(time.Second))
+}
+
+func (limit Limit) tokensFromDuration(d time.Duration) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return d.Seconds() * float64(limit)
+}
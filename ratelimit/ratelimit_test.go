@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock/fakeclock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// RateLimitTestSuite defines a test suite for the shared rate limiter
+type RateLimitTestSuite struct {
+	suite.Suite
+	tempDir string
+	path    string
+	clock   *fakeclock.Clock
+}
+
+// SetupTest creates a temporary directory and a fake clock before each test
+func (s *RateLimitTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "ratelimit-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.path = filepath.Join(tempDir, "api.rate")
+	s.clock = fakeclock.New(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *RateLimitTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *RateLimitTestSuite) newLimiter(limit Limit, burst int) *Limiter {
+	return New(s.path, limit, burst, WithClock(s.clock))
+}
+
+func (s *RateLimitTestSuite) allow(l *Limiter) bool {
+	ok, err := l.Allow()
+	s.Require().NoError(err)
+	return ok
+}
+
+// TestAllowBurstAndRefill tests that the burst is allowed and tokens refill over time
+func (s *RateLimitTestSuite) TestAllowBurstAndRefill() {
+	l := s.newLimiter(Every(time.Second), 3)
+
+	for i := 0; i < 3; i++ {
+		s.Assert().True(s.allow(l))
+	}
+	s.Assert().False(s.allow(l))
+
+	s.clock.Advance(time.Second)
+	s.Assert().True(s.allow(l))
+	s.Assert().False(s.allow(l))
+}
+
+// TestSharedQuota tests that limiters on the same file share their tokens
+func (s *RateLimitTestSuite) TestSharedQuota() {
+	first, second := s.newLimiter(1, 2), s.newLimiter(1, 2)
+
+	s.Assert().True(s.allow(first))
+	s.Assert().True(s.allow(second))
+	s.Assert().False(s.allow(first))
+	s.Assert().False(s.allow(second))
+
+	tokens, err := second.Tokens()
+	s.Require().NoError(err)
+	s.Assert().Zero(tokens)
+}
+
+// TestReserve tests the delay of reservations beyond the available tokens
+func (s *RateLimitTestSuite) TestReserve() {
+	l := s.newLimiter(10, 1)
+
+	r, err := l.Reserve()
+	s.Require().NoError(err)
+	s.Assert().True(r.OK())
+	s.Assert().Zero(r.Delay())
+
+	r, err = l.Reserve()
+	s.Require().NoError(err)
+	s.Assert().Equal(100*time.Millisecond, r.Delay())
+
+	r, err = l.ReserveN(2)
+	s.Require().NoError(err)
+	s.Assert().False(r.OK())
+}
+
+// TestCancel tests that canceling a pending reservation returns its tokens
+func (s *RateLimitTestSuite) TestCancel() {
+	l := s.newLimiter(1, 1)
+	s.Assert().True(s.allow(l))
+
+	r, err := l.Reserve()
+	s.Require().NoError(err)
+	s.Require().NoError(r.Cancel())
+
+	tokens, err := l.Tokens()
+	s.Require().NoError(err)
+	s.Assert().Zero(tokens)
+}
+
+// TestCancelAfterLaterReservations tests that canceling a reservation does not
+// return the tokens the later reservations were scheduled against
+func (s *RateLimitTestSuite) TestCancelAfterLaterReservations() {
+	l := s.newLimiter(1, 1)
+	s.Assert().True(s.allow(l))
+
+	first, err := l.Reserve()
+	s.Require().NoError(err)
+	second, err := l.Reserve()
+	s.Require().NoError(err)
+	s.Assert().Equal(2*time.Second, second.Delay())
+
+	s.Require().NoError(first.Cancel())
+	third, err := l.Reserve()
+	s.Require().NoError(err)
+	s.Assert().Equal(3*time.Second, third.Delay(), "the tokens used by the second reservation were returned")
+
+	s.Require().NoError(third.Cancel())
+	fourth, err := l.Reserve()
+	s.Require().NoError(err)
+	s.Assert().Equal(3*time.Second, fourth.Delay(), "the last reservation returns all its tokens")
+}
+
+// TestWait tests that Wait sleeps until the tokens are available
+func (s *RateLimitTestSuite) TestWait() {
+	l := s.newLimiter(Every(200*time.Millisecond), 1)
+
+	s.Require().NoError(l.Wait(context.Background()))
+	s.Require().NoError(l.Wait(context.Background()))
+	s.Assert().Equal([]time.Duration{200 * time.Millisecond}, s.clock.Sleeps())
+}
+
+// TestWaitErrors tests that impossible waits fail without consuming tokens
+func (s *RateLimitTestSuite) TestWaitErrors() {
+	// Context deadlines are in real time
+	s.clock = fakeclock.New(time.Now())
+	l := s.newLimiter(Every(time.Second), 1)
+
+	s.Assert().ErrorIs(l.WaitN(context.Background(), 2), ErrExceedsBurst)
+
+	s.Require().NoError(l.Wait(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	s.Assert().ErrorIs(l.Wait(ctx), ErrWouldExceedDeadline)
+
+	s.clock.Advance(time.Second)
+	s.Assert().True(s.allow(l))
+}
+
+// TestInf tests that the infinite limit allows every event without touching the file
+func (s *RateLimitTestSuite) TestInf() {
+	l := s.newLimiter(Inf, 0)
+	for i := 0; i < 10; i++ {
+		s.Assert().True(s.allow(l))
+	}
+	s.Assert().NoFileExists(s.path)
+}
+
+// TestRateLimit runs the test suite
+func TestRateLimit(t *testing.T) {
+	suite.Run(t, new(RateLimitTestSuite))
+}
@@ -0,0 +1,140 @@
+package fs
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+
+	"github.com/rsgcata/go-fs/watch"
+)
+
+// Reloader delivers the decoded content of a file, typically a config file, every
+// time it changes. The file is read like ReadFileShared, under a shared lock on
+// LockPath(path), so a file written by the locked writers of this package, like
+// WriteFileLocked or Update, is never read half-written.
+type Reloader[T any] struct {
+	path    string
+	decode  func([]byte) (T, error)
+	opts    []FileOption
+	watcher *watch.Watcher
+	values  chan T
+	errors  chan error
+	last    []byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewReloader watches the file at path, which must exist, and delivers its content
+// decoded with decode on Values: first the current content, then the new content
+// after every change. Changes leaving the content unchanged are not delivered.
+func NewReloader[T any](path string, decode func([]byte) (T, error), opts ...FileOption) (*Reloader[T], error) {
+	path = filepath.Clean(path)
+	watcher, err := watch.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(path); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	r := &Reloader[T]{
+		path:    path,
+		decode:  decode,
+		opts:    opts,
+		watcher: watcher,
+		values:  make(chan T),
+		errors:  make(chan error),
+		done:    make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.run()
+	return r, nil
+}
+
+// Values returns the channel receiving the decoded content, closed by Close
+// It must be read continuously: the file is not read again until each value is received
+func (r *Reloader[T]) Values() <-chan T {
+	return r.values
+}
+
+// Errors returns the channel receiving the errors reading, verifying or decoding the
+// file, and of the watch, closed by Close. It must be read like Values.
+func (r *Reloader[T]) Errors() <-chan error {
+	return r.errors
+}
+
+// Path returns the path of the watched file
+func (r *Reloader[T]) Path() string {
+	return r.path
+}
+
+// run delivers the current content, then the content after every change
+func (r *Reloader[T]) run() {
+	defer r.wg.Done()
+	r.reload()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case err := <-r.watcher.Errors():
+			r.send(nil, err)
+		case e := <-r.watcher.Events():
+			// Atomic writes rename the new content over the file, which is a Create
+			if e.Op&(watch.Create|watch.Write) != 0 {
+				r.reload()
+			}
+		}
+	}
+}
+
+// reload reads and decodes the file, and delivers the value if the content changed
+func (r *Reloader[T]) reload() {
+	data, err := ReadFileShared(r.path, r.opts...)
+	if err != nil {
+		r.send(nil, err)
+		return
+	}
+	if r.last != nil && bytes.Equal(data, r.last) {
+		return
+	}
+
+	value, err := r.decode(data)
+	if err != nil {
+		r.send(nil, err)
+		return
+	}
+	r.last = data
+	r.send(&value, nil)
+}
+
+// send delivers value, or err if not nil, unless the Reloader is closed
+func (r *Reloader[T]) send(value *T, err error) {
+	if err != nil {
+		select {
+		case r.errors <- err:
+		case <-r.done:
+		}
+		return
+	}
+	select {
+	case r.values <- *value:
+	case <-r.done:
+	}
+}
+
+// Close stops watching the file and closes the Values and Errors channels
+func (r *Reloader[T]) Close() error {
+	err := watch.ErrClosed
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+		err = r.watcher.Close()
+		close(r.values)
+		close(r.errors)
+	})
+	return err
+}
@@ -0,0 +1,110 @@
+package fs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// testConfig is the config decoded by the reload tests
+type testConfig struct {
+	Name string `json:"name"`
+}
+
+func decodeTestConfig(data []byte) (testConfig, error) {
+	var config testConfig
+	err := json.Unmarshal(data, &config)
+	return config, err
+}
+
+// ReloadTestSuite defines a test suite for the Reloader
+type ReloadTestSuite struct {
+	suite.Suite
+	tempDir  string
+	path     string
+	reloader *Reloader[testConfig]
+}
+
+// SetupTest writes a config file and watches it before each test
+func (s *ReloadTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "reload-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.path = filepath.Join(tempDir, "config.json")
+	s.Require().NoError(WriteFileLocked(s.path, []byte(`{"name":"first"}`), 0644))
+
+	s.reloader, err = NewReloader(s.path, decodeTestConfig)
+	s.Require().NoError(err)
+}
+
+// TearDownTest closes the Reloader and removes the temporary directory after each test
+func (s *ReloadTestSuite) TearDownTest() {
+	_ = s.reloader.Close()
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *ReloadTestSuite) expectValue(name string) {
+	select {
+	case config := <-s.reloader.Values():
+		s.Assert().Equal(name, config.Name)
+	case err := <-s.reloader.Errors():
+		s.Require().NoError(err)
+	case <-time.After(2 * time.Second):
+		s.Require().Fail("no value delivered")
+	}
+}
+
+// TestReload tests that the current content and each new content are delivered
+func (s *ReloadTestSuite) TestReload() {
+	s.expectValue("first")
+
+	s.Require().NoError(WriteFileLocked(s.path, []byte(`{"name":"second"}`), 0644))
+	s.expectValue("second")
+
+	s.Require().NoError(WriteFileLocked(s.path, []byte(`{"name":`), 0644))
+	select {
+	case err := <-s.reloader.Errors():
+		s.Assert().Error(err)
+	case <-time.After(2 * time.Second):
+		s.Require().Fail("no decode error delivered")
+	}
+
+	s.Require().NoError(WriteFileLocked(s.path, []byte(`{"name":"third"}`), 0644))
+	s.expectValue("third")
+}
+
+// TestNeverReadsHalfWritten tests that changes made under the exclusive lock are read
+// once the lock is released
+func (s *ReloadTestSuite) TestNeverReadsHalfWritten() {
+	s.expectValue("first")
+
+	writer := New(LockPath(s.path))
+	s.Require().NoError(writer.Lock())
+	s.Require().NoError(os.WriteFile(s.path, []byte(`{"name":`), 0644))
+	time.Sleep(50 * time.Millisecond)
+	s.Require().NoError(os.WriteFile(s.path, []byte(`{"name":"second"}`), 0644))
+	s.Require().NoError(writer.Unlock())
+
+	s.expectValue("second")
+}
+
+// TestClose tests that Close closes the channels
+func (s *ReloadTestSuite) TestClose() {
+	s.Require().NoError(s.reloader.Close())
+	_, ok := <-s.reloader.Values()
+	s.Assert().False(ok)
+	_, ok = <-s.reloader.Errors()
+	s.Assert().False(ok)
+
+	_, err := NewReloader(filepath.Join(s.tempDir, "missing.json"), decodeTestConfig)
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+}
+
+// TestReload runs the test suite
+func TestReload(t *testing.T) {
+	suite.Run(t, new(ReloadTestSuite))
+}
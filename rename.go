@@ -0,0 +1,129 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rsgcata/go-fs/internal/dirsync"
+	"github.com/rsgcata/go-fs/uniqfile"
+)
+
+// ExchangeFiles atomically swaps the files (or directories) a and b, holding the
+// locks on LockPath(a) and LockPath(b), acquired in sorted order within
+// DefaultTimeout. Both must exist, on the same file system.
+// On Linux it uses renameat2(2) with RENAME_EXCHANGE, so even readers not using
+// the locks see either the old or the new file at each path. Elsewhere, or on file
+// systems without RENAME_EXCHANGE, the swap is three renames: it is only atomic for
+// the holders of the locks.
+func ExchangeFiles(a, b string) error {
+	return withPathLocks([]string{a, b}, nil, func() error {
+		if err := exchange(a, b); err != nil {
+			return err
+		}
+		return syncDirs(a, b)
+	})
+}
+
+// RenameNoReplace renames oldpath to newpath like os.Rename, unless newpath exists,
+// in which case it returns an error matching os.ErrExist. It holds the locks on
+// LockPath(oldpath) and LockPath(newpath), acquired in sorted order within
+// DefaultTimeout.
+// It uses renameat2(2) with RENAME_NOREPLACE on Linux and MoveFileEx without
+// MOVEFILE_REPLACE_EXISTING on Windows. On file systems without RENAME_NOREPLACE,
+// the check is only atomic for the holders of the locks.
+func RenameNoReplace(oldpath, newpath string) error {
+	return withPathLocks([]string{oldpath, newpath}, nil, func() error {
+		if err := renameNoReplace(oldpath, newpath); err != nil {
+			return err
+		}
+		return syncDirs(oldpath, newpath)
+	})
+}
+
+// withPathLocks runs fn holding exclusive locks on LockPath of the exclusive paths
+// and shared locks on LockPath of the shared ones, acquired in sorted order within
+// DefaultTimeout
+func withPathLocks(exclusive, shared []string, fn func() error) error {
+	// A path is locked once, exclusively if it is in both lists
+	sharedLocks := make(map[string]bool)
+	for _, path := range shared {
+		sharedLocks[LockPath(path)] = true
+	}
+	for _, path := range exclusive {
+		sharedLocks[LockPath(path)] = false
+	}
+
+	m := &MultiLock{}
+	var lockPaths []string
+	for lockPath := range sharedLocks {
+		m.paths = append(m.paths, strings.TrimSuffix(lockPath, LockSuffix))
+		lockPaths = append(lockPaths, lockPath)
+	}
+	sort.Strings(m.paths)
+
+	if err := m.lockSorted(lockPaths, sharedLocks, time.Now().Add(DefaultTimeout)); err != nil {
+		return err
+	}
+	err := fn()
+	if unlockErr := m.Unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// syncDirs flushes the directories of a and b
+func syncDirs(a, b string) error {
+	dirA, dirB := filepath.Dir(a), filepath.Dir(b)
+	if err := dirsync.Sync(dirA); err != nil || dirA == dirB {
+		return err
+	}
+	return dirsync.Sync(dirB)
+}
+
+// renameFile renames the files of exchangeRenames, replaced by the tests
+var renameFile = os.Rename
+
+// exchangeRenames swaps a and b with three renames through a temporary name next
+// to a. If a rename fails, the previous ones are undone, and the errors of the
+// undo, if any, are joined to the error of the rename.
+func exchangeRenames(a, b string) error {
+	if _, err := os.Lstat(b); err != nil {
+		return &os.LinkError{Op: "exchange", Old: a, New: b, Err: errors.Unwrap(err)}
+	}
+
+	tmp := filepath.Join(filepath.Dir(a), "."+filepath.Base(a)+".exchange-"+uniqfile.Name())
+	if err := renameFile(a, tmp); err != nil {
+		return err
+	}
+	if err := renameFile(b, a); err != nil {
+		return joinUndo(err, renameFile(tmp, a))
+	}
+	if err := renameFile(tmp, b); err != nil {
+		undoErr := renameFile(a, b)
+		if undoErr == nil {
+			undoErr = renameFile(tmp, a)
+		}
+		return joinUndo(err, undoErr)
+	}
+	return nil
+}
+
+// joinUndo returns err, joined with undoErr if undoing failed
+func joinUndo(err, undoErr error) error {
+	if undoErr == nil {
+		return err
+	}
+	return errors.Join(err, undoErr)
+}
+
+// renameChecked renames oldpath to newpath after checking that newpath does not exist
+func renameChecked(oldpath, newpath string) error {
+	if _, err := os.Lstat(newpath); err == nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrExist}
+	}
+	return os.Rename(oldpath, newpath)
+}
@@ -0,0 +1,33 @@
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// exchange swaps a and b with renamex_np and RENAME_SWAP, falling back to renames
+// on file systems without it
+func exchange(a, b string) error {
+	err := unix.RenamexNp(a, b, unix.RENAME_SWAP)
+	if err == unix.ENOTSUP || err == unix.EINVAL {
+		return exchangeRenames(a, b)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "exchange", Old: a, New: b, Err: err}
+	}
+	return nil
+}
+
+// renameNoReplace renames with renamex_np and RENAME_EXCL, falling back to a
+// checked rename on file systems without it
+func renameNoReplace(oldpath, newpath string) error {
+	err := unix.RenamexNp(oldpath, newpath, unix.RENAME_EXCL)
+	if err == unix.ENOTSUP || err == unix.EINVAL {
+		return renameChecked(oldpath, newpath)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build unix && !linux && !darwin
+
+package fs
+
+// exchange swaps a and b with renames, the system has no atomic exchange
+func exchange(a, b string) error {
+	return exchangeRenames(a, b)
+}
+
+// renameNoReplace renames with a checked rename, the system has no rename
+// failing when newpath exists
+func renameNoReplace(oldpath, newpath string) error {
+	return renameChecked(oldpath, newpath)
+}
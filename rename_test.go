@@ -0,0 +1,138 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// RenameTestSuite defines a test suite for the locked rename helpers
+type RenameTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory with two files before each test
+func (s *RenameTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "rename-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+
+	s.Require().NoError(os.WriteFile(s.path("blue"), []byte("blue"), 0644))
+	s.Require().NoError(os.WriteFile(s.path("green"), []byte("green"), 0644))
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *RenameTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *RenameTestSuite) path(name string) string {
+	return filepath.Join(s.tempDir, name)
+}
+
+func (s *RenameTestSuite) content(name string) string {
+	data, err := os.ReadFile(s.path(name))
+	s.Require().NoError(err)
+	return string(data)
+}
+
+// TestExchangeFiles tests that the files are swapped and nothing else is left behind
+func (s *RenameTestSuite) TestExchangeFiles() {
+	s.Require().NoError(ExchangeFiles(s.path("blue"), s.path("green")))
+	s.Assert().Equal("green", s.content("blue"))
+	s.Assert().Equal("blue", s.content("green"))
+
+	entries, err := os.ReadDir(s.tempDir)
+	s.Require().NoError(err)
+	var names []string
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != LockSuffix {
+			names = append(names, entry.Name())
+		}
+	}
+	s.Assert().Equal([]string{"blue", "green"}, names)
+
+	s.Assert().ErrorIs(ExchangeFiles(s.path("blue"), s.path("missing")), os.ErrNotExist)
+	s.Assert().Equal("green", s.content("blue"))
+}
+
+// TestExchangeRenames tests the fallback used without RENAME_EXCHANGE
+func (s *RenameTestSuite) TestExchangeRenames() {
+	s.Require().NoError(exchangeRenames(s.path("blue"), s.path("green")))
+	s.Assert().Equal("green", s.content("blue"))
+	s.Assert().Equal("blue", s.content("green"))
+	s.Assert().ErrorIs(exchangeRenames(s.path("blue"), s.path("missing")), os.ErrNotExist)
+}
+
+// TestExchangeRenamesUndo tests that a failed rename of the fallback undoes the
+// previous ones
+func (s *RenameTestSuite) TestExchangeRenamesUndo() {
+	defer func() { renameFile = os.Rename }()
+	failure := errors.New("rename failed")
+	for _, failAt := range []int{2, 3} {
+		calls := 0
+		renameFile = func(oldpath, newpath string) error {
+			calls++
+			if calls == failAt {
+				return failure
+			}
+			return os.Rename(oldpath, newpath)
+		}
+		s.Assert().ErrorIs(exchangeRenames(s.path("blue"), s.path("green")), failure)
+		s.Assert().Equal("blue", s.content("blue"))
+		s.Assert().Equal("green", s.content("green"))
+	}
+
+	undoFailure := errors.New("undo failed")
+	calls := 0
+	renameFile = func(oldpath, newpath string) error {
+		calls++
+		switch calls {
+		case 3:
+			return failure
+		case 4:
+			return undoFailure
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	err := exchangeRenames(s.path("blue"), s.path("green"))
+	s.Assert().ErrorIs(err, failure)
+	s.Assert().ErrorIs(err, undoFailure)
+}
+
+// TestRenameNoReplace tests that an existing destination is never replaced
+func (s *RenameTestSuite) TestRenameNoReplace() {
+	s.Assert().ErrorIs(RenameNoReplace(s.path("blue"), s.path("green")), os.ErrExist)
+	s.Assert().Equal("green", s.content("green"))
+
+	s.Require().NoError(RenameNoReplace(s.path("blue"), s.path("cyan")))
+	s.Assert().Equal("blue", s.content("cyan"))
+	s.Assert().NoFileExists(s.path("blue"))
+
+	s.Assert().ErrorIs(renameChecked(s.path("cyan"), s.path("green")), os.ErrExist)
+}
+
+// TestLocked tests that the helpers wait for the locks of both paths
+func (s *RenameTestSuite) TestLocked() {
+	lock := New(LockPath(s.path("green")))
+	s.Require().NoError(lock.Lock())
+	time.AfterFunc(50*time.Millisecond, func() { _ = lock.Unlock() })
+
+	start := time.Now()
+	s.Require().NoError(ExchangeFiles(s.path("blue"), s.path("green")))
+	s.Assert().GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+	s.Assert().False(lock.IsLocked())
+	s.Assert().Equal(filelock.Unlocked, lock.Status().State)
+}
+
+// TestRename runs the test suite
+func TestRename(t *testing.T) {
+	suite.Run(t, new(RenameTestSuite))
+}
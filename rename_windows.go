@@ -0,0 +1,28 @@
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// exchange swaps a and b with renames, Windows has no atomic exchange
+func exchange(a, b string) error {
+	return exchangeRenames(a, b)
+}
+
+// renameNoReplace renames with MoveFileEx, which fails if newpath exists unless
+// MOVEFILE_REPLACE_EXISTING is set
+func renameNoReplace(oldpath, newpath string) error {
+	from, err := windows.UTF16PtrFromString(oldpath)
+	if err == nil {
+		var to *uint16
+		if to, err = windows.UTF16PtrFromString(newpath); err == nil {
+			err = windows.MoveFileEx(from, to, windows.MOVEFILE_WRITE_THROUGH)
+		}
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
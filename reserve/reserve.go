@@ -0,0 +1,138 @@
+// Package reserve reserves local resources from a numbered range, such as TCP
+// ports, display numbers or device indices, across the processes of a host.
+//
+// Each number of a range has a slot lock file, and a number is reserved while
+// its slot is locked, with fs.TryLockAny. Reservations of crashed processes are
+// released by the system with their locks. Test harnesses starting many services
+// concurrently use it to pick ports that no other harness picks meanwhile.
+package reserve
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// ErrExhausted is returned when every number of the range is reserved
+var ErrExhausted = errors.New("every number of the range is reserved")
+
+// Reservation is a number reserved until Release
+type Reservation struct {
+	// Number is the reserved number
+	Number int
+
+	lock filelock.FileLock
+}
+
+// Path returns the path of the slot lock file of the reservation
+func (r *Reservation) Path() string {
+	return r.lock.Path()
+}
+
+// Release makes the number available again
+func (r *Reservation) Release() error {
+	return r.lock.Unlock()
+}
+
+type options struct {
+	random bool
+	check  func(n int) error
+}
+
+// Option configures Reserve
+type Option func(*options)
+
+// WithRandomOrder picks a random free number instead of the lowest one, which
+// limits the contention between processes reserving at the same time
+func WithRandomOrder() Option {
+	return func(o *options) {
+		o.random = true
+	}
+}
+
+// WithCheck skips the numbers for which check fails after locking their slot, for
+// resources also used by processes not using this package, see TCPPortFree
+func WithCheck(check func(n int) error) Option {
+	return func(o *options) {
+		o.check = check
+	}
+}
+
+// SlotPath returns the path of the slot lock file of number n of the range name in dir
+func SlotPath(dir, name string, n int) string {
+	return filepath.Join(dir, name+"-"+strconv.Itoa(n)+fs.LockSuffix)
+}
+
+// Reserve reserves a number between first and last, included, of the range name
+// whose slot lock files are kept in dir, created if needed. Every process sharing
+// the range must use the same dir and name. It returns ErrExhausted if every
+// number is reserved or fails its check.
+func Reserve(dir, name string, first, last int, opts ...Option) (*Reservation, error) {
+	if last < first {
+		return nil, fmt.Errorf("invalid range %d-%d", first, last)
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	numbers := make([]int, 0, last-first+1)
+	for n := first; n <= last; n++ {
+		numbers = append(numbers, n)
+	}
+
+	// Slots failing their check stay locked until a number is reserved, so they
+	// are not tried again
+	var skipped []filelock.FileLock
+	defer func() {
+		for _, lock := range skipped {
+			_ = lock.Unlock()
+		}
+	}()
+
+	for len(numbers) > 0 {
+		paths := make([]string, len(numbers))
+		for i, n := range numbers {
+			paths[i] = SlotPath(dir, name, n)
+		}
+		var anyOpts []fs.AnyOption
+		if o.random {
+			anyOpts = append(anyOpts, fs.WithRandomOrder())
+		}
+
+		lock, i, err := fs.TryLockAny(paths, anyOpts...)
+		if errors.Is(err, filelock.ErrLockHeld) {
+			return nil, ErrExhausted
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		n := numbers[i]
+		if o.check == nil || o.check(n) == nil {
+			return &Reservation{Number: n, lock: lock}, nil
+		}
+		skipped = append(skipped, lock)
+		numbers = append(numbers[:i], numbers[i+1:]...)
+	}
+	return nil, ErrExhausted
+}
+
+// TCPPortFree checks that the TCP port can be listened on on the loopback
+// interface, for WithCheck
+func TCPPortFree(port int) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	return listener.Close()
+}
@@ -0,0 +1,98 @@
+package reserve
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// ReserveTestSuite defines a test suite for the number reservations
+type ReserveTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory before each test
+func (s *ReserveTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "reserve-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *ReserveTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestReserve tests that each number is reserved once until released
+func (s *ReserveTestSuite) TestReserve() {
+	first, err := Reserve(s.tempDir, "display", 10, 11)
+	s.Require().NoError(err)
+	s.Assert().Equal(10, first.Number)
+	s.Assert().Equal(SlotPath(s.tempDir, "display", 10), first.Path())
+
+	second, err := Reserve(s.tempDir, "display", 10, 11)
+	s.Require().NoError(err)
+	s.Assert().Equal(11, second.Number)
+
+	_, err = Reserve(s.tempDir, "display", 10, 11, WithRandomOrder())
+	s.Assert().Equal(ErrExhausted, err)
+
+	s.Require().NoError(first.Release())
+	again, err := Reserve(s.tempDir, "display", 10, 11, WithRandomOrder())
+	s.Require().NoError(err)
+	s.Assert().Equal(10, again.Number)
+	s.Require().NoError(again.Release())
+	s.Require().NoError(second.Release())
+
+	_, err = Reserve(s.tempDir, "display", 11, 10)
+	s.Assert().Error(err)
+}
+
+// TestCheck tests that numbers failing the check are skipped and not kept reserved
+func (s *ReserveTestSuite) TestCheck() {
+	inUse := errors.New("in use")
+	check := func(n int) error {
+		if n < 3 {
+			return inUse
+		}
+		return nil
+	}
+
+	r, err := Reserve(s.tempDir, "device", 1, 3, WithCheck(check))
+	s.Require().NoError(err)
+	s.Assert().Equal(3, r.Number)
+
+	_, err = Reserve(s.tempDir, "device", 1, 3, WithCheck(check))
+	s.Assert().Equal(ErrExhausted, err)
+	s.Require().NoError(r.Release())
+
+	r, err = Reserve(s.tempDir, "device", 1, 3)
+	s.Require().NoError(err)
+	s.Assert().Equal(1, r.Number, "skipped slots are released")
+	s.Require().NoError(r.Release())
+}
+
+// TestTCPPortFree tests the port check against a listening port
+func (s *ReserveTestSuite) TestTCPPortFree() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	s.Assert().Error(TCPPortFree(port))
+
+	r, err := Reserve(s.tempDir, "port", port, port+1, WithCheck(TCPPortFree))
+	if err == nil {
+		s.Assert().Equal(port+1, r.Number)
+		s.Require().NoError(r.Release())
+	}
+	s.Require().NoError(listener.Close())
+	s.Assert().NoError(TCPPortFree(port))
+}
+
+// TestReservations runs the test suite
+func TestReservations(t *testing.T) {
+	suite.Run(t, new(ReserveTestSuite))
+}
@@ -0,0 +1,98 @@
+package fs
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// DefaultTimeout is how long the helpers without a timeout parameter wait for the lock
+const DefaultTimeout = 10 * time.Second
+
+// ReadFileShared reads the file at path like os.ReadFile, under a shared lock on
+// LockPath(path) acquired within DefaultTimeout. Writers holding the exclusive lock,
+// like Update, cannot modify the file during the read, so it is never torn, while
+// any number of readers proceed concurrently.
+func ReadFileShared(path string, opts ...FileOption) ([]byte, error) {
+	o := newFileOptions(opts)
+	var data []byte
+	err := withLock(path, true, func() error {
+		var err error
+		data, err = readFile(path, o)
+		return err
+	})
+	return data, err
+}
+
+// readFile reads path and verifies its checksum if requested, the lock being held
+func readFile(path string, o fileOptions) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil && o.checksum {
+		err = verifyChecksum(path, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CopySnapshot copies the content of the file at path to w under a shared lock on
+// LockPath(path), like ReadFileShared, and returns the number of bytes copied.
+// The lock is held until the copy completes, so a slow w delays the writers.
+// With WithChecksum, a mismatch is only detected once the content is copied.
+func CopySnapshot(w io.Writer, path string, opts ...FileOption) (int64, error) {
+	o := newFileOptions(opts)
+	var n int64
+	err := withLock(path, true, func() error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if !o.checksum {
+			n, err = io.Copy(w, file)
+			return err
+		}
+		h := sha256.New()
+		if n, err = io.Copy(io.MultiWriter(w, h), file); err != nil {
+			return err
+		}
+		return compareChecksum(path, h.Sum(nil))
+	})
+	return n, err
+}
+
+// withLock runs fn holding a shared or exclusive lock on LockPath(path),
+// acquired within DefaultTimeout
+func withLock(path string, shared bool, fn func() error) error {
+	lock := newPathLock(path, shared)
+	if err := lock.LockWithTimeout(DefaultTimeout); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return fn()
+}
+
+// withLockContext runs fn holding a shared or exclusive lock on LockPath(path),
+// acquired until ctx is done
+func withLockContext(ctx context.Context, path string, shared bool, fn func() error) error {
+	lock := newPathLock(path, shared)
+	if err := lockContext(ctx, lock); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return fn()
+}
+
+// newPathLock returns a shared or exclusive lock on LockPath(path)
+func newPathLock(path string, shared bool) filelock.FileLock {
+	if shared {
+		return New(LockPath(path), filelock.WithShared())
+	}
+	return New(LockPath(path))
+}
@@ -0,0 +1,151 @@
+// Package spool lets worker processes claim the files of a spool directory,
+// such as mail, print or job spools, so that each file is processed by a
+// single worker at a time.
+//
+// A claim is a lock on a per-file lock file kept in a separate claims
+// directory, hidden inside the spool by default. Claims are released by the
+// system when the worker dies, so the files of a crashed worker can be claimed
+// again immediately. Files are never renamed while claimed, which keeps the
+// spool compatible with producers and tools that do not know about claims.
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// ErrNothingToClaim is returned by Claim when every file is claimed or the spool is empty
+var ErrNothingToClaim = errors.New("no unclaimed file in spool")
+
+// DefaultClaimsDir is the name of the claims directory created inside the spool
+const DefaultClaimsDir = ".claims"
+
+// Spool is a directory whose files are claimed by workers
+type Spool struct {
+	dir       string
+	claimsDir string
+}
+
+// Option configures a Spool
+type Option func(*Spool)
+
+// WithClaimsDir keeps the claim lock files in dir instead of a hidden directory
+// inside the spool. All the workers of a spool must use the same claims directory.
+func WithClaimsDir(dir string) Option {
+	return func(s *Spool) {
+		s.claimsDir = dir
+	}
+}
+
+// Open opens the spool directory dir, creating its claims directory if needed
+func Open(dir string, opts ...Option) (*Spool, error) {
+	s := &Spool{dir: dir, claimsDir: filepath.Join(dir, DefaultClaimsDir)}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := os.MkdirAll(s.claimsDir, 0777); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Files returns the names of the files in the spool, claimed or not, sorted by name
+// Hidden files, starting with a dot, and directories are ignored
+func (s *Spool) Files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Claim claims the first unclaimed file in name order
+// It returns ErrNothingToClaim if every file is claimed or the spool is empty
+func (s *Spool) Claim() (*Claim, error) {
+	names, err := s.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		claim, err := s.ClaimFile(name)
+		if errors.Is(err, filelock.ErrLockHeld) || errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		return claim, err
+	}
+	return nil, ErrNothingToClaim
+}
+
+// ClaimFile claims the named file of the spool
+// It returns filelock.ErrLockHeld if the file is claimed by another worker, and
+// an error satisfying errors.Is(err, os.ErrNotExist) if the file does not exist
+func (s *Spool) ClaimFile(name string) (*Claim, error) {
+	lock := fs.New(filepath.Join(s.claimsDir, name+fs.LockSuffix))
+	if err := lock.Lock(); err != nil {
+		return nil, err
+	}
+
+	// The file may have been completed by another worker before we got the claim
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		_ = lock.Unlock()
+		return nil, err
+	}
+
+	return &Claim{Name: name, Path: path, lock: lock}, nil
+}
+
+// Claim is a file of the spool claimed by this worker
+type Claim struct {
+	// Name is the file name in the spool
+	Name string
+
+	// Path is the path of the claimed file
+	Path string
+
+	lock filelock.FileLock
+}
+
+// Release gives up the claim and leaves the file in the spool
+func (c *Claim) Release() error {
+	return c.lock.Unlock()
+}
+
+// Done removes the file from the spool and releases the claim
+func (c *Claim) Done() error {
+	if err := os.Remove(c.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return c.finish()
+}
+
+// MoveTo moves the file into dir, for example a "processed" directory, and
+// releases the claim. dir must be on the same file system as the spool.
+func (c *Claim) MoveTo(dir string) error {
+	if err := os.Rename(c.Path, filepath.Join(dir, c.Name)); err != nil {
+		return err
+	}
+	return c.finish()
+}
+
+// finish releases the claim of a file that left the spool, removing its lock file
+func (c *Claim) finish() error {
+	_ = os.Remove(c.lock.Path())
+	return c.lock.Unlock()
+}
@@ -0,0 +1,160 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// SpoolTestSuite defines a test suite for the spool claims
+type SpoolTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary spool directory before each test
+func (s *SpoolTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "spool-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *SpoolTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *SpoolTestSuite) writeFiles(names ...string) {
+	for _, name := range names {
+		s.Require().NoError(os.WriteFile(filepath.Join(s.tempDir, name), []byte(name), 0644))
+	}
+}
+
+// TestClaimSkipsClaimedFiles tests that two workers never claim the same file
+func (s *SpoolTestSuite) TestClaimSkipsClaimedFiles() {
+	s.writeFiles("a", "b")
+	worker1, err := Open(s.tempDir)
+	s.Require().NoError(err)
+	worker2, err := Open(s.tempDir)
+	s.Require().NoError(err)
+
+	claim1, err := worker1.Claim()
+	s.Require().NoError(err)
+	s.Assert().Equal("a", claim1.Name)
+
+	claim2, err := worker2.Claim()
+	s.Require().NoError(err)
+	s.Assert().Equal("b", claim2.Name)
+
+	_, err = worker2.Claim()
+	s.Assert().Equal(ErrNothingToClaim, err)
+
+	_, err = worker2.ClaimFile("a")
+	s.Assert().ErrorIs(err, filelock.ErrLockHeld)
+}
+
+// TestReleaseAndDone tests that released files can be claimed again and done files are removed
+func (s *SpoolTestSuite) TestReleaseAndDone() {
+	s.writeFiles("job")
+	sp, err := Open(s.tempDir)
+	s.Require().NoError(err)
+
+	claim, err := sp.Claim()
+	s.Require().NoError(err)
+	s.Require().NoError(claim.Release())
+
+	claim, err = sp.Claim()
+	s.Require().NoError(err)
+	s.Require().NoError(claim.Done())
+
+	_, err = os.Stat(claim.Path)
+	s.Assert().True(os.IsNotExist(err))
+	_, err = sp.Claim()
+	s.Assert().Equal(ErrNothingToClaim, err)
+}
+
+// TestMoveTo tests moving a claimed file out of the spool
+func (s *SpoolTestSuite) TestMoveTo() {
+	s.writeFiles("job")
+	processed := filepath.Join(s.tempDir, ".processed")
+	s.Require().NoError(os.Mkdir(processed, 0777))
+
+	sp, err := Open(s.tempDir)
+	s.Require().NoError(err)
+	claim, err := sp.Claim()
+	s.Require().NoError(err)
+	s.Require().NoError(claim.MoveTo(processed))
+
+	data, err := os.ReadFile(filepath.Join(processed, "job"))
+	s.Require().NoError(err)
+	s.Assert().Equal("job", string(data))
+}
+
+// TestCustomClaimsDir tests keeping claims outside of the spool
+func (s *SpoolTestSuite) TestCustomClaimsDir() {
+	s.writeFiles("job")
+	claimsDir := s.T().TempDir()
+
+	sp, err := Open(s.tempDir, WithClaimsDir(claimsDir))
+	s.Require().NoError(err)
+	claim, err := sp.Claim()
+	s.Require().NoError(err)
+	defer claim.Release()
+
+	_, err = os.Stat(filepath.Join(claimsDir, "job.lock"))
+	s.Assert().NoError(err)
+	_, err = os.Stat(filepath.Join(s.tempDir, DefaultClaimsDir))
+	s.Assert().True(os.IsNotExist(err))
+}
+
+// TestConcurrentWorkers tests that concurrent workers process each file once
+func (s *SpoolTestSuite) TestConcurrentWorkers() {
+	const numFiles = 30
+	for i := 0; i < numFiles; i++ {
+		s.writeFiles(fmt.Sprintf("job-%02d", i))
+	}
+
+	var (
+		mutex sync.Mutex
+		seen  = make(map[string]int)
+		wg    sync.WaitGroup
+	)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sp, err := Open(s.tempDir)
+			s.Assert().NoError(err)
+			for {
+				claim, err := sp.Claim()
+				if err == ErrNothingToClaim {
+					return
+				}
+				if !s.Assert().NoError(err) {
+					return
+				}
+				mutex.Lock()
+				seen[claim.Name]++
+				mutex.Unlock()
+				s.Assert().NoError(claim.Done())
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.Assert().Len(seen, numFiles)
+	for name, count := range seen {
+		s.Assert().Equal(1, count, name)
+	}
+}
+
+// TestSpool runs the test suite
+func TestSpool(t *testing.T) {
+	suite.Run(t, new(SpoolTestSuite))
+}
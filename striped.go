@@ -0,0 +1,50 @@
+package fs
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// Stripes maps arbitrary keys to a fixed set of lock files, see Striped
+type Stripes struct {
+	dir  string
+	n    int
+	opts []filelock.Option
+}
+
+// Striped returns the n lock stripes of lockDir, for workloads locking many distinct
+// keys: each key is mapped by hash to one of the lock files stripe-0.lock to
+// stripe-<n-1>.lock, bounding the number of lock files and descriptors. Keys sharing
+// a stripe exclude each other, so n trades the number of files for contention.
+// lockDir must exist. Striped panics if n is not positive.
+func Striped(lockDir string, n int, opts ...filelock.Option) *Stripes {
+	if n <= 0 {
+		panic(fmt.Sprintf("fs: Striped with %d stripes, need at least 1", n))
+	}
+	return &Stripes{dir: lockDir, n: n, opts: opts}
+}
+
+// Index returns the stripe of key, from 0 to Len()-1
+func (s *Stripes) Index(key string) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum64() % uint64(s.n))
+}
+
+// Path returns the lock file of the stripe of key
+func (s *Stripes) Path(key string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("stripe-%d.lock", s.Index(key)))
+}
+
+// Lock returns a new lock on the stripe of key, not acquired yet
+func (s *Stripes) Lock(key string) filelock.FileLock {
+	return New(s.Path(key), s.opts...)
+}
+
+// Len returns the number of stripes
+func (s *Stripes) Len() int {
+	return s.n
+}
@@ -0,0 +1,76 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// StripedTestSuite defines a test suite for Striped
+type StripedTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary lock directory before each test
+func (s *StripedTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "striped-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *StripedTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestBoundedFiles tests that any number of keys maps to at most n lock files
+func (s *StripedTestSuite) TestBoundedFiles() {
+	stripes := Striped(s.tempDir, 4)
+	s.Assert().Equal(4, stripes.Len())
+
+	used := make(map[int]bool)
+	for i := range 1000 {
+		key := fmt.Sprintf("user-%d", i)
+		index := stripes.Index(key)
+		s.Require().GreaterOrEqual(index, 0)
+		s.Require().Less(index, 4)
+		s.Require().Equal(index, stripes.Index(key), "the mapping is stable")
+		used[index] = true
+
+		lock := stripes.Lock(key)
+		s.Require().NoError(lock.Lock())
+		s.Require().NoError(lock.Unlock())
+	}
+	s.Assert().Len(used, 4, "keys are spread over every stripe")
+
+	entries, err := os.ReadDir(s.tempDir)
+	s.Require().NoError(err)
+	s.Assert().Len(entries, 4)
+}
+
+// TestSameStripeExcludes tests that keys sharing a stripe exclude each other
+func (s *StripedTestSuite) TestSameStripeExcludes() {
+	stripes := Striped(s.tempDir, 1)
+	s.Assert().Equal(filepath.Join(s.tempDir, "stripe-0.lock"), stripes.Path("a"))
+
+	lock := stripes.Lock("a")
+	s.Require().NoError(lock.Lock())
+	defer lock.Unlock()
+	s.Assert().Equal(filelock.ErrLockHeld, stripes.Lock("b").Lock())
+}
+
+// TestInvalidCount tests that Striped refuses a non-positive number of stripes
+func (s *StripedTestSuite) TestInvalidCount() {
+	s.Assert().Panics(func() { Striped(s.tempDir, 0) })
+}
+
+// TestStriped runs the test suite
+func TestStriped(t *testing.T) {
+	suite.Run(t, new(StripedTestSuite))
+}
@@ -0,0 +1,308 @@
+// Package tempfiles creates temporary files and directories that are cleaned up
+// even when the process creating them crashes.
+//
+// A Manager creates its temporary files under a namespace directory, in a
+// directory of its own, and registers them in a manifest shared by the managers
+// of the namespace and updated under its lock. Each Manager holds a lock on its
+// owner lock file while it is open, which the system releases when the process
+// dies: the next Manager opened in the namespace, or Cleanup, finds the owners
+// whose lock is free and removes their leftovers.
+package tempfiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/uniqfile"
+)
+
+// ManifestName is the name of the manifest file in the namespace directory
+const ManifestName = "manifest.json"
+
+// ownerLockSuffix is appended to the owner directory path to get its lock file
+const ownerLockSuffix = ".owner" + fs.LockSuffix
+
+// ErrClosed is returned when using a closed Manager
+var ErrClosed = errors.New("temp file manager is closed")
+
+// Manifest lists the owners of a namespace and their temporary files
+type Manifest struct {
+	Owners map[string]Owner `json:"owners"`
+}
+
+// Owner is a Manager registered in the manifest
+type Owner struct {
+	Holder    filelock.Holder `json:"holder"`
+	StartedAt time.Time       `json:"started_at"`
+	Paths     []string        `json:"paths"`
+}
+
+// options configures a Manager or a Cleanup
+type options struct {
+	root string
+}
+
+// Option configures a Manager or a Cleanup
+type Option func(*options)
+
+// WithRoot keeps the namespace directories in root instead of os.TempDir()
+func WithRoot(root string) Option {
+	return func(o *options) {
+		o.root = root
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{root: os.TempDir()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Manager creates and tracks the temporary files of a process in a namespace
+type Manager struct {
+	dir   string // namespace directory
+	id    string
+	owned string // directory of the temporary files of the Manager
+	lock  filelock.FileLock
+
+	mutex  sync.Mutex
+	closed bool
+}
+
+// New opens a Manager in namespace, creating the namespace directory if needed,
+// after cleaning up the leftovers of the crashed managers of the namespace
+func New(namespace string, opts ...Option) (*Manager, error) {
+	o := newOptions(opts)
+	dir := filepath.Join(o.root, namespace)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	if _, err := cleanup(dir); err != nil {
+		return nil, err
+	}
+
+	id := uniqfile.Name()
+	m := &Manager{dir: dir, id: id, owned: filepath.Join(dir, id)}
+	m.lock = fs.New(m.owned + ownerLockSuffix)
+	if err := m.lock.Lock(); err != nil {
+		return nil, err
+	}
+
+	err := m.update(func(manifest *Manifest) error {
+		manifest.Owners[id] = Owner{Holder: filelock.CurrentHolder(), StartedAt: time.Now()}
+		return os.Mkdir(m.owned, 0700)
+	})
+	if err != nil {
+		_ = m.lock.Unlock()
+		_ = os.Remove(m.owned + ownerLockSuffix)
+		return nil, err
+	}
+	return m, nil
+}
+
+// Dir returns the directory holding the temporary files of the Manager
+func (m *Manager) Dir() string {
+	return m.owned
+}
+
+// CreateTemp creates a temporary file like os.CreateTemp, in the directory of the Manager
+func (m *Manager) CreateTemp(pattern string) (*os.File, error) {
+	var file *os.File
+	err := m.create(func() (string, error) {
+		var err error
+		file, err = os.CreateTemp(m.owned, pattern)
+		if err != nil {
+			return "", err
+		}
+		return file.Name(), nil
+	})
+	return file, err
+}
+
+// MkdirTemp creates a temporary directory like os.MkdirTemp, in the directory of the Manager
+func (m *Manager) MkdirTemp(pattern string) (string, error) {
+	var dir string
+	err := m.create(func() (string, error) {
+		var err error
+		dir, err = os.MkdirTemp(m.owned, pattern)
+		return dir, err
+	})
+	return dir, err
+}
+
+// create registers the path created by fn in the manifest. The path is created
+// under the manifest lock, so it is registered even if the process crashes right
+// after, and it is removed with the directory of the Manager anyway.
+func (m *Manager) create(fn func() (string, error)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	return m.update(func(manifest *Manifest) error {
+		path, err := fn()
+		if err != nil {
+			return err
+		}
+		owner := manifest.Owners[m.id]
+		owner.Paths = append(owner.Paths, path)
+		manifest.Owners[m.id] = owner
+		return nil
+	})
+}
+
+// Remove removes a temporary file or directory created by the Manager, and
+// unregisters it
+func (m *Manager) Remove(path string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+
+	return m.update(func(manifest *Manifest) error {
+		owner := manifest.Owners[m.id]
+		i := slices.Index(owner.Paths, path)
+		if i < 0 {
+			return fmt.Errorf("%s: %w", path, os.ErrNotExist)
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		owner.Paths = slices.Delete(owner.Paths, i, i+1)
+		manifest.Owners[m.id] = owner
+		return nil
+	})
+}
+
+// Paths returns the temporary files and directories of the Manager, in creation order
+func (m *Manager) Paths() ([]string, error) {
+	manifest, err := ReadManifest(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Owners[m.id].Paths, nil
+}
+
+// Close removes the temporary files and directories of the Manager and unregisters it
+func (m *Manager) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.closed = true
+
+	err := m.update(func(manifest *Manifest) error {
+		if err := os.RemoveAll(m.owned); err != nil {
+			return err
+		}
+		delete(manifest.Owners, m.id)
+		return nil
+	})
+	// Remove the owner lock file while holding the lock where possible (Unix)
+	removeErr := os.Remove(m.owned + ownerLockSuffix)
+	unlockErr := m.lock.Unlock()
+	if removeErr != nil {
+		removeErr = os.Remove(m.owned + ownerLockSuffix)
+	}
+	if errors.Is(removeErr, os.ErrNotExist) {
+		removeErr = nil
+	}
+	return errors.Join(err, unlockErr, removeErr)
+}
+
+// update modifies the manifest of the Manager namespace
+func (m *Manager) update(fn func(*Manifest) error) error {
+	return updateManifest(m.dir, fn)
+}
+
+// Cleanup removes the leftovers of the crashed managers of namespace and returns
+// the removed temporary files and directories. It is called by New.
+func Cleanup(namespace string, opts ...Option) ([]string, error) {
+	o := newOptions(opts)
+	return cleanup(filepath.Join(o.root, namespace))
+}
+
+// cleanup removes the leftovers of the owners of the namespace directory dir whose
+// owner lock is free
+func cleanup(dir string) ([]string, error) {
+	var removed []string
+	err := updateManifest(dir, func(manifest *Manifest) error {
+		var errs []error
+		for id, owner := range manifest.Owners {
+			owned := filepath.Join(dir, id)
+			lock := fs.New(owned + ownerLockSuffix)
+			if err := lock.Lock(); err != nil {
+				if !errors.Is(err, filelock.ErrLockHeld) {
+					errs = append(errs, err)
+				}
+				continue
+			}
+
+			err := os.RemoveAll(owned)
+			_ = os.Remove(owned + ownerLockSuffix)
+			_ = lock.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			delete(manifest.Owners, id)
+			removed = append(removed, owner.Paths...)
+		}
+		return errors.Join(errs...)
+	})
+	return removed, err
+}
+
+// ReadManifest reads the manifest of the namespace directory dir, under its lock
+func ReadManifest(dir string) (Manifest, error) {
+	data, err := fs.ReadFileShared(filepath.Join(dir, ManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Manifest{Owners: map[string]Owner{}}, nil
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+	return decodeManifest(data)
+}
+
+// updateManifest modifies the manifest of the namespace directory dir under its lock
+// The manifest is written even if fn fails, to record the changes it made.
+func updateManifest(dir string, fn func(*Manifest) error) error {
+	var fnErr error
+	err := fs.Update(filepath.Join(dir, ManifestName), fs.DefaultTimeout, func(old []byte) ([]byte, error) {
+		manifest, err := decodeManifest(old)
+		if err != nil {
+			return nil, err
+		}
+		fnErr = fn(&manifest)
+		return json.MarshalIndent(manifest, "", "  ")
+	})
+	return errors.Join(fnErr, err)
+}
+
+func decodeManifest(data []byte) (Manifest, error) {
+	manifest := Manifest{Owners: map[string]Owner{}}
+	if len(data) == 0 {
+		return manifest, nil
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("corrupt temp file manifest: %w", err)
+	}
+	if manifest.Owners == nil {
+		manifest.Owners = map[string]Owner{}
+	}
+	return manifest, nil
+}
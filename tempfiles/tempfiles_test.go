@@ -0,0 +1,107 @@
+package tempfiles
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// TempFilesTestSuite defines a test suite for the temp file manager
+type TempFilesTestSuite struct {
+	suite.Suite
+	root string
+}
+
+// SetupTest creates a temporary root directory before each test
+func (s *TempFilesTestSuite) SetupTest() {
+	root, err := os.MkdirTemp("", "tempfiles-test")
+	s.Require().NoError(err)
+	s.root = root
+}
+
+// TearDownTest removes the temporary root directory after each test
+func (s *TempFilesTestSuite) TearDownTest() {
+	os.RemoveAll(s.root)
+}
+
+func (s *TempFilesTestSuite) newManager() *Manager {
+	m, err := New("app", WithRoot(s.root))
+	s.Require().NoError(err)
+	return m
+}
+
+// TestCreateAndClose tests that the temporary files are registered and removed by Close
+func (s *TempFilesTestSuite) TestCreateAndClose() {
+	m := s.newManager()
+	file, err := m.CreateTemp("data-*.tmp")
+	s.Require().NoError(err)
+	s.Require().NoError(file.Close())
+	dir, err := m.MkdirTemp("work-*")
+	s.Require().NoError(err)
+
+	paths, err := m.Paths()
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{file.Name(), dir}, paths)
+
+	s.Require().NoError(m.Remove(dir))
+	s.Assert().NoDirExists(dir)
+	s.Assert().ErrorIs(m.Remove(dir), os.ErrNotExist)
+
+	s.Require().NoError(m.Close())
+	s.Assert().NoFileExists(file.Name())
+	s.Assert().NoDirExists(m.Dir())
+	s.Assert().Equal(ErrClosed, m.Close())
+	_, err = m.CreateTemp("")
+	s.Assert().Equal(ErrClosed, err)
+
+	manifest, err := ReadManifest(m.dir)
+	s.Require().NoError(err)
+	s.Assert().Empty(manifest.Owners)
+}
+
+// TestCrashedLeftoversAreRemoved tests that the files of a crashed manager are removed
+// by the next one, while the files of live managers are kept
+func (s *TempFilesTestSuite) TestCrashedLeftoversAreRemoved() {
+	crashed := s.newManager()
+	leftover, err := crashed.CreateTemp("")
+	s.Require().NoError(err)
+	s.Require().NoError(leftover.Close())
+
+	live := s.newManager()
+	kept, err := live.MkdirTemp("")
+	s.Require().NoError(err)
+
+	// The system releases the owner lock of a dead process
+	s.Require().NoError(crashed.lock.Unlock())
+
+	removed, err := Cleanup("app", WithRoot(s.root))
+	s.Require().NoError(err)
+	s.Assert().Equal([]string{leftover.Name()}, removed)
+	s.Assert().NoFileExists(leftover.Name())
+	s.Assert().NoDirExists(crashed.Dir())
+	s.Assert().DirExists(kept)
+
+	manifest, err := ReadManifest(live.dir)
+	s.Require().NoError(err)
+	s.Assert().Len(manifest.Owners, 1)
+	s.Assert().Contains(manifest.Owners, live.id)
+	s.Require().NoError(live.Close())
+}
+
+// TestNewCleansUp tests that opening a manager cleans up the crashed ones
+func (s *TempFilesTestSuite) TestNewCleansUp() {
+	crashed := s.newManager()
+	leftover, err := crashed.MkdirTemp("")
+	s.Require().NoError(err)
+	s.Require().NoError(crashed.lock.Unlock())
+
+	m := s.newManager()
+	defer m.Close()
+	s.Assert().NoDirExists(leftover)
+}
+
+// TestTempFiles runs the test suite
+func TestTempFiles(t *testing.T) {
+	suite.Run(t, new(TempFilesTestSuite))
+}
@@ -0,0 +1,126 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// DefaultTreeLockDir is the name of the directory holding the lock files of a
+// TreeLocker, created inside its root
+const DefaultTreeLockDir = ".treelock"
+
+// TreeLocker locks the nodes of a path tree with intention locking: locking a
+// node exclusively first takes intent locks on all of its ancestors. Locking
+// /data/a/b therefore conflicts with locking /data or /data/a (the whole tree or
+// subtree) but not with locking /data/a/c.
+//
+// Intent locks are shared locks and node locks exclusive locks on per-node lock
+// files, mirroring the tree in a separate lock directory. They are taken from the
+// root down, so concurrent tree locks do not deadlock.
+type TreeLocker struct {
+	root    string
+	lockDir string
+}
+
+// TreeOption configures a TreeLocker
+type TreeOption func(*TreeLocker)
+
+// WithTreeLockDir keeps the lock files in dir instead of DefaultTreeLockDir inside
+// the root, for example when the tree is read-only. All the processes locking a
+// tree must use the same lock directory.
+func WithTreeLockDir(dir string) TreeOption {
+	return func(t *TreeLocker) {
+		t.lockDir = dir
+	}
+}
+
+// NewTreeLocker creates a TreeLocker for the tree rooted at root
+func NewTreeLocker(root string, opts ...TreeOption) *TreeLocker {
+	t := &TreeLocker{
+		root:    filepath.Clean(root),
+		lockDir: filepath.Join(root, DefaultTreeLockDir),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Root returns the root of the tree
+func (t *TreeLocker) Root() string {
+	return t.root
+}
+
+// Lock exclusively locks the node at path and takes intent locks on its ancestors,
+// all within timeout. The path is either relative to the root or an absolute path
+// inside it, and the root itself (".") locks the whole tree. The node does not
+// need to exist. On failure the locks already acquired are released.
+func (t *TreeLocker) Lock(path string, timeout time.Duration) (*MultiLock, error) {
+	deadline := time.Now().Add(timeout)
+
+	rel, err := t.rel(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MultiLock{paths: []string{filepath.Join(t.root, rel)}}
+	nodes := ancestors(rel)
+	for i, node := range nodes {
+		var opts []filelock.Option
+		if i < len(nodes)-1 {
+			opts = append(opts, filelock.WithShared())
+		}
+
+		lockPath := t.lockPath(node)
+		lock := New(lockPath, opts...)
+		err := os.MkdirAll(filepath.Dir(lockPath), 0777)
+		if err == nil {
+			err = lock.LockWithTimeout(max(time.Until(deadline), 0))
+		}
+		if err != nil {
+			_ = m.Unlock()
+			return nil, err
+		}
+		m.locks = append(m.locks, lock)
+	}
+	return m, nil
+}
+
+// rel returns path relative to the root, rejecting paths outside the tree
+func (t *TreeLocker) rel(path string) (string, error) {
+	rel := filepath.Clean(path)
+	if filepath.IsAbs(path) {
+		var err error
+		if rel, err = filepath.Rel(t.root, path); err != nil {
+			return "", err
+		}
+	}
+	if rel != "." && !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("path %s is outside of the tree %s", path, t.root)
+	}
+	return rel, nil
+}
+
+// lockPath returns the path of the lock file of a node
+func (t *TreeLocker) lockPath(node string) string {
+	return filepath.Join(t.lockDir, node, LockSuffix)
+}
+
+// ancestors returns the nodes from the root down to rel, included
+func ancestors(rel string) []string {
+	nodes := []string{"."}
+	if rel == "." {
+		return nodes
+	}
+
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i := range parts {
+		nodes = append(nodes, filepath.Join(parts[:i+1]...))
+	}
+	return nodes
+}
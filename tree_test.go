@@ -0,0 +1,91 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// TreeTestSuite defines a test suite for hierarchical tree locks
+type TreeTestSuite struct {
+	suite.Suite
+	tempDir string
+	tree    *TreeLocker
+}
+
+// SetupTest creates a temporary directory and a tree locker before each test
+func (s *TreeTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "tree-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.tree = NewTreeLocker(tempDir)
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *TreeTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestSiblingsDoNotConflict tests that leaves of the same subtree can be locked together
+func (s *TreeTestSuite) TestSiblingsDoNotConflict() {
+	first, err := s.tree.Lock("a/b", 0)
+	s.Require().NoError(err)
+	defer first.Unlock()
+
+	second, err := s.tree.Lock(filepath.Join(s.tempDir, "a", "c"), 0)
+	s.Require().NoError(err)
+	defer second.Unlock()
+
+	s.Assert().Equal([]string{filepath.Join(s.tempDir, "a", "c")}, second.Paths())
+}
+
+// TestAncestorConflicts tests that locking a node conflicts with locking its ancestors
+func (s *TreeTestSuite) TestAncestorConflicts() {
+	leaf, err := s.tree.Lock("a/b", 0)
+	s.Require().NoError(err)
+
+	for _, node := range []string{".", "a", "a/b"} {
+		_, err := s.tree.Lock(node, 0)
+		s.Assert().ErrorIs(err, filelock.ErrLockHeld, node)
+	}
+	s.Require().NoError(leaf.Unlock())
+
+	whole, err := s.tree.Lock(".", 0)
+	s.Require().NoError(err)
+	_, err = s.tree.Lock("x/y/z", 0)
+	s.Assert().ErrorIs(err, filelock.ErrLockHeld)
+	s.Require().NoError(whole.Unlock())
+}
+
+// TestFailureReleasesIntentLocks tests that a failed lock releases its intent locks
+func (s *TreeTestSuite) TestFailureReleasesIntentLocks() {
+	leaf, err := s.tree.Lock("a/b", 0)
+	s.Require().NoError(err)
+
+	_, err = s.tree.Lock("a/b", 20*time.Millisecond)
+	s.Require().ErrorIs(err, filelock.ErrTimeout)
+	s.Require().NoError(leaf.Unlock())
+
+	whole, err := s.tree.Lock(".", 0)
+	s.Require().NoError(err)
+	s.Require().NoError(whole.Unlock())
+}
+
+// TestOutsideOfTree tests that paths outside of the tree are rejected
+func (s *TreeTestSuite) TestOutsideOfTree() {
+	_, err := s.tree.Lock("../other", 0)
+	s.Assert().Error(err)
+
+	_, err = s.tree.Lock(filepath.Dir(s.tempDir), 0)
+	s.Assert().Error(err)
+}
+
+// TestTreeLocker runs the test suite
+func TestTreeLocker(t *testing.T) {
+	suite.Run(t, new(TreeTestSuite))
+}
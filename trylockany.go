@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"errors"
+	"math/rand/v2"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// AnyOption configures TryLockAny
+type AnyOption func(*anyOptions)
+
+type anyOptions struct {
+	random   bool
+	lockOpts []filelock.Option
+}
+
+// WithRandomOrder makes TryLockAny try the candidates in a random order, spreading
+// concurrent callers over the slots instead of having them all contend for the first
+func WithRandomOrder() AnyOption {
+	return func(o *anyOptions) {
+		o.random = true
+	}
+}
+
+// WithLockOptions creates the candidate locks with opts
+func WithLockOptions(opts ...filelock.Option) AnyOption {
+	return func(o *anyOptions) {
+		o.lockOpts = append(o.lockOpts, opts...)
+	}
+}
+
+// TryLockAny tries to lock each of the lock files at paths without waiting, in order,
+// and returns the first lock acquired with its index in paths, for worker slot
+// allocation like "any of worker-0.lock to worker-7.lock".
+// It returns filelock.ErrLockHeld if every candidate is held by someone else, or
+// the errors of the candidates that failed otherwise, joined, with an index of -1.
+func TryLockAny(paths []string, opts ...AnyOption) (filelock.FileLock, int, error) {
+	var o anyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	order := make([]int, len(paths))
+	for i := range order {
+		order[i] = i
+	}
+	if o.random {
+		rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+
+	var errs []error
+	for _, i := range order {
+		lock := New(paths[i], o.lockOpts...)
+		err := lock.Lock()
+		if err == nil {
+			return lock, i, nil
+		}
+		if !errors.Is(err, filelock.ErrLockHeld) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, -1, errors.Join(errs...)
+	}
+	return nil, -1, filelock.ErrLockHeld
+}
@@ -0,0 +1,94 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// TryLockAnyTestSuite defines a test suite for TryLockAny
+type TryLockAnyTestSuite struct {
+	suite.Suite
+	tempDir string
+	paths   []string
+}
+
+// SetupTest creates a temporary directory with slot lock paths before each test
+func (s *TryLockAnyTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "trylockany-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+
+	s.paths = nil
+	for i := range 3 {
+		s.paths = append(s.paths, filepath.Join(tempDir, fmt.Sprintf("worker-%d.lock", i)))
+	}
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *TryLockAnyTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestInOrder tests that the first free slot is returned
+func (s *TryLockAnyTestSuite) TestInOrder() {
+	var locks []filelock.FileLock
+	for want := range s.paths {
+		lock, i, err := TryLockAny(s.paths)
+		s.Require().NoError(err)
+		s.Assert().Equal(want, i)
+		s.Assert().Equal(s.paths[i], lock.Path())
+		s.Assert().True(lock.IsLocked())
+		locks = append(locks, lock)
+	}
+
+	lock, i, err := TryLockAny(s.paths)
+	s.Assert().Equal(filelock.ErrLockHeld, err)
+	s.Assert().Nil(lock)
+	s.Assert().Equal(-1, i)
+
+	s.Require().NoError(locks[1].Unlock())
+	lock, i, err = TryLockAny(s.paths)
+	s.Require().NoError(err)
+	s.Assert().Equal(1, i)
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestRandomOrder tests that every slot is eventually handed out in random order
+func (s *TryLockAnyTestSuite) TestRandomOrder() {
+	seen := make(map[int]bool)
+	for range 100 {
+		lock, i, err := TryLockAny(s.paths, WithRandomOrder())
+		s.Require().NoError(err)
+		seen[i] = true
+		s.Require().NoError(lock.Unlock())
+	}
+	s.Assert().Len(seen, len(s.paths))
+}
+
+// TestErrors tests that failures other than contention are reported
+func (s *TryLockAnyTestSuite) TestErrors() {
+	missing := filepath.Join(s.tempDir, "missing", "worker.lock")
+	_, i, err := TryLockAny([]string{missing})
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+	s.Assert().Equal(-1, i)
+
+	lock, i, err := TryLockAny([]string{missing, s.paths[0]}, WithLockOptions(filelock.WithShared()))
+	s.Require().NoError(err)
+	s.Assert().Equal(1, i)
+	s.Assert().True(lock.Status().Shared)
+	s.Require().NoError(lock.Unlock())
+
+	_, _, err = TryLockAny(nil)
+	s.Assert().Equal(filelock.ErrLockHeld, err)
+}
+
+// TestTryLockAny runs the test suite
+func TestTryLockAny(t *testing.T) {
+	suite.Run(t, new(TryLockAnyTestSuite))
+}
@@ -0,0 +1,552 @@
+// Package txn changes several files of a directory as a single transaction.
+//
+// A transaction locks its files when it begins, stages their new content in a
+// private directory, and on Commit renames every staged file over its target.
+// A journal written before the first rename makes the commit recoverable: if
+// the process dies half-way, the next Open or Begin on the directory finishes
+// the renames, so other processes observe either none or all of the changes
+// once they hold the locks. Transactions that die before committing are rolled
+// back by the same recovery.
+//
+// Files are locked with the same sidecar lock files as fs.Update, so both can be
+// used on the same files while no commit is interrupted. fs.Update does not
+// recover interrupted commits: the journal records the size and modification
+// time of the targets, and recovery refuses to overwrite a target changed since
+// the interruption, reporting ErrModified. Open or Recover the store after a
+// crash, before changing its files otherwise. The staging area is the hidden
+// ".txn" directory of the store, which keeps renames on a single file system.
+package txn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gofs "github.com/rsgcata/go-fs"
+	"github.com/rsgcata/go-fs/atomicfile"
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/internal/dirsync"
+	"github.com/rsgcata/go-fs/uniqfile"
+)
+
+// StagingDir is the name of the staging directory created inside the store
+const StagingDir = ".txn"
+
+// DefaultTimeout is how long Open and Recover wait for the locks of an interrupted commit
+const DefaultTimeout = 10 * time.Second
+
+const journalName = "journal"
+
+var (
+	// ErrDone is returned when using a transaction that was committed or rolled back
+	ErrDone = errors.New("transaction is already committed or rolled back")
+
+	// ErrNotInTx is returned when accessing a file that was not locked by Begin
+	ErrNotInTx = errors.New("file is not part of the transaction")
+
+	// ErrInvalidName is returned for names outside the store or inside its staging directory
+	ErrInvalidName = errors.New("invalid file name")
+
+	// ErrModified is the cause of the RecoveryError of an interrupted commit whose
+	// remaining targets were changed since, for example by fs.Update. Nothing more
+	// of the commit is applied: the newer content is kept, and the transaction is
+	// left in the staging directory until it is removed.
+	ErrModified = errors.New("files changed since the transaction was interrupted")
+)
+
+// RecoveryError describes an interrupted transaction that could not be recovered
+type RecoveryError struct {
+	// Dir is the staging directory of the transaction
+	Dir string
+
+	// Names are the files changed by the transaction, nil if its journal cannot
+	// be read
+	Names []string
+
+	// Err is why the transaction could not be recovered
+	Err error
+}
+
+func (e *RecoveryError) Error() string {
+	return fmt.Sprintf("recovering transaction %s: %v", e.Dir, e.Err)
+}
+
+// Unwrap returns the cause of the failure
+func (e *RecoveryError) Unwrap() error {
+	return e.Err
+}
+
+// Store is a directory whose files are changed by transactions
+type Store struct {
+	dir     string
+	staging string
+}
+
+// Open opens the store rooted at dir, creating its staging directory if needed,
+// and recovers the transactions interrupted by a crash
+func Open(dir string) (*Store, error) {
+	s := &Store{dir: dir, staging: filepath.Join(dir, StagingDir)}
+	if err := os.MkdirAll(s.staging, 0777); err != nil {
+		return nil, err
+	}
+	if err := s.recoverAll(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the path of the named file of the store
+func (s *Store) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// Recover finishes the interrupted commits and rolls back the interrupted
+// transactions of every process. Transactions still in progress are left alone.
+// The transactions that cannot be recovered are reported by *RecoveryError
+// errors, joined.
+func (s *Store) Recover() error {
+	return s.recoverAll()
+}
+
+// recoverAll recovers every interrupted transaction, waiting up to DefaultTimeout
+// for their files
+func (s *Store) recoverAll() error {
+	failures, err := s.recover(time.Now().Add(DefaultTimeout), nil)
+	errs := []error{err}
+	for _, failure := range failures {
+		errs = append(errs, failure)
+	}
+	return errors.Join(errs...)
+}
+
+// Begin starts a transaction on the named files, waiting up to timeout to lock all
+// of them. Names are relative to the store and the files do not need to exist;
+// missing parent directories are created.
+// Files are locked in sorted order, so transactions on overlapping files do not
+// deadlock.
+// The interrupted transactions are recovered first, within timeout for the ones
+// that changed the named files, which Begin fails with their *RecoveryError if
+// they cannot be recovered. The others are recovered only if their files are not
+// locked, and are otherwise left to a later recovery, see Recover.
+func (s *Store) Begin(timeout time.Duration, names ...string) (*Tx, error) {
+	deadline := time.Now().Add(timeout)
+
+	names, err := normalize(names)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := s.recover(deadline, names)
+	if err != nil {
+		return nil, err
+	}
+	for _, failure := range failures {
+		if overlap(failure.Names, names) {
+			return nil, failure
+		}
+	}
+
+	tx := &Tx{
+		store:  s,
+		id:     uniqfile.Name(),
+		locks:  make(map[string]filelock.FileLock, len(names)),
+		staged: make(map[string]*op, len(names)),
+	}
+	tx.dir = filepath.Join(s.staging, tx.id)
+
+	tx.lock = gofs.New(tx.dir + gofs.LockSuffix)
+	if err := tx.lock.LockWithTimeout(0); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(tx.dir, 0777); err != nil {
+		tx.release()
+		return nil, err
+	}
+
+	for _, name := range names {
+		lock := gofs.New(gofs.LockPath(s.Path(name)))
+		err := os.MkdirAll(filepath.Dir(s.Path(name)), 0777)
+		if err == nil {
+			err = lock.LockWithTimeout(max(time.Until(deadline), 0))
+		}
+		if err != nil {
+			_ = os.RemoveAll(tx.dir)
+			tx.release()
+			return nil, err
+		}
+		tx.locks[name] = lock
+		tx.names = append(tx.names, name)
+	}
+	return tx, nil
+}
+
+// Tx is a transaction on a set of locked files. It is not safe for concurrent use.
+type Tx struct {
+	store  *Store
+	id     string
+	dir    string
+	lock   filelock.FileLock
+	names  []string
+	locks  map[string]filelock.FileLock
+	staged map[string]*op
+	seq    int
+	done   bool
+}
+
+// op is the staged change of a file, as recorded in the journal
+type op struct {
+	Name   string `json:"name"`
+	Staged string `json:"staged,omitempty"`
+	Remove bool   `json:"remove,omitempty"`
+
+	// Before is the target when the journal was written, nil in older journals
+	Before *stamp `json:"before,omitempty"`
+}
+
+// stamp tells whether a target changed, by its size and modification time
+type stamp struct {
+	Exists  bool      `json:"exists"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// stampOf returns the stamp of the file at path
+func stampOf(path string) (*stamp, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return &stamp{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stamp{Exists: true, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// equal reports whether s and other stamp the same content
+func (s *stamp) equal(other *stamp) bool {
+	return s.Exists == other.Exists && s.Size == other.Size && s.ModTime.Equal(other.ModTime)
+}
+
+type journal struct {
+	Ops []*op `json:"ops"`
+}
+
+// ReadFile returns the content of the named file as seen by the transaction,
+// including its staged changes
+func (tx *Tx) ReadFile(name string) ([]byte, error) {
+	name, change, err := tx.change(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case change == nil:
+		return os.ReadFile(tx.store.Path(name))
+	case change.Remove:
+		return nil, &fs.PathError{Op: "open", Path: tx.store.Path(name), Err: fs.ErrNotExist}
+	default:
+		return os.ReadFile(filepath.Join(tx.dir, change.Staged))
+	}
+}
+
+// WriteFile stages data as the new content of the named file, with the permission
+// bits perm regardless of the umask. The file is only changed by Commit.
+func (tx *Tx) WriteFile(name string, data []byte, perm os.FileMode) error {
+	name, _, err := tx.change(name)
+	if err != nil {
+		return err
+	}
+
+	tx.seq++
+	staged := strconv.Itoa(tx.seq)
+	if err := writeSynced(filepath.Join(tx.dir, staged), data, perm); err != nil {
+		return err
+	}
+	tx.discard(name)
+	tx.staged[name] = &op{Name: name, Staged: staged}
+	return nil
+}
+
+// Remove stages the removal of the named file. Removing a missing file is not an error.
+func (tx *Tx) Remove(name string) error {
+	name, _, err := tx.change(name)
+	if err != nil {
+		return err
+	}
+	tx.discard(name)
+	tx.staged[name] = &op{Name: name, Remove: true}
+	return nil
+}
+
+// Commit applies the staged changes and releases the locks
+// Once the journal is written, the changes are applied even if the process dies.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrDone
+	}
+	tx.done = true
+	defer tx.release()
+
+	var err error
+	var j journal
+	for _, name := range tx.names {
+		if change, ok := tx.staged[name]; ok {
+			if change.Before, err = stampOf(tx.store.Path(name)); err != nil {
+				_ = os.RemoveAll(tx.dir)
+				return err
+			}
+			j.Ops = append(j.Ops, change)
+		}
+	}
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(filepath.Join(tx.dir, journalName), data, 0644); err != nil {
+		_ = os.RemoveAll(tx.dir)
+		return err
+	}
+	return tx.store.apply(tx.dir, j)
+}
+
+// Rollback discards the staged changes and releases the locks
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrDone
+	}
+	tx.done = true
+	defer tx.release()
+
+	return os.RemoveAll(tx.dir)
+}
+
+// change returns the cleaned name and the staged change of name, nil if it has none
+func (tx *Tx) change(name string) (string, *op, error) {
+	clean := filepath.Clean(name)
+	if tx.done {
+		return clean, nil, ErrDone
+	}
+	if _, ok := tx.locks[clean]; !ok {
+		return clean, nil, fmt.Errorf("%w: %s", ErrNotInTx, name)
+	}
+	return clean, tx.staged[clean], nil
+}
+
+// discard removes the staged content of name, if any
+func (tx *Tx) discard(name string) {
+	if change, ok := tx.staged[name]; ok && change.Staged != "" {
+		_ = os.Remove(filepath.Join(tx.dir, change.Staged))
+	}
+}
+
+// release unlocks the files and the transaction itself
+func (tx *Tx) release() {
+	for i := len(tx.names) - 1; i >= 0; i-- {
+		_ = tx.locks[tx.names[i]].Unlock()
+	}
+	_ = os.Remove(tx.lock.Path())
+	_ = tx.lock.Unlock()
+}
+
+// apply renames the staged files of j over their targets and removes the transaction directory
+func (s *Store) apply(dir string, j journal) error {
+	dirs := make(map[string]bool)
+	for _, change := range j.Ops {
+		target := s.Path(change.Name)
+		dirs[filepath.Dir(target)] = true
+
+		if change.Remove {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		// A missing staged file was already renamed before the interruption
+		staged := filepath.Join(dir, change.Staged)
+		if _, err := os.Lstat(staged); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Rename(staged, target); err != nil {
+			return err
+		}
+	}
+
+	for d := range dirs {
+		if err := dirsync.Sync(d); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+// recover finishes or rolls back the transactions of dead processes. The ones
+// that changed one of names, or every one if names is nil, wait until deadline
+// for their files, the others do not wait. It returns the transactions that
+// could not be recovered, and an error if the staging directory cannot be read.
+func (s *Store) recover(deadline time.Time, names []string) ([]*RecoveryError, error) {
+	entries, err := os.ReadDir(s.staging)
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []*RecoveryError
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if failure := s.recoverOne(filepath.Join(s.staging, entry.Name()), deadline, names); failure != nil {
+			failures = append(failures, failure)
+		}
+	}
+	return failures, nil
+}
+
+func (s *Store) recoverOne(dir string, deadline time.Time, names []string) *RecoveryError {
+	lock := gofs.New(dir + gofs.LockSuffix)
+	if err := lock.LockWithTimeout(0); err != nil {
+		if errors.Is(err, filelock.ErrLockHeld) {
+			// The transaction is still in progress
+			return nil
+		}
+		return &RecoveryError{Dir: dir, Err: err}
+	}
+	defer func() {
+		_ = os.Remove(lock.Path())
+		_ = lock.Unlock()
+	}()
+
+	data, err := os.ReadFile(filepath.Join(dir, journalName))
+	if os.IsNotExist(err) {
+		// Interrupted before the commit, or already finished meanwhile
+		if err := os.RemoveAll(dir); err != nil {
+			return &RecoveryError{Dir: dir, Err: err}
+		}
+		return nil
+	}
+	if err != nil {
+		return &RecoveryError{Dir: dir, Err: err}
+	}
+
+	var j journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return &RecoveryError{Dir: dir, Err: fmt.Errorf("corrupt journal: %w", err)}
+	}
+	failure := &RecoveryError{Dir: dir}
+	for _, change := range j.Ops {
+		failure.Names = append(failure.Names, change.Name)
+	}
+
+	var timeout time.Duration
+	if names == nil || overlap(failure.Names, names) {
+		timeout = max(time.Until(deadline), 0)
+	}
+	var locks []filelock.FileLock
+	defer func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			_ = locks[i].Unlock()
+		}
+	}()
+	for _, change := range j.Ops {
+		lock := gofs.New(gofs.LockPath(s.Path(change.Name)))
+		if failure.Err = lock.LockWithTimeout(timeout); failure.Err != nil {
+			return failure
+		}
+		locks = append(locks, lock)
+	}
+	if failure.Err = s.checkUnchanged(dir, j); failure.Err != nil {
+		return failure
+	}
+	if failure.Err = s.apply(dir, j); failure.Err != nil {
+		return failure
+	}
+	return nil
+}
+
+// checkUnchanged returns an error wrapping ErrModified if a target of j still to
+// be replaced or removed changed since the journal was written
+func (s *Store) checkUnchanged(dir string, j journal) error {
+	var modified []string
+	for _, change := range j.Ops {
+		if change.Before == nil {
+			continue
+		}
+		if !change.Remove {
+			// A missing staged file was already renamed before the interruption
+			if _, err := os.Lstat(filepath.Join(dir, change.Staged)); os.IsNotExist(err) {
+				continue
+			}
+		}
+		current, err := stampOf(s.Path(change.Name))
+		if err != nil {
+			return err
+		}
+		if change.Remove && !current.Exists {
+			// Removed before the interruption, or missing anyway
+			continue
+		}
+		if !current.equal(change.Before) {
+			modified = append(modified, change.Name)
+		}
+	}
+	if len(modified) > 0 {
+		return fmt.Errorf("%w: %s", ErrModified, strings.Join(modified, ", "))
+	}
+	return nil
+}
+
+// overlap reports whether a and b have a name in common
+func overlap(a, b []string) bool {
+	for _, name := range a {
+		if slices.Contains(b, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize validates, cleans, sorts and deduplicates names
+func normalize(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	var out []string
+	for _, name := range names {
+		clean := filepath.Clean(name)
+		if !filepath.IsLocal(clean) || clean == StagingDir ||
+			strings.HasPrefix(clean, StagingDir+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidName, name)
+		}
+		if !seen[clean] {
+			seen[clean] = true
+			out = append(out, clean)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// writeSynced creates the file at path with data flushed to stable storage
+func writeSynced(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
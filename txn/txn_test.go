@@ -0,0 +1,334 @@
+package txn
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	gofs "github.com/rsgcata/go-fs"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// TxnTestSuite defines a test suite for file transactions
+type TxnTestSuite struct {
+	suite.Suite
+	tempDir string
+	store   *Store
+}
+
+// SetupTest creates a store in a temporary directory before each test
+func (s *TxnTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "txn-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+
+	s.store, err = Open(tempDir)
+	s.Require().NoError(err)
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *TxnTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+func (s *TxnTestSuite) readFile(name string) string {
+	data, err := os.ReadFile(s.store.Path(name))
+	s.Require().NoError(err)
+	return string(data)
+}
+
+func (s *TxnTestSuite) stagingEntries() []os.DirEntry {
+	entries, err := os.ReadDir(filepath.Join(s.tempDir, StagingDir))
+	s.Require().NoError(err)
+	return entries
+}
+
+// TestCommit tests that every staged change is applied on commit
+func (s *TxnTestSuite) TestCommit() {
+	s.Require().NoError(os.WriteFile(s.store.Path("old"), []byte("x"), 0644))
+
+	tx, err := s.store.Begin(time.Second, "a", "dir/b", "old")
+	s.Require().NoError(err)
+	s.Require().NoError(tx.WriteFile("a", []byte("A"), 0600))
+	s.Require().NoError(tx.WriteFile("dir/b", []byte("B"), 0644))
+	s.Require().NoError(tx.Remove("old"))
+
+	s.Assert().NoFileExists(s.store.Path("a"))
+
+	s.Require().NoError(tx.Commit())
+	s.Assert().Equal("A", s.readFile("a"))
+	s.Assert().Equal("B", s.readFile("dir/b"))
+	s.Assert().NoFileExists(s.store.Path("old"))
+	s.Assert().Empty(s.stagingEntries())
+
+	info, err := os.Stat(s.store.Path("a"))
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0600), info.Mode().Perm())
+
+	s.Assert().ErrorIs(tx.Commit(), ErrDone)
+}
+
+// TestRollback tests that staged changes are discarded on rollback
+func (s *TxnTestSuite) TestRollback() {
+	s.Require().NoError(os.WriteFile(s.store.Path("a"), []byte("old"), 0644))
+
+	tx, err := s.store.Begin(time.Second, "a")
+	s.Require().NoError(err)
+	s.Require().NoError(tx.WriteFile("a", []byte("new"), 0644))
+	s.Require().NoError(tx.Rollback())
+
+	s.Assert().Equal("old", s.readFile("a"))
+	s.Assert().Empty(s.stagingEntries())
+	s.Assert().ErrorIs(tx.Rollback(), ErrDone)
+}
+
+// TestReadYourWrites tests that reads within a transaction see its staged changes
+func (s *TxnTestSuite) TestReadYourWrites() {
+	s.Require().NoError(os.WriteFile(s.store.Path("a"), []byte("old"), 0644))
+
+	tx, err := s.store.Begin(time.Second, "a")
+	s.Require().NoError(err)
+	defer tx.Rollback()
+
+	data, err := tx.ReadFile("a")
+	s.Require().NoError(err)
+	s.Assert().Equal("old", string(data))
+
+	s.Require().NoError(tx.WriteFile("a", []byte("first"), 0644))
+	s.Require().NoError(tx.WriteFile("./a", []byte("second"), 0644))
+	data, err = tx.ReadFile("a")
+	s.Require().NoError(err)
+	s.Assert().Equal("second", string(data))
+
+	s.Require().NoError(tx.Remove("a"))
+	_, err = tx.ReadFile("a")
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+}
+
+// TestNames tests that only the locked files of the store can be changed
+func (s *TxnTestSuite) TestNames() {
+	for _, name := range []string{"../escape", "/abs", StagingDir, filepath.Join(StagingDir, "x")} {
+		_, err := s.store.Begin(time.Second, name)
+		s.Assert().ErrorIs(err, ErrInvalidName, name)
+	}
+
+	tx, err := s.store.Begin(time.Second, "a")
+	s.Require().NoError(err)
+	defer tx.Rollback()
+	s.Assert().ErrorIs(tx.WriteFile("b", nil, 0644), ErrNotInTx)
+}
+
+// TestBeginTimeout tests that Begin waits for files locked by another transaction
+func (s *TxnTestSuite) TestBeginTimeout() {
+	tx, err := s.store.Begin(time.Second, "a", "b")
+	s.Require().NoError(err)
+	defer tx.Rollback()
+
+	_, err = s.store.Begin(50*time.Millisecond, "b", "c")
+	s.Require().Error(err)
+	s.Assert().Len(s.stagingEntries(), 2, "only the running transaction and its lock file")
+}
+
+// TestRecoverInterruptedCommit tests that a commit interrupted after its journal is finished
+func (s *TxnTestSuite) TestRecoverInterruptedCommit() {
+	s.Require().NoError(os.WriteFile(s.store.Path("a"), []byte("old"), 0644))
+	s.Require().NoError(os.WriteFile(s.store.Path("gone"), []byte("old"), 0644))
+
+	// Staging directory of a process that died after renaming "b" but before "a"
+	dir := filepath.Join(s.tempDir, StagingDir, "dead")
+	s.Require().NoError(os.Mkdir(dir, 0777))
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "1"), []byte("new"), 0644))
+	s.Require().NoError(os.WriteFile(s.store.Path("b"), []byte("new"), 0644))
+	data, err := json.Marshal(journal{Ops: []*op{
+		{Name: "a", Staged: "1"},
+		{Name: "b", Staged: "2"},
+		{Name: "gone", Remove: true},
+	}})
+	s.Require().NoError(err)
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, journalName), data, 0644))
+
+	_, err = Open(s.tempDir)
+	s.Require().NoError(err)
+
+	s.Assert().Equal("new", s.readFile("a"))
+	s.Assert().Equal("new", s.readFile("b"))
+	s.Assert().NoFileExists(s.store.Path("gone"))
+	s.Assert().Empty(s.stagingEntries())
+}
+
+// TestRecoverModifiedTarget tests that the recovery of a commit does not overwrite
+// a target changed since the interruption
+func (s *TxnTestSuite) TestRecoverModifiedTarget() {
+	s.Require().NoError(os.WriteFile(s.store.Path("a"), []byte("old"), 0644))
+	s.Require().NoError(os.WriteFile(s.store.Path("b"), []byte("old"), 0644))
+	before := func(name string) *stamp {
+		st, err := stampOf(s.store.Path(name))
+		s.Require().NoError(err)
+		return st
+	}
+
+	// A process died after renaming "b" but before "a", then "a" was updated
+	dir := filepath.Join(s.tempDir, StagingDir, "dead")
+	s.Require().NoError(os.Mkdir(dir, 0777))
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "1"), []byte("new"), 0644))
+	data, err := json.Marshal(journal{Ops: []*op{
+		{Name: "a", Staged: "1", Before: before("a")},
+		{Name: "b", Staged: "2", Before: before("b")},
+	}})
+	s.Require().NoError(err)
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, journalName), data, 0644))
+	s.Require().NoError(os.WriteFile(s.store.Path("b"), []byte("new"), 0644))
+	s.Require().NoError(gofs.Update(s.store.Path("a"), time.Second, func([]byte) ([]byte, error) {
+		return []byte("updated"), nil
+	}))
+
+	_, err = Open(s.tempDir)
+	var recoveryErr *RecoveryError
+	s.Require().ErrorAs(err, &recoveryErr)
+	s.Assert().ErrorIs(err, ErrModified)
+	s.Assert().Equal(dir, recoveryErr.Dir)
+	s.Assert().Equal("updated", s.readFile("a"))
+	s.Assert().Len(s.stagingEntries(), 1)
+
+	_, err = s.store.Begin(time.Second, "a")
+	s.Assert().ErrorIs(err, ErrModified)
+
+	s.Require().NoError(os.RemoveAll(dir))
+	tx, err := s.store.Begin(time.Second, "a")
+	s.Require().NoError(err)
+	s.Require().NoError(tx.Rollback())
+}
+
+// TestCommitStampsTargets tests that the journal records the targets as they were
+// before the commit
+func (s *TxnTestSuite) TestCommitStampsTargets() {
+	s.Require().NoError(os.WriteFile(s.store.Path("a"), []byte("old"), 0644))
+	tx, err := s.store.Begin(time.Second, "a", "b")
+	s.Require().NoError(err)
+	s.Require().NoError(tx.WriteFile("a", []byte("new"), 0644))
+	s.Require().NoError(tx.Remove("b"))
+	st, err := stampOf(s.store.Path("a"))
+	s.Require().NoError(err)
+	s.Require().NoError(tx.Commit())
+
+	s.Assert().Equal(st, tx.staged["a"].Before)
+	s.Assert().True(tx.staged["a"].Before.Exists)
+	s.Assert().Equal(&stamp{}, tx.staged["b"].Before)
+}
+
+// TestRecoverUncommitted tests that a transaction that died before committing is rolled back
+func (s *TxnTestSuite) TestRecoverUncommitted() {
+	dir := filepath.Join(s.tempDir, StagingDir, "dead")
+	s.Require().NoError(os.Mkdir(dir, 0777))
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "1"), []byte("new"), 0644))
+
+	s.Require().NoError(s.store.Recover())
+	s.Assert().Empty(s.stagingEntries())
+	s.Assert().NoFileExists(s.store.Path("a"))
+}
+
+// TestRecoverLeavesRunningTransactions tests that recovery does not touch live transactions
+func (s *TxnTestSuite) TestRecoverLeavesRunningTransactions() {
+	tx, err := s.store.Begin(time.Second, "a")
+	s.Require().NoError(err)
+	s.Require().NoError(tx.WriteFile("a", []byte("A"), 0644))
+
+	s.Require().NoError(s.store.Recover())
+	s.Require().NoError(tx.Commit())
+	s.Assert().Equal("A", s.readFile("a"))
+}
+
+// TestBeginSkipsUnrelatedRecovery tests that Begin is not failed nor delayed by
+// the interrupted transactions that did not change its files
+func (s *TxnTestSuite) TestBeginSkipsUnrelatedRecovery() {
+	corrupt := filepath.Join(s.tempDir, StagingDir, "corrupt")
+	s.Require().NoError(os.Mkdir(corrupt, 0777))
+	s.Require().NoError(os.WriteFile(filepath.Join(corrupt, journalName), []byte("{"), 0644))
+
+	// A commit of "x" interrupted while "x" is locked by a live process
+	dead := filepath.Join(s.tempDir, StagingDir, "dead")
+	s.Require().NoError(os.Mkdir(dead, 0777))
+	s.Require().NoError(os.WriteFile(filepath.Join(dead, "1"), []byte("new"), 0644))
+	data, err := json.Marshal(journal{Ops: []*op{{Name: "x", Staged: "1"}}})
+	s.Require().NoError(err)
+	s.Require().NoError(os.WriteFile(filepath.Join(dead, journalName), data, 0644))
+	holder := gofs.New(gofs.LockPath(s.store.Path("x")))
+	s.Require().NoError(holder.Lock())
+
+	start := time.Now()
+	tx, err := s.store.Begin(time.Second, "a")
+	s.Require().NoError(err)
+	s.Assert().Less(time.Since(start), 500*time.Millisecond, "unrelated transactions are not waited for")
+	s.Require().NoError(tx.Rollback())
+
+	start = time.Now()
+	_, err = s.store.Begin(100*time.Millisecond, "x")
+	var recoveryErr *RecoveryError
+	s.Require().ErrorAs(err, &recoveryErr)
+	s.Assert().Equal(dead, recoveryErr.Dir)
+	s.Assert().Equal([]string{"x"}, recoveryErr.Names)
+	s.Assert().Less(time.Since(start), 500*time.Millisecond, "recovery waits within the timeout of Begin")
+
+	s.Require().NoError(holder.Unlock())
+	tx, err = s.store.Begin(time.Second, "x")
+	s.Require().NoError(err)
+	content, err := tx.ReadFile("x")
+	s.Require().NoError(err)
+	s.Assert().Equal("new", string(content))
+	s.Require().NoError(tx.Rollback())
+
+	err = s.store.Recover()
+	s.Require().ErrorAs(err, &recoveryErr)
+	s.Assert().Equal(corrupt, recoveryErr.Dir)
+	s.Assert().Contains(err.Error(), "corrupt journal")
+}
+
+// TestConcurrentTransfers tests that concurrent transactions keep two files consistent
+func (s *TxnTestSuite) TestConcurrentTransfers() {
+	const numWorkers, numTransfers, total = 4, 20, 1000
+	s.Require().NoError(os.WriteFile(s.store.Path("from"), []byte(strconv.Itoa(total)), 0644))
+	s.Require().NoError(os.WriteFile(s.store.Path("to"), []byte("0"), 0644))
+
+	read := func(tx *Tx, name string) int {
+		data, err := tx.ReadFile(name)
+		s.Require().NoError(err)
+		n, err := strconv.Atoi(string(data))
+		s.Require().NoError(err)
+		return n
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store, err := Open(s.tempDir)
+			s.Assert().NoError(err)
+			for i := 0; i < numTransfers; i++ {
+				tx, err := store.Begin(10*time.Second, "to", "from")
+				if !s.Assert().NoError(err) {
+					return
+				}
+				from, to := read(tx, "from"), read(tx, "to")
+				s.Assert().Equal(total, from+to)
+				s.Assert().NoError(tx.WriteFile("from", []byte(strconv.Itoa(from-1)), 0644))
+				s.Assert().NoError(tx.WriteFile("to", []byte(strconv.Itoa(to+1)), 0644))
+				s.Assert().NoError(tx.Commit())
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.Assert().Equal(strconv.Itoa(total-numWorkers*numTransfers), s.readFile("from"))
+	s.Assert().Equal(strconv.Itoa(numWorkers*numTransfers), s.readFile("to"))
+}
+
+// TestTxn runs the test suite
+func TestTxn(t *testing.T) {
+	suite.Run(t, new(TxnTestSuite))
+}
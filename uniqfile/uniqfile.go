@@ -0,0 +1,86 @@
+// Package uniqfile generates collision-free file names and creates files with
+// them atomically, for artifacts created concurrently by several processes and
+// hosts in a shared directory.
+//
+// Names follow the Maildir convention, time.MusecPpidQcounter.hostname, for
+// example "1736942400.M000123P4242Q0000000001.myhost". The seconds, the
+// zero-padded microseconds and the zero-padded counter make names created by a
+// process sort in creation order, including within the same microsecond.
+package uniqfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxCreateAttempts bounds the retries of Create when a name is already taken
+const maxCreateAttempts = 100
+
+var counter atomic.Uint64
+
+// hostnameEscaper escapes the characters that cannot appear in a Maildir host
+// name, plus "~" which callers may use as a separator after the name
+var hostnameEscaper = strings.NewReplacer(`/`, `\057`, `:`, `\072`, `~`, `\176`)
+
+var hostname = sync.OnceValue(func() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		name = "localhost"
+	}
+	return hostnameEscaper.Replace(name)
+})
+
+// Name returns a new unique file name
+func Name() string {
+	return format(time.Now())
+}
+
+func format(t time.Time) string {
+	return fmt.Sprintf(
+		"%d.M%06dP%dQ%010d.%s",
+		t.Unix(), t.Nanosecond()/1000, os.Getpid(), counter.Add(1), hostname(),
+	)
+}
+
+// Time returns the creation time encoded in a name generated by Name, with
+// microsecond precision
+func Time(name string) (time.Time, bool) {
+	secs, rest, ok := strings.Cut(name, ".M")
+	if !ok || len(rest) < 6 {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	usec, err := strconv.ParseInt(rest[:6], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, usec*1000), true
+}
+
+// Create creates a new file with a unique name in dir, opened for writing
+// The file is created with O_EXCL, so an existing file is never reused
+func Create(dir string, perm os.FileMode) (*os.File, error) {
+	var err error
+	for attempt := 0; attempt < maxCreateAttempts; attempt++ {
+		var f *os.File
+		f, err = os.OpenFile(
+			filepath.Join(dir, Name()),
+			os.O_CREATE|os.O_EXCL|os.O_WRONLY,
+			perm,
+		)
+		if !errors.Is(err, os.ErrExist) {
+			return f, err
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,105 @@
+package uniqfile
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// UniqFileTestSuite defines a test suite for the unique names
+type UniqFileTestSuite struct {
+	suite.Suite
+}
+
+// TestNamesAreUnique tests that concurrent calls never return the same name
+func (s *UniqFileTestSuite) TestNamesAreUnique() {
+	var (
+		mutex sync.Mutex
+		names = make(map[string]struct{})
+		wg    sync.WaitGroup
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				name := Name()
+				mutex.Lock()
+				names[name] = struct{}{}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	s.Assert().Len(names, 8000)
+}
+
+// TestNamesSortInCreationOrder tests that successive names sort in creation order
+func (s *UniqFileTestSuite) TestNamesSortInCreationOrder() {
+	var names []string
+	for i := 0; i < 5; i++ {
+		names = append(names, Name())
+		time.Sleep(time.Millisecond)
+	}
+	s.Assert().True(sort.StringsAreSorted(names))
+
+	// Within the same microsecond, across a change of the number of digits of the
+	// counter, which only moves forward to keep the names unique
+	power := uint64(10)
+	for power <= counter.Load()+3 {
+		power *= 10
+	}
+	counter.Store(power - 3)
+	now := time.Now()
+	names = nil
+	for i := 0; i < 5; i++ {
+		names = append(names, format(now))
+	}
+	s.Assert().True(sort.StringsAreSorted(names), names)
+}
+
+// TestTime tests that the creation time can be read back from a name
+func (s *UniqFileTestSuite) TestTime() {
+	now := time.Date(2025, 1, 15, 12, 0, 0, 123456789, time.UTC)
+	name := format(now)
+
+	got, ok := Time(name)
+	s.Require().True(ok)
+	s.Assert().True(got.Equal(now.Truncate(time.Microsecond)))
+
+	_, ok = Time("not-a-unique-name")
+	s.Assert().False(ok)
+}
+
+// TestNameFormat tests the Maildir layout and the escaping of the host name
+func (s *UniqFileTestSuite) TestNameFormat() {
+	s.Assert().Regexp(`^\d+\.M\d{6}P\d+Q\d{10}\..+$`, Name())
+	s.Assert().Equal(`a\057b\072c\176d`, hostnameEscaper.Replace("a/b:c~d"))
+}
+
+// TestCreate tests the exclusive creation of files
+func (s *UniqFileTestSuite) TestCreate() {
+	dir := s.T().TempDir()
+
+	f, err := Create(dir, 0600)
+	s.Require().NoError(err)
+	defer f.Close()
+
+	_, err = f.WriteString("data")
+	s.Require().NoError(err)
+
+	info, err := os.Stat(f.Name())
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0600), info.Mode().Perm())
+	s.Assert().True(strings.HasPrefix(f.Name(), dir))
+}
+
+// TestUniqFile runs the test suite
+func TestUniqFile(t *testing.T) {
+	suite.Run(t, new(UniqFileTestSuite))
+}
@@ -0,0 +1,56 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// LockSuffix is appended to a file path to get the path of the lock file
+// protecting it in the helpers of this package
+const LockSuffix = ".lock"
+
+// defaultPerm is the permission of files created by the helpers of this package
+const defaultPerm os.FileMode = 0644
+
+// LockPath returns the path of the lock file protecting path in the helpers of
+// this package. Files replaced atomically cannot be locked directly, since each
+// replacement creates a new file, so a separate lock file is used instead.
+func LockPath(path string) string {
+	return path + LockSuffix
+}
+
+// Update performs a locked read-modify-write of the file at path.
+// It acquires the lock on LockPath(path) within timeout, reads the current
+// content of the file (nil if it does not exist), calls fn with it, and atomically
+// replaces the file with the returned content. If fn returns an error, the file
+// is left untouched and the error is returned.
+// The file keeps its permissions, new files are created with mode 0644.
+// With WithChecksum, the current content is verified before calling fn.
+func Update(path string, timeout time.Duration, fn func(old []byte) ([]byte, error), opts ...FileOption) error {
+	o := newFileOptions(opts)
+	lock := New(LockPath(path))
+	if err := lock.LockWithTimeout(timeout); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	perm := defaultPerm
+	old, err := readFile(path, o)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		old = nil
+	case err != nil:
+		return err
+	default:
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+	}
+
+	data, err := fn(old)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data, perm, o)
+}
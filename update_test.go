@@ -0,0 +1,281 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/atomicfile"
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// UpdateTestSuite defines a test suite for the locked file helpers
+type UpdateTestSuite struct {
+	suite.Suite
+	tempDir string
+}
+
+// SetupTest creates a temporary directory for test files before each test
+func (s *UpdateTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "fs-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *UpdateTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// increment is an Update callback incrementing a decimal counter
+func increment(old []byte) ([]byte, error) {
+	n := 0
+	if old != nil {
+		var err error
+		if n, err = strconv.Atoi(string(old)); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(strconv.Itoa(n + 1)), nil
+}
+
+// TestUpdateCreatesFile tests that a missing file is seen as nil and created
+func (s *UpdateTestSuite) TestUpdateCreatesFile() {
+	path := filepath.Join(s.tempDir, "counter")
+
+	err := Update(path, time.Second, func(old []byte) ([]byte, error) {
+		s.Assert().Nil(old)
+		return []byte("1"), nil
+	})
+	s.Require().NoError(err)
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("1", string(data))
+}
+
+// TestUpdateCallbackError tests that a failing callback leaves the file untouched
+func (s *UpdateTestSuite) TestUpdateCallbackError() {
+	path := filepath.Join(s.tempDir, "counter")
+	s.Require().NoError(os.WriteFile(path, []byte("41"), 0600))
+
+	failure := errors.New("failure")
+	err := Update(path, time.Second, func([]byte) ([]byte, error) {
+		return []byte("garbage"), failure
+	})
+	s.Require().Equal(failure, err)
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("41", string(data))
+}
+
+// TestUpdateKeepsPermissions tests that the file mode survives the replacement
+func (s *UpdateTestSuite) TestUpdateKeepsPermissions() {
+	path := filepath.Join(s.tempDir, "counter")
+	s.Require().NoError(os.WriteFile(path, []byte("1"), 0600))
+	s.Require().NoError(os.Chmod(path, 0600))
+
+	s.Require().NoError(Update(path, time.Second, increment))
+
+	info, err := os.Stat(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0600), info.Mode().Perm())
+}
+
+// TestConcurrentUpdates tests that concurrent updates never lose an increment
+func (s *UpdateTestSuite) TestConcurrentUpdates() {
+	path := filepath.Join(s.tempDir, "counter")
+	const numGoroutines = 10
+
+	var wg sync.WaitGroup
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Assert().NoError(Update(path, 5*time.Second, increment))
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(strconv.Itoa(numGoroutines), string(data))
+}
+
+// TestReadFileSharedNeverTorn tests that readers never observe an in-place write in progress
+func (s *UpdateTestSuite) TestReadFileSharedNeverTorn() {
+	path := filepath.Join(s.tempDir, "state")
+	s.Require().NoError(os.WriteFile(path, []byte("aaaa"), 0644))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 50 {
+			lock := New(LockPath(path))
+			if !s.Assert().NoError(lock.LockWithTimeout(5 * time.Second)) {
+				return
+			}
+			// Rewrite the file in place in two steps
+			content := strings.Repeat(string(rune('a'+i%2)), 4)
+			file, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if !s.Assert().NoError(err) {
+				return
+			}
+			_, _ = file.WriteAt([]byte(content[:2]), 0)
+			time.Sleep(time.Millisecond)
+			_, _ = file.WriteAt([]byte(content[2:]), 2)
+			s.Assert().NoError(file.Close())
+			s.Assert().NoError(lock.Unlock())
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		data, err := ReadFileShared(path)
+		s.Require().NoError(err)
+		s.Require().Contains([]string{"aaaa", "bbbb"}, string(data))
+	}
+}
+
+// TestCopySnapshot tests that the copy waits for the writer to release the lock
+func (s *UpdateTestSuite) TestCopySnapshot() {
+	path := filepath.Join(s.tempDir, "snapshot")
+	s.Require().NoError(os.WriteFile(path, []byte("old"), 0644))
+
+	writer := New(LockPath(path))
+	s.Require().NoError(writer.Lock())
+	time.AfterFunc(50*time.Millisecond, func() {
+		_ = os.WriteFile(path, []byte("new"), 0644)
+		_ = writer.Unlock()
+	})
+
+	var buf bytes.Buffer
+	n, err := CopySnapshot(&buf, path)
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(3), n)
+	s.Assert().Equal("new", buf.String())
+
+	_, err = CopySnapshot(&buf, filepath.Join(s.tempDir, "missing"))
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+}
+
+// TestReadAndWriteFileLocked tests the locked counterparts of os.ReadFile and os.WriteFile
+func (s *UpdateTestSuite) TestReadAndWriteFileLocked() {
+	path := filepath.Join(s.tempDir, "config")
+
+	s.Require().NoError(WriteFileLocked(path, []byte("v1"), 0600))
+	data, err := ReadFileLocked(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("v1", string(data))
+
+	info, err := os.Stat(path)
+	s.Require().NoError(err)
+	s.Assert().Equal(os.FileMode(0600), info.Mode().Perm())
+
+	_, err = ReadFileLocked(filepath.Join(s.tempDir, "missing"))
+	s.Assert().ErrorIs(err, os.ErrNotExist)
+}
+
+// TestUpdateWithNewLocked tests that the lock file left by Update is the one of
+// atomicfile.NewLocked, which then refuses to replace the file
+func (s *UpdateTestSuite) TestUpdateWithNewLocked() {
+	path := filepath.Join(s.tempDir, "index")
+	s.Require().NoError(Update(path, time.Second, increment))
+
+	_, err := atomicfile.NewLocked(path, 0644)
+	var lockedErr *atomicfile.LockedError
+	s.Require().ErrorAs(err, &lockedErr)
+	s.Assert().Equal(LockPath(path), lockedErr.LockPath)
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("1", string(data))
+}
+
+// TestFileLockedContext tests that the context variants wait for the lock until ctx is done
+func (s *UpdateTestSuite) TestFileLockedContext() {
+	path := filepath.Join(s.tempDir, "config")
+	s.Require().NoError(WriteFileLocked(path, []byte("v1"), 0644))
+
+	reader := New(LockPath(path), filelock.WithShared())
+	s.Require().NoError(reader.Lock())
+
+	data, err := ReadFileLockedContext(context.Background(), path)
+	s.Require().NoError(err, "readers share the lock")
+	s.Assert().Equal("v1", string(data))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = WriteFileLockedContext(ctx, path, []byte("v2"), 0644)
+	s.Assert().ErrorIs(err, context.DeadlineExceeded)
+
+	time.AfterFunc(50*time.Millisecond, func() { _ = reader.Unlock() })
+	s.Require().NoError(WriteFileLockedContext(context.Background(), path, []byte("v2"), 0644))
+	data, err = ReadFileLocked(path)
+	s.Require().NoError(err)
+	s.Assert().Equal("v2", string(data))
+}
+
+// TestChecksum tests that content modified behind the helpers is detected
+func (s *UpdateTestSuite) TestChecksum() {
+	path := filepath.Join(s.tempDir, "ledger")
+
+	s.Require().NoError(WriteFileLocked(path, []byte("balance=10"), 0644, WithChecksum()))
+	sidecar, err := os.ReadFile(ChecksumPath(path))
+	s.Require().NoError(err)
+	s.Assert().True(strings.HasSuffix(string(sidecar), "  ledger\n"))
+
+	s.Require().NoError(Update(path, time.Second, func(old []byte) ([]byte, error) {
+		s.Assert().Equal("balance=10", string(old))
+		return []byte("balance=20"), nil
+	}, WithChecksum()))
+	data, err := ReadFileLocked(path, WithChecksum())
+	s.Require().NoError(err)
+	s.Assert().Equal("balance=20", string(data))
+
+	// A program ignoring the helpers rewrites the file
+	s.Require().NoError(os.WriteFile(path, []byte("balance=99"), 0644))
+	_, err = ReadFileLocked(path, WithChecksum())
+	s.Assert().ErrorIs(err, ErrChecksumMismatch)
+	_, err = CopySnapshot(io.Discard, path, WithChecksum())
+	s.Assert().ErrorIs(err, ErrChecksumMismatch)
+	err = Update(path, time.Second, func(old []byte) ([]byte, error) {
+		s.Fail("fn is not called on a mismatch")
+		return old, nil
+	}, WithChecksum())
+	s.Assert().ErrorIs(err, ErrChecksumMismatch)
+
+	data, err = ReadFileLocked(path)
+	s.Require().NoError(err, "without the option the content is not verified")
+	s.Assert().Equal("balance=99", string(data))
+}
+
+// TestChecksumWithoutSidecar tests that files without a recorded checksum are read as is
+func (s *UpdateTestSuite) TestChecksumWithoutSidecar() {
+	path := filepath.Join(s.tempDir, "legacy")
+	s.Require().NoError(os.WriteFile(path, []byte("v1"), 0644))
+
+	data, err := ReadFileShared(path, WithChecksum())
+	s.Require().NoError(err)
+	s.Assert().Equal("v1", string(data))
+}
+
+// TestUpdate runs the test suite
+func TestUpdate(t *testing.T) {
+	suite.Run(t, new(UpdateTestSuite))
+}
@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"context"
+
+	"github.com/rsgcata/go-fs/watch"
+)
+
+// WaitUntilUnlocked blocks until no process holds the lock on the lock file at path,
+// or ctx is done. It does not acquire the lock, so another process may take it
+// right after WaitUntilUnlocked returns.
+// The release is noticed through the watch package: as soon as the holder closes
+// the lock file on Linux, within watch.DefaultPollInterval otherwise. The lock is
+// probed by taking and releasing it without waiting, see the watch package.
+func WaitUntilUnlocked(ctx context.Context, path string) error {
+	watcher, err := watch.New()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Watch before checking, so a release right after the check is not missed
+	if err := watcher.WatchLock(path); err != nil {
+		return err
+	}
+	if !watch.Locked(path) {
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-watcher.Events():
+			if e.Op&watch.LockReleased != 0 {
+				return nil
+			}
+		case <-watcher.Errors():
+			// Events were dropped, check the lock directly
+			if !watch.Locked(path) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// WaitTestSuite defines a test suite for WaitUntilUnlocked
+type WaitTestSuite struct {
+	suite.Suite
+	tempDir  string
+	lockPath string
+}
+
+// SetupTest creates a temporary directory before each test
+func (s *WaitTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "wait-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.lockPath = filepath.Join(tempDir, "worker.lock")
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *WaitTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// TestReturnsWhenUnlocked tests that free and missing locks do not block
+func (s *WaitTestSuite) TestReturnsWhenUnlocked() {
+	s.Require().NoError(WaitUntilUnlocked(context.Background(), s.lockPath))
+	s.Assert().NoFileExists(s.lockPath)
+
+	lock := New(s.lockPath)
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+	s.Require().NoError(WaitUntilUnlocked(context.Background(), s.lockPath))
+}
+
+// TestWaitsForRelease tests that it returns once every holder released the lock
+func (s *WaitTestSuite) TestWaitsForRelease() {
+	first := New(s.lockPath, filelock.WithShared())
+	second := New(s.lockPath, filelock.WithShared())
+	s.Require().NoError(first.Lock())
+	s.Require().NoError(second.Lock())
+	time.AfterFunc(50*time.Millisecond, func() { _ = first.Unlock() })
+	time.AfterFunc(100*time.Millisecond, func() { _ = second.Unlock() })
+
+	start := time.Now()
+	s.Require().NoError(WaitUntilUnlocked(context.Background(), s.lockPath))
+	s.Assert().GreaterOrEqual(time.Since(start), 100*time.Millisecond)
+	s.Assert().False(second.IsLocked())
+}
+
+// TestKeptOpen tests that the release of a lock whose file is kept open, which
+// is not closed on release, is noticed
+func (s *WaitTestSuite) TestKeptOpen() {
+	lock := New(s.lockPath, filelock.WithKeepOpen())
+	s.Require().NoError(lock.Lock())
+	defer lock.(io.Closer).Close()
+	time.AfterFunc(200*time.Millisecond, func() { _ = lock.Unlock() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	start := time.Now()
+	s.Require().NoError(WaitUntilUnlocked(ctx, s.lockPath))
+	s.Assert().Less(time.Since(start), time.Second)
+	s.Assert().False(lock.IsLocked())
+}
+
+// TestContext tests that it stops waiting when the context is done
+func (s *WaitTestSuite) TestContext() {
+	lock := New(s.lockPath)
+	s.Require().NoError(lock.Lock())
+	defer lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s.Assert().ErrorIs(WaitUntilUnlocked(ctx, s.lockPath), context.DeadlineExceeded)
+	s.Assert().True(lock.IsLocked())
+}
+
+// TestWait runs the test suite
+func TestWait(t *testing.T) {
+	suite.Run(t, new(WaitTestSuite))
+}
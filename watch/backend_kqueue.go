@@ -0,0 +1,263 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// dirNotes selects the changes reported for a watched directory
+const dirNotes = unix.NOTE_WRITE | unix.NOTE_DELETE | unix.NOTE_RENAME
+
+// fileNotes selects the changes reported for a regular file of a watched directory
+const fileNotes = unix.NOTE_WRITE | unix.NOTE_EXTEND | unix.NOTE_ATTRIB | unix.NOTE_DELETE | unix.NOTE_RENAME |
+	closeNotes
+
+// kqueueDir is a directory watched with kqueue
+type kqueueDir struct {
+	fd      int
+	entries map[string]entry
+	files   map[string]int // name -> descriptor of the watched regular files
+}
+
+// kqueueBackend watches directories with kqueue(2). The entries of a directory are
+// listed again when it changes, to find which ones changed, and its regular files
+// are opened to report the changes of their content.
+type kqueueBackend struct {
+	kq    int
+	wake  [2]int // pipe waking up the reader on close
+	emit  func(Event)
+	fail  func(error)
+	mutex sync.Mutex
+	dirs  map[string]*kqueueDir
+	paths map[int]string // descriptor -> watched directory or file
+	done  chan struct{}
+}
+
+func newBackend(emit func(Event), fail func(error), _ time.Duration) (backend, error) {
+	kq, err := unix.Kqueue()
+	if err != nil {
+		return nil, os.NewSyscallError("kqueue", err)
+	}
+	unix.CloseOnExec(kq)
+	b := &kqueueBackend{
+		kq:    kq,
+		emit:  emit,
+		fail:  fail,
+		dirs:  make(map[string]*kqueueDir),
+		paths: make(map[int]string),
+		done:  make(chan struct{}),
+	}
+	if err := unix.Pipe(b.wake[:]); err != nil {
+		_ = unix.Close(kq)
+		return nil, os.NewSyscallError("pipe", err)
+	}
+	unix.CloseOnExec(b.wake[0])
+	unix.CloseOnExec(b.wake[1])
+	if err := b.register(b.wake[0], unix.EVFILT_READ, 0); err != nil {
+		_ = unix.Close(kq)
+		_ = unix.Close(b.wake[0])
+		_ = unix.Close(b.wake[1])
+		return nil, os.NewSyscallError("kevent", err)
+	}
+	go b.read()
+	return b, nil
+}
+
+// register adds the filter for the descriptor fd to the kqueue
+func (b *kqueueBackend) register(fd, filter int, fflags uint32) error {
+	var change [1]unix.Kevent_t
+	unix.SetKevent(&change[0], fd, filter, unix.EV_ADD|unix.EV_CLEAR)
+	change[0].Fflags = fflags
+	_, err := unix.Kevent(b.kq, change[:], nil, nil)
+	return err
+}
+
+func (b *kqueueBackend) addDir(dir string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.dirs[dir]; ok {
+		return nil
+	}
+	fd, err := unix.Open(dir, openFlags|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	if err := b.register(fd, unix.EVFILT_VNODE, dirNotes); err != nil {
+		_ = unix.Close(fd)
+		return &os.PathError{Op: "kevent", Path: dir, Err: err}
+	}
+	d := &kqueueDir{fd: fd, files: make(map[string]int)}
+	b.dirs[dir] = d
+	b.paths[fd] = dir
+	// Listed after registering, so no change is missed
+	b.rescan(dir, d)
+	return nil
+}
+
+func (b *kqueueBackend) removeDir(dir string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if d, ok := b.dirs[dir]; ok {
+		b.drop(dir, d)
+	}
+	return nil
+}
+
+func (b *kqueueBackend) close() error {
+	_, _ = unix.Write(b.wake[1], []byte{0})
+	<-b.done
+
+	b.mutex.Lock()
+	for dir, d := range b.dirs {
+		b.drop(dir, d)
+	}
+	b.mutex.Unlock()
+	err := unix.Close(b.kq)
+	_ = unix.Close(b.wake[0])
+	_ = unix.Close(b.wake[1])
+	return err
+}
+
+func (b *kqueueBackend) reportsClose() bool {
+	return closeNotes != 0
+}
+
+// drop stops watching dir and its files, must be called with mutex held
+func (b *kqueueBackend) drop(dir string, d *kqueueDir) {
+	for name := range d.files {
+		b.unwatchFile(d, name)
+	}
+	delete(b.dirs, dir)
+	delete(b.paths, d.fd)
+	_ = unix.Close(d.fd)
+}
+
+// watchFile watches the regular file name of dir, must be called with mutex held
+// The files which cannot be opened are not watched, the listings of dir still
+// report their changes when the directory changes.
+func (b *kqueueBackend) watchFile(dir string, d *kqueueDir, name string) {
+	path := filepath.Join(dir, name)
+	fd, err := unix.Open(path, openFlags|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return
+	}
+	if err := b.register(fd, unix.EVFILT_VNODE, fileNotes); err != nil {
+		_ = unix.Close(fd)
+		return
+	}
+	d.files[name] = fd
+	b.paths[fd] = path
+}
+
+// unwatchFile stops watching the file name of d, must be called with mutex held
+func (b *kqueueBackend) unwatchFile(d *kqueueDir, name string) {
+	fd := d.files[name]
+	delete(d.files, name)
+	delete(b.paths, fd)
+	_ = unix.Close(fd)
+}
+
+// rescan lists dir again, watches its new regular files and returns the changes
+// since the previous listing, must be called with mutex held
+func (b *kqueueBackend) rescan(dir string, d *kqueueDir) []Event {
+	after, err := list(dir)
+	if err != nil {
+		after = map[string]entry{}
+	}
+	events := diff(dir, d.entries, after)
+	d.entries = after
+
+	for name := range d.files {
+		if e, ok := after[name]; !ok || !e.mode.IsRegular() {
+			b.unwatchFile(d, name)
+		}
+	}
+	for name, e := range after {
+		if _, ok := d.files[name]; !ok && e.mode.IsRegular() {
+			b.watchFile(dir, d, name)
+		}
+	}
+	return events
+}
+
+// read reads and dispatches the events until the backend is closed
+func (b *kqueueBackend) read() {
+	defer close(b.done)
+	buf := make([]unix.Kevent_t, 64)
+
+	for {
+		n, err := unix.Kevent(b.kq, nil, buf, nil)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			b.fail(os.NewSyscallError("kevent", err))
+			return
+		}
+
+		var events []Event
+		for _, kev := range buf[:n] {
+			if int(kev.Ident) == b.wake[0] {
+				return
+			}
+			events = append(events, b.dispatch(int(kev.Ident), kev.Fflags)...)
+		}
+		for _, e := range events {
+			b.emit(e)
+		}
+	}
+}
+
+// dispatch translates the changes fflags of the watched descriptor fd
+func (b *kqueueBackend) dispatch(fd int, fflags uint32) []Event {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	path, ok := b.paths[fd]
+	if !ok {
+		return nil
+	}
+
+	if d, ok := b.dirs[path]; ok && d.fd == fd {
+		if fflags&(unix.NOTE_DELETE|unix.NOTE_RENAME) != 0 {
+			// The directory is gone, report its entries as removed once
+			events := diff(path, d.entries, map[string]entry{})
+			b.drop(path, d)
+			return events
+		}
+		return b.rescan(path, d)
+	}
+
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	d := b.dirs[dir]
+	if fflags&(unix.NOTE_DELETE|unix.NOTE_RENAME) != 0 {
+		// Removed, renamed or replaced: the listing tells which
+		b.unwatchFile(d, name)
+		return b.rescan(dir, d)
+	}
+
+	var op Op
+	if fflags&(unix.NOTE_WRITE|unix.NOTE_EXTEND) != 0 {
+		op |= Write
+	}
+	if fflags&unix.NOTE_ATTRIB != 0 {
+		op |= Chmod
+	}
+	op |= closeOp(fflags)
+	if op&(Write|Chmod) != 0 {
+		// Recorded, so the next listing does not report the change again
+		if info, err := os.Lstat(path); err == nil {
+			d.entries[name] = entry{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+		}
+	}
+	if op == 0 {
+		return nil
+	}
+	return []Event{{Path: path, Op: op}}
+}
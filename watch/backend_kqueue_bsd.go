@@ -0,0 +1,17 @@
+//go:build dragonfly || netbsd || openbsd
+
+package watch
+
+import "golang.org/x/sys/unix"
+
+// openFlags opens the watched directories and files
+const openFlags = unix.O_RDONLY | unix.O_CLOEXEC
+
+// closeNotes selects the closes reported for the watched files, none on these
+// systems
+const closeNotes = 0
+
+// closeOp translates the closes of fflags into changes
+func closeOp(uint32) Op {
+	return 0
+}
@@ -0,0 +1,15 @@
+package watch
+
+import "golang.org/x/sys/unix"
+
+// openFlags opens the watched directories and files for notifications only, so
+// they do not prevent unmounting their volume
+const openFlags = unix.O_EVTONLY | unix.O_CLOEXEC
+
+// closeNotes selects the closes reported for the watched files, none on macOS
+const closeNotes = 0
+
+// closeOp translates the closes of fflags into changes
+func closeOp(uint32) Op {
+	return 0
+}
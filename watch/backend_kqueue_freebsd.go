@@ -0,0 +1,21 @@
+package watch
+
+import "golang.org/x/sys/unix"
+
+// openFlags opens the watched directories and files
+const openFlags = unix.O_RDONLY | unix.O_CLOEXEC
+
+// closeNotes selects the closes reported for the watched files
+const closeNotes = unix.NOTE_CLOSE | unix.NOTE_CLOSE_WRITE
+
+// closeOp translates the closes of fflags into changes
+func closeOp(fflags uint32) Op {
+	var op Op
+	if fflags&unix.NOTE_CLOSE_WRITE != 0 {
+		op |= opClose
+	}
+	if fflags&unix.NOTE_CLOSE != 0 {
+		op |= opCloseRead
+	}
+	return op
+}
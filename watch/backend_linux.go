@@ -0,0 +1,186 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask selects the changes reported for the entries of a watched directory
+const inotifyMask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_MODIFY | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_ATTRIB | unix.IN_CLOSE_WRITE | unix.IN_CLOSE_NOWRITE
+
+// inotifyBackend watches directories with inotify(7)
+type inotifyBackend struct {
+	fd    int
+	wake  [2]int // pipe waking up the reader on close
+	emit  func(Event)
+	fail  func(error)
+	mutex sync.Mutex
+	dirs  map[int]string // watch descriptor -> directory
+	wds   map[string]int // directory -> watch descriptor
+	done  chan struct{}
+}
+
+func newBackend(emit func(Event), fail func(error), _ time.Duration) (backend, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	b := &inotifyBackend{
+		fd:   fd,
+		emit: emit,
+		fail: fail,
+		dirs: make(map[int]string),
+		wds:  make(map[string]int),
+		done: make(chan struct{}),
+	}
+	if err := unix.Pipe2(b.wake[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		_ = unix.Close(fd)
+		return nil, os.NewSyscallError("pipe2", err)
+	}
+	go b.read()
+	return b, nil
+}
+
+func (b *inotifyBackend) addDir(dir string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	wd, err := unix.InotifyAddWatch(b.fd, dir, inotifyMask|unix.IN_ONLYDIR)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	b.dirs[wd] = dir
+	b.wds[dir] = wd
+	return nil
+}
+
+func (b *inotifyBackend) removeDir(dir string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	wd, ok := b.wds[dir]
+	if !ok {
+		return nil
+	}
+	delete(b.wds, dir)
+	delete(b.dirs, wd)
+	_, err := unix.InotifyRmWatch(b.fd, uint32(wd))
+	if err != nil && !errors.Is(err, unix.EINVAL) {
+		// EINVAL means the directory is gone and so is its watch
+		return &os.PathError{Op: "inotify_rm_watch", Path: dir, Err: err}
+	}
+	return nil
+}
+
+func (b *inotifyBackend) close() error {
+	_, _ = unix.Write(b.wake[1], []byte{0})
+	<-b.done
+	err := unix.Close(b.fd)
+	_ = unix.Close(b.wake[0])
+	_ = unix.Close(b.wake[1])
+	return err
+}
+
+func (b *inotifyBackend) reportsClose() bool {
+	return true
+}
+
+// read reads and dispatches the events until the backend is closed
+func (b *inotifyBackend) read() {
+	defer close(b.done)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	fds := []unix.PollFd{
+		{Fd: int32(b.fd), Events: unix.POLLIN},
+		{Fd: int32(b.wake[0]), Events: unix.POLLIN},
+	}
+
+	for {
+		_, err := unix.Poll(fds, -1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			b.fail(os.NewSyscallError("poll", err))
+			return
+		}
+		if fds[1].Revents != 0 {
+			return
+		}
+
+		n, err := unix.Read(b.fd, buf)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			b.fail(os.NewSyscallError("read", err))
+			return
+		}
+		b.dispatch(buf[:n])
+	}
+}
+
+// dispatch parses the events read from inotify
+func (b *inotifyBackend) dispatch(buf []byte) {
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + unix.SizeofInotifyEvent
+		offset = nameStart + int(raw.Len)
+
+		if raw.Mask&unix.IN_Q_OVERFLOW != 0 {
+			b.fail(fmt.Errorf("inotify queue overflow: events were dropped"))
+			continue
+		}
+
+		b.mutex.Lock()
+		dir, ok := b.dirs[int(raw.Wd)]
+		if raw.Mask&unix.IN_IGNORED != 0 {
+			// The directory was removed, so was its watch
+			delete(b.dirs, int(raw.Wd))
+			if b.wds[dir] == int(raw.Wd) {
+				delete(b.wds, dir)
+			}
+		}
+		b.mutex.Unlock()
+		if !ok || raw.Len == 0 {
+			continue
+		}
+
+		name := unix.ByteSliceToString(buf[nameStart:offset])
+		if op := inotifyOp(raw.Mask); op != 0 {
+			b.emit(Event{Path: filepath.Join(dir, name), Op: op})
+		}
+	}
+}
+
+// inotifyOp translates an inotify mask into changes
+func inotifyOp(mask uint32) Op {
+	var op Op
+	if mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		op |= Create
+	}
+	if mask&unix.IN_MODIFY != 0 {
+		op |= Write
+	}
+	if mask&unix.IN_DELETE != 0 {
+		op |= Remove
+	}
+	if mask&unix.IN_MOVED_FROM != 0 {
+		op |= Rename
+	}
+	if mask&unix.IN_ATTRIB != 0 {
+		op |= Chmod
+	}
+	if mask&unix.IN_CLOSE_WRITE != 0 {
+		op |= opClose
+	}
+	if mask&unix.IN_CLOSE_NOWRITE != 0 {
+		op |= opCloseRead
+	}
+	return op
+}
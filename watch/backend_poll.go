@@ -0,0 +1,92 @@
+//go:build !linux && !windows && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package watch
+
+import (
+	"sync"
+	"time"
+)
+
+// pollBackend watches directories by listing them every interval
+type pollBackend struct {
+	emit     func(Event)
+	fail     func(error)
+	interval time.Duration
+	mutex    sync.Mutex
+	dirs     map[string]map[string]entry
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newBackend(emit func(Event), fail func(error), interval time.Duration) (backend, error) {
+	b := &pollBackend{
+		emit:     emit,
+		fail:     fail,
+		interval: interval,
+		dirs:     make(map[string]map[string]entry),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.poll()
+	return b, nil
+}
+
+func (b *pollBackend) addDir(dir string) error {
+	entries, err := list(dir)
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	b.dirs[dir] = entries
+	b.mutex.Unlock()
+	return nil
+}
+
+func (b *pollBackend) removeDir(dir string) error {
+	b.mutex.Lock()
+	delete(b.dirs, dir)
+	b.mutex.Unlock()
+	return nil
+}
+
+func (b *pollBackend) close() error {
+	close(b.stop)
+	<-b.done
+	return nil
+}
+
+func (b *pollBackend) reportsClose() bool {
+	return false
+}
+
+// poll compares the listings of the watched directories every interval
+func (b *pollBackend) poll() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		b.mutex.Lock()
+		var events []Event
+		for dir, before := range b.dirs {
+			after, err := list(dir)
+			if err != nil {
+				// The directory is gone, report its entries as removed once
+				after = map[string]entry{}
+			}
+			events = append(events, diff(dir, before, after)...)
+			b.dirs[dir] = after
+		}
+		b.mutex.Unlock()
+
+		for _, e := range events {
+			b.emit(e)
+		}
+	}
+}
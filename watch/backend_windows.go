@@ -0,0 +1,174 @@
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// notifyFilter selects the changes reported for the entries of a watched directory
+const notifyFilter = windows.FILE_NOTIFY_CHANGE_FILE_NAME | windows.FILE_NOTIFY_CHANGE_DIR_NAME |
+	windows.FILE_NOTIFY_CHANGE_ATTRIBUTES | windows.FILE_NOTIFY_CHANGE_SIZE |
+	windows.FILE_NOTIFY_CHANGE_LAST_WRITE
+
+// dirWatch is a directory watched with ReadDirectoryChangesW
+type dirWatch struct {
+	handle windows.Handle
+	stop   windows.Handle // event stopping the watch
+	done   chan struct{}
+}
+
+// readDirBackend watches directories with ReadDirectoryChangesW
+type readDirBackend struct {
+	emit  func(Event)
+	fail  func(error)
+	mutex sync.Mutex
+	dirs  map[string]*dirWatch
+}
+
+func newBackend(emit func(Event), fail func(error), _ time.Duration) (backend, error) {
+	return &readDirBackend{emit: emit, fail: fail, dirs: make(map[string]*dirWatch)}, nil
+}
+
+func (b *readDirBackend) addDir(dir string) error {
+	name, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return err
+	}
+	handle, err := windows.CreateFile(
+		name,
+		windows.FILE_LIST_DIRECTORY,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OVERLAPPED,
+		0,
+	)
+	if err != nil {
+		return &os.PathError{Op: "CreateFile", Path: dir, Err: err}
+	}
+	stop, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		_ = windows.CloseHandle(handle)
+		return os.NewSyscallError("CreateEvent", err)
+	}
+
+	w := &dirWatch{handle: handle, stop: stop, done: make(chan struct{})}
+	b.mutex.Lock()
+	b.dirs[dir] = w
+	b.mutex.Unlock()
+	go b.read(dir, w)
+	return nil
+}
+
+func (b *readDirBackend) removeDir(dir string) error {
+	b.mutex.Lock()
+	w, ok := b.dirs[dir]
+	delete(b.dirs, dir)
+	b.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	return w.close()
+}
+
+func (b *readDirBackend) close() error {
+	b.mutex.Lock()
+	dirs := b.dirs
+	b.dirs = make(map[string]*dirWatch)
+	b.mutex.Unlock()
+
+	var errs []error
+	for _, w := range dirs {
+		errs = append(errs, w.close())
+	}
+	return errors.Join(errs...)
+}
+
+func (b *readDirBackend) reportsClose() bool {
+	return false
+}
+
+// close stops the reader of the watch and releases its handles
+func (w *dirWatch) close() error {
+	_ = windows.SetEvent(w.stop)
+	<-w.done
+	err := windows.CloseHandle(w.handle)
+	_ = windows.CloseHandle(w.stop)
+	return err
+}
+
+// read reads and dispatches the changes of dir until the watch is closed
+func (b *readDirBackend) read(dir string, w *dirWatch) {
+	defer close(w.done)
+	ready, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		b.fail(os.NewSyscallError("CreateEvent", err))
+		return
+	}
+	defer windows.CloseHandle(ready)
+
+	// The buffer must be DWORD-aligned
+	buf := make([]uint32, 16*1024)
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&buf[0])), len(buf)*4)
+	for {
+		overlapped := windows.Overlapped{HEvent: ready}
+		err := windows.ReadDirectoryChanges(w.handle, &raw[0], uint32(len(raw)), false, notifyFilter, nil, &overlapped, 0)
+		if err != nil {
+			b.fail(&os.PathError{Op: "ReadDirectoryChanges", Path: dir, Err: err})
+			return
+		}
+
+		event, err := windows.WaitForMultipleObjects([]windows.Handle{ready, w.stop}, false, windows.INFINITE)
+		if err != nil || event != windows.WAIT_OBJECT_0 {
+			_ = windows.CancelIoEx(w.handle, &overlapped)
+			var n uint32
+			_ = windows.GetOverlappedResult(w.handle, &overlapped, &n, true)
+			return
+		}
+
+		var n uint32
+		if err := windows.GetOverlappedResult(w.handle, &overlapped, &n, false); err != nil {
+			b.fail(&os.PathError{Op: "ReadDirectoryChanges", Path: dir, Err: err})
+			return
+		}
+		if n == 0 {
+			b.fail(&os.PathError{Op: "ReadDirectoryChanges", Path: dir, Err: errors.New("buffer overflow: events were dropped")})
+			continue
+		}
+		b.dispatch(dir, raw[:n])
+	}
+}
+
+// dispatch parses the FILE_NOTIFY_INFORMATION records read for dir
+func (b *readDirBackend) dispatch(dir string, buf []byte) {
+	for offset := uint32(0); ; {
+		info := (*windows.FileNotifyInformation)(unsafe.Pointer(&buf[offset]))
+		name := windows.UTF16ToString(unsafe.Slice(&info.FileName, info.FileNameLength/2))
+
+		var op Op
+		switch info.Action {
+		case windows.FILE_ACTION_ADDED, windows.FILE_ACTION_RENAMED_NEW_NAME:
+			op = Create
+		case windows.FILE_ACTION_REMOVED:
+			op = Remove
+		case windows.FILE_ACTION_MODIFIED:
+			op = Write
+		case windows.FILE_ACTION_RENAMED_OLD_NAME:
+			op = Rename
+		}
+		if op != 0 {
+			b.emit(Event{Path: filepath.Join(dir, name), Op: op})
+		}
+
+		if info.NextEntryOffset == 0 {
+			return
+		}
+		offset += info.NextEntryOffset
+	}
+}
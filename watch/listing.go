@@ -0,0 +1,59 @@
+//go:build !linux && !windows
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// entry is the state of a directory entry compared between polls
+type entry struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+}
+
+// list returns the state of the entries of dir
+func list(dir string) (map[string]entry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]entry, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		entries[dirEntry.Name()] = entry{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+	}
+	return entries, nil
+}
+
+// diff returns the changes between two listings of dir
+func diff(dir string, before, after map[string]entry) []Event {
+	var events []Event
+	for name, old := range before {
+		current, ok := after[name]
+		var op Op
+		switch {
+		case !ok:
+			op = Remove
+		case current.size != old.size || !current.modTime.Equal(old.modTime):
+			op = Write
+		case current.mode != old.mode:
+			op = Chmod
+		}
+		if op != 0 {
+			events = append(events, Event{Path: filepath.Join(dir, name), Op: op})
+		}
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			events = append(events, Event{Path: filepath.Join(dir, name), Op: Create})
+		}
+	}
+	return events
+}
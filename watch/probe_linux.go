@@ -0,0 +1,49 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// procLocks lists the file locks of the system
+const procLocks = "/proc/locks"
+
+// probe reports whether the lock file at path is locked by anyone, and whether it
+// was opened to probe it. The locks are looked up in /proc/locks, without opening
+// the file, which is probed like on the other systems only if /proc/locks cannot
+// be read.
+func probe(path string) (held, opened bool) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		// No file, no lock
+		return false, false
+	}
+	held, err := flocked(&stat)
+	if err != nil {
+		return flockProbe(path)
+	}
+	return held, false
+}
+
+// flocked reports whether /proc/locks lists a flock(2) lock held on the file of stat
+func flocked(stat *unix.Stat_t) (bool, error) {
+	data, err := os.ReadFile(procLocks)
+	if err != nil {
+		return false, err
+	}
+
+	// The locks are listed as "1: FLOCK  ADVISORY  WRITE 1234 fe:00:9617622 0 EOF",
+	// the file being identified by the major and minor of its device in hex and its
+	// inode. The waiters are listed as "1: -> FLOCK ...".
+	id := fmt.Sprintf("%02x:%02x:%d", unix.Major(uint64(stat.Dev)), unix.Minor(uint64(stat.Dev)), stat.Ino)
+	for line := range strings.Lines(string(data)) {
+		fields := strings.Fields(line)
+		if len(fields) >= 6 && fields[1] == "FLOCK" && fields[5] == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package watch
+
+// probe reports whether the lock file at path is locked by anyone, and whether it
+// was opened to probe it
+func probe(path string) (held, opened bool) {
+	return flockProbe(path)
+}
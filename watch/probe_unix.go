@@ -0,0 +1,26 @@
+//go:build !windows
+
+package watch
+
+import (
+	"os"
+	"syscall"
+)
+
+// flockProbe reports whether the lock file at path is locked by anyone, and whether
+// it was opened to probe it. The file is opened read-only and locked exclusively
+// without blocking, which fails if anyone holds a lock.
+func flockProbe(path string) (held, opened bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		// No file, no lock. Unreadable files are not watched for release.
+		return false, false
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return err == syscall.EWOULDBLOCK || err == syscall.EAGAIN, true
+	}
+	_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	return false, true
+}
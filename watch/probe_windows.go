@@ -0,0 +1,25 @@
+package watch
+
+import (
+	"errors"
+	"os"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/windows"
+)
+
+// probe reports whether the lock file at path is locked by anyone, and whether it
+// was opened to probe it
+func probe(path string) (held, opened bool) {
+	if _, err := os.Stat(path); err != nil {
+		// No file, no lock
+		return false, false
+	}
+	lock := windows.New(path)
+	if err := lock.Lock(); err != nil {
+		// Unlockable files are not watched for release
+		return errors.Is(err, filelock.ErrLockHeld), true
+	}
+	_ = lock.Unlock()
+	return false, true
+}
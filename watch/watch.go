@@ -0,0 +1,414 @@
+// Package watch reports changes to files and directories, and the release of
+// file locks.
+//
+// Changes are reported by the system: inotify on Linux, kqueue on macOS and the
+// BSDs, ReadDirectoryChangesW on Windows, and by polling the directories elsewhere.
+// With kqueue, the Watcher keeps open the watched directories and their regular
+// files, and lists a directory again when its entries change. For lock files
+// registered with WatchLock, the Watcher also emits a LockReleased event when the
+// lock is released, so waiters and observers can react immediately instead of
+// polling the lock.
+//
+// Whether a lock is held is found by probing it. On Linux, the flock(2) locks are
+// looked up in /proc/locks, without opening or locking the file. Elsewhere, and on
+// Linux if /proc/locks cannot be read, the probe opens the file and takes and
+// immediately releases an exclusive lock on it, without blocking: a concurrent
+// non-blocking Lock of the same file may then fail during the probe, like it would
+// against any other contender.
+//
+// The lock files are probed every poll interval, in which case a lock taken and
+// released between two probes is not reported. On Linux and FreeBSD they are also
+// probed when a holder closes them, whether it opened them for writing or
+// read-only, so most releases are reported at once: only the releases of holders
+// keeping the file open, such as the locks created with filelock.WithKeepOpen, wait
+// for the poll. Where the probe opens the file, its own closes are counted so they
+// do not trigger another probe; when the system merges the close of a read-only
+// holder with the close of a probe into a single event, as inotify does for
+// identical consecutive events, that release also waits for the poll.
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is the default interval of the polling done where the
+// system does not report the changes needed
+const DefaultPollInterval = 100 * time.Millisecond
+
+// Op describes a change
+type Op uint32
+
+const (
+	// Create is reported when a file is created or renamed into a watched directory
+	Create Op = 1 << iota
+
+	// Write is reported when the content of a file changes
+	Write
+
+	// Remove is reported when a file is removed
+	Remove
+
+	// Rename is reported when a file is renamed, for its old name
+	Rename
+
+	// Chmod is reported when the attributes of a file change
+	Chmod
+
+	// LockReleased is reported when a lock file registered with WatchLock is no
+	// longer locked by anyone
+	LockReleased
+
+	// opClose is reported by the backends when a file opened for writing is closed,
+	// it is never emitted
+	opClose Op = 1 << 31
+
+	// opCloseRead is reported by the backends when a file opened read-only is
+	// closed, as done by holders such as flock(1) and by the probes, it is never
+	// emitted
+	opCloseRead Op = 1 << 30
+)
+
+var opNames = []string{"CREATE", "WRITE", "REMOVE", "RENAME", "CHMOD", "LOCK_RELEASED"}
+
+// String returns the names of the changes of op, separated by "|"
+func (op Op) String() string {
+	var names []string
+	for i, name := range opNames {
+		if op&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a change of a file
+type Event struct {
+	// Path is the path of the file, the watched directory joined with the file name
+	// for the entries of a watched directory
+	Path string
+
+	// Op is the change
+	Op Op
+}
+
+// String returns the change and the path
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Path
+}
+
+// ErrClosed is returned when using a closed Watcher
+var ErrClosed = errors.New("watcher is closed")
+
+// backend watches directories and reports the changes of their entries
+type backend interface {
+	addDir(dir string) error
+	removeDir(dir string) error
+	close() error
+
+	// reportsClose reports whether the backend reports opClose and opCloseRead
+	reportsClose() bool
+}
+
+// Watcher watches files, directories and lock files
+type Watcher struct {
+	events   chan Event
+	errors   chan error
+	interval time.Duration
+	backend  backend
+
+	mutex sync.Mutex
+	files map[string]bool // watched files
+	dirs  map[string]bool // watched directories
+	locks map[string]bool // watched lock files, and whether they were held at the last probe
+	// probeCloses counts the opCloseRead changes still to be reported for the
+	// probes of each lock file, which are not probed again
+	probeCloses map[string]int
+	// watching counts the reasons to watch each directory with the backend
+	watching map[string]int
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Option configures a Watcher
+type Option func(*Watcher)
+
+// WithPollInterval sets the interval of the polling done where the system does not
+// report the changes needed, DefaultPollInterval by default
+func WithPollInterval(interval time.Duration) Option {
+	return func(w *Watcher) {
+		w.interval = interval
+	}
+}
+
+// New creates a Watcher watching nothing
+func New(opts ...Option) (*Watcher, error) {
+	w := &Watcher{
+		events:   make(chan Event),
+		errors:   make(chan error),
+		interval: DefaultPollInterval,
+		files:    make(map[string]bool),
+		dirs:     make(map[string]bool),
+		locks:    make(map[string]bool),
+		watching: make(map[string]int),
+		done:     make(chan struct{}),
+
+		probeCloses: make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	b, err := newBackend(w.handle, w.fail, w.interval)
+	if err != nil {
+		return nil, err
+	}
+	w.backend = b
+
+	// Even when closes are reported, a holder may release without closing
+	w.wg.Add(1)
+	go w.pollLocks()
+	return w, nil
+}
+
+// Events returns the channel receiving the changes, closed by Close
+// It must be read continuously: the watch blocks until each event is received
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Errors returns the channel receiving the errors of the watch, closed by Close
+// For example, an error is sent when the system dropped events
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Add watches path: the file itself, or the entries of a directory
+func (w *Watcher) Add(path string) error {
+	path = filepath.Clean(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed() {
+		return ErrClosed
+	}
+	if info.IsDir() {
+		if w.dirs[path] {
+			return nil
+		}
+		if err := w.watch(path); err != nil {
+			return err
+		}
+		w.dirs[path] = true
+		return nil
+	}
+
+	if w.files[path] {
+		return nil
+	}
+	if err := w.watch(filepath.Dir(path)); err != nil {
+		return err
+	}
+	w.files[path] = true
+	return nil
+}
+
+// Remove stops watching path, added with Add
+func (w *Watcher) Remove(path string) error {
+	path = filepath.Clean(path)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	switch {
+	case w.dirs[path]:
+		delete(w.dirs, path)
+		return w.unwatch(path)
+	case w.files[path]:
+		delete(w.files, path)
+		return w.unwatch(filepath.Dir(path))
+	default:
+		return os.ErrNotExist
+	}
+}
+
+// WatchLock emits a LockReleased event every time the lock on the lock file at path
+// is released. The file does not need to exist, its directory does.
+func (w *Watcher) WatchLock(path string) error {
+	path = filepath.Clean(path)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed() {
+		return ErrClosed
+	}
+	if _, ok := w.locks[path]; ok {
+		return nil
+	}
+	if err := w.watch(filepath.Dir(path)); err != nil {
+		return err
+	}
+	w.locks[path] = w.probe(path)
+	return nil
+}
+
+// UnwatchLock stops watching the lock file at path, added with WatchLock
+func (w *Watcher) UnwatchLock(path string) error {
+	path = filepath.Clean(path)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, ok := w.locks[path]; !ok {
+		return os.ErrNotExist
+	}
+	delete(w.locks, path)
+	delete(w.probeCloses, path)
+	return w.unwatch(filepath.Dir(path))
+}
+
+// watch watches dir with the backend for one more reason, must be called with mutex held
+func (w *Watcher) watch(dir string) error {
+	if w.watching[dir] == 0 {
+		if err := w.backend.addDir(dir); err != nil {
+			return err
+		}
+	}
+	w.watching[dir]++
+	return nil
+}
+
+// unwatch releases a reason to watch dir, must be called with mutex held
+func (w *Watcher) unwatch(dir string) error {
+	w.watching[dir]--
+	if w.watching[dir] > 0 {
+		return nil
+	}
+	delete(w.watching, dir)
+	return w.backend.removeDir(dir)
+}
+
+// Locked reports whether the lock file at path is locked by anyone, by probing it
+// A missing file is not locked.
+func Locked(path string) bool {
+	held, _ := probe(path)
+	return held
+}
+
+// probe probes the watched lock file at path, and expects the close of the probe
+// to be reported, must be called with mutex held
+func (w *Watcher) probe(path string) bool {
+	held, opened := probe(path)
+	if opened && w.backend.reportsClose() {
+		w.probeCloses[path]++
+	}
+	return held
+}
+
+// closed reports whether Close was called
+func (w *Watcher) closed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// handle is called by the backend for every change in a watched directory
+func (w *Watcher) handle(e Event) {
+	w.mutex.Lock()
+	// A holder closing the lock file may have released it. Other changes are not
+	// probed, the probe could fail a concurrent Lock of a file just created. The
+	// probes opening the file close it too, which must not trigger another probe.
+	var released bool
+	if _, ok := w.locks[e.Path]; ok && e.Op&(opClose|opCloseRead) != 0 {
+		if e.Op&opClose == 0 && w.probeCloses[e.Path] > 0 {
+			w.probeCloses[e.Path]--
+		} else {
+			released = !w.probe(e.Path)
+			w.locks[e.Path] = !released
+		}
+	}
+	watched := w.files[e.Path] || w.dirs[filepath.Dir(e.Path)]
+	w.mutex.Unlock()
+
+	if op := e.Op &^ (opClose | opCloseRead); watched && op != 0 {
+		w.emit(Event{Path: e.Path, Op: op})
+	}
+	if released {
+		w.emit(Event{Path: e.Path, Op: LockReleased})
+	}
+}
+
+// pollLocks probes the watched lock files every interval, for backends not
+// reporting when files are closed and for holders releasing without closing
+func (w *Watcher) pollLocks() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		w.mutex.Lock()
+		var released []string
+		for path, held := range w.locks {
+			nowHeld := w.probe(path)
+			w.locks[path] = nowHeld
+			if held && !nowHeld {
+				released = append(released, path)
+			}
+		}
+		w.mutex.Unlock()
+
+		for _, path := range released {
+			w.emit(Event{Path: path, Op: LockReleased})
+		}
+	}
+}
+
+// emit sends e to the Events channel, unless the Watcher is closed
+func (w *Watcher) emit(e Event) {
+	select {
+	case w.events <- e:
+	case <-w.done:
+	}
+}
+
+// fail sends err to the Errors channel, unless the Watcher is closed
+func (w *Watcher) fail(err error) {
+	select {
+	case w.errors <- err:
+	case <-w.done:
+	}
+}
+
+// Close stops watching and closes the Events and Errors channels
+func (w *Watcher) Close() error {
+	err := ErrClosed
+	w.closeOnce.Do(func() {
+		// Under mutex, so no watch is added to the backend being closed
+		w.mutex.Lock()
+		close(w.done)
+		w.mutex.Unlock()
+
+		err = w.backend.close()
+		w.wg.Wait()
+		close(w.events)
+		close(w.errors)
+	})
+	return err
+}
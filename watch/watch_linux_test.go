@@ -0,0 +1,62 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// TestReadOnlyHolderReleased tests that the release by a holder that opened the
+// lock file read-only, as flock(1) does, is reported when it closes it, and that
+// the probes closing the file do not probe it again
+func (s *WatchTestSuite) TestReadOnlyHolderReleased() {
+	// Without polling, only the close is reported
+	s.Require().NoError(s.watcher.Close())
+	var err error
+	s.watcher, err = New(WithPollInterval(time.Hour))
+	s.Require().NoError(err)
+
+	path := filepath.Join(s.tempDir, "file.lock")
+	s.Require().NoError(os.WriteFile(path, nil, 0644))
+	s.Require().NoError(s.watcher.WatchLock(path))
+
+	for range 2 {
+		holder, err := os.Open(path)
+		s.Require().NoError(err)
+		s.Require().NoError(syscall.Flock(int(holder.Fd()), syscall.LOCK_EX))
+		reader, err := os.Open(path)
+		s.Require().NoError(err)
+		s.Require().NoError(reader.Close())
+		s.expectNone(path)
+
+		s.Require().NoError(holder.Close())
+		s.expect(path, LockReleased)
+		s.expectNone(path)
+	}
+}
+
+// TestProbeWithoutLocking tests that the locks are found without opening the lock
+// file, so a non-blocking Lock never fails because of the probe
+func (s *WatchTestSuite) TestProbeWithoutLocking() {
+	path := filepath.Join(s.tempDir, "file.lock")
+	held, opened := probe(path)
+	s.Assert().False(held)
+	s.Assert().False(opened)
+
+	holder, err := os.Create(path)
+	s.Require().NoError(err)
+	defer holder.Close()
+	held, opened = probe(path)
+	s.Assert().False(held)
+	s.Assert().False(opened)
+
+	s.Require().NoError(syscall.Flock(int(holder.Fd()), syscall.LOCK_SH))
+	held, opened = probe(path)
+	s.Assert().True(held)
+	s.Assert().False(opened, "the file was opened to probe it")
+
+	s.Require().NoError(syscall.Flock(int(holder.Fd()), syscall.LOCK_UN))
+	held, _ = probe(path)
+	s.Assert().False(held)
+}
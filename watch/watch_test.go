@@ -0,0 +1,130 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// WatchTestSuite defines a test suite for the Watcher
+type WatchTestSuite struct {
+	suite.Suite
+	tempDir string
+	watcher *Watcher
+}
+
+// SetupTest creates a temporary directory and a Watcher before each test
+func (s *WatchTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "watch-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+
+	s.watcher, err = New(WithPollInterval(10 * time.Millisecond))
+	s.Require().NoError(err)
+}
+
+// TearDownTest closes the Watcher and removes the temporary directory after each test
+func (s *WatchTestSuite) TearDownTest() {
+	_ = s.watcher.Close()
+	os.RemoveAll(s.tempDir)
+}
+
+// expect waits for an event with op for path, skipping the other events
+func (s *WatchTestSuite) expect(path string, op Op) {
+	s.T().Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e := <-s.watcher.Events():
+			if e.Path == path && e.Op&op != 0 {
+				return
+			}
+		case err := <-s.watcher.Errors():
+			s.Require().NoError(err)
+		case <-timeout:
+			s.Require().Failf("no event", "expected %s %s", op, path)
+		}
+	}
+}
+
+// expectNone asserts that no event is received for path for a while
+func (s *WatchTestSuite) expectNone(path string) {
+	s.T().Helper()
+	timeout := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case e := <-s.watcher.Events():
+			s.Require().NotEqual(path, e.Path, "unexpected event %s", e)
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// TestDirectoryEvents tests the changes reported for the entries of a watched directory
+func (s *WatchTestSuite) TestDirectoryEvents() {
+	s.Require().NoError(s.watcher.Add(s.tempDir))
+	path := filepath.Join(s.tempDir, "file.txt")
+
+	s.Require().NoError(os.WriteFile(path, []byte("one"), 0644))
+	s.expect(path, Create)
+
+	s.Require().NoError(os.WriteFile(path, []byte("two!"), 0644))
+	s.expect(path, Write)
+
+	s.Require().NoError(os.Remove(path))
+	s.expect(path, Remove)
+}
+
+// TestFileEvents tests that watching a file does not report its siblings
+func (s *WatchTestSuite) TestFileEvents() {
+	path := filepath.Join(s.tempDir, "file.txt")
+	sibling := filepath.Join(s.tempDir, "sibling.txt")
+	s.Require().NoError(os.WriteFile(path, []byte("one"), 0644))
+	s.Require().NoError(s.watcher.Add(path))
+
+	s.Require().NoError(os.WriteFile(sibling, []byte("one"), 0644))
+	s.expectNone(sibling)
+
+	s.Require().NoError(os.WriteFile(path, []byte("two!"), 0644))
+	s.expect(path, Write)
+
+	s.Require().NoError(s.watcher.Remove(path))
+	s.Require().NoError(os.WriteFile(path, []byte("three"), 0644))
+	s.expectNone(path)
+	s.Assert().ErrorIs(s.watcher.Remove(path), os.ErrNotExist)
+}
+
+// TestAddMissing tests that missing paths cannot be watched
+func (s *WatchTestSuite) TestAddMissing() {
+	s.Assert().ErrorIs(s.watcher.Add(filepath.Join(s.tempDir, "missing")), os.ErrNotExist)
+	s.Assert().Error(s.watcher.WatchLock(filepath.Join(s.tempDir, "missing", "file.lock")))
+}
+
+// TestClose tests that Close closes the channels and stops further watches
+func (s *WatchTestSuite) TestClose() {
+	s.Require().NoError(s.watcher.Add(s.tempDir))
+	s.Require().NoError(s.watcher.Close())
+
+	_, ok := <-s.watcher.Events()
+	s.Assert().False(ok)
+	_, ok = <-s.watcher.Errors()
+	s.Assert().False(ok)
+
+	s.Assert().Equal(ErrClosed, s.watcher.Close())
+	s.Assert().Equal(ErrClosed, s.watcher.Add(s.tempDir))
+}
+
+// TestOpString tests the names of the changes
+func (s *WatchTestSuite) TestOpString() {
+	s.Assert().Equal("CREATE|WRITE", (Create | Write).String())
+	s.Assert().Equal("LOCK_RELEASED /a.lock", Event{Path: "/a.lock", Op: LockReleased}.String())
+}
+
+// TestWatch runs the test suite
+func TestWatch(t *testing.T) {
+	suite.Run(t, new(WatchTestSuite))
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+
+package watch
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+	"github.com/rsgcata/go-fs/filelock/unix"
+)
+
+// TestLockReleased tests that releasing a watched lock is reported, every time
+func (s *WatchTestSuite) TestLockReleased() {
+	path := filepath.Join(s.tempDir, "file.lock")
+	s.Require().NoError(s.watcher.WatchLock(path))
+
+	for range 2 {
+		lock := unix.New(path)
+		s.Require().NoError(lock.Lock())
+		s.expectNone(path)
+
+		start := time.Now()
+		s.Require().NoError(lock.Unlock())
+		s.expect(path, LockReleased)
+		s.Assert().Less(time.Since(start), time.Second)
+	}
+}
+
+// TestSharedLockReleased tests that the release is reported once no shared holder is left
+func (s *WatchTestSuite) TestSharedLockReleased() {
+	path := filepath.Join(s.tempDir, "file.lock")
+	first := unix.New(path, filelock.WithShared())
+	second := unix.New(path, filelock.WithShared())
+	s.Require().NoError(first.Lock())
+	s.Require().NoError(second.Lock())
+	s.Require().NoError(s.watcher.WatchLock(path))
+
+	s.Require().NoError(first.Unlock())
+	s.expectNone(path)
+	s.Require().NoError(second.Unlock())
+	s.expect(path, LockReleased)
+
+	s.Require().NoError(s.watcher.UnwatchLock(path))
+	s.Require().NoError(first.Lock())
+	s.Require().NoError(first.Unlock())
+	s.expectNone(path)
+}
@@ -0,0 +1,94 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/rsgcata/go-fs/filelock"
+)
+
+// PanicError is the error returned by WithLock when the critical section panics
+type PanicError struct {
+	// Value is the value the critical section panicked with
+	Value any
+
+	// Stack is the stack trace of the panicking goroutine
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in critical section: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error, so errors.Is and errors.As
+// see through the panic
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// LockOption configures WithLock
+type LockOption func(*lockOptions)
+
+type lockOptions struct {
+	repanic bool
+	onPanic func(value any, stack []byte)
+}
+
+// WithRepanic makes WithLock panic again with the original value once the lock is
+// released, instead of returning a PanicError
+func WithRepanic() LockOption {
+	return func(o *lockOptions) {
+		o.repanic = true
+	}
+}
+
+// OnPanic calls hook with the panic value and the stack trace when the critical
+// section panics, after the lock is released, for example to report it
+func OnPanic(hook func(value any, stack []byte)) LockOption {
+	return func(o *lockOptions) {
+		o.onPanic = hook
+	}
+}
+
+// WithLock acquires lock within timeout, runs fn and releases the lock, returning
+// the errors of fn and of the release joined.
+// If fn panics, the lock is still released and the panic is returned as a
+// *PanicError, or resumed with WithRepanic, so a panicking worker never leaves the
+// lock held until the process exits.
+func WithLock(lock filelock.FileLock, timeout time.Duration, fn func() error, opts ...LockOption) (err error) {
+	var o lockOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err := lock.LockWithTimeout(timeout); err != nil {
+		return err
+	}
+	defer func() {
+		value := recover()
+		unlockErr := lock.Unlock()
+		if value == nil {
+			if unlockErr != nil {
+				err = errors.Join(err, unlockErr)
+			}
+			return
+		}
+
+		// The critical section panicked: fn returned no error
+		stack := debug.Stack()
+		if o.onPanic != nil {
+			o.onPanic(value, stack)
+		}
+		if o.repanic {
+			panic(value)
+		}
+		err = &PanicError{Value: value, Stack: stack}
+		if unlockErr != nil {
+			err = errors.Join(err, unlockErr)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,100 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsgcata/go-fs/filelock"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// WithLockTestSuite defines a test suite for WithLock
+type WithLockTestSuite struct {
+	suite.Suite
+	tempDir  string
+	lockPath string
+}
+
+// SetupTest creates a temporary directory before each test
+func (s *WithLockTestSuite) SetupTest() {
+	tempDir, err := os.MkdirTemp("", "withlock-test")
+	s.Require().NoError(err)
+	s.tempDir = tempDir
+	s.lockPath = filepath.Join(tempDir, "worker.lock")
+}
+
+// TearDownTest removes the temporary directory after each test
+func (s *WithLockTestSuite) TearDownTest() {
+	os.RemoveAll(s.tempDir)
+}
+
+// assertReleased asserts that the lock can be taken again
+func (s *WithLockTestSuite) assertReleased() {
+	lock := New(s.lockPath)
+	s.Require().NoError(lock.Lock())
+	s.Require().NoError(lock.Unlock())
+}
+
+// TestRunsUnderLock tests that fn runs holding the lock and its error is returned
+func (s *WithLockTestSuite) TestRunsUnderLock() {
+	fnErr := errors.New("failed")
+	err := WithLock(New(s.lockPath), 0, func() error {
+		s.Assert().Equal(filelock.ErrLockHeld, New(s.lockPath).Lock())
+		return fnErr
+	})
+	s.Assert().Equal(fnErr, err)
+	s.assertReleased()
+}
+
+// TestPanicIsReturned tests that a panic releases the lock and becomes a PanicError
+func (s *WithLockTestSuite) TestPanicIsReturned() {
+	cause := errors.New("nil map")
+	var hookValue any
+	var hookStack []byte
+
+	err := WithLock(New(s.lockPath), 0, func() error {
+		panic(cause)
+	}, OnPanic(func(value any, stack []byte) {
+		hookValue, hookStack = value, stack
+	}))
+
+	var panicErr *PanicError
+	s.Require().ErrorAs(err, &panicErr)
+	s.Assert().Equal(cause, panicErr.Value)
+	s.Assert().ErrorIs(err, cause)
+	s.Assert().Contains(string(panicErr.Stack), "TestPanicIsReturned")
+	s.Assert().Equal(cause, hookValue)
+	s.Assert().Equal(panicErr.Stack, hookStack)
+	s.assertReleased()
+}
+
+// TestRepanic tests that WithRepanic resumes the panic once the lock is released
+func (s *WithLockTestSuite) TestRepanic() {
+	s.Assert().PanicsWithValue("boom", func() {
+		_ = WithLock(New(s.lockPath), 0, func() error {
+			panic("boom")
+		}, WithRepanic())
+	})
+	s.assertReleased()
+}
+
+// TestLockFailure tests that fn does not run when the lock is not acquired
+func (s *WithLockTestSuite) TestLockFailure() {
+	holder := New(s.lockPath)
+	s.Require().NoError(holder.Lock())
+	defer holder.Unlock()
+
+	err := WithLock(New(s.lockPath), 0, func() error {
+		s.Fail("fn ran without the lock")
+		return nil
+	})
+	s.Assert().Equal(filelock.ErrLockHeld, err)
+}
+
+// TestWithLock runs the test suite
+func TestWithLock(t *testing.T) {
+	suite.Run(t, new(WithLockTestSuite))
+}